@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	api "github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/scanner"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+type options struct {
+	countThresholds string
+	ecrID           string
+	imageTag        string
+	logLevel        string
+	minimumSeverity string
+	multiArch       bool
+	scanScope       string
+	newestImages    int
+	numWorkers      int
+	rateLimit       float64
+	endpoint        string
+	output          string
+	profile         string
+	region          string
+	tagFilter       string
+	thresholdMode   string
+	snoozeTable     string
+	snooze          string
+	unsnooze        string
+	vulnerability   string
+	snoozeFor       time.Duration
+	reason          string
+	packageInclude  string
+	packageExclude  string
+}
+
+// section is a titled list of repositories in the output
+type section struct {
+	Title        string        `json:"title"`
+	Repositories []*repository `json:"repositories"`
+}
+
+type repository struct {
+	Name            string           `json:"name"`
+	Platform        string           `json:"platform,omitempty"`
+	Link            string           `json:"link,omitempty"`
+	Tag             string           `json:"tag,omitempty"`
+	Digest          string           `json:"digest,omitempty"`
+	ImageTags       []string         `json:"imageTags,omitempty"`
+	RegistryID      string           `json:"registryId,omitempty"`
+	PushedAt        *time.Time       `json:"pushedAt,omitempty"`
+	ScanCompletedAt *time.Time       `json:"scanCompletedAt,omitempty"`
+	WorstSeverity   string           `json:"worstSeverity,omitempty"`
+	Findings        map[string]int64 `json:"findings,omitempty"`
+	Cause           string           `json:"cause,omitempty"`
+}
+
+func parseFlags() options {
+	var o options
+	flag.StringVar(&o.region, "region", os.Getenv("AWS_REGION"), "AWS region of the registry, taken from the profile when empty")
+	flag.StringVar(&o.profile, "profile", os.Getenv("AWS_PROFILE"), "AWS shared config profile")
+	flag.StringVar(&o.endpoint, "endpoint-url", os.Getenv("AWS_ENDPOINT_URL"), "Endpoint URL of every AWS service, e.g.: http://localhost:4566 for LocalStack")
+	flag.StringVar(&o.ecrID, "registry", "", "ECR registry ID, the account's default registry when empty")
+	flag.StringVar(&o.imageTag, "tag", "latest", "Image tag whose scan findings are checked")
+	flag.StringVar(&o.minimumSeverity, "minimum-severity", "CRITICAL", "Minimum severity level which should be reported")
+	flag.StringVar(&o.countThresholds, "count-thresholds", "", "Comma separated finding counts per severity, e.g.: CRITICAL=1,HIGH=5")
+	flag.StringVar(&o.thresholdMode, "threshold-mode", severity.ThresholdModeScore, "How score and count thresholds combine: "+strings.Join(severity.ThresholdModes, ", "))
+	flag.StringVar(&o.tagFilter, "tag-filter", "", "Comma separated list of resource tags a repository must carry, e.g.: scan=true,team")
+	flag.StringVar(&o.packageInclude, "package-include", "", "Comma separated package name patterns, only their findings are counted, e.g.: openssl*,log4j*")
+	flag.StringVar(&o.packageExclude, "package-exclude", "", "Comma separated package name patterns whose findings aren't counted, e.g.: kernel-headers")
+	flag.BoolVar(&o.multiArch, "multi-arch", false, "Check each platform of multi-architecture images separately")
+	flag.StringVar(&o.scanScope, "scan-scope", api.ScanScopeTag, "Images checked per repository: tag, the image tagged -tag, or all-tagged, every tagged image")
+	flag.IntVar(&o.newestImages, "newest", 0, "With -scan-scope all-tagged, check only this many of the most recently pushed images, every one when zero")
+	flag.IntVar(&o.numWorkers, "workers", 4, "Number of goroutines spawned")
+	flag.Float64Var(&o.rateLimit, "rate-limit", 0, "ECR API requests per second across every worker, unlimited when zero")
+	flag.StringVar(&o.output, "output", "table", "Output format: table or json")
+	flag.StringVar(&o.logLevel, "log-level", "ERROR", "Log level, logs are written to stderr")
+	flag.StringVar(&o.snoozeTable, "snooze-table", os.Getenv("SNOOZE_TABLE"), "DynamoDB table of snoozes, snoozed repositories and vulnerabilities are left out when set")
+	flag.StringVar(&o.snooze, "snooze", "", "Snooze the repository (pattern) in -snooze-table instead of scanning")
+	flag.StringVar(&o.unsnooze, "unsnooze", "", "End the snooze of the repository (pattern) in -snooze-table instead of scanning")
+	flag.StringVar(&o.vulnerability, "vulnerability", "", "Snooze or unsnooze only this vulnerability of the repository, e.g.: CVE-2021-44228")
+	flag.DurationVar(&o.snoozeFor, "snooze-for", 7*24*time.Hour, "How long the snooze lasts")
+	flag.StringVar(&o.reason, "reason", "", "Why the repository is snoozed, required by -snooze")
+	flag.Parse()
+	return o
+}
+
+func run(o options, out io.Writer) error {
+	if o.output != "table" && o.output != "json" {
+		return fmt.Errorf("Invalid output %s, expected table or json", o.output)
+	}
+	if o.scanScope != api.ScanScopeTag && o.scanScope != api.ScanScopeAllTagged {
+		return fmt.Errorf("Invalid scan scope %s, expected %s or %s", o.scanScope, api.ScanScopeTag, api.ScanScopeAllTagged)
+	}
+
+	logger, err := logger.NewConsoleLogger(o.logLevel)
+	if err != nil {
+		return err
+	}
+
+	tagFilter, err := api.ParseTagFilter(o.tagFilter)
+	if err != nil {
+		return err
+	}
+
+	countThresholds, err := severity.ParseCountThresholds(o.countThresholds)
+	if err != nil {
+		return err
+	}
+
+	sess, err := api.NewSession(api.SessionConfig{
+		Region:       o.region,
+		Endpoint:     o.endpoint,
+		SharedConfig: true,
+		Profile:      o.profile,
+	})
+	if err != nil {
+		return err
+	}
+
+	region := aws.StringValue(sess.Config.Region)
+	if region == "" {
+		return fmt.Errorf("Region is not set, use -region or set it in the profile")
+	}
+
+	var snoozes *api.SnoozeStore
+	if o.snoozeTable != "" {
+		snoozes = api.NewSnoozeStore(o.snoozeTable, dynamodb.New(sess))
+	}
+	if o.snooze != "" || o.unsnooze != "" {
+		return updateSnooze(o, snoozes, out)
+	}
+
+	serviceOptions := api.Options{
+		TagFilter:            tagFilter,
+		ResolveManifestLists: o.multiArch,
+		ScanScope:            o.scanScope,
+		NewestImages:         o.newestImages,
+		CountThresholds:      countThresholds,
+		ThresholdMode:        o.thresholdMode,
+		PackageFilters:       api.ParsePackageFilter(o.packageInclude, o.packageExclude),
+	}
+	if snoozes != nil {
+		if serviceOptions.Snoozes, err = snoozes.List(); err != nil {
+			return err
+		}
+	}
+	client := ecr.New(sess)
+	if o.rateLimit > 0 {
+		api.LimitRequests(client.Client, api.NewRateLimiter(o.rateLimit))
+	}
+	report, err := scanner.Scan(context.Background(), scanner.Options{
+		Client:          client,
+		RegistryID:      o.ecrID,
+		Region:          region,
+		ImageTag:        o.imageTag,
+		MinimumSeverity: o.minimumSeverity,
+		Workers:         o.numWorkers,
+		Service:         serviceOptions,
+		Logger:          logger,
+	})
+	if err != nil {
+		return err
+	}
+	report.SortBySeverity()
+
+	if o.output == "json" {
+		return writeJSON(out, report)
+	}
+	return writeTable(out, report)
+}
+
+// updateSnooze snoozes or unsnoozes a repository, or a vulnerability of it
+func updateSnooze(o options, snoozes *api.SnoozeStore, out io.Writer) error {
+	if snoozes == nil {
+		return fmt.Errorf("Snoozes are stored in a DynamoDB table, set -snooze-table")
+	}
+
+	if o.unsnooze != "" {
+		if err := snoozes.Delete(o.unsnooze, o.vulnerability); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Unsnoozed %s\n", snoozeTarget(o.unsnooze, o.vulnerability))
+		return nil
+	}
+
+	if o.reason == "" {
+		return fmt.Errorf("Set -reason to tell why %s is snoozed", o.snooze)
+	}
+	if o.snoozeFor <= 0 {
+		return fmt.Errorf("Invalid -snooze-for %s, expected a positive duration", o.snoozeFor)
+	}
+	until := time.Now().Add(o.snoozeFor).UTC()
+	err := snoozes.Put(report.Snooze{
+		Repository:    o.snooze,
+		Vulnerability: o.vulnerability,
+		Until:         until,
+		Reason:        o.reason,
+		By:            os.Getenv("USER"),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Snoozed %s until %s\n", snoozeTarget(o.snooze, o.vulnerability), until.Format(time.RFC3339))
+	return nil
+}
+
+func snoozeTarget(repository string, vulnerability string) string {
+	if vulnerability == "" {
+		return repository
+	}
+	return vulnerability + " of " + repository
+}
+
+// sections returns the repository lists of the report in display order
+func sections(report *api.Report) []section {
+	return []section{
+		{Title: "Vulnerable", Repositories: repositories(report.Filtered)},
+		{Title: "Failed", Repositories: repositories(report.Failed)},
+		{Title: "Empty", Repositories: repositories(report.Empty)},
+		{Title: "Not scanned", Repositories: repositories(report.NotScanned)},
+		{Title: "Scan on push disabled", Repositories: repositories(report.ScanOnPushDisabled)},
+		{Title: "Not covered by scanning rules", Repositories: repositories(report.NotCovered)},
+		{Title: "Snoozed", Repositories: repositories(report.Snoozed)},
+	}
+}
+
+func repositories(infos []*api.RepositoryInfo) []*repository {
+	list := []*repository{}
+	for _, r := range infos {
+		repo := &repository{
+			Name:          r.Name,
+			Platform:      r.Platform,
+			Link:          r.Link,
+			Tag:           r.Tag,
+			Digest:        r.Digest,
+			ImageTags:     r.ImageTags,
+			RegistryID:    r.RegistryID,
+			WorstSeverity: r.WorstSeverity(),
+			Cause:         r.Cause,
+		}
+		if !r.PushedAt.IsZero() {
+			repo.PushedAt = &r.PushedAt
+		}
+		if !r.ScanCompletedAt.IsZero() {
+			repo.ScanCompletedAt = &r.ScanCompletedAt
+		}
+		for k, v := range r.ReportedSeverity().Count {
+			if repo.Findings == nil {
+				repo.Findings = map[string]int64{}
+			}
+			repo.Findings[k] = aws.Int64Value(v)
+		}
+		list = append(list, repo)
+	}
+	return list
+}
+
+func writeJSON(out io.Writer, report *api.Report) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		ScanType string    `json:"scanType"`
+		Sections []section `json:"sections"`
+	}{
+		ScanType: report.ScanType,
+		Sections: sections(report),
+	})
+}
+
+// displayName returns the repository name, suffixed with the tags of the image with -scan-scope all-tagged,
+// and with the platform for multi-architecture images
+func (r *repository) displayName() string {
+	name := r.Name
+	if len(r.ImageTags) > 0 {
+		name += ":" + strings.Join(r.ImageTags, ",")
+	}
+	if r.Platform == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, r.Platform)
+}
+
+// shortDigest returns the first 12 hex digits of the image digest, the way docker lists images, - when unknown
+func (r *repository) shortDigest() string {
+	hex := strings.TrimPrefix(r.Digest, "sha256:")
+	if hex == "" {
+		return "-"
+	}
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
+
+func writeTable(out io.Writer, report *api.Report) error {
+	all := sections(report)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "REPOSITORY\tDIGEST\t%s\n", strings.Join(severity.SeverityList, "\t"))
+	for _, r := range all[0].Repositories {
+		counts := make([]string, len(severity.SeverityList))
+		for i, key := range severity.SeverityList {
+			counts[i] = "-"
+			if count, ok := r.Findings[key]; ok {
+				counts[i] = strconv.FormatInt(count, 10)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.displayName(), r.shortDigest(), strings.Join(counts, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, s := range all[1:] {
+		if len(s.Repositories) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s:\n", s.Title)
+		for _, r := range s.Repositories {
+			fmt.Fprintf(out, "  %s\n", r.displayName())
+		}
+	}
+	return nil
+}
+
+func main() {
+	if err := run(parseFlags(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -4,7 +4,7 @@ go 1.12
 
 require (
 	github.com/aws/aws-lambda-go v1.17.0
-	github.com/aws/aws-sdk-go v1.26.8
+	github.com/aws/aws-sdk-go v1.44.334
 	github.com/facebookgo/ensure v0.0.0-20200202191622-63f1cf65ac4c // indirect
 	github.com/facebookgo/stack v0.0.0-20160209184415-751773369052 // indirect
 	github.com/facebookgo/subset v0.0.0-20200203212716-c811ad88dec4 // indirect
@@ -13,4 +13,5 @@ require (
 	github.com/nlopes/slack v0.6.0
 	github.com/onsi/ginkgo v1.14.0 // indirect
 	go.uber.org/zap v1.15.0
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// Annotations BuildKit adds to image manifests about the image the build started from
+const (
+	annotationBaseName   = "org.opencontainers.image.base.name"
+	annotationBaseDigest = "org.opencontainers.image.base.digest"
+)
+
+type imageManifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		Digest string `json:"digest"`
+	} `json:"layers"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// getManifest returns the manifest of a single architecture image
+func (s *ECRService) getManifest(registryID string, repositoryName string, imageID *ecr.ImageIdentifier) (*imageManifest, error) {
+	input := ecr.BatchGetImageInput{
+		AcceptedMediaTypes: aws.StringSlice([]string{mediaTypeDockerManifest, mediaTypeOCIImageManifest}),
+		ImageIds:           []*ecr.ImageIdentifier{imageID},
+		RepositoryName:     aws.String(repositoryName),
+	}
+	if len(registryID) != 0 {
+		input.RegistryId = aws.String(registryID)
+	}
+
+	output, err := s.client.BatchGetImage(&input)
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Images) == 0 {
+		return nil, fmt.Errorf("Image of repository %s not found", repositoryName)
+	}
+
+	var manifest imageManifest
+	if err := json.Unmarshal([]byte(aws.StringValue(output.Images[0].ImageManifest)), &manifest); err != nil {
+		return nil, fmt.Errorf("Error parsing manifest: %s", err)
+	}
+	return &manifest, nil
+}
+
+// parseImageReference splits an image reference of an ECR registry in the region into registry ID, repository and image.
+// ok is false for images of other registries.
+func parseImageReference(reference string, region string) (registryID string, repository string, imageID *ecr.ImageIdentifier, ok bool) {
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) != 2 {
+		return "", "", nil, false
+	}
+	host := strings.Split(parts[0], ".")
+	if len(host) < 6 || host[1] != "dkr" || host[2] != "ecr" || host[3] != region {
+		return "", "", nil, false
+	}
+
+	repository, tag := parts[1], "latest"
+	if i := strings.Index(repository, "@"); i >= 0 {
+		return host[0], repository[:i], &ecr.ImageIdentifier{ImageDigest: aws.String(repository[i+1:])}, true
+	}
+	if i := strings.LastIndex(repository, ":"); i >= 0 {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	return host[0], repository, &ecr.ImageIdentifier{ImageTag: aws.String(tag)}, true
+}
+
+// attributeBaseImage notes the base image of the repository's image, as recorded in the manifest annotations.
+// With enhanced scanning and the base image in the same registry, findings are counted by whether the vulnerable
+// package comes from a layer of the base image or one added on top of it.
+func (s *ECRService) attributeBaseImage(info *RepositoryInfo, digest string) {
+	manifest, err := s.getManifest(s.registryID, info.Name, &ecr.ImageIdentifier{ImageDigest: aws.String(digest)})
+	if err != nil {
+		s.logger.Errorf("Error getting manifest of repository %s: %s", info.Name, err.Error())
+		return
+	}
+
+	info.BaseImage = manifest.Annotations[annotationBaseName]
+	if info.BaseImage == "" || s.scanType != ecr.ScanTypeEnhanced {
+		return
+	}
+
+	registryID, repository, baseID, ok := parseImageReference(info.BaseImage, s.region)
+	if !ok {
+		return
+	}
+	if baseDigest := manifest.Annotations[annotationBaseDigest]; baseDigest != "" {
+		baseID = &ecr.ImageIdentifier{ImageDigest: aws.String(baseDigest)}
+	}
+	base, err := s.getManifest(registryID, repository, baseID)
+	if err != nil {
+		s.logger.Errorf("Error getting manifest of base image %s: %s", info.BaseImage, err.Error())
+		return
+	}
+
+	baseLayers := make(map[string]bool)
+	for _, l := range base.Layers {
+		baseLayers[l.Digest] = true
+	}
+
+	err = s.enhancedFindings(info.Name, digest, func(finding *ecr.EnhancedImageScanFinding) {
+		if !severity.Reaches(aws.StringValue(finding.Severity), info.MinimumSeverity) {
+			return
+		}
+		if fromBaseImage(finding, baseLayers) {
+			info.BaseImageFindings++
+		} else {
+			info.ApplicationFindings++
+		}
+	})
+	if err != nil {
+		s.logger.Errorf("Error listing findings of repository %s: %s", info.Name, err.Error())
+		info.BaseImageFindings, info.ApplicationFindings = 0, 0
+	}
+}
+
+// fromBaseImage reports whether every vulnerable package of the finding is in a layer of the base image
+func fromBaseImage(finding *ecr.EnhancedImageScanFinding, baseLayers map[string]bool) bool {
+	if finding.PackageVulnerabilityDetails == nil || len(finding.PackageVulnerabilityDetails.VulnerablePackages) == 0 {
+		return false
+	}
+	for _, p := range finding.PackageVulnerabilityDetails.VulnerablePackages {
+		if !baseLayers[aws.StringValue(p.SourceLayerHash)] {
+			return false
+		}
+	}
+	return true
+}
+
+// enhancedFindings calls fn with each enhanced scanning finding of the image
+func (s *ECRService) enhancedFindings(repositoryName string, digest string, fn func(*ecr.EnhancedImageScanFinding)) error {
+	input := ecr.DescribeImageScanFindingsInput{
+		ImageId:        &ecr.ImageIdentifier{ImageDigest: aws.String(digest)},
+		RepositoryName: aws.String(repositoryName),
+		MaxResults:     aws.Int64(1000),
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	for {
+		output, err := s.findingsSource().DescribeImageScanFindings(&input)
+		if err != nil {
+			return err
+		}
+		if output.ImageScanFindings != nil {
+			for _, finding := range output.ImageScanFindings.EnhancedFindings {
+				fn(finding)
+			}
+		}
+		if output.NextToken == nil {
+			return nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
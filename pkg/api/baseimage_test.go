@@ -0,0 +1,112 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+const (
+	testBaseName = "123456789012.dkr.ecr.us-east-1.amazonaws.com/golden/alpine:3.18"
+	testAppImage = `{"schemaVersion": 2, "layers": [{"digest": "sha256:base"}, {"digest": "sha256:app"}],
+		"annotations": {"org.opencontainers.image.base.name": "` + testBaseName + `"}}`
+	testBaseImage = `{"schemaVersion": 2, "layers": [{"digest": "sha256:base"}]}`
+)
+
+// baseImageECRService serves an image built on golden/alpine with findings in both layers
+type baseImageECRService struct {
+	mockECRService
+}
+
+func (m baseImageECRService) BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error) {
+	manifest := testAppImage
+	if *input.RepositoryName == "golden/alpine" {
+		manifest = testBaseImage
+	}
+	return &ecr.BatchGetImageOutput{
+		Images: []*ecr.Image{{ImageManifest: aws.String(manifest), ImageManifestMediaType: aws.String(mediaTypeOCIImageManifest)}},
+	}, nil
+}
+
+func (m baseImageECRService) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	finding := func(level string, layer string) *ecr.EnhancedImageScanFinding {
+		return &ecr.EnhancedImageScanFinding{
+			Severity: aws.String(level),
+			PackageVulnerabilityDetails: &ecr.PackageVulnerabilityDetails{
+				VulnerablePackages: []*ecr.VulnerablePackage{{SourceLayerHash: aws.String(layer)}},
+			},
+		}
+	}
+
+	// Findings are served on two pages
+	if input.NextToken == nil {
+		return &ecr.DescribeImageScanFindingsOutput{
+			ImageScanFindings: &ecr.ImageScanFindings{EnhancedFindings: []*ecr.EnhancedImageScanFinding{
+				finding("CRITICAL", "sha256:base"),
+				finding("HIGH", "sha256:base"),
+			}},
+			NextToken: aws.String("next"),
+		}, nil
+	}
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageScanFindings: &ecr.ImageScanFindings{EnhancedFindings: []*ecr.EnhancedImageScanFinding{
+			finding("HIGH", "sha256:app"),
+			finding("LOW", "sha256:app"),
+		}},
+	}, nil
+}
+
+func TestAttributeBaseImage(t *testing.T) {
+	cases := []struct {
+		scanType    string
+		minimum     string
+		base        int
+		application int
+	}{
+		{scanType: ecr.ScanTypeEnhanced, minimum: "", base: 2, application: 2},
+		{scanType: ecr.ScanTypeEnhanced, minimum: "HIGH", base: 2, application: 1},
+		// Basic scanning findings don't tell the layer of the package
+		{scanType: ecr.ScanTypeBasic, minimum: "", base: 0, application: 0},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("123456789012", "us-east-1", "latest", Options{}, service.logger, baseImageECRService{})
+		s.scanType = c.scanType
+
+		info := &RepositoryInfo{Name: "TestRepo/Test1", MinimumSeverity: c.minimum}
+		s.attributeBaseImage(info, "sha256:image")
+
+		if info.BaseImage != testBaseName {
+			t.Fatalf("[%d] values are not equal, wanting: %s, got: %s", i, testBaseName, info.BaseImage)
+		}
+		if info.BaseImageFindings != c.base || info.ApplicationFindings != c.application {
+			t.Fatalf("[%d] Expected %d base image and %d application findings, got: %d and %d", i, c.base, c.application, info.BaseImageFindings, info.ApplicationFindings)
+		}
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	cases := []struct {
+		reference  string
+		registryID string
+		repository string
+		imageID    *ecr.ImageIdentifier
+		ok         bool
+	}{
+		{reference: testBaseName, registryID: "123456789012", repository: "golden/alpine", imageID: &ecr.ImageIdentifier{ImageTag: aws.String("3.18")}, ok: true},
+		{reference: "123456789012.dkr.ecr.us-east-1.amazonaws.com/golden/alpine", registryID: "123456789012", repository: "golden/alpine", imageID: &ecr.ImageIdentifier{ImageTag: aws.String("latest")}, ok: true},
+		{reference: "123456789012.dkr.ecr.us-east-1.amazonaws.com/golden/alpine@sha256:abc", registryID: "123456789012", repository: "golden/alpine", imageID: &ecr.ImageIdentifier{ImageDigest: aws.String("sha256:abc")}, ok: true},
+		{reference: "123456789012.dkr.ecr.eu-west-1.amazonaws.com/golden/alpine:3.18"},
+		{reference: "docker.io/library/alpine:3.18"},
+		{reference: "alpine"},
+	}
+
+	for i, c := range cases {
+		registryID, repository, imageID, ok := parseImageReference(c.reference, "us-east-1")
+		if registryID != c.registryID || repository != c.repository || !reflect.DeepEqual(imageID, c.imageID) || ok != c.ok {
+			t.Fatalf("[%d] Unexpected result for %s: %s, %s, %v, %t", i, c.reference, registryID, repository, imageID, ok)
+		}
+	}
+}
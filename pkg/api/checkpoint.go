@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Checkpoint holds the progress of a report spanning multiple invocations
+type Checkpoint struct {
+	// Repositories already gathered
+	Processed []string
+	// Partial report of the processed repositories
+	Report *Report
+	// Number of invocations so far
+	Invocations int
+}
+
+// CheckpointStore keeps checkpoints as JSON objects under an S3 prefix, one per resume token
+type CheckpointStore struct {
+	client s3iface.S3API
+	bucket string
+	prefix string
+}
+
+// NewCheckpointStore creates a store at an s3://bucket/prefix URI
+func NewCheckpointStore(uri string, client s3iface.S3API) (*CheckpointStore, error) {
+	bucket, prefix, err := ParseS3URI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid checkpoint URI %s, expected s3://bucket/prefix", uri)
+	}
+	return &CheckpointStore{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+func (c *CheckpointStore) key(token string) string {
+	return c.prefix + token + ".json"
+}
+
+// Save stores the checkpoint under token, replacing the previous one
+func (c *CheckpointStore) Save(token string, checkpoint *Checkpoint) error {
+	body, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(c.key(token)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// Load fetches the checkpoint stored under token
+func (c *CheckpointStore) Load(token string) (*Checkpoint, error) {
+	output, err := c.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.key(token)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching checkpoint %s: %s", token, err)
+	}
+	defer output.Body.Close()
+
+	var checkpoint Checkpoint
+	if err := json.NewDecoder(output.Body).Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("Error parsing checkpoint %s: %s", token, err)
+	}
+	if checkpoint.Report == nil {
+		checkpoint.Report = &Report{}
+	}
+	return &checkpoint, nil
+}
+
+// Delete removes the checkpoint stored under token
+func (c *CheckpointStore) Delete(token string) error {
+	_, err := c.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.key(token)),
+	})
+	return err
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type mockS3Service struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (m *mockS3Service) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	body, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[*input.Bucket+"/"+*input.Key] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockS3Service) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	body, ok := m.objects[*input.Bucket+"/"+*input.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func (m *mockS3Service) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	delete(m.objects, *input.Bucket+"/"+*input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestNewCheckpointStore(t *testing.T) {
+	cases := []struct {
+		uri      string
+		expected string
+	}{
+		{uri: "s3://bucket/checkpoints/", expected: "checkpoints/run.json"},
+		{uri: "s3://bucket", expected: "run.json"},
+	}
+	for i, c := range cases {
+		store, err := NewCheckpointStore(c.uri, &mockS3Service{})
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", i, err)
+		}
+		if key := store.key("run"); key != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %s, got: %s", i, c.expected, key)
+		}
+	}
+
+	if _, err := NewCheckpointStore("bucket/checkpoints", &mockS3Service{}); err == nil {
+		t.Fatalf("Expected invalid URI error")
+	}
+}
+
+func TestCheckpointStore(t *testing.T) {
+	client := &mockS3Service{objects: map[string][]byte{}}
+	store, err := NewCheckpointStore("s3://bucket/checkpoints", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint := &Checkpoint{
+		Processed:   []string{"team-a/api", "team-a/worker"},
+		Report:      &Report{ScanType: "BASIC", Filtered: []*RepositoryInfo{{Name: "team-a/api", Link: "https://console.aws.amazon.com"}}},
+		Invocations: 1,
+	}
+	if err := store.Save("run", checkpoint); err != nil {
+		t.Fatalf("Error saving checkpoint: %s", err)
+	}
+	if _, ok := client.objects["bucket/checkpoints/run.json"]; !ok {
+		t.Fatalf("Expected checkpoint to be stored under the prefix, got: %v", client.objects)
+	}
+
+	loaded, err := store.Load("run")
+	if err != nil {
+		t.Fatalf("Error loading checkpoint: %s", err)
+	}
+	if !reflect.DeepEqual(loaded, checkpoint) {
+		t.Fatalf("values not equal, wanting: %+v, got: %+v", checkpoint, loaded)
+	}
+
+	if err := store.Delete("run"); err != nil {
+		t.Fatalf("Error deleting checkpoint: %s", err)
+	}
+	if _, err := store.Load("run"); err == nil {
+		t.Fatalf("Expected error loading deleted checkpoint")
+	}
+}
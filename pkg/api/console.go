@@ -0,0 +1,22 @@
+package api
+
+import (
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// consoleDomains maps AWS partitions to their management console domain
+var consoleDomains = map[string]string{
+	endpoints.AwsPartitionID:      "console.aws.amazon.com",
+	endpoints.AwsCnPartitionID:    "console.amazonaws.cn",
+	endpoints.AwsUsGovPartitionID: "console.amazonaws-us-gov.com",
+}
+
+// ConsoleDomain returns the management console domain of the partition the region belongs to
+func ConsoleDomain(region string) string {
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		if domain, ok := consoleDomains[partition.ID()]; ok {
+			return domain
+		}
+	}
+	return consoleDomains[endpoints.AwsPartitionID]
+}
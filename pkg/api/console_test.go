@@ -0,0 +1,24 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestConsoleDomain(t *testing.T) {
+	cases := []struct {
+		region   string
+		expected string
+	}{
+		{region: "us-east-1", expected: "console.aws.amazon.com"},
+		{region: "eu-central-1", expected: "console.aws.amazon.com"},
+		{region: "us-gov-west-1", expected: "console.amazonaws-us-gov.com"},
+		{region: "cn-north-1", expected: "console.amazonaws.cn"},
+		{region: "", expected: "console.aws.amazon.com"},
+	}
+
+	for i, c := range cases {
+		if domain := ConsoleDomain(c.region); domain != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %s, got: %s", i, c.expected, domain)
+		}
+	}
+}
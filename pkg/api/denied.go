@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// AuthorizationDecoder decodes the encoded authorization failure messages of AccessDenied errors, satisfied by the STS client
+type AuthorizationDecoder interface {
+	DecodeAuthorizationMessage(input *sts.DecodeAuthorizationMessageInput) (*sts.DecodeAuthorizationMessageOutput, error)
+}
+
+var (
+	// e.g.: User: arn:aws:sts::123456789012:assumed-role/ecr-scan/fn is not authorized to perform: ecr:DescribeImageScanFindings
+	// on resource: arn:aws:ecr:eu-west-1:123456789012:repository/team-a/api because no identity-based policy allows the ecr:DescribeImageScanFindings action
+	deniedMessage  = regexp.MustCompile(`not authorized to perform: (\S+)(?: on resource: (\S+))?(?: (?:because|with) (.+))?`)
+	encodedMessage = regexp.MustCompile(`Encoded authorization failure message: (\S+)`)
+)
+
+// decodedAuthorization is the part of a decoded authorization failure message telling what was denied
+type decodedAuthorization struct {
+	ExplicitDeny bool `json:"explicitDeny"`
+	Context      struct {
+		Action   string `json:"action"`
+		Resource string `json:"resource"`
+	} `json:"context"`
+}
+
+// diagnose notes and logs the permission a repository failing with AccessDenied was missing
+func (s *ECRService) diagnose(info *RepositoryInfo, err error) {
+	if info.Cause != report.CauseAccessDenied {
+		return
+	}
+	info.Denied = s.denial(err)
+	if info.Denied == nil {
+		s.logger.Errorf("Access denied to repository %s, the error doesn't tell which permission is missing: %s", info.Name, err.Error())
+		return
+	}
+	message := "Access denied to repository %s, missing %s"
+	args := []interface{}{info.Name, info.Denied.Action}
+	if info.Denied.Resource != "" {
+		message += " on %s"
+		args = append(args, info.Denied.Resource)
+	}
+	if info.Denied.Reason != "" {
+		message += " (%s)"
+		args = append(args, info.Denied.Reason)
+	}
+	s.logger.Errorf(message, args...)
+}
+
+// denial reads the permission an AccessDenied error was missing from its message, nil when the message doesn't tell.
+// Encoded messages are decoded with Options.AuthorizationDecoder, which needs sts:DecodeAuthorizationMessage.
+func (s *ECRService) denial(err error) *report.Denial {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return nil
+	}
+	if m := deniedMessage.FindStringSubmatch(aerr.Message()); m != nil {
+		return &report.Denial{Action: m[1], Resource: m[2], Reason: strings.TrimSuffix(strings.TrimSpace(m[3]), ".")}
+	}
+
+	m := encodedMessage.FindStringSubmatch(aerr.Message())
+	if m == nil || s.options.AuthorizationDecoder == nil {
+		return nil
+	}
+	output, err := s.options.AuthorizationDecoder.DecodeAuthorizationMessage(&sts.DecodeAuthorizationMessageInput{
+		EncodedMessage: aws.String(m[1]),
+	})
+	if err != nil {
+		s.logger.Debugf("Error decoding authorization failure message: %s", err.Error())
+		return nil
+	}
+	var decoded decodedAuthorization
+	if err := json.Unmarshal([]byte(aws.StringValue(output.DecodedMessage)), &decoded); err != nil || decoded.Context.Action == "" {
+		return nil
+	}
+	denial := &report.Denial{Action: decoded.Context.Action, Resource: decoded.Context.Resource}
+	if decoded.ExplicitDeny {
+		denial.Reason = "an explicit deny"
+	}
+	return denial
+}
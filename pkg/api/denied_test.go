@@ -0,0 +1,76 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// fakeDecoder decodes the message "encoded" and fails to decode any other
+type fakeDecoder struct{}
+
+func (fakeDecoder) DecodeAuthorizationMessage(input *sts.DecodeAuthorizationMessageInput) (*sts.DecodeAuthorizationMessageOutput, error) {
+	if aws.StringValue(input.EncodedMessage) != "encoded" {
+		return nil, awserr.New("AccessDenied", "not authorized to perform: sts:DecodeAuthorizationMessage", nil)
+	}
+	return &sts.DecodeAuthorizationMessageOutput{DecodedMessage: aws.String(`{"allowed":false,"explicitDeny":true,
+		"context":{"action":"kms:Decrypt","resource":"arn:aws:kms:us-east-1:123456789012:key/1234"}}`)}, nil
+}
+
+func TestDenial(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected *report.Denial
+	}{
+		{
+			err: awserr.New("AccessDeniedException", "User: arn:aws:sts::123456789012:assumed-role/ecr-scan/fn is not authorized to perform: "+
+				"ecr:DescribeImageScanFindings on resource: arn:aws:ecr:us-east-1:123456789012:repository/team-a/api "+
+				"because no identity-based policy allows the ecr:DescribeImageScanFindings action", nil),
+			expected: &report.Denial{
+				Action:   "ecr:DescribeImageScanFindings",
+				Resource: "arn:aws:ecr:us-east-1:123456789012:repository/team-a/api",
+				Reason:   "no identity-based policy allows the ecr:DescribeImageScanFindings action",
+			},
+		},
+		{
+			err: awserr.New("AccessDeniedException", "User: arn:aws:iam::123456789012:user/ci is not authorized to perform: ecr:BatchGetImage "+
+				"with an explicit deny in a resource-based policy.", nil),
+			expected: &report.Denial{Action: "ecr:BatchGetImage", Reason: "an explicit deny in a resource-based policy"},
+		},
+		{
+			err:      awserr.New("AccessDeniedException", "Access denied. Encoded authorization failure message: encoded", nil),
+			expected: &report.Denial{Action: "kms:Decrypt", Resource: "arn:aws:kms:us-east-1:123456789012:key/1234", Reason: "an explicit deny"},
+		},
+		// Without the permission to decode the message, it doesn't tell
+		{err: awserr.New("AccessDeniedException", "Encoded authorization failure message: other", nil)},
+		{err: awserr.New("UnrecognizedClientException", "The security token included in the request is invalid", nil)},
+		{err: fmt.Errorf("access denied")},
+	}
+
+	s := NewECRService("123456789012", "us-east-1", "latest", Options{AuthorizationDecoder: fakeDecoder{}}, service.logger, mockECRService{})
+	for i, c := range cases {
+		if denial := s.denial(c.err); !reflect.DeepEqual(denial, c.expected) {
+			t.Fatalf("[%d] values are not equal, wanting: %+v, got: %+v", i, c.expected, denial)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	err := awserr.New("AccessDeniedException", "is not authorized to perform: ecr:DescribeImageScanFindings", nil)
+
+	info := &RepositoryInfo{Name: "team-a/api", Cause: report.CauseAccessDenied}
+	if service.diagnose(info, err); info.Denied == nil || info.Denied.Action != "ecr:DescribeImageScanFindings" {
+		t.Fatalf("Expected the missing permission to be noted, got: %+v", info.Denied)
+	}
+
+	// Only access denied failures are diagnosed
+	info = &RepositoryInfo{Name: "team-a/api", Cause: report.CauseThrottling}
+	if service.diagnose(info, err); info.Denied != nil {
+		t.Fatalf("Expected no permission to be noted, got: %+v", info.Denied)
+	}
+}
@@ -4,28 +4,114 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ecr"
-	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
 )
 
+// ECRClient is the part of the ECR API used by ECRService, satisfied by *ecr.ECR
+type ECRClient interface {
+	BatchGetImage(*ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error)
+	DescribeImageScanFindings(*ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error)
+	DescribeImages(*ecr.DescribeImagesInput) (*ecr.DescribeImagesOutput, error)
+	DescribePullThroughCacheRulesPages(*ecr.DescribePullThroughCacheRulesInput, func(*ecr.DescribePullThroughCacheRulesOutput, bool) bool) error
+	DescribeRepositoriesPages(*ecr.DescribeRepositoriesInput, func(*ecr.DescribeRepositoriesOutput, bool) bool) error
+	GetDownloadUrlForLayer(*ecr.GetDownloadUrlForLayerInput) (*ecr.GetDownloadUrlForLayerOutput, error)
+	GetLifecyclePolicy(*ecr.GetLifecyclePolicyInput) (*ecr.GetLifecyclePolicyOutput, error)
+	GetRegistryScanningConfiguration(*ecr.GetRegistryScanningConfigurationInput) (*ecr.GetRegistryScanningConfigurationOutput, error)
+	ListTagsForResource(*ecr.ListTagsForResourceInput) (*ecr.ListTagsForResourceOutput, error)
+	PutImageScanningConfiguration(*ecr.PutImageScanningConfigurationInput) (*ecr.PutImageScanningConfigurationOutput, error)
+	StartImageScan(*ecr.StartImageScanInput) (*ecr.StartImageScanOutput, error)
+}
+
+var _ ECRClient = (*ecr.ECR)(nil)
+
 // ECRService implements ECR API
 type ECRService struct {
-	client     ecriface.ECRAPI
-	logger     *logger.Logger
-	imageTag   string
-	region     string
-	registryID string
+	client              ECRClient
+	logger              *logger.Logger
+	imageTag            string
+	options             Options
+	pullThroughPrefixes []string
+	region              string
+	registryID          string
+	scanType            string
+	scanningRules       []*ecr.RegistryScanningRule
+	groups              *repositoryGroups
 }
 
-// RepositoryInfo data structure for storing repositories
-type RepositoryInfo struct {
-	Name     string
-	Link     string
-	Severity severity.Matrix
+// Options tune which repositories and images ECRService processes
+type Options struct {
+	// Repositories have to carry every tag of the filter to be processed
+	TagFilter map[string]string
+	// Repositories are labelled with the value of this tag in RepositoryInfo.Group, not grouped when empty
+	GroupTag string
+	// Scan and report each platform of multi-architecture images separately
+	ResolveManifestLists bool
+	// Images reported per repository, ScanScopeTag when empty
+	ScanScope string
+	// With ScanScopeAllTagged, only the most recently pushed images are reported, every tagged image when zero
+	NewestImages int
+	// Management console domain used in links, derived from the region's partition when empty
+	ConsoleDomain string
+	// Minimum severity of matching repositories, the first matching override wins
+	SeverityOverrides []SeverityOverride
+	// Finding counts per severity which trigger a report
+	CountThresholds severity.CountThresholds
+	// How score and count thresholds combine, score when empty
+	ThresholdMode string
+	// Scores of the severity levels the score threshold is checked with, SeverityTable when nil
+	Weights severity.Weights
+	// Keep findings below the threshold in the rendered report
+	ShowAllSeverities bool
+	// Repositories requested per DescribeRepositories call, between 1 and 1000, ECR's default when zero
+	PageSize int64
+	// Repository listings are reused while cached, the registry is listed every time when nil
+	RepositoryCache *RepositoryCache
+	// Images pushed longer ago are reported as stale, push dates aren't looked up when zero
+	StaleAfter time.Duration
+	// Images pushed longer ago are left out, along with the checks of their repository, unless zero
+	MaxImageAge time.Duration
+	// Repositories holding at least this many untagged images are reported, untagged images aren't counted when zero
+	UntaggedThreshold int
+	// Note the base image of vulnerable images, and with enhanced scanning, how many findings come from it
+	AttributeBaseImage bool
+	// Count the findings of vulnerable images separately for OS and language packages, needs enhanced scanning
+	SplitPackageTypes bool
+	// Note the layers of vulnerable images which introduced the vulnerable packages, needs enhanced scanning
+	AttributeLayers bool
+	// Note the IDs of the reported vulnerabilities of vulnerable images, so later reports can tell which were fixed
+	ListVulnerabilities bool
+	// Note the commit and source repository images were built from, clean images included
+	ResolveRevision bool
+	// Report repositories without a lifecycle policy, LifecyclePolicyAuditReport or LifecyclePolicyAuditSuggest, not checked when empty
+	LifecyclePolicyAudit string
+	// No repository is gathered after the deadline, the rest are counted in Report.NotProcessed
+	Deadline time.Time
+	// Called with the name of each repository once its findings are in the report, from multiple goroutines
+	Gathered func(repositoryName string)
+	// Called when the findings of a repository can't be retrieved, from multiple goroutines
+	Failed func(repositoryName string, err error)
+	// Decodes the encoded messages of AccessDenied errors, so failed repositories tell the permission missing
+	AuthorizationDecoder AuthorizationDecoder
+	// Findings are read from the source, from ECR when nil
+	FindingsSource FindingsSource
+	// Snoozed repositories are reported in Report.Snoozed, findings of snoozed vulnerabilities aren't counted
+	Snoozes []report.Snooze
+	// Findings of packages filtered out aren't counted
+	PackageFilters []PackageFilter
+}
+
+// SeverityOverride replaces the minimum severity for repositories matching Pattern, where * matches any sequence of characters
+type SeverityOverride struct {
+	Pattern         string
+	MinimumSeverity string
 }
 
 // ScanningResult .
@@ -35,59 +121,156 @@ type ScanningResult struct {
 }
 
 // NewECRService populates a new ECRService instance
-func NewECRService(registryID string, region string, imageTag string, logger *logger.Logger, client ecriface.ECRAPI) *ECRService {
+func NewECRService(registryID string, region string, imageTag string, options Options, logger *logger.Logger, client ECRClient) *ECRService {
+	if options.ConsoleDomain == "" {
+		options.ConsoleDomain = ConsoleDomain(region)
+	}
+
 	return &ECRService{
 		client:     client,
 		imageTag:   imageTag,
 		logger:     logger,
+		options:    options,
 		region:     region,
 		registryID: registryID,
+		groups:     &repositoryGroups{values: make(map[string]string)},
 	}
 }
 
 func (s *ECRService) getImageScanFinding(repo *ecr.Repository) (*ecr.DescribeImageScanFindingsOutput, error) {
+	return s.describeImageScanFindings(repo, &ecr.ImageIdentifier{
+		ImageTag: aws.String(s.imageTag),
+	})
+}
+
+func (s *ECRService) describeImageScanFindings(repo *ecr.Repository, imageID *ecr.ImageIdentifier) (*ecr.DescribeImageScanFindingsOutput, error) {
 	describeInput := ecr.DescribeImageScanFindingsInput{
-		ImageId: &ecr.ImageIdentifier{
-			ImageTag: aws.String(s.imageTag),
-		},
+		ImageId:        imageID,
 		RepositoryName: repo.RepositoryName,
+		// Only the severity counts are used, they summarize every finding regardless of the page size.
+		// Skipping the findings themselves keeps responses small.
+		MaxResults: aws.Int64(1),
 	}
 
 	if len(s.registryID) != 0 {
 		describeInput.RegistryId = aws.String(s.registryID)
 	}
-	return s.client.DescribeImageScanFindings(&describeInput)
+	return s.findingsSource().DescribeImageScanFindings(&describeInput)
 }
 
 func (s *ECRService) createInfo(finding *ecr.DescribeImageScanFindingsOutput) *RepositoryInfo {
 	if finding.ImageScanFindings != nil && len(finding.ImageScanFindings.FindingSeverityCounts) != 0 {
-		return &RepositoryInfo{
+		info := &RepositoryInfo{
 			Name: *finding.RepositoryName,
-			Link: fmt.Sprintf("https://console.aws.amazon.com/ecr/repositories/%s/image/%s/scan-results?region=%s", *finding.RepositoryName, *finding.ImageId.ImageDigest, s.region),
+			Link: s.consoleLink(finding),
 			Severity: severity.Matrix{
 				Count: finding.ImageScanFindings.FindingSeverityCounts,
 			},
 		}
+		s.describeImage(info, finding)
+		if merged, ok := s.options.FindingsSource.(*MergedSource); ok {
+			info.Sources = merged.Sources(info.Name, info.Digest)
+		}
+		return info
 	}
 	return nil
 }
 
-func hitSeverityThreshold(info *RepositoryInfo, minimumSeverity string) bool {
-	return info.Severity.CalculateScore() >= severity.SeverityTable[minimumSeverity]
+// consoleLink returns the scan results of the image on the console. The registry is part of the link,
+// so links of repositories in other accounts don't point at the repository of the same name in the signed in one.
+func (s *ECRService) consoleLink(finding *ecr.DescribeImageScanFindingsOutput) string {
+	if registryID := aws.StringValue(finding.RegistryId); registryID != "" {
+		return fmt.Sprintf("https://%s/ecr/repositories/private/%s/%s/_/image/%s/scan-results?region=%s", s.options.ConsoleDomain, registryID, *finding.RepositoryName, *finding.ImageId.ImageDigest, s.region)
+	}
+	return fmt.Sprintf("https://%s/ecr/repositories/%s/image/%s/scan-results?region=%s", s.options.ConsoleDomain, *finding.RepositoryName, *finding.ImageId.ImageDigest, s.region)
+}
+
+// describeImage sets the tag, digest, registry and scan date of the image the findings belong to
+func (s *ECRService) describeImage(info *RepositoryInfo, finding *ecr.DescribeImageScanFindingsOutput) {
+	info.Tag = s.imageTag
+	info.RegistryID = aws.StringValue(finding.RegistryId)
+	if finding.ImageId != nil {
+		info.Digest = aws.StringValue(finding.ImageId.ImageDigest)
+	}
+	if finding.ImageScanFindings != nil && finding.ImageScanFindings.ImageScanCompletedAt != nil {
+		info.ScanCompletedAt = *finding.ImageScanFindings.ImageScanCompletedAt
+	}
+}
+
+// setImageTags lists the repository under the tags of the image, when every tagged image is reported
+func setImageTags(info *RepositoryInfo, tags []string) {
+	if len(tags) > 0 {
+		info.ImageTags = tags
+		info.Tag = tags[0]
+	}
+}
+
+func hitSeverityThreshold(info *RepositoryInfo, minimumSeverity string, weights severity.Weights) bool {
+	return info.Severity.ScoreWith(weights) >= weights.Score(minimumSeverity)
+}
+
+// hitThreshold decides whether the findings are reported according to the threshold mode
+func (s *ECRService) hitThreshold(info *RepositoryInfo, minimumSeverity string) bool {
+	score := hitSeverityThreshold(info, s.minimumSeverityFor(info.Name, minimumSeverity), s.options.Weights)
+	count := info.Severity.HitCountThresholds(s.options.CountThresholds)
+
+	switch s.options.ThresholdMode {
+	case severity.ThresholdModeCount:
+		return count
+	case severity.ThresholdModeAny:
+		return score || count
+	case severity.ThresholdModeAll:
+		return score && count
+	}
+	return score
+}
+
+// reportedMinimum returns the least severe level shown in messages for the repository
+func (s *ECRService) reportedMinimum(name string, minimumSeverity string) string {
+	if s.options.ShowAllSeverities {
+		return ""
+	}
+
+	var lowestCount string
+	for k := range s.options.CountThresholds {
+		lowestCount = severity.Lowest(lowestCount, k)
+	}
+
+	switch s.options.ThresholdMode {
+	case severity.ThresholdModeCount:
+		return lowestCount
+	case severity.ThresholdModeAny:
+		return severity.Lowest(s.minimumSeverityFor(name, minimumSeverity), lowestCount)
+	}
+	return s.minimumSeverityFor(name, minimumSeverity)
+}
+
+// minimumSeverityFor returns the minimum severity applying to the repository
+func (s *ECRService) minimumSeverityFor(name string, minimumSeverity string) string {
+	for _, o := range s.options.SeverityOverrides {
+		if WildcardMatch(o.Pattern, name) {
+			return o.MinimumSeverity
+		}
+	}
+	return minimumSeverity
 }
 
 // GatherVulnerabilities requests scan findings for repositories (for given tag)
-// and filters them based on the minimum severity level.
-// Returns the filtered findings and a list of repositores which couldn't be scanned.
+// and filters them based on the minimum severity level, or the repository's severity override.
+// Returns a report of the filtered findings, repositories which couldn't be scanned,
+// repositories which don't contain any image and images which have never been scanned.
+// When the registry has scanning rules, repositories not covered by any of them are reported.
+// Otherwise repositories with scan on push disabled are reported, unless enforceScanOnPush
+// is set and enabling scan on push on them succeeds.
 // Reason for scanning error can be that there is no image version with the provided tag in the repsitory.
 func (s *ECRService) GatherVulnerabilities(
 	ctx context.Context,
 	repositories chan *ecr.Repository,
 	minimumSeverity string,
+	enforceScanOnPush bool,
 	numWorkers int,
-) ([]*RepositoryInfo, []*RepositoryInfo) {
-	var filtered []*RepositoryInfo
-	var failed []*RepositoryInfo
+) *Report {
+	result := &Report{ScanType: s.scanType}
 	var wg sync.WaitGroup
 	mu := &sync.Mutex{}
 
@@ -96,25 +279,339 @@ func (s *ECRService) GatherVulnerabilities(
 		go func() {
 			defer wg.Done()
 			for repository := range repositories {
-				finding, err := s.getImageScanFinding(repository)
-				if err != nil {
+				if !s.options.Deadline.IsZero() && time.Now().After(s.options.Deadline) {
 					mu.Lock()
-					failed = append(failed, &RepositoryInfo{Name: *repository.RepositoryName})
+					result.NotProcessed++
 					mu.Unlock()
-				} else {
-					if info := s.createInfo(finding); info != nil {
-						if hitSeverityThreshold(info, minimumSeverity) {
-							mu.Lock()
-							filtered = append(filtered, info)
-							mu.Unlock()
-						}
+					continue
+				}
+
+				var pushedAt time.Time
+				if s.options.ScanScope != ScanScopeAllTagged && (s.options.StaleAfter > 0 || s.options.MaxImageAge > 0) {
+					pushedAt = s.imagePushedAt(repository.RepositoryName)
+					if s.TooOld(pushedAt) {
+						s.logger.Debugf("Skipping repository %s, its image was pushed on %s", *repository.RepositoryName, pushedAt.Format("2006-01-02"))
+						s.gathered(repository)
+						continue
 					}
 				}
+
+				s.checkScanCoverage(repository, enforceScanOnPush, result, mu)
+				s.checkImageAge(repository, pushedAt, result, mu)
+				s.checkUntaggedImages(repository, result, mu)
+				s.checkLifecyclePolicy(repository, result, mu)
+
+				start := time.Now()
+				failed := s.gatherFindings(repository, pushedAt, minimumSeverity, result, mu)
+				mu.Lock()
+				result.Fetches = append(result.Fetches, report.Fetch{Repository: *repository.RepositoryName, Duration: time.Since(start), Failed: failed})
+				mu.Unlock()
+				s.gathered(repository)
 			}
 		}()
 	}
 	wg.Wait()
-	return filtered, failed
+	if s.options.GroupTag != "" {
+		result.SetGroup(s.groups.get)
+	}
+	return result
+}
+
+// gatherFindings collects the findings of the images of the repository, the image with the configured tag,
+// each image of a manifest list or each tagged image. Returns whether retrieving any of them failed.
+func (s *ECRService) gatherFindings(repository *ecr.Repository, pushedAt time.Time, minimumSeverity string, report *Report, mu *sync.Mutex) bool {
+	if s.options.ScanScope == ScanScopeAllTagged {
+		return s.gatherTaggedImages(repository, minimumSeverity, report, mu)
+	}
+
+	if s.options.ResolveManifestLists {
+		platforms, err := s.ResolvePlatforms(repository.RepositoryName)
+		if err != nil {
+			s.logger.Errorf("Error resolving platforms of repository %s: %s", *repository.RepositoryName, err.Error())
+		}
+		if len(platforms) > 0 {
+			failed := false
+			for _, p := range platforms {
+				finding, err := s.describeImageScanFindings(repository, &ecr.ImageIdentifier{ImageDigest: aws.String(p.Digest)})
+				if s.collect(repository, p.Name, nil, pushedAt, finding, err, minimumSeverity, report, mu) {
+					failed = true
+				}
+			}
+			return failed
+		}
+	}
+
+	finding, err := s.getImageScanFinding(repository)
+	return s.collect(repository, "", nil, pushedAt, finding, err, minimumSeverity, report, mu)
+}
+
+func (s *ECRService) gathered(repository *ecr.Repository) {
+	if s.options.Gathered != nil {
+		s.options.Gathered(*repository.RepositoryName)
+	}
+}
+
+// checkScanCoverage reports repositories not covered by registry scanning rules,
+// or with scan on push disabled when the registry has no scanning rules
+func (s *ECRService) checkScanCoverage(repository *ecr.Repository, enforceScanOnPush bool, report *Report, mu *sync.Mutex) {
+	if len(s.scanningRules) > 0 {
+		if !s.coveredByRules(repository) {
+			mu.Lock()
+			report.NotCovered = append(report.NotCovered, &RepositoryInfo{Name: *repository.RepositoryName})
+			mu.Unlock()
+		}
+	} else if !scanOnPushEnabled(repository) {
+		if !enforceScanOnPush || !s.enableScanOnPush(repository) {
+			mu.Lock()
+			report.ScanOnPushDisabled = append(report.ScanOnPushDisabled, &RepositoryInfo{Name: *repository.RepositoryName})
+			mu.Unlock()
+		}
+	}
+}
+
+// imagePushedAt returns when the tagged image of the repository was pushed, zero when it can't be described
+func (s *ECRService) imagePushedAt(repositoryName *string) time.Time {
+	input := ecr.DescribeImagesInput{
+		ImageIds:       []*ecr.ImageIdentifier{{ImageTag: aws.String(s.imageTag)}},
+		RepositoryName: repositoryName,
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	output, err := s.client.DescribeImages(&input)
+	if err != nil || len(output.ImageDetails) == 0 || output.ImageDetails[0].ImagePushedAt == nil {
+		return time.Time{}
+	}
+	return *output.ImageDetails[0].ImagePushedAt
+}
+
+// ImageTooOld reports whether the tagged image of the repository was pushed before the MaxImageAge window,
+// images which can't be described aren't
+func (s *ECRService) ImageTooOld(repositoryName *string) bool {
+	if s.options.MaxImageAge <= 0 {
+		return false
+	}
+	return s.TooOld(s.imagePushedAt(repositoryName))
+}
+
+// TooOld reports whether an image pushed at pushedAt is outside the MaxImageAge window, unknown push dates aren't
+func (s *ECRService) TooOld(pushedAt time.Time) bool {
+	return s.options.MaxImageAge > 0 && !pushedAt.IsZero() && time.Since(pushedAt) > s.options.MaxImageAge
+}
+
+// checkImageAge reports the repository when its tagged image, pushed at pushedAt, is older than the staleness limit
+func (s *ECRService) checkImageAge(repository *ecr.Repository, pushedAt time.Time, report *Report, mu *sync.Mutex) {
+	if s.options.StaleAfter <= 0 || pushedAt.IsZero() {
+		return
+	}
+
+	if time.Since(pushedAt) > s.options.StaleAfter {
+		mu.Lock()
+		report.Stale = append(report.Stale, &RepositoryInfo{Name: *repository.RepositoryName, PushedAt: pushedAt})
+		mu.Unlock()
+	}
+}
+
+// checkUntaggedImages reports the repository when it holds at least as many untagged images as the threshold
+func (s *ECRService) checkUntaggedImages(repository *ecr.Repository, report *Report, mu *sync.Mutex) {
+	if s.options.UntaggedThreshold <= 0 {
+		return
+	}
+
+	input := ecr.DescribeImagesInput{
+		Filter:         &ecr.DescribeImagesFilter{TagStatus: aws.String(ecr.TagStatusUntagged)},
+		RepositoryName: repository.RepositoryName,
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	info := &RepositoryInfo{Name: *repository.RepositoryName}
+	for {
+		output, err := s.client.DescribeImages(&input)
+		if err != nil {
+			s.logger.Errorf("Error describing untagged images of repository %s: %s", *repository.RepositoryName, err.Error())
+			return
+		}
+		for _, image := range output.ImageDetails {
+			info.UntaggedImages++
+			info.UntaggedBytes += aws.Int64Value(image.ImageSizeInBytes)
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	if info.UntaggedImages >= s.options.UntaggedThreshold {
+		mu.Lock()
+		report.Untagged = append(report.Untagged, info)
+		mu.Unlock()
+	}
+}
+
+// collect sorts the scan findings of an image into the matching section of the report,
+// tags are only set when every tagged image of the repository is reported.
+// Returns whether the image was reported as failed.
+func (s *ECRService) collect(
+	repository *ecr.Repository,
+	platform string,
+	tags []string,
+	pushedAt time.Time,
+	finding *ecr.DescribeImageScanFindingsOutput,
+	err error,
+	minimumSeverity string,
+	report *Report,
+	mu *sync.Mutex,
+) bool {
+	if err != nil {
+		info := &RepositoryInfo{Name: *repository.RepositoryName, Platform: platform, ImageTags: tags}
+		notScanned := isScanNotFound(err)
+		empty := !notScanned && s.isEmpty(repository)
+		if !notScanned && !empty {
+			info.Cause = classifyError(err)
+			s.diagnose(info, err)
+		}
+		mu.Lock()
+		switch {
+		case notScanned:
+			report.NotScanned = append(report.NotScanned, info)
+		case empty:
+			report.Empty = append(report.Empty, info)
+		default:
+			report.Failed = append(report.Failed, info)
+		}
+		mu.Unlock()
+		failed := !notScanned && !empty
+		if failed && s.options.Failed != nil {
+			s.options.Failed(info.Name, err)
+		}
+		return failed
+	}
+
+	if status := finding.ImageScanStatus; status != nil && (aws.StringValue(status.Status) == ecr.ScanStatusInProgress || aws.StringValue(status.Status) == ecr.ScanStatusPending) {
+		mu.Lock()
+		report.InProgress = append(report.InProgress, *repository.RepositoryName)
+		mu.Unlock()
+	}
+
+	info := s.createInfo(finding)
+	if info != nil {
+		setImageTags(info, tags)
+	}
+	now := time.Now()
+	ids := s.snoozedVulnerabilities(*repository.RepositoryName, now)
+	filters := s.packageFilters(*repository.RepositoryName)
+	if info != nil && (len(ids) > 0 || len(filters) > 0) {
+		err := s.leaveOut(info, func(f scanFinding) bool {
+			return ids[f.id] || !keepPackages(filters, f.packages)
+		})
+		if err != nil {
+			s.logger.Errorf("Error listing findings of repository %s, snoozed vulnerabilities and filtered packages are counted: %s", info.Name, err.Error())
+		}
+	}
+	if info == nil || !s.hitThreshold(info, minimumSeverity) {
+		clean := &RepositoryInfo{Name: *repository.RepositoryName, Platform: platform, PushedAt: pushedAt}
+		s.describeImage(clean, finding)
+		setImageTags(clean, tags)
+		if s.options.ResolveRevision {
+			s.resolveRevision(clean)
+		}
+		mu.Lock()
+		report.Clean = append(report.Clean, clean)
+		mu.Unlock()
+		return false
+	}
+
+	info.Platform = platform
+	info.PushedAt = pushedAt
+	info.MinimumSeverity = s.reportedMinimum(info.Name, minimumSeverity)
+	if s.options.AttributeBaseImage {
+		s.attributeBaseImage(info, info.Digest)
+	}
+	if s.options.SplitPackageTypes {
+		s.countByPackageType(info, info.Digest)
+	}
+	if s.options.AttributeLayers {
+		s.attributeLayers(info, info.Digest)
+	}
+	if s.options.ListVulnerabilities {
+		s.listVulnerabilities(info)
+	}
+	if s.options.ResolveRevision {
+		s.resolveRevision(info)
+	}
+	if snooze := s.repositorySnooze(info.Name, now); snooze != nil {
+		info.Snooze = snooze
+		mu.Lock()
+		report.Snoozed = append(report.Snoozed, info)
+		mu.Unlock()
+		return false
+	}
+	mu.Lock()
+	report.Filtered = append(report.Filtered, info)
+	mu.Unlock()
+	return false
+}
+
+// classifyError tells why the findings of a repository couldn't be retrieved
+func classifyError(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case ecr.ErrCodeImageNotFoundException:
+			return report.CauseImageNotFound
+		case "AccessDeniedException", "UnrecognizedClientException", "ExpiredTokenException":
+			return report.CauseAccessDenied
+		}
+	}
+	if request.IsErrorThrottle(err) {
+		return report.CauseThrottling
+	}
+	return report.CauseOther
+}
+
+// scanOnPushEnabled reports whether images are scanned on push to the repository
+func scanOnPushEnabled(repo *ecr.Repository) bool {
+	return repo.ImageScanningConfiguration != nil &&
+		repo.ImageScanningConfiguration.ScanOnPush != nil &&
+		*repo.ImageScanningConfiguration.ScanOnPush
+}
+
+// enableScanOnPush turns on scan on push for repository and reports whether it succeeded
+func (s *ECRService) enableScanOnPush(repo *ecr.Repository) bool {
+	if r := s.putImageScanningConfiguration(repo); r.Err != nil {
+		s.logger.Errorf("Error enabling scan on push on repository %s: %s", *repo.RepositoryName, r.Err.Error())
+		return false
+	}
+	s.logger.Infof("Scan on push enabled on repository %s", *repo.RepositoryName)
+	return true
+}
+
+// isScanNotFound reports whether the findings are missing because the image has never been scanned
+func isScanNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == ecr.ErrCodeScanNotFoundException
+	}
+	return false
+}
+
+// isEmpty reports whether repository contains no images at all
+func (s *ECRService) isEmpty(repo *ecr.Repository) bool {
+	input := ecr.DescribeImagesInput{
+		MaxResults:     aws.Int64(1),
+		RepositoryName: repo.RepositoryName,
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	output, err := s.client.DescribeImages(&input)
+	if err != nil {
+		s.logger.Errorf("Error describing images of repository %s: %s", *repo.RepositoryName, err.Error())
+		return false
+	}
+	return len(output.ImageDetails) == 0
 }
 
 // GenImageScanningConfiguration iterates an input repository channel
@@ -175,41 +672,130 @@ func (s *ECRService) StartImageScan(repositoryName *string) (*ecr.StartImageScan
 	return s.client.StartImageScan(&startImageScanInput)
 }
 
-// DescribeRepositoriesPages iterates through all repositories and passes them into a channel
+// FilterRepositories passes only the repositories keep returns true for into the output channel
+func (s *ECRService) FilterRepositories(ctx context.Context, repositories chan *ecr.Repository, keep func(*ecr.Repository) bool) chan *ecr.Repository {
+	out := make(chan *ecr.Repository)
+	go func() {
+		defer close(out)
+		for r := range repositories {
+			if !keep(r) {
+				s.logger.Debugf("Skipping repository %s\n", *r.RepositoryName)
+				continue
+			}
+
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				s.logger.Info("FilterRepositories context cancelled")
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// LimitRepositories passes at most max repositories into the output channel, then calls stop
+// so the stages producing repositories stop listing
+func (s *ECRService) LimitRepositories(repositories chan *ecr.Repository, max int, stop func()) chan *ecr.Repository {
+	out := make(chan *ecr.Repository)
+	go func() {
+		defer close(out)
+		passed := 0
+		for r := range repositories {
+			out <- r
+			passed++
+			if passed == max {
+				s.logger.Infof("Reached the limit of %d repositories, the rest of the registry is left out", max)
+				stop()
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// DescribeRepositoriesPages iterates through all repositories and passes them into a channel.
+// The next page is only requested once every repository of the current one has been received,
+// so a single page is held in memory at a time, unless the listing is cached. The error of listing
+// is sent when the repositories channel is closed, read it after receiving every repository.
 func (s *ECRService) DescribeRepositoriesPages(ctx context.Context) (chan *ecr.Repository, chan error) {
 	s.logger.Info("Starting to describe repositories...")
 
-	var wg sync.WaitGroup
 	repositories := make(chan *ecr.Repository)
 	errc := make(chan error, 1)
 
+	cache := s.options.RepositoryCache
+	cacheKey := s.registryID + "/" + s.region
+	if cache != nil {
+		cached, ok, err := cache.Get(cacheKey)
+		if err != nil {
+			s.logger.Errorf("Error reading the cached repository listing, listing the registry: %s", err.Error())
+		}
+		if ok {
+			s.logger.Infof("Using the cached listing of %d repositories", len(cached))
+			go func() {
+				defer close(errc)
+				defer close(repositories)
+				s.sendRepositories(ctx, cached, repositories)
+			}()
+			return repositories, errc
+		}
+	}
+
 	input := &ecr.DescribeRepositoriesInput{}
 	if len(s.registryID) != 0 {
 		input.RegistryId = aws.String(s.registryID)
 	}
-	pageNum := 0
-	errc <- s.client.DescribeRepositoriesPages(input, func(page *ecr.DescribeRepositoriesOutput, lastPage bool) bool {
-		s.logger.Infof("Iterating repository page %d \n", pageNum)
-		pageNum++
-		wg.Add(1)
-		go func(pageNum int) {
-			defer wg.Done()
-			for _, output := range page.Repositories {
-				select {
-				case repositories <- output:
-					s.logger.Infof("Describing %s has finished...(goroutine #%d)\n", *output.RepositoryName, pageNum)
-				case <-ctx.Done():
-					s.logger.Info("DescribeRepositoriesPages context cancelled")
-					return
-				}
-			}
-		}(pageNum)
-		return true
-	})
+	if s.options.PageSize > 0 {
+		input.MaxResults = aws.Int64(s.options.PageSize)
+	}
+
 	go func() {
-		wg.Wait()
-		close(repositories)
-		close(errc)
+		defer close(errc)
+		defer close(repositories)
+
+		pageNum := 0
+		var listed []*ecr.Repository
+		complete := false
+		err := s.client.DescribeRepositoriesPages(input, func(page *ecr.DescribeRepositoriesOutput, lastPage bool) bool {
+			s.logger.Infof("Iterating repository page %d \n", pageNum)
+			pageNum++
+			if cache != nil {
+				listed = append(listed, page.Repositories...)
+			}
+			if !s.sendRepositories(ctx, page.Repositories, repositories) {
+				return false
+			}
+			complete = lastPage
+			return true
+		})
+		// Listings cut short don't hold every repository
+		if err == nil && complete && cache != nil {
+			if err := cache.Put(cacheKey, listed); err != nil {
+				s.logger.Errorf("Error caching the repository listing: %s", err.Error())
+			}
+		}
+		errc <- err
 	}()
 	return repositories, errc
 }
+
+// sendRepositories passes the repositories matching the tag filter into the channel, until ctx is done.
+// Reports whether every repository was passed.
+func (s *ECRService) sendRepositories(ctx context.Context, page []*ecr.Repository, repositories chan *ecr.Repository) bool {
+	for _, output := range page {
+		if !s.matchTags(output) {
+			s.logger.Debugf("Skipping %s, tag filter does not match\n", *output.RepositoryName)
+			continue
+		}
+
+		select {
+		case repositories <- output:
+			s.logger.Infof("Describing %s has finished...\n", *output.RepositoryName)
+		case <-ctx.Done():
+			s.logger.Info("DescribeRepositoriesPages context cancelled")
+			return false
+		}
+	}
+	return true
+}
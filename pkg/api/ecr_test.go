@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
 )
 
@@ -56,6 +60,23 @@ func (m mockECRService) DescribeImageScanFindings(input *ecr.DescribeImageScanFi
 				ImageDigest: aws.String("eeefffggghhh"),
 			},
 		}, nil
+	case "TestRepo/NotScanned":
+		return nil, awserr.New(ecr.ErrCodeScanNotFoundException, "Fake scan not found", nil)
+	case "TestRepo/MultiArch":
+		if aws.StringValue(input.ImageId.ImageDigest) != "sha256:amd64" {
+			return nil, awserr.New(ecr.ErrCodeScanNotFoundException, "Fake scan not found", nil)
+		}
+		return &ecr.DescribeImageScanFindingsOutput{
+			ImageScanFindings: &ecr.ImageScanFindings{
+				FindingSeverityCounts: map[string]*int64{
+					"CRITICAL": aws.Int64(2),
+				},
+			},
+			RepositoryName: aws.String("TestRepo/MultiArch"),
+			ImageId: &ecr.ImageIdentifier{
+				ImageDigest: aws.String("sha256:amd64"),
+			},
+		}, nil
 	default:
 		return &ecr.DescribeImageScanFindingsOutput{
 			ImageScanFindings: &ecr.ImageScanFindings{
@@ -77,7 +98,7 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
-	service = NewECRService("xxxxx", "us-east-1", "latest", logger, mockECRService{})
+	service = NewECRService("xxxxx", "us-east-1", "latest", Options{}, logger, mockECRService{})
 }
 
 func TestGetImageScanFinding(t *testing.T) {
@@ -113,7 +134,9 @@ func TestCreateInfo(t *testing.T) {
 						FindingSeverityCounts: map[string]*int64{
 							"CRITICAL": aws.Int64(12),
 						},
+						ImageScanCompletedAt: aws.Time(time.Date(2020, 7, 18, 8, 0, 0, 0, time.UTC)),
 					},
+					RegistryId:     aws.String("123456789012"),
 					RepositoryName: aws.String("TestRepo/Test1"),
 					ImageId: &ecr.ImageIdentifier{
 						ImageDigest: aws.String("xxxyyyzzzddd"),
@@ -122,8 +145,12 @@ func TestCreateInfo(t *testing.T) {
 				region: "us-east-1",
 			},
 			expected: &RepositoryInfo{
-				Name: "TestRepo/Test1",
-				Link: "https://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1",
+				Name:            "TestRepo/Test1",
+				Link:            "https://console.aws.amazon.com/ecr/repositories/private/123456789012/TestRepo/Test1/_/image/xxxyyyzzzddd/scan-results?region=us-east-1",
+				Tag:             "latest",
+				Digest:          "xxxyyyzzzddd",
+				ScanCompletedAt: time.Date(2020, 7, 18, 8, 0, 0, 0, time.UTC),
+				RegistryID:      "123456789012",
 				Severity: severity.Matrix{
 					Count: map[string]*int64{
 						"CRITICAL": aws.Int64(12),
@@ -148,8 +175,10 @@ func TestCreateInfo(t *testing.T) {
 				region: "us-east-1",
 			},
 			expected: &RepositoryInfo{
-				Name: "TestRepo/Test2",
-				Link: "https://console.aws.amazon.com/ecr/repositories/TestRepo/Test2/image/aaabbbcccddd/scan-results?region=us-east-1",
+				Name:   "TestRepo/Test2",
+				Link:   "https://console.aws.amazon.com/ecr/repositories/TestRepo/Test2/image/aaabbbcccddd/scan-results?region=us-east-1",
+				Tag:    "latest",
+				Digest: "aaabbbcccddd",
 				Severity: severity.Matrix{
 					Count: map[string]*int64{
 						"LOW": aws.Int64(12),
@@ -165,6 +194,13 @@ func TestCreateInfo(t *testing.T) {
 			t.Fatalf("[%d], values not equal, wanting: %v, got: %v", i, c.expected, repos)
 		}
 	}
+
+	govService := NewECRService("xxxxx", "us-gov-west-1", "latest", Options{}, service.logger, mockECRService{})
+	info := govService.createInfo(cases[0].input.finding)
+	expectedLink := "https://console.amazonaws-us-gov.com/ecr/repositories/private/123456789012/TestRepo/Test1/_/image/xxxyyyzzzddd/scan-results?region=us-gov-west-1"
+	if info.Link != expectedLink {
+		t.Fatalf("values not equal, wanting: %s, got: %s", expectedLink, info.Link)
+	}
 }
 
 func TestHitSeverityThreshold(t *testing.T) {
@@ -198,7 +234,7 @@ func TestHitSeverityThreshold(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		repos := hitSeverityThreshold(c.input, "MEDIUM")
+		repos := hitSeverityThreshold(c.input, "MEDIUM", nil)
 		if !reflect.DeepEqual(repos, c.expected) {
 			t.Fatalf("[%d], values not equal, wanting: %v, got: %v", i, c.expected, repos)
 		}
@@ -239,6 +275,12 @@ func TestGatherVulnerabilities(t *testing.T) {
 		{
 			RepositoryName: aws.String("TestRepo/NoVulnerablity"),
 		},
+		{
+			RepositoryName: aws.String("TestRepo/Empty"),
+		},
+		{
+			RepositoryName: aws.String("TestRepo/NotScanned"),
+		},
 	}
 
 	input := gen(repositories)
@@ -249,31 +291,303 @@ func TestGatherVulnerabilities(t *testing.T) {
 	expectedFailed := []string{
 		"TestRepo/NoVulnerablity",
 	}
+	expectedEmpty := []string{
+		"TestRepo/Empty",
+	}
+	expectedNotScanned := []string{
+		"TestRepo/NotScanned",
+	}
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
 
-	filtered, failed := service.GatherVulnerabilities(ctx, input, "MEDIUM", 2)
+	report := service.GatherVulnerabilities(ctx, input, "MEDIUM", false, 2)
 
-	for _, f := range filtered {
+	for _, f := range report.Filtered {
 		if !contains(f.Name, expectedFiltered) {
 			t.Errorf("Filtered expected to contain %s", f.Name)
 		}
 	}
 
-	for _, f := range failed {
+	for _, f := range report.Failed {
 		if !contains(f.Name, expectedFailed) {
 			t.Fatalf("Failed expected to contain %s", f.Name)
 		}
 	}
+
+	if len(report.Empty) != len(expectedEmpty) {
+		t.Fatalf("Empty values are not equal, wanting: %d, got: %d", len(expectedEmpty), len(report.Empty))
+	}
+	for _, f := range report.Empty {
+		if !contains(f.Name, expectedEmpty) {
+			t.Fatalf("Empty expected to contain %s", f.Name)
+		}
+	}
+
+	if len(report.NotScanned) != len(expectedNotScanned) {
+		t.Fatalf("NotScanned values are not equal, wanting: %d, got: %d", len(expectedNotScanned), len(report.NotScanned))
+	}
+	for _, f := range report.NotScanned {
+		if !contains(f.Name, expectedNotScanned) {
+			t.Fatalf("NotScanned expected to contain %s", f.Name)
+		}
+	}
+}
+
+func TestSeverityOverrides(t *testing.T) {
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{
+		SeverityOverrides: []SeverityOverride{
+			{Pattern: "TestRepo/Test3", MinimumSeverity: "LOW"},
+			{Pattern: "TestRepo/*", MinimumSeverity: "CRITICAL"},
+		},
+	}, service.logger, mockECRService{})
+
+	repositories := []*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("TestRepo/Test2")},
+		{RepositoryName: aws.String("TestRepo/Test3")},
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	report := s.GatherVulnerabilities(ctx, gen(repositories), "MEDIUM", false, 1)
+
+	expected := []string{"TestRepo/Test1", "TestRepo/Test3"}
+	if len(report.Filtered) != len(expected) {
+		t.Fatalf("Filtered values are not equal, wanting: %d, got: %d", len(expected), len(report.Filtered))
+	}
+	for _, f := range report.Filtered {
+		if !contains(f.Name, expected) {
+			t.Fatalf("Filtered expected to contain %s", f.Name)
+		}
+	}
+}
+
+func TestHitThreshold(t *testing.T) {
+	info := &RepositoryInfo{
+		Name: "TestRepo/Test2",
+		Severity: severity.Matrix{
+			Count: map[string]*int64{
+				"HIGH": aws.Int64(32),
+				"LOW":  aws.Int64(1),
+			},
+		},
+	}
+
+	cases := []struct {
+		mode     string
+		counts   severity.CountThresholds
+		weights  severity.Weights
+		expected bool
+	}{
+		{mode: "", counts: severity.CountThresholds{"CRITICAL": 1}, expected: true},
+		{mode: "", weights: severity.Weights{"HIGH": 50, "MEDIUM": 100, "LOW": 10}, expected: false},
+		{mode: severity.ThresholdModeCount, counts: severity.CountThresholds{"CRITICAL": 1}, expected: false},
+		{mode: severity.ThresholdModeCount, counts: severity.CountThresholds{"HIGH": 5}, expected: true},
+		{mode: severity.ThresholdModeAny, counts: severity.CountThresholds{"CRITICAL": 1}, expected: true},
+		{mode: severity.ThresholdModeAll, counts: severity.CountThresholds{"CRITICAL": 1}, expected: false},
+		{mode: severity.ThresholdModeAll, counts: severity.CountThresholds{"HIGH": 5}, expected: true},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("xxxxx", "us-east-1", "latest", Options{
+			CountThresholds: c.counts,
+			ThresholdMode:   c.mode,
+			Weights:         c.weights,
+		}, service.logger, mockECRService{})
+
+		if hit := s.hitThreshold(info, "MEDIUM"); hit != c.expected {
+			t.Fatalf("[%d] values are not equal, wanting: %t, got: %t", i, c.expected, hit)
+		}
+	}
+}
+
+func TestReportedMinimum(t *testing.T) {
+	cases := []struct {
+		options  Options
+		expected string
+	}{
+		{options: Options{}, expected: "MEDIUM"},
+		{options: Options{ShowAllSeverities: true}, expected: ""},
+		{options: Options{SeverityOverrides: []SeverityOverride{{Pattern: "TestRepo/*", MinimumSeverity: "LOW"}}}, expected: "LOW"},
+		{options: Options{ThresholdMode: severity.ThresholdModeCount, CountThresholds: severity.CountThresholds{"CRITICAL": 1, "HIGH": 5}}, expected: "HIGH"},
+		{options: Options{ThresholdMode: severity.ThresholdModeAny, CountThresholds: severity.CountThresholds{"CRITICAL": 1}}, expected: "MEDIUM"},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("xxxxx", "us-east-1", "latest", c.options, service.logger, mockECRService{})
+		if minimum := s.reportedMinimum("TestRepo/Test1", "MEDIUM"); minimum != c.expected {
+			t.Fatalf("[%d] values are not equal, wanting: %s, got: %s", i, c.expected, minimum)
+		}
+	}
+}
+
+func (m mockECRService) DescribeImages(input *ecr.DescribeImagesInput) (*ecr.DescribeImagesOutput, error) {
+	if *input.RepositoryName == "TestRepo/Empty" {
+		return &ecr.DescribeImagesOutput{}, nil
+	}
+	// Test2 holds three untagged images on two pages
+	if input.Filter != nil && aws.StringValue(input.Filter.TagStatus) == ecr.TagStatusUntagged {
+		if *input.RepositoryName != "TestRepo/Test2" {
+			return &ecr.DescribeImagesOutput{}, nil
+		}
+		if input.NextToken == nil {
+			return &ecr.DescribeImagesOutput{
+				ImageDetails: []*ecr.ImageDetail{{ImageSizeInBytes: aws.Int64(100)}},
+				NextToken:    aws.String("next"),
+			}, nil
+		}
+		return &ecr.DescribeImagesOutput{
+			ImageDetails: []*ecr.ImageDetail{{ImageSizeInBytes: aws.Int64(200)}, {ImageSizeInBytes: aws.Int64(300)}},
+		}, nil
+	}
+
+	// Test1 is pushed 200 days ago, other images a day ago
+	pushedAt := time.Now().AddDate(0, 0, -1)
+	if *input.RepositoryName == "TestRepo/Test1" {
+		pushedAt = time.Now().AddDate(0, 0, -200)
+	}
+	return &ecr.DescribeImagesOutput{
+		ImageDetails: []*ecr.ImageDetail{
+			{
+				ImageTags:     []*string{aws.String("latest")},
+				ImagePushedAt: aws.Time(pushedAt),
+			},
+		},
+	}, nil
 }
 
 func (m mockECRService) PutImageScanningConfiguration(input *ecr.PutImageScanningConfigurationInput) (*ecr.PutImageScanningConfigurationOutput, error) {
+	if *input.RepositoryName == "TestRepo/Locked" {
+		return nil, fmt.Errorf("Fake error happened")
+	}
 	return &ecr.PutImageScanningConfigurationOutput{
 		RepositoryName: aws.String(*input.RepositoryName),
 	}, nil
 }
 
+func TestGatherScanOnPushDisabled(t *testing.T) {
+	repositories := []*ecr.Repository{
+		{
+			RepositoryName: aws.String("TestRepo/Test1"),
+			ImageScanningConfiguration: &ecr.ImageScanningConfiguration{
+				ScanOnPush: aws.Bool(true),
+			},
+		},
+		{
+			RepositoryName: aws.String("TestRepo/Test2"),
+			ImageScanningConfiguration: &ecr.ImageScanningConfiguration{
+				ScanOnPush: aws.Bool(false),
+			},
+		},
+		{
+			RepositoryName: aws.String("TestRepo/Locked"),
+		},
+	}
+
+	cases := []struct {
+		enforce  bool
+		expected []string
+	}{
+		{enforce: false, expected: []string{"TestRepo/Test2", "TestRepo/Locked"}},
+		{enforce: true, expected: []string{"TestRepo/Locked"}},
+	}
+
+	for i, c := range cases {
+		report := service.GatherVulnerabilities(context.Background(), gen(repositories), "MEDIUM", c.enforce, 2)
+
+		if len(report.ScanOnPushDisabled) != len(c.expected) {
+			t.Fatalf("[%d] values are not equal, wanting: %d, got: %d", i, len(c.expected), len(report.ScanOnPushDisabled))
+		}
+		for _, r := range report.ScanOnPushDisabled {
+			if !contains(r.Name, c.expected) {
+				t.Fatalf("[%d] ScanOnPushDisabled expected to contain %s", i, r.Name)
+			}
+		}
+	}
+}
+
+func TestGatherStaleImages(t *testing.T) {
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{StaleAfter: 180 * 24 * time.Hour}, service.logger, mockECRService{})
+
+	repositories := []*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("TestRepo/Test2")},
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	report := s.GatherVulnerabilities(ctx, gen(repositories), "MEDIUM", false, 1)
+
+	if len(report.Stale) != 1 || report.Stale[0].Name != "TestRepo/Test1" {
+		t.Fatalf("Stale expected to contain only TestRepo/Test1, got: %+v", report.Stale)
+	}
+	for _, f := range report.Filtered {
+		if f.PushedAt.IsZero() {
+			t.Fatalf("Expected push date of %s to be set", f.Name)
+		}
+	}
+
+	report = service.GatherVulnerabilities(ctx, gen(repositories), "MEDIUM", false, 1)
+	if len(report.Stale) != 0 || report.Filtered[0].PushedAt != (time.Time{}) {
+		t.Fatalf("Expected push dates not to be looked up without StaleAfter")
+	}
+}
+
+func TestGatherMaxImageAge(t *testing.T) {
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{MaxImageAge: 90 * 24 * time.Hour, StaleAfter: 180 * 24 * time.Hour}, service.logger, mockECRService{})
+
+	repositories := []*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("TestRepo/Test2")},
+	}
+
+	var gathered []string
+	s.options.Gathered = func(name string) { gathered = append(gathered, name) }
+
+	report := s.GatherVulnerabilities(context.Background(), gen(repositories), "MEDIUM", false, 1)
+
+	// Test1 was pushed 200 days ago, it's left out entirely, stale listing included
+	if len(report.Filtered) != 1 || report.Filtered[0].Name != "TestRepo/Test2" || len(report.Stale) != 0 {
+		t.Fatalf("Expected only TestRepo/Test2 to be reported, got: %+v, stale: %+v", report.Filtered, report.Stale)
+	}
+	if len(gathered) != 2 {
+		t.Fatalf("Expected skipped repositories to be gathered, got: %v", gathered)
+	}
+	if !s.ImageTooOld(aws.String("TestRepo/Test1")) || s.ImageTooOld(aws.String("TestRepo/Test2")) {
+		t.Fatalf("Expected only the image of TestRepo/Test1 to be too old")
+	}
+}
+
+func TestGatherUntaggedImages(t *testing.T) {
+	repositories := []*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("TestRepo/Test2")},
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	cases := []struct {
+		threshold int
+		expected  []*RepositoryInfo
+	}{
+		{threshold: 0, expected: nil},
+		{threshold: 3, expected: []*RepositoryInfo{{Name: "TestRepo/Test2", UntaggedImages: 3, UntaggedBytes: 600}}},
+		{threshold: 4, expected: nil},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("xxxxx", "us-east-1", "latest", Options{UntaggedThreshold: c.threshold}, service.logger, mockECRService{})
+		report := s.GatherVulnerabilities(ctx, gen(repositories), "MEDIUM", false, 1)
+		if !reflect.DeepEqual(report.Untagged, c.expected) {
+			t.Fatalf("[%d] values are not equal, wanting: %+v, got: %+v", i, c.expected, report.Untagged)
+		}
+	}
+}
+
 func TestGenImageScanningConfiguration(t *testing.T) {
 	repositories := []*ecr.Repository{
 		{
@@ -367,3 +681,103 @@ func TestDescribeRepositoriesPages(t *testing.T) {
 		t.Fatalf("TestDescribeRepositoriesPages values are not equal, wanting: %d, got: %d", expectedLen, cnt)
 	}
 }
+
+func TestGatheredCallback(t *testing.T) {
+	var mu sync.Mutex
+	var gathered []string
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{
+		Gathered: func(name string) {
+			mu.Lock()
+			gathered = append(gathered, name)
+			mu.Unlock()
+		},
+	}, service.logger, mockECRService{})
+
+	s.GatherVulnerabilities(context.Background(), gen([]*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("TestRepo/Test3")},
+	}), "HIGH", false, 2)
+
+	if len(gathered) != 2 || !contains("TestRepo/Test1", gathered) || !contains("TestRepo/Test3", gathered) {
+		t.Fatalf("Expected both repositories to be reported gathered, got: %v", gathered)
+	}
+}
+
+func TestGatherFetches(t *testing.T) {
+	report := service.GatherVulnerabilities(context.Background(), gen([]*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("TestRepo/NoVulnerablity")},
+		{RepositoryName: aws.String("TestRepo/NotScanned")},
+	}), "HIGH", false, 2)
+
+	failed := map[string]bool{}
+	for _, f := range report.Fetches {
+		failed[f.Repository] = f.Failed
+	}
+	expected := map[string]bool{"TestRepo/Test1": false, "TestRepo/NoVulnerablity": true, "TestRepo/NotScanned": false}
+	if !reflect.DeepEqual(failed, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, failed)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected string
+	}{
+		{err: awserr.New(ecr.ErrCodeImageNotFoundException, "Fake image not found", nil), expected: report.CauseImageNotFound},
+		{err: awserr.New("AccessDeniedException", "Fake access denied", nil), expected: report.CauseAccessDenied},
+		{err: awserr.New("ThrottlingException", "Fake rate exceeded", nil), expected: report.CauseThrottling},
+		{err: fmt.Errorf("Fake error happened"), expected: report.CauseOther},
+	}
+
+	for i, c := range cases {
+		if cause := classifyError(c.err); cause != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %s, got: %s", i, c.expected, cause)
+		}
+	}
+}
+
+type pagedECRService struct {
+	mockECRService
+	pages     int
+	requested chan int
+}
+
+func (m pagedECRService) DescribeRepositoriesPages(input *ecr.DescribeRepositoriesInput, fn func(*ecr.DescribeRepositoriesOutput, bool) bool) error {
+	for i := 0; i < m.pages; i++ {
+		m.requested <- i
+		page := &ecr.DescribeRepositoriesOutput{Repositories: []*ecr.Repository{
+			{RepositoryName: aws.String(fmt.Sprintf("page%d/a", i))},
+			{RepositoryName: aws.String(fmt.Sprintf("page%d/b", i))},
+		}}
+		if !fn(page, i == m.pages-1) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestDescribeRepositoriesPagesStreaming(t *testing.T) {
+	client := pagedECRService{pages: 3, requested: make(chan int, 3)}
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{}, service.logger, client)
+
+	repositories, errc := s.DescribeRepositoriesPages(context.Background())
+	<-repositories
+	// The first page isn't fully received yet, the second one must not be requested
+	time.Sleep(10 * time.Millisecond)
+	if len(client.requested) != 1 {
+		t.Fatalf("Expected only the first page to be requested, got: %d", len(client.requested))
+	}
+
+	cnt := 1
+	for range repositories {
+		cnt++
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cnt != 6 {
+		t.Fatalf("values are not equal, wanting: %d, got: %d", 6, cnt)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/aws-sdk-go/service/ecrpublic/ecrpubliciface"
+)
+
+// ECRPublicRegion is the only region serving the ECR Public API
+const ECRPublicRegion = "us-east-1"
+
+// ECRPublicService implements ECR Public API
+type ECRPublicService struct {
+	client     ecrpubliciface.ECRPublicAPI
+	registryID string
+}
+
+// NewECRPublicService .
+func NewECRPublicService(registryID string, client ecrpubliciface.ECRPublicAPI) *ECRPublicService {
+	return &ECRPublicService{
+		client:     client,
+		registryID: registryID,
+	}
+}
+
+// DescribeRepositories lists every public repository of the registry.
+// ECR Public doesn't support image scanning, so the repositories carry no findings.
+func (s *ECRPublicService) DescribeRepositories() ([]*RepositoryInfo, error) {
+	var repositories []*RepositoryInfo
+
+	input := &ecrpublic.DescribeRepositoriesInput{}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	err := s.client.DescribeRepositoriesPages(input, func(page *ecrpublic.DescribeRepositoriesOutput, lastPage bool) bool {
+		for _, r := range page.Repositories {
+			repositories = append(repositories, &RepositoryInfo{
+				Name: aws.StringValue(r.RepositoryName),
+				Link: aws.StringValue(r.RepositoryUri),
+			})
+		}
+		return true
+	})
+	return repositories, err
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/aws-sdk-go/service/ecrpublic/ecrpubliciface"
+)
+
+type mockECRPublicService struct {
+	ecrpubliciface.ECRPublicAPI
+}
+
+func (m mockECRPublicService) DescribeRepositoriesPages(input *ecrpublic.DescribeRepositoriesInput, fn func(*ecrpublic.DescribeRepositoriesOutput, bool) bool) error {
+	fn(&ecrpublic.DescribeRepositoriesOutput{
+		Repositories: []*ecrpublic.Repository{
+			{
+				RepositoryName: aws.String("TestRepo/Public1"),
+				RepositoryUri:  aws.String("public.ecr.aws/xxxxx/TestRepo/Public1"),
+			},
+		},
+	}, false)
+	fn(&ecrpublic.DescribeRepositoriesOutput{
+		Repositories: []*ecrpublic.Repository{
+			{
+				RepositoryName: aws.String("TestRepo/Public2"),
+				RepositoryUri:  aws.String("public.ecr.aws/xxxxx/TestRepo/Public2"),
+			},
+		},
+	}, true)
+	return nil
+}
+
+func TestDescribePublicRepositories(t *testing.T) {
+	expected := []*RepositoryInfo{
+		{Name: "TestRepo/Public1", Link: "public.ecr.aws/xxxxx/TestRepo/Public1"},
+		{Name: "TestRepo/Public2", Link: "public.ecr.aws/xxxxx/TestRepo/Public2"},
+	}
+
+	s := NewECRPublicService("xxxxx", mockECRPublicService{})
+	repositories, err := s.DescribeRepositories()
+	if err != nil {
+		t.Fatalf("TestDescribePublicRepositories failed to list repositories")
+	}
+
+	if !reflect.DeepEqual(repositories, expected) {
+		t.Fatalf("values not equal, wanting: %v, got: %v", expected, repositories)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+)
+
+// EventsService puts custom events on an EventBridge event bus
+type EventsService struct {
+	client  eventbridgeiface.EventBridgeAPI
+	busName string
+	source  string
+}
+
+// NewEventsService .
+func NewEventsService(busName string, source string, client eventbridgeiface.EventBridgeAPI) *EventsService {
+	return &EventsService{
+		client:  client,
+		busName: busName,
+		source:  source,
+	}
+}
+
+// Put sends an event of detailType with detail marshalled to JSON
+func (s *EventsService) Put(detailType string, detail interface{}) error {
+	body, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+
+	out, err := s.client.PutEvents(&eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{{
+			EventBusName: aws.String(s.busName),
+			Source:       aws.String(s.source),
+			DetailType:   aws.String(detailType),
+			Detail:       aws.String(string(body)),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// PutEvents reports rejected entries in the response instead of an error
+	if aws.Int64Value(out.FailedEntryCount) > 0 && len(out.Entries) > 0 {
+		return fmt.Errorf("Error putting %s event: %s %s", detailType, aws.StringValue(out.Entries[0].ErrorCode), aws.StringValue(out.Entries[0].ErrorMessage))
+	}
+	return nil
+}
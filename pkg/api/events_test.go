@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+)
+
+type mockEventBridgeService struct {
+	eventbridgeiface.EventBridgeAPI
+	input *eventbridge.PutEventsInput
+	fail  bool
+}
+
+func (m *mockEventBridgeService) PutEvents(input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+	m.input = input
+	if m.fail {
+		return &eventbridge.PutEventsOutput{
+			FailedEntryCount: aws.Int64(1),
+			Entries:          []*eventbridge.PutEventsResultEntry{{ErrorCode: aws.String("InternalFailure")}},
+		}, nil
+	}
+	return &eventbridge.PutEventsOutput{FailedEntryCount: aws.Int64(0)}, nil
+}
+
+func TestPutEvent(t *testing.T) {
+	client := &mockEventBridgeService{}
+	s := NewEventsService("default", "ecr-scan", client)
+
+	if err := s.Put("ecr-scan.run.completed", map[string]int{"scanned": 3}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	entry := client.input.Entries[0]
+	if *entry.EventBusName != "default" || *entry.Source != "ecr-scan" || *entry.DetailType != "ecr-scan.run.completed" {
+		t.Fatalf("Unexpected event entry: %+v", entry)
+	}
+	if *entry.Detail != `{"scanned":3}` {
+		t.Fatalf("values not equal, wanting: %s, got: %s", `{"scanned":3}`, *entry.Detail)
+	}
+
+	client.fail = true
+	if err := s.Put("ecr-scan.run.failed", nil); err == nil {
+		t.Fatalf("Expected error for a rejected entry")
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// scanFinding is a single finding of an image, basic and enhanced alike
+type scanFinding struct {
+	id    string
+	level string
+	// Names of the vulnerable packages, empty when the scan doesn't tell
+	packages []string
+}
+
+// leaveOut subtracts the findings for which drop returns true from the finding counts of the image
+func (s *ECRService) leaveOut(info *RepositoryInfo, drop func(f scanFinding) bool) error {
+	count := make(map[string]*int64)
+	for level, val := range info.Severity.Count {
+		count[level] = aws.Int64(aws.Int64Value(val))
+	}
+
+	err := s.findings(info.Name, info.Digest, func(f scanFinding) {
+		if drop(f) && count[f.level] != nil {
+			*count[f.level]--
+			if *count[f.level] <= 0 {
+				delete(count, f.level)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	info.Severity.Count = count
+	return nil
+}
+
+// listVulnerabilities notes the IDs of the reported vulnerabilities of the image, each once
+func (s *ECRService) listVulnerabilities(info *RepositoryInfo) {
+	ids := make(map[string]bool)
+	err := s.findings(info.Name, info.Digest, func(f scanFinding) {
+		if f.id != "" && severity.Reaches(f.level, info.MinimumSeverity) {
+			ids[f.id] = true
+		}
+	})
+	if err != nil {
+		s.logger.Errorf("Error listing findings of repository %s, fixed vulnerabilities won't be told: %s", info.Name, err.Error())
+		return
+	}
+
+	info.Vulnerabilities = []string{}
+	for id := range ids {
+		info.Vulnerabilities = append(info.Vulnerabilities, id)
+	}
+	sort.Strings(info.Vulnerabilities)
+}
+
+// findings calls fn with every finding of the image
+func (s *ECRService) findings(repositoryName string, digest string, fn func(f scanFinding)) error {
+	input := ecr.DescribeImageScanFindingsInput{
+		ImageId:        &ecr.ImageIdentifier{ImageDigest: aws.String(digest)},
+		RepositoryName: aws.String(repositoryName),
+		MaxResults:     aws.Int64(1000),
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	for {
+		output, err := s.findingsSource().DescribeImageScanFindings(&input)
+		if err != nil {
+			return err
+		}
+		if output.ImageScanFindings != nil {
+			for _, finding := range output.ImageScanFindings.Findings {
+				fn(basicFinding(finding))
+			}
+			for _, finding := range output.ImageScanFindings.EnhancedFindings {
+				if finding.PackageVulnerabilityDetails == nil {
+					continue
+				}
+				fn(enhancedScanFinding(finding))
+			}
+		}
+		if output.NextToken == nil {
+			return nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// basicFinding returns the vulnerability and packages of a basic scanning finding
+func basicFinding(finding *ecr.ImageScanFinding) scanFinding {
+	f := scanFinding{id: aws.StringValue(finding.Name), level: aws.StringValue(finding.Severity)}
+	for _, attribute := range finding.Attributes {
+		if aws.StringValue(attribute.Key) == "package_name" {
+			f.packages = append(f.packages, aws.StringValue(attribute.Value))
+		}
+	}
+	return f
+}
+
+// enhancedScanFinding returns the vulnerability and packages of an enhanced scanning finding, the title
+// stands for the vulnerability of findings without package details
+func enhancedScanFinding(finding *ecr.EnhancedImageScanFinding) scanFinding {
+	details := finding.PackageVulnerabilityDetails
+	if details == nil {
+		return scanFinding{id: aws.StringValue(finding.Title), level: aws.StringValue(finding.Severity)}
+	}
+	f := scanFinding{id: aws.StringValue(details.VulnerabilityId), level: aws.StringValue(finding.Severity)}
+	for _, p := range details.VulnerablePackages {
+		f.packages = append(f.packages, aws.StringValue(p.Name))
+	}
+	return f
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestListVulnerabilities(t *testing.T) {
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{ListVulnerabilities: true}, service.logger, mockPackageFindings{})
+	report := s.GatherVulnerabilities(context.Background(), gen([]*ecr.Repository{{RepositoryName: aws.String("team/api")}}), "HIGH", false, 1)
+
+	if len(report.Filtered) != 1 {
+		t.Fatalf("Unexpected vulnerable repositories: %+v", report.Filtered)
+	}
+	expected := []string{"CVE-2021-44228", "CVE-2022-0001", "CVE-2022-0778"}
+	if ids := report.Filtered[0].Vulnerabilities; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, ids)
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+const historyDateFormat = "2006-01-02"
+
+// HistoryStore keeps the report of each day as a JSON object under an S3 prefix, for digests
+type HistoryStore struct {
+	s3 *S3Service
+}
+
+// NewHistoryStore creates a store at an s3://bucket/prefix URI
+func NewHistoryStore(uri string, client s3iface.S3API) (*HistoryStore, error) {
+	s3, err := NewS3Service(uri, client)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryStore{s3: s3}, nil
+}
+
+// Save stores the report of the day, replacing an earlier report of the same day. Days are
+// those of the date's location, so the report time zone decides where a day ends.
+func (h *HistoryStore) Save(date time.Time, report *Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return h.s3.Put(date.Format(historyDateFormat)+".json", body, "application/json", "")
+}
+
+// Load returns the reports of the days since the given date, sorted by date
+func (h *HistoryStore) Load(since time.Time) ([]report.DatedReport, error) {
+	keys, err := h.s3.List()
+	if err != nil {
+		return nil, err
+	}
+
+	first := since.Format(historyDateFormat)
+	var reports []report.DatedReport
+	for _, key := range keys {
+		day := strings.TrimSuffix(key, ".json")
+		date, err := time.Parse(historyDateFormat, day)
+		if err != nil || day < first {
+			continue
+		}
+
+		body, err := h.s3.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		var stored Report
+		if err := json.Unmarshal(body, &stored); err != nil {
+			return nil, fmt.Errorf("Error parsing report of %s: %s", day, err)
+		}
+		reports = append(reports, report.DatedReport{Date: date, Report: &stored})
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Date.Before(reports[j].Date)
+	})
+	return reports, nil
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryStore(t *testing.T) {
+	client := &mockS3Service{objects: map[string][]byte{"bucket/history/notes.txt": []byte("x")}}
+	store, err := NewHistoryStore("s3://bucket/history", client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for day, name := range map[int]string{1: "team-a/api", 5: "team-a/worker", 7: "team-b/web"} {
+		report := &Report{Filtered: []*RepositoryInfo{{Name: name}}}
+		if err := store.Save(time.Date(2020, 7, day, 8, 0, 0, 0, time.UTC), report); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if _, ok := client.objects["bucket/history/2020-07-05.json"]; !ok {
+		t.Fatalf("Expected the report to be stored by date")
+	}
+
+	reports, err := store.Load(time.Date(2020, 7, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(reports) != 2 || reports[0].Report.Filtered[0].Name != "team-a/worker" || reports[1].Report.Filtered[0].Name != "team-b/web" {
+		t.Fatalf("Unexpected reports: %+v", reports)
+	}
+}
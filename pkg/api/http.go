@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HTTPConfig tunes the HTTP client shared by the AWS and Slack clients
+type HTTPConfig struct {
+	// Time limit of a request including reading the response, zero means no limit
+	Timeout time.Duration
+	// Idle connections kept open for reuse per host
+	MaxIdleConnsPerHost int
+	// Proxy URL, when empty the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used
+	Proxy string
+}
+
+// ParseHTTPConfig parses the timeout as a duration and the idle connection limit as a number
+func ParseHTTPConfig(timeout string, maxIdleConnsPerHost string, proxy string) (HTTPConfig, error) {
+	t, err := time.ParseDuration(timeout)
+	if err != nil {
+		return HTTPConfig{}, fmt.Errorf("Invalid HTTP timeout %s: %s", timeout, err)
+	}
+	idle, err := strconv.Atoi(maxIdleConnsPerHost)
+	if err != nil || idle < 0 {
+		return HTTPConfig{}, fmt.Errorf("Invalid number of idle HTTP connections %s", maxIdleConnsPerHost)
+	}
+	if proxy != "" {
+		if _, err := url.Parse(proxy); err != nil {
+			return HTTPConfig{}, fmt.Errorf("Invalid proxy URL %s: %s", proxy, err)
+		}
+	}
+	return HTTPConfig{Timeout: t, MaxIdleConnsPerHost: idle, Proxy: proxy}, nil
+}
+
+// HTTP clients built by SharedHTTPClient, kept for the life of the process so connections are reused
+var (
+	httpClientsMu sync.Mutex
+	httpClients   = map[HTTPConfig]*http.Client{}
+)
+
+// SharedHTTPClient returns the HTTP client of the configuration, every caller with the same configuration
+// shares its connection pool
+func SharedHTTPClient(c HTTPConfig) (*http.Client, error) {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+
+	if client, ok := httpClients[c]; ok {
+		return client, nil
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	client := &http.Client{
+		Timeout: c.Timeout,
+		Transport: &http.Transport{
+			Proxy: proxy,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+	httpClients[c] = client
+	return client, nil
+}
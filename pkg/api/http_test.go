@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseHTTPConfig(t *testing.T) {
+	c, err := ParseHTTPConfig("15s", "20", "http://proxy.internal:3128")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := HTTPConfig{Timeout: 15 * time.Second, MaxIdleConnsPerHost: 20, Proxy: "http://proxy.internal:3128"}
+	if c != expected {
+		t.Fatalf("values not equal, wanting: %+v, got: %+v", expected, c)
+	}
+
+	for _, invalid := range [][]string{{"15", "20", ""}, {"15s", "-1", ""}, {"15s", "20", "http://proxy internal"}} {
+		if _, err := ParseHTTPConfig(invalid[0], invalid[1], invalid[2]); err == nil {
+			t.Fatalf("Expected error for %v", invalid)
+		}
+	}
+}
+
+func TestSharedHTTPClient(t *testing.T) {
+	c := HTTPConfig{Timeout: 15 * time.Second, MaxIdleConnsPerHost: 20, Proxy: "http://proxy.internal:3128"}
+	client, err := SharedHTTPClient(c)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if again, _ := SharedHTTPClient(c); again != client {
+		t.Fatalf("Expected the client to be shared")
+	}
+	if client.Timeout != 15*time.Second {
+		t.Fatalf("values not equal, wanting: %s, got: %s", 15*time.Second, client.Timeout)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.ecr.us-east-1.amazonaws.com", nil)
+	proxy, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil || proxy.String() != "http://proxy.internal:3128" {
+		t.Fatalf("Expected requests to go through the proxy, got: %v %v", proxy, err)
+	}
+
+	sess, err := NewSession(SessionConfig{Region: "us-east-1", HTTP: c})
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+	if sess.Config.HTTPClient != client {
+		t.Fatalf("Expected the session to use the shared client")
+	}
+}
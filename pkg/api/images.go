@@ -0,0 +1,99 @@
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// Scan scopes, which images of a repository are reported
+const (
+	// The image carrying the configured tag
+	ScanScopeTag = "tag"
+	// Every tagged image, each listed separately
+	ScanScopeAllTagged = "all-tagged"
+)
+
+// taggedImage is an image of a repository carrying at least one tag
+type taggedImage struct {
+	digest   string
+	tags     []string
+	pushedAt time.Time
+}
+
+// taggedImages lists the tagged images of the repository, most recently pushed first,
+// at most Options.NewestImages of them unless it's zero
+func (s *ECRService) taggedImages(repository *ecr.Repository) ([]taggedImage, error) {
+	input := ecr.DescribeImagesInput{
+		Filter:         &ecr.DescribeImagesFilter{TagStatus: aws.String(ecr.TagStatusTagged)},
+		RepositoryName: repository.RepositoryName,
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	var images []taggedImage
+	for {
+		output, err := s.client.DescribeImages(&input)
+		if err != nil {
+			return nil, err
+		}
+		for _, detail := range output.ImageDetails {
+			if len(detail.ImageTags) == 0 {
+				continue
+			}
+			tags := aws.StringValueSlice(detail.ImageTags)
+			sort.Strings(tags)
+			images = append(images, taggedImage{
+				digest:   aws.StringValue(detail.ImageDigest),
+				tags:     tags,
+				pushedAt: aws.TimeValue(detail.ImagePushedAt),
+			})
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].pushedAt.After(images[j].pushedAt)
+	})
+	if s.options.NewestImages > 0 && len(images) > s.options.NewestImages {
+		images = images[:s.options.NewestImages]
+	}
+	return images, nil
+}
+
+// gatherTaggedImages collects the findings of each tagged image of the repository,
+// returns whether retrieving any of them failed
+func (s *ECRService) gatherTaggedImages(repository *ecr.Repository, minimumSeverity string, report *Report, mu *sync.Mutex) bool {
+	images, err := s.taggedImages(repository)
+	if err != nil {
+		return s.collect(repository, "", nil, time.Time{}, nil, err, minimumSeverity, report, mu)
+	}
+	if len(images) == 0 {
+		mu.Lock()
+		report.Empty = append(report.Empty, &RepositoryInfo{Name: *repository.RepositoryName})
+		mu.Unlock()
+		return false
+	}
+
+	failed := false
+
+	for _, image := range images {
+		// Images are listed newest first, the rest are older still
+		if s.TooOld(image.pushedAt) {
+			s.logger.Debugf("Skipping images of repository %s pushed on %s or earlier", *repository.RepositoryName, image.pushedAt.Format("2006-01-02"))
+			break
+		}
+		finding, err := s.describeImageScanFindings(repository, &ecr.ImageIdentifier{ImageDigest: aws.String(image.digest)})
+		if s.collect(repository, "", image.tags, image.pushedAt, finding, err, minimumSeverity, report, mu) {
+			failed = true
+		}
+	}
+	return failed
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// mockTaggedImages holds three tagged images of TestRepo/Live on two pages, the oldest one is clean
+type mockTaggedImages struct {
+	mockECRService
+}
+
+func (m mockTaggedImages) DescribeImages(input *ecr.DescribeImagesInput) (*ecr.DescribeImagesOutput, error) {
+	if input.Filter == nil || aws.StringValue(input.Filter.TagStatus) != ecr.TagStatusTagged {
+		return m.mockECRService.DescribeImages(input)
+	}
+	now := time.Now()
+	if input.NextToken == nil {
+		return &ecr.DescribeImagesOutput{
+			ImageDetails: []*ecr.ImageDetail{
+				{ImageDigest: aws.String("sha256:blue"), ImageTags: aws.StringSlice([]string{"v1"}), ImagePushedAt: aws.Time(now.AddDate(0, 0, -10))},
+				{ImageDigest: aws.String("sha256:green"), ImageTags: aws.StringSlice([]string{"v2", "latest"}), ImagePushedAt: aws.Time(now.AddDate(0, 0, -1))},
+			},
+			NextToken: aws.String("next"),
+		}, nil
+	}
+	return &ecr.DescribeImagesOutput{
+		ImageDetails: []*ecr.ImageDetail{
+			{ImageDigest: aws.String("sha256:canary"), ImageTags: aws.StringSlice([]string{"v3-rc1"}), ImagePushedAt: aws.Time(now)},
+		},
+	}, nil
+}
+
+func (m mockTaggedImages) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	counts := map[string]*int64{"CRITICAL": aws.Int64(2)}
+	if *input.ImageId.ImageDigest == "sha256:blue" {
+		counts = map[string]*int64{"LOW": aws.Int64(1)}
+	}
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageScanFindings: &ecr.ImageScanFindings{FindingSeverityCounts: counts},
+		RepositoryName:    input.RepositoryName,
+		ImageId:           input.ImageId,
+	}, nil
+}
+
+func TestGatherTaggedImages(t *testing.T) {
+	repositories := []*ecr.Repository{{RepositoryName: aws.String("TestRepo/Live")}}
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	cases := []struct {
+		newest     int
+		vulnerable []string
+		clean      []string
+	}{
+		{vulnerable: []string{"TestRepo/Live:latest,v2", "TestRepo/Live:v3-rc1"}, clean: []string{"TestRepo/Live:v1"}},
+		{newest: 1, vulnerable: []string{"TestRepo/Live:v3-rc1"}},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("xxxxx", "us-east-1", "latest", Options{ScanScope: ScanScopeAllTagged, NewestImages: c.newest}, service.logger, mockTaggedImages{})
+		report := s.GatherVulnerabilities(ctx, gen(repositories), "HIGH", false, 1)
+
+		if names := displayNames(report.Filtered); !reflect.DeepEqual(names, c.vulnerable) {
+			t.Fatalf("[%d] values are not equal, wanting: %v, got: %v", i, c.vulnerable, names)
+		}
+		if names := displayNames(report.Clean); !reflect.DeepEqual(names, c.clean) {
+			t.Fatalf("[%d] values are not equal, wanting: %v, got: %v", i, c.clean, names)
+		}
+	}
+}
+
+func TestGatherTaggedImagesMaxAge(t *testing.T) {
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{ScanScope: ScanScopeAllTagged, MaxImageAge: 7 * 24 * time.Hour}, service.logger, mockTaggedImages{})
+	report := s.GatherVulnerabilities(context.Background(), gen([]*ecr.Repository{{RepositoryName: aws.String("TestRepo/Live")}}), "HIGH", false, 1)
+
+	// v1 was pushed 10 days ago
+	if names := displayNames(append(report.Filtered, report.Clean...)); !reflect.DeepEqual(names, []string{"TestRepo/Live:latest,v2", "TestRepo/Live:v3-rc1"}) {
+		t.Fatalf("Unexpected images: %v", names)
+	}
+}
+
+func TestTaggedImageDetails(t *testing.T) {
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{ScanScope: ScanScopeAllTagged, NewestImages: 1}, service.logger, mockTaggedImages{})
+	report := s.GatherVulnerabilities(context.Background(), gen([]*ecr.Repository{{RepositoryName: aws.String("TestRepo/Live")}}), "HIGH", false, 1)
+
+	info := report.Filtered[0]
+	if info.Tag != "v3-rc1" || info.Digest != "sha256:canary" || info.PushedAt.IsZero() {
+		t.Fatalf("Unexpected image details, tag: %s, digest: %s, pushed: %s", info.Tag, info.Digest, info.PushedAt)
+	}
+}
+
+func displayNames(repositories []*RepositoryInfo) []string {
+	var names []string
+	for _, r := range repositories {
+		names = append(names, r.DisplayName())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// Inventory counts the repositories and images of the registry, and how many of them are scanned, along with the
+// scanning configuration of the registry. The counts gathered so far are returned with the error of listing.
+func (s *ECRService) Inventory(ctx context.Context) (*report.RegistryInventory, error) {
+	inventory := &report.RegistryInventory{RegistryID: s.registryID, Region: s.region}
+	inventory.ScanType = s.LoadRegistryScanningConfiguration()
+	inventory.Rules = scanningRulesText(s.scanningRules)
+
+	// Stops listing when counting fails
+	listCtx, stopListing := context.WithCancel(ctx)
+	defer stopListing()
+
+	repositories, errc := s.DescribeRepositoriesPages(listCtx)
+	for repository := range repositories {
+		inventory.Repositories++
+		if s.covered(repository) {
+			inventory.CoveredRepositories++
+		}
+		images, scanned, err := s.countImages(repository)
+		inventory.Images += images
+		inventory.ScannedImages += scanned
+		if err != nil {
+			return inventory, fmt.Errorf("Error describing images of repository %s: %s", *repository.RepositoryName, err)
+		}
+	}
+	if err := <-errc; err != nil {
+		return inventory, err
+	}
+	if err := ctx.Err(); err != nil {
+		return inventory, err
+	}
+	return inventory, nil
+}
+
+// covered reports whether the images of the repository are scanned, by a registry scanning rule
+// or on push when the registry has no rules
+func (s *ECRService) covered(repository *ecr.Repository) bool {
+	if len(s.scanningRules) > 0 {
+		return s.coveredByRules(repository)
+	}
+	return scanOnPushEnabled(repository)
+}
+
+// countImages returns the number of images of the repository, and of those scanned
+func (s *ECRService) countImages(repository *ecr.Repository) (int, int, error) {
+	input := ecr.DescribeImagesInput{
+		MaxResults:     aws.Int64(1000),
+		RepositoryName: repository.RepositoryName,
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	var images, scanned int
+	for {
+		output, err := s.client.DescribeImages(&input)
+		if err != nil {
+			return images, scanned, err
+		}
+		for _, image := range output.ImageDetails {
+			images++
+			if image.ImageScanStatus == nil {
+				continue
+			}
+			// Enhanced scanning keeps continuously scanned images ACTIVE
+			switch aws.StringValue(image.ImageScanStatus.Status) {
+			case ecr.ScanStatusComplete, ecr.ScanStatusActive:
+				scanned++
+			}
+		}
+		if output.NextToken == nil {
+			return images, scanned, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// scanningRulesText describes each scanning rule by its frequency and filters, e.g.: SCAN_ON_PUSH on prod-*, team-*
+func scanningRulesText(rules []*ecr.RegistryScanningRule) []string {
+	var ret []string
+	for _, rule := range rules {
+		var filters []string
+		for _, f := range rule.RepositoryFilters {
+			filters = append(filters, aws.StringValue(f.Filter))
+		}
+		ret = append(ret, fmt.Sprintf("%s on %s", aws.StringValue(rule.ScanFrequency), strings.Join(filters, ", ")))
+	}
+	return ret
+}
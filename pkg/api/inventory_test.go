@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// inventoryECRService holds an app repository scanned on push with images on two pages,
+// and a base repository with one image never scanned
+type inventoryECRService struct {
+	mockECRService
+	rules        []*ecr.RegistryScanningRule
+	imagesFailed bool
+}
+
+func (m inventoryECRService) GetRegistryScanningConfiguration(input *ecr.GetRegistryScanningConfigurationInput) (*ecr.GetRegistryScanningConfigurationOutput, error) {
+	scanType := ecr.ScanTypeBasic
+	if len(m.rules) > 0 {
+		scanType = ecr.ScanTypeEnhanced
+	}
+	return &ecr.GetRegistryScanningConfigurationOutput{
+		ScanningConfiguration: &ecr.RegistryScanningConfiguration{ScanType: aws.String(scanType), Rules: m.rules},
+	}, nil
+}
+
+func (m inventoryECRService) DescribeRepositoriesPages(input *ecr.DescribeRepositoriesInput, fn func(*ecr.DescribeRepositoriesOutput, bool) bool) error {
+	fn(&ecr.DescribeRepositoriesOutput{Repositories: []*ecr.Repository{
+		{
+			RepositoryName:             aws.String("team-a/app"),
+			ImageScanningConfiguration: &ecr.ImageScanningConfiguration{ScanOnPush: aws.Bool(true)},
+		},
+		{RepositoryName: aws.String("team-a/base")},
+	}}, true)
+	return nil
+}
+
+func (m inventoryECRService) DescribeImages(input *ecr.DescribeImagesInput) (*ecr.DescribeImagesOutput, error) {
+	if m.imagesFailed {
+		return nil, fmt.Errorf("Fake describe images error")
+	}
+	status := func(s string) *ecr.ImageDetail {
+		return &ecr.ImageDetail{ImageScanStatus: &ecr.ImageScanStatus{Status: aws.String(s)}}
+	}
+	if *input.RepositoryName == "team-a/base" {
+		return &ecr.DescribeImagesOutput{ImageDetails: []*ecr.ImageDetail{{}}}, nil
+	}
+	if input.NextToken == nil {
+		return &ecr.DescribeImagesOutput{
+			ImageDetails: []*ecr.ImageDetail{status(ecr.ScanStatusComplete), status(ecr.ScanStatusFailed)},
+			NextToken:    aws.String("next"),
+		}, nil
+	}
+	return &ecr.DescribeImagesOutput{ImageDetails: []*ecr.ImageDetail{status(ecr.ScanStatusActive)}}, nil
+}
+
+func TestInventory(t *testing.T) {
+	cases := []struct {
+		client   inventoryECRService
+		expected report.RegistryInventory
+		err      bool
+	}{
+		{
+			client: inventoryECRService{},
+			expected: report.RegistryInventory{
+				RegistryID: "123456789012", Region: "us-east-1", ScanType: ecr.ScanTypeBasic,
+				Repositories: 2, CoveredRepositories: 1, Images: 4, ScannedImages: 2,
+			},
+		},
+		// Repositories are covered by rules of registries having them
+		{
+			client: inventoryECRService{rules: []*ecr.RegistryScanningRule{{
+				ScanFrequency:     aws.String(ecr.ScanFrequencyContinuousScan),
+				RepositoryFilters: []*ecr.ScanningRepositoryFilter{{Filter: aws.String("*/base")}, {Filter: aws.String("prod-*")}},
+			}}},
+			expected: report.RegistryInventory{
+				RegistryID: "123456789012", Region: "us-east-1", ScanType: ecr.ScanTypeEnhanced,
+				Rules:        []string{"CONTINUOUS_SCAN on */base, prod-*"},
+				Repositories: 2, CoveredRepositories: 1, Images: 4, ScannedImages: 2,
+			},
+		},
+		// Counting stops at the first failure
+		{
+			client: inventoryECRService{imagesFailed: true},
+			expected: report.RegistryInventory{
+				RegistryID: "123456789012", Region: "us-east-1", ScanType: ecr.ScanTypeBasic,
+				Repositories: 1, CoveredRepositories: 1,
+			},
+			err: true,
+		},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("123456789012", "us-east-1", "latest", Options{}, service.logger, c.client)
+		inventory, err := s.Inventory(context.Background())
+		if (err != nil) != c.err {
+			t.Fatalf("[%d] unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(*inventory, c.expected) {
+			t.Fatalf("[%d] values are not equal, wanting: %+v, got: %+v", i, c.expected, *inventory)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+)
+
+// InvokeService invokes a Lambda function, e.g.: the running function itself to continue its work
+type InvokeService struct {
+	client       lambdaiface.LambdaAPI
+	functionName string
+}
+
+// NewInvokeService .
+func NewInvokeService(functionName string, client lambdaiface.LambdaAPI) *InvokeService {
+	return &InvokeService{
+		client:       client,
+		functionName: functionName,
+	}
+}
+
+// InvokeAsync invokes the function with payload marshalled to JSON, without waiting for the result
+func (s *InvokeService) InvokeAsync(payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Invoke(&lambda.InvokeInput{
+		FunctionName:   aws.String(s.functionName),
+		InvocationType: aws.String(lambda.InvocationTypeEvent),
+		Payload:        body,
+	})
+	return err
+}
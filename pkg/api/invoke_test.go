@@ -0,0 +1,34 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+)
+
+type mockLambdaService struct {
+	lambdaiface.LambdaAPI
+	input *lambda.InvokeInput
+}
+
+func (m *mockLambdaService) Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	m.input = input
+	return &lambda.InvokeOutput{StatusCode: new(int64)}, nil
+}
+
+func TestInvokeAsync(t *testing.T) {
+	client := &mockLambdaService{}
+	s := NewInvokeService("ecr-report-lambda", client)
+
+	if err := s.InvokeAsync(map[string]string{"body": `{"resumeToken":"abc"}`}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *client.input.FunctionName != "ecr-report-lambda" || *client.input.InvocationType != lambda.InvocationTypeEvent {
+		t.Fatalf("Expected asynchronous invocation of ecr-report-lambda, got: %+v", client.input)
+	}
+	expected := `{"body":"{\"resumeToken\":\"abc\"}"}`
+	if string(client.input.Payload) != expected {
+		t.Fatalf("values not equal, wanting: %s, got: %s", expected, client.input.Payload)
+	}
+}
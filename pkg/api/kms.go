@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/base64"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// KMSService decrypts environment variables encrypted with KMS
+type KMSService struct {
+	client       kmsiface.KMSAPI
+	functionName string
+}
+
+// NewKMSService .
+func NewKMSService(functionName string, client kmsiface.KMSAPI) *KMSService {
+	return &KMSService{
+		client:       client,
+		functionName: functionName,
+	}
+}
+
+// Decrypt decrypts a base64 encoded ciphertext blob. Values encrypted with the Lambda console's
+// encryption helpers carry the function name as encryption context, others are decrypted without one
+func (s *KMSService) Decrypt(ciphertext string) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	input := &kms.DecryptInput{CiphertextBlob: blob}
+	if s.functionName != "" {
+		input.EncryptionContext = map[string]*string{"LambdaFunctionName": aws.String(s.functionName)}
+		output, err := s.client.Decrypt(input)
+		if err == nil {
+			return string(output.Plaintext), nil
+		}
+		input.EncryptionContext = nil
+	}
+
+	output, err := s.client.Decrypt(input)
+	if err != nil {
+		return "", err
+	}
+	return string(output.Plaintext), nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+type mockKMSService struct {
+	kmsiface.KMSAPI
+}
+
+// Decrypt "decrypts" blobs prefixed with the encryption context they were encrypted with
+func (m mockKMSService) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	context := ""
+	if name, ok := input.EncryptionContext["LambdaFunctionName"]; ok {
+		context = *name
+	}
+
+	blob := string(input.CiphertextBlob)
+	prefix := context + ":"
+	if len(blob) < len(prefix) || blob[:len(prefix)] != prefix {
+		return nil, fmt.Errorf("InvalidCiphertextException")
+	}
+	return &kms.DecryptOutput{Plaintext: []byte(blob[len(prefix):])}, nil
+}
+
+func TestDecrypt(t *testing.T) {
+	cases := []struct {
+		functionName string
+		ciphertext   string
+		expected     string
+	}{
+		{functionName: "ecr-report-lambda", ciphertext: "ecr-report-lambda:xoxb-1", expected: "xoxb-1"},
+		{functionName: "ecr-report-lambda", ciphertext: ":xoxb-2", expected: "xoxb-2"},
+		{functionName: "", ciphertext: ":xoxb-3", expected: "xoxb-3"},
+	}
+
+	for i, c := range cases {
+		svc := NewKMSService(c.functionName, mockKMSService{})
+		value, err := svc.Decrypt(base64.StdEncoding.EncodeToString([]byte(c.ciphertext)))
+		if err != nil {
+			t.Fatalf("[%d] Error decrypting value: %s", i, err)
+		}
+		if value != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %s, got: %s", i, c.expected, value)
+		}
+	}
+}
+
+func TestDecryptError(t *testing.T) {
+	svc := NewKMSService("ecr-report-lambda", mockKMSService{})
+
+	if _, err := svc.Decrypt("not base64!"); err == nil {
+		t.Fatalf("Expected error for invalid base64")
+	}
+	if _, err := svc.Decrypt(base64.StdEncoding.EncodeToString([]byte("other:xoxb"))); err == nil {
+		t.Fatalf("Expected error for foreign ciphertext")
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+const (
+	// Image configurations are a few kilobytes, anything larger isn't read
+	maxImageConfigSize = 1 << 20
+	// Longer build instructions are cut, e.g.: RUN commands chaining every package installed
+	maxInstructionLength = 80
+)
+
+// layerHTTPClient downloads image configurations from the URLs ECR hands out
+var layerHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// imageConfig is the part of the image configuration telling how each layer was built
+type imageConfig struct {
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+}
+
+// attributeLayers notes which layers of the image introduced the packages of the reported findings, along with
+// the build instruction of each layer when the image configuration records it. Only enhanced scanning findings
+// tell the layer of the package.
+func (s *ECRService) attributeLayers(info *RepositoryInfo, digest string) {
+	if s.scanType != ecr.ScanTypeEnhanced {
+		return
+	}
+
+	manifest, err := s.getManifest(s.registryID, info.Name, &ecr.ImageIdentifier{ImageDigest: aws.String(digest)})
+	if err != nil {
+		s.logger.Errorf("Error getting manifest of repository %s: %s", info.Name, err.Error())
+		return
+	}
+
+	layers := make(map[string]*report.Layer)
+	for i, l := range manifest.Layers {
+		layers[l.Digest] = &report.Layer{Index: i + 1, Digest: l.Digest}
+	}
+	instructions, err := s.layerInstructions(info.Name, manifest.Config.Digest)
+	if err != nil {
+		s.logger.Debugf("Layers of repository %s are listed without their build instructions: %s", info.Name, err.Error())
+	}
+	for i, instruction := range instructions {
+		if i < len(manifest.Layers) {
+			layers[manifest.Layers[i].Digest].Instruction = instruction
+		}
+	}
+
+	packages := make(map[string]map[string]bool)
+	err = s.enhancedFindings(info.Name, digest, func(finding *ecr.EnhancedImageScanFinding) {
+		if !severity.Reaches(aws.StringValue(finding.Severity), info.MinimumSeverity) || finding.PackageVulnerabilityDetails == nil {
+			return
+		}
+		// Packages of a finding may be spread over layers, each of them introduced it
+		counted := make(map[string]bool)
+		for _, p := range finding.PackageVulnerabilityDetails.VulnerablePackages {
+			hash := aws.StringValue(p.SourceLayerHash)
+			layer, ok := layers[hash]
+			if !ok {
+				continue
+			}
+			if !counted[hash] {
+				counted[hash] = true
+				layer.Findings++
+			}
+			if packages[hash] == nil {
+				packages[hash] = make(map[string]bool)
+			}
+			packages[hash][aws.StringValue(p.Name)] = true
+		}
+	})
+	if err != nil {
+		s.logger.Errorf("Error listing findings of repository %s: %s", info.Name, err.Error())
+		return
+	}
+
+	info.Layers = nil
+	for hash, layer := range layers {
+		if layer.Findings == 0 {
+			continue
+		}
+		for name := range packages[hash] {
+			layer.Packages = append(layer.Packages, name)
+		}
+		sort.Strings(layer.Packages)
+		info.Layers = append(info.Layers, *layer)
+	}
+	sort.Slice(info.Layers, func(i, j int) bool {
+		return info.Layers[i].Index < info.Layers[j].Index
+	})
+}
+
+// layerInstructions returns the build instruction of each layer of the image in order, from the history of the
+// image configuration. Images built without history, e.g.: by some distroless builders, have none.
+func (s *ECRService) layerInstructions(repositoryName string, configDigest string) ([]string, error) {
+	if configDigest == "" {
+		return nil, fmt.Errorf("Manifest has no image configuration")
+	}
+	input := ecr.GetDownloadUrlForLayerInput{
+		LayerDigest:    aws.String(configDigest),
+		RepositoryName: aws.String(repositoryName),
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+	output, err := s.client.GetDownloadUrlForLayer(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := layerHTTPClient.Get(aws.StringValue(output.DownloadUrl))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Downloading image configuration responded with status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxImageConfigSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var config imageConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("Error parsing image configuration: %s", err)
+	}
+	var instructions []string
+	for _, h := range config.History {
+		// Instructions like ENV or CMD only change the configuration, they don't create a layer
+		if !h.EmptyLayer {
+			instructions = append(instructions, instruction(h.CreatedBy))
+		}
+	}
+	return instructions, nil
+}
+
+// instruction turns the command recorded in the image history into the Dockerfile instruction it came from
+func instruction(createdBy string) string {
+	text := strings.TrimSpace(createdBy)
+	text = strings.TrimSuffix(text, "# buildkit")
+	switch {
+	case strings.HasPrefix(text, "/bin/sh -c #(nop) "):
+		text = strings.TrimPrefix(text, "/bin/sh -c #(nop) ")
+	case strings.HasPrefix(text, "/bin/sh -c "):
+		text = "RUN " + strings.TrimPrefix(text, "/bin/sh -c ")
+	case strings.HasPrefix(text, "RUN /bin/sh -c "):
+		text = "RUN " + strings.TrimPrefix(text, "RUN /bin/sh -c ")
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxInstructionLength {
+		text = string(runes[:maxInstructionLength-3]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+const (
+	testLayeredImage = `{"schemaVersion": 2, "config": {"digest": "sha256:config"},
+		"layers": [{"digest": "sha256:alpine"}, {"digest": "sha256:openssl"}, {"digest": "sha256:app"}]}`
+	testImageConfig = `{"history": [
+		{"created_by": "/bin/sh -c #(nop) ADD file:0123 in / "},
+		{"created_by": "/bin/sh -c #(nop)  CMD [\"/bin/sh\"]", "empty_layer": true},
+		{"created_by": "RUN /bin/sh -c apk add --no-cache openssl # buildkit"},
+		{"created_by": "COPY app /usr/local/bin/app # buildkit"}
+	]}`
+)
+
+// layeredECRService serves an image with findings in its first two layers, its configuration downloaded from url
+type layeredECRService struct {
+	mockECRService
+	url string
+}
+
+func (m layeredECRService) BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error) {
+	return &ecr.BatchGetImageOutput{
+		Images: []*ecr.Image{{ImageManifest: aws.String(testLayeredImage), ImageManifestMediaType: aws.String(mediaTypeOCIImageManifest)}},
+	}, nil
+}
+
+func (m layeredECRService) GetDownloadUrlForLayer(input *ecr.GetDownloadUrlForLayerInput) (*ecr.GetDownloadUrlForLayerOutput, error) {
+	return &ecr.GetDownloadUrlForLayerOutput{DownloadUrl: aws.String(m.url + "/" + *input.LayerDigest), LayerDigest: input.LayerDigest}, nil
+}
+
+func (m layeredECRService) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	finding := func(level string, packages ...*ecr.VulnerablePackage) *ecr.EnhancedImageScanFinding {
+		return &ecr.EnhancedImageScanFinding{
+			Severity:                    aws.String(level),
+			PackageVulnerabilityDetails: &ecr.PackageVulnerabilityDetails{VulnerablePackages: packages},
+		}
+	}
+	vulnerable := func(name string, layer string) *ecr.VulnerablePackage {
+		return &ecr.VulnerablePackage{Name: aws.String(name), SourceLayerHash: aws.String(layer)}
+	}
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageScanFindings: &ecr.ImageScanFindings{EnhancedFindings: []*ecr.EnhancedImageScanFinding{
+			finding("CRITICAL", vulnerable("libssl3", "sha256:openssl"), vulnerable("libcrypto3", "sha256:openssl")),
+			finding("HIGH", vulnerable("openssl", "sha256:openssl")),
+			finding("LOW", vulnerable("busybox", "sha256:alpine")),
+		}},
+	}, nil
+}
+
+func TestAttributeLayers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sha256:config" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testImageConfig))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		minimum string
+		url     string
+		layers  []report.Layer
+	}{
+		{
+			url: server.URL,
+			layers: []report.Layer{
+				{Index: 1, Digest: "sha256:alpine", Instruction: "ADD file:0123 in /", Findings: 1, Packages: []string{"busybox"}},
+				{Index: 2, Digest: "sha256:openssl", Instruction: "RUN apk add --no-cache openssl", Findings: 2, Packages: []string{"libcrypto3", "libssl3", "openssl"}},
+			},
+		},
+		{
+			minimum: "HIGH",
+			url:     server.URL,
+			layers: []report.Layer{
+				{Index: 2, Digest: "sha256:openssl", Instruction: "RUN apk add --no-cache openssl", Findings: 2, Packages: []string{"libcrypto3", "libssl3", "openssl"}},
+			},
+		},
+		// Without the configuration the layers are listed without instructions
+		{
+			minimum: "HIGH",
+			url:     server.URL + "/missing",
+			layers: []report.Layer{
+				{Index: 2, Digest: "sha256:openssl", Findings: 2, Packages: []string{"libcrypto3", "libssl3", "openssl"}},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("123456789012", "us-east-1", "latest", Options{}, service.logger, layeredECRService{url: c.url})
+		s.scanType = ecr.ScanTypeEnhanced
+
+		info := &RepositoryInfo{Name: "TestRepo/Test1", MinimumSeverity: c.minimum}
+		s.attributeLayers(info, "sha256:image")
+		if !reflect.DeepEqual(info.Layers, c.layers) {
+			t.Fatalf("[%d] values are not equal, wanting: %+v, got: %+v", i, c.layers, info.Layers)
+		}
+	}
+
+	// Basic scanning findings don't tell the layer of the package
+	s := NewECRService("123456789012", "us-east-1", "latest", Options{}, service.logger, layeredECRService{url: server.URL})
+	s.scanType = ecr.ScanTypeBasic
+	info := &RepositoryInfo{Name: "TestRepo/Test1"}
+	if s.attributeLayers(info, "sha256:image"); info.Layers != nil {
+		t.Fatalf("Expected no layers with basic scanning, got: %+v", info.Layers)
+	}
+}
+
+func TestInstruction(t *testing.T) {
+	cases := map[string]string{
+		"/bin/sh -c #(nop) COPY file:abc in /app ":                  "COPY file:abc in /app",
+		"/bin/sh -c apt-get update &&     apt-get install -y curl":  "RUN apt-get update && apt-get install -y curl",
+		"RUN /bin/sh -c pip install -r requirements.txt # buildkit": "RUN pip install -r requirements.txt",
+		"WORKDIR /app": "WORKDIR /app",
+	}
+	for createdBy, expected := range cases {
+		if text := instruction(createdBy); text != expected {
+			t.Fatalf("values are not equal, wanting: %s, got: %s", expected, text)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// Lifecycle policy audit modes
+const (
+	// Repositories without a lifecycle policy are reported
+	LifecyclePolicyAuditReport = "report"
+	// Repositories without a lifecycle policy are reported along with a suggested policy
+	LifecyclePolicyAuditSuggest = "suggest"
+)
+
+// SuggestedLifecyclePolicy expires untagged images after two weeks and keeps the 100 most recent images
+const SuggestedLifecyclePolicy = `{
+  "rules": [
+    {
+      "rulePriority": 1,
+      "description": "Expire untagged images after 14 days",
+      "selection": {
+        "tagStatus": "untagged",
+        "countType": "sinceImagePushed",
+        "countUnit": "days",
+        "countNumber": 14
+      },
+      "action": {"type": "expire"}
+    },
+    {
+      "rulePriority": 2,
+      "description": "Keep the 100 most recent images",
+      "selection": {
+        "tagStatus": "any",
+        "countType": "imageCountMoreThan",
+        "countNumber": 100
+      },
+      "action": {"type": "expire"}
+    }
+  ]
+}`
+
+// checkLifecyclePolicy reports the repository when it has no lifecycle policy
+func (s *ECRService) checkLifecyclePolicy(repository *ecr.Repository, report *Report, mu *sync.Mutex) {
+	if s.options.LifecyclePolicyAudit != LifecyclePolicyAuditReport && s.options.LifecyclePolicyAudit != LifecyclePolicyAuditSuggest {
+		return
+	}
+
+	input := ecr.GetLifecyclePolicyInput{RepositoryName: repository.RepositoryName}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	_, err := s.client.GetLifecyclePolicy(&input)
+	if err == nil {
+		return
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ecr.ErrCodeLifecyclePolicyNotFoundException {
+		s.logger.Errorf("Error getting lifecycle policy of repository %s: %s", *repository.RepositoryName, err.Error())
+		return
+	}
+
+	mu.Lock()
+	report.NoLifecyclePolicy = append(report.NoLifecyclePolicy, &RepositoryInfo{Name: *repository.RepositoryName})
+	if s.options.LifecyclePolicyAudit == LifecyclePolicyAuditSuggest {
+		report.SuggestedLifecyclePolicy = SuggestedLifecyclePolicy
+	}
+	mu.Unlock()
+}
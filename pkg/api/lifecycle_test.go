@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func (m mockECRService) GetLifecyclePolicy(input *ecr.GetLifecyclePolicyInput) (*ecr.GetLifecyclePolicyOutput, error) {
+	if *input.RepositoryName == "TestRepo/Test1" {
+		return &ecr.GetLifecyclePolicyOutput{LifecyclePolicyText: aws.String(SuggestedLifecyclePolicy)}, nil
+	}
+	return nil, awserr.New(ecr.ErrCodeLifecyclePolicyNotFoundException, "Lifecycle policy does not exist", nil)
+}
+
+func TestCheckLifecyclePolicy(t *testing.T) {
+	repositories := []*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("TestRepo/Test2")},
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	cases := []struct {
+		audit      string
+		missing    int
+		suggestion bool
+	}{
+		{audit: "", missing: 0, suggestion: false},
+		{audit: LifecyclePolicyAuditReport, missing: 1, suggestion: false},
+		{audit: LifecyclePolicyAuditSuggest, missing: 1, suggestion: true},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("xxxxx", "us-east-1", "latest", Options{LifecyclePolicyAudit: c.audit}, service.logger, mockECRService{})
+		report := s.GatherVulnerabilities(ctx, gen(repositories), "MEDIUM", false, 1)
+
+		if len(report.NoLifecyclePolicy) != c.missing {
+			t.Fatalf("[%d] values are not equal, wanting: %d, got: %d", i, c.missing, len(report.NoLifecyclePolicy))
+		}
+		if c.missing > 0 && report.NoLifecyclePolicy[0].Name != "TestRepo/Test2" {
+			t.Fatalf("[%d] Expected TestRepo/Test2 to be reported, got: %s", i, report.NoLifecyclePolicy[0].Name)
+		}
+		if (report.SuggestedLifecyclePolicy != "") != c.suggestion {
+			t.Fatalf("[%d] Unexpected suggested policy: %q", i, report.SuggestedLifecyclePolicy)
+		}
+	}
+}
+
+func TestSuggestedLifecyclePolicy(t *testing.T) {
+	if !json.Valid([]byte(SuggestedLifecyclePolicy)) {
+		t.Fatalf("Expected the suggested lifecycle policy to be valid JSON")
+	}
+}
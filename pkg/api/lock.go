@@ -0,0 +1,65 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// LockService guards against doing the same work twice with conditional writes to a DynamoDB table.
+// The table needs a LockKey string partition key, enable TTL on ExpiresAt to clean up expired locks.
+type LockService struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewLockService .
+func NewLockService(table string, ttl time.Duration, client dynamodbiface.DynamoDBAPI) *LockService {
+	return &LockService{
+		client: client,
+		table:  table,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Acquire takes the lock for key and reports whether it succeeded.
+// Locks held by someone else are only taken over once they expire.
+func (l *LockService) Acquire(key string) (bool, error) {
+	now := l.now()
+	_, err := l.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockKey":   {S: aws.String(key)},
+			"ExpiresAt": {N: aws.String(strconv.FormatInt(now.Add(l.ttl).Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(LockKey) OR ExpiresAt < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Release gives up the lock for key, so the work can be retried
+func (l *LockService) Release(key string) error {
+	_, err := l.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"LockKey": {S: aws.String(key)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// mockDynamoDB evaluates the lock condition against an in-memory table
+type mockDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]int64
+	err   error
+}
+
+func (m *mockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	key := aws.StringValue(input.Item["LockKey"].S)
+	now, _ := strconv.ParseInt(aws.StringValue(input.ExpressionAttributeValues[":now"].N), 10, 64)
+	if expiresAt, ok := m.items[key]; ok && expiresAt >= now {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	m.items[key], _ = strconv.ParseInt(aws.StringValue(input.Item["ExpiresAt"].N), 10, 64)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	delete(m.items, aws.StringValue(input.Key["LockKey"].S))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestLockService(t *testing.T) {
+	now := time.Date(2020, 7, 19, 8, 0, 0, 0, time.UTC)
+	lock := NewLockService("ecr-scan-locks", time.Hour, &mockDynamoDB{items: map[string]int64{}})
+	lock.now = func() time.Time { return now }
+
+	cases := []struct {
+		action   func() (bool, error)
+		expected bool
+	}{
+		{action: func() (bool, error) { return lock.Acquire("report") }, expected: true},
+		// Held by the first invocation
+		{action: func() (bool, error) { return lock.Acquire("report") }, expected: false},
+		{action: func() (bool, error) { return lock.Acquire("other") }, expected: true},
+		// Expired
+		{action: func() (bool, error) { now = now.Add(2 * time.Hour); return lock.Acquire("report") }, expected: true},
+		// Released
+		{action: func() (bool, error) { return true, lock.Release("report") }, expected: true},
+		{action: func() (bool, error) { return lock.Acquire("report") }, expected: true},
+	}
+
+	for i, c := range cases {
+		acquired, err := c.action()
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", i, err)
+		}
+		if acquired != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %t, got: %t", i, c.expected, acquired)
+		}
+	}
+}
+
+func TestLockServiceError(t *testing.T) {
+	lock := NewLockService("ecr-scan-locks", time.Hour, &mockDynamoDB{err: fmt.Errorf("ResourceNotFoundException")})
+	if _, err := lock.Acquire("report"); err == nil {
+		t.Fatalf("Expected error to be returned")
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+const (
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIImageIndex      = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCIImageManifest   = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// Platform is a single architecture image of a manifest list
+type Platform struct {
+	// OS and architecture of the image, e.g.: linux/arm64
+	Name   string
+	Digest string
+}
+
+type manifestList struct {
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+			Variant      string `json:"variant"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// ResolvePlatforms returns the per platform images of the tagged image when it is a manifest list.
+// Returns nil for single architecture images.
+func (s *ECRService) ResolvePlatforms(repositoryName *string) ([]Platform, error) {
+	input := ecr.BatchGetImageInput{
+		AcceptedMediaTypes: aws.StringSlice([]string{
+			mediaTypeDockerManifestList,
+			mediaTypeOCIImageIndex,
+			mediaTypeDockerManifest,
+			mediaTypeOCIImageManifest,
+		}),
+		ImageIds: []*ecr.ImageIdentifier{
+			{ImageTag: aws.String(s.imageTag)},
+		},
+		RepositoryName: repositoryName,
+	}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	output, err := s.client.BatchGetImage(&input)
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Images) == 0 {
+		return nil, nil
+	}
+
+	image := output.Images[0]
+	mediaType := aws.StringValue(image.ImageManifestMediaType)
+	if mediaType != mediaTypeDockerManifestList && mediaType != mediaTypeOCIImageIndex {
+		return nil, nil
+	}
+
+	return parsePlatforms(aws.StringValue(image.ImageManifest))
+}
+
+// parsePlatforms extracts platform images from a manifest list, leaving out attestation manifests
+func parsePlatforms(manifest string) ([]Platform, error) {
+	var list manifestList
+	if err := json.Unmarshal([]byte(manifest), &list); err != nil {
+		return nil, fmt.Errorf("Error parsing manifest list: %s", err)
+	}
+
+	var platforms []Platform
+	for _, m := range list.Manifests {
+		if m.Platform.OS == "" || m.Platform.OS == "unknown" {
+			continue
+		}
+
+		name := m.Platform.OS + "/" + m.Platform.Architecture
+		if m.Platform.Variant != "" {
+			name += "/" + m.Platform.Variant
+		}
+		platforms = append(platforms, Platform{Name: name, Digest: m.Digest})
+	}
+	return platforms, nil
+}
+
+// StartImageScanDigest triggers image scan on given repository for a provided image digest
+func (s *ECRService) StartImageScanDigest(repositoryName *string, digest string) (*ecr.StartImageScanOutput, error) {
+	startImageScanInput := ecr.StartImageScanInput{
+		ImageId: &ecr.ImageIdentifier{
+			ImageDigest: aws.String(digest),
+		},
+		RepositoryName: repositoryName,
+	}
+	if len(s.registryID) != 0 {
+		startImageScanInput.RegistryId = aws.String(s.registryID)
+	}
+	return s.client.StartImageScan(&startImageScanInput)
+}
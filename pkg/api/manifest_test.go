@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+)
+
+var testManifestList = `{
+	"schemaVersion": 2,
+	"mediaType": "application/vnd.oci.image.index.v1+json",
+	"manifests": [
+		{"digest": "sha256:amd64", "platform": {"os": "linux", "architecture": "amd64"}},
+		{"digest": "sha256:arm64", "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}},
+		{"digest": "sha256:attestation", "platform": {"os": "unknown", "architecture": "unknown"}}
+	]
+}`
+
+func (m mockECRService) BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error) {
+	if *input.RepositoryName == "TestRepo/MultiArch" {
+		return &ecr.BatchGetImageOutput{
+			Images: []*ecr.Image{
+				{
+					ImageManifest:          aws.String(testManifestList),
+					ImageManifestMediaType: aws.String(mediaTypeOCIImageIndex),
+				},
+			},
+		}, nil
+	}
+	return &ecr.BatchGetImageOutput{
+		Images: []*ecr.Image{
+			{
+				ImageManifest:          aws.String(`{"schemaVersion": 2}`),
+				ImageManifestMediaType: aws.String(mediaTypeDockerManifest),
+			},
+		},
+	}, nil
+}
+
+func TestParsePlatforms(t *testing.T) {
+	expected := []Platform{
+		{Name: "linux/amd64", Digest: "sha256:amd64"},
+		{Name: "linux/arm64/v8", Digest: "sha256:arm64"},
+	}
+
+	platforms, err := parsePlatforms(testManifestList)
+	if err != nil {
+		t.Fatalf("Error parsing manifest list: %s", err)
+	}
+	if !reflect.DeepEqual(platforms, expected) {
+		t.Fatalf("values not equal, wanting: %v, got: %v", expected, platforms)
+	}
+
+	if _, err := parsePlatforms("not json"); err == nil {
+		t.Fatalf("Expected error parsing invalid manifest list")
+	}
+}
+
+func TestResolvePlatforms(t *testing.T) {
+	platforms, err := service.ResolvePlatforms(aws.String("TestRepo/Test1"))
+	if err != nil {
+		t.Fatalf("Error resolving platforms: %s", err)
+	}
+	if platforms != nil {
+		t.Fatalf("Expected no platforms for single architecture image, got: %v", platforms)
+	}
+
+	platforms, err = service.ResolvePlatforms(aws.String("TestRepo/MultiArch"))
+	if err != nil {
+		t.Fatalf("Error resolving platforms: %s", err)
+	}
+	if len(platforms) != 2 {
+		t.Fatalf("values not equal, wanting: %d, got: %d", 2, len(platforms))
+	}
+}
+
+func TestGatherMultiArch(t *testing.T) {
+	logger, err := logger.NewLogger("DEBUG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{ResolveManifestLists: true}, logger, mockECRService{})
+
+	repositories := []*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/MultiArch")},
+		{RepositoryName: aws.String("TestRepo/Test1")},
+	}
+	report := s.GatherVulnerabilities(context.Background(), gen(repositories), "MEDIUM", false, 2)
+
+	var filtered []string
+	for _, r := range report.Filtered {
+		filtered = append(filtered, r.DisplayName())
+	}
+	if len(filtered) != 2 || !contains("TestRepo/MultiArch (linux/amd64)", filtered) || !contains("TestRepo/Test1", filtered) {
+		t.Fatalf("Filtered values not equal, got: %v", filtered)
+	}
+
+	if len(report.NotScanned) != 1 || report.NotScanned[0].DisplayName() != "TestRepo/MultiArch (linux/arm64/v8)" {
+		t.Fatalf("NotScanned values not equal, got: %v", report.NotScanned)
+	}
+}
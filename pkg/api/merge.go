@@ -0,0 +1,164 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// NamedSource is a findings source along with the name findings are attributed to
+type NamedSource struct {
+	// e.g.: trivy-s3
+	Name string
+	// ECR client of the scanned registry when nil
+	Source FindingsSource
+}
+
+// MergedSource returns the union of the findings of several sources. A vulnerability of a package listed by
+// several sources is counted once, with the severity of the first source listing it, and the findings each
+// source listed are noted in RepositoryInfo.Sources. Sources without results for the image are left out,
+// the image is only not scanned when none of them has results.
+type MergedSource struct {
+	sources []NamedSource
+	// ECR client sources without one read from
+	client FindingsSource
+
+	attribution *attribution
+}
+
+// attribution keeps the number of findings each source listed, by repository@digest
+type attribution struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int
+}
+
+// NewMergedSource creates a source merging the findings of the sources, in order
+func NewMergedSource(sources ...NamedSource) *MergedSource {
+	return &MergedSource{
+		sources:     sources,
+		attribution: &attribution{counts: make(map[string]map[string]int)},
+	}
+}
+
+// bind returns the source reading findings of sources without one with the ECR client
+func (m *MergedSource) bind(client FindingsSource) *MergedSource {
+	bound := *m
+	bound.client = client
+	return &bound
+}
+
+// Sources returns the number of findings each source listed for the image, nil when it wasn't looked up
+func (m *MergedSource) Sources(repositoryName string, digest string) map[string]int {
+	m.attribution.mu.Lock()
+	defer m.attribution.mu.Unlock()
+	return m.attribution.counts[repositoryName+"@"+digest]
+}
+
+// DescribeImageScanFindings returns every merged finding of the image on a single page. Every page of each source
+// is read, so counting findings with ECR as one of the sources takes a call per 1000 findings.
+func (m *MergedSource) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	var merged *ecr.DescribeImageScanFindingsOutput
+	seen := make(map[string]bool)
+	counts := make(map[string]int)
+	var notFound error
+
+	for _, named := range m.sources {
+		source := named.Source
+		if source == nil {
+			source = m.client
+		}
+		outputs, err := allFindings(source, input)
+		if isScanNotFound(err) {
+			notFound = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, output := range outputs {
+			if merged == nil {
+				merged = &ecr.DescribeImageScanFindingsOutput{
+					ImageId:           output.ImageId,
+					ImageScanStatus:   output.ImageScanStatus,
+					RegistryId:        output.RegistryId,
+					RepositoryName:    output.RepositoryName,
+					ImageScanFindings: &ecr.ImageScanFindings{FindingSeverityCounts: make(map[string]*int64)},
+				}
+			}
+			if output.ImageScanFindings == nil {
+				continue
+			}
+			findings := merged.ImageScanFindings
+			if completed := output.ImageScanFindings.ImageScanCompletedAt; completed != nil && (findings.ImageScanCompletedAt == nil || completed.After(*findings.ImageScanCompletedAt)) {
+				findings.ImageScanCompletedAt = completed
+			}
+			for _, finding := range output.ImageScanFindings.Findings {
+				counts[named.Name]++
+				if merge(seen, basicFinding(finding)) {
+					findings.Findings = append(findings.Findings, finding)
+					countFinding(findings, aws.StringValue(finding.Severity))
+				}
+			}
+			for _, finding := range output.ImageScanFindings.EnhancedFindings {
+				counts[named.Name]++
+				if merge(seen, enhancedScanFinding(finding)) {
+					findings.EnhancedFindings = append(findings.EnhancedFindings, finding)
+					countFinding(findings, aws.StringValue(finding.Severity))
+				}
+			}
+		}
+	}
+	if merged == nil {
+		return nil, notFound
+	}
+
+	if merged.ImageId != nil {
+		m.attribution.mu.Lock()
+		m.attribution.counts[aws.StringValue(merged.RepositoryName)+"@"+aws.StringValue(merged.ImageId.ImageDigest)] = counts
+		m.attribution.mu.Unlock()
+	}
+	return merged, nil
+}
+
+// allFindings reads every page of the findings of the image from the source
+func allFindings(source FindingsSource, input *ecr.DescribeImageScanFindingsInput) ([]*ecr.DescribeImageScanFindingsOutput, error) {
+	paged := *input
+	paged.MaxResults = aws.Int64(1000)
+	paged.NextToken = nil
+
+	var outputs []*ecr.DescribeImageScanFindingsOutput
+	for {
+		output, err := source.DescribeImageScanFindings(&paged)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+		if output.NextToken == nil {
+			return outputs, nil
+		}
+		paged.NextToken = output.NextToken
+	}
+}
+
+// merge notes the vulnerable packages of the finding, reports whether any of them wasn't listed before
+func merge(seen map[string]bool, f scanFinding) bool {
+	if len(f.packages) == 0 {
+		f.packages = []string{""}
+	}
+	listed := true
+	for _, p := range f.packages {
+		key := f.id + "|" + p
+		if !seen[key] {
+			seen[key] = true
+			listed = false
+		}
+	}
+	return !listed
+}
+
+// countFinding adds the finding to the severity counts
+func countFinding(findings *ecr.ImageScanFindings, level string) {
+	findings.FindingSeverityCounts[level] = aws.Int64(aws.Int64Value(findings.FindingSeverityCounts[level]) + 1)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// mergeECRService lists the basic findings of team-a/api on two pages, team-b/web was never scanned
+type mergeECRService struct {
+	mockECRService
+}
+
+func (m mergeECRService) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	if *input.RepositoryName == "team-b/web" {
+		return nil, awserr.New(ecr.ErrCodeScanNotFoundException, "never scanned", nil)
+	}
+	finding := func(id string, pkg string, level string) *ecr.ImageScanFinding {
+		return &ecr.ImageScanFinding{
+			Name:       aws.String(id),
+			Severity:   aws.String(level),
+			Attributes: []*ecr.Attribute{{Key: aws.String("package_name"), Value: aws.String(pkg)}},
+		}
+	}
+	output := &ecr.DescribeImageScanFindingsOutput{
+		ImageId:        &ecr.ImageIdentifier{ImageDigest: aws.String("sha256:abc"), ImageTag: aws.String("latest")},
+		RepositoryName: input.RepositoryName,
+	}
+	if input.NextToken == nil {
+		output.ImageScanFindings = &ecr.ImageScanFindings{Findings: []*ecr.ImageScanFinding{
+			finding("CVE-2020-0001", "openssl", "HIGH"),
+			finding("CVE-2020-0002", "musl", "MEDIUM"),
+		}}
+		output.NextToken = aws.String("next")
+		return output, nil
+	}
+	output.ImageScanFindings = &ecr.ImageScanFindings{Findings: []*ecr.ImageScanFinding{
+		finding("CVE-2020-0004", "zlib", "LOW"),
+	}}
+	return output, nil
+}
+
+func TestMergedSource(t *testing.T) {
+	client := &mockS3Service{objects: map[string][]byte{"ci-reports/trivy/team-a/api/latest.json": []byte(trivyReportJSON)}}
+	trivy, err := NewTrivyS3Source("s3://ci-reports/trivy", client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	merged := NewMergedSource(NamedSource{Name: "ecr"}, NamedSource{Name: "trivy-s3", Source: trivy})
+	s := NewECRService("", "us-east-1", "latest", Options{FindingsSource: merged}, service.logger, mergeECRService{})
+
+	output, err := s.getImageScanFinding(&ecr.Repository{RepositoryName: aws.String("team-a/api")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// CVE-2020-0001 of openssl and CVE-2020-0002 of musl are listed by both, with the severity ECR gave them
+	expected := map[string]int64{"CRITICAL": 1, "HIGH": 1, "MEDIUM": 1, "LOW": 1}
+	counts := make(map[string]int64)
+	for level, count := range output.ImageScanFindings.FindingSeverityCounts {
+		counts[level] = *count
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, counts)
+	}
+	if len(output.ImageScanFindings.Findings) != 4 || output.NextToken != nil {
+		t.Fatalf("Expected every finding on a single page, got: %d", len(output.ImageScanFindings.Findings))
+	}
+
+	info := s.createInfo(output)
+	if !reflect.DeepEqual(info.Sources, map[string]int{"ecr": 3, "trivy-s3": 3}) {
+		t.Fatalf("Unexpected sources: %v", info.Sources)
+	}
+
+	// Images none of the sources has results of aren't scanned
+	output, err = s.getImageScanFinding(&ecr.Repository{RepositoryName: aws.String("team-b/web")})
+	if !isScanNotFound(err) {
+		t.Fatalf("Expected images none of the sources has results of not to be scanned, got: %v, %v", output, err)
+	}
+}
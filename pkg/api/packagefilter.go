@@ -0,0 +1,80 @@
+package api
+
+import "strings"
+
+// PackageFilter leaves findings out of the counts by the name of the vulnerable package, patterns may contain * wildcards
+type PackageFilter struct {
+	// Repositories the filter applies to, every repository when empty
+	Repository string
+	// Only findings of matching packages are counted, every package when empty
+	Include []string
+	// Findings of matching packages aren't counted
+	Exclude []string
+}
+
+// ParsePackageFilter returns the filter of comma separated include and exclude patterns, nil when both are empty
+func ParsePackageFilter(include string, exclude string) []PackageFilter {
+	f := PackageFilter{Include: patternList(include), Exclude: patternList(exclude)}
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return nil
+	}
+	return []PackageFilter{f}
+}
+
+// patternList splits a comma separated list of patterns
+func patternList(raw string) []string {
+	var patterns []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// packageFilters returns the filters applying to the repository
+func (s *ECRService) packageFilters(name string) []PackageFilter {
+	var filters []PackageFilter
+	for _, f := range s.options.PackageFilters {
+		if f.Repository == "" || WildcardMatch(f.Repository, name) {
+			filters = append(filters, f)
+		}
+	}
+	return filters
+}
+
+// keepPackages reports whether a finding of the packages is counted: when any of them passes every filter.
+// Findings without package names are always counted.
+func keepPackages(filters []PackageFilter, packages []string) bool {
+	if len(packages) == 0 {
+		return true
+	}
+	for _, p := range packages {
+		if passes(filters, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// passes reports whether the package is included and not excluded by every filter
+func passes(filters []PackageFilter, name string) bool {
+	for _, f := range filters {
+		if len(f.Include) > 0 && !matchesAny(f.Include, name) {
+			return false
+		}
+		if matchesAny(f.Exclude, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if WildcardMatch(p, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestKeepPackages(t *testing.T) {
+	filters := []PackageFilter{
+		{Exclude: []string{"kernel-*"}},
+		{Repository: "team/*", Include: []string{"openssl*", "log4j*"}},
+	}
+	cases := []struct {
+		packages []string
+		expected bool
+	}{
+		{packages: nil, expected: true},
+		{packages: []string{"openssl-libs"}, expected: true},
+		{packages: []string{"kernel-headers"}, expected: false},
+		{packages: []string{"bash"}, expected: false},
+		{packages: []string{"bash", "log4j-core"}, expected: true},
+	}
+
+	for i, c := range cases {
+		if got := keepPackages(filters, c.packages); got != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %t, got: %t", i, c.expected, got)
+		}
+	}
+}
+
+func TestParsePackageFilter(t *testing.T) {
+	if filters := ParsePackageFilter("", " "); filters != nil {
+		t.Fatalf("Expected no filter, got: %+v", filters)
+	}
+	filters := ParsePackageFilter("openssl*, log4j*", "kernel-headers")
+	expected := []PackageFilter{{Include: []string{"openssl*", "log4j*"}, Exclude: []string{"kernel-headers"}}}
+	if !reflect.DeepEqual(filters, expected) {
+		t.Fatalf("values not equal, wanting: %+v, got: %+v", expected, filters)
+	}
+}
+
+// mockPackageFindings returns the same findings for every repository, with the names of their packages
+type mockPackageFindings struct {
+	mockECRService
+}
+
+func (m mockPackageFindings) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	finding := func(name string, level string, pkg string) *ecr.ImageScanFinding {
+		return &ecr.ImageScanFinding{
+			Name:       aws.String(name),
+			Severity:   aws.String(level),
+			Attributes: []*ecr.Attribute{{Key: aws.String("package_name"), Value: aws.String(pkg)}},
+		}
+	}
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageScanFindings: &ecr.ImageScanFindings{
+			FindingSeverityCounts: map[string]*int64{"CRITICAL": aws.Int64(2), "HIGH": aws.Int64(1), "MEDIUM": aws.Int64(1)},
+			Findings: []*ecr.ImageScanFinding{
+				finding("CVE-2021-44228", "CRITICAL", "log4j-core"),
+				finding("CVE-2022-0001", "CRITICAL", "kernel-headers"),
+				finding("CVE-2022-0778", "HIGH", "openssl-libs"),
+				finding("CVE-2022-1271", "MEDIUM", "bash"),
+			},
+		},
+		RepositoryName: input.RepositoryName,
+		ImageId:        &ecr.ImageIdentifier{ImageDigest: aws.String("xxxyyyzzzddd")},
+	}, nil
+}
+
+func TestGatherPackageFilters(t *testing.T) {
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{PackageFilters: []PackageFilter{
+		{Exclude: []string{"kernel-*"}},
+		{Repository: "team/api", Include: []string{"openssl*", "log4j*"}},
+	}}, service.logger, mockPackageFindings{})
+
+	report := s.GatherVulnerabilities(context.Background(), gen([]*ecr.Repository{
+		{RepositoryName: aws.String("team/api")},
+		{RepositoryName: aws.String("team/web")},
+	}), "MEDIUM", false, 1)
+
+	sort.Slice(report.Filtered, func(i, j int) bool { return report.Filtered[i].Name < report.Filtered[j].Name })
+	if len(report.Filtered) != 2 {
+		t.Fatalf("Unexpected vulnerable repositories: %+v", report.Filtered)
+	}
+	expected := map[string]map[string]int64{
+		"team/api": {"CRITICAL": 1, "HIGH": 1},
+		"team/web": {"CRITICAL": 1, "HIGH": 1, "MEDIUM": 1},
+	}
+	for _, r := range report.Filtered {
+		if len(r.Severity.Count) != len(expected[r.Name]) {
+			t.Fatalf("Unexpected findings of %s: %v", r.Name, r.Severity.Count)
+		}
+		for level, count := range expected[r.Name] {
+			if aws.Int64Value(r.Severity.Count[level]) != count {
+				t.Fatalf("Unexpected %s findings of %s, wanting: %d, got: %d", level, r.Name, count, aws.Int64Value(r.Severity.Count[level]))
+			}
+		}
+	}
+}
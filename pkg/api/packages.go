@@ -0,0 +1,53 @@
+package api
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// packageManagerOS is the package manager Inspector reports for operating system packages
+const packageManagerOS = "OS"
+
+// countByPackageType counts the findings of the image per severity, separately for operating system packages
+// and language packages (pip, npm, maven...). Only enhanced scanning findings tell the package manager.
+func (s *ECRService) countByPackageType(info *RepositoryInfo, digest string) {
+	if s.scanType != ecr.ScanTypeEnhanced {
+		return
+	}
+
+	osCount := make(map[string]*int64)
+	languageCount := make(map[string]*int64)
+	err := s.enhancedFindings(info.Name, digest, func(finding *ecr.EnhancedImageScanFinding) {
+		count := languageCount
+		if osPackage(finding) {
+			count = osCount
+		}
+
+		level := aws.StringValue(finding.Severity)
+		if count[level] == nil {
+			count[level] = aws.Int64(0)
+		}
+		*count[level]++
+	})
+	if err != nil {
+		s.logger.Errorf("Error listing findings of repository %s: %s", info.Name, err.Error())
+		return
+	}
+
+	info.OSPackages = severity.Matrix{Count: osCount}
+	info.LanguagePackages = severity.Matrix{Count: languageCount}
+}
+
+// osPackage reports whether the finding is about an operating system package
+func osPackage(finding *ecr.EnhancedImageScanFinding) bool {
+	if finding.PackageVulnerabilityDetails == nil {
+		return false
+	}
+	for _, p := range finding.PackageVulnerabilityDetails.VulnerablePackages {
+		if aws.StringValue(p.PackageManager) == packageManagerOS {
+			return true
+		}
+	}
+	return false
+}
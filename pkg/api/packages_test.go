@@ -0,0 +1,66 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// packageTypeECRService serves findings in OS and language packages
+type packageTypeECRService struct {
+	mockECRService
+}
+
+func (m packageTypeECRService) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	finding := func(level string, packageManager string) *ecr.EnhancedImageScanFinding {
+		return &ecr.EnhancedImageScanFinding{
+			Severity: aws.String(level),
+			PackageVulnerabilityDetails: &ecr.PackageVulnerabilityDetails{
+				VulnerablePackages: []*ecr.VulnerablePackage{{PackageManager: aws.String(packageManager)}},
+			},
+		}
+	}
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageScanFindings: &ecr.ImageScanFindings{EnhancedFindings: []*ecr.EnhancedImageScanFinding{
+			finding("CRITICAL", "OS"),
+			finding("HIGH", "OS"),
+			finding("HIGH", "OS"),
+			finding("HIGH", "PYTHONPKG"),
+			finding("MEDIUM", "NODEPKG"),
+		}},
+	}, nil
+}
+
+func TestCountByPackageType(t *testing.T) {
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{}, service.logger, packageTypeECRService{})
+
+	info := &RepositoryInfo{Name: "TestRepo/Test1"}
+	s.scanType = ecr.ScanTypeBasic
+	s.countByPackageType(info, "sha256:image")
+	if info.OSPackages.Count != nil || info.LanguagePackages.Count != nil {
+		t.Fatalf("Expected no package type counts with basic scanning")
+	}
+
+	s.scanType = ecr.ScanTypeEnhanced
+	s.countByPackageType(info, "sha256:image")
+
+	expected := []struct {
+		count map[string]*int64
+		level string
+		value int64
+	}{
+		{count: info.OSPackages.Count, level: "CRITICAL", value: 1},
+		{count: info.OSPackages.Count, level: "HIGH", value: 2},
+		{count: info.LanguagePackages.Count, level: "HIGH", value: 1},
+		{count: info.LanguagePackages.Count, level: "MEDIUM", value: 1},
+	}
+	for i, e := range expected {
+		if e.count[e.level] == nil || *e.count[e.level] != e.value {
+			t.Fatalf("[%d] Expected %d %s findings, got: %v", i, e.value, e.level, e.count[e.level])
+		}
+	}
+	if len(info.OSPackages.Count) != 2 || len(info.LanguagePackages.Count) != 2 {
+		t.Fatalf("Unexpected severity levels: %v, %v", info.OSPackages.Count, info.LanguagePackages.Count)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// ParameterStore loads configuration from SSM Parameter Store parameters under a path prefix
+type ParameterStore struct {
+	client  ssmiface.SSMAPI
+	path    string
+	ttl     time.Duration
+	values  map[string]string
+	fetched time.Time
+	mu      sync.Mutex
+}
+
+// NewParameterStore .
+func NewParameterStore(path string, ttl time.Duration, client ssmiface.SSMAPI) *ParameterStore {
+	return &ParameterStore{
+		client: client,
+		path:   "/" + strings.Trim(path, "/"),
+		ttl:    ttl,
+	}
+}
+
+// Load returns configuration values keyed by environment variable name, e.g.:
+// /ecr-scan/prod/slack/channel becomes SLACK_CHANNEL. Values are cached for the store's ttl
+func (p *ParameterStore) Load() (map[string]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.values != nil && time.Since(p.fetched) < p.ttl {
+		return p.values, nil
+	}
+
+	values := map[string]string{}
+	err := p.client.GetParametersByPathPages(&ssm.GetParametersByPathInput{
+		Path:           aws.String(p.path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	}, func(page *ssm.GetParametersByPathOutput, lastPage bool) bool {
+		for _, parameter := range page.Parameters {
+			values[p.key(*parameter.Name)] = *parameter.Value
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.values = values
+	p.fetched = time.Now()
+	return values, nil
+}
+
+// key turns a parameter name into an environment variable name
+func (p *ParameterStore) key(name string) string {
+	name = strings.Trim(strings.TrimPrefix(name, p.path), "/")
+	return strings.ToUpper(strings.NewReplacer("/", "_", "-", "_", ".", "_").Replace(name))
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+type mockSSMService struct {
+	ssmiface.SSMAPI
+	calls *int
+}
+
+func (m mockSSMService) GetParametersByPathPages(input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool) error {
+	*m.calls++
+	fn(&ssm.GetParametersByPathOutput{
+		Parameters: []*ssm.Parameter{
+			{Name: aws.String(*input.Path + "/MINIMUM_SEVERITY"), Value: aws.String("HIGH")},
+		},
+	}, false)
+	fn(&ssm.GetParametersByPathOutput{
+		Parameters: []*ssm.Parameter{
+			{Name: aws.String(*input.Path + "/slack/channel"), Value: aws.String("#ecr-scan")},
+			{Name: aws.String(*input.Path + "/repository-tag-filter"), Value: aws.String("scan=true")},
+		},
+	}, true)
+	return nil
+}
+
+func TestParameterStoreLoad(t *testing.T) {
+	calls := 0
+	store := NewParameterStore("ecr-scan/prod/", time.Minute, mockSSMService{calls: &calls})
+
+	expected := map[string]string{
+		"MINIMUM_SEVERITY":      "HIGH",
+		"SLACK_CHANNEL":         "#ecr-scan",
+		"REPOSITORY_TAG_FILTER": "scan=true",
+	}
+
+	for i := 0; i < 2; i++ {
+		values, err := store.Load()
+		if err != nil {
+			t.Fatalf("[%d] Error loading parameters: %s", i, err)
+		}
+		if !reflect.DeepEqual(values, expected) {
+			t.Fatalf("[%d] values not equal, wanting: %v, got: %v", i, expected, values)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("Expected parameters to be cached, fetched %d times", calls)
+	}
+
+	store.fetched = time.Now().Add(-2 * time.Minute)
+	if _, err := store.Load(); err != nil {
+		t.Fatalf("Error reloading parameters: %s", err)
+	}
+	if calls != 2 {
+		t.Fatalf("Expected expired parameters to be fetched again, fetched %d times", calls)
+	}
+}
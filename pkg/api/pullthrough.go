@@ -0,0 +1,48 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// LoadPullThroughCacheRules fetches the repository prefixes of the registry's pull through cache rules
+func (s *ECRService) LoadPullThroughCacheRules() error {
+	s.pullThroughPrefixes = nil
+
+	input := &ecr.DescribePullThroughCacheRulesInput{}
+	if len(s.registryID) != 0 {
+		input.RegistryId = aws.String(s.registryID)
+	}
+
+	return s.client.DescribePullThroughCacheRulesPages(input, func(page *ecr.DescribePullThroughCacheRulesOutput, lastPage bool) bool {
+		for _, rule := range page.PullThroughCacheRules {
+			s.pullThroughPrefixes = append(s.pullThroughPrefixes, aws.StringValue(rule.EcrRepositoryPrefix))
+		}
+		return true
+	})
+}
+
+// IsPullThroughCache reports whether the repository was created by a pull through cache rule
+func (s *ECRService) IsPullThroughCache(repositoryName string) bool {
+	for _, prefix := range s.pullThroughPrefixes {
+		if strings.HasPrefix(repositoryName, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SeparatePullThroughCache moves vulnerable pull through cache repositories into their own section of the report
+func (s *ECRService) SeparatePullThroughCache(report *Report) {
+	var filtered []*RepositoryInfo
+	for _, r := range report.Filtered {
+		if s.IsPullThroughCache(r.Name) {
+			report.PullThroughCache = append(report.PullThroughCache, r)
+		} else {
+			filtered = append(filtered, r)
+		}
+	}
+	report.Filtered = filtered
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+)
+
+func (m mockECRService) DescribePullThroughCacheRulesPages(input *ecr.DescribePullThroughCacheRulesInput, fn func(*ecr.DescribePullThroughCacheRulesOutput, bool) bool) error {
+	fn(&ecr.DescribePullThroughCacheRulesOutput{
+		PullThroughCacheRules: []*ecr.PullThroughCacheRule{
+			{
+				EcrRepositoryPrefix: aws.String("docker-hub"),
+				UpstreamRegistryUrl: aws.String("registry-1.docker.io"),
+			},
+		},
+	}, true)
+	return nil
+}
+
+func newPullThroughService(t *testing.T) *ECRService {
+	logger, err := logger.NewLogger("DEBUG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{}, logger, mockECRService{})
+	if err := s.LoadPullThroughCacheRules(); err != nil {
+		t.Fatalf("Error loading pull through cache rules: %s", err)
+	}
+	return s
+}
+
+func TestIsPullThroughCache(t *testing.T) {
+	s := newPullThroughService(t)
+
+	cases := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "docker-hub/library/nginx", expected: true},
+		{name: "docker-hubby/service", expected: false},
+		{name: "TestRepo/Test1", expected: false},
+	}
+
+	for i, c := range cases {
+		if ptc := s.IsPullThroughCache(c.name); ptc != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %v, got: %v", i, c.expected, ptc)
+		}
+	}
+}
+
+func TestSeparatePullThroughCache(t *testing.T) {
+	s := newPullThroughService(t)
+
+	report := &Report{
+		Filtered: []*RepositoryInfo{
+			{Name: "docker-hub/library/nginx"},
+			{Name: "TestRepo/Test1"},
+		},
+	}
+	s.SeparatePullThroughCache(report)
+
+	if !reflect.DeepEqual(report.Filtered, []*RepositoryInfo{{Name: "TestRepo/Test1"}}) {
+		t.Fatalf("Filtered values not equal, got: %v", report.Filtered)
+	}
+	if !reflect.DeepEqual(report.PullThroughCache, []*RepositoryInfo{{Name: "docker-hub/library/nginx"}}) {
+		t.Fatalf("PullThroughCache values not equal, got: %v", report.PullThroughCache)
+	}
+}
+
+func TestFilterRepositories(t *testing.T) {
+	s := newPullThroughService(t)
+
+	repositories := []*ecr.Repository{
+		{RepositoryName: aws.String("docker-hub/library/nginx")},
+		{RepositoryName: aws.String("TestRepo/Test1")},
+	}
+
+	var names []string
+	filtered := s.FilterRepositories(context.Background(), gen(repositories), func(r *ecr.Repository) bool {
+		return !s.IsPullThroughCache(*r.RepositoryName)
+	})
+	for r := range filtered {
+		names = append(names, *r.RepositoryName)
+	}
+
+	if !reflect.DeepEqual(names, []string{"TestRepo/Test1"}) {
+		t.Fatalf("values not equal, got: %v", names)
+	}
+}
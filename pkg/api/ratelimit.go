@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RateLimiter is a token bucket shared by every request of a client, so parallel workers together stay below
+// the rate, leaving the rest of the account's API quota to others, e.g.: CI pipelines pulling images
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewRateLimiter allows rate requests per second, the bucket holds a second's worth of requests but at least one
+func NewRateLimiter(rate float64) *RateLimiter {
+	burst := float64(int(rate))
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now(), now: time.Now}
+}
+
+// ParseRateLimit parses requests per second, zero turns rate limiting off
+func ParseRateLimit(rate string) (float64, error) {
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r < 0 {
+		return 0, fmt.Errorf("Invalid rate limit %s, expected zero or a positive number of requests per second", rate)
+	}
+	return r, nil
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait delays the request until the limiter lets it through, retries included. Requests whose context is done
+// go ahead, the SDK fails them as canceled.
+func (l *RateLimiter) wait(r *request.Request) {
+	wait := l.reserve()
+	if wait == 0 {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
+
+// LimitRequests sends every request of the client through the limiter
+func LimitRequests(c *client.Client, l *RateLimiter) {
+	c.Handlers.Send.PushFrontNamed(request.NamedHandler{Name: "ecrscan.RateLimiter", Fn: l.wait})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(2)
+	l.last = now
+	l.now = func() time.Time { return now }
+
+	// The bucket starts full with a second's worth of requests
+	for i, expected := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if wait := l.reserve(); wait != expected {
+			t.Fatalf("[%d] Expected to wait %s, got: %s", i, expected, wait)
+		}
+	}
+
+	// Tokens refill at the rate, the waiting requests took them
+	now = now.Add(2 * time.Second)
+	if wait := l.reserve(); wait != 0 {
+		t.Fatalf("Expected no wait after the bucket refilled, got: %s", wait)
+	}
+
+	// Below one request per second the bucket still holds one
+	slow := NewRateLimiter(0.5)
+	slow.now = func() time.Time { return slow.last }
+	if first, second := slow.reserve(), slow.reserve(); first != 0 || second != 2*time.Second {
+		t.Fatalf("Expected waits of 0s and 2s, got: %s %s", first, second)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	if r, err := ParseRateLimit("2.5"); err != nil || r != 2.5 {
+		t.Fatalf("Expected 2.5, got: %v %v", r, err)
+	}
+	for _, rate := range []string{"-1", "fast", ""} {
+		if _, err := ParseRateLimit(rate); err == nil {
+			t.Fatalf("Expected an error for %q", rate)
+		}
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("us-east-1"), Credentials: credentials.NewStaticCredentials("id", "secret", "")}))
+	client := ecr.New(sess)
+	LimitRequests(client.Client, NewRateLimiter(1))
+
+	request, _ := client.DescribeRepositoriesRequest(&ecr.DescribeRepositoriesInput{})
+	if request.Handlers.Send.Len() < 2 {
+		t.Fatalf("Expected the limiter in front of the send handlers")
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Registry is a private registry scanned besides others, reached with the credentials of RoleARN when set
+type Registry struct {
+	// ID of the registry, the AWS account ID it belongs to
+	ID      string
+	RoleARN string
+}
+
+// ParseAccountAliases parses a comma separated list of registry ID and alias pairs, e.g.: 111111111111=prod,222222222222=staging
+func ParseAccountAliases(raw string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("Invalid account alias %s, expected <registry ID>=<alias>", entry)
+		}
+		id := strings.TrimSpace(parts[0])
+		if !registryIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("Invalid registry ID %s, expected a 12 digit account ID", id)
+		}
+		aliases[id] = strings.TrimSpace(parts[1])
+	}
+	return aliases, nil
+}
+
+var (
+	registryIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+	roleARNPattern    = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:role/.+$`)
+)
+
+// ParseRegistries parses a comma separated list of registry IDs, each optionally followed by =<role ARN>
+// to assume for it, e.g.: 111111111111,222222222222=arn:aws:iam::222222222222:role/ecr-scan
+func ParseRegistries(raw string) ([]Registry, error) {
+	var registries []Registry
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		r := Registry{ID: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			r.RoleARN = strings.TrimSpace(parts[1])
+		}
+		if !registryIDPattern.MatchString(r.ID) {
+			return nil, fmt.Errorf("Invalid registry ID %s, expected a 12 digit account ID", r.ID)
+		}
+		if len(parts) == 2 && !roleARNPattern.MatchString(r.RoleARN) {
+			return nil, fmt.Errorf("Invalid role ARN %s of registry %s", r.RoleARN, r.ID)
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("Registry %s is listed more than once", r.ID)
+		}
+		seen[r.ID] = true
+		registries = append(registries, r)
+	}
+	return registries, nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRegistries(t *testing.T) {
+	registries, err := ParseRegistries("111111111111, 222222222222=arn:aws:iam::222222222222:role/ecr-scan,")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []Registry{{ID: "111111111111"}, {ID: "222222222222", RoleARN: "arn:aws:iam::222222222222:role/ecr-scan"}}
+	if !reflect.DeepEqual(registries, expected) {
+		t.Fatalf("values not equal, wanting: %v, got: %v", expected, registries)
+	}
+
+	for _, raw := range []string{
+		"12345",
+		"111111111111=ecr-scan",
+		"111111111111,111111111111",
+	} {
+		if _, err := ParseRegistries(raw); err == nil {
+			t.Fatalf("Expected an error for %s", raw)
+		}
+	}
+}
+
+func TestParseAccountAliases(t *testing.T) {
+	aliases, err := ParseAccountAliases("111111111111=prod, 222222222222 = staging,")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]string{"111111111111": "prod", "222222222222": "staging"}
+	if !reflect.DeepEqual(aliases, expected) {
+		t.Fatalf("values not equal, wanting: %v, got: %v", expected, aliases)
+	}
+
+	for _, raw := range []string{"prod", "111111111111=", "12345=prod"} {
+		if _, err := ParseAccountAliases(raw); err == nil {
+			t.Fatalf("Expected an error for %s", raw)
+		}
+	}
+}
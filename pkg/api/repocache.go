@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// RepositoryCache keeps the repository listings of registries for a while, so frequent invocations don't list
+// the whole registry every time. Listings are kept in memory, which lasts as long as the Lambda container, and in
+// a DynamoDB table when set, shared by every container. The table needs a CacheKey string partition key,
+// enable TTL on ExpiresAt to clean up expired listings. A listing has to fit a 400KB item to be stored in the table.
+type RepositoryCache struct {
+	client  dynamodbiface.DynamoDBAPI
+	table   string
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]cachedListing
+}
+
+type cachedListing struct {
+	repositories []*ecr.Repository
+	expiresAt    time.Time
+}
+
+// NewRepositoryCache creates a cache keeping listings for ttl, in memory only when table is empty
+func NewRepositoryCache(ttl time.Duration, table string, client dynamodbiface.DynamoDBAPI) *RepositoryCache {
+	return &RepositoryCache{
+		client:  client,
+		table:   table,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedListing),
+	}
+}
+
+// Get returns the repositories listed under key, unless the listing expired
+func (c *RepositoryCache) Get(key string) ([]*ecr.Repository, bool, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.repositories, true, nil
+	}
+	if c.table == "" {
+		return nil, false, nil
+	}
+
+	output, err := c.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(c.table),
+		Key:            map[string]*dynamodb.AttributeValue{"CacheKey": {S: aws.String(key)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if output.Item == nil || output.Item["Repositories"] == nil || output.Item["ExpiresAt"] == nil {
+		return nil, false, nil
+	}
+	expires, err := strconv.ParseInt(aws.StringValue(output.Item["ExpiresAt"].N), 10, 64)
+	if err != nil {
+		return nil, false, err
+	}
+	// TTL deletes expired items eventually, not right away
+	entry = cachedListing{expiresAt: time.Unix(expires, 0)}
+	if !now.Before(entry.expiresAt) {
+		return nil, false, nil
+	}
+	if err := json.Unmarshal([]byte(aws.StringValue(output.Item["Repositories"].S)), &entry.repositories); err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+	return entry.repositories, true, nil
+}
+
+// Put keeps the repositories listed under key until the TTL passes
+func (c *RepositoryCache) Put(key string, repositories []*ecr.Repository) error {
+	entry := cachedListing{repositories: repositories, expiresAt: c.now().Add(c.ttl)}
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+	if c.table == "" {
+		return nil
+	}
+
+	encoded, err := json.Marshal(repositories)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(c.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"CacheKey":     {S: aws.String(key)},
+			"Repositories": {S: aws.String(string(encoded))},
+			"ExpiresAt":    {N: aws.String(strconv.FormatInt(entry.expiresAt.Unix(), 10))},
+		},
+	})
+	return err
+}
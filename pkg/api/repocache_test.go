@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// mockCacheTable stores items by CacheKey
+type mockCacheTable struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (m *mockCacheTable) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.items[aws.StringValue(input.Key["CacheKey"].S)]}, nil
+}
+
+func (m *mockCacheTable) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	m.items[aws.StringValue(input.Item["CacheKey"].S)] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// mockListedRepositories counts how many times the registry is listed
+type mockListedRepositories struct {
+	mockECRService
+	listed *int
+}
+
+func (m mockListedRepositories) DescribeRepositoriesPages(input *ecr.DescribeRepositoriesInput, fn func(*ecr.DescribeRepositoriesOutput, bool) bool) error {
+	*m.listed++
+	fn(&ecr.DescribeRepositoriesOutput{Repositories: []*ecr.Repository{{RepositoryName: aws.String("TestRepo/Test1")}}}, false)
+	fn(&ecr.DescribeRepositoriesOutput{Repositories: []*ecr.Repository{{RepositoryName: aws.String("TestRepo/Test2")}}}, true)
+	return nil
+}
+
+func TestRepositoryCache(t *testing.T) {
+	now := time.Date(2020, 7, 19, 8, 0, 0, 0, time.UTC)
+	table := &mockCacheTable{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	cache := NewRepositoryCache(time.Hour, "ecr-scan-cache", table)
+	cache.now = func() time.Time { return now }
+
+	listed := 0
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{RepositoryCache: cache}, service.logger, mockListedRepositories{listed: &listed})
+	list := func() []string {
+		repositories, errc := s.DescribeRepositoriesPages(context.Background())
+		var names []string
+		for r := range repositories {
+			names = append(names, *r.RepositoryName)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return names
+	}
+
+	for i := 0; i < 2; i++ {
+		if names := list(); len(names) != 2 {
+			t.Fatalf("[%d] Expected both repositories, got: %v", i, names)
+		}
+	}
+	if listed != 1 {
+		t.Fatalf("Expected the registry to be listed once, got: %d", listed)
+	}
+
+	// Another container only has the table
+	other := NewRepositoryCache(time.Hour, "ecr-scan-cache", table)
+	other.now = cache.now
+	if cached, ok, err := other.Get("xxxxx/us-east-1"); err != nil || !ok || len(cached) != 2 || *cached[1].RepositoryName != "TestRepo/Test2" {
+		t.Fatalf("Expected the listing to be read from the table, got: %v %v %v", cached, ok, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	list()
+	if listed != 2 {
+		t.Fatalf("Expected the registry to be listed again once the listing expired, got: %d", listed)
+	}
+}
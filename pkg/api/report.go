@@ -0,0 +1,9 @@
+package api
+
+import "github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+
+// Report is kept as an alias of report.Report for existing callers
+type Report = report.Report
+
+// RepositoryInfo is kept as an alias of report.RepositoryInfo for existing callers
+type RepositoryInfo = report.RepositoryInfo
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// ResponseStore keeps response bodies too large to return under an S3 prefix, handing out presigned URLs of them
+type ResponseStore struct {
+	s3 *S3Service
+	// How long the URLs are valid
+	ttl time.Duration
+}
+
+// NewResponseStore creates a store at an s3://bucket/prefix URI, handing out URLs valid for ttl
+func NewResponseStore(uri string, ttl time.Duration, client s3iface.S3API) (*ResponseStore, error) {
+	s3, err := NewS3Service(uri, client)
+	if err != nil {
+		return nil, err
+	}
+	return &ResponseStore{s3: s3, ttl: ttl}, nil
+}
+
+// Offload stores the body as the response of the run, replacing an earlier one of the same run,
+// and returns a presigned URL of it along with its expiry
+func (r *ResponseStore) Offload(runID string, body []byte, contentType string) (string, time.Time, error) {
+	key := runID + ".txt"
+	if strings.HasPrefix(contentType, "application/json") {
+		key = runID + ".json"
+	}
+	if err := r.s3.Put(key, body, contentType, ""); err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(r.ttl)
+	url, err := r.s3.Presign(key, r.ttl)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return url, expires, nil
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// GetObjectRequest builds the request with a real client, presigning doesn't send it
+func (m *mockS3Service) GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	return s3.New(sess).GetObjectRequest(input)
+}
+
+func TestResponseStore(t *testing.T) {
+	client := &mockS3Service{objects: map[string][]byte{}}
+	store, err := NewResponseStore("s3://bucket/responses", time.Hour, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	url, expires, err := store.Offload("run-1", []byte(`{"run_id":"run-1"}`), "application/json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(client.objects["bucket/responses/run-1.json"]) != `{"run_id":"run-1"}` {
+		t.Fatalf("Expected the body to be stored by run, got: %v", client.objects)
+	}
+	if !strings.Contains(url, "/responses/run-1.json?") || !strings.Contains(url, "X-Amz-Expires=3600") {
+		t.Fatalf("Expected a presigned URL of the body, got: %s", url)
+	}
+	if time.Until(expires) > time.Hour || time.Until(expires) < 59*time.Minute {
+		t.Fatalf("Unexpected expiry: %s", expires)
+	}
+
+	if _, _, err := store.Offload("run-2", []byte("text"), "text/plain"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := client.objects["bucket/responses/run-2.txt"]; !ok {
+		t.Fatalf("Expected bodies other than json to be stored as text, got: %v", client.objects)
+	}
+}
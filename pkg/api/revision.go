@@ -0,0 +1,27 @@
+package api
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// Annotations recording the source the image was built from, e.g.: set by docker/metadata-action
+const (
+	annotationRevision = "org.opencontainers.image.revision"
+	annotationSource   = "org.opencontainers.image.source"
+)
+
+// resolveRevision notes the commit and source repository the image was built from, as recorded in the manifest annotations
+func (s *ECRService) resolveRevision(info *RepositoryInfo) {
+	if info.Digest == "" {
+		return
+	}
+
+	manifest, err := s.getManifest(s.registryID, info.Name, &ecr.ImageIdentifier{ImageDigest: aws.String(info.Digest)})
+	if err != nil {
+		s.logger.Errorf("Error getting manifest of repository %s: %s", info.Name, err.Error())
+		return
+	}
+	info.Revision = manifest.Annotations[annotationRevision]
+	info.Source = manifest.Annotations[annotationSource]
+}
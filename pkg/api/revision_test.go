@@ -0,0 +1,39 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// revisionECRService serves an image annotated with the commit it was built from
+type revisionECRService struct {
+	mockECRService
+}
+
+func (m revisionECRService) BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error) {
+	manifest := `{"schemaVersion": 2, "annotations": {
+		"org.opencontainers.image.revision": "0123456789abcdef0123456789abcdef01234567",
+		"org.opencontainers.image.source": "https://github.com/example/app"}}`
+	return &ecr.BatchGetImageOutput{
+		Images: []*ecr.Image{{ImageManifest: aws.String(manifest), ImageManifestMediaType: aws.String(mediaTypeOCIImageManifest)}},
+	}, nil
+}
+
+func TestResolveRevision(t *testing.T) {
+	s := NewECRService("123456789012", "us-east-1", "latest", Options{}, service.logger, revisionECRService{})
+
+	info := &RepositoryInfo{Name: "TestRepo/Test1", Digest: "sha256:image"}
+	s.resolveRevision(info)
+	if info.Revision != "0123456789abcdef0123456789abcdef01234567" || info.Source != "https://github.com/example/app" {
+		t.Fatalf("Unexpected revision %s of %s", info.Revision, info.Source)
+	}
+
+	// Images without a digest aren't looked up
+	info = &RepositoryInfo{Name: "TestRepo/Test1"}
+	s.resolveRevision(info)
+	if info.Revision != "" {
+		t.Fatalf("Expected no revision, got: %s", info.Revision)
+	}
+}
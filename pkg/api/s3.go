@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// ParseS3URI splits an s3://bucket/prefix URI, the prefix is empty or ends with a slash
+func ParseS3URI(uri string) (bucket string, prefix string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("Invalid S3 URI %s, expected s3://bucket/prefix", uri)
+	}
+
+	prefix = strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return u.Host, prefix, nil
+}
+
+// S3Service writes objects under an S3 prefix
+type S3Service struct {
+	client s3iface.S3API
+	bucket string
+	prefix string
+}
+
+// NewS3Service creates a service writing under an s3://bucket/prefix URI
+func NewS3Service(uri string, client s3iface.S3API) (*S3Service, error) {
+	bucket, prefix, err := ParseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Service{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// Put stores body under the prefix at key, replacing the previous object
+func (s *S3Service) Put(key string, body []byte, contentType string, cacheControl string) error {
+	input := s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.prefix + key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	}
+	if cacheControl != "" {
+		input.CacheControl = aws.String(cacheControl)
+	}
+	_, err := s.client.PutObject(&input)
+	return err
+}
+
+// Get returns the object stored under the prefix at key, nil when there is none
+func (s *S3Service) Get(key string) ([]byte, error) {
+	output, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return ioutil.ReadAll(output.Body)
+}
+
+// List returns the keys under the prefix, relative to it
+func (s *S3Service) List() ([]string, error) {
+	var keys []string
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}, func(output *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range output.Contents {
+			keys = append(keys, strings.TrimPrefix(aws.StringValue(o.Key), s.prefix))
+		}
+		return true
+	})
+	return keys, err
+}
+
+// Presign returns a URL the object stored under the prefix at key can be downloaded from without credentials,
+// valid for the given duration or until the credentials signing it expire, whichever comes first
+func (s *S3Service) Presign(key string, expires time.Duration) (string, error) {
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	return req.Presign(expires)
+}
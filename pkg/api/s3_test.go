@@ -0,0 +1,84 @@
+package api
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func (m *mockS3Service) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, *input.Bucket+"/"+*input.Prefix) {
+			keys = append(keys, strings.TrimPrefix(key, *input.Bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	fn(output, true)
+	return nil
+}
+
+func TestParseS3URI(t *testing.T) {
+	cases := []struct {
+		uri    string
+		bucket string
+		prefix string
+		err    bool
+	}{
+		{uri: "s3://bucket/badges/", bucket: "bucket", prefix: "badges/"},
+		{uri: "s3://bucket/badges", bucket: "bucket", prefix: "badges/"},
+		{uri: "s3://bucket", bucket: "bucket", prefix: ""},
+		{uri: "bucket/badges", err: true},
+		{uri: "https://bucket/badges", err: true},
+	}
+
+	for i, c := range cases {
+		bucket, prefix, err := ParseS3URI(c.uri)
+		if (err != nil) != c.err || bucket != c.bucket || prefix != c.prefix {
+			t.Fatalf("[%d] Unexpected result for %s: %s, %s, %v", i, c.uri, bucket, prefix, err)
+		}
+	}
+}
+
+func TestS3Service(t *testing.T) {
+	client := &mockS3Service{objects: map[string][]byte{"bucket/other/file": []byte("x")}}
+	service, err := NewS3Service("s3://bucket/badges", client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, key := range []string{"team-a/api.svg", "team-b/api.svg"} {
+		if err := service.Put(key, []byte("<svg/>"), "image/svg+xml", "no-cache"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if body := string(client.objects["bucket/badges/team-a/api.svg"]); body != "<svg/>" {
+		t.Fatalf("values are not equal, wanting: <svg/>, got: %s", body)
+	}
+
+	body, err := service.Get("team-a/api.svg")
+	if err != nil || string(body) != "<svg/>" {
+		t.Fatalf("Unexpected object %s: %v", body, err)
+	}
+	if body, err := service.Get("missing.svg"); err != nil || body != nil {
+		t.Fatalf("Expected no object, got: %s, %v", body, err)
+	}
+
+	keys, err := service.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"team-a/api.svg", "team-b/api.svg"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, keys)
+	}
+}
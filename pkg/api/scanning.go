@@ -0,0 +1,50 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// LoadRegistryScanningConfiguration fetches the registry level scanning configuration.
+// Scan type falls back to BASIC without any rules when it can't be retrieved.
+func (s *ECRService) LoadRegistryScanningConfiguration() string {
+	s.scanType = ecr.ScanTypeBasic
+	s.scanningRules = nil
+
+	output, err := s.client.GetRegistryScanningConfiguration(&ecr.GetRegistryScanningConfigurationInput{})
+	if err != nil {
+		s.logger.Errorf("Error getting registry scanning configuration, assuming %s scanning: %s", s.scanType, err.Error())
+		return s.scanType
+	}
+
+	if output.ScanningConfiguration != nil {
+		s.scanType = aws.StringValue(output.ScanningConfiguration.ScanType)
+		s.scanningRules = output.ScanningConfiguration.Rules
+	}
+	s.logger.Infof("Registry uses %s scanning with %d scanning rules", s.scanType, len(s.scanningRules))
+	return s.scanType
+}
+
+// coveredByRules reports whether any registry scanning rule applies to the repository
+func (s *ECRService) coveredByRules(repo *ecr.Repository) bool {
+	for _, rule := range s.scanningRules {
+		for _, filter := range rule.RepositoryFilters {
+			if WildcardMatch(aws.StringValue(filter.Filter), *repo.RepositoryName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WildcardMatch matches name against an ECR repository filter where * matches any sequence of characters
+func WildcardMatch(pattern string, name string) bool {
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(name)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+)
+
+func (m mockECRService) GetRegistryScanningConfiguration(input *ecr.GetRegistryScanningConfigurationInput) (*ecr.GetRegistryScanningConfigurationOutput, error) {
+	return &ecr.GetRegistryScanningConfigurationOutput{
+		ScanningConfiguration: &ecr.RegistryScanningConfiguration{
+			ScanType: aws.String(ecr.ScanTypeEnhanced),
+			Rules: []*ecr.RegistryScanningRule{
+				{
+					ScanFrequency: aws.String(ecr.ScanFrequencyContinuousScan),
+					RepositoryFilters: []*ecr.ScanningRepositoryFilter{
+						{
+							Filter:     aws.String("TestRepo/Test*"),
+							FilterType: aws.String(ecr.ScanningRepositoryFilterTypeWildcard),
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func TestWildcardMatch(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{pattern: "*", name: "TestRepo/Test1", expected: true},
+		{pattern: "TestRepo/*", name: "TestRepo/Test1", expected: true},
+		{pattern: "TestRepo/*", name: "Other/Test1", expected: false},
+		{pattern: "*/Test1", name: "TestRepo/Test1", expected: true},
+		{pattern: "TestRepo.Test1", name: "TestRepo/Test1", expected: false},
+		{pattern: "TestRepo/Test1", name: "TestRepo/Test1", expected: true},
+	}
+
+	for i, c := range cases {
+		if match := WildcardMatch(c.pattern, c.name); match != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %v, got: %v", i, c.expected, match)
+		}
+	}
+}
+
+func TestGatherNotCovered(t *testing.T) {
+	logger, err := logger.NewLogger("DEBUG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{}, logger, mockECRService{})
+
+	if scanType := s.LoadRegistryScanningConfiguration(); scanType != ecr.ScanTypeEnhanced {
+		t.Fatalf("Scan type values not equal, wanting: %s, got: %s", ecr.ScanTypeEnhanced, scanType)
+	}
+
+	repositories := []*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("Other/Test1")},
+	}
+	report := s.GatherVulnerabilities(context.Background(), gen(repositories), "MEDIUM", false, 2)
+
+	if report.ScanType != ecr.ScanTypeEnhanced {
+		t.Fatalf("Report scan type values not equal, wanting: %s, got: %s", ecr.ScanTypeEnhanced, report.ScanType)
+	}
+	if len(report.NotCovered) != 1 || report.NotCovered[0].Name != "Other/Test1" {
+		t.Fatalf("NotCovered expected to contain only Other/Test1, got: %v", report.NotCovered)
+	}
+	if len(report.ScanOnPushDisabled) != 0 {
+		t.Fatalf("ScanOnPushDisabled expected to be empty when scanning rules apply, got: %v", report.ScanOnPushDisabled)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// SecretsService fetches secrets from Secrets Manager and caches them for the lifetime of the execution environment
+type SecretsService struct {
+	client secretsmanageriface.SecretsManagerAPI
+	cache  map[string]string
+	mu     sync.Mutex
+}
+
+// NewSecretsService .
+func NewSecretsService(client secretsmanageriface.SecretsManagerAPI) *SecretsService {
+	return &SecretsService{
+		client: client,
+		cache:  map[string]string{},
+	}
+}
+
+// GetSecret returns the cached value of the secret, fetching it on first use
+func (s *SecretsService) GetSecret(arn string) (string, error) {
+	s.mu.Lock()
+	value, ok := s.cache[arn]
+	s.mu.Unlock()
+
+	if ok {
+		return value, nil
+	}
+	return s.RefreshSecret(arn)
+}
+
+// RefreshSecret fetches the current value of the secret, replacing the cached one
+func (s *SecretsService) RefreshSecret(arn string) (string, error) {
+	output, err := s.client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(arn),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if output.SecretString == nil {
+		return "", fmt.Errorf("Secret %s has no string value", arn)
+	}
+
+	s.mu.Lock()
+	s.cache[arn] = *output.SecretString
+	s.mu.Unlock()
+
+	return *output.SecretString, nil
+}
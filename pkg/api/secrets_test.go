@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+type mockSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	calls *int
+}
+
+func (m mockSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	*m.calls++
+	switch *input.SecretId {
+	case "arn:secret:binary":
+		return &secretsmanager.GetSecretValueOutput{SecretBinary: []byte("token")}, nil
+	case "arn:secret:missing":
+		return nil, fmt.Errorf("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String(fmt.Sprintf("xoxb-%d", *m.calls)),
+	}, nil
+}
+
+func TestGetSecret(t *testing.T) {
+	calls := 0
+	svc := NewSecretsService(mockSecretsManager{calls: &calls})
+
+	for i := 0; i < 2; i++ {
+		value, err := svc.GetSecret("arn:secret:slack")
+		if err != nil {
+			t.Fatalf("[%d] Error getting secret: %s", i, err)
+		}
+		if value != "xoxb-1" {
+			t.Fatalf("[%d] values not equal, wanting: xoxb-1, got: %s", i, value)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("Expected secret to be fetched once, fetched %d times", calls)
+	}
+
+	value, err := svc.RefreshSecret("arn:secret:slack")
+	if err != nil {
+		t.Fatalf("Error refreshing secret: %s", err)
+	}
+	if value != "xoxb-2" {
+		t.Fatalf("values not equal, wanting: xoxb-2, got: %s", value)
+	}
+
+	value, _ = svc.GetSecret("arn:secret:slack")
+	if value != "xoxb-2" {
+		t.Fatalf("Expected refreshed secret to be cached, got: %s", value)
+	}
+}
+
+func TestGetSecretError(t *testing.T) {
+	calls := 0
+	svc := NewSecretsService(mockSecretsManager{calls: &calls})
+
+	if _, err := svc.GetSecret("arn:secret:missing"); err == nil {
+		t.Fatalf("Expected error for missing secret")
+	}
+	if _, err := svc.GetSecret("arn:secret:binary"); err == nil {
+		t.Fatalf("Expected error for binary secret")
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// SessionConfig describes how AWS clients reach their endpoints
+type SessionConfig struct {
+	Region string
+	// Use FIPS 140-2 validated endpoints
+	FIPS bool
+	// Use endpoints reachable over both IPv4 and IPv6
+	DualStack bool
+	// Endpoint URL of every service, e.g.: LocalStack, service specific endpoints take precedence
+	Endpoint string
+	// Custom endpoint URLs, e.g.: VPC interface endpoints or LocalStack
+	ECREndpoint string
+	STSEndpoint string
+	S3Endpoint  string
+	// Load the shared config files (~/.aws/config), e.g.: for profiles and SSO when run locally
+	SharedConfig bool
+	Profile      string
+	// Tunes the shared HTTP client of the session, the SDK's default client is used when empty
+	HTTP HTTPConfig
+}
+
+// Sessions built by CachedSession, kept for the life of the process
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[SessionConfig]*session.Session{}
+)
+
+// CachedSession returns the session a previous call built for the same configuration, or creates one.
+// Lambda keeps the process between warm invocations, and sessions refresh their credentials before they expire,
+// e.g.: assumed role credentials, so a session can be reused by every invocation.
+func CachedSession(c SessionConfig) (*session.Session, error) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	if sess, ok := sessions[c]; ok {
+		return sess, nil
+	}
+	sess, err := NewSession(c)
+	if err != nil {
+		return nil, err
+	}
+	sessions[c] = sess
+	return sess, nil
+}
+
+// NewSession creates an AWS session honoring the endpoint configuration
+func NewSession(c SessionConfig) (*session.Session, error) {
+	config := &aws.Config{}
+	if c.Region != "" {
+		config.Region = aws.String(c.Region)
+	}
+
+	if c.FIPS {
+		config.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+	if c.DualStack {
+		config.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+
+	overrides := map[string]string{}
+	if c.ECREndpoint != "" {
+		overrides[ecr.EndpointsID] = c.ECREndpoint
+	}
+	if c.STSEndpoint != "" {
+		overrides[sts.EndpointsID] = c.STSEndpoint
+	}
+	if c.S3Endpoint != "" {
+		overrides[s3.EndpointsID] = c.S3Endpoint
+		// Custom S3 endpoints rarely support virtual hosted-style buckets
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	if c.Endpoint != "" {
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	if len(overrides) > 0 || c.Endpoint != "" {
+		config.EndpointResolver = endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+			if url, ok := overrides[service]; ok {
+				return endpoints.ResolvedEndpoint{URL: url, SigningRegion: region}, nil
+			}
+			if c.Endpoint != "" {
+				return endpoints.ResolvedEndpoint{URL: c.Endpoint, SigningRegion: region}, nil
+			}
+			return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+		})
+	}
+
+	if c.HTTP != (HTTPConfig{}) {
+		client, err := SharedHTTPClient(c.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		config.HTTPClient = client
+	}
+
+	if c.SharedConfig {
+		return session.NewSessionWithOptions(session.Options{
+			Config:            *config,
+			Profile:           c.Profile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+	}
+	return session.NewSession(config)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestNewSession(t *testing.T) {
+	cases := []struct {
+		config   SessionConfig
+		expected string
+	}{
+		{config: SessionConfig{Region: "us-east-1"}, expected: "https://api.ecr.us-east-1.amazonaws.com"},
+		{config: SessionConfig{Region: "us-east-1", FIPS: true}, expected: "https://ecr-fips.us-east-1.amazonaws.com"},
+		{config: SessionConfig{Region: "us-east-1", DualStack: true}, expected: "https://api.ecr.us-east-1.api.aws"},
+	}
+
+	for i, c := range cases {
+		sess, err := NewSession(c.config)
+		if err != nil {
+			t.Fatalf("[%d] Error creating session: %s", i, err)
+		}
+
+		endpoint := sess.ClientConfig(ecr.EndpointsID).Endpoint
+		if endpoint != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %s, got: %s", i, c.expected, endpoint)
+		}
+	}
+}
+
+func TestNewSessionEndpointOverrides(t *testing.T) {
+	sess, err := NewSession(SessionConfig{
+		Region:      "us-east-1",
+		ECREndpoint: "https://vpce-1234.api.ecr.us-east-1.vpce.amazonaws.com",
+		STSEndpoint: "http://localhost:4566",
+		S3Endpoint:  "http://localhost:4566",
+	})
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+
+	expected := map[string]string{
+		ecr.EndpointsID: "https://vpce-1234.api.ecr.us-east-1.vpce.amazonaws.com",
+		sts.EndpointsID: "http://localhost:4566",
+		s3.EndpointsID:  "http://localhost:4566",
+		sns.EndpointsID: "https://sns.us-east-1.amazonaws.com",
+	}
+
+	for service, url := range expected {
+		endpoint := sess.ClientConfig(service).Endpoint
+		if endpoint != url {
+			t.Fatalf("[%s] values not equal, wanting: %s, got: %s", service, url, endpoint)
+		}
+	}
+
+	if !*sess.Config.S3ForcePathStyle {
+		t.Fatalf("Expected path style addressing with custom S3 endpoint")
+	}
+}
+
+func TestNewSessionEndpoint(t *testing.T) {
+	sess, err := NewSession(SessionConfig{
+		Region:      "us-east-1",
+		Endpoint:    "http://localhost:4566",
+		ECREndpoint: "http://localhost:4567",
+	})
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+
+	expected := map[string]string{
+		ecr.EndpointsID: "http://localhost:4567",
+		sts.EndpointsID: "http://localhost:4566",
+		sns.EndpointsID: "http://localhost:4566",
+	}
+
+	for service, url := range expected {
+		endpoint := sess.ClientConfig(service).Endpoint
+		if endpoint != url {
+			t.Fatalf("[%s] values not equal, wanting: %s, got: %s", service, url, endpoint)
+		}
+	}
+}
+
+func TestNewSessionSharedConfig(t *testing.T) {
+	os.Setenv("AWS_CONFIG_FILE", "testdata/config")
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+
+	sess, err := NewSession(SessionConfig{SharedConfig: true, Profile: "staging"})
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+	if region := *sess.Config.Region; region != "eu-west-1" {
+		t.Fatalf("values not equal, wanting: eu-west-1, got: %s", region)
+	}
+}
+
+func TestCachedSession(t *testing.T) {
+	first, err := CachedSession(SessionConfig{Region: "eu-west-1"})
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+	second, err := CachedSession(SessionConfig{Region: "eu-west-1"})
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+	if first != second {
+		t.Fatalf("Expected the session to be reused")
+	}
+
+	other, err := CachedSession(SessionConfig{Region: "eu-west-1", FIPS: true})
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+	if other == first {
+		t.Fatalf("Expected a new session for a different configuration")
+	}
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// SnoozeStore keeps snoozes in a DynamoDB table. The table needs a SnoozeKey string partition key,
+// enable TTL on ExpiresAt to clean up expired snoozes.
+type SnoozeStore struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+	now    func() time.Time
+}
+
+// NewSnoozeStore .
+func NewSnoozeStore(table string, client dynamodbiface.DynamoDBAPI) *SnoozeStore {
+	return &SnoozeStore{
+		client: client,
+		table:  table,
+		now:    time.Now,
+	}
+}
+
+func snoozeKey(repository string, vulnerability string) string {
+	if vulnerability == "" {
+		return repository
+	}
+	return repository + "#" + vulnerability
+}
+
+// Put stores the snooze, replacing an earlier snooze of the same repository and vulnerability
+func (s *SnoozeStore) Put(snooze report.Snooze) error {
+	item := map[string]*dynamodb.AttributeValue{
+		"SnoozeKey":  {S: aws.String(snoozeKey(snooze.Repository, snooze.Vulnerability))},
+		"Repository": {S: aws.String(snooze.Repository)},
+		"ExpiresAt":  {N: aws.String(strconv.FormatInt(snooze.Until.Unix(), 10))},
+	}
+	for name, value := range map[string]string{"Vulnerability": snooze.Vulnerability, "Reason": snooze.Reason, "SnoozedBy": snooze.By} {
+		if value != "" {
+			item[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+		}
+	}
+
+	_, err := s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	})
+	return err
+}
+
+// Delete ends the snooze of the repository, or of the vulnerability when set
+func (s *SnoozeStore) Delete(repository string, vulnerability string) error {
+	_, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"SnoozeKey": {S: aws.String(snoozeKey(repository, vulnerability))},
+		},
+	})
+	return err
+}
+
+// List returns the snoozes which haven't expired yet. TTL deletes expired items lazily, so they are skipped here.
+func (s *SnoozeStore) List() ([]report.Snooze, error) {
+	now := s.now()
+	var snoozes []report.Snooze
+	err := s.client.ScanPages(&dynamodb.ScanInput{TableName: aws.String(s.table)}, func(output *dynamodb.ScanOutput, last bool) bool {
+		for _, item := range output.Items {
+			expiresAt, err := strconv.ParseInt(attributeString(item["ExpiresAt"], true), 10, 64)
+			if err != nil || !now.Before(time.Unix(expiresAt, 0)) {
+				continue
+			}
+			snoozes = append(snoozes, report.Snooze{
+				Repository:    attributeString(item["Repository"], false),
+				Vulnerability: attributeString(item["Vulnerability"], false),
+				Until:         time.Unix(expiresAt, 0).UTC(),
+				Reason:        attributeString(item["Reason"], false),
+				By:            attributeString(item["SnoozedBy"], false),
+			})
+		}
+		return true
+	})
+	return snoozes, err
+}
+
+func attributeString(value *dynamodb.AttributeValue, number bool) string {
+	if value == nil {
+		return ""
+	}
+	if number {
+		return aws.StringValue(value.N)
+	}
+	return aws.StringValue(value.S)
+}
+
+// ExpiringSnoozes returns reminders of the snoozes which expire within the window, soonest first
+func ExpiringSnoozes(snoozes []report.Snooze, now time.Time, window time.Duration) []*RepositoryInfo {
+	var expiring []*RepositoryInfo
+	for i := range snoozes {
+		if until := snoozes[i].Until; now.Before(until) && until.Sub(now) <= window {
+			expiring = append(expiring, &RepositoryInfo{Name: snoozes[i].Repository, Snooze: &snoozes[i]})
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].Snooze.Until.Before(expiring[j].Snooze.Until)
+	})
+	return expiring
+}
+
+// repositorySnooze returns the active snooze of the whole repository, if any
+func (s *ECRService) repositorySnooze(name string, now time.Time) *report.Snooze {
+	for i, snooze := range s.options.Snoozes {
+		if snooze.Vulnerability == "" && now.Before(snooze.Until) && WildcardMatch(snooze.Repository, name) {
+			return &s.options.Snoozes[i]
+		}
+	}
+	return nil
+}
+
+// snoozedVulnerabilities returns the IDs of the repository's actively snoozed vulnerabilities
+func (s *ECRService) snoozedVulnerabilities(name string, now time.Time) map[string]bool {
+	ids := make(map[string]bool)
+	for _, snooze := range s.options.Snoozes {
+		if snooze.Vulnerability != "" && now.Before(snooze.Until) && WildcardMatch(snooze.Repository, name) {
+			ids[snooze.Vulnerability] = true
+		}
+	}
+	return ids
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// mockSnoozeTable keeps the items of the snooze table in memory
+type mockSnoozeTable struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (m *mockSnoozeTable) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	m.items[aws.StringValue(input.Item["SnoozeKey"].S)] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockSnoozeTable) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	delete(m.items, aws.StringValue(input.Key["SnoozeKey"].S))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (m *mockSnoozeTable) ScanPages(input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	output := &dynamodb.ScanOutput{}
+	for _, item := range m.items {
+		output.Items = append(output.Items, item)
+	}
+	fn(output, true)
+	return nil
+}
+
+func TestSnoozeStore(t *testing.T) {
+	now := time.Date(2020, 7, 19, 8, 0, 0, 0, time.UTC)
+	store := NewSnoozeStore("ecr-scan-snoozes", &mockSnoozeTable{items: map[string]map[string]*dynamodb.AttributeValue{}})
+	store.now = func() time.Time { return now }
+
+	for _, s := range []report.Snooze{
+		{Repository: "team/api", Until: now.Add(time.Hour), Reason: "fix in review", By: "jane"},
+		{Repository: "team/api", Vulnerability: "CVE-2021-44228", Until: now.Add(2 * time.Hour)},
+		// Expired, but not deleted by TTL yet
+		{Repository: "team/worker", Until: now.Add(-time.Hour)},
+	} {
+		if err := store.Put(s); err != nil {
+			t.Fatalf("Error storing snooze: %s", err)
+		}
+	}
+	if err := store.Delete("team/api", ""); err != nil {
+		t.Fatalf("Error deleting snooze: %s", err)
+	}
+
+	snoozes, err := store.List()
+	if err != nil {
+		t.Fatalf("Error listing snoozes: %s", err)
+	}
+	expected := report.Snooze{Repository: "team/api", Vulnerability: "CVE-2021-44228", Until: now.Add(2 * time.Hour)}
+	if len(snoozes) != 1 || snoozes[0] != expected {
+		t.Fatalf("Unexpected snoozes: %+v", snoozes)
+	}
+}
+
+func TestExpiringSnoozes(t *testing.T) {
+	now := time.Date(2020, 7, 19, 8, 0, 0, 0, time.UTC)
+	expiring := ExpiringSnoozes([]report.Snooze{
+		{Repository: "team/web", Until: now.Add(48 * time.Hour)},
+		{Repository: "team/api", Until: now.Add(24 * time.Hour)},
+		{Repository: "team/worker", Until: now.Add(30 * 24 * time.Hour)},
+		{Repository: "team/batch", Until: now.Add(-time.Hour)},
+	}, now, 72*time.Hour)
+
+	if len(expiring) != 2 || expiring[0].Name != "team/api" || expiring[1].Name != "team/web" || expiring[1].Snooze.Until != now.Add(48*time.Hour) {
+		t.Fatalf("Unexpected expiring snoozes: %+v", expiring)
+	}
+}
+
+// mockSnoozedFindings lists the findings behind the severity counts of TestRepo/Test1 and TestRepo/Test2
+type mockSnoozedFindings struct {
+	mockECRService
+}
+
+func (m mockSnoozedFindings) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	output, err := m.mockECRService.DescribeImageScanFindings(input)
+	if err != nil || input.ImageId.ImageDigest == nil {
+		return output, err
+	}
+	output.ImageScanFindings.Findings = []*ecr.ImageScanFinding{
+		{Name: aws.String("CVE-2021-44228"), Severity: aws.String("CRITICAL")},
+		{Name: aws.String("CVE-2020-0001"), Severity: aws.String("HIGH")},
+	}
+	return output, nil
+}
+
+func TestGatherSnoozed(t *testing.T) {
+	until := time.Now().Add(time.Hour)
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{Snoozes: []report.Snooze{
+		{Repository: "TestRepo/Test2", Until: until},
+		{Repository: "TestRepo/*", Vulnerability: "CVE-2021-44228", Until: until},
+		{Repository: "TestRepo/Test1", Vulnerability: "CVE-2020-0001", Until: until.Add(-2 * time.Hour)},
+	}}, service.logger, mockSnoozedFindings{})
+
+	report := s.GatherVulnerabilities(context.Background(), gen([]*ecr.Repository{
+		{RepositoryName: aws.String("TestRepo/Test1")},
+		{RepositoryName: aws.String("TestRepo/Test2")},
+	}), "MEDIUM", false, 1)
+
+	// 11 of the 12 critical findings of Test1 remain, Test2 is snoozed as a whole
+	if len(report.Filtered) != 1 || *report.Filtered[0].Severity.Count["CRITICAL"] != 11 {
+		t.Fatalf("Unexpected vulnerable repositories: %+v", report.Filtered)
+	}
+	if len(report.Snoozed) != 1 || report.Snoozed[0].Name != "TestRepo/Test2" || report.Snoozed[0].Snooze.Until != until {
+		t.Fatalf("Unexpected snoozed repositories: %+v", report.Snoozed)
+	}
+}
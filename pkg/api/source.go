@@ -0,0 +1,317 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/inspector2"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Findings sources, where the findings of images are read from
+const (
+	// ECR image scanning, basic or enhanced
+	FindingsSourceECR = "ecr"
+	// Amazon Inspector, e.g.: the delegated administrator account's findings of every member account
+	FindingsSourceInspector2 = "inspector2"
+	// Trivy JSON reports stored in S3 by CI
+	FindingsSourceTrivyS3 = "trivy-s3"
+)
+
+// FindingsSource retrieves the scan findings of images in the shape ECR returns them, so findings of every source
+// go through the same thresholds, filters and exporters. Satisfied by ECRClient. Sources other than ECR return every
+// finding on a single page, regardless of MaxResults, and a ScanNotFoundException for images they have no results of.
+type FindingsSource interface {
+	DescribeImageScanFindings(*ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error)
+}
+
+// findingsSource returns the source findings are read from, the ECR client unless another one is configured
+func (s *ECRService) findingsSource() FindingsSource {
+	if merged, ok := s.options.FindingsSource.(*MergedSource); ok {
+		return merged.bind(s.client)
+	}
+	if s.options.FindingsSource != nil {
+		return s.options.FindingsSource
+	}
+	return s.client
+}
+
+// scanNotFound is the error of sources without results for the image, which reports it as not scanned
+func scanNotFound(input *ecr.DescribeImageScanFindingsInput) error {
+	return awserr.New(ecr.ErrCodeScanNotFoundException, fmt.Sprintf("No scan results of %s:%s", aws.StringValue(input.RepositoryName), imageIDText(input.ImageId)), nil)
+}
+
+// imageIDText returns the digest of the image when known, its tag otherwise
+func imageIDText(id *ecr.ImageIdentifier) string {
+	if id == nil {
+		return ""
+	}
+	if digest := aws.StringValue(id.ImageDigest); digest != "" {
+		return digest
+	}
+	return aws.StringValue(id.ImageTag)
+}
+
+// Inspector2Client is the part of the Inspector API used by Inspector2Source, satisfied by *inspector2.Inspector2
+type Inspector2Client interface {
+	ListFindingsPages(*inspector2.ListFindingsInput, func(*inspector2.ListFindingsOutput, bool) bool) error
+}
+
+var _ Inspector2Client = (*inspector2.Inspector2)(nil)
+
+// Inspector2Source reads the active findings of images from Amazon Inspector, as enhanced scanning findings.
+// Inspector doesn't tell images without findings from images it hasn't scanned, both are reported clean.
+type Inspector2Source struct {
+	client Inspector2Client
+}
+
+// NewInspector2Source creates a source reading findings with the Inspector client
+func NewInspector2Source(client Inspector2Client) *Inspector2Source {
+	return &Inspector2Source{client: client}
+}
+
+// inspectorEquals filters on a single value
+func inspectorEquals(value string) []*inspector2.StringFilter {
+	return []*inspector2.StringFilter{{
+		Comparison: aws.String(inspector2.StringComparisonEquals),
+		Value:      aws.String(value),
+	}}
+}
+
+// DescribeImageScanFindings lists the active findings of the image. Images looked up by tag are matched by the
+// images carrying it, the most recently pushed one wins when findings of an image the tag moved away from remain.
+func (s *Inspector2Source) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	criteria := &inspector2.FilterCriteria{
+		FindingStatus:          inspectorEquals(inspector2.FindingStatusActive),
+		ResourceType:           inspectorEquals(inspector2.ResourceTypeAwsEcrContainerImage),
+		EcrImageRepositoryName: inspectorEquals(aws.StringValue(input.RepositoryName)),
+	}
+	if registryID := aws.StringValue(input.RegistryId); registryID != "" {
+		criteria.EcrImageRegistry = inspectorEquals(registryID)
+	}
+	if digest := aws.StringValue(input.ImageId.ImageDigest); digest != "" {
+		criteria.EcrImageHash = inspectorEquals(digest)
+	} else {
+		criteria.EcrImageTags = inspectorEquals(aws.StringValue(input.ImageId.ImageTag))
+	}
+
+	var digest string
+	var pushedAt time.Time
+	images := make(map[string][]*inspector2.Finding)
+	err := s.client.ListFindingsPages(&inspector2.ListFindingsInput{FilterCriteria: criteria}, func(page *inspector2.ListFindingsOutput, last bool) bool {
+		for _, finding := range page.Findings {
+			image := inspectorImage(finding)
+			if image == nil {
+				continue
+			}
+			hash := aws.StringValue(image.ImageHash)
+			images[hash] = append(images[hash], finding)
+			if digest == "" || aws.TimeValue(image.PushedAt).After(pushedAt) {
+				digest, pushedAt = hash, aws.TimeValue(image.PushedAt)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ecr.DescribeImageScanFindingsOutput{
+		ImageId:         &ecr.ImageIdentifier{ImageDigest: input.ImageId.ImageDigest, ImageTag: input.ImageId.ImageTag},
+		RegistryId:      input.RegistryId,
+		RepositoryName:  input.RepositoryName,
+		ImageScanStatus: &ecr.ImageScanStatus{Status: aws.String(ecr.ScanStatusActive)},
+		ImageScanFindings: &ecr.ImageScanFindings{
+			FindingSeverityCounts: make(map[string]*int64),
+		},
+	}
+	if digest != "" {
+		output.ImageId.ImageDigest = aws.String(digest)
+	}
+	var observedAt time.Time
+	for _, finding := range images[digest] {
+		countFinding(output.ImageScanFindings, aws.StringValue(finding.Severity))
+		output.ImageScanFindings.EnhancedFindings = append(output.ImageScanFindings.EnhancedFindings, enhancedFinding(finding))
+		if aws.TimeValue(finding.LastObservedAt).After(observedAt) {
+			observedAt = aws.TimeValue(finding.LastObservedAt)
+		}
+	}
+	if !observedAt.IsZero() {
+		output.ImageScanFindings.ImageScanCompletedAt = aws.Time(observedAt)
+	}
+	return output, nil
+}
+
+// inspectorImage returns the image the finding is about, nil for findings of other resources
+func inspectorImage(finding *inspector2.Finding) *inspector2.AwsEcrContainerImageDetails {
+	for _, resource := range finding.Resources {
+		if resource.Details != nil && resource.Details.AwsEcrContainerImage != nil {
+			return resource.Details.AwsEcrContainerImage
+		}
+	}
+	return nil
+}
+
+// enhancedFinding converts an Inspector finding to an enhanced scanning finding, keeping what reports use
+func enhancedFinding(finding *inspector2.Finding) *ecr.EnhancedImageScanFinding {
+	converted := &ecr.EnhancedImageScanFinding{
+		AwsAccountId:    finding.AwsAccountId,
+		Description:     finding.Description,
+		FindingArn:      finding.FindingArn,
+		FirstObservedAt: finding.FirstObservedAt,
+		LastObservedAt:  finding.LastObservedAt,
+		Score:           finding.InspectorScore,
+		Severity:        finding.Severity,
+		Status:          finding.Status,
+		Title:           finding.Title,
+		Type:            finding.Type,
+		UpdatedAt:       finding.UpdatedAt,
+	}
+	if details := finding.PackageVulnerabilityDetails; details != nil {
+		converted.PackageVulnerabilityDetails = &ecr.PackageVulnerabilityDetails{
+			ReferenceUrls:   details.ReferenceUrls,
+			Source:          details.Source,
+			SourceUrl:       details.SourceUrl,
+			VendorSeverity:  details.VendorSeverity,
+			VulnerabilityId: details.VulnerabilityId,
+		}
+		for _, p := range details.VulnerablePackages {
+			converted.PackageVulnerabilityDetails.VulnerablePackages = append(converted.PackageVulnerabilityDetails.VulnerablePackages, &ecr.VulnerablePackage{
+				Arch:            p.Arch,
+				Epoch:           p.Epoch,
+				FilePath:        p.FilePath,
+				Name:            p.Name,
+				PackageManager:  p.PackageManager,
+				Release:         p.Release,
+				SourceLayerHash: p.SourceLayerHash,
+				Version:         p.Version,
+			})
+		}
+	}
+	return converted
+}
+
+// TrivyS3Source reads Trivy JSON reports (trivy image --format json) stored under an S3 prefix at
+// <repository>/<tag>.json, or at <repository>/<digest>.json for images looked up by digest. Findings are
+// returned as basic scanning findings, UNKNOWN severities as UNDEFINED.
+type TrivyS3Source struct {
+	s3 *S3Service
+
+	mu sync.Mutex
+	// Keys of the reports read by tag, by repository@digest, so findings of the image are looked up again by digest
+	keys map[string]string
+}
+
+// NewTrivyS3Source creates a source reading reports under an s3://bucket/prefix URI
+func NewTrivyS3Source(uri string, client s3iface.S3API) (*TrivyS3Source, error) {
+	s3, err := NewS3Service(uri, client)
+	if err != nil {
+		return nil, err
+	}
+	return &TrivyS3Source{s3: s3, keys: make(map[string]string)}, nil
+}
+
+// trivyReport is the part of a Trivy JSON report read
+type trivyReport struct {
+	// Only written by recent Trivy versions
+	CreatedAt time.Time `json:"CreatedAt"`
+	Metadata  struct {
+		// e.g.: 123456789012.dkr.ecr.eu-west-1.amazonaws.com/team-a/api@sha256:...
+		RepoDigests []string `json:"RepoDigests"`
+	} `json:"Metadata"`
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			Severity         string `json:"Severity"`
+			Description      string `json:"Description"`
+			PrimaryURL       string `json:"PrimaryURL"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// DescribeImageScanFindings reads the report of the image
+func (s *TrivyS3Source) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	repositoryName := aws.StringValue(input.RepositoryName)
+	digest := aws.StringValue(input.ImageId.ImageDigest)
+	key := repositoryName + "/" + aws.StringValue(input.ImageId.ImageTag) + ".json"
+	if digest != "" {
+		s.mu.Lock()
+		known, ok := s.keys[repositoryName+"@"+digest]
+		s.mu.Unlock()
+		key = repositoryName + "/" + digest + ".json"
+		if ok {
+			key = known
+		}
+	}
+
+	body, err := s.s3.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, scanNotFound(input)
+	}
+	var report trivyReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, fmt.Errorf("Invalid Trivy report %s: %s", key, err)
+	}
+
+	if digest == "" {
+		digest = trivyDigest(report.Metadata.RepoDigests)
+	}
+	if digest != "" && key != repositoryName+"/"+digest+".json" {
+		s.mu.Lock()
+		s.keys[repositoryName+"@"+digest] = key
+		s.mu.Unlock()
+	}
+
+	findings := &ecr.ImageScanFindings{FindingSeverityCounts: make(map[string]*int64)}
+	if !report.CreatedAt.IsZero() {
+		findings.ImageScanCompletedAt = aws.Time(report.CreatedAt)
+	}
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			level := v.Severity
+			if level == "UNKNOWN" {
+				level = ecr.FindingSeverityUndefined
+			}
+			countFinding(findings, level)
+			findings.Findings = append(findings.Findings, &ecr.ImageScanFinding{
+				Name:        aws.String(v.VulnerabilityID),
+				Severity:    aws.String(level),
+				Description: aws.String(v.Description),
+				Uri:         aws.String(v.PrimaryURL),
+				Attributes: []*ecr.Attribute{
+					{Key: aws.String("package_name"), Value: aws.String(v.PkgName)},
+					{Key: aws.String("package_version"), Value: aws.String(v.InstalledVersion)},
+				},
+			})
+		}
+	}
+
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageId:           &ecr.ImageIdentifier{ImageDigest: aws.String(digest), ImageTag: input.ImageId.ImageTag},
+		RegistryId:        input.RegistryId,
+		RepositoryName:    input.RepositoryName,
+		ImageScanStatus:   &ecr.ImageScanStatus{Status: aws.String(ecr.ScanStatusComplete)},
+		ImageScanFindings: findings,
+	}, nil
+}
+
+// trivyDigest returns the digest of the first repository digest of the report, empty when there is none
+func trivyDigest(repoDigests []string) string {
+	for _, d := range repoDigests {
+		if i := strings.LastIndex(d, "@"); i >= 0 {
+			return d[i+1:]
+		}
+	}
+	return ""
+}
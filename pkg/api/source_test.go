@@ -0,0 +1,148 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/inspector2"
+)
+
+// mockInspector2 holds findings of two images tagged latest, the newer one pushed after the tag moved
+type mockInspector2 struct {
+	input *inspector2.ListFindingsInput
+}
+
+func (m *mockInspector2) ListFindingsPages(input *inspector2.ListFindingsInput, fn func(*inspector2.ListFindingsOutput, bool) bool) error {
+	m.input = input
+	finding := func(digest string, pushedAt time.Time, id string, level string) *inspector2.Finding {
+		return &inspector2.Finding{
+			Severity:       aws.String(level),
+			LastObservedAt: aws.Time(pushedAt.Add(time.Hour)),
+			PackageVulnerabilityDetails: &inspector2.PackageVulnerabilityDetails{
+				VulnerabilityId:    aws.String(id),
+				VulnerablePackages: []*inspector2.VulnerablePackage{{Name: aws.String("openssl"), Version: aws.String("1.1.1")}},
+			},
+			Resources: []*inspector2.Resource{{Details: &inspector2.ResourceDetails{
+				AwsEcrContainerImage: &inspector2.AwsEcrContainerImageDetails{ImageHash: aws.String(digest), PushedAt: aws.Time(pushedAt)},
+			}}},
+		}
+	}
+	old, pushed := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 7, 8, 0, 0, 0, 0, time.UTC)
+	fn(&inspector2.ListFindingsOutput{Findings: []*inspector2.Finding{
+		finding("sha256:old", old, "CVE-2020-0001", "CRITICAL"),
+		finding("sha256:new", pushed, "CVE-2020-0002", "HIGH"),
+	}}, false)
+	fn(&inspector2.ListFindingsOutput{Findings: []*inspector2.Finding{
+		finding("sha256:new", pushed, "CVE-2020-0003", "HIGH"),
+	}}, true)
+	return nil
+}
+
+func TestInspector2Source(t *testing.T) {
+	client := &mockInspector2{}
+	source := NewInspector2Source(client)
+	output, err := source.DescribeImageScanFindings(&ecr.DescribeImageScanFindingsInput{
+		RepositoryName: aws.String("team-a/api"),
+		RegistryId:     aws.String("123456789012"),
+		ImageId:        &ecr.ImageIdentifier{ImageTag: aws.String("latest")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	criteria := client.input.FilterCriteria
+	if *criteria.EcrImageTags[0].Value != "latest" || *criteria.EcrImageRegistry[0].Value != "123456789012" || criteria.EcrImageHash != nil {
+		t.Fatalf("Unexpected filter criteria: %s", criteria)
+	}
+	if *output.ImageId.ImageDigest != "sha256:new" || *output.RepositoryName != "team-a/api" {
+		t.Fatalf("Expected the findings of the newest image, got: %s", output.ImageId)
+	}
+	counts := output.ImageScanFindings.FindingSeverityCounts
+	if len(counts) != 1 || *counts["HIGH"] != 2 {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+	findings := output.ImageScanFindings.EnhancedFindings
+	if len(findings) != 2 || *findings[0].PackageVulnerabilityDetails.VulnerablePackages[0].Name != "openssl" {
+		t.Fatalf("Unexpected findings: %v", findings)
+	}
+	if !output.ImageScanFindings.ImageScanCompletedAt.Equal(time.Date(2020, 7, 8, 1, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected scan date: %s", output.ImageScanFindings.ImageScanCompletedAt)
+	}
+
+	// Images without findings are clean
+	output, err = source.DescribeImageScanFindings(&ecr.DescribeImageScanFindingsInput{
+		RepositoryName: aws.String("team-a/api"),
+		ImageId:        &ecr.ImageIdentifier{ImageDigest: aws.String("sha256:other")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *client.input.FilterCriteria.EcrImageHash[0].Value != "sha256:other" {
+		t.Fatalf("Expected images looked up by digest to be filtered by digest")
+	}
+}
+
+const trivyReportJSON = `{
+  "CreatedAt": "2020-07-08T10:00:00Z",
+  "ArtifactName": "123456789012.dkr.ecr.us-east-1.amazonaws.com/team-a/api:latest",
+  "Metadata": {"RepoDigests": ["123456789012.dkr.ecr.us-east-1.amazonaws.com/team-a/api@sha256:abc"]},
+  "Results": [
+    {"Target": "alpine", "Vulnerabilities": [
+      {"VulnerabilityID": "CVE-2020-0001", "PkgName": "openssl", "InstalledVersion": "1.1.1", "Severity": "CRITICAL"},
+      {"VulnerabilityID": "CVE-2020-0002", "PkgName": "musl", "InstalledVersion": "1.2", "Severity": "UNKNOWN"}
+    ]},
+    {"Target": "app/package-lock.json", "Vulnerabilities": [
+      {"VulnerabilityID": "CVE-2020-0003", "PkgName": "lodash", "InstalledVersion": "4.17.15", "Severity": "CRITICAL"}
+    ]}
+  ]
+}`
+
+func TestTrivyS3Source(t *testing.T) {
+	client := &mockS3Service{objects: map[string][]byte{"ci-reports/trivy/team-a/api/latest.json": []byte(trivyReportJSON)}}
+	source, err := NewTrivyS3Source("s3://ci-reports/trivy", client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	output, err := source.DescribeImageScanFindings(&ecr.DescribeImageScanFindingsInput{
+		RepositoryName: aws.String("team-a/api"),
+		ImageId:        &ecr.ImageIdentifier{ImageTag: aws.String("latest")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *output.ImageId.ImageDigest != "sha256:abc" {
+		t.Fatalf("Expected the digest of the report, got: %s", output.ImageId)
+	}
+	counts := output.ImageScanFindings.FindingSeverityCounts
+	if len(counts) != 2 || *counts["CRITICAL"] != 2 || *counts["UNDEFINED"] != 1 {
+		t.Fatalf("Unexpected counts: %v", counts)
+	}
+	if !output.ImageScanFindings.ImageScanCompletedAt.Equal(time.Date(2020, 7, 8, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected scan date: %s", output.ImageScanFindings.ImageScanCompletedAt)
+	}
+
+	// The findings are listed again by the digest of the report, as snooze and package filters do
+	s := NewECRService("", "us-east-1", "latest", Options{FindingsSource: source}, service.logger, mockECRService{})
+	var packages []string
+	err = s.findings("team-a/api", "sha256:abc", func(f scanFinding) {
+		packages = append(packages, f.packages...)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(packages) != 3 || packages[2] != "lodash" {
+		t.Fatalf("Unexpected packages: %v", packages)
+	}
+
+	// Images without a report aren't scanned
+	_, err = source.DescribeImageScanFindings(&ecr.DescribeImageScanFindingsInput{
+		RepositoryName: aws.String("team-b/web"),
+		ImageId:        &ecr.ImageIdentifier{ImageTag: aws.String("latest")},
+	})
+	if !isScanNotFound(err) {
+		t.Fatalf("Expected images without a report not to be scanned, got: %v", err)
+	}
+}
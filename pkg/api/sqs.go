@@ -0,0 +1,65 @@
+package api
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// SQSService sends and receives messages of an SQS queue
+type SQSService struct {
+	client   sqsiface.SQSAPI
+	queueURL string
+}
+
+// QueuedMessage is a message received from the queue
+type QueuedMessage struct {
+	Body          string
+	ReceiptHandle string
+}
+
+// NewSQSService .
+func NewSQSService(queueURL string, client sqsiface.SQSAPI) *SQSService {
+	return &SQSService{
+		client:   client,
+		queueURL: queueURL,
+	}
+}
+
+// Send puts body on the queue
+func (s *SQSService) Send(body []byte) error {
+	_, err := s.client.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(s.queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// Receive returns at most max messages waiting on the queue, without waiting for new ones
+func (s *SQSService) Receive(max int64) ([]QueuedMessage, error) {
+	out, err := s.client.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(s.queueURL),
+		MaxNumberOfMessages: aws.Int64(max),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]QueuedMessage, 0, len(out.Messages))
+	for _, m := range out.Messages {
+		messages = append(messages, QueuedMessage{
+			Body:          aws.StringValue(m.Body),
+			ReceiptHandle: aws.StringValue(m.ReceiptHandle),
+		})
+	}
+	return messages, nil
+}
+
+// Delete removes a received message from the queue
+func (s *SQSService) Delete(receiptHandle string) error {
+	_, err := s.client.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(s.queueURL),
+		ReceiptHandle: aws.String(receiptHandle),
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+type mockSQSService struct {
+	sqsiface.SQSAPI
+	messages map[string]string
+	next     int
+}
+
+func (m *mockSQSService) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	m.next++
+	m.messages[fmt.Sprintf("receipt-%d", m.next)] = *input.MessageBody
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (m *mockSQSService) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	out := &sqs.ReceiveMessageOutput{}
+	for handle, body := range m.messages {
+		if int64(len(out.Messages)) == *input.MaxNumberOfMessages {
+			break
+		}
+		out.Messages = append(out.Messages, &sqs.Message{Body: aws.String(body), ReceiptHandle: aws.String(handle)})
+	}
+	return out, nil
+}
+
+func (m *mockSQSService) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	if _, ok := m.messages[*input.ReceiptHandle]; !ok {
+		return nil, fmt.Errorf("ReceiptHandleIsInvalid")
+	}
+	delete(m.messages, *input.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestSQSService(t *testing.T) {
+	client := &mockSQSService{messages: make(map[string]string)}
+	s := NewSQSService("https://sqs.us-east-1.amazonaws.com/123456789012/slack-fallback", client)
+
+	for _, body := range []string{"first", "second"} {
+		if err := s.Send([]byte(body)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	messages, err := s.Receive(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 queued messages, got: %+v", messages)
+	}
+
+	for _, m := range messages {
+		if err := s.Delete(m.ReceiptHandle); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if messages, _ = s.Receive(10); len(messages) != 0 {
+		t.Fatalf("Expected an empty queue, got: %+v", messages)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// ParseTagFilter parses a comma separated list of key=value pairs into a tag filter.
+// A key without value matches every repository carrying the tag regardless of its value.
+func ParseTagFilter(raw string) (map[string]string, error) {
+	filter := make(map[string]string)
+	if raw == "" {
+		return filter, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if key == "" {
+			return nil, fmt.Errorf("Invalid tag filter %q, expected key=value pairs", raw)
+		}
+
+		filter[key] = ""
+		if len(parts) == 2 {
+			filter[key] = strings.TrimSpace(parts[1])
+		}
+	}
+	return filter, nil
+}
+
+// repositoryGroups keeps the value of the group tag of each repository listed, by repository name
+type repositoryGroups struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (g *repositoryGroups) set(repositoryName string, group string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[repositoryName] = group
+}
+
+// get returns the group of the repository, empty when it doesn't carry the group tag
+func (g *repositoryGroups) get(repositoryName string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[repositoryName]
+}
+
+// matchTags reports whether repository carries every tag of the tag filter, and notes the value of its group tag.
+// Repositories whose tags can't be listed are skipped, unless there is no tag filter, in which case they are left ungrouped.
+func (s *ECRService) matchTags(repo *ecr.Repository) bool {
+	if len(s.options.TagFilter) == 0 && s.options.GroupTag == "" {
+		return true
+	}
+
+	output, err := s.client.ListTagsForResource(&ecr.ListTagsForResourceInput{
+		ResourceArn: repo.RepositoryArn,
+	})
+	if err != nil {
+		if len(s.options.TagFilter) == 0 {
+			s.logger.Errorf("Error listing tags of repository %s, leaving it ungrouped: %s", *repo.RepositoryName, err.Error())
+			return true
+		}
+		s.logger.Errorf("Error listing tags of repository %s, skipping it: %s", *repo.RepositoryName, err.Error())
+		return false
+	}
+
+	tags := make(map[string]string)
+	for _, t := range output.Tags {
+		tags[*t.Key] = *t.Value
+	}
+
+	if s.options.GroupTag != "" {
+		s.groups.set(*repo.RepositoryName, tags[s.options.GroupTag])
+	}
+
+	for key, value := range s.options.TagFilter {
+		v, ok := tags[key]
+		if !ok || (value != "" && value != v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+)
+
+func (m mockECRService) ListTagsForResource(input *ecr.ListTagsForResourceInput) (*ecr.ListTagsForResourceOutput, error) {
+	switch *input.ResourceArn {
+	case "arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test1":
+		return &ecr.ListTagsForResourceOutput{
+			Tags: []*ecr.Tag{
+				{Key: aws.String("scan"), Value: aws.String("true")},
+				{Key: aws.String("team"), Value: aws.String("platform")},
+			},
+		}, nil
+	case "arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test2":
+		return &ecr.ListTagsForResourceOutput{
+			Tags: []*ecr.Tag{
+				{Key: aws.String("scan"), Value: aws.String("false")},
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("Fake error happened")
+	}
+}
+
+func TestParseTagFilter(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected map[string]string
+		err      bool
+	}{
+		{input: "", expected: map[string]string{}},
+		{input: "scan=true", expected: map[string]string{"scan": "true"}},
+		{input: "scan=true, team", expected: map[string]string{"scan": "true", "team": ""}},
+		{input: "=true", err: true},
+	}
+
+	for i, c := range cases {
+		filter, err := ParseTagFilter(c.input)
+		if c.err {
+			if err == nil {
+				t.Fatalf("[%d] Expected error parsing %q", i, c.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("[%d] Error parsing tag filter: %s", i, err)
+		}
+		if !reflect.DeepEqual(filter, c.expected) {
+			t.Fatalf("[%d] values not equal, wanting: %v, got: %v", i, c.expected, filter)
+		}
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	logger, err := logger.NewLogger("DEBUG")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		filter   map[string]string
+		arn      string
+		expected bool
+	}{
+		{filter: nil, arn: "arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test3", expected: true},
+		{filter: map[string]string{"scan": "true"}, arn: "arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test1", expected: true},
+		{filter: map[string]string{"scan": "true"}, arn: "arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test2", expected: false},
+		{filter: map[string]string{"team": ""}, arn: "arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test1", expected: true},
+		{filter: map[string]string{"team": ""}, arn: "arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test2", expected: false},
+		{filter: map[string]string{"scan": "true"}, arn: "arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test3", expected: false},
+	}
+
+	for i, c := range cases {
+		s := NewECRService("xxxxx", "us-east-1", "latest", Options{TagFilter: c.filter}, logger, mockECRService{})
+		repo := &ecr.Repository{
+			RepositoryName: aws.String("TestRepo"),
+			RepositoryArn:  aws.String(c.arn),
+		}
+		if match := s.matchTags(repo); match != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %v, got: %v", i, c.expected, match)
+		}
+	}
+}
+
+func TestGroupTag(t *testing.T) {
+	logger, err := logger.NewLogger("DEBUG")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewECRService("xxxxx", "us-east-1", "latest", Options{GroupTag: "team"}, logger, mockECRService{})
+	for _, name := range []string{"TestRepo/Test1", "TestRepo/Test2", "TestRepo/Test3"} {
+		repo := &ecr.Repository{
+			RepositoryName: aws.String(name),
+			RepositoryArn:  aws.String("arn:aws:ecr:us-east-1:xxxxx:repository/" + name),
+		}
+		// Repositories whose tags can't be listed are kept without a tag filter
+		if !s.matchTags(repo) {
+			t.Fatalf("Expected %s to match without a tag filter", name)
+		}
+	}
+
+	report := &Report{
+		Filtered: []*RepositoryInfo{{Name: "TestRepo/Test1"}},
+		Clean:    []*RepositoryInfo{{Name: "TestRepo/Test2"}, {Name: "TestRepo/Test3"}},
+	}
+	report.SetGroup(s.groups.get)
+	groups := []string{report.Filtered[0].Group, report.Clean[0].Group, report.Clean[1].Group}
+	if !reflect.DeepEqual(groups, []string{"platform", "", ""}) {
+		t.Fatalf("values not equal, wanting: %v, got: %v", []string{"platform", "", ""}, groups)
+	}
+
+	// Tags are listed once for the filter and the group
+	s = NewECRService("xxxxx", "us-east-1", "latest", Options{TagFilter: map[string]string{"scan": "true"}, GroupTag: "team"}, logger, mockECRService{})
+	if s.matchTags(&ecr.Repository{RepositoryName: aws.String("TestRepo/Test3"), RepositoryArn: aws.String("arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test3")}) {
+		t.Fatalf("Expected repositories whose tags can't be listed to be skipped with a tag filter")
+	}
+	if !s.matchTags(&ecr.Repository{RepositoryName: aws.String("TestRepo/Test1"), RepositoryArn: aws.String("arn:aws:ecr:us-east-1:xxxxx:repository/TestRepo/Test1")}) || s.groups.get("TestRepo/Test1") != "platform" {
+		t.Fatalf("Expected TestRepo/Test1 to match and be grouped, got: %q", s.groups.get("TestRepo/Test1"))
+	}
+}
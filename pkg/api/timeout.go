@@ -0,0 +1,19 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// TimeoutRequests cancels requests of the client not completed within timeout, retries and rate limiting included,
+// while the HTTP client's timeout only bounds single attempts
+func TimeoutRequests(c *client.Client, timeout time.Duration) {
+	c.Handlers.Build.PushFrontNamed(request.NamedHandler{Name: "ecrscan.Timeout", Fn: func(r *request.Request) {
+		ctx, cancelFunc := context.WithTimeout(r.Context(), timeout)
+		r.SetContext(ctx)
+		r.Handlers.Complete.PushBack(func(*request.Request) { cancelFunc() })
+	}})
+}
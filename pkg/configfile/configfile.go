@@ -0,0 +1,572 @@
+package configfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Exporters which can be enabled from a config file
+var Exporters = []string{"log", "slack", "sns", "mailgun", "prometheus", "grafana"}
+
+// File is the structured configuration of the report lambda
+type File struct {
+	Repositories Repositories  `yaml:"repositories" json:"repositories"`
+	Thresholds   Thresholds    `yaml:"thresholds" json:"thresholds"`
+	Suppressions []Suppression `yaml:"suppressions" json:"suppressions"`
+	Snoozes      []Snooze      `yaml:"snoozes" json:"snoozes"`
+	// Findings of filtered out packages aren't counted
+	PackageFilters []PackageFilter `yaml:"package_filters" json:"package_filters"`
+	Notifiers      Notifiers       `yaml:"notifiers" json:"notifiers"`
+	Teams          []Team          `yaml:"teams" json:"teams"`
+	// Notifiers receiving the part of the report covering a namespace, e.g.: payments of payments/api
+	Namespaces map[string]Notifiers `yaml:"namespaces" json:"namespaces"`
+	// Named reports selected by the invocation payload, e.g.: daily-critical, weekly-full
+	Profiles map[string]Profile `yaml:"profiles" json:"profiles"`
+	// Format of the selected profile, set by WithProfile
+	Format Format `yaml:"-" json:"-"`
+}
+
+// Profile overrides the repositories, thresholds, notifiers and format of the file, settings left empty keep theirs
+type Profile struct {
+	Repositories Repositories `yaml:"repositories" json:"repositories"`
+	Thresholds   Thresholds   `yaml:"thresholds" json:"thresholds"`
+	Notifiers    Notifiers    `yaml:"notifiers" json:"notifiers"`
+	Format       Format       `yaml:"format" json:"format"`
+	// Leaves the reports of teams and namespaces out
+	SkipTeams bool `yaml:"skip_teams" json:"skip_teams"`
+}
+
+// Format decides how the report reads, empty values leave environment variables in effect
+type Format struct {
+	Locale            string `yaml:"locale" json:"locale"`
+	DateFormat        string `yaml:"date_format" json:"date_format"`
+	Timezone          string `yaml:"timezone" json:"timezone"`
+	ShowAllSeverities *bool  `yaml:"show_all_severities" json:"show_all_severities"`
+	GroupByNamespace  *bool  `yaml:"group_by_namespace" json:"group_by_namespace"`
+}
+
+// Repositories selects the repositories taking part in the report
+type Repositories struct {
+	// Repository name patterns, * matches any sequence of characters
+	Include []string `yaml:"include" json:"include"`
+	Exclude []string `yaml:"exclude" json:"exclude"`
+	// Resource tags a repository must carry, an empty value matches any value
+	Tags map[string]string `yaml:"tags" json:"tags"`
+}
+
+// Thresholds decide which findings are reported
+type Thresholds struct {
+	MinimumSeverity string `yaml:"minimum_severity" json:"minimum_severity"`
+	// Per repository minimum severity, the first matching override wins
+	Overrides []SeverityOverride `yaml:"overrides" json:"overrides"`
+	// Scores of severity levels used for threshold comparisons
+	Weights map[string]int `yaml:"weights" json:"weights"`
+	// Finding counts per severity which trigger a report
+	Counts severity.CountThresholds `yaml:"counts" json:"counts"`
+	// How score and count thresholds combine: score, count, any or all
+	Mode string `yaml:"mode" json:"mode"`
+}
+
+// SeverityOverride replaces the minimum severity for matching repositories
+type SeverityOverride struct {
+	Repository      string `yaml:"repository" json:"repository"`
+	MinimumSeverity string `yaml:"minimum_severity" json:"minimum_severity"`
+}
+
+// Suppression leaves matching repositories out of every report, until it expires when Expires is set
+type Suppression struct {
+	Repository string `yaml:"repository" json:"repository"`
+	Reason     string `yaml:"reason" json:"reason"`
+	// Date, e.g.: 2020-07-31, or RFC 3339 time the suppression expires at, never when empty
+	Expires string `yaml:"expires" json:"expires"`
+}
+
+// Snooze leaves a matching repository, or a vulnerability of it, out of reports until the given date
+type Snooze struct {
+	Repository    string `yaml:"repository" json:"repository"`
+	Vulnerability string `yaml:"vulnerability" json:"vulnerability"`
+	// Date, e.g.: 2020-07-31, or RFC 3339 time the snooze expires at
+	Until  string `yaml:"until" json:"until"`
+	Reason string `yaml:"reason" json:"reason"`
+}
+
+// PackageFilter counts the findings of matching packages only, or leaves them out
+type PackageFilter struct {
+	// Repositories the filter applies to, every repository when empty
+	Repository string   `yaml:"repository" json:"repository"`
+	Include    []string `yaml:"include" json:"include"`
+	Exclude    []string `yaml:"exclude" json:"exclude"`
+}
+
+// Notifiers configure the exporters, empty values leave environment variables in effect
+type Notifiers struct {
+	Exporters []string        `yaml:"exporters" json:"exporters"`
+	Slack     SlackNotifier   `yaml:"slack" json:"slack"`
+	SNS       SNSNotifier     `yaml:"sns" json:"sns"`
+	Mailgun   MailgunNotifier `yaml:"mailgun" json:"mailgun"`
+}
+
+// SlackNotifier .
+type SlackNotifier struct {
+	Channel string `yaml:"channel" json:"channel"`
+	// Secrets Manager secret holding the token, set to post to another workspace
+	TokenSecretARN string `yaml:"token_secret_arn" json:"token_secret_arn"`
+}
+
+// SNSNotifier .
+type SNSNotifier struct {
+	TopicARN string `yaml:"topic_arn" json:"topic_arn"`
+}
+
+// MailgunNotifier .
+type MailgunNotifier struct {
+	From       string   `yaml:"from" json:"from"`
+	Recipients []string `yaml:"recipients" json:"recipients"`
+}
+
+// Team receives a report of its own repositories through its own notifiers
+type Team struct {
+	Name         string   `yaml:"name" json:"name"`
+	Repositories []string `yaml:"repositories" json:"repositories"`
+	// Values of the repository group tag, repositories of these groups belong to the team too
+	Groups    []string  `yaml:"groups" json:"groups"`
+	Notifiers Notifiers `yaml:"notifiers" json:"notifiers"`
+}
+
+// ValidationError lists every problem found in a config file
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config file: " + strings.Join(e, "; ")
+}
+
+// Load fetches and parses the config file at an s3://bucket/key URI
+func Load(uri string, client s3iface.S3API) (*File, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "s3" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("Invalid config file URI %s, expected s3://bucket/key", uri)
+	}
+
+	output, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(u.Host),
+		Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching config file %s: %s", uri, err)
+	}
+	defer output.Body.Close()
+
+	var buffer bytes.Buffer
+	if _, err := buffer.ReadFrom(output.Body); err != nil {
+		return nil, fmt.Errorf("Error reading config file %s: %s", uri, err)
+	}
+
+	file, err := Parse(buffer.Bytes(), strings.HasSuffix(u.Path, ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", uri, err)
+	}
+	return file, nil
+}
+
+// Parse decodes a YAML or JSON config file, rejecting unknown fields, and validates it
+func Parse(data []byte, isJSON bool) (*File, error) {
+	var file File
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("invalid config file: %s", err)
+		}
+	} else if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid config file: %s", err)
+	}
+
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Validate checks the config file against the schema, reporting every problem at once
+func (f *File) Validate() error {
+	var errs ValidationError
+
+	errs = append(errs, f.Thresholds.validate("thresholds")...)
+	errs = append(errs, f.Repositories.validate("repositories")...)
+
+	for i, s := range f.Suppressions {
+		if s.Repository == "" {
+			errs = append(errs, fmt.Sprintf("suppressions[%d].repository: is required", i))
+		}
+		if s.Reason == "" {
+			errs = append(errs, fmt.Sprintf("suppressions[%d].reason: is required", i))
+		}
+		if s.Expires != "" {
+			if _, err := parseUntil(s.Expires); err != nil {
+				errs = append(errs, fmt.Sprintf("suppressions[%d].expires: %q is not a date, expected e.g.: 2020-07-31", i, s.Expires))
+			}
+		}
+	}
+
+	for i, s := range f.Snoozes {
+		field := fmt.Sprintf("snoozes[%d]", i)
+		if s.Repository == "" {
+			errs = append(errs, field+".repository: is required")
+		}
+		if s.Reason == "" {
+			errs = append(errs, field+".reason: is required")
+		}
+		if _, err := parseUntil(s.Until); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.until: %q is not a date, expected e.g.: 2020-07-31", field, s.Until))
+		}
+	}
+
+	for i, p := range f.PackageFilters {
+		field := fmt.Sprintf("package_filters[%d]", i)
+		if len(p.Include) == 0 && len(p.Exclude) == 0 {
+			errs = append(errs, field+": include or exclude is required")
+		}
+		errs = append(errs, validatePatterns(field+".include", p.Include)...)
+		errs = append(errs, validatePatterns(field+".exclude", p.Exclude)...)
+	}
+
+	errs = append(errs, f.Notifiers.validate("notifiers")...)
+
+	names := map[string]bool{}
+	for i, t := range f.Teams {
+		field := fmt.Sprintf("teams[%d]", i)
+		if t.Name == "" {
+			errs = append(errs, field+".name: is required")
+		} else if names[t.Name] {
+			errs = append(errs, fmt.Sprintf("%s.name: duplicate team %q", field, t.Name))
+		}
+		names[t.Name] = true
+
+		if len(t.Repositories) == 0 && len(t.Groups) == 0 {
+			errs = append(errs, field+": repositories or groups is required")
+		}
+		errs = append(errs, validatePatterns(field+".repositories", t.Repositories)...)
+		errs = append(errs, t.Notifiers.validate(field+".notifiers")...)
+	}
+
+	for _, ns := range sortedNamespaces(f.Namespaces) {
+		field := "namespaces." + ns
+		if ns == "" || strings.ContainsAny(ns, "/*") {
+			errs = append(errs, fmt.Sprintf("%s: invalid namespace %q", field, ns))
+		}
+		errs = append(errs, f.Namespaces[ns].validate(field+".notifiers")...)
+	}
+
+	for _, name := range sortedProfiles(f.Profiles) {
+		field := "profiles." + name
+		p := f.Profiles[name]
+		errs = append(errs, p.Repositories.validate(field+".repositories")...)
+		errs = append(errs, p.Thresholds.validate(field+".thresholds")...)
+		errs = append(errs, p.Notifiers.validate(field+".notifiers")...)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (t Thresholds) validate(field string) []string {
+	var errs []string
+	if s := t.MinimumSeverity; s != "" {
+		errs = append(errs, validateSeverity(field+".minimum_severity", s)...)
+	}
+
+	for _, s := range sortedKeys(t.Weights) {
+		name := field + ".weights." + s
+		errs = append(errs, validateSeverity(name, s)...)
+		if t.Weights[s] <= 0 {
+			errs = append(errs, fmt.Sprintf("%s: expected a positive score, got %d", name, t.Weights[s]))
+		}
+	}
+
+	if err := t.Counts.Validate(); err != nil {
+		errs = append(errs, field+".counts: "+err.Error())
+	}
+
+	if m := t.Mode; m != "" && !contains(severity.ThresholdModes, m) {
+		errs = append(errs, fmt.Sprintf("%s.mode: unknown mode %q, expected one of %s", field, m, strings.Join(severity.ThresholdModes, ", ")))
+	}
+
+	for i, o := range t.Overrides {
+		name := fmt.Sprintf("%s.overrides[%d]", field, i)
+		if o.Repository == "" {
+			errs = append(errs, name+".repository: is required")
+		}
+		if o.MinimumSeverity == "" {
+			errs = append(errs, name+".minimum_severity: is required")
+		} else {
+			errs = append(errs, validateSeverity(name+".minimum_severity", o.MinimumSeverity)...)
+		}
+	}
+	return errs
+}
+
+func (r Repositories) validate(field string) []string {
+	errs := validatePatterns(field+".include", r.Include)
+	return append(errs, validatePatterns(field+".exclude", r.Exclude)...)
+}
+
+func (n Notifiers) validate(field string) []string {
+	var errs []string
+	for i, e := range n.Exporters {
+		if !contains(Exporters, e) {
+			errs = append(errs, fmt.Sprintf("%s.exporters[%d]: unknown exporter %q, expected one of %s", field, i, e, strings.Join(Exporters, ", ")))
+		}
+	}
+	if arn := n.Slack.TokenSecretARN; arn != "" && !strings.HasPrefix(arn, "arn:") {
+		errs = append(errs, fmt.Sprintf("%s.slack.token_secret_arn: %q is not an ARN", field, arn))
+	}
+	if arn := n.SNS.TopicARN; arn != "" && !strings.HasPrefix(arn, "arn:") {
+		errs = append(errs, fmt.Sprintf("%s.sns.topic_arn: %q is not an ARN", field, arn))
+	}
+	for i, r := range n.Mailgun.Recipients {
+		if !strings.Contains(r, "@") {
+			errs = append(errs, fmt.Sprintf("%s.mailgun.recipients[%d]: %q is not an email address", field, i, r))
+		}
+	}
+	return errs
+}
+
+func validateSeverity(field string, s string) []string {
+	if _, ok := severity.SeverityTable[s]; !ok {
+		return []string{fmt.Sprintf("%s: unknown severity %q, expected one of %s", field, s, strings.Join(severity.SeverityList, ", "))}
+	}
+	return nil
+}
+
+func validatePatterns(field string, patterns []string) []string {
+	var errs []string
+	for i, p := range patterns {
+		if p == "" {
+			errs = append(errs, fmt.Sprintf("%s[%d]: empty pattern", field, i))
+		}
+	}
+	return errs
+}
+
+// WithProfile returns a copy of the file with the named profile applied
+func (f *File) WithProfile(name string) (*File, error) {
+	p, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown report profile %q, expected one of %s", name, strings.Join(sortedProfiles(f.Profiles), ", "))
+	}
+
+	file := *f
+	if len(p.Repositories.Include) > 0 {
+		file.Repositories.Include = p.Repositories.Include
+	}
+	if len(p.Repositories.Exclude) > 0 {
+		file.Repositories.Exclude = p.Repositories.Exclude
+	}
+	if len(p.Repositories.Tags) > 0 {
+		file.Repositories.Tags = p.Repositories.Tags
+	}
+
+	if p.Thresholds.MinimumSeverity != "" {
+		file.Thresholds.MinimumSeverity = p.Thresholds.MinimumSeverity
+	}
+	if len(p.Thresholds.Overrides) > 0 {
+		file.Thresholds.Overrides = p.Thresholds.Overrides
+	}
+	if len(p.Thresholds.Weights) > 0 {
+		file.Thresholds.Weights = p.Thresholds.Weights
+	}
+	if len(p.Thresholds.Counts) > 0 {
+		file.Thresholds.Counts = p.Thresholds.Counts
+	}
+	if p.Thresholds.Mode != "" {
+		file.Thresholds.Mode = p.Thresholds.Mode
+	}
+
+	if len(p.Notifiers.Exporters) > 0 {
+		file.Notifiers.Exporters = p.Notifiers.Exporters
+	}
+	if p.Notifiers.Slack.Channel != "" {
+		file.Notifiers.Slack.Channel = p.Notifiers.Slack.Channel
+	}
+	if p.Notifiers.SNS.TopicARN != "" {
+		file.Notifiers.SNS.TopicARN = p.Notifiers.SNS.TopicARN
+	}
+	if p.Notifiers.Mailgun.From != "" {
+		file.Notifiers.Mailgun.From = p.Notifiers.Mailgun.From
+	}
+	if len(p.Notifiers.Mailgun.Recipients) > 0 {
+		file.Notifiers.Mailgun.Recipients = p.Notifiers.Mailgun.Recipients
+	}
+
+	file.Format = p.Format
+	if p.SkipTeams {
+		file.Teams = nil
+		file.Namespaces = nil
+	}
+	return &file, nil
+}
+
+// Selected reports whether the repository takes part in the report
+func (f *File) Selected(name string) bool {
+	if len(f.Repositories.Include) > 0 && !matchAny(f.Repositories.Include, name) {
+		return false
+	}
+	return !matchAny(f.Repositories.Exclude, name)
+}
+
+// Suppressed returns the suppression matching the repository which hasn't expired by now, if any
+func (f *File) Suppressed(name string, now time.Time) *Suppression {
+	for i, s := range f.Suppressions {
+		if api.WildcardMatch(s.Repository, name) && !s.expired(now) {
+			return &f.Suppressions[i]
+		}
+	}
+	return nil
+}
+
+// ExpiringSuppressions returns the suppressions expiring within window, the soonest first
+func (f *File) ExpiringSuppressions(now time.Time, window time.Duration) []*api.RepositoryInfo {
+	var expiring []*api.RepositoryInfo
+	for _, s := range f.Suppressions {
+		if s.Expires == "" {
+			continue
+		}
+		until, err := parseUntil(s.Expires)
+		if err == nil && now.Before(until) && until.Sub(now) <= window {
+			expiring = append(expiring, &api.RepositoryInfo{
+				Name:        s.Repository,
+				Suppression: &report.Suppression{Repository: s.Repository, Until: until, Reason: s.Reason},
+			})
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].Suppression.Until.Before(expiring[j].Suppression.Until)
+	})
+	return expiring
+}
+
+// expired reports whether the suppression expired by now, never when it has no expiry
+func (s Suppression) expired(now time.Time) bool {
+	if s.Expires == "" {
+		return false
+	}
+	until, err := parseUntil(s.Expires)
+	return err == nil && !now.Before(until)
+}
+
+// SnoozeList returns the snoozes of the file, expired ones included
+func (f *File) SnoozeList() []report.Snooze {
+	var snoozes []report.Snooze
+	for _, s := range f.Snoozes {
+		until, _ := parseUntil(s.Until)
+		snoozes = append(snoozes, report.Snooze{
+			Repository:    s.Repository,
+			Vulnerability: s.Vulnerability,
+			Until:         until,
+			Reason:        s.Reason,
+			By:            "config file",
+		})
+	}
+	return snoozes
+}
+
+// PackageFilterList returns the package filters of the file
+func (f *File) PackageFilterList() []api.PackageFilter {
+	var filters []api.PackageFilter
+	for _, p := range f.PackageFilters {
+		filters = append(filters, api.PackageFilter{Repository: p.Repository, Include: p.Include, Exclude: p.Exclude})
+	}
+	return filters
+}
+
+// parseUntil parses the expiry of a snooze, dates expire at the end of the day in UTC
+func parseUntil(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date.AddDate(0, 0, 1), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Routes returns the teams followed by a team of each namespace, named after it, owning its repositories
+func (f *File) Routes() []Team {
+	routes := append([]Team{}, f.Teams...)
+	for _, ns := range sortedNamespaces(f.Namespaces) {
+		routes = append(routes, Team{Name: "namespace " + ns, Repositories: []string{ns + "/*"}, Notifiers: f.Namespaces[ns]})
+	}
+	return routes
+}
+
+// Owns reports whether the repository belongs to the team
+func (t Team) Owns(name string) bool {
+	return matchAny(t.Repositories, name)
+}
+
+// OwnsGroup reports whether repositories of the group belong to the team, ungrouped repositories don't
+func (t Team) OwnsGroup(group string) bool {
+	for _, g := range t.Groups {
+		if group != "" && g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if api.WildcardMatch(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedNamespaces(m map[string]Notifiers) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedProfiles(m map[string]Profile) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
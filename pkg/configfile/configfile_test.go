@@ -0,0 +1,380 @@
+package configfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const testYAML = `
+repositories:
+  include: ["team-*"]
+  exclude: ["*/sandbox"]
+  tags:
+    scan: "true"
+thresholds:
+  minimum_severity: HIGH
+  weights:
+    CRITICAL: 1000
+  counts:
+    CRITICAL: 1
+    HIGH: 5
+  mode: any
+  overrides:
+    - repository: team-a/public-*
+      minimum_severity: MEDIUM
+suppressions:
+  - repository: team-a/legacy
+    reason: end of life
+snoozes:
+  - repository: team-b/api
+    vulnerability: CVE-2021-44228
+    until: 2020-07-31
+    reason: patched base image rolling out
+package_filters:
+  - exclude: [kernel-headers]
+  - repository: team-a/*
+    include: ["openssl*", "log4j*"]
+notifiers:
+  exporters: [log, slack]
+  slack:
+    channel: "#ecr-scan"
+teams:
+  - name: payments
+    repositories: ["team-a/*"]
+    notifiers:
+      exporters: [slack]
+      slack:
+        channel: "#payments"
+namespaces:
+  team-b:
+    exporters: [mailgun]
+    mailgun:
+      recipients: [team-b@example.com]
+profiles:
+  payments-only:
+    repositories:
+      include: ["team-a/*"]
+    thresholds:
+      minimum_severity: CRITICAL
+    notifiers:
+      slack:
+        channel: "#payments-security"
+    format:
+      locale: de
+      show_all_severities: true
+    skip_teams: true
+`
+
+type mockS3Service struct {
+	s3iface.S3API
+}
+
+func (m mockS3Service) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	if *input.Bucket != "config-bucket" {
+		return nil, fmt.Errorf("NoSuchBucket")
+	}
+	body := testYAML
+	if strings.HasSuffix(*input.Key, ".json") {
+		body = `{"thresholds": {"minimum_severity": "LOW"}}`
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+func TestParse(t *testing.T) {
+	file, err := Parse([]byte(testYAML), false)
+	if err != nil {
+		t.Fatalf("Error parsing config file: %s", err)
+	}
+
+	if file.Thresholds.MinimumSeverity != "HIGH" {
+		t.Fatalf("values not equal, wanting: HIGH, got: %s", file.Thresholds.MinimumSeverity)
+	}
+	if file.Thresholds.Weights["CRITICAL"] != 1000 {
+		t.Fatalf("Unexpected severity weights: %v", file.Thresholds.Weights)
+	}
+	if file.Thresholds.Counts["HIGH"] != 5 || file.Thresholds.Mode != "any" {
+		t.Fatalf("Unexpected count thresholds: %v, mode: %s", file.Thresholds.Counts, file.Thresholds.Mode)
+	}
+	if len(file.Thresholds.Overrides) != 1 || file.Thresholds.Overrides[0].MinimumSeverity != "MEDIUM" {
+		t.Fatalf("Unexpected severity overrides: %+v", file.Thresholds.Overrides)
+	}
+	if !reflect.DeepEqual(file.Repositories.Tags, map[string]string{"scan": "true"}) {
+		t.Fatalf("Unexpected repository tags: %v", file.Repositories.Tags)
+	}
+	if len(file.Teams) != 1 || file.Teams[0].Notifiers.Slack.Channel != "#payments" {
+		t.Fatalf("Unexpected teams: %+v", file.Teams)
+	}
+	filters := file.PackageFilterList()
+	if len(filters) != 2 || filters[0].Repository != "" || filters[1].Include[1] != "log4j*" {
+		t.Fatalf("Unexpected package filters: %+v", filters)
+	}
+	snoozes := file.SnoozeList()
+	if len(snoozes) != 1 || snoozes[0].Vulnerability != "CVE-2021-44228" || !snoozes[0].Until.Equal(time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected snoozes: %+v", snoozes)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		data     string
+		isJSON   bool
+		expected []string
+	}{
+		{data: "thresholds:\n  minimum: HIGH\n", expected: []string{"field minimum not found"}},
+		{data: `{"thresholds": {"minimum": "HIGH"}}`, isJSON: true, expected: []string{`unknown field "minimum"`}},
+		{
+			data: `
+thresholds:
+  minimum_severity: SEVERE
+  weights:
+    HIGH: 0
+    SEVERE: 10
+  counts:
+    HIGH: -1
+  mode: most
+  overrides:
+    - repository: team-a/*
+suppressions:
+  - repository: legacy
+    expires: someday
+snoozes:
+  - repository: team-b/api
+    until: next week
+package_filters:
+  - repository: team-a/*
+notifiers:
+  exporters: [slak]
+teams:
+  - name: payments
+  - name: payments
+    repositories: ["team-a/*"]
+    notifiers:
+      slack:
+        token_secret_arn: payments-slack
+      sns:
+        topic_arn: payments
+profiles:
+  weekly-full:
+    repositories:
+      include: [""]
+    thresholds:
+      minimum_severity: ALL
+    notifiers:
+      exporters: [pager]
+namespaces:
+  team-b/api:
+    exporters: [slack]
+`,
+			expected: []string{
+				`thresholds.minimum_severity: unknown severity "SEVERE"`,
+				"thresholds.weights.HIGH: expected a positive score, got 0",
+				`thresholds.weights.SEVERE: unknown severity "SEVERE"`,
+				"thresholds.counts: Invalid count threshold -1 for HIGH",
+				`thresholds.mode: unknown mode "most"`,
+				"thresholds.overrides[0].minimum_severity: is required",
+				"suppressions[0].reason: is required",
+				`suppressions[0].expires: "someday" is not a date`,
+				"snoozes[0].reason: is required",
+				`snoozes[0].until: "next week" is not a date`,
+				"package_filters[0]: include or exclude is required",
+				`notifiers.exporters[0]: unknown exporter "slak"`,
+				"teams[0]: repositories or groups is required",
+				`teams[1].name: duplicate team "payments"`,
+				`teams[1].notifiers.slack.token_secret_arn: "payments-slack" is not an ARN`,
+				`teams[1].notifiers.sns.topic_arn: "payments" is not an ARN`,
+				"profiles.weekly-full.repositories.include[0]: empty pattern",
+				`profiles.weekly-full.thresholds.minimum_severity: unknown severity "ALL"`,
+				`profiles.weekly-full.notifiers.exporters[0]: unknown exporter "pager"`,
+				`namespaces.team-b/api: invalid namespace "team-b/api"`,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		_, err := Parse([]byte(c.data), c.isJSON)
+		if err == nil {
+			t.Fatalf("[%d] Expected error parsing config file", i)
+		}
+		for _, e := range c.expected {
+			if !strings.Contains(err.Error(), e) {
+				t.Fatalf("[%d] Error should contain: %s, got: %s", i, e, err)
+			}
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		uri      string
+		expected string
+		err      bool
+	}{
+		{uri: "s3://config-bucket/ecr-scan/config.yaml", expected: "HIGH"},
+		{uri: "s3://config-bucket/ecr-scan/config.json", expected: "LOW"},
+		{uri: "s3://other-bucket/config.yaml", err: true},
+		{uri: "https://config-bucket/config.yaml", err: true},
+		{uri: "s3://config-bucket", err: true},
+	}
+
+	for i, c := range cases {
+		file, err := Load(c.uri, mockS3Service{})
+		if c.err {
+			if err == nil {
+				t.Fatalf("[%d] Expected error loading %s", i, c.uri)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("[%d] Error loading config file: %s", i, err)
+		}
+		if file.Thresholds.MinimumSeverity != c.expected {
+			t.Fatalf("[%d] values not equal, wanting: %s, got: %s", i, c.expected, file.Thresholds.MinimumSeverity)
+		}
+	}
+}
+
+func TestSelection(t *testing.T) {
+	file, err := Parse([]byte(testYAML), false)
+	if err != nil {
+		t.Fatalf("Error parsing config file: %s", err)
+	}
+
+	cases := []struct {
+		name       string
+		selected   bool
+		suppressed bool
+		owned      bool
+	}{
+		{name: "team-a/api", selected: true, owned: true},
+		{name: "team-a/legacy", selected: true, suppressed: true, owned: true},
+		{name: "team-b/sandbox", selected: false},
+		{name: "tools/builder", selected: false},
+	}
+
+	for i, c := range cases {
+		if selected := file.Selected(c.name); selected != c.selected {
+			t.Fatalf("[%d] Selected(%s) wanting: %t, got: %t", i, c.name, c.selected, selected)
+		}
+		if suppressed := file.Suppressed(c.name, time.Now()) != nil; suppressed != c.suppressed {
+			t.Fatalf("[%d] Suppressed(%s) wanting: %t, got: %t", i, c.name, c.suppressed, suppressed)
+		}
+		if owned := file.Teams[0].Owns(c.name); owned != c.owned {
+			t.Fatalf("[%d] Owns(%s) wanting: %t, got: %t", i, c.name, c.owned, owned)
+		}
+	}
+}
+
+func TestTeamOwnsGroup(t *testing.T) {
+	team := Team{Name: "payments", Groups: []string{"payments", "billing"}}
+	if !team.OwnsGroup("billing") || team.OwnsGroup("search") || team.OwnsGroup("") {
+		t.Fatalf("Unexpected groups owned by %+v", team)
+	}
+	if (Team{Name: "all", Repositories: []string{"*"}}).OwnsGroup("") {
+		t.Fatalf("Expected teams without groups not to own ungrouped repositories by group")
+	}
+}
+
+func TestSuppressionExpiry(t *testing.T) {
+	file := &File{Suppressions: []Suppression{
+		{Repository: "team-a/legacy", Reason: "end of life"},
+		{Repository: "team-b/migration-*", Reason: "replaced by team-b/api", Expires: "2020-07-24"},
+		{Repository: "team-c/*", Reason: "handed over", Expires: "2020-07-20"},
+		{Repository: "team-d/*", Reason: "audit pending", Expires: "2020-09-30"},
+	}}
+	now := time.Date(2020, 7, 19, 8, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		now        time.Time
+		suppressed bool
+	}{
+		{name: "team-a/legacy", now: now.AddDate(1, 0, 0), suppressed: true},
+		{name: "team-b/migration-db", now: now, suppressed: true},
+		// The suppression lasts the whole day
+		{name: "team-b/migration-db", now: time.Date(2020, 7, 24, 23, 0, 0, 0, time.UTC), suppressed: true},
+		{name: "team-b/migration-db", now: time.Date(2020, 7, 25, 0, 0, 0, 0, time.UTC), suppressed: false},
+	}
+	for i, c := range cases {
+		if suppressed := file.Suppressed(c.name, c.now) != nil; suppressed != c.suppressed {
+			t.Fatalf("[%d] Suppressed(%s) wanting: %t, got: %t", i, c.name, c.suppressed, suppressed)
+		}
+	}
+
+	var names []string
+	for _, r := range file.ExpiringSuppressions(now, 7*24*time.Hour) {
+		names = append(names, r.Name)
+	}
+	if expected := []string{"team-c/*", "team-b/migration-*"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, names)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	file, err := Parse([]byte(testYAML), false)
+	if err != nil {
+		t.Fatalf("Error parsing config file: %s", err)
+	}
+
+	routes := file.Routes()
+	if len(routes) != 2 || routes[0].Name != "payments" || routes[1].Name != "namespace team-b" {
+		t.Fatalf("Unexpected routes: %+v", routes)
+	}
+	if routes[1].Notifiers.Mailgun.Recipients[0] != "team-b@example.com" {
+		t.Fatalf("Unexpected notifiers: %+v", routes[1].Notifiers)
+	}
+
+	cases := []struct {
+		name  string
+		owned bool
+	}{
+		{name: "team-b/api", owned: true},
+		{name: "team-b/tools/builder", owned: true},
+		{name: "team-b", owned: false},
+		{name: "team-bc/api", owned: false},
+	}
+	for i, c := range cases {
+		if owned := routes[1].Owns(c.name); owned != c.owned {
+			t.Fatalf("[%d] Owns(%s) wanting: %t, got: %t", i, c.name, c.owned, owned)
+		}
+	}
+}
+
+func TestWithProfile(t *testing.T) {
+	file, err := Parse([]byte(testYAML), false)
+	if err != nil {
+		t.Fatalf("Error parsing config file: %s", err)
+	}
+
+	profile, err := file.WithProfile("payments-only")
+	if err != nil {
+		t.Fatalf("Error applying profile: %s", err)
+	}
+	if profile.Selected("team-b/api") || !profile.Selected("team-a/api") || profile.Selected("team-a/sandbox") {
+		t.Fatalf("Unexpected repositories: %+v", profile.Repositories)
+	}
+	if profile.Thresholds.MinimumSeverity != "CRITICAL" || profile.Thresholds.Mode != "any" {
+		t.Fatalf("Unexpected thresholds: %+v", profile.Thresholds)
+	}
+	if profile.Notifiers.Slack.Channel != "#payments-security" || !reflect.DeepEqual(profile.Notifiers.Exporters, []string{"log", "slack"}) {
+		t.Fatalf("Unexpected notifiers: %+v", profile.Notifiers)
+	}
+	if profile.Format.Locale != "de" || !*profile.Format.ShowAllSeverities || len(profile.Routes()) != 0 {
+		t.Fatalf("Unexpected format: %+v, teams: %+v", profile.Format, profile.Teams)
+	}
+	// The file itself is left untouched
+	if file.Thresholds.MinimumSeverity != "HIGH" || len(file.Teams) != 1 || len(file.Namespaces) != 1 {
+		t.Fatalf("Profile changed the file: %+v", file)
+	}
+
+	if _, err := file.WithProfile("weekly-full"); err == nil || !strings.Contains(err.Error(), `"weekly-full", expected one of payments-only`) {
+		t.Fatalf("Expected unknown profile error, got: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package exporters
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+const (
+	badgeLabel     = "vulnerabilities"
+	badgeExtension = ".svg"
+)
+
+const (
+	badgeColorClean   = "#4c1"
+	badgeColorDefault = "#9f9f9f"
+)
+
+// BadgeStorage stores badges under stable keys, satisfied by api.S3Service
+type BadgeStorage interface {
+	Put(key string, body []byte, contentType string, cacheControl string) error
+	List() ([]string, error)
+}
+
+// BadgeExporter uploads an SVG badge with the finding counts of each repository
+type BadgeExporter struct {
+	Presentation
+
+	name    string
+	storage BadgeStorage
+}
+
+// NewBadgeExporter .
+func NewBadgeExporter(name string, storage BadgeStorage) *BadgeExporter {
+	return &BadgeExporter{
+		name:    name,
+		storage: storage,
+	}
+}
+
+// Name .
+func (b BadgeExporter) Name() string {
+	return b.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (b BadgeExporter) Format(report *api.Report) (func() error, error) {
+	badges := b.formatBadges(report)
+
+	return func() error {
+		// Repositories fixed since the last run get a clean badge instead of keeping a stale one
+		existing, err := b.storage.List()
+		if err != nil {
+			return err
+		}
+		for _, key := range existing {
+			if !strings.HasSuffix(key, badgeExtension) {
+				continue
+			}
+			if _, ok := badges[key]; !ok {
+				badges[key] = renderBadge(badgeLabel, "none", badgeColorClean)
+			}
+		}
+
+		for key, badge := range badges {
+			if err := b.storage.Put(key, []byte(badge), "image/svg+xml", "no-cache"); err != nil {
+				return fmt.Errorf("Error uploading badge %s: %s", key, err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// worstCounts returns the reported finding counts of each vulnerable repository by name.
+// Images of multiple platforms are reported separately, the worst count of each level among them is kept.
+func worstCounts(report *api.Report) map[string]map[string]int64 {
+	counts := make(map[string]map[string]int64)
+	for _, r := range append(append([]*api.RepositoryInfo{}, report.Filtered...), report.PullThroughCache...) {
+		if _, ok := counts[r.Name]; !ok {
+			counts[r.Name] = make(map[string]int64)
+		}
+		for key, val := range r.ReportedSeverity().Count {
+			if val != nil && *val > counts[r.Name][key] {
+				counts[r.Name][key] = *val
+			}
+		}
+	}
+	return counts
+}
+
+// formatBadges renders a badge for each repository of the report, keyed by the object key
+func (p Presentation) formatBadges(report *api.Report) map[string]string {
+	badges := make(map[string]string)
+	for _, r := range report.Clean {
+		badges[r.Name+badgeExtension] = renderBadge(badgeLabel, "none", badgeColorClean)
+	}
+	for name, count := range worstCounts(report) {
+		message, color := p.badgeMessage(count)
+		badges[name+badgeExtension] = renderBadge(badgeLabel, message, color)
+	}
+	return badges
+}
+
+// badgeMessage lists the finding counts in severity order, colored by the worst level
+func (p Presentation) badgeMessage(count map[string]int64) (string, string) {
+	var parts []string
+	color := ""
+	for _, key := range severity.SeverityList {
+		if count[key] == 0 {
+			continue
+		}
+		if color == "" {
+			color = p.displayOf(key).Color
+			if color == "" {
+				color = badgeColorDefault
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d", strings.ToLower(key), count[key]))
+	}
+	if len(parts) == 0 {
+		return "none", badgeColorClean
+	}
+	return strings.Join(parts, ", "), color
+}
+
+// renderBadge draws a flat badge, text width is estimated from the character count
+func renderBadge(label string, message string, color string) string {
+	labelWidth := len(label)*7 + 10
+	messageWidth := len(message)*7 + 10
+	width := labelWidth + messageWidth
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<title>%s: %s</title>`+
+		`<rect width="%d" height="20" fill="#555"/>`+
+		`<rect x="%d" width="%d" height="20" fill="%s"/>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="14">%s</text>`+
+		`<text x="%d" y="14">%s</text>`+
+		`</g></svg>`,
+		width, label, message,
+		label, message,
+		labelWidth,
+		labelWidth, messageWidth, color,
+		labelWidth/2, label,
+		labelWidth+messageWidth/2, message,
+	)
+}
@@ -0,0 +1,80 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+type fakeBadgeStorage struct {
+	objects map[string]string
+}
+
+func (f *fakeBadgeStorage) Put(key string, body []byte, contentType string, cacheControl string) error {
+	f.objects[key] = string(body)
+	return nil
+}
+
+func (f *fakeBadgeStorage) List() ([]string, error) {
+	var keys []string
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func TestBadgeMessage(t *testing.T) {
+	var p Presentation
+	cases := []struct {
+		count   map[string]int64
+		message string
+		color   string
+	}{
+		{count: map[string]int64{"CRITICAL": 2, "HIGH": 5}, message: "critical: 2, high: 5", color: "#e05d44"},
+		{count: map[string]int64{"MEDIUM": 1, "LOW": 3}, message: "medium: 1, low: 3", color: "#dfb317"},
+		{count: map[string]int64{"INFORMATIONAL": 1}, message: "informational: 1", color: "#9f9f9f"},
+		{count: map[string]int64{}, message: "none", color: "#4c1"},
+	}
+
+	for i, c := range cases {
+		message, color := p.badgeMessage(c.count)
+		if message != c.message || color != c.color {
+			t.Fatalf("[%d] values are not equal, wanting: %s %s, got: %s %s", i, c.message, c.color, message, color)
+		}
+	}
+}
+
+func TestBadgeSend(t *testing.T) {
+	storage := &fakeBadgeStorage{objects: map[string]string{
+		"TestRepository/Fixed.svg": "stale",
+		"index.html":               "unrelated",
+	}}
+
+	b := NewBadgeExporter("badge", storage)
+	send, err := b.Format(&api.Report{
+		Filtered: pushgatewayInput,
+		Clean:    []*api.RepositoryInfo{{Name: "TestRepository/Clean"}},
+	})
+	if err != nil {
+		t.Fatalf("Error formatting badges: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error uploading badges: %s", err)
+	}
+
+	expected := map[string]string{
+		"TestRepository/TestRepo1.svg": "critical: 1, high: 2",
+		"TestRepository/TestRepo2.svg": "critical: 3, low: 4",
+		"TestRepository/Clean.svg":     "none",
+		"TestRepository/Fixed.svg":     "none",
+	}
+	for key, message := range expected {
+		if !strings.Contains(storage.objects[key], "<title>vulnerabilities: "+message+"</title>") {
+			t.Fatalf("Expected badge %s to show %q, got: %s", key, message, storage.objects[key])
+		}
+	}
+	if storage.objects["index.html"] != "unrelated" {
+		t.Fatalf("Expected objects other than badges to be left alone")
+	}
+}
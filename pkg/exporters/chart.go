@@ -0,0 +1,167 @@
+package exporters
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// Layout of the histogram in pixels, text is drawn with chartGlyphs scaled by chartScale
+const (
+	chartBarHeight = 160
+	chartSlot      = 120
+	chartBarWidth  = 64
+	chartMargin    = 16
+	chartScale     = 2
+	chartTextLine  = 6 * chartScale
+)
+
+// chartGlyphs are 3x5 pixel glyphs of the digits and letters, row by row
+var chartGlyphs = map[rune]string{
+	'0': "111101101101111", '1': "010110010010111", '2': "111001111100111", '3': "111001111001111",
+	'4': "101101111001001", '5': "111100111001111", '6': "111100111101111", '7': "111001001001001",
+	'8': "111101111101111", '9': "111101111001111",
+	'A': "010101111101101", 'B': "110101110101110", 'C': "011100100100011", 'D': "110101101101110",
+	'E': "111100110100111", 'F': "111100110100100", 'G': "011100101101011", 'H': "101101111101101",
+	'I': "111010010010111", 'J': "001001001101010", 'K': "101101110101101", 'L': "100100100100111",
+	'M': "101111111101101", 'N': "110101101101101", 'O': "010101101101010", 'P': "110101110100100",
+	'Q': "010101101110011", 'R': "110101110101101", 'S': "011100010001110", 'T': "111010010010010",
+	'U': "101101101101111", 'V': "101101101101010", 'W': "101101111111101", 'X': "101101010101101",
+	'Y': "101101010010010", 'Z': "111001010100111",
+}
+
+var (
+	chartBackground = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	chartForeground = color.RGBA{R: 0x33, G: 0x33, B: 0x33, A: 0xff}
+	chartDefault    = color.RGBA{R: 0x9f, G: 0x9f, B: 0x9f, A: 0xff}
+)
+
+// ChartStorage stores chart images where Slack can fetch them, satisfied by api.S3Service
+type ChartStorage interface {
+	Put(key string, body []byte, contentType string, cacheControl string) error
+}
+
+// Chart uploads the severity histogram of each report to Storage, URL is where the uploaded images are served from
+type Chart struct {
+	Storage ChartStorage
+	URL     string
+}
+
+// histogramLevels returns the severity levels with findings in severity order, with the number of findings of each
+func histogramLevels(findings map[string]int64) ([]string, []int64) {
+	var levels []string
+	var counts []int64
+	for _, key := range severity.SeverityList {
+		if findings[key] > 0 {
+			levels = append(levels, key)
+			counts = append(counts, findings[key])
+		}
+	}
+	return levels, counts
+}
+
+// histogramText describes the histogram for clients not showing images, e.g.: CRITICAL 2, HIGH 5
+func (p Presentation) histogramText(findings map[string]int64) string {
+	levels, counts := histogramLevels(findings)
+	parts := make([]string, len(levels))
+	for i, key := range levels {
+		parts[i] = fmt.Sprintf("%s %d", p.displayOf(key).Label, counts[i])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// renderHistogram draws a PNG bar chart of the findings per severity level, in the colors of the levels.
+// Bars are labelled by the level and topped by the number of findings, nil when there are no findings.
+func (p Presentation) renderHistogram(findings map[string]int64) ([]byte, error) {
+	levels, counts := histogramLevels(findings)
+	if len(levels) == 0 {
+		return nil, nil
+	}
+	var highest int64
+	for _, count := range counts {
+		if count > highest {
+			highest = count
+		}
+	}
+
+	width := 2*chartMargin + len(levels)*chartSlot
+	height := 2*chartMargin + chartBarHeight + 2*chartTextLine
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: chartBackground}, image.Point{}, draw.Src)
+
+	baseline := chartMargin + chartTextLine + chartBarHeight
+	for i, key := range levels {
+		center := chartMargin + i*chartSlot + chartSlot/2
+		// Every bar is at least a few pixels high, so small counts stay visible
+		barHeight := int(int64(chartBarHeight) * counts[i] / highest)
+		if barHeight < 2 {
+			barHeight = 2
+		}
+		bar := image.Rect(center-chartBarWidth/2, baseline-barHeight, center+chartBarWidth/2, baseline)
+		draw.Draw(img, bar, &image.Uniform{C: chartColor(p.displayOf(key).Color)}, image.Point{}, draw.Src)
+
+		count := strconv.FormatInt(counts[i], 10)
+		chartText(img, count, center-chartTextWidth(count)/2, bar.Min.Y-chartTextLine)
+		chartText(img, key, center-chartTextWidth(key)/2, baseline+chartScale*2)
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// chartColor parses a #rgb or #rrggbb color, the default gray when it's not set
+func chartColor(hex string) color.RGBA {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return chartDefault
+	}
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xff}
+}
+
+// chartTextWidth returns the width of the text in pixels
+func chartTextWidth(text string) int {
+	return len(text) * 4 * chartScale
+}
+
+// chartText draws the text with its top left corner at x, y, leaving out characters without a glyph
+func chartText(img draw.Image, text string, x int, y int) {
+	for i, r := range strings.ToUpper(text) {
+		glyph := chartGlyphs[r]
+		for p, bit := range glyph {
+			if bit != '1' {
+				continue
+			}
+			left := x + i*4*chartScale + p%3*chartScale
+			top := y + p/3*chartScale
+			draw.Draw(img, image.Rect(left, top, left+chartScale, top+chartScale), &image.Uniform{C: chartForeground}, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// histogramURL returns where the chart uploaded under key is served from
+func (c Chart) histogramURL(key string) string {
+	return strings.TrimSuffix(c.URL, "/") + "/" + key
+}
+
+// histogramKey returns a new key for every report, Slack caches images by their URL
+func histogramKey(report *api.Report, now string) string {
+	if report.RunID != "" {
+		return fmt.Sprintf("ecr-scan-severity-%s.png", report.RunID)
+	}
+	return fmt.Sprintf("ecr-scan-severity-%s.png", now)
+}
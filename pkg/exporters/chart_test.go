@@ -0,0 +1,100 @@
+package exporters
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+	"github.com/nlopes/slack"
+)
+
+// countingSlackClient counts the messages posted
+type countingSlackClient struct {
+	posted int
+}
+
+func (c *countingSlackClient) PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	c.posted++
+	return channelID, "1", nil
+}
+
+func TestRenderHistogram(t *testing.T) {
+	var p Presentation
+	if chart, err := p.renderHistogram(map[string]int64{}); err != nil || chart != nil {
+		t.Fatalf("Expected no chart without findings, got: %v %v", chart, err)
+	}
+
+	chart, err := p.renderHistogram(map[string]int64{"CRITICAL": 2, "HIGH": 8})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	img, err := png.Decode(bytes.NewReader(chart))
+	if err != nil {
+		t.Fatalf("Expected a PNG image, got: %s", err)
+	}
+	if width := img.Bounds().Dx(); width != 2*chartMargin+2*chartSlot {
+		t.Fatalf("Expected a bar for each level with findings, got width: %d", width)
+	}
+
+	// Bottom of the bars, in the colors of their levels
+	y := chartMargin + chartTextLine + chartBarHeight - 1
+	for i, key := range []string{"CRITICAL", "HIGH"} {
+		r, g, b, _ := img.At(chartMargin+i*chartSlot+chartSlot/2, y).RGBA()
+		expected := chartColor(p.displayOf(key).Color)
+		if uint8(r>>8) != expected.R || uint8(g>>8) != expected.G || uint8(b>>8) != expected.B {
+			t.Fatalf("Unexpected color of the %s bar: %d %d %d", key, r>>8, g>>8, b>>8)
+		}
+	}
+}
+
+func TestChartColor(t *testing.T) {
+	if c := chartColor("#f80"); c.R != 0xff || c.G != 0x88 || c.B != 0 {
+		t.Fatalf("Unexpected color: %v", c)
+	}
+	if c := chartColor(""); c != chartDefault {
+		t.Fatalf("Expected the default color, got: %v", c)
+	}
+}
+
+func TestSlackChart(t *testing.T) {
+	storage := &fakeArchiveStorage{}
+	client := &countingSlackClient{}
+	s := NewSlackExporterWithClient("slack", client, "#ecr-scan").WithChart(Chart{Storage: storage, URL: "https://charts.example.com/ecr/"})
+
+	report := &api.Report{RunID: "run-1", Filtered: []*api.RepositoryInfo{
+		{Name: "team-a/api", Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(1), "HIGH": aws.Int64(2)}}},
+	}}
+	messages := s.messages(report)
+	if _, _, err := s.attachChart(report, messages); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	image, ok := messages[0].BlockSet[len(messages[0].BlockSet)-1].(*slack.ImageBlock)
+	if !ok || image.ImageURL != "https://charts.example.com/ecr/ecr-scan-severity-run-1.png" || image.AltText != "CRITICAL 1, HIGH 2" {
+		t.Fatalf("Expected the chart to be attached to the header, got: %+v", messages[0].BlockSet)
+	}
+
+	send, err := s.Format(report)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if storage.key != "ecr-scan-severity-run-1.png" || storage.contentType != "image/png" || !bytes.HasPrefix(storage.body, []byte("\x89PNG")) {
+		t.Fatalf("Unexpected chart %s of type %s", storage.key, storage.contentType)
+	}
+	if client.posted != 2 {
+		t.Fatalf("Expected the header and the repository to be posted, got: %d", client.posted)
+	}
+
+	// A clean report has no chart
+	storage.key = ""
+	send, _ = s.Format(&api.Report{})
+	if err := send(); err != nil || storage.key != "" {
+		t.Fatalf("Expected no chart for a clean report, got: %s %v", storage.key, err)
+	}
+}
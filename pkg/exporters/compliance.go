@@ -0,0 +1,122 @@
+package exporters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+// Compliance frameworks controls can be referenced from
+const (
+	FrameworkCISDocker = "cis-docker"
+	FrameworkNIST      = "nist-800-53"
+)
+
+// ComplianceFrameworks lists the frameworks of the bundled mapping
+var ComplianceFrameworks = []string{FrameworkCISDocker, FrameworkNIST}
+
+// Control is a control of a compliance framework a finding relates to
+type Control struct {
+	Framework string `json:"framework"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+}
+
+// Categories of findings, named after the sections of the SNS payload
+const (
+	categoryVulnerable  = "vulnerablities"
+	categoryBaseImage   = "base_image"
+	categoryFailed      = "failed"
+	categoryNotScanned  = "not_scanned"
+	categoryScanOnPush  = "scan_on_push_disabled"
+	categoryNotCovered  = "not_covered"
+	categoryPublic      = "public"
+	categoryStale       = "stale"
+	categoryUntagged    = "untagged"
+	categoryNoLifecycle = "no_lifecycle_policy"
+)
+
+var (
+	cisTrustedBaseImages = Control{Framework: FrameworkCISDocker, ID: "4.2", Title: "Ensure that containers use only trusted base images"}
+	cisScanAndRebuild    = Control{Framework: FrameworkCISDocker, ID: "4.4", Title: "Ensure images are scanned and rebuilt to include security patches"}
+	cisImageSprawl       = Control{Framework: FrameworkCISDocker, ID: "6.1", Title: "Ensure that image sprawl is avoided"}
+	nistPublicContent    = Control{Framework: FrameworkNIST, ID: "AC-22", Title: "Publicly Accessible Content"}
+	nistInventory        = Control{Framework: FrameworkNIST, ID: "CM-8", Title: "System Component Inventory"}
+	nistScanning         = Control{Framework: FrameworkNIST, ID: "RA-5", Title: "Vulnerability Monitoring and Scanning"}
+	nistFlawRemediation  = Control{Framework: FrameworkNIST, ID: "SI-2", Title: "Flaw Remediation"}
+	nistSupplyChain      = Control{Framework: FrameworkNIST, ID: "SR-3", Title: "Supply Chain Controls and Processes"}
+)
+
+// complianceMapping ties categories of findings to controls. ECR findings don't carry CWEs, so findings are
+// mapped by what they tell about the image rather than by weakness.
+var complianceMapping = map[string][]Control{
+	categoryVulnerable:  {cisScanAndRebuild, nistScanning, nistFlawRemediation},
+	categoryBaseImage:   {cisTrustedBaseImages, nistSupplyChain},
+	categoryFailed:      {nistScanning},
+	categoryNotScanned:  {cisScanAndRebuild, nistScanning},
+	categoryScanOnPush:  {cisScanAndRebuild, nistScanning},
+	categoryNotCovered:  {cisScanAndRebuild, nistScanning},
+	categoryPublic:      {nistScanning, nistPublicContent},
+	categoryStale:       {cisScanAndRebuild, nistFlawRemediation},
+	categoryUntagged:    {cisImageSprawl, nistInventory},
+	categoryNoLifecycle: {cisImageSprawl, nistInventory},
+}
+
+// ParseComplianceFrameworks parses a comma separated list of frameworks, e.g.: cis-docker,nist-800-53
+func ParseComplianceFrameworks(raw string) ([]string, error) {
+	var frameworks []string
+	if strings.TrimSpace(raw) == "" {
+		return frameworks, nil
+	}
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if !contains(ComplianceFrameworks, f) {
+			return nil, fmt.Errorf("Unknown compliance framework %q, expected one of %s", f, strings.Join(ComplianceFrameworks, ", "))
+		}
+		frameworks = append(frameworks, f)
+	}
+	return frameworks, nil
+}
+
+// controls returns the controls of the enabled frameworks a category of findings relates to
+func (p Presentation) controls(category string) []Control {
+	var ret []Control
+	for _, c := range complianceMapping[category] {
+		if contains(p.ComplianceFrameworks, c.Framework) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// repositoryControls returns the controls the findings of a vulnerable repository relate to
+func (p Presentation) repositoryControls(r *api.RepositoryInfo) []Control {
+	ret := p.controls(categoryVulnerable)
+	if r.BaseImageFindings > 0 {
+		ret = append(ret, p.controls(categoryBaseImage)...)
+	}
+	return ret
+}
+
+// controlsText returns the references of controls, e.g.: CIS Docker 4.4, NIST 800-53 RA-5, empty without controls
+func (p Presentation) controlsText(controls []Control) string {
+	if len(controls) == 0 {
+		return ""
+	}
+	names := map[string]string{FrameworkCISDocker: "CIS Docker", FrameworkNIST: "NIST 800-53"}
+	var refs []string
+	for _, c := range controls {
+		refs = append(refs, names[c.Framework]+" "+c.ID)
+	}
+	return fmt.Sprintf(p.msg().controls, strings.Join(refs, ", "))
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
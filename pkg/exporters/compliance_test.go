@@ -0,0 +1,49 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+func TestParseComplianceFrameworks(t *testing.T) {
+	if frameworks, err := ParseComplianceFrameworks(" cis-docker, nist-800-53"); err != nil || len(frameworks) != 2 {
+		t.Fatalf("Unexpected frameworks: %v, %v", frameworks, err)
+	}
+	if frameworks, err := ParseComplianceFrameworks(""); err != nil || len(frameworks) != 0 {
+		t.Fatalf("Expected no frameworks, got: %v, %v", frameworks, err)
+	}
+	if _, err := ParseComplianceFrameworks("pci-dss"); err == nil {
+		t.Fatalf("Expected error parsing an unknown framework")
+	}
+}
+
+func TestComplianceControls(t *testing.T) {
+	vulnerable := &api.RepositoryInfo{
+		Name:              "team-a/api",
+		Severity:          severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(2)}},
+		BaseImageFindings: 1,
+	}
+	report := &api.Report{Filtered: []*api.RepositoryInfo{vulnerable}, NoLifecyclePolicy: []*api.RepositoryInfo{{Name: "team-a/web"}}}
+
+	var p Presentation
+	if refs := p.controlsText(p.repositoryControls(vulnerable)); refs != "" {
+		t.Fatalf("Expected no controls without frameworks, got: %s", refs)
+	}
+
+	p.ComplianceFrameworks = []string{FrameworkNIST}
+	if refs := p.controlsText(p.repositoryControls(vulnerable)); refs != "Controls: NIST 800-53 RA-5, NIST 800-53 SI-2, NIST 800-53 SR-3" {
+		t.Fatalf("Unexpected controls: %s", refs)
+	}
+
+	html, err := p.formatHTML(report)
+	if err != nil {
+		t.Fatalf("Error formatting HTML: %s", err)
+	}
+	if !strings.Contains(html, "<p>Controls: NIST 800-53 CM-8</p>") || strings.Contains(html, "CIS Docker") {
+		t.Fatalf("Expected the NIST controls of the lifecycle section, got: %s", html)
+	}
+}
@@ -0,0 +1,171 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+// ConfluenceExporter creates a Confluence page with the HTML report, or updates the page of the same date
+type ConfluenceExporter struct {
+	Presentation
+
+	client   *http.Client
+	name     string
+	url      string
+	user     string
+	token    string
+	space    string
+	parentID string
+	title    string
+}
+
+type confluencePage struct {
+	ID        string               `json:"id,omitempty"`
+	Type      string               `json:"type"`
+	Title     string               `json:"title"`
+	Space     confluenceSpace      `json:"space"`
+	Ancestors []confluenceAncestor `json:"ancestors,omitempty"`
+	Body      confluenceBody       `json:"body"`
+	Version   *confluenceVersion   `json:"version,omitempty"`
+}
+
+type confluenceSpace struct {
+	Key string `json:"key"`
+}
+
+type confluenceAncestor struct {
+	ID string `json:"id"`
+}
+
+type confluenceBody struct {
+	Storage confluenceStorage `json:"storage"`
+}
+
+type confluenceStorage struct {
+	Value          string `json:"value"`
+	Representation string `json:"representation"`
+}
+
+type confluenceVersion struct {
+	Number int `json:"number"`
+}
+
+// NewConfluenceExporter creates an exporter publishing to the space of the Confluence instance at url.
+// Requests are authenticated with basic auth when user is set, with token as a personal access token otherwise.
+func NewConfluenceExporter(name string, url string, user string, token string, space string, parentID string, title string) *ConfluenceExporter {
+	return &ConfluenceExporter{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		name:     name,
+		url:      strings.TrimSuffix(url, "/"),
+		user:     user,
+		token:    token,
+		space:    space,
+		parentID: parentID,
+		title:    title,
+	}
+}
+
+// Name .
+func (c ConfluenceExporter) Name() string {
+	return c.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (c ConfluenceExporter) Format(report *api.Report) (func() error, error) {
+	body, err := c.formatHTML(report)
+	if err != nil {
+		return nil, err
+	}
+
+	page := confluencePage{
+		Type:  "page",
+		Title: fmt.Sprintf("%s %s", c.title, c.reportDate(report.Date).Format(c.dateFormat())),
+		Space: confluenceSpace{Key: c.space},
+		Body:  confluenceBody{Storage: confluenceStorage{Value: body, Representation: "storage"}},
+	}
+	if c.parentID != "" {
+		page.Ancestors = []confluenceAncestor{{ID: c.parentID}}
+	}
+
+	return func() error {
+		// A rerun on the same day updates the page instead of failing on the duplicate title
+		existing, err := c.find(page.Title)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return c.do(http.MethodPost, "/rest/api/content", page, nil)
+		}
+
+		page.ID = existing.ID
+		page.Version = &confluenceVersion{Number: existing.Version.Number + 1}
+		return c.do(http.MethodPut, "/rest/api/content/"+url.PathEscape(existing.ID), page, nil)
+	}, nil
+}
+
+// find returns the page of the space with the title, nil when there is none
+func (c ConfluenceExporter) find(title string) (*confluencePage, error) {
+	query := url.Values{}
+	query.Set("spaceKey", c.space)
+	query.Set("title", title)
+	query.Set("expand", "version")
+
+	var result struct {
+		Results []confluencePage `json:"results"`
+	}
+	if err := c.do(http.MethodGet, "/rest/api/content?"+query.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Results) == 0 || result.Results[0].Version == nil {
+		return nil, nil
+	}
+	return &result.Results[0], nil
+}
+
+// do sends a request to the Confluence REST API, decoding the response into out when set
+func (c ConfluenceExporter) do(method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(payload)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Confluence responded with status %d", resp.StatusCode)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+func TestConfluenceSend(t *testing.T) {
+	cases := []struct {
+		existing []confluencePage
+		method   string
+		path     string
+		version  int
+	}{
+		{method: http.MethodPost, path: "/wiki/rest/api/content"},
+		// A page of the same date is updated with the next version
+		{existing: []confluencePage{{ID: "42", Version: &confluenceVersion{Number: 3}}}, method: http.MethodPut, path: "/wiki/rest/api/content/42", version: 4},
+	}
+
+	for i, c := range cases {
+		var method, path, user, password string
+		var page confluencePage
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				if r.URL.Query().Get("spaceKey") != "SEC" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"results": c.existing})
+				return
+			}
+			method, path = r.Method, r.URL.Path
+			user, password, _ = r.BasicAuth()
+			json.NewDecoder(r.Body).Decode(&page)
+		}))
+
+		e := NewConfluenceExporter("confluence", server.URL+"/wiki", "bot@example.com", "secret", "SEC", "1001", "ECR scan report")
+		send, err := e.Format(&api.Report{Filtered: pushgatewayInput})
+		if err != nil {
+			t.Fatalf("[%d] Error formatting page: %s", i, err)
+		}
+		if err := send(); err != nil {
+			t.Fatalf("[%d] Error publishing page: %s", i, err)
+		}
+		server.Close()
+
+		if method != c.method || path != c.path {
+			t.Fatalf("[%d] Expected %s %s, got: %s %s", i, c.method, c.path, method, path)
+		}
+		if user != "bot@example.com" || password != "secret" {
+			t.Fatalf("[%d] Wrong credentials, got => %s", i, user)
+		}
+		if page.Space.Key != "SEC" || len(page.Ancestors) != 1 || page.Ancestors[0].ID != "1001" || page.Body.Storage.Representation != "storage" {
+			t.Fatalf("[%d] Unexpected page: %+v", i, page)
+		}
+		if (page.Version == nil && c.version != 0) || (page.Version != nil && page.Version.Number != c.version) {
+			t.Fatalf("[%d] Expected version %d, got: %+v", i, c.version, page.Version)
+		}
+	}
+}
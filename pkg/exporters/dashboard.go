@@ -0,0 +1,239 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+const (
+	dashboardHistoryKey = "history.json"
+	dashboardIndexKey   = "index.html"
+	// Number of runs kept in the history and shown on the trend chart
+	dashboardHistoryLength = 90
+)
+
+// DashboardStorage stores the dashboard pages and its history, satisfied by api.S3Service
+type DashboardStorage interface {
+	Get(key string) ([]byte, error)
+	Put(key string, body []byte, contentType string, cacheControl string) error
+}
+
+// DashboardExporter regenerates a static dashboard of the latest report and the trend of previous runs
+type DashboardExporter struct {
+	Presentation
+
+	name    string
+	storage DashboardStorage
+}
+
+// dashboardRun is the history entry of a run
+type dashboardRun struct {
+	Time       time.Time        `json:"time"`
+	Vulnerable int              `json:"vulnerable"`
+	Failed     int              `json:"failed"`
+	Findings   map[string]int64 `json:"findings"`
+}
+
+type dashboardPage struct {
+	Title string
+	Body  template.HTML
+}
+
+const dashboardPageTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td p { margin: 2px 0; font-size: 0.9em; color: #555; }
+</style>
+</head>
+<body>
+{{ .Body }}
+</body>
+</html>
+`
+
+// NewDashboardExporter .
+func NewDashboardExporter(name string, storage DashboardStorage) *DashboardExporter {
+	return &DashboardExporter{
+		name:    name,
+		storage: storage,
+	}
+}
+
+// Name .
+func (d DashboardExporter) Name() string {
+	return d.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (d DashboardExporter) Format(report *api.Report) (func() error, error) {
+	now := time.Now().UTC()
+
+	return func() error {
+		raw, err := d.storage.Get(dashboardHistoryKey)
+		if err != nil {
+			return err
+		}
+		var history []dashboardRun
+		if raw != nil {
+			if err := json.Unmarshal(raw, &history); err != nil {
+				return fmt.Errorf("Error parsing dashboard history: %s", err)
+			}
+		}
+
+		pages, history, err := d.formatDashboard(report, history, now)
+		if err != nil {
+			return err
+		}
+
+		// The index goes last, so it never links to pages which haven't been uploaded
+		keys := make([]string, 0, len(pages))
+		for key := range pages {
+			if key != dashboardIndexKey {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range append(keys, dashboardIndexKey) {
+			if err := d.storage.Put(key, []byte(pages[key]), "text/html; charset=utf-8", "no-cache"); err != nil {
+				return fmt.Errorf("Error uploading dashboard page %s: %s", key, err)
+			}
+		}
+
+		body, err := json.Marshal(history)
+		if err != nil {
+			return err
+		}
+		return d.storage.Put(dashboardHistoryKey, body, "application/json", "no-cache")
+	}, nil
+}
+
+// formatDashboard renders the index and a page per repository keyed by the object key, along with the history including the run
+func (p Presentation) formatDashboard(report *api.Report, history []dashboardRun, now time.Time) (map[string]string, []dashboardRun, error) {
+	history = append(history, dashboardRun{
+		Time:       now,
+		Vulnerable: len(report.Filtered),
+		Failed:     len(report.Failed),
+		Findings:   countFindings(report.Filtered),
+	})
+	if len(history) > dashboardHistoryLength {
+		history = history[len(history)-dashboardHistoryLength:]
+	}
+
+	pages := make(map[string]string)
+
+	data := p.newHTMLReport(report)
+	tables := []*htmlTable{&data.Vulnerable, &data.PullThroughCache}
+	for i := range data.Groups {
+		data.Groups[i].Collapsible = true
+		tables = append(tables, &data.Groups[i])
+	}
+	for _, table := range tables {
+		for i := range table.Rows {
+			table.Rows[i].Link = repositoryPageKey(table.Rows[i].Repository)
+		}
+	}
+	body, err := data.render()
+	if err != nil {
+		return nil, nil, err
+	}
+	head := p.headText(report.Date)
+	index, err := renderDashboardPage(head, body+p.trendChart(history))
+	if err != nil {
+		return nil, nil, err
+	}
+	pages[dashboardIndexKey] = index
+
+	// Images of multiple platforms share the page of their repository, clean repositories get a page without a table
+	byName := make(map[string][]*api.RepositoryInfo)
+	for _, r := range report.Clean {
+		byName[r.Name] = nil
+	}
+	for _, r := range append(append([]*api.RepositoryInfo{}, report.Filtered...), report.PullThroughCache...) {
+		byName[r.Name] = append(byName[r.Name], r)
+	}
+	for name, repositories := range byName {
+		body, err := htmlReport{Head: name, Clean: p.msg().clean, Vulnerable: p.newHTMLTable("", repositories)}.render()
+		if err != nil {
+			return nil, nil, err
+		}
+		if pages[repositoryPageKey(name)], err = renderDashboardPage(name, backLink(name, head)+body); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pages, history, nil
+}
+
+// repositoryPageKey returns the key of the repository's page, relative to the index
+func repositoryPageKey(name string) string {
+	return "repositories/" + name + ".html"
+}
+
+// backLink links the page of the repository to the index
+func backLink(name string, head string) string {
+	up := strings.Repeat("../", strings.Count(repositoryPageKey(name), "/"))
+	return fmt.Sprintf("<p><a href=\"%s%s\">%s</a></p>\n", up, dashboardIndexKey, template.HTMLEscapeString(head))
+}
+
+func renderDashboardPage(title string, body string) (string, error) {
+	buffer, err := execTmpl(dashboardPage{Title: title, Body: template.HTML(body)}, dashboardPageTemplate)
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// trendChart draws the number of vulnerable and failed repositories of each run as an SVG line chart
+func (p Presentation) trendChart(history []dashboardRun) string {
+	const width, height, padding = 600, 160, 10
+
+	highest := 1
+	for _, run := range history {
+		if run.Vulnerable > highest {
+			highest = run.Vulnerable
+		}
+		if run.Failed > highest {
+			highest = run.Failed
+		}
+	}
+
+	points := func(value func(dashboardRun) int) string {
+		var coordinates []string
+		for i, run := range history {
+			x := padding
+			if len(history) > 1 {
+				x += i * (width - 2*padding) / (len(history) - 1)
+			}
+			y := height - padding - value(run)*(height-2*padding)/highest
+			coordinates = append(coordinates, fmt.Sprintf("%d,%d", x, y))
+		}
+		return strings.Join(coordinates, " ")
+	}
+
+	first, last := history[0].Time.In(p.location()), history[len(history)-1].Time.In(p.location())
+	return fmt.Sprintf(`<h2>%s</h2>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img">`+
+		`<rect width="%d" height="%d" fill="#fafafa" stroke="#ccc"/>`+
+		`<polyline fill="none" stroke="#e05d44" stroke-width="2" points="%s"/>`+
+		`<polyline fill="none" stroke="#9f9f9f" stroke-width="2" points="%s"/>`+
+		`</svg>
+<p>%s - %s, max. %d</p>
+`,
+		template.HTMLEscapeString(fmt.Sprintf(p.msg().trend, len(history))),
+		width, height, width, height,
+		points(func(r dashboardRun) int { return r.Vulnerable }),
+		points(func(r dashboardRun) int { return r.Failed }),
+		template.HTMLEscapeString(first.Format(p.dateFormat())), template.HTMLEscapeString(last.Format(p.dateFormat())), highest,
+	)
+}
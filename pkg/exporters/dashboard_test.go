@@ -0,0 +1,87 @@
+package exporters
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+type fakeDashboardStorage struct {
+	objects map[string]string
+}
+
+func (f *fakeDashboardStorage) Get(key string) ([]byte, error) {
+	body, ok := f.objects[key]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(body), nil
+}
+
+func (f *fakeDashboardStorage) Put(key string, body []byte, contentType string, cacheControl string) error {
+	f.objects[key] = string(body)
+	return nil
+}
+
+func TestDashboardSend(t *testing.T) {
+	var p Presentation
+	previous, _ := json.Marshal([]dashboardRun{{Time: time.Date(2020, 7, 17, 8, 0, 0, 0, time.UTC), Vulnerable: 5, Failed: 1}})
+	storage := &fakeDashboardStorage{objects: map[string]string{dashboardHistoryKey: string(previous)}}
+
+	d := NewDashboardExporter("dashboard", storage)
+	send, err := d.Format(&api.Report{
+		Filtered: pushgatewayInput,
+		Clean:    []*api.RepositoryInfo{{Name: "TestRepository/Clean"}},
+	})
+	if err != nil {
+		t.Fatalf("Error formatting dashboard: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error uploading dashboard: %s", err)
+	}
+
+	var history []dashboardRun
+	if err := json.Unmarshal([]byte(storage.objects[dashboardHistoryKey]), &history); err != nil {
+		t.Fatalf("Error parsing history: %s", err)
+	}
+	if len(history) != 2 || history[1].Vulnerable != 2 || history[1].Findings["CRITICAL"] != 4 {
+		t.Fatalf("Expected the run to be added to the history, got: %+v", history)
+	}
+
+	expected := map[string][]string{
+		"index.html": {
+			`<a href="repositories/TestRepository/TestRepo1.html">TestRepository/TestRepo1</a>`,
+			`points="10,10 590,94"`,
+		},
+		"repositories/TestRepository/TestRepo1.html": {
+			`<a href="../../index.html">`,
+			"<h1>TestRepository/TestRepo1</h1>",
+			"<td>1</td><td>2</td>",
+		},
+		"repositories/TestRepository/Clean.html": {
+			"<p>" + p.msg().clean + "</p>",
+		},
+	}
+	for key, contents := range expected {
+		for _, c := range contents {
+			if !strings.Contains(storage.objects[key], c) {
+				t.Fatalf("Expected %s to contain %s, got: \n%s", key, c, storage.objects[key])
+			}
+		}
+	}
+}
+
+func TestDashboardHistoryLength(t *testing.T) {
+	var p Presentation
+	history := make([]dashboardRun, dashboardHistoryLength)
+	_, history, err := p.formatDashboard(&api.Report{}, history, time.Now())
+	if err != nil {
+		t.Fatalf("Error formatting dashboard: %s", err)
+	}
+	if len(history) != dashboardHistoryLength {
+		t.Fatalf("Expected the history to be capped at %d runs, got: %d", dashboardHistoryLength, len(history))
+	}
+}
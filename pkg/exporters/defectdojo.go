@@ -0,0 +1,279 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+const (
+	defectDojoScanType  = "Generic Findings Import"
+	defectDojoTestTitle = "ECR scan"
+)
+
+// defectDojoSeverities maps severity levels to the ones DefectDojo knows
+var defectDojoSeverities = map[string]string{
+	"CRITICAL":      "Critical",
+	"HIGH":          "High",
+	"MEDIUM":        "Medium",
+	"LOW":           "Low",
+	"INFORMATIONAL": "Info",
+	"UNTRIAGED":     "Info",
+	"UNDEFINED":     "Info",
+}
+
+// DefectDojoTarget is the product and engagement the findings of a repository are imported into
+type DefectDojoTarget struct {
+	Product    string `json:"product"`
+	Engagement string `json:"engagement"`
+}
+
+// DefectDojoExporter reimports the findings of each run into DefectDojo, as a test per product and engagement.
+// DefectDojo deduplicates the findings and closes the ones missing from the import, e.g.: of fixed images.
+type DefectDojoExporter struct {
+	Presentation
+
+	client      *http.Client
+	name        string
+	url         string
+	token       string
+	productType string
+	// Target of repositories missing from targets, their findings aren't imported when its product is empty
+	fallback DefectDojoTarget
+	// Repository name patterns and their targets, * matches any sequence of characters
+	targets map[string]DefectDojoTarget
+}
+
+type defectDojoFindings struct {
+	Findings []defectDojoFinding `json:"findings"`
+}
+
+type defectDojoFinding struct {
+	Title            string `json:"title"`
+	Description      string `json:"description"`
+	Severity         string `json:"severity"`
+	Date             string `json:"date"`
+	ComponentName    string `json:"component_name"`
+	UniqueIDFromTool string `json:"unique_id_from_tool"`
+	References       string `json:"references,omitempty"`
+	StaticFinding    bool   `json:"static_finding"`
+	DynamicFinding   bool   `json:"dynamic_finding"`
+	Occurrences      int64  `json:"nb_occurences"`
+}
+
+// ParseDefectDojoTargets parses a JSON object mapping repository name patterns to products and engagements,
+// e.g.: {"team-a/*": {"product": "Payments", "engagement": "Container images"}}
+func ParseDefectDojoTargets(raw string) (map[string]DefectDojoTarget, error) {
+	targets := map[string]DefectDojoTarget{}
+	if raw == "" {
+		return targets, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &targets); err != nil {
+		return nil, fmt.Errorf("Invalid DefectDojo products %q, expected a JSON object of repository patterns: %s", raw, err)
+	}
+	for pattern, t := range targets {
+		if t.Product == "" {
+			return nil, fmt.Errorf("Invalid DefectDojo products, the product of %s is missing", pattern)
+		}
+	}
+	return targets, nil
+}
+
+// NewDefectDojoExporter creates an exporter for the DefectDojo API at url. Engagements and products missing
+// from DefectDojo are created, products with productType.
+func NewDefectDojoExporter(name string, url string, token string, productType string, fallback DefectDojoTarget, targets map[string]DefectDojoTarget) *DefectDojoExporter {
+	return &DefectDojoExporter{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		name:        name,
+		url:         strings.TrimSuffix(url, "/"),
+		token:       token,
+		productType: productType,
+		fallback:    fallback,
+		targets:     targets,
+	}
+}
+
+// Name .
+func (d DefectDojoExporter) Name() string {
+	return d.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (d DefectDojoExporter) Format(report *api.Report) (func() error, error) {
+	date := d.reportDate(report.Date).Format("2006-01-02")
+	imports := d.findings(report, date)
+
+	return func() error {
+		targets := make([]DefectDojoTarget, 0, len(imports))
+		for target := range imports {
+			targets = append(targets, target)
+		}
+		sort.Slice(targets, func(i, j int) bool {
+			return targets[i].Product+"/"+targets[i].Engagement < targets[j].Product+"/"+targets[j].Engagement
+		})
+
+		// A failing import doesn't keep the others from being imported
+		var failed []string
+		for _, target := range targets {
+			if err := d.reimport(target, imports[target], date); err != nil {
+				failed = append(failed, fmt.Sprintf("%s/%s: %s", target.Product, target.Engagement, err))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("Error importing %d of %d DefectDojo tests: %s", len(failed), len(targets), strings.Join(failed, "; "))
+		}
+		return nil
+	}, nil
+}
+
+// findings collects the findings of each target, a finding per repository and severity level. Targets of clean
+// repositories get an empty import, so DefectDojo closes their findings.
+func (d DefectDojoExporter) findings(report *api.Report, date string) map[DefectDojoTarget]defectDojoFindings {
+	imports := make(map[DefectDojoTarget]defectDojoFindings)
+
+	for _, r := range report.Clean {
+		if target, ok := d.target(r.Name); ok {
+			imports[target] = imports[target]
+		}
+	}
+
+	for _, r := range append(append([]*api.RepositoryInfo{}, report.Filtered...), report.PullThroughCache...) {
+		target, ok := d.target(r.Name)
+		if !ok {
+			continue
+		}
+		findings := imports[target]
+		reported := r.ReportedSeverity()
+		for _, key := range severity.SeverityList {
+			count := reported.Count[key]
+			if count == nil || *count == 0 {
+				continue
+			}
+			findings.Findings = append(findings.Findings, defectDojoFinding{
+				Title:            fmt.Sprintf("%s vulnerabilities in %s", key, r.DisplayName()),
+				Description:      d.description(r, key, *count),
+				Severity:         defectDojoSeverities[key],
+				Date:             date,
+				ComponentName:    r.Name,
+				UniqueIDFromTool: r.DisplayName() + "/" + key,
+				References:       r.Link,
+				Occurrences:      *count,
+			})
+		}
+		imports[target] = findings
+	}
+	return imports
+}
+
+func (d DefectDojoExporter) description(r *api.RepositoryInfo, level string, count int64) string {
+	lines := []string{fmt.Sprintf("%d %s findings in the image of %s.", count, level, r.DisplayName())}
+	if r.Tag != "" {
+		lines = append(lines, "Image tag: "+r.Tag)
+	}
+	if r.Digest != "" {
+		lines = append(lines, "Image digest: "+r.Digest)
+	}
+	if r.RegistryID != "" {
+		lines = append(lines, "Registry: "+r.RegistryID)
+	}
+	if !r.ScanCompletedAt.IsZero() {
+		lines = append(lines, "Scanned: "+r.ScanCompletedAt.UTC().Format(time.RFC3339))
+	}
+	if r.Link != "" {
+		lines = append(lines, "Scan results: "+r.Link)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// target returns the product and engagement of a repository, the longest matching pattern wins
+func (d DefectDojoExporter) target(name string) (DefectDojoTarget, bool) {
+	best := ""
+	found := false
+	for pattern := range d.targets {
+		if !api.WildcardMatch(pattern, name) {
+			continue
+		}
+		if !found || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best, found = pattern, true
+		}
+	}
+	if !found {
+		return d.fallback, d.fallback.Product != ""
+	}
+
+	target := d.targets[best]
+	if target.Engagement == "" {
+		target.Engagement = d.fallback.Engagement
+	}
+	return target, true
+}
+
+// reimport uploads the findings of a target as a reimport of its test, creating it when missing
+func (d DefectDojoExporter) reimport(target DefectDojoTarget, findings defectDojoFindings, date string) error {
+	if findings.Findings == nil {
+		findings.Findings = []defectDojoFinding{}
+	}
+	file, err := json.Marshal(findings)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, field := range [][2]string{
+		{"scan_type", defectDojoScanType},
+		{"test_title", defectDojoTestTitle},
+		{"product_name", target.Product},
+		{"engagement_name", target.Engagement},
+		{"product_type_name", d.productType},
+		{"auto_create_context", "true"},
+		{"close_old_findings", "true"},
+		{"active", "true"},
+		{"verified", "false"},
+		{"minimum_severity", "Info"},
+		{"scan_date", date},
+	} {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("file", "ecr-scan.json")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(file); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.url+"/api/v2/reimport-scan/", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Token "+d.token)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("DefectDojo responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+func TestDefectDojoSend(t *testing.T) {
+	received := make(map[string][]defectDojoFinding)
+	var auth, productType, closeOld string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/reimport-scan/" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Error reading the scan file: %s", err)
+			return
+		}
+		var findings defectDojoFindings
+		json.NewDecoder(file).Decode(&findings)
+		received[r.FormValue("product_name")+"/"+r.FormValue("engagement_name")] = findings.Findings
+		auth = r.Header.Get("Authorization")
+		productType = r.FormValue("product_type_name")
+		closeOld = r.FormValue("close_old_findings")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	report := &api.Report{
+		Date: time.Date(2020, 7, 18, 20, 0, 0, 0, time.UTC),
+		Filtered: []*api.RepositoryInfo{
+			{
+				Name:     "team-a/app",
+				Link:     "https://console.aws.amazon.com/ecr/app",
+				Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(2), "LOW": aws.Int64(0)}},
+			},
+			{Name: "other/tool", Severity: severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(1)}}},
+		},
+		// Imported empty, so DefectDojo closes the findings of the fixed image
+		Clean: []*api.RepositoryInfo{{Name: "team-b/worker"}},
+	}
+
+	targets := map[string]DefectDojoTarget{
+		"team-a/*":   {Product: "Payments"},
+		"team-a/app": {Product: "Payments", Engagement: "App"},
+		"team-b/*":   {Product: "Search", Engagement: "Images"},
+	}
+	d := NewDefectDojoExporter("defectdojo", server.URL+"/", "secret", "ECR", DefectDojoTarget{Engagement: "ECR scan"}, targets)
+	send, err := d.Format(report)
+	if err != nil {
+		t.Fatalf("Error formatting findings: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error importing findings: %s", err)
+	}
+
+	date := "2020-07-18"
+	expected := map[string][]defectDojoFinding{
+		"Payments/App": {
+			{
+				Title:            "CRITICAL vulnerabilities in team-a/app",
+				Description:      "2 CRITICAL findings in the image of team-a/app.\nScan results: https://console.aws.amazon.com/ecr/app",
+				Severity:         "Critical",
+				Date:             date,
+				ComponentName:    "team-a/app",
+				UniqueIDFromTool: "team-a/app/CRITICAL",
+				References:       "https://console.aws.amazon.com/ecr/app",
+				Occurrences:      2,
+			},
+		},
+		"Search/Images": {},
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, received)
+	}
+	if auth != "Token secret" || productType != "ECR" || closeOld != "true" {
+		t.Fatalf("Unexpected request, authorization: %s, product type: %s, close old findings: %s", auth, productType, closeOld)
+	}
+}
+
+func TestDefectDojoTarget(t *testing.T) {
+	d := NewDefectDojoExporter("defectdojo", "", "", "", DefectDojoTarget{Product: "Platform", Engagement: "ECR scan"}, map[string]DefectDojoTarget{
+		"team-a/*":    {Product: "Payments"},
+		"team-a/api*": {Product: "API", Engagement: "Services"},
+	})
+
+	cases := map[string]DefectDojoTarget{
+		"team-a/app":     {Product: "Payments", Engagement: "ECR scan"},
+		"team-a/api-gw":  {Product: "API", Engagement: "Services"},
+		"team-c/service": {Product: "Platform", Engagement: "ECR scan"},
+	}
+	for name, expected := range cases {
+		if target, ok := d.target(name); !ok || target != expected {
+			t.Fatalf("values are not equal for %s, wanting: %v, got: %v", name, expected, target)
+		}
+	}
+
+	d.fallback.Product = ""
+	if _, ok := d.target("team-c/service"); ok {
+		t.Fatalf("Expected repositories without a product to be skipped")
+	}
+}
+
+func TestParseDefectDojoTargets(t *testing.T) {
+	targets, err := ParseDefectDojoTargets(`{"team-a/*": {"product": "Payments", "engagement": "Images"}}`)
+	if err != nil {
+		t.Fatalf("Error parsing targets: %s", err)
+	}
+	if targets["team-a/*"] != (DefectDojoTarget{Product: "Payments", Engagement: "Images"}) {
+		t.Fatalf("Unexpected targets: %v", targets)
+	}
+
+	for _, raw := range []string{`{"team-a/*": {"engagement": "Images"}}`, `["team-a/*"]`} {
+		if _, err := ParseDefectDojoTargets(raw); err == nil {
+			t.Fatalf("Expected error parsing %s", raw)
+		}
+	}
+}
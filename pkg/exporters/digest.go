@@ -0,0 +1,188 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+	"github.com/nlopes/slack"
+)
+
+// DigestExporter is an exporter which can send digests of the daily reports as well
+type DigestExporter interface {
+	Exporter
+	// Formats the digest then returns function which sends it on invocation
+	FormatDigest(digest *report.Digest) (func() error, error)
+}
+
+// digestSection is a titled list of lines of the digest
+type digestSection struct {
+	head  string
+	lines []string
+}
+
+// digestHeadText returns the header of the digest with its period
+func (p Presentation) digestHeadText(digest *report.Digest) string {
+	return fmt.Sprintf(p.msg().digestHead, digest.From.Format(p.dateFormat()), digest.To.Format(p.dateFormat()))
+}
+
+// digestSections returns the parts of the digest in display order, empty lists read "None"
+func (p Presentation) digestSections(digest *report.Digest) []digestSection {
+	var trend []string
+	for _, day := range digest.Trend {
+		line := fmt.Sprintf(p.msg().digestDay, day.Date.Format(p.dateFormat()), day.Vulnerable, day.Failed)
+		var counts []string
+		for _, key := range severity.SeverityList {
+			if day.Findings[key] > 0 {
+				counts = append(counts, fmt.Sprintf("%s: %d", key, day.Findings[key]))
+			}
+		}
+		if len(counts) > 0 {
+			line += " (" + strings.Join(counts, ", ") + ")"
+		}
+		trend = append(trend, line)
+	}
+
+	var breaches []string
+	for _, b := range digest.SLABreaches {
+		breaches = append(breaches, fmt.Sprintf(p.msg().slaBreach, b.Repository.DisplayName(), b.Severity, b.Days))
+	}
+
+	sections := []digestSection{
+		{head: p.msg().digestTrend, lines: trend},
+		{head: p.msg().digestNew, lines: p.listNames(digest.New)},
+		{head: p.msg().digestResolved, lines: p.listNames(digest.Resolved)},
+		{head: p.msg().digestSLA, lines: breaches},
+	}
+	for i := range sections {
+		if len(sections[i].lines) == 0 {
+			sections[i].lines = []string{p.msg().digestNone}
+		}
+	}
+	return sections
+}
+
+// formatDigestText renders the digest as plain text
+func (p Presentation) formatDigestText(digest *report.Digest) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(p.digestHeadText(digest) + "\n")
+	for _, s := range p.digestSections(digest) {
+		buffer.WriteString("\n" + s.head + "\n")
+		for _, line := range s.lines {
+			buffer.WriteString(line + "\n")
+		}
+	}
+	return buffer.String()
+}
+
+// FormatDigestText renders the digest as plain text, the way the log exporter prints it
+func (p Presentation) FormatDigestText(digest *report.Digest) string {
+	return p.formatDigestText(digest)
+}
+
+// FormatDigest prints the digest to stdout
+func (l LogExporter) FormatDigest(digest *report.Digest) (func() error, error) {
+	msg := l.formatDigestText(digest)
+	return func() error {
+		fmt.Println(msg)
+		return nil
+	}, nil
+}
+
+// FormatDigest posts the digest to the channel, a message per section
+func (s *SlackService) FormatDigest(digest *report.Digest) (func() error, error) {
+	messages := []slack.Blocks{{BlockSet: []slack.Block{s.GenerateTextBlock(bold(s.digestHeadText(digest)))}}}
+	for _, section := range s.digestSections(digest) {
+		text := boldn(section.head) + strings.Join(section.lines, "\n")
+		messages = append(messages, slack.Blocks{BlockSet: []slack.Block{s.GenerateTextBlock(text)}})
+	}
+
+	return func() error {
+		_, err := s.deliver(s.channel, messages)
+		return err
+	}, nil
+}
+
+// FormatDigest emails the digest as plain text
+func (m MailgunExporter) FormatDigest(digest *report.Digest) (func() error, error) {
+	msg := m.client.NewMessage(m.from, m.msg().digestSubject, m.formatDigestText(digest))
+	for _, user := range strings.Split(m.recipients, ",") {
+		if err := msg.AddRecipient(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		_, _, err := m.client.Send(msg)
+		return err
+	}, nil
+}
+
+type jsonDigest struct {
+	Head        string       `json:"head"`
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Trend       []jsonDay    `json:"trend"`
+	New         []repository `json:"new"`
+	Resolved    []repository `json:"resolved"`
+	SLABreaches []jsonBreach `json:"sla_breaches"`
+}
+
+type jsonDay struct {
+	Date       string         `json:"date"`
+	Vulnerable int            `json:"vulnerable"`
+	Failed     int            `json:"failed"`
+	Findings   []vulnerablity `json:"findings"`
+}
+
+type jsonBreach struct {
+	Name     string `json:"name"`
+	Platform string `json:"platform,omitempty"`
+	Severity string `json:"severity"`
+	Days     int    `json:"days"`
+}
+
+// FormatDigest publishes the digest as json
+func (s SNSExporter) FormatDigest(digest *report.Digest) (func() error, error) {
+	js := jsonDigest{
+		Head:     s.digestHeadText(digest),
+		From:     digest.From.Format("2006-01-02"),
+		To:       digest.To.Format("2006-01-02"),
+		New:      s.format(digest.New),
+		Resolved: s.format(digest.Resolved),
+	}
+	for _, day := range digest.Trend {
+		findings := make(map[string]*int64)
+		for key := range day.Findings {
+			val := day.Findings[key]
+			findings[key] = &val
+		}
+		js.Trend = append(js.Trend, jsonDay{
+			Date:       day.Date.Format("2006-01-02"),
+			Vulnerable: day.Vulnerable,
+			Failed:     day.Failed,
+			Findings:   s.findings(severity.Matrix{Count: findings}),
+		})
+	}
+	for _, b := range digest.SLABreaches {
+		js.SLABreaches = append(js.SLABreaches, jsonBreach{Name: b.Repository.Name, Platform: b.Repository.Platform, Severity: b.Severity, Days: b.Days})
+	}
+
+	body, err := json.Marshal(js)
+	if err != nil {
+		return nil, err
+	}
+	msg := string(body)
+
+	return func() error {
+		_, err := s.client.Publish(&sns.PublishInput{
+			Message:  &msg,
+			TopicArn: &s.topicARN,
+		})
+		return err
+	}, nil
+}
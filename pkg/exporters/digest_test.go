@@ -0,0 +1,74 @@
+package exporters
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+type mockSNSClient struct {
+	snsiface.SNSAPI
+	message string
+}
+
+func (m *mockSNSClient) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	m.message = *input.Message
+	return &sns.PublishOutput{}, nil
+}
+
+func testDigest() *report.Digest {
+	from := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	return &report.Digest{
+		From: from,
+		To:   from.AddDate(0, 0, 1),
+		Trend: []report.DigestDay{
+			{Date: from, Vulnerable: 1, Findings: map[string]int64{"CRITICAL": 2}},
+			{Date: from.AddDate(0, 0, 1), Vulnerable: 1, Failed: 1, Findings: map[string]int64{}},
+		},
+		New:         []*api.RepositoryInfo{{Name: "team/api"}},
+		SLABreaches: []report.SLABreach{{Repository: &api.RepositoryInfo{Name: "team/api"}, Severity: "CRITICAL", Days: 9}},
+	}
+}
+
+func TestFormatDigestText(t *testing.T) {
+	var p Presentation
+	text := p.formatDigestText(testDigest())
+
+	for _, expected := range []string{
+		"\n" + p.msg().digestNew + "\nteam/api\n",
+		"\n" + p.msg().digestResolved + "\n" + p.msg().digestNone + "\n",
+		"(CRITICAL: 2)\n",
+		"team/api: CRITICAL findings open for 9 days\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Fatalf("Expected digest to contain %q, got:\n%s", expected, text)
+		}
+	}
+}
+
+func TestSNSFormatDigest(t *testing.T) {
+	client := &mockSNSClient{}
+	s := NewSNSExporter("sns", api.NewSNSService(client), "arn:aws:sns:us-east-1:123456789012:ecr-scan")
+
+	send, err := s.FormatDigest(testDigest())
+	if err != nil {
+		t.Fatalf("Error formatting digest: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error publishing digest: %s", err)
+	}
+
+	var digest jsonDigest
+	if err := json.Unmarshal([]byte(client.message), &digest); err != nil {
+		t.Fatalf("Error parsing published digest: %s", err)
+	}
+	if digest.From != "2020-07-01" || len(digest.Trend) != 2 || digest.Trend[0].Findings[0].Count != "2" || len(digest.New) != 1 || digest.SLABreaches[0].Days != 9 {
+		t.Fatalf("Unexpected digest: %+v", digest)
+	}
+}
@@ -0,0 +1,82 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// SeverityDisplay decides how a severity level is presented in the reports
+type SeverityDisplay struct {
+	// Slack emoji put before the level, e.g.: :red_circle:
+	Emoji string `json:"emoji"`
+	// Badge color, e.g.: #e05d44
+	Color string `json:"color"`
+	// Name of the level in Slack, HTML and namespace subtotals
+	Label string `json:"label"`
+}
+
+// defaultSeverityDisplay is used for the levels and fields SEVERITY_DISPLAY leaves out
+var defaultSeverityDisplay = map[string]SeverityDisplay{
+	"CRITICAL":      {Emoji: ":red_circle:", Color: "#e05d44", Label: "CRITICAL"},
+	"HIGH":          {Emoji: ":large_orange_circle:", Color: "#fe7d37", Label: "HIGH"},
+	"MEDIUM":        {Emoji: ":large_yellow_circle:", Color: "#dfb317", Label: "MEDIUM"},
+	"LOW":           {Emoji: ":large_blue_circle:", Color: "#a4a61d", Label: "LOW"},
+	"INFORMATIONAL": {Emoji: ":white_circle:", Color: "#9f9f9f", Label: "INFORMATIONAL"},
+	"UNTRIAGED":     {Emoji: ":grey_question:", Color: "#9f9f9f", Label: "UNTRIAGED"},
+	"UNDEFINED":     {Emoji: ":black_circle:", Color: "#9f9f9f", Label: "UNDEFINED"},
+}
+
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// ParseSeverityDisplay parses a JSON object of severity levels and their presentation, e.g.:
+// {"CRITICAL": {"emoji": ":fire:", "label": "P1"}}. Levels and fields left out keep their defaults.
+func ParseSeverityDisplay(raw string) (map[string]SeverityDisplay, error) {
+	display := make(map[string]SeverityDisplay)
+	for k, v := range defaultSeverityDisplay {
+		display[k] = v
+	}
+	if strings.TrimSpace(raw) == "" {
+		return display, nil
+	}
+
+	var overrides map[string]SeverityDisplay
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("Invalid severity display, expected a JSON object of severity levels: %s", err)
+	}
+	for level, o := range overrides {
+		d, ok := display[level]
+		if !ok {
+			return nil, fmt.Errorf("Invalid severity display, unknown severity %s, expected one of %s", level, strings.Join(severity.SeverityList, ", "))
+		}
+		if o.Emoji != "" {
+			d.Emoji = o.Emoji
+		}
+		if o.Color != "" {
+			if !colorPattern.MatchString(o.Color) {
+				return nil, fmt.Errorf("Invalid severity display color %s of %s, expected #rgb or #rrggbb", o.Color, level)
+			}
+			d.Color = o.Color
+		}
+		if strings.TrimSpace(o.Label) != "" {
+			d.Label = o.Label
+		}
+		display[level] = d
+	}
+	return display, nil
+}
+
+// displayOf returns the presentation of the severity level, the level itself labels unknown ones
+func (p Presentation) displayOf(level string) SeverityDisplay {
+	display := p.SeverityDisplay
+	if display == nil {
+		display = defaultSeverityDisplay
+	}
+	if d, ok := display[level]; ok {
+		return d
+	}
+	return SeverityDisplay{Label: level}
+}
@@ -0,0 +1,59 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSeverityDisplay(t *testing.T) {
+	display, err := ParseSeverityDisplay(`{"CRITICAL": {"emoji": ":fire:", "label": "P1"}, "LOW": {"color": "#ccc"}}`)
+	if err != nil {
+		t.Fatalf("Error parsing severity display: %s", err)
+	}
+	if d := display["CRITICAL"]; d.Emoji != ":fire:" || d.Label != "P1" || d.Color != "#e05d44" {
+		t.Fatalf("Unexpected display of CRITICAL: %+v", d)
+	}
+	if d := display["LOW"]; d.Color != "#ccc" || d.Label != "LOW" {
+		t.Fatalf("Unexpected display of LOW: %+v", d)
+	}
+	if d := display["UNDEFINED"]; d != defaultSeverityDisplay["UNDEFINED"] {
+		t.Fatalf("Unexpected display of UNDEFINED: %+v", d)
+	}
+
+	if display, err := ParseSeverityDisplay(""); err != nil || len(display) != len(defaultSeverityDisplay) {
+		t.Fatalf("Expected the defaults, got: %v, %v", display, err)
+	}
+
+	for _, raw := range []string{
+		`{"SEVERE": {"label": "S"}}`,
+		`{"HIGH": {"color": "orange"}}`,
+		`["HIGH"]`,
+	} {
+		if _, err := ParseSeverityDisplay(raw); err == nil {
+			t.Fatalf("Expected error parsing %s", raw)
+		}
+	}
+}
+
+func TestSeverityDisplayLabels(t *testing.T) {
+	display, err := ParseSeverityDisplay(`{"CRITICAL": {"emoji": "", "label": "P1"}, "HIGH": {"emoji": ":fire:", "color": "#f00"}}`)
+	if err != nil {
+		t.Fatalf("Error parsing severity display: %s", err)
+	}
+	p := Presentation{SeverityDisplay: display}
+
+	if text := p.severityText("CRITICAL"); text != ":red_circle: P1" {
+		t.Fatalf("values not equal, wanting: :red_circle: P1, got: %s", text)
+	}
+	if text := p.severityText("HIGH"); text != ":fire: HIGH" {
+		t.Fatalf("values not equal, wanting: :fire: HIGH, got: %s", text)
+	}
+	if _, color := p.badgeMessage(map[string]int64{"HIGH": 1}); color != "#f00" {
+		t.Fatalf("values not equal, wanting: #f00, got: %s", color)
+	}
+
+	table := p.newHTMLTable("", namespaced())
+	if strings.Join(table.Levels, ",") != "P1,HIGH" {
+		t.Fatalf("Unexpected levels: %v", table.Levels)
+	}
+}
@@ -1,13 +1,21 @@
 package exporters
 
 import (
-	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
 )
 
 // Exporter defines a common interface for different exporters
 type Exporter interface {
 	// Formats message types then returns function which sends formatted messages on invocation
-	Format(filtered []*api.RepositoryInfo, failed []*api.RepositoryInfo) (func() error, error)
+	Format(report *report.Report) (func() error, error)
 	// Retrun exporter name
 	Name() string
 }
+
+// LoggingExporter is an exporter logging while it sends. Exporters outlive the run which built them,
+// so each run sets its own logger before sending.
+type LoggingExporter interface {
+	Exporter
+	SetLogger(l *logger.Logger)
+}
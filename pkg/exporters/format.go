@@ -4,30 +4,34 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
 )
 
 type values struct {
-	Name               string
+	Found              string
 	CountCritical      *int64
 	CountHigh          *int64
 	CountMedium        *int64
 	CountLow           *int64
 	CountInformational *int64
+	CountUntriaged     *int64
 	CountUndefined     *int64
-	Link               string
+	TextLink           string
+	Details            string
+	BaseImage          string
+	Packages           string
+	Layers             string
 }
 
-var (
-	// Vulnerablity list header
-	reportHeadText = fmt.Sprintf("Scan results on %s", time.Now().Format("2006 Jan 02"))
-	// Failed scan list header
-	reportFailedHeadText = "Failed to get scan results from the following repos:"
-	// Message in case no vulnerablity hit the threshold
-	reportClean = "Looks like the tested images have zero vulnerabilities hitting the threshold, good job!"
-)
+// DefaultDateFormat is the layout of the date in the report header
+const DefaultDateFormat = "2006 Jan 02"
 
 func execTmpl(data interface{}, raw string) (bytes.Buffer, error) {
 	tmpl, err := template.New("text formatter").Parse(raw)
@@ -42,29 +46,41 @@ func execTmpl(data interface{}, raw string) (bytes.Buffer, error) {
 	return buffer, nil
 }
 
-func fillTmpl(r *api.RepositoryInfo) (string, error) {
-
+func (p Presentation) fillTmpl(r *api.RepositoryInfo) (string, error) {
+	reported := r.ReportedSeverity()
 	data := values{
-		Name:               r.Name,
-		CountCritical:      r.Severity.Count["CRITICAL"],
-		CountHigh:          r.Severity.Count["HIGH"],
-		CountMedium:        r.Severity.Count["MEDIUM"],
-		CountLow:           r.Severity.Count["LOW"],
-		CountInformational: r.Severity.Count["INFORMATIONAL"],
-		CountUndefined:     r.Severity.Count["UNDEFINED"],
-		Link:               r.Link,
+		Found:              fmt.Sprintf(p.msg().found, r.DisplayName()),
+		CountCritical:      reported.Count["CRITICAL"],
+		CountHigh:          reported.Count["HIGH"],
+		CountMedium:        reported.Count["MEDIUM"],
+		CountLow:           reported.Count["LOW"],
+		CountInformational: reported.Count["INFORMATIONAL"],
+		CountUntriaged:     reported.Count["UNTRIAGED"],
+		CountUndefined:     reported.Count["UNDEFINED"],
+		Details:            p.imageDetails(r),
+		BaseImage:          p.baseImageText(r),
+		Packages:           p.packagesText(r),
+		Layers:             p.layersText(r),
+	}
+	// Redacted repositories have no link
+	if r.Link != "" {
+		data.TextLink = fmt.Sprintf(p.msg().textLink, r.Link)
 	}
 
-	raw := `Vulnerabilities found in {{ .Name }}:
+	raw := `{{ .Found }}
+{{- if .Details }}{{printf "%s" "\n"}}{{ .Details }}{{end}}
+{{- if .BaseImage }}{{printf "%s" "\n"}}{{ .BaseImage }}{{end}}
 {{printf "%s" "\n"}}
 {{- if .CountCritical }}     CRITICAL: {{ .CountCritical }}{{printf "%s" "\n"}}{{end}}
 {{- if .CountHigh }}         HIGH: {{ .CountHigh }}{{printf "%s" "\n"}}{{end}}
 {{- if .CountMedium }}       MEDIUM: {{ .CountMedium }}{{printf "%s" "\n"}}{{end}}
 {{- if .CountLow }}          LOW: {{ .CountLow }}{{printf "%s" "\n"}}{{end}}
 {{- if .CountInformational }}INFORMATIONAL: {{ .CountInformational }}{{printf "%s" "\n"}}{{end}}
+{{- if .CountUntriaged }}    UNTRIAGED: {{ .CountUntriaged }}{{printf "%s" "\n"}}{{end}}
 {{- if .CountUndefined }}    UNDEFINED: {{ .CountUndefined }}{{end}}
-
-View detailed scan results on console ({{ .Link }})
+{{ if .Packages }}{{ .Packages }}{{end}}
+{{- if .Layers }}{{ .Layers }}{{end}}
+{{ if .TextLink }}{{ .TextLink }}{{printf "%s" "\n"}}{{end -}}
 --------------------------------------
 `
 
@@ -77,17 +93,40 @@ View detailed scan results on console ({{ .Link }})
 }
 
 // formats concatenates textual representation of vulnerablities to one string
-func format(repositories []*api.RepositoryInfo) (string, error) {
+func (p Presentation) format(date time.Time, repositories []*api.RepositoryInfo) (string, error) {
 	var buffer bytes.Buffer
-	buffer.WriteString(reportHeadText + "\n")
+	buffer.WriteString(p.headText(date) + "\n")
 
 	if len(repositories) == 0 {
-		buffer.WriteString(reportClean + "\n")
+		buffer.WriteString(p.msg().clean + "\n")
 		return buffer.String(), nil
 	}
 
+	for _, g := range p.groupByNamespace(repositories) {
+		if head := p.groupHead(g); head != "" {
+			buffer.WriteString("\n" + head + "\n")
+		}
+		for _, r := range g.repositories {
+			msg, err := p.fillTmpl(r)
+			if err != nil {
+				return "", err
+			}
+			buffer.WriteString(msg)
+		}
+	}
+	return buffer.String(), nil
+}
+
+// formatPullThroughCache concatenates textual representation of pull through cache vulnerablities to one string
+func (p Presentation) formatPullThroughCache(repositories []*api.RepositoryInfo) (string, error) {
+	var buffer bytes.Buffer
+	if len(repositories) == 0 {
+		return "", nil
+	}
+
+	buffer.WriteString(p.msg().pullThroughCache + "\n")
 	for _, r := range repositories {
-		msg, err := fillTmpl(r)
+		msg, err := p.fillTmpl(r)
 		if err != nil {
 			return "", err
 		}
@@ -96,16 +135,372 @@ func format(repositories []*api.RepositoryInfo) (string, error) {
 	return buffer.String(), nil
 }
 
-// formatFailed creates a list of repositories which has failed scanning
-func formatFailed(repositories []*api.RepositoryInfo) (string, error) {
+// countFindings sums up findings of each severity level across repositories
+func countFindings(repositories []*api.RepositoryInfo) map[string]int64 {
+	findings := make(map[string]int64)
+	for _, r := range repositories {
+		for key, val := range r.Severity.Count {
+			if val != nil {
+				findings[key] += *val
+			}
+		}
+	}
+	return findings
+}
+
+// section is a titled list of repositories in the report
+type section struct {
+	head         string
+	repositories []*api.RepositoryInfo
+	// Repositories are listed in groups by failure cause
+	byCause bool
+	// Category of the findings the section lists, for compliance controls
+	category string
+}
+
+// groupByCause splits failed repositories into sections per failure cause, in the order of report.Causes
+func (p Presentation) groupByCause(repositories []*api.RepositoryInfo) []section {
+	groups := make(map[string][]*api.RepositoryInfo)
+	for _, r := range repositories {
+		cause := r.Cause
+		if _, ok := p.msg().causes[cause]; !ok {
+			cause = report.CauseOther
+		}
+		groups[cause] = append(groups[cause], r)
+	}
+
+	var grouped []section
+	for _, cause := range report.Causes {
+		if len(groups[cause]) > 0 {
+			grouped = append(grouped, section{head: p.msg().causes[cause], repositories: groups[cause]})
+		}
+	}
+	return grouped
+}
+
+// sections returns the repository lists of the report in display order
+func (p Presentation) sections(report *api.Report) []section {
+	return []section{
+		{head: p.msg().resolved, repositories: report.Resolved},
+		{head: p.msg().failed, repositories: report.Failed, byCause: true, category: categoryFailed},
+		{head: p.msg().empty, repositories: report.Empty},
+		{head: p.msg().notScanned, repositories: report.NotScanned, category: categoryNotScanned},
+		{head: p.msg().scanOnPushOff, repositories: report.ScanOnPushDisabled, category: categoryScanOnPush},
+		{head: p.msg().notCovered, repositories: report.NotCovered, category: categoryNotCovered},
+		{head: p.msg().public, repositories: report.Public, category: categoryPublic},
+		{head: p.msg().stale, repositories: report.Stale, category: categoryStale},
+		{head: p.msg().untagged, repositories: report.Untagged, category: categoryUntagged},
+		{head: p.msg().noLifecycle, repositories: report.NoLifecyclePolicy, category: categoryNoLifecycle},
+		{head: p.msg().snoozeExpiring, repositories: report.SnoozeExpiring},
+		{head: p.msg().suppressExpiring, repositories: report.SuppressionExpiring},
+		{head: p.msg().overdue, repositories: overdue(report.Filtered)},
+	}
+}
+
+// overdue returns the repositories vulnerable for longer than the escalation period
+func overdue(repositories []*api.RepositoryInfo) []*api.RepositoryInfo {
+	var ret []*api.RepositoryInfo
+	for _, r := range repositories {
+		if r.Overdue {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// pushedText returns when the image of the repository was pushed, empty when unknown
+func (p Presentation) pushedText(r *api.RepositoryInfo) string {
+	if r.PushedAt.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf(p.msg().pushed, r.PushedAt.In(p.location()).Format(p.dateFormat()))
+}
+
+// formatSize returns a number of bytes in binary units, e.g.: 1.5 GiB
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// imageRef returns the tag and the short digest of the image, e.g.: latest@sha256:0123456789ab, empty without a digest
+func imageRef(r *api.RepositoryInfo) string {
+	if r.Digest == "" {
+		return ""
+	}
+	ref := "sha256:" + shortDigest(r.Digest)
+	if r.Tag != "" {
+		ref = r.Tag + "@" + ref
+	}
+	return ref
+}
+
+// imageDetails returns the image reference, the registry, the push and scan dates and the regions of the image,
+// empty when none is known
+func (p Presentation) imageDetails(r *api.RepositoryInfo) string {
+	var details []string
+	if ref := imageRef(r); ref != "" {
+		details = append(details, ref)
+	}
+	if r.RegistryID != "" {
+		details = append(details, fmt.Sprintf(p.msg().account, r.RegistryID))
+	}
+	if pushed := p.pushedText(r); pushed != "" {
+		details = append(details, pushed)
+	}
+	if !r.ScanCompletedAt.IsZero() {
+		details = append(details, fmt.Sprintf(p.msg().scanned, r.ScanCompletedAt.In(p.location()).Format(p.dateFormat())))
+	}
+	if len(r.Sources) > 0 {
+		details = append(details, p.sourcesText(r.Sources))
+	}
+	if len(r.Regions) > 0 {
+		details = append(details, strings.Join(r.Regions, ", "))
+	}
+	return strings.Join(details, ", ")
+}
+
+// sourcesText returns the findings each merged source listed, by source name, e.g.: found by ecr 12 + trivy-s3 15
+func (p Presentation) sourcesText(sources map[string]int) string {
+	var names []string
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s %d", name, sources[name]))
+	}
+	return fmt.Sprintf(p.msg().sources, strings.Join(parts, " + "))
+}
+
+// baseImageText returns the base image of the repository's image and the findings it brings, empty when unknown
+func (p Presentation) baseImageText(r *api.RepositoryInfo) string {
+	if r.BaseImage == "" {
+		return ""
+	}
+	text := fmt.Sprintf(p.msg().baseImage, r.BaseImage)
+	if r.BaseImageFindings+r.ApplicationFindings > 0 {
+		text += " (" + fmt.Sprintf(p.msg().attribution, r.BaseImageFindings, r.ApplicationFindings) + ")"
+	}
+	return text
+}
+
+// packagesText returns the reported findings of OS and language packages, a line each, empty when not counted
+func (p Presentation) packagesText(r *api.RepositoryInfo) string {
+	var buffer bytes.Buffer
+	for _, p := range []struct {
+		format string
+		matrix severity.Matrix
+	}{
+		{format: p.msg().osPackages, matrix: r.OSPackages},
+		{format: p.msg().languagePackages, matrix: r.LanguagePackages},
+	} {
+		reported := p.matrix.AtLeast(r.MinimumSeverity)
+		var counts []string
+		for _, key := range severity.SeverityList {
+			if val, ok := reported.Count[key]; ok {
+				counts = append(counts, fmt.Sprintf("%s %d", key, *val))
+			}
+		}
+		if len(counts) > 0 {
+			buffer.WriteString(fmt.Sprintf(p.format, strings.Join(counts, ", ")) + "\n")
+		}
+	}
+	return buffer.String()
+}
+
+// layerPackages is how many packages are named per layer, the SNS payload lists every one of them
+const layerPackages = 3
+
+// layersText returns the layers which introduced vulnerable packages, a line each with the build instruction
+// of the layer when known, e.g.: openssl introduced in layer 2 (RUN apk add openssl). Empty when not attributed.
+func (p Presentation) layersText(r *api.RepositoryInfo) string {
+	var buffer bytes.Buffer
+	for _, l := range r.Layers {
+		packages := l.Packages
+		if len(packages) > layerPackages {
+			packages = append(append([]string{}, packages[:layerPackages]...), "…")
+		}
+		buffer.WriteString(fmt.Sprintf(p.msg().layer, strings.Join(packages, ", "), l.Index))
+		if l.Instruction != "" {
+			buffer.WriteString(" (" + l.Instruction + ")")
+		}
+		buffer.WriteString("\n")
+	}
+	return buffer.String()
+}
+
+// listName returns the name a repository is listed with, followed by the image details, untagged images and snooze when known
+func (p Presentation) listName(r *api.RepositoryInfo) string {
+	var details []string
+	if image := p.imageDetails(r); image != "" {
+		details = append(details, image)
+	}
+	if r.UntaggedImages > 0 {
+		details = append(details, fmt.Sprintf(p.msg().untaggedCount, r.UntaggedImages, formatSize(r.UntaggedBytes)))
+	}
+	if r.Snooze != nil {
+		details = append(details, p.snoozeText(r.Snooze))
+	}
+	if r.Suppression != nil {
+		details = append(details, p.suppressionText(r.Suppression))
+	}
+	if len(r.Fixed) > 0 {
+		details = append(details, p.fixedText(r.Fixed))
+	}
+	if r.Denied != nil {
+		details = append(details, p.deniedText(r))
+	}
+	if len(details) == 0 {
+		return r.DisplayName()
+	}
+	return fmt.Sprintf("%s (%s)", r.DisplayName(), strings.Join(details, ", "))
+}
+
+// fixedVulnerabilities is how many fixed vulnerabilities are named per repository, the SNS payload lists every one of them
+const fixedVulnerabilities = 5
+
+// fixedText returns the vulnerabilities fixed since the previous report, e.g.: fixed CVE-2023-0464, CVE-2023-0465
+func (p Presentation) fixedText(ids []string) string {
+	if len(ids) > fixedVulnerabilities {
+		ids = append(append([]string{}, ids[:fixedVulnerabilities]...), "…")
+	}
+	return fmt.Sprintf(p.msg().fixed, strings.Join(ids, ", "))
+}
+
+// deniedText returns the permission a failed repository was missing, e.g.: missing ecr:DescribeImageScanFindings.
+// The resource is left out when it is the repository itself.
+func (p Presentation) deniedText(r *api.RepositoryInfo) string {
+	if r.Denied.Resource == "" || strings.HasSuffix(r.Denied.Resource, ":repository/"+r.Name) {
+		return fmt.Sprintf(p.msg().denied, r.Denied.Action)
+	}
+	return fmt.Sprintf(p.msg().deniedOn, r.Denied.Action, r.Denied.Resource)
+}
+
+// snoozeText returns the snoozed vulnerability, the expiry and the reason of the snooze
+func (p Presentation) snoozeText(s *report.Snooze) string {
+	var parts []string
+	if s.Vulnerability != "" {
+		parts = append(parts, s.Vulnerability)
+	}
+	parts = append(parts, fmt.Sprintf(p.msg().snoozedUntil, s.Until.In(p.location()).Format(p.dateFormat())))
+	if s.Reason != "" {
+		parts = append(parts, s.Reason)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// suppressionText returns the expiry and the reason of the suppression
+func (p Presentation) suppressionText(s *report.Suppression) string {
+	text := fmt.Sprintf(p.msg().suppressedUntil, s.Until.In(p.location()).Format(p.dateFormat()))
+	if s.Reason != "" {
+		text += ", " + s.Reason
+	}
+	return text
+}
+
+// formatRun returns a note identifying the run which produced the report, empty when it has no run ID
+func (p Presentation) formatRun(report *api.Report) string {
+	if report.RunID == "" {
+		return ""
+	}
+	return fmt.Sprintf(p.msg().run, report.RunID, report.Fingerprint()) + "\n"
+}
+
+// formatPartial returns a note about repositories left out when the report was cut short or held back
+func (p Presentation) formatPartial(report *api.Report) string {
+	var buffer bytes.Buffer
+	if report.NotProcessed > 0 {
+		buffer.WriteString(fmt.Sprintf(p.msg().partial, report.NotProcessed) + "\n")
+	}
+	if report.Interrupted {
+		buffer.WriteString(p.msg().interrupted + "\n")
+	}
+	if len(report.Pending) > 0 {
+		buffer.WriteString(fmt.Sprintf(p.msg().pending, len(report.Pending)) + "\n")
+	}
+	return buffer.String()
+}
+
+// formatLifecyclePolicy returns the suggested lifecycle policy under its header, empty when not suggested
+func (p Presentation) formatLifecyclePolicy(report *api.Report) string {
+	if report.SuggestedLifecyclePolicy == "" {
+		return ""
+	}
+	return p.msg().suggestedPolicy + "\n" + report.SuggestedLifecyclePolicy + "\n"
+}
+
+// formatScanType returns a note about the registry scan type when it's worth mentioning
+func (p Presentation) formatScanType(scanType string) string {
+	if scanType == ecr.ScanTypeEnhanced {
+		return p.msg().enhancedNote + "\n"
+	}
+	return ""
+}
+
+// formatList creates a list of repository names under the given header
+func (p Presentation) formatList(head string, repositories []*api.RepositoryInfo) string {
 	var buffer bytes.Buffer
 	if len(repositories) == 0 {
-		return "", nil
+		return ""
 	}
 
-	buffer.WriteString(reportFailedHeadText + "\n")
+	buffer.WriteString(head + "\n")
 	for _, r := range repositories {
-		buffer.WriteString(r.Name + "\n")
+		buffer.WriteString(p.listName(r) + "\n")
+	}
+	return buffer.String()
+}
+
+// formatSection creates the list of a section, grouping repositories by failure cause when needed
+func (p Presentation) formatSection(s section) string {
+	if !s.byCause || len(s.repositories) == 0 {
+		return p.formatList(s.head, s.repositories)
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(s.head + "\n")
+	for _, group := range p.groupByCause(s.repositories) {
+		buffer.WriteString(p.formatList(group.head, group.repositories))
+	}
+	return buffer.String()
+}
+
+// FormatText renders the report as plain text, the way the log exporter prints it
+func (p Presentation) FormatText(report *api.Report) (string, error) {
+	return p.formatReport(report)
+}
+
+// formatReport concatenates every section of the report to one string
+func (p Presentation) formatReport(report *api.Report) (string, error) {
+	var buffer bytes.Buffer
+
+	filteredMsg, err := p.format(report.Date, report.Filtered)
+	if err != nil {
+		return "", err
+	}
+	buffer.WriteString(filteredMsg)
+	buffer.WriteString(p.formatPartial(report))
+
+	pullThroughMsg, err := p.formatPullThroughCache(report.PullThroughCache)
+	if err != nil {
+		return "", err
+	}
+	buffer.WriteString(pullThroughMsg)
+	buffer.WriteString(p.formatScanType(report.ScanType))
+
+	for _, s := range p.sections(report) {
+		buffer.WriteString(p.formatSection(s))
 	}
+	buffer.WriteString(p.formatLifecyclePolicy(report))
+	buffer.WriteString(p.formatRun(report))
 	return buffer.String(), nil
 }
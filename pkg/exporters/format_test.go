@@ -2,21 +2,25 @@ package exporters
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+	"github.com/nlopes/slack"
 )
 
 func TestTmpl(t *testing.T) {
 	expected := `Vulnerabilities found in TestRepo/Test1:`
 
 	data := values{
-		Name: "TestRepo/Test1",
+		Found: "Vulnerabilities found in TestRepo/Test1:",
 	}
 
-	head, err := execTmpl(data, `Vulnerabilities found in {{ .Name }}:`)
+	head, err := execTmpl(data, `{{ .Found }}`)
 	if err != nil {
 		t.Fatalf("Runtime error formatting text: %s", err)
 	}
@@ -42,6 +46,7 @@ var input = api.RepositoryInfo{
 }
 
 func TestTextFormatSingle(t *testing.T) {
+	var p Presentation
 
 	expectedMsg := `Vulnerabilities found in TestRepo/Test1:
 
@@ -56,7 +61,7 @@ View detailed scan results on console (https://console.aws.amazon.com/ecr/reposi
 --------------------------------------
 `
 
-	msg, err := fillTmpl(&input)
+	msg, err := p.fillTmpl(&input)
 	if err != nil {
 		t.Fatalf("Runtime error `formatt`ing text: %s", err)
 	}
@@ -71,3 +76,401 @@ View detailed scan results on console (https://console.aws.amazon.com/ecr/reposi
 		t.Fatalf("Error `formatt`ing text => wanted: \n%v, got: \n%v", expectedMsg, msg)
 	}
 }
+
+func TestTextFormatMinimumSeverity(t *testing.T) {
+	var p Presentation
+	expectedMsg := `Vulnerabilities found in TestRepo/Test1:
+
+     CRITICAL: 1
+         HIGH: 2
+
+
+View detailed scan results on console (https://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1)
+--------------------------------------
+`
+
+	filtered := input
+	filtered.MinimumSeverity = "HIGH"
+
+	msg, err := p.fillTmpl(&filtered)
+	if err != nil {
+		t.Fatalf("Runtime error formatting text: %s", err)
+	}
+
+	if !reflect.DeepEqual(expectedMsg, msg) {
+		t.Fatalf("Error formatting text => wanted: \n%v, got: \n%v", expectedMsg, msg)
+	}
+}
+
+func TestReportDate(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("Time zone database is not available: %s", err)
+	}
+
+	// 2020-07-18 20:00 UTC is already the next day in Tokyo
+	date := time.Date(2020, 7, 18, 20, 0, 0, 0, time.UTC)
+
+	if expected, head := "Scan results on 2020 Jul 18", (Presentation{}).headText(date); head != expected {
+		t.Fatalf("values not equal, wanting: %s, got: %s", expected, head)
+	}
+
+	p := Presentation{DateFormat: "2006-01-02 (Mon)", Location: tokyo}
+	if expected, head := "Scan results on 2020-07-19 (Sun)", p.headText(date); head != expected {
+		t.Fatalf("values not equal, wanting: %s, got: %s", expected, head)
+	}
+}
+
+func TestFormatReport(t *testing.T) {
+	var p Presentation
+	expected := "Scan results on 2020 Jul 18\n" + p.msg().clean + "\n" +
+		p.msg().enhancedNote + "\n" +
+		p.msg().failed + "\n" + p.msg().causes[report.CauseAccessDenied] + "\nTestRepo/Failed1\n" +
+		p.msg().empty + "\nTestRepo/Empty1\nTestRepo/Empty2\n" +
+		p.msg().notScanned + "\nTestRepo/NotScanned1\n" +
+		p.msg().notCovered + "\nTestRepo/NotCovered1\n" +
+		p.msg().public + "\nTestRepo/Public1\n"
+
+	report := &api.Report{
+		Date:       time.Date(2020, 7, 18, 0, 0, 0, 0, time.UTC),
+		ScanType:   "ENHANCED",
+		Failed:     []*api.RepositoryInfo{{Name: "TestRepo/Failed1", Cause: report.CauseAccessDenied}},
+		Empty:      []*api.RepositoryInfo{{Name: "TestRepo/Empty1"}, {Name: "TestRepo/Empty2"}},
+		NotScanned: []*api.RepositoryInfo{{Name: "TestRepo/NotScanned1"}},
+		NotCovered: []*api.RepositoryInfo{{Name: "TestRepo/NotCovered1"}},
+		Public:     []*api.RepositoryInfo{{Name: "TestRepo/Public1"}},
+	}
+
+	msg, err := p.formatReport(report)
+	if err != nil {
+		t.Fatalf("Runtime error formatting report: %s", err)
+	}
+
+	if !reflect.DeepEqual(expected, msg) {
+		t.Fatalf("Error formatting report => wanted: \n%v, got: \n%v", expected, msg)
+	}
+}
+
+func TestFormatPullThroughCache(t *testing.T) {
+	var p Presentation
+	msg, err := p.formatPullThroughCache(nil)
+	if err != nil {
+		t.Fatalf("Runtime error formatting pull through cache repos: %s", err)
+	}
+	if msg != "" {
+		t.Fatalf("Expected no pull through cache section, got: \n%s", msg)
+	}
+
+	msg, err = p.formatPullThroughCache([]*api.RepositoryInfo{&input})
+	if err != nil {
+		t.Fatalf("Runtime error formatting pull through cache repos: %s", err)
+	}
+
+	repoMsg, _ := p.fillTmpl(&input)
+	expected := p.msg().pullThroughCache + "\n" + repoMsg
+	if !reflect.DeepEqual(expected, msg) {
+		t.Fatalf("Error formatting pull through cache repos => wanted: \n%v, got: \n%v", expected, msg)
+	}
+}
+
+func TestFormatListPlatform(t *testing.T) {
+	var p Presentation
+	expected := p.msg().failed + "\nTestRepo/Test1\nTestRepo/MultiArch (linux/arm64)\n"
+
+	msg := p.formatList(p.msg().failed, []*api.RepositoryInfo{
+		{Name: "TestRepo/Test1"},
+		{Name: "TestRepo/MultiArch", Platform: "linux/arm64"},
+	})
+	if !reflect.DeepEqual(expected, msg) {
+		t.Fatalf("Error formatting list => wanted: \n%v, got: \n%v", expected, msg)
+	}
+}
+
+func TestFormatSectionByCause(t *testing.T) {
+	var p Presentation
+	s := section{head: p.msg().failed, byCause: true, repositories: []*api.RepositoryInfo{
+		{Name: "TestRepo/Throttled", Cause: report.CauseThrottling},
+		{Name: "TestRepo/NoTag", Cause: report.CauseImageNotFound},
+		{Name: "TestRepo/Unknown"},
+	}}
+
+	expected := p.msg().failed + "\n" +
+		p.msg().causes[report.CauseImageNotFound] + "\nTestRepo/NoTag\n" +
+		p.msg().causes[report.CauseThrottling] + "\nTestRepo/Throttled\n" +
+		p.msg().causes[report.CauseOther] + "\nTestRepo/Unknown\n"
+	if msg := p.formatSection(s); msg != expected {
+		t.Fatalf("Error formatting section => wanted: \n%v, got: \n%v", expected, msg)
+	}
+}
+
+func TestFormatDenied(t *testing.T) {
+	var p Presentation
+	s := section{head: p.msg().failed, byCause: true, repositories: []*api.RepositoryInfo{
+		{Name: "team-a/api", Cause: report.CauseAccessDenied, Denied: &report.Denial{
+			Action: "ecr:DescribeImageScanFindings", Resource: "arn:aws:ecr:us-east-1:123456789012:repository/team-a/api",
+		}},
+		{Name: "team-a/web", Cause: report.CauseAccessDenied, Denied: &report.Denial{
+			Action: "kms:Decrypt", Resource: "arn:aws:kms:us-east-1:123456789012:key/1234",
+		}},
+		{Name: "team-b/api", Cause: report.CauseAccessDenied},
+	}}
+
+	expected := p.msg().failed + "\n" + p.msg().causes[report.CauseAccessDenied] + "\n" +
+		"team-a/api (missing ecr:DescribeImageScanFindings)\n" +
+		"team-a/web (missing kms:Decrypt on arn:aws:kms:us-east-1:123456789012:key/1234)\n" +
+		"team-b/api\n"
+	if msg := p.formatSection(s); msg != expected {
+		t.Fatalf("Error formatting section => wanted: \n%v, got: \n%v", expected, msg)
+	}
+}
+
+func TestFormatPartial(t *testing.T) {
+	var p Presentation
+	if note := p.formatPartial(&api.Report{}); note != "" {
+		t.Fatalf("Expected no note for a complete report, got: %s", note)
+	}
+
+	msg, err := p.formatReport(&api.Report{NotProcessed: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(msg, "Partial report, 3 repos were not processed before the time limit.") {
+		t.Fatalf("Expected the partial report note, got: %s", msg)
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	var p Presentation
+	msg, err := p.formatReport(&api.Report{
+		Filtered: []*api.RepositoryInfo{{Name: "TestRepo/Old", Overdue: true}, {Name: "TestRepo/Recent"}},
+		Pending:  []*api.RepositoryInfo{{Name: "TestRepo/New"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(msg, p.msg().overdue+"\nTestRepo/Old\n") || strings.Contains(msg, "TestRepo/New") {
+		t.Fatalf("Expected only the overdue repository in the overdue section, got: %s", msg)
+	}
+	if !strings.Contains(msg, "1 repos became vulnerable recently, they are reported once the grace period is over.") {
+		t.Fatalf("Expected the grace period note, got: %s", msg)
+	}
+}
+
+func TestFormatRun(t *testing.T) {
+	var p Presentation
+	if note := p.formatRun(&api.Report{}); note != "" {
+		t.Fatalf("Expected no note without a run ID, got: %s", note)
+	}
+
+	r := &api.Report{RunID: "1a2b3c4d"}
+	expected := "Run 1a2b3c4d, report " + r.Hash()[:12]
+	msg, err := p.formatReport(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasSuffix(msg, expected+"\n") {
+		t.Fatalf("Expected the report to end with: %s, got: %s", expected, msg)
+	}
+
+	head := slackService.messages(r)[0].BlockSet[0].(*slack.SectionBlock).Text.Text
+	if !strings.HasSuffix(head, "\n_"+expected+"_") {
+		t.Fatalf("Expected the Slack header to quote the run, got: %s", head)
+	}
+}
+
+func TestFormatPushedAt(t *testing.T) {
+	var p Presentation
+	pushed := input
+	pushed.PushedAt = time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	msg, err := p.fillTmpl(&pushed)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(msg, "Vulnerabilities found in TestRepo/Test1:\npushed 2020 Jan 02\n\n     CRITICAL: 1\n") {
+		t.Fatalf("Expected the push date below the header, got: %s", msg)
+	}
+
+	msg, err = p.formatReport(&api.Report{Stale: []*api.RepositoryInfo{{Name: "TestRepo/Old", PushedAt: pushed.PushedAt}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "Images in the following repos haven't been pushed for a long time, their base images may be unpatched:\nTestRepo/Old (pushed 2020 Jan 02)\n"
+	if !strings.Contains(msg, expected) {
+		t.Fatalf("Expected the stale image list, got: %s", msg)
+	}
+}
+
+func TestFormatImageDetails(t *testing.T) {
+	var p Presentation
+	image := input
+	image.Tag = "v1.2.0"
+	image.Digest = "sha256:0123456789abcdef0123456789abcdef"
+	image.RegistryID = "123456789012"
+	image.ScanCompletedAt = time.Date(2020, 1, 3, 8, 0, 0, 0, time.UTC)
+
+	msg, err := p.fillTmpl(&image)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(msg, "Vulnerabilities found in TestRepo/Test1:\nv1.2.0@sha256:0123456789ab, account 123456789012, scanned 2020 Jan 03\n") {
+		t.Fatalf("Expected the image details below the header, got: %s", msg)
+	}
+
+	image.Sources = map[string]int{"trivy-s3": 15, "ecr": 12}
+	if details := p.imageDetails(&image); !strings.HasSuffix(details, ", scanned 2020 Jan 03, found by ecr 12 + trivy-s3 15") {
+		t.Fatalf("Expected the findings of each source, got: %s", details)
+	}
+
+	if details := p.imageDetails(&api.RepositoryInfo{Name: "TestRepo/Failed", Tag: "latest"}); details != "" {
+		t.Fatalf("Expected no details without a digest, got: %s", details)
+	}
+}
+
+func TestFormatUntagged(t *testing.T) {
+	var p Presentation
+	msg, err := p.formatReport(&api.Report{Untagged: []*api.RepositoryInfo{
+		{Name: "TestRepo/Build", UntaggedImages: 42, UntaggedBytes: 3 * 1024 * 1024 * 1024 / 2},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(msg, "TestRepo/Build (42 untagged images, 1.5 GiB)\n") {
+		t.Fatalf("Expected the untagged image counts, got: %s", msg)
+	}
+
+	for size, expected := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 * 1024 * 1024: "5.0 MiB"} {
+		if formatted := formatSize(size); formatted != expected {
+			t.Fatalf("values are not equal, wanting: %s, got: %s", expected, formatted)
+		}
+	}
+}
+
+func TestFormatSuppressionExpiring(t *testing.T) {
+	var p Presentation
+	msg, err := p.formatReport(&api.Report{SuppressionExpiring: []*api.RepositoryInfo{
+		{Name: "team-b/migration-*", Suppression: &report.Suppression{Repository: "team-b/migration-*", Until: time.Date(2020, 7, 25, 0, 0, 0, 0, time.UTC), Reason: "replaced by team-b/api"}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(msg, "The following suppressions expire soon, the repos are reported again afterwards:\nteam-b/migration-* (suppressed until 2020 Jul 25, replaced by team-b/api)\n") {
+		t.Fatalf("Expected the expiring suppression, got: %s", msg)
+	}
+}
+
+func TestFormatResolved(t *testing.T) {
+	var p Presentation
+	msg, err := p.formatReport(&api.Report{Resolved: []*api.RepositoryInfo{
+		{Name: "team-a/api"},
+		{Name: "team-a/web", Fixed: []string{"CVE-2023-0464", "CVE-2023-0465"}},
+		{Name: "team-b/api", Fixed: []string{"CVE-1", "CVE-2", "CVE-3", "CVE-4", "CVE-5", "CVE-6"}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "Fixed since the last run, well done:\nteam-a/api\nteam-a/web (fixed CVE-2023-0464, CVE-2023-0465)\nteam-b/api (fixed CVE-1, CVE-2, CVE-3, CVE-4, CVE-5, …)\n"
+	if !strings.Contains(msg, expected) {
+		t.Fatalf("Expected the resolved repositories, got: %s", msg)
+	}
+}
+
+func TestFormatLifecyclePolicy(t *testing.T) {
+	var p Presentation
+	if policy := p.formatLifecyclePolicy(&api.Report{}); policy != "" {
+		t.Fatalf("Expected no suggested policy, got: %s", policy)
+	}
+
+	msg, err := p.formatReport(&api.Report{
+		NoLifecyclePolicy:        []*api.RepositoryInfo{{Name: "TestRepo/Build"}},
+		SuggestedLifecyclePolicy: api.SuggestedLifecyclePolicy,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(msg, "The following repos have no lifecycle policy:\nTestRepo/Build\n") {
+		t.Fatalf("Expected the repositories without lifecycle policy, got: %s", msg)
+	}
+	if !strings.HasSuffix(msg, api.SuggestedLifecyclePolicy+"\n") {
+		t.Fatalf("Expected the suggested lifecycle policy, got: %s", msg)
+	}
+}
+
+func TestFormatRegions(t *testing.T) {
+	var p Presentation
+	replicated := input
+	replicated.Regions = []string{"eu-west-1", "us-east-1"}
+
+	msg, err := p.fillTmpl(&replicated)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(msg, "Vulnerabilities found in TestRepo/Test1:\neu-west-1, us-east-1\n\n") {
+		t.Fatalf("Expected the regions below the header, got: %s", msg)
+	}
+}
+
+func TestFormatBaseImage(t *testing.T) {
+	var p Presentation
+	built := input
+	built.BaseImage = "golden/alpine:3.18"
+	built.BaseImageFindings = 12
+	built.ApplicationFindings = 3
+
+	msg, err := p.fillTmpl(&built)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "Vulnerabilities found in TestRepo/Test1:\nBase image: golden/alpine:3.18 (12 findings in base image layers, 3 in application layers)\n\n"
+	if !strings.HasPrefix(msg, expected) {
+		t.Fatalf("Expected the base image below the header, got: %s", msg)
+	}
+
+	built.BaseImageFindings, built.ApplicationFindings = 0, 0
+	if text := p.baseImageText(&built); text != "Base image: golden/alpine:3.18" {
+		t.Fatalf("Expected the base image without attribution, got: %s", text)
+	}
+}
+
+func TestFormatPackageTypes(t *testing.T) {
+	var p Presentation
+	split := input
+	split.MinimumSeverity = "HIGH"
+	split.OSPackages = severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(1), "HIGH": aws.Int64(1), "LOW": aws.Int64(4)}}
+	split.LanguagePackages = severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(1)}}
+
+	msg, err := p.fillTmpl(&split)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "OS packages: CRITICAL 1, HIGH 1\nLanguage packages (pip, npm, maven...): HIGH 1\n\nView detailed scan results"
+	if !strings.Contains(msg, expected) {
+		t.Fatalf("Expected the findings per package type, got: %s", msg)
+	}
+
+	if text := p.packagesText(&input); text != "" {
+		t.Fatalf("Expected no package types when not counted, got: %s", text)
+	}
+}
+
+func TestFormatLayers(t *testing.T) {
+	var p Presentation
+	layered := input
+	layered.Layers = []report.Layer{
+		{Index: 1, Digest: "sha256:alpine", Findings: 1, Packages: []string{"busybox"}},
+		{Index: 4, Digest: "sha256:openssl", Instruction: "RUN apk add openssl", Findings: 5, Packages: []string{"libcrypto3", "libssl3", "openssl", "openssl-dev", "zlib"}},
+	}
+
+	msg, err := p.fillTmpl(&layered)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "busybox introduced in layer 1\nlibcrypto3, libssl3, openssl, … introduced in layer 4 (RUN apk add openssl)\n\nView detailed scan results"
+	if !strings.Contains(msg, expected) {
+		t.Fatalf("Expected the layers introducing the packages, got: %s", msg)
+	}
+
+	if text := p.layersText(&input); text != "" {
+		t.Fatalf("Expected no layers when not attributed, got: %s", text)
+	}
+}
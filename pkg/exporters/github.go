@@ -0,0 +1,189 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+const (
+	githubStatusContext = "ecr-scan"
+	// GitHub rejects longer commit status descriptions
+	githubDescriptionLimit = 140
+)
+
+// GitHubExporter publishes a commit status on the commit each image was built from
+type GitHubExporter struct {
+	Presentation
+
+	client       *http.Client
+	name         string
+	url          string
+	token        string
+	repositories map[string]string
+}
+
+type commitStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description"`
+	Context     string `json:"context"`
+}
+
+// commitTarget identifies the commit a status is published on
+type commitTarget struct {
+	repository string
+	revision   string
+}
+
+// ParseGitHubRepositories parses a JSON object mapping ECR repositories to GitHub repositories, e.g.: {"team/app": "example/app"}
+func ParseGitHubRepositories(raw string) (map[string]string, error) {
+	repositories := map[string]string{}
+	if raw == "" {
+		return repositories, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &repositories); err != nil {
+		return nil, fmt.Errorf("Invalid GitHub repositories %q, expected a JSON object of owner/repository names: %s", raw, err)
+	}
+	return repositories, nil
+}
+
+// NewGitHubExporter creates an exporter for the GitHub API at url. Images of ECR repositories missing from
+// repositories are attributed to the GitHub repository in their source annotation.
+func NewGitHubExporter(name string, url string, token string, repositories map[string]string) *GitHubExporter {
+	return &GitHubExporter{
+		client:       &http.Client{Timeout: 10 * time.Second},
+		name:         name,
+		url:          strings.TrimSuffix(url, "/"),
+		token:        token,
+		repositories: repositories,
+	}
+}
+
+// Name .
+func (g GitHubExporter) Name() string {
+	return g.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (g GitHubExporter) Format(report *api.Report) (func() error, error) {
+	statuses := g.statuses(report)
+
+	return func() error {
+		targets := make([]commitTarget, 0, len(statuses))
+		for target := range statuses {
+			targets = append(targets, target)
+		}
+		sort.Slice(targets, func(i, j int) bool {
+			return targets[i].repository+targets[i].revision < targets[j].repository+targets[j].revision
+		})
+
+		// A failing repository doesn't keep the statuses of the others from being published
+		var failed []string
+		for _, target := range targets {
+			if err := g.publish(target, statuses[target]); err != nil {
+				failed = append(failed, fmt.Sprintf("%s@%s: %s", target.repository, target.revision, err))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("Error publishing %d of %d commit statuses: %s", len(failed), len(targets), strings.Join(failed, "; "))
+		}
+		return nil
+	}, nil
+}
+
+// statuses decides the status of each commit images of the report were built from.
+// The commit fails when any image built from it has findings hitting the threshold.
+func (g GitHubExporter) statuses(report *api.Report) map[commitTarget]commitStatus {
+	statuses := make(map[commitTarget]commitStatus)
+
+	for _, r := range report.Clean {
+		if target, ok := g.target(r); ok {
+			statuses[target] = commitStatus{
+				State:       "success",
+				Description: "No findings hitting the severity threshold",
+				Context:     githubStatusContext,
+			}
+		}
+	}
+
+	counts := worstCounts(report)
+	for _, r := range append(append([]*api.RepositoryInfo{}, report.Filtered...), report.PullThroughCache...) {
+		if target, ok := g.target(r); ok {
+			message, _ := g.badgeMessage(counts[r.Name])
+			description := "Findings hitting the severity threshold: " + message
+			if len(description) > githubDescriptionLimit {
+				description = description[:githubDescriptionLimit]
+			}
+			statuses[target] = commitStatus{
+				State:       "failure",
+				TargetURL:   r.Link,
+				Description: description,
+				Context:     githubStatusContext,
+			}
+		}
+	}
+	return statuses
+}
+
+// target returns the commit the image was built from, ok is false when it isn't known
+func (g GitHubExporter) target(r *api.RepositoryInfo) (commitTarget, bool) {
+	if r.Revision == "" {
+		return commitTarget{}, false
+	}
+	if repository, ok := g.repositories[r.Name]; ok {
+		return commitTarget{repository: repository, revision: r.Revision}, true
+	}
+	if repository, ok := sourceRepository(r.Source); ok {
+		return commitTarget{repository: repository, revision: r.Revision}, true
+	}
+	return commitTarget{}, false
+}
+
+// sourceRepository returns the owner/repository name of a repository URL, e.g.: https://github.com/example/app.git
+func sourceRepository(source string) (string, bool) {
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0] + "/" + parts[1], true
+}
+
+// publish creates the commit status through the GitHub API
+func (g GitHubExporter) publish(target commitTarget, status commitStatus) error {
+	body, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/repos/%s/statuses/%s", g.url, target.repository, target.revision), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+g.token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("GitHub responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
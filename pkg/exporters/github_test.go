@@ -0,0 +1,102 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+func TestGitHubSend(t *testing.T) {
+	received := make(map[string]commitStatus)
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status commitStatus
+		json.NewDecoder(r.Body).Decode(&status)
+		received[r.URL.Path] = status
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	report := &api.Report{
+		Filtered: []*api.RepositoryInfo{
+			{
+				Name:     "team/app",
+				Link:     "https://console.aws.amazon.com/ecr/app",
+				Revision: "abc123",
+				Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(2), "HIGH": aws.Int64(5)}},
+			},
+			// Images without a known commit are skipped
+			{Name: "team/legacy", Severity: severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(1)}}},
+		},
+		Clean: []*api.RepositoryInfo{
+			{Name: "team/worker", Revision: "def456", Source: "https://github.com/example/worker.git"},
+		},
+	}
+
+	g := NewGitHubExporter("github", server.URL, "secret", map[string]string{"team/app": "example/app"})
+	send, err := g.Format(report)
+	if err != nil {
+		t.Fatalf("Error formatting statuses: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error publishing statuses: %s", err)
+	}
+
+	expected := map[string]commitStatus{
+		"/repos/example/app/statuses/abc123": {
+			State:       "failure",
+			TargetURL:   "https://console.aws.amazon.com/ecr/app",
+			Description: "Findings hitting the severity threshold: critical: 2, high: 5",
+			Context:     "ecr-scan",
+		},
+		"/repos/example/worker/statuses/def456": {
+			State:       "success",
+			Description: "No findings hitting the severity threshold",
+			Context:     "ecr-scan",
+		},
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, received)
+	}
+	if auth != "Bearer secret" {
+		t.Fatalf("Wrong authorization header, got => %s", auth)
+	}
+}
+
+func TestSourceRepository(t *testing.T) {
+	cases := []struct {
+		source     string
+		repository string
+		ok         bool
+	}{
+		{source: "https://github.com/example/app", repository: "example/app", ok: true},
+		{source: "https://github.example.com/example/app.git", repository: "example/app", ok: true},
+		{source: "https://github.com/example"},
+		{source: "example/app"},
+		{source: ""},
+	}
+
+	for i, c := range cases {
+		repository, ok := sourceRepository(c.source)
+		if repository != c.repository || ok != c.ok {
+			t.Fatalf("[%d] Unexpected repository of %s: %s, %t", i, c.source, repository, ok)
+		}
+	}
+}
+
+func TestParseGitHubRepositories(t *testing.T) {
+	repositories, err := ParseGitHubRepositories(`{"team/app": "example/app"}`)
+	if err != nil || repositories["team/app"] != "example/app" {
+		t.Fatalf("Unexpected repositories %v: %v", repositories, err)
+	}
+	if _, err := ParseGitHubRepositories("team/app=example/app"); err == nil {
+		t.Fatalf("Expected invalid repositories error")
+	}
+}
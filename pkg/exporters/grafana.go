@@ -0,0 +1,98 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+const grafanaTag = "ecr-scan"
+
+// GrafanaExporter posts an annotation summarizing the report to Grafana
+type GrafanaExporter struct {
+	apiKey string
+	client *http.Client
+	name   string
+	url    string
+}
+
+type annotation struct {
+	Time int64    `json:"time"`
+	Tags []string `json:"tags"`
+	Text string   `json:"text"`
+}
+
+// NewGrafanaExporter .
+func NewGrafanaExporter(name string, url string, apiKey string) *GrafanaExporter {
+	return &GrafanaExporter{
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 10 * time.Second},
+		name:   name,
+		url:    strings.TrimSuffix(url, "/"),
+	}
+}
+
+// Name .
+func (g GrafanaExporter) Name() string {
+	return g.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (g GrafanaExporter) Format(report *api.Report) (func() error, error) {
+	tags := []string{grafanaTag}
+	if report.RunID != "" {
+		tags = append(tags, "run:"+report.RunID)
+	}
+	body, err := json.Marshal(annotation{
+		Time: time.Now().UnixNano() / int64(time.Millisecond),
+		Tags: tags,
+		Text: summary(report),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		req, err := http.NewRequest(http.MethodPost, g.url+"/api/annotations", bytes.NewBuffer(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+
+		resp, err := g.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("Grafana responded with status %d", resp.StatusCode)
+		}
+		return nil
+	}, nil
+}
+
+// summary creates a one line overview of the report
+func summary(report *api.Report) string {
+	findings := countFindings(report.Filtered)
+
+	var counts []string
+	for _, key := range severity.SeverityList {
+		if findings[key] > 0 {
+			counts = append(counts, fmt.Sprintf("%s: %d", key, findings[key]))
+		}
+	}
+
+	text := fmt.Sprintf("ECR scan: %d vulnerable, %d failed repositories", len(report.Filtered), len(report.Failed))
+	if len(counts) > 0 {
+		text += " (" + strings.Join(counts, ", ") + ")"
+	}
+	return text
+}
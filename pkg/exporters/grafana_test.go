@@ -0,0 +1,68 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+func TestSummary(t *testing.T) {
+	cases := []struct {
+		report   *api.Report
+		expected string
+	}{
+		{
+			report: &api.Report{
+				Filtered: pushgatewayInput,
+				Failed:   []*api.RepositoryInfo{{Name: "TestRepo/Failed1"}},
+			},
+			expected: "ECR scan: 2 vulnerable, 1 failed repositories (CRITICAL: 4, HIGH: 2, LOW: 4)",
+		},
+		{
+			report:   &api.Report{},
+			expected: "ECR scan: 0 vulnerable, 0 failed repositories",
+		},
+	}
+
+	for i, c := range cases {
+		text := summary(c.report)
+		if !reflect.DeepEqual(c.expected, text) {
+			t.Fatalf("[%d] Error creating summary, wanted => %s, got => %s", i, c.expected, text)
+		}
+	}
+}
+
+func TestGrafanaSend(t *testing.T) {
+	var auth string
+	var body annotation
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/annotations" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	g := NewGrafanaExporter("grafana", server.URL, "secret")
+	send, err := g.Format(&api.Report{Filtered: pushgatewayInput})
+	if err != nil {
+		t.Fatalf("Error formatting annotation: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error posting annotation: %s", err)
+	}
+
+	if auth != "Bearer secret" {
+		t.Fatalf("Wrong authorization header, got => %s", auth)
+	}
+	if !reflect.DeepEqual(body.Tags, []string{"ecr-scan"}) {
+		t.Fatalf("Wrong annotation tags, got => %v", body.Tags)
+	}
+}
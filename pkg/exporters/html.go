@@ -0,0 +1,205 @@
+package exporters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// htmlReport is the data of the HTML report template
+type htmlReport struct {
+	Head             string
+	Clean            string
+	Vulnerable       htmlTable
+	PullThroughCache htmlTable
+	Notes            []string
+	Lists            []htmlList
+	PolicyHead       string
+	Policy           string
+	// Vulnerable repositories by namespace, replacing the Vulnerable table when grouping is on
+	Groups []htmlTable
+}
+
+// htmlTable lists vulnerable repositories with a column per severity level found among them
+type htmlTable struct {
+	Head           string
+	RepositoryHead string
+	Levels         []string
+	Rows           []htmlRow
+	// The table folds into its head, e.g.: namespace groups on the dashboard
+	Collapsible bool
+}
+
+type htmlRow struct {
+	// Repository the row belongs to, Name includes the platform
+	Repository string
+	Name       string
+	Link       string
+	Counts     []string
+	Details    []string
+}
+
+// htmlList is a titled list of repository names, failed repositories have a list per cause
+type htmlList struct {
+	Head    string
+	SubHead bool
+	Names   []string
+	// Compliance controls the listed findings relate to
+	Controls string
+}
+
+// The output is well-formed XHTML, so it is also valid Confluence storage format
+const htmlTemplate = `<h1>{{ .Head }}</h1>
+{{- define "table" }}
+{{- if .Collapsible }}
+<details open="open"><summary>{{ .Head }}</summary>
+{{- else if .Head }}
+<h2>{{ .Head }}</h2>
+{{- end }}
+<table><tbody>
+<tr><th>{{ .RepositoryHead }}</th>{{ range .Levels }}<th>{{ . }}</th>{{ end }}</tr>
+{{- range .Rows }}
+<tr><td>{{ if .Link }}<a href="{{ .Link }}">{{ .Name }}</a>{{ else }}{{ .Name }}{{ end }}{{ range .Details }}<p>{{ . }}</p>{{ end }}</td>{{ range .Counts }}<td>{{ . }}</td>{{ end }}</tr>
+{{- end }}
+</tbody></table>
+{{- if .Collapsible }}
+</details>
+{{- end }}
+{{- end }}
+{{- if .Groups }}{{ range .Groups }}{{ template "table" . }}{{ end }}
+{{- else if .Vulnerable.Rows }}{{ template "table" .Vulnerable }}{{ else }}
+<p>{{ .Clean }}</p>
+{{- end }}
+{{- if .PullThroughCache.Rows }}{{ template "table" .PullThroughCache }}{{ end }}
+{{- range .Notes }}
+<p>{{ . }}</p>
+{{- end }}
+{{- range .Lists }}
+{{ if .SubHead }}<h3>{{ .Head }}</h3>{{ else }}<h2>{{ .Head }}</h2>{{ end }}
+{{- if .Controls }}
+<p>{{ .Controls }}</p>
+{{- end }}
+{{- if .Names }}
+<ul>{{ range .Names }}<li>{{ . }}</li>{{ end }}</ul>
+{{- end }}
+{{- end }}
+{{- if .Policy }}
+<h2>{{ .PolicyHead }}</h2>
+<pre>{{ .Policy }}</pre>
+{{- end }}
+`
+
+// formatHTML renders the report as an HTML fragment of headers, tables and lists
+func (p Presentation) formatHTML(report *api.Report) (string, error) {
+	return p.newHTMLReport(report).render()
+}
+
+// newHTMLReport collects the data of the HTML report, rows link to the console
+func (p Presentation) newHTMLReport(report *api.Report) htmlReport {
+	data := htmlReport{
+		Head:             p.headText(report.Date),
+		Clean:            p.msg().clean,
+		Vulnerable:       p.newHTMLTable("", report.Filtered),
+		PullThroughCache: p.newHTMLTable(p.msg().pullThroughCache, report.PullThroughCache),
+		PolicyHead:       p.msg().suggestedPolicy,
+		Policy:           report.SuggestedLifecyclePolicy,
+		Notes:            lines(p.formatRun(report) + p.formatPartial(report) + p.formatScanType(report.ScanType)),
+	}
+	if p.GroupByNamespace {
+		for _, g := range p.groupByNamespace(report.Filtered) {
+			data.Groups = append(data.Groups, p.newHTMLTable(p.groupHead(g), g.repositories))
+		}
+	}
+
+	for _, s := range p.sections(report) {
+		if len(s.repositories) == 0 {
+			continue
+		}
+		refs := p.controlsText(p.controls(s.category))
+		if !s.byCause {
+			data.Lists = append(data.Lists, htmlList{Head: s.head, Names: p.listNames(s.repositories), Controls: refs})
+			continue
+		}
+		data.Lists = append(data.Lists, htmlList{Head: s.head, Controls: refs})
+		for _, group := range p.groupByCause(s.repositories) {
+			data.Lists = append(data.Lists, htmlList{Head: group.head, SubHead: true, Names: p.listNames(group.repositories)})
+		}
+	}
+
+	return data
+}
+
+func (data htmlReport) render() (string, error) {
+	buffer, err := execTmpl(data, htmlTemplate)
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// newHTMLTable creates the table of vulnerable repositories, leaving out severity levels none of them has
+func (p Presentation) newHTMLTable(head string, repositories []*api.RepositoryInfo) htmlTable {
+	findings := make(map[string]int64)
+	for _, r := range repositories {
+		for key, val := range r.ReportedSeverity().Count {
+			if val != nil {
+				findings[key] += *val
+			}
+		}
+	}
+
+	table := htmlTable{Head: head, RepositoryHead: p.msg().repository}
+	var levels []string
+	for _, key := range severity.SeverityList {
+		if findings[key] > 0 {
+			levels = append(levels, key)
+			table.Levels = append(table.Levels, p.displayOf(key).Label)
+		}
+	}
+
+	for _, r := range repositories {
+		reported := r.ReportedSeverity()
+		row := htmlRow{Repository: r.Name, Name: r.DisplayName(), Link: r.Link}
+		for _, key := range levels {
+			if val := reported.Count[key]; val != nil && *val > 0 {
+				row.Counts = append(row.Counts, fmt.Sprintf("%d", *val))
+			} else {
+				row.Counts = append(row.Counts, "")
+			}
+		}
+		for _, detail := range []string{p.imageDetails(r), p.baseImageText(r)} {
+			if detail != "" {
+				row.Details = append(row.Details, detail)
+			}
+		}
+		row.Details = append(row.Details, lines(p.packagesText(r))...)
+		row.Details = append(row.Details, lines(p.layersText(r))...)
+		if refs := p.controlsText(p.repositoryControls(r)); refs != "" {
+			row.Details = append(row.Details, refs)
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// listNames returns the names repositories are listed with
+func (p Presentation) listNames(repositories []*api.RepositoryInfo) []string {
+	names := make([]string, 0, len(repositories))
+	for _, r := range repositories {
+		names = append(names, p.listName(r))
+	}
+	return names
+}
+
+// lines splits text into its non-empty lines
+func lines(text string) []string {
+	var result []string
+	for _, line := range strings.Split(text, "\n") {
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
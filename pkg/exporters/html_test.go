@@ -0,0 +1,45 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+func TestFormatHTML(t *testing.T) {
+	var p Presentation
+	report := &api.Report{
+		Filtered:    pushgatewayInput,
+		Failed:      []*api.RepositoryInfo{{Name: "TestRepo/<Failed>", Cause: "AccessDenied"}},
+		Empty:       []*api.RepositoryInfo{{Name: "TestRepo/Empty"}},
+		Interrupted: true,
+	}
+
+	html, err := p.formatHTML(report)
+	if err != nil {
+		t.Fatalf("Runtime error formatting HTML: %s", err)
+	}
+
+	expected := []string{
+		"<tr><th>Repository</th><th>CRITICAL</th><th>HIGH</th><th>LOW</th></tr>",
+		"<tr><td>TestRepository/TestRepo1</td><td>1</td><td>2</td><td></td></tr>",
+		"<tr><td>TestRepository/TestRepo2</td><td>3</td><td></td><td>4</td></tr>",
+		"<p>" + p.msg().interrupted + "</p>",
+		"<h2>" + p.msg().failed + "</h2>\n<h3>" + p.msg().causes["AccessDenied"] + "</h3>\n<ul><li>TestRepo/&lt;Failed&gt;</li></ul>",
+		"<h2>" + p.msg().empty + "</h2>\n<ul><li>TestRepo/Empty</li></ul>",
+	}
+	for _, e := range expected {
+		if !strings.Contains(html, e) {
+			t.Fatalf("Expected HTML to contain %s, got: \n%s", e, html)
+		}
+	}
+
+	html, err = p.formatHTML(&api.Report{})
+	if err != nil {
+		t.Fatalf("Runtime error formatting HTML: %s", err)
+	}
+	if !strings.Contains(html, "<p>"+p.msg().clean+"</p>") || strings.Contains(html, "<table>") {
+		t.Fatalf("Expected the clean message without a table, got: \n%s", html)
+	}
+}
@@ -0,0 +1,165 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nlopes/slack"
+)
+
+// InventoryExporter is an exporter which can send repository inventories as well
+type InventoryExporter interface {
+	Exporter
+	// Formats the inventory then returns function which sends it on invocation
+	FormatInventory(inventory *report.Inventory) (func() error, error)
+}
+
+// inventoryLine describes the counts of a registry, or of every registry, e.g.:
+// prod/eu-west-1: 120 repos, 110 covered by scanning, 2400 images, 95.8% scanned (BASIC scanning, rules: SCAN_ON_PUSH on *)
+func (p Presentation) inventoryLine(name string, r report.RegistryInventory) string {
+	line := fmt.Sprintf(p.msg().inventoryRegistry, name, r.Repositories, r.CoveredRepositories, r.Images, r.Coverage())
+	var scanning []string
+	if r.ScanType != "" {
+		scanning = append(scanning, fmt.Sprintf(p.msg().inventoryScanning, r.ScanType))
+	}
+	if len(r.Rules) > 0 {
+		scanning = append(scanning, fmt.Sprintf(p.msg().inventoryRules, strings.Join(r.Rules, "; ")))
+	}
+	if len(scanning) > 0 {
+		line += " (" + strings.Join(scanning, ", ") + ")"
+	}
+	return line
+}
+
+// inventoryLines returns a line per registry, the total when there are several, then the incomplete registries
+func (p Presentation) inventoryLines(inventory *report.Inventory) []string {
+	var lines, incomplete []string
+	for _, r := range inventory.Registries {
+		lines = append(lines, p.inventoryLine(r.Account, r))
+		if r.Error != "" {
+			incomplete = append(incomplete, fmt.Sprintf(p.msg().inventoryError, r.Account, r.Error))
+		}
+	}
+	if len(inventory.Registries) > 1 {
+		lines = append(lines, p.inventoryLine(p.msg().inventoryTotal, inventory.Total()))
+	}
+	return append(lines, incomplete...)
+}
+
+// formatInventoryText renders the inventory as plain text
+func (p Presentation) formatInventoryText(inventory *report.Inventory) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(p.msg().inventoryHead + "\n\n")
+	for _, line := range p.inventoryLines(inventory) {
+		buffer.WriteString(line + "\n")
+	}
+	return buffer.String()
+}
+
+// FormatInventoryText renders the inventory as plain text, the way the log exporter prints it
+func (p Presentation) FormatInventoryText(inventory *report.Inventory) string {
+	return p.formatInventoryText(inventory)
+}
+
+// FormatInventory prints the inventory to stdout
+func (l LogExporter) FormatInventory(inventory *report.Inventory) (func() error, error) {
+	msg := l.formatInventoryText(inventory)
+	return func() error {
+		fmt.Println(msg)
+		return nil
+	}, nil
+}
+
+// FormatInventory posts the inventory to the channel in a single message
+func (s *SlackService) FormatInventory(inventory *report.Inventory) (func() error, error) {
+	text := boldn(s.msg().inventoryHead) + escapeMrkdwn(strings.Join(s.inventoryLines(inventory), "\n"))
+	messages := []slack.Blocks{{BlockSet: []slack.Block{s.GenerateTextBlock(text)}}}
+
+	return func() error {
+		_, err := s.deliver(s.channel, messages)
+		return err
+	}, nil
+}
+
+// FormatInventory emails the inventory as plain text
+func (m MailgunExporter) FormatInventory(inventory *report.Inventory) (func() error, error) {
+	msg := m.client.NewMessage(m.from, m.msg().inventorySubject, m.formatInventoryText(inventory))
+	for _, user := range strings.Split(m.recipients, ",") {
+		if err := msg.AddRecipient(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		_, _, err := m.client.Send(msg)
+		return err
+	}, nil
+}
+
+type jsonInventory struct {
+	Head       string         `json:"head"`
+	RunID      string         `json:"run_id,omitempty"`
+	Registries []jsonRegistry `json:"registries"`
+	Total      jsonRegistry   `json:"total"`
+}
+
+type jsonRegistry struct {
+	Account             string   `json:"account,omitempty"`
+	RegistryID          string   `json:"registry_id,omitempty"`
+	Region              string   `json:"region,omitempty"`
+	ScanType            string   `json:"scan_type,omitempty"`
+	Rules               []string `json:"rules,omitempty"`
+	Repositories        int      `json:"repositories"`
+	CoveredRepositories int      `json:"covered_repositories"`
+	Images              int      `json:"images"`
+	ScannedImages       int      `json:"scanned_images"`
+	Coverage            float64  `json:"coverage"`
+	Error               string   `json:"error,omitempty"`
+}
+
+// registryJSON returns the inventory of the registry as published
+func registryJSON(r report.RegistryInventory) jsonRegistry {
+	return jsonRegistry{
+		Account:             r.Account,
+		RegistryID:          r.RegistryID,
+		Region:              r.Region,
+		ScanType:            r.ScanType,
+		Rules:               r.Rules,
+		Repositories:        r.Repositories,
+		CoveredRepositories: r.CoveredRepositories,
+		Images:              r.Images,
+		ScannedImages:       r.ScannedImages,
+		Coverage:            r.Coverage(),
+		Error:               r.Error,
+	}
+}
+
+// FormatInventory publishes the inventory as json
+func (s SNSExporter) FormatInventory(inventory *report.Inventory) (func() error, error) {
+	js := jsonInventory{
+		Head:  s.msg().inventoryHead,
+		RunID: inventory.RunID,
+		Total: registryJSON(inventory.Total()),
+	}
+	for _, r := range inventory.Registries {
+		js.Registries = append(js.Registries, registryJSON(r))
+	}
+
+	body, err := json.Marshal(js)
+	if err != nil {
+		return nil, err
+	}
+	msg := string(body)
+
+	return func() error {
+		_, err := s.client.Publish(&sns.PublishInput{
+			Message:  &msg,
+			TopicArn: &s.topicARN,
+		})
+		return err
+	}, nil
+}
@@ -0,0 +1,50 @@
+package exporters
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+func TestFormatInventoryText(t *testing.T) {
+	var p Presentation
+	inventory := &report.Inventory{Registries: []report.RegistryInventory{
+		{
+			Account: "prod/eu-west-1", ScanType: "ENHANCED", Rules: []string{"CONTINUOUS_SCAN on *"},
+			Repositories: 120, CoveredRepositories: 120, Images: 2400, ScannedImages: 2300,
+		},
+		{
+			Account: "dev/eu-west-1", ScanType: "BASIC",
+			Repositories: 30, CoveredRepositories: 12, Images: 100, ScannedImages: 40, Error: "AccessDeniedException",
+		},
+	}}
+
+	expected := "ECR repository inventory\n\n" +
+		"prod/eu-west-1: 120 repos, 120 covered by scanning, 2400 images, 95.8% scanned (ENHANCED scanning, rules: CONTINUOUS_SCAN on *)\n" +
+		"dev/eu-west-1: 30 repos, 12 covered by scanning, 100 images, 40.0% scanned (BASIC scanning)\n" +
+		"Total: 150 repos, 132 covered by scanning, 2500 images, 93.6% scanned\n" +
+		"Inventory of dev/eu-west-1 is incomplete: AccessDeniedException\n"
+	if text := p.formatInventoryText(inventory); text != expected {
+		t.Fatalf("values are not equal, wanting: \n%s, got: \n%s", expected, text)
+	}
+
+	// A single registry has no total
+	inventory.Registries = inventory.Registries[:1]
+	expected = "ECR repository inventory\n\n" +
+		"prod/eu-west-1: 120 repos, 120 covered by scanning, 2400 images, 95.8% scanned (ENHANCED scanning, rules: CONTINUOUS_SCAN on *)\n"
+	if text := p.formatInventoryText(inventory); text != expected {
+		t.Fatalf("values are not equal, wanting: \n%s, got: \n%s", expected, text)
+	}
+}
+
+func TestInventoryJSON(t *testing.T) {
+	body, err := json.Marshal(jsonInventory{Head: "ECR repository inventory", RunID: "1a2b3c4d"})
+	if err != nil {
+		t.Fatalf("Error marshalling inventory: %s", err)
+	}
+	if !strings.HasPrefix(string(body), `{"head":"ECR repository inventory","run_id":"1a2b3c4d",`) {
+		t.Fatalf("Expected the run ID as run_id, got: %s", body)
+	}
+}
@@ -0,0 +1,343 @@
+package exporters
+
+import (
+	"sort"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// DefaultLocale is the language of messages unless configured otherwise
+const DefaultLocale = "en"
+
+// messages holds every user-facing string of the reports in one language
+type messages struct {
+	// Report header, %s is the date
+	head             string
+	pullThroughCache string
+	failed           string
+	empty            string
+	notScanned       string
+	scanOnPushOff    string
+	notCovered       string
+	public           string
+	stale            string
+	untagged         string
+	noLifecycle      string
+	snoozeExpiring   string
+	suppressExpiring string
+	resolved         string
+	overdue          string
+	suggestedPolicy  string
+	enhancedNote     string
+	clean            string
+	// Run which produced the report, %s are the run ID and the report fingerprint
+	run string
+	// Note on reports cut short by the time limit, %d is the number of repositories left out
+	partial string
+	// Note on reports of cancelled runs
+	interrupted string
+	// Note on repositories held back by the grace period, %d is their number
+	pending string
+	// Push date of an image, %s is the date
+	pushed string
+	// Date of the latest scan of an image, %s is the date
+	scanned string
+	// Findings each source listed of merged sources, %s are the sources with their counts
+	sources string
+	// Registry of a repository, %s is the AWS account ID
+	account string
+	// Untagged images of a repository, %d is their number and %s their total size
+	untaggedCount string
+	// Expiry of the snooze of a listed repository, %s is the date
+	snoozedUntil string
+	// Expiry of the suppression of a listed repository, %s is the date
+	suppressedUntil string
+	// Vulnerabilities of a listed repository fixed since the previous report, %s are their IDs
+	fixed string
+	// Permission a failed repository was missing, %s is the action, and the resource for deniedOn
+	denied   string
+	deniedOn string
+	// Escalation of repositories with severe findings, %s is the severity
+	escalation string
+	// Base image of a repository's image, %s is the image reference
+	baseImage string
+	// Findings by layer, %d are the findings in base image layers and in application layers
+	attribution string
+	// Layer which introduced vulnerable packages, %s are the packages and %d is the position of the layer
+	layer string
+	// Findings by package type, %s are the counts per severity
+	osPackages       string
+	languagePackages string
+	// Compliance controls findings relate to, %s are the control references
+	controls string
+	// Header of a repository's findings, %s is the repository name
+	found string
+	// Note on repositories left out of a size limited message, %d is their number
+	more string
+	// Header of the vulnerable repositories of a namespace, %s is the namespace, %d their number and %s their findings
+	namespace   string
+	noNamespace string
+	// Column header of repository names in HTML reports
+	repository string
+	// Header of the dashboard trend chart, %d is the number of runs shown
+	trend string
+	// Digest header, %s are the first and last day of the period
+	digestHead     string
+	digestNew      string
+	digestResolved string
+	digestTrend    string
+	digestSLA      string
+	// Daily run in the digest trend, %s is the date, %d are the numbers of vulnerable and failed repositories
+	digestDay string
+	// Repository breaching the SLA, %s are the repository and the severity, %d is the number of days
+	slaBreach     string
+	digestNone    string
+	digestSubject string
+	// Inventory line of a registry, %s is the registry, %d are the numbers of repositories, of those covered by
+	// scanning and of images, %.1f is the percentage of images scanned
+	inventoryHead     string
+	inventoryRegistry string
+	// Scanning configuration of a registry, %s are the scan type and the scanning rules
+	inventoryScanning string
+	inventoryRules    string
+	// Registry whose inventory is incomplete, %s are the registry and the error
+	inventoryError   string
+	inventoryTotal   string
+	inventorySubject string
+	// Link to the console in text reports, %s is the link
+	textLink string
+	// Link to the console in Slack mrkdwn, %s is the link
+	slackLink   string
+	mailSubject string
+	// Headers of failed repositories grouped by the cause of the failure
+	causes map[string]string
+}
+
+var locales = map[string]messages{
+	"en": {
+		head:              "Scan results on %s",
+		pullThroughCache:  "Vulnerabilities found in pull through cache repos:",
+		failed:            "Failed to get scan results from the following repos:",
+		empty:             "The following repos contain no images:",
+		notScanned:        "Images in the following repos have never been scanned (is scan on push enabled?):",
+		scanOnPushOff:     "Scan on push is disabled on the following repos:",
+		notCovered:        "The following repos are not covered by any registry scanning rule:",
+		public:            "The following public repos are not scanned (ECR Public doesn't support image scanning):",
+		stale:             "Images in the following repos haven't been pushed for a long time, their base images may be unpatched:",
+		untagged:          "The following repos hold many untagged images, which take up storage and may contain vulnerable layers:",
+		noLifecycle:       "The following repos have no lifecycle policy:",
+		snoozeExpiring:    "The following snoozes expire soon:",
+		suppressExpiring:  "The following suppressions expire soon, the repos are reported again afterwards:",
+		resolved:          "Fixed since the last run, well done:",
+		overdue:           "The following repos have been vulnerable for longer than the escalation period:",
+		suggestedPolicy:   "Suggested lifecycle policy, expiring untagged images after 14 days and keeping the 100 most recent images:",
+		enhancedNote:      "Note: the registry uses enhanced scanning, images are scanned continuously by Amazon Inspector.",
+		clean:             "Looks like the tested images have zero vulnerabilities hitting the threshold, good job!",
+		run:               "Run %s, report %s",
+		partial:           "Partial report, %d repos were not processed before the time limit.",
+		interrupted:       "Partial report, the run was interrupted before every repo was processed.",
+		pending:           "%d repos became vulnerable recently, they are reported once the grace period is over.",
+		pushed:            "pushed %s",
+		scanned:           "scanned %s",
+		sources:           "found by %s",
+		account:           "account %s",
+		untaggedCount:     "%d untagged images, %s",
+		snoozedUntil:      "snoozed until %s",
+		suppressedUntil:   "suppressed until %s",
+		fixed:             "fixed %s",
+		denied:            "missing %s",
+		deniedOn:          "missing %s on %s",
+		escalation:        "Repositories with %s findings need attention:",
+		baseImage:         "Base image: %s",
+		attribution:       "%d findings in base image layers, %d in application layers",
+		layer:             "%s introduced in layer %d",
+		osPackages:        "OS packages: %s",
+		languagePackages:  "Language packages (pip, npm, maven...): %s",
+		controls:          "Controls: %s",
+		found:             "Vulnerabilities found in %s:",
+		more:              "... and %d more repos",
+		namespace:         "%s: %d vulnerable repos, %s",
+		noNamespace:       "without namespace",
+		repository:        "Repository",
+		trend:             "Vulnerable (red) and failed (grey) repos over the last %d runs:",
+		digestHead:        "ECR scan digest, %s - %s",
+		digestNew:         "Newly vulnerable repos:",
+		digestResolved:    "Resolved repos:",
+		digestTrend:       "Daily results:",
+		digestSLA:         "Repos with findings open for longer than the SLA:",
+		digestDay:         "%s: %d vulnerable, %d failed repos",
+		slaBreach:         "%s: %s findings open for %d days",
+		digestNone:        "None",
+		digestSubject:     "Weekly ECR scan digest",
+		inventoryHead:     "ECR repository inventory",
+		inventoryRegistry: "%s: %d repos, %d covered by scanning, %d images, %.1f%% scanned",
+		inventoryScanning: "%s scanning",
+		inventoryRules:    "rules: %s",
+		inventoryError:    "Inventory of %s is incomplete: %s",
+		inventoryTotal:    "Total",
+		inventorySubject:  "ECR repository inventory",
+		textLink:          "View detailed scan results on console (%s)",
+		slackLink:         "View detailed scan results <%s| on ECR console>",
+		mailSubject:       "Daily ECR scan report",
+		causes: map[string]string{
+			report.CauseImageNotFound: "No image with the tag (push it or check IMAGE_TAG):",
+			report.CauseAccessDenied:  "Access denied (check the IAM permissions):",
+			report.CauseThrottling:    "Throttled by AWS (retry later or lower NUM_WORKERS):",
+			report.CauseOther:         "Other errors:",
+		},
+	},
+	"de": {
+		head:              "Scan-Ergebnisse vom %s",
+		pullThroughCache:  "In Pull-Through-Cache-Repos gefundene Schwachstellen:",
+		failed:            "Die Scan-Ergebnisse der folgenden Repos konnten nicht abgerufen werden:",
+		empty:             "Die folgenden Repos enthalten keine Images:",
+		notScanned:        "Images in den folgenden Repos wurden nie gescannt (ist Scan bei Push aktiviert?):",
+		scanOnPushOff:     "Scan bei Push ist in den folgenden Repos deaktiviert:",
+		notCovered:        "Die folgenden Repos werden von keiner Scan-Regel der Registry erfasst:",
+		public:            "Die folgenden öffentlichen Repos werden nicht gescannt (ECR Public unterstützt keine Image-Scans):",
+		stale:             "Images in den folgenden Repos wurden lange nicht gepusht, ihre Basis-Images sind möglicherweise ungepatcht:",
+		untagged:          "Die folgenden Repos enthalten viele Images ohne Tag, die Speicher belegen und verwundbare Layer enthalten können:",
+		noLifecycle:       "Die folgenden Repos haben keine Lifecycle-Richtlinie:",
+		snoozeExpiring:    "Die folgenden Zurückstellungen laufen bald ab:",
+		suppressExpiring:  "Die folgenden Ausnahmen laufen bald ab, die Repos werden danach wieder gemeldet:",
+		resolved:          "Seit dem letzten Lauf behoben, gut gemacht:",
+		overdue:           "Die folgenden Repos sind länger als die Eskalationsfrist verwundbar:",
+		suggestedPolicy:   "Vorgeschlagene Lifecycle-Richtlinie, die Images ohne Tag nach 14 Tagen löscht und die 100 neuesten Images behält:",
+		enhancedNote:      "Hinweis: Die Registry verwendet Enhanced Scanning, Images werden fortlaufend von Amazon Inspector gescannt.",
+		clean:             "Die getesteten Images haben keine Schwachstellen über dem Schwellenwert, gute Arbeit!",
+		run:               "Lauf %s, Bericht %s",
+		partial:           "Unvollständiger Bericht, %d Repos wurden vor Ablauf der Zeit nicht verarbeitet.",
+		interrupted:       "Unvollständiger Bericht, der Lauf wurde abgebrochen, bevor alle Repos verarbeitet wurden.",
+		pending:           "%d Repos sind seit Kurzem verwundbar, sie werden nach Ablauf der Karenzzeit gemeldet.",
+		pushed:            "gepusht am %s",
+		scanned:           "gescannt am %s",
+		sources:           "gefunden von %s",
+		account:           "Konto %s",
+		untaggedCount:     "%d Images ohne Tag, %s",
+		snoozedUntil:      "zurückgestellt bis %s",
+		suppressedUntil:   "ausgenommen bis %s",
+		fixed:             "behoben: %s",
+		denied:            "fehlende Berechtigung %s",
+		deniedOn:          "fehlende Berechtigung %s auf %s",
+		escalation:        "Repos mit Schwachstellen der Stufe %s erfordern Aufmerksamkeit:",
+		baseImage:         "Basis-Image: %s",
+		attribution:       "%d Befunde in Layern des Basis-Images, %d in Anwendungs-Layern",
+		layer:             "%s hinzugefügt in Layer %d",
+		osPackages:        "Betriebssystempakete: %s",
+		languagePackages:  "Sprachpakete (pip, npm, maven...): %s",
+		controls:          "Kontrollen: %s",
+		found:             "Schwachstellen gefunden in %s:",
+		more:              "... und %d weitere Repos",
+		namespace:         "%s: %d verwundbare Repos, %s",
+		noNamespace:       "ohne Namespace",
+		repository:        "Repository",
+		trend:             "Verwundbare (rot) und fehlgeschlagene (grau) Repos der letzten %d Läufe:",
+		digestHead:        "ECR-Scan-Zusammenfassung, %s - %s",
+		digestNew:         "Neu verwundbare Repos:",
+		digestResolved:    "Behobene Repos:",
+		digestTrend:       "Tägliche Ergebnisse:",
+		digestSLA:         "Repos mit Befunden, die länger als das SLA offen sind:",
+		digestDay:         "%s: %d verwundbare, %d fehlgeschlagene Repos",
+		slaBreach:         "%s: %s-Befunde seit %d Tagen offen",
+		digestNone:        "Keine",
+		digestSubject:     "Wöchentliche ECR-Scan-Zusammenfassung",
+		inventoryHead:     "ECR-Repository-Inventar",
+		inventoryRegistry: "%s: %d Repos, %d vom Scannen erfasst, %d Images, %.1f%% gescannt",
+		inventoryScanning: "%s-Scannen",
+		inventoryRules:    "Regeln: %s",
+		inventoryError:    "Inventar von %s ist unvollständig: %s",
+		inventoryTotal:    "Gesamt",
+		inventorySubject:  "ECR-Repository-Inventar",
+		textLink:          "Detaillierte Scan-Ergebnisse in der Konsole (%s)",
+		slackLink:         "Detaillierte Scan-Ergebnisse <%s| in der ECR-Konsole>",
+		mailSubject:       "Täglicher ECR-Scan-Bericht",
+		causes: map[string]string{
+			report.CauseImageNotFound: "Kein Image mit dem Tag (pushen oder IMAGE_TAG prüfen):",
+			report.CauseAccessDenied:  "Zugriff verweigert (IAM-Berechtigungen prüfen):",
+			report.CauseThrottling:    "Von AWS gedrosselt (später erneut versuchen oder NUM_WORKERS verringern):",
+			report.CauseOther:         "Andere Fehler:",
+		},
+	},
+	"ja": {
+		head:              "%s のスキャン結果",
+		pullThroughCache:  "プルスルーキャッシュリポジトリで見つかった脆弱性:",
+		failed:            "次のリポジトリのスキャン結果を取得できませんでした:",
+		empty:             "次のリポジトリにはイメージがありません:",
+		notScanned:        "次のリポジトリのイメージは一度もスキャンされていません (プッシュ時のスキャンは有効ですか?):",
+		scanOnPushOff:     "次のリポジトリではプッシュ時のスキャンが無効です:",
+		notCovered:        "次のリポジトリはどのレジストリスキャンルールの対象にもなっていません:",
+		public:            "次のパブリックリポジトリはスキャンされません (ECR Public はイメージスキャンに対応していません):",
+		stale:             "次のリポジトリのイメージは長期間プッシュされていません。ベースイメージにパッチが適用されていない可能性があります:",
+		untagged:          "次のリポジトリにはタグのないイメージが多数あります。ストレージを消費し、脆弱なレイヤーを含んでいる可能性があります:",
+		noLifecycle:       "次のリポジトリにはライフサイクルポリシーがありません:",
+		snoozeExpiring:    "次のスヌーズはまもなく期限切れになります:",
+		suppressExpiring:  "次の除外はまもなく期限切れになります。期限切れ後、リポジトリは再び報告されます:",
+		resolved:          "前回の実行以降に修正されました。お疲れさまでした:",
+		overdue:           "次のリポジトリはエスカレーション期間を超えて脆弱な状態が続いています:",
+		suggestedPolicy:   "推奨ライフサイクルポリシー (タグなしイメージを 14 日後に削除し、最新の 100 イメージを保持します):",
+		enhancedNote:      "注: このレジストリは拡張スキャンを使用しており、イメージは Amazon Inspector によって継続的にスキャンされます。",
+		clean:             "テストしたイメージにしきい値を超える脆弱性はありません。お疲れさまでした!",
+		run:               "実行 %s、レポート %s",
+		partial:           "部分的なレポートです。時間制限までに %d 個のリポジトリを処理できませんでした。",
+		interrupted:       "部分的なレポートです。すべてのリポジトリを処理する前に実行が中断されました。",
+		pending:           "%d 個のリポジトリが最近脆弱になりました。猶予期間の終了後に報告されます。",
+		pushed:            "プッシュ日 %s",
+		scanned:           "スキャン日 %s",
+		sources:           "検出元 %s",
+		account:           "アカウント %s",
+		untaggedCount:     "タグなしイメージ %d 個、%s",
+		snoozedUntil:      "%s までスヌーズ",
+		suppressedUntil:   "%s まで除外",
+		fixed:             "修正済み: %s",
+		denied:            "権限不足: %s",
+		deniedOn:          "権限不足: %s (%s)",
+		escalation:        "%s の検出結果があるリポジトリへの対応が必要です:",
+		baseImage:         "ベースイメージ: %s",
+		attribution:       "ベースイメージのレイヤーに %d 件、アプリケーションのレイヤーに %d 件の検出結果",
+		layer:             "%s はレイヤー %d で追加",
+		osPackages:        "OS パッケージ: %s",
+		languagePackages:  "言語パッケージ (pip、npm、maven など): %s",
+		controls:          "管理策: %s",
+		found:             "%s で脆弱性が見つかりました:",
+		more:              "... 他 %d 件のリポジトリ",
+		namespace:         "%s: 脆弱なリポジトリ %d 個、%s",
+		noNamespace:       "名前空間なし",
+		repository:        "リポジトリ",
+		trend:             "直近 %d 回の実行における脆弱なリポジトリ (赤) と失敗したリポジトリ (灰色):",
+		digestHead:        "ECR スキャンダイジェスト (%s - %s)",
+		digestNew:         "新たに脆弱になったリポジトリ:",
+		digestResolved:    "解消されたリポジトリ:",
+		digestTrend:       "日次の結果:",
+		digestSLA:         "SLA を超えて検出結果が未解決のリポジトリ:",
+		digestDay:         "%s: 脆弱 %d 件、失敗 %d 件",
+		slaBreach:         "%s: %s の検出結果が %d 日間未解決",
+		digestNone:        "なし",
+		digestSubject:     "ECR スキャン週次ダイジェスト",
+		inventoryHead:     "ECR リポジトリインベントリ",
+		inventoryRegistry: "%s: リポジトリ %d 件 (スキャン対象 %d 件)、イメージ %d 件 (スキャン済み %.1f%%)",
+		inventoryScanning: "%s スキャン",
+		inventoryRules:    "ルール: %s",
+		inventoryError:    "%s のインベントリは不完全です: %s",
+		inventoryTotal:    "合計",
+		inventorySubject:  "ECR リポジトリインベントリ",
+		textLink:          "詳細なスキャン結果はコンソールで確認できます (%s)",
+		slackLink:         "詳細なスキャン結果は <%s|ECR コンソール> で確認できます",
+		mailSubject:       "ECR スキャン日次レポート",
+		causes: map[string]string{
+			report.CauseImageNotFound: "タグの付いたイメージがありません (プッシュするか IMAGE_TAG を確認してください):",
+			report.CauseAccessDenied:  "アクセスが拒否されました (IAM 権限を確認してください):",
+			report.CauseThrottling:    "AWS によってスロットリングされました (後で再試行するか NUM_WORKERS を減らしてください):",
+			report.CauseOther:         "その他のエラー:",
+		},
+	},
+}
+
+// Locales returns the supported locales
+func Locales() []string {
+	var list []string
+	for l := range locales {
+		list = append(list, l)
+	}
+	sort.Strings(list)
+	return list
+}
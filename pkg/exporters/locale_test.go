@@ -0,0 +1,47 @@
+package exporters
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalesComplete(t *testing.T) {
+	en := reflect.ValueOf(locales[DefaultLocale])
+	for name, m := range locales {
+		v := reflect.ValueOf(m)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i).Name
+			if v.Field(i).String() == "" {
+				t.Fatalf("[%s] message %s is missing", name, field)
+			}
+			if strings.Count(v.Field(i).String(), "%s") != strings.Count(en.Field(i).String(), "%s") {
+				t.Fatalf("[%s] message %s has different placeholders than %s", name, field, DefaultLocale)
+			}
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	p := Presentation{Locale: "de", DateFormat: "2006-01-02"}
+
+	if expected, head := "Scan-Ergebnisse vom 2020-07-18", p.headText(time.Date(2020, 7, 18, 0, 0, 0, 0, time.UTC)); head != expected {
+		t.Fatalf("values not equal, wanting: %s, got: %s", expected, head)
+	}
+	if p.msg().clean != locales["de"].clean {
+		t.Fatalf("values not equal, wanting: %s, got: %s", locales["de"].clean, p.msg().clean)
+	}
+
+	msg, err := p.fillTmpl(&input)
+	if err != nil {
+		t.Fatalf("Runtime error formatting text: %s", err)
+	}
+	if !strings.HasPrefix(msg, "Schwachstellen gefunden in TestRepo/Test1:") {
+		t.Fatalf("Expected localized repository header, got: %s", msg)
+	}
+
+	if unsupported := (Presentation{Locale: "fr"}); unsupported.msg().clean != locales[DefaultLocale].clean {
+		t.Fatalf("Expected the default locale for an unsupported one")
+	}
+}
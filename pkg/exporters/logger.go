@@ -9,6 +9,8 @@ import (
 // LogExporter is a dummy exporter which prints formatted message to stdout.
 // For debug and educational purposes.
 type LogExporter struct {
+	Presentation
+
 	name string
 }
 
@@ -25,19 +27,12 @@ func (l LogExporter) Name() string {
 }
 
 // Format clousure formats scan results and returns a function that sends report on invocation
-func (l LogExporter) Format(filtered []*api.RepositoryInfo, failed []*api.RepositoryInfo) (func() error, error) {
-	filteredMsg, err := format(filtered)
-	if err != nil {
-		return nil, err
-	}
-
-	failedMsg, err := formatFailed(failed)
+func (l LogExporter) Format(report *api.Report) (func() error, error) {
+	msg, err := l.formatReport(report)
 	if err != nil {
 		return nil, err
 	}
 
-	msg := filteredMsg + failedMsg
-
 	return func() error {
 		fmt.Println(msg)
 		return nil
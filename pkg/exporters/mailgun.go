@@ -9,6 +9,8 @@ import (
 
 // MailgunExporter lets you send reports via email
 type MailgunExporter struct {
+	Presentation
+
 	client     *mailgun.MailgunImpl
 	from       string
 	name       string
@@ -33,22 +35,17 @@ func (m MailgunExporter) Name() string {
 }
 
 // Format clousure formats scan results and returns a function that sends report on invocation
-func (m MailgunExporter) Format(filtered []*api.RepositoryInfo, failed []*api.RepositoryInfo) (func() error, error) {
-
-	filteredMsg, err := format(filtered)
-	if err != nil {
-		return nil, err
-	}
+func (m MailgunExporter) Format(report *api.Report) (func() error, error) {
 
-	failedMsg, err := formatFailed(failed)
+	text, err := m.formatReport(report)
 	if err != nil {
 		return nil, err
 	}
 
 	msg := m.client.NewMessage(
 		m.from,
-		"Daily ECR scan report",
-		filteredMsg+failedMsg,
+		m.msg().mailSubject,
+		text,
 	)
 
 	recipientList := strings.Split(m.recipients, ",")
@@ -0,0 +1,83 @@
+package exporters
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// namespaceGroup is the vulnerable repositories of a namespace
+type namespaceGroup struct {
+	namespace    string
+	repositories []*api.RepositoryInfo
+}
+
+// namespace returns the part of the repository name before the first /, empty when it has none
+func namespace(name string) string {
+	if i := strings.Index(name, "/"); i > 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// groupByNamespace splits repositories into groups by namespace in alphabetical order, repositories without namespace
+// come last. A single group holds every repository unless grouping is on.
+func (p Presentation) groupByNamespace(repositories []*api.RepositoryInfo) []namespaceGroup {
+	if !p.GroupByNamespace {
+		return []namespaceGroup{{repositories: repositories}}
+	}
+
+	groups := make(map[string][]*api.RepositoryInfo)
+	var namespaces []string
+	for _, r := range repositories {
+		ns := namespace(r.Name)
+		if _, ok := groups[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+		groups[ns] = append(groups[ns], r)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		if namespaces[i] == "" || namespaces[j] == "" {
+			return namespaces[j] == ""
+		}
+		return namespaces[i] < namespaces[j]
+	})
+
+	grouped := make([]namespaceGroup, 0, len(namespaces))
+	for _, ns := range namespaces {
+		grouped = append(grouped, namespaceGroup{namespace: ns, repositories: groups[ns]})
+	}
+	return grouped
+}
+
+// groupHead returns the header of the group with the number of repositories and their reported findings,
+// empty when grouping is off
+func (p Presentation) groupHead(g namespaceGroup) string {
+	if !p.GroupByNamespace {
+		return ""
+	}
+
+	findings := make(map[string]int64)
+	for _, r := range g.repositories {
+		for key, val := range r.ReportedSeverity().Count {
+			if val != nil {
+				findings[key] += *val
+			}
+		}
+	}
+	var counts []string
+	for _, key := range severity.SeverityList {
+		if findings[key] > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", p.displayOf(key).Label, findings[key]))
+		}
+	}
+
+	name := g.namespace
+	if name == "" {
+		name = p.msg().noNamespace
+	}
+	return fmt.Sprintf(p.msg().namespace, name, len(g.repositories), strings.Join(counts, ", "))
+}
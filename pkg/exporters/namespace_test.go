@@ -0,0 +1,82 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+	"github.com/nlopes/slack"
+)
+
+func namespaced() []*api.RepositoryInfo {
+	repository := func(name string, critical int64, high int64) *api.RepositoryInfo {
+		return &api.RepositoryInfo{Name: name, Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(critical), "HIGH": aws.Int64(high)}}}
+	}
+	return []*api.RepositoryInfo{
+		repository("search/indexer", 0, 2),
+		repository("legacy", 1, 0),
+		repository("payments/api", 1, 3),
+		repository("payments/worker", 2, 0),
+	}
+}
+
+func TestGroupByNamespace(t *testing.T) {
+	var p Presentation
+	if groups := p.groupByNamespace(namespaced()); len(groups) != 1 || len(groups[0].repositories) != 4 || p.groupHead(groups[0]) != "" {
+		t.Fatalf("Expected a single group without head when grouping is off, got: %v", groups)
+	}
+
+	p.GroupByNamespace = true
+	var heads []string
+	for _, g := range p.groupByNamespace(namespaced()) {
+		heads = append(heads, p.groupHead(g))
+	}
+	expected := []string{
+		"payments: 2 vulnerable repos, CRITICAL 3, HIGH 3",
+		"search: 1 vulnerable repos, HIGH 2",
+		"without namespace: 1 vulnerable repos, CRITICAL 1",
+	}
+	if strings.Join(heads, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected groups:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(heads, "\n"))
+	}
+}
+
+func TestFormatGroupedByNamespace(t *testing.T) {
+	p := Presentation{GroupByNamespace: true}
+	report := &api.Report{Filtered: namespaced()}
+
+	text, err := p.formatReport(report)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	payments, search := strings.Index(text, "payments: 2 vulnerable repos"), strings.Index(text, "search: 1 vulnerable repos")
+	if payments < 0 || search < payments || strings.Index(text, "payments/worker") > search {
+		t.Fatalf("Expected repositories under their namespace, got: %s", text)
+	}
+
+	slackService.SetPresentation(p)
+	defer slackService.SetPresentation(Presentation{})
+	messages := slackService.messages(report)
+	if head := messages[1].BlockSet[0].(*slack.SectionBlock).Text.Text; head != "*payments: 2 vulnerable repos, CRITICAL 3, HIGH 3*" {
+		t.Fatalf("Expected the first namespace header after the report header, got: %s", head)
+	}
+
+	html, err := p.formatHTML(report)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Count(html, "<table>") != 3 || !strings.Contains(html, "<h2>payments: 2 vulnerable repos, CRITICAL 3, HIGH 3</h2>") || strings.Contains(html, "<details") {
+		t.Fatalf("Expected a table per namespace, got: %s", html)
+	}
+
+	pages, _, err := p.formatDashboard(report, nil, time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if index := pages[dashboardIndexKey]; strings.Count(index, "<details open=\"open\"><summary>") != 3 {
+		t.Fatalf("Expected collapsible namespaces on the dashboard, got: %s", index)
+	}
+}
@@ -0,0 +1,275 @@
+package exporters
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+// A4 page with the standard PDF fonts, which need no embedding
+const (
+	pdfPageWidth   = 595
+	pdfPageHeight  = 842
+	pdfMargin      = 50
+	pdfHeadingSize = 13
+	pdfTextSize    = 9
+	pdfLeading     = 13
+	// Characters of Courier at pdfTextSize fitting between the margins
+	pdfLineLength = 90
+)
+
+// ArchiveStorage stores archived reports, satisfied by api.S3Service
+type ArchiveStorage interface {
+	Put(key string, body []byte, contentType string, cacheControl string) error
+}
+
+// PDFExporter archives each report as a PDF document
+type PDFExporter struct {
+	Presentation
+
+	name    string
+	storage ArchiveStorage
+}
+
+// NewPDFExporter .
+func NewPDFExporter(name string, storage ArchiveStorage) *PDFExporter {
+	return &PDFExporter{
+		name:    name,
+		storage: storage,
+	}
+}
+
+// Name .
+func (p PDFExporter) Name() string {
+	return p.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (p PDFExporter) Format(report *api.Report) (func() error, error) {
+	document := p.formatPDF(report)
+	// Reports are never overwritten, every run leaves its own point-in-time document
+	key := fmt.Sprintf("ecr-scan-report-%s.pdf", time.Now().UTC().Format("20060102T150405Z"))
+
+	return func() error {
+		return p.storage.Put(key, document, "application/pdf", "")
+	}, nil
+}
+
+// formatPDF renders the report as a summary page, the tables of vulnerable repositories and an appendix of the other sections
+func (p Presentation) formatPDF(report *api.Report) []byte {
+	d := newPDFDocument()
+
+	d.heading(p.headText(report.Date))
+	d.text(summary(report))
+	for _, note := range lines(p.formatRun(report) + p.formatPartial(report) + p.formatScanType(report.ScanType)) {
+		d.text(note)
+	}
+	d.space()
+	for _, s := range p.sections(report) {
+		if len(s.repositories) > 0 {
+			d.text(fmt.Sprintf("%s %d", s.head, len(s.repositories)))
+		}
+	}
+
+	d.newPage()
+	vulnerable := p.newHTMLTable("", report.Filtered)
+	if len(vulnerable.Rows) == 0 {
+		d.text(p.msg().clean)
+	} else {
+		d.table(vulnerable)
+	}
+	if pullThrough := p.newHTMLTable(p.msg().pullThroughCache, report.PullThroughCache); len(pullThrough.Rows) > 0 {
+		d.space()
+		d.table(pullThrough)
+	}
+
+	appendix := false
+	for _, s := range p.sections(report) {
+		if len(s.repositories) == 0 {
+			continue
+		}
+		if !appendix {
+			d.newPage()
+			appendix = true
+		}
+		d.heading(s.head)
+		if !s.byCause {
+			d.list(p.listNames(s.repositories))
+			continue
+		}
+		for _, group := range p.groupByCause(s.repositories) {
+			d.text(group.head)
+			d.list(p.listNames(group.repositories))
+		}
+	}
+	if report.SuggestedLifecyclePolicy != "" {
+		d.heading(p.msg().suggestedPolicy)
+		for _, line := range strings.Split(report.SuggestedLifecyclePolicy, "\n") {
+			d.text(line)
+		}
+	}
+	return d.bytes()
+}
+
+// pdfDocument lays out lines of text on pages, starting a new page when one is full
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	y     int
+}
+
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// write places a line at the current position in the font, F1 is Helvetica-Bold and F2 is Courier
+func (d *pdfDocument) write(font string, size int, text string) {
+	if d.y-pdfLeading < pdfMargin {
+		d.newPage()
+	}
+	d.y -= pdfLeading
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, pdfMargin, d.y, pdfEscape(text))
+}
+
+func (d *pdfDocument) heading(text string) {
+	d.space()
+	for _, line := range wrap(text, pdfLineLength*pdfTextSize/pdfHeadingSize) {
+		d.write("F1", pdfHeadingSize, line)
+	}
+	d.space()
+}
+
+func (d *pdfDocument) text(text string) {
+	for _, line := range wrap(text, pdfLineLength) {
+		d.write("F2", pdfTextSize, line)
+	}
+}
+
+func (d *pdfDocument) space() {
+	d.y -= pdfLeading / 2
+}
+
+func (d *pdfDocument) list(names []string) {
+	for _, name := range names {
+		d.text("- " + name)
+	}
+}
+
+// table writes the rows in columns of fixed width, the details of a repository follow its row
+func (d *pdfDocument) table(t htmlTable) {
+	if t.Head != "" {
+		d.heading(t.Head)
+	}
+
+	// Count columns are as wide as the severity level they are headed by
+	width := pdfLineLength
+	for _, level := range t.Levels {
+		width -= len(level) + 2
+	}
+	row := func(name string, counts []string) string {
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("%-*s", width, truncate(name, width-1)))
+		for i, c := range counts {
+			buffer.WriteString(fmt.Sprintf("%*s", len(t.Levels[i])+2, c))
+		}
+		return buffer.String()
+	}
+
+	d.text(row(t.RepositoryHead, t.Levels))
+	d.text(strings.Repeat("-", pdfLineLength))
+	for _, r := range t.Rows {
+		d.text(row(r.Name, r.Counts))
+		for _, detail := range r.Details {
+			d.text("  " + detail)
+		}
+	}
+}
+
+// bytes assembles the document: catalog, page tree, fonts, then a page and its content for each page
+func (d *pdfDocument) bytes() []byte {
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range d.pages {
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+2*i))
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+
+	xref := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buffer.Bytes()
+}
+
+// pdfEscape encodes text for a PDF string in WinAnsiEncoding. The standard fonts only cover Latin-1,
+// other characters are replaced with a question mark.
+func pdfEscape(text string) string {
+	var buffer bytes.Buffer
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			buffer.WriteByte('\\')
+			buffer.WriteByte(byte(r))
+		case r < 0x20 || r > 0xff:
+			buffer.WriteByte('?')
+		default:
+			buffer.WriteByte(byte(r))
+		}
+	}
+	return buffer.String()
+}
+
+// wrap breaks text into lines of at most length characters, at spaces where possible
+func wrap(text string, length int) []string {
+	var result []string
+	runes := []rune(text)
+	for len(runes) > length {
+		cut := length
+		for i := length; i > 0; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		result = append(result, string(runes[:cut]))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(result, string(runes))
+}
+
+// truncate shortens text to at most length characters
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "~"
+}
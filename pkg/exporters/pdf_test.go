@@ -0,0 +1,76 @@
+package exporters
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+type fakeArchiveStorage struct {
+	key         string
+	body        []byte
+	contentType string
+}
+
+func (f *fakeArchiveStorage) Put(key string, body []byte, contentType string, cacheControl string) error {
+	f.key, f.body, f.contentType = key, body, contentType
+	return nil
+}
+
+func TestPDFSend(t *testing.T) {
+	storage := &fakeArchiveStorage{}
+	p := NewPDFExporter("pdf", storage)
+
+	send, err := p.Format(&api.Report{
+		Filtered: pushgatewayInput,
+		Failed:   []*api.RepositoryInfo{{Name: "TestRepo/Failed(1)", Cause: "AccessDenied"}},
+	})
+	if err != nil {
+		t.Fatalf("Error formatting PDF: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error archiving PDF: %s", err)
+	}
+
+	if !strings.HasPrefix(storage.key, "ecr-scan-report-") || !strings.HasSuffix(storage.key, ".pdf") || storage.contentType != "application/pdf" {
+		t.Fatalf("Unexpected object %s of type %s", storage.key, storage.contentType)
+	}
+	if !bytes.HasPrefix(storage.body, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(storage.body, []byte("%%EOF\n")) {
+		t.Fatalf("Expected a PDF document, got: %s", storage.body)
+	}
+	// Summary, vulnerable repositories and the appendix of failures
+	if !bytes.Contains(storage.body, []byte("/Count 3")) {
+		t.Fatalf("Expected 3 pages, got: %s", storage.body)
+	}
+	for _, text := range []string{"(TestRepository/TestRepo1", "(- TestRepo/Failed\\(1\\))"} {
+		if !bytes.Contains(storage.body, []byte(text)) {
+			t.Fatalf("Expected the document to contain %s, got: %s", text, storage.body)
+		}
+	}
+}
+
+func TestPDFEscape(t *testing.T) {
+	if escaped := pdfEscape(`a(b)\ä日`); escaped != "a\\(b\\)\\\\\xe4?" {
+		t.Fatalf("Unexpected escaped text: %q", escaped)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "short", expected: []string{"short"}},
+		{text: "split at the last space", expected: []string{"split at", "the last", "space"}},
+		{text: "unbreakable", expected: []string{"unbreaka", "ble"}},
+	}
+
+	for i, c := range cases {
+		if lines := wrap(c.text, 8); !reflect.DeepEqual(lines, c.expected) {
+			t.Fatalf("[%d] values are not equal, wanting: %q, got: %q", i, c.expected, lines)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package exporters
+
+import (
+	"fmt"
+	"time"
+)
+
+// Presentation decides how the reports are worded and laid out. The zero value presents them in the default
+// locale and date format, in UTC, with the default severity display and without grouping or compliance controls.
+type Presentation struct {
+	// Language of the messages, one of Locales(), DefaultLocale when empty
+	Locale string
+	// Go time layout of the dates, DefaultDateFormat when empty
+	DateFormat string
+	// Time zone of the dates, UTC when nil
+	Location *time.Location
+	// List vulnerable repositories in groups by namespace, the part of their name before the first /,
+	// each group headed by its subtotals
+	GroupByNamespace bool
+	// How severity levels are presented, see ParseSeverityDisplay, the defaults when nil
+	SeverityDisplay map[string]SeverityDisplay
+	// Frameworks whose controls are referenced, see ParseComplianceFrameworks
+	ComplianceFrameworks []string
+}
+
+// PresentingExporter is an exporter whose reports follow a Presentation, the defaults until one is set
+type PresentingExporter interface {
+	Exporter
+	SetPresentation(presentation Presentation)
+}
+
+// SetPresentation makes the reports formatted from now on follow presentation
+func (p *Presentation) SetPresentation(presentation Presentation) {
+	*p = presentation
+}
+
+// msg returns the messages of the locale, the default locale's unless it is supported
+func (p Presentation) msg() messages {
+	if m, ok := locales[p.Locale]; ok {
+		return m
+	}
+	return locales[DefaultLocale]
+}
+
+func (p Presentation) dateFormat() string {
+	if p.DateFormat == "" {
+		return DefaultDateFormat
+	}
+	return p.DateFormat
+}
+
+func (p Presentation) location() *time.Location {
+	if p.Location == nil {
+		return time.UTC
+	}
+	return p.Location
+}
+
+// reportDate returns the date of the report in the time zone of the presentation, now when the report has none
+func (p Presentation) reportDate(date time.Time) time.Time {
+	if date.IsZero() {
+		date = time.Now()
+	}
+	return date.In(p.location())
+}
+
+// headText returns the report header of the date
+func (p Presentation) headText(date time.Time) string {
+	return fmt.Sprintf(p.msg().head, p.reportDate(date).Format(p.dateFormat()))
+}
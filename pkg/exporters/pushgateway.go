@@ -0,0 +1,164 @@
+package exporters
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+const pushgatewayJob = "ecr_scan_lambda"
+
+// PushgatewayExporter pushes report metrics to a Prometheus Pushgateway
+type PushgatewayExporter struct {
+	client   *http.Client
+	name     string
+	url      string
+	registry string
+	region   string
+	// Push the fetch duration and failure of each repository, a series per repository
+	repositoryMetrics bool
+}
+
+// NewPushgatewayExporter .
+func NewPushgatewayExporter(name string, url string, registry string, region string, repositoryMetrics bool) *PushgatewayExporter {
+	if registry == "" {
+		registry = "default"
+	}
+
+	return &PushgatewayExporter{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		name:     name,
+		url:      strings.TrimSuffix(url, "/"),
+		registry: registry,
+		region:   region,
+
+		repositoryMetrics: repositoryMetrics,
+	}
+}
+
+// Name .
+func (p PushgatewayExporter) Name() string {
+	return p.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (p PushgatewayExporter) Format(report *api.Report) (func() error, error) {
+	body := p.format(report, time.Now())
+
+	return func() error {
+		req, err := http.NewRequest(http.MethodPut, p.endpoint(), bytes.NewBufferString(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("Pushgateway responded with status %d", resp.StatusCode)
+		}
+		return nil
+	}, nil
+}
+
+// endpoint builds the grouping key path the metrics are pushed to
+func (p PushgatewayExporter) endpoint() string {
+	return fmt.Sprintf("%s/metrics/job/%s/registry/%s/region/%s",
+		p.url,
+		pushgatewayJob,
+		url.PathEscape(p.registry),
+		url.PathEscape(p.region),
+	)
+}
+
+// format renders scan results in the Prometheus text exposition format
+func (p PushgatewayExporter) format(report *api.Report, now time.Time) string {
+	findings := countFindings(report.Filtered)
+
+	var buffer bytes.Buffer
+	buffer.WriteString("# TYPE ecr_scan_vulnerable_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_vulnerable_repositories %d\n", len(report.Filtered)))
+	buffer.WriteString("# TYPE ecr_scan_pull_through_cache_vulnerable_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_pull_through_cache_vulnerable_repositories %d\n", len(report.PullThroughCache)))
+	buffer.WriteString("# TYPE ecr_scan_failed_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_failed_repositories %d\n", len(report.Failed)))
+	buffer.WriteString("# TYPE ecr_scan_empty_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_empty_repositories %d\n", len(report.Empty)))
+	buffer.WriteString("# TYPE ecr_scan_not_scanned_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_not_scanned_repositories %d\n", len(report.NotScanned)))
+	buffer.WriteString("# TYPE ecr_scan_scan_on_push_disabled_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_scan_on_push_disabled_repositories %d\n", len(report.ScanOnPushDisabled)))
+	buffer.WriteString("# TYPE ecr_scan_not_covered_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_not_covered_repositories %d\n", len(report.NotCovered)))
+	buffer.WriteString("# TYPE ecr_scan_public_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_public_repositories %d\n", len(report.Public)))
+	buffer.WriteString("# TYPE ecr_scan_stale_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_stale_repositories %d\n", len(report.Stale)))
+	buffer.WriteString("# TYPE ecr_scan_untagged_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_untagged_repositories %d\n", len(report.Untagged)))
+	buffer.WriteString("# TYPE ecr_scan_no_lifecycle_policy_repositories gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_no_lifecycle_policy_repositories %d\n", len(report.NoLifecyclePolicy)))
+	buffer.WriteString("# TYPE ecr_scan_findings gauge\n")
+	for _, key := range severity.SeverityList {
+		buffer.WriteString(fmt.Sprintf("ecr_scan_findings{severity=\"%s\"} %d\n", key, findings[key]))
+	}
+	if len(report.Fetches) > 0 {
+		p.formatFetches(&buffer, report.Fetches)
+	}
+	buffer.WriteString("# TYPE ecr_scan_last_run_timestamp_seconds gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_last_run_timestamp_seconds %d\n", now.Unix()))
+	if report.RunID != "" {
+		buffer.WriteString("# TYPE ecr_scan_last_run_info gauge\n")
+		buffer.WriteString(fmt.Sprintf("ecr_scan_last_run_info{run_id=\"%s\",fingerprint=\"%s\"} 1\n", report.RunID, report.Fingerprint()))
+	}
+	return buffer.String()
+}
+
+// formatFetches renders how long retrieving the findings of repositories took and how many of them failed,
+// per repository too when repositoryMetrics is set
+func (p PushgatewayExporter) formatFetches(buffer *bytes.Buffer, fetches []report.Fetch) {
+	var total, longest time.Duration
+	failed := 0
+	for _, f := range fetches {
+		total += f.Duration
+		if f.Duration > longest {
+			longest = f.Duration
+		}
+		if f.Failed {
+			failed++
+		}
+	}
+	buffer.WriteString("# TYPE ecr_scan_fetch_seconds_total gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_fetch_seconds_total %g\n", total.Seconds()))
+	buffer.WriteString("# TYPE ecr_scan_fetch_seconds_max gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_fetch_seconds_max %g\n", longest.Seconds()))
+	buffer.WriteString("# TYPE ecr_scan_fetch_errors gauge\n")
+	buffer.WriteString(fmt.Sprintf("ecr_scan_fetch_errors %d\n", failed))
+	if !p.repositoryMetrics {
+		return
+	}
+
+	buffer.WriteString("# TYPE ecr_scan_repository_fetch_seconds gauge\n")
+	for _, f := range fetches {
+		buffer.WriteString(fmt.Sprintf("ecr_scan_repository_fetch_seconds{repository=\"%s\"} %g\n", f.Repository, f.Duration.Seconds()))
+	}
+	buffer.WriteString("# TYPE ecr_scan_repository_fetch_failed gauge\n")
+	for _, f := range fetches {
+		value := 0
+		if f.Failed {
+			value = 1
+		}
+		buffer.WriteString(fmt.Sprintf("ecr_scan_repository_fetch_failed{repository=\"%s\"} %d\n", f.Repository, value))
+	}
+}
@@ -0,0 +1,166 @@
+package exporters
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+var pushgatewayInput = []*api.RepositoryInfo{
+	{
+		Name: "TestRepository/TestRepo1",
+		Severity: severity.Matrix{
+			Count: map[string]*int64{
+				"CRITICAL": aws.Int64(1),
+				"HIGH":     aws.Int64(2),
+			},
+		},
+	},
+	{
+		Name: "TestRepository/TestRepo2",
+		Severity: severity.Matrix{
+			Count: map[string]*int64{
+				"CRITICAL": aws.Int64(3),
+				"LOW":      aws.Int64(4),
+			},
+		},
+	},
+}
+
+func TestPushgatewayFormat(t *testing.T) {
+	expected := `# TYPE ecr_scan_vulnerable_repositories gauge
+ecr_scan_vulnerable_repositories 2
+# TYPE ecr_scan_pull_through_cache_vulnerable_repositories gauge
+ecr_scan_pull_through_cache_vulnerable_repositories 0
+# TYPE ecr_scan_failed_repositories gauge
+ecr_scan_failed_repositories 1
+# TYPE ecr_scan_empty_repositories gauge
+ecr_scan_empty_repositories 0
+# TYPE ecr_scan_not_scanned_repositories gauge
+ecr_scan_not_scanned_repositories 0
+# TYPE ecr_scan_scan_on_push_disabled_repositories gauge
+ecr_scan_scan_on_push_disabled_repositories 0
+# TYPE ecr_scan_not_covered_repositories gauge
+ecr_scan_not_covered_repositories 0
+# TYPE ecr_scan_public_repositories gauge
+ecr_scan_public_repositories 0
+# TYPE ecr_scan_stale_repositories gauge
+ecr_scan_stale_repositories 0
+# TYPE ecr_scan_untagged_repositories gauge
+ecr_scan_untagged_repositories 0
+# TYPE ecr_scan_no_lifecycle_policy_repositories gauge
+ecr_scan_no_lifecycle_policy_repositories 0
+# TYPE ecr_scan_findings gauge
+ecr_scan_findings{severity="CRITICAL"} 4
+ecr_scan_findings{severity="HIGH"} 2
+ecr_scan_findings{severity="MEDIUM"} 0
+ecr_scan_findings{severity="LOW"} 4
+ecr_scan_findings{severity="INFORMATIONAL"} 0
+ecr_scan_findings{severity="UNTRIAGED"} 0
+ecr_scan_findings{severity="UNDEFINED"} 0
+# TYPE ecr_scan_last_run_timestamp_seconds gauge
+ecr_scan_last_run_timestamp_seconds 1595116800
+`
+	p := NewPushgatewayExporter("prometheus", "http://localhost:9091", "", "us-east-1", false)
+	report := &api.Report{
+		Filtered: pushgatewayInput,
+		Failed:   []*api.RepositoryInfo{{Name: "TestRepo/Failed1"}},
+	}
+
+	body := p.format(report, time.Unix(1595116800, 0))
+	if !reflect.DeepEqual(body, expected) {
+		t.Fatalf("Error formatting metrics => wanted: \n%s, got: \n%s", expected, body)
+	}
+}
+
+func TestPushgatewaySend(t *testing.T) {
+	var path, method string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		method = r.Method
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	p := NewPushgatewayExporter("prometheus", server.URL+"/", "123456789012", "us-east-1", false)
+	send, err := p.Format(&api.Report{Filtered: pushgatewayInput})
+	if err != nil {
+		t.Fatalf("Error formatting metrics: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error pushing metrics: %s", err)
+	}
+
+	expectedPath := "/metrics/job/ecr_scan_lambda/registry/123456789012/region/us-east-1"
+	if path != expectedPath {
+		t.Fatalf("Wrong grouping key, wanted => %s, got => %s", expectedPath, path)
+	}
+	if method != http.MethodPut {
+		t.Fatalf("Wrong method, wanted => %s, got => %s", http.MethodPut, method)
+	}
+	if len(body) == 0 {
+		t.Fatalf("Pushed metrics body is empty")
+	}
+}
+
+func TestPushgatewaySendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	p := NewPushgatewayExporter("prometheus", server.URL, "", "us-east-1", false)
+	send, err := p.Format(&api.Report{Filtered: pushgatewayInput})
+	if err != nil {
+		t.Fatalf("Error formatting metrics: %s", err)
+	}
+	if err := send(); err == nil {
+		t.Fatalf("Expected error on non 2xx response")
+	}
+}
+
+func TestPushgatewayFetches(t *testing.T) {
+	report := &api.Report{
+		Fetches: []report.Fetch{
+			{Repository: "TestRepository/TestRepo1", Duration: 1500 * time.Millisecond},
+			{Repository: "TestRepo/Failed1", Duration: 250 * time.Millisecond, Failed: true},
+		},
+	}
+	expected := `# TYPE ecr_scan_fetch_seconds_total gauge
+ecr_scan_fetch_seconds_total 1.75
+# TYPE ecr_scan_fetch_seconds_max gauge
+ecr_scan_fetch_seconds_max 1.5
+# TYPE ecr_scan_fetch_errors gauge
+ecr_scan_fetch_errors 1
+`
+	perRepository := `# TYPE ecr_scan_repository_fetch_seconds gauge
+ecr_scan_repository_fetch_seconds{repository="TestRepository/TestRepo1"} 1.5
+ecr_scan_repository_fetch_seconds{repository="TestRepo/Failed1"} 0.25
+# TYPE ecr_scan_repository_fetch_failed gauge
+ecr_scan_repository_fetch_failed{repository="TestRepository/TestRepo1"} 0
+ecr_scan_repository_fetch_failed{repository="TestRepo/Failed1"} 1
+`
+
+	for _, repositoryMetrics := range []bool{false, true} {
+		p := NewPushgatewayExporter("prometheus", "http://localhost:9091", "", "us-east-1", repositoryMetrics)
+		body := p.format(report, time.Unix(1595116800, 0))
+		want := expected
+		if repositoryMetrics {
+			want += perRepository
+		}
+		if !strings.Contains(body, want+"# TYPE ecr_scan_last_run_timestamp_seconds gauge\n") {
+			t.Fatalf("[%v] Error formatting fetch metrics => wanted: \n%s, got: \n%s", repositoryMetrics, want, body)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package exporters
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// Redaction modes, how the names of sensitive repositories are replaced
+const (
+	// Every name is replaced by the same mask
+	RedactMask = "mask"
+	// Each name is replaced by a short hash of it, so a repository can be followed across reports
+	RedactHash = "hash"
+)
+
+const redactedName = "[redacted]"
+
+// Redactor replaces the names of repositories matching sensitive patterns
+type Redactor struct {
+	patterns []string
+	mode     string
+}
+
+// ParseRedactor creates a redactor of comma separated repository patterns, nil when there are none
+func ParseRedactor(patterns string, mode string) *Redactor {
+	r := &Redactor{mode: mode}
+	for _, p := range strings.Split(patterns, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			r.patterns = append(r.patterns, p)
+		}
+	}
+	if len(r.patterns) == 0 {
+		return nil
+	}
+	return r
+}
+
+// Redact returns the name shown of the repository, the name itself unless it matches a pattern
+func (r *Redactor) Redact(name string) string {
+	for _, p := range r.patterns {
+		if !api.WildcardMatch(p, name) {
+			continue
+		}
+		if r.mode == RedactHash {
+			sum := sha256.Sum256([]byte(name))
+			return "redacted-" + hex.EncodeToString(sum[:])[:8]
+		}
+		return redactedName
+	}
+	return name
+}
+
+// redactedExporter sends reports with the names of sensitive repositories redacted
+type redactedExporter struct {
+	Exporter
+	redactor *Redactor
+}
+
+// Format clousure formats the redacted report and returns a function that sends it on invocation
+func (e redactedExporter) Format(report *api.Report) (func() error, error) {
+	return e.Exporter.Format(report.Redacted(e.redactor.Redact))
+}
+
+// redactedDigestExporter sends digests with the names of sensitive repositories redacted as well
+type redactedDigestExporter struct {
+	redactedExporter
+	digest DigestExporter
+}
+
+// FormatDigest formats the redacted digest and returns a function that sends it on invocation
+func (e redactedDigestExporter) FormatDigest(digest *report.Digest) (func() error, error) {
+	return e.digest.FormatDigest(digest.Redacted(e.redactor.Redact))
+}
+
+// Redacted wraps the exporter to redact the names of sensitive repositories, e.g.: for widely readable channels
+func Redacted(e Exporter, redactor *Redactor) Exporter {
+	wrapped := redactedExporter{Exporter: e, redactor: redactor}
+	if d, ok := e.(DigestExporter); ok {
+		return redactedDigestExporter{redactedExporter: wrapped, digest: d}
+	}
+	return wrapped
+}
+
+// Unwrap returns the exporter Redacted wrapped, the exporter itself when it isn't wrapped
+func Unwrap(e Exporter) Exporter {
+	switch w := e.(type) {
+	case redactedExporter:
+		return w.Exporter
+	case redactedDigestExporter:
+		return w.Exporter
+	}
+	return e
+}
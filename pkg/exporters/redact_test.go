@@ -0,0 +1,79 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+// captureExporter keeps the last report it formatted
+type captureExporter struct {
+	report *api.Report
+}
+
+func (c *captureExporter) Name() string {
+	return "capture"
+}
+
+func (c *captureExporter) Format(report *api.Report) (func() error, error) {
+	c.report = report
+	return func() error { return nil }, nil
+}
+
+func TestRedactor(t *testing.T) {
+	if ParseRedactor(" , ", RedactMask) != nil {
+		t.Fatalf("Expected no redactor without patterns")
+	}
+
+	mask := ParseRedactor("payments/*, secret", RedactMask)
+	cases := map[string]string{
+		"payments/api": redactedName,
+		"secret":       redactedName,
+		"search/api":   "search/api",
+	}
+	for name, expected := range cases {
+		if redacted := mask.Redact(name); redacted != expected {
+			t.Fatalf("Expected %s to be shown as %s, got: %s", name, expected, redacted)
+		}
+	}
+
+	hash := ParseRedactor("payments/*", RedactHash)
+	first, second := hash.Redact("payments/api"), hash.Redact("payments/worker")
+	if !strings.HasPrefix(first, "redacted-") || len(first) != len("redacted-")+8 || first == second || first != hash.Redact("payments/api") {
+		t.Fatalf("Expected distinct stable hashes, got: %s %s", first, second)
+	}
+}
+
+func TestRedactedExporter(t *testing.T) {
+	capture := &captureExporter{}
+	e := Redacted(capture, ParseRedactor("payments/*", RedactMask))
+	if Unwrap(e) != capture {
+		t.Fatalf("Expected the wrapped exporter to be unwrapped")
+	}
+
+	report := &api.Report{
+		Filtered: []*api.RepositoryInfo{
+			{Name: "payments/api", Link: "https://console.aws.amazon.com/ecr/repositories/payments/api"},
+			{Name: "search/api", Link: "https://console.aws.amazon.com/ecr/repositories/search/api"},
+		},
+		NotScanned: []*api.RepositoryInfo{{Name: "payments/worker"}},
+	}
+	if _, err := e.Format(report); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	redacted := capture.report
+	if r := redacted.Filtered[0]; r.Name != redactedName || r.Link != "" {
+		t.Fatalf("Expected the name and link of payments/api to be redacted, got: %s %s", r.Name, r.Link)
+	}
+	if r := redacted.Filtered[1]; r.Name != "search/api" || r.Link == "" {
+		t.Fatalf("Expected search/api to be left alone, got: %s %s", r.Name, r.Link)
+	}
+	if redacted.NotScanned[0].Name != redactedName {
+		t.Fatalf("Expected the sections to be redacted as well, got: %s", redacted.NotScanned[0].Name)
+	}
+	if report.Filtered[0].Name != "payments/api" {
+		t.Fatalf("Expected the original report to be left alone, got: %s", report.Filtered[0].Name)
+	}
+}
@@ -2,98 +2,422 @@ package exporters
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
 	"github.com/nlopes/slack"
 )
 
+// SlackClient is the part of the Slack API used by SlackService, satisfied by *slack.Client
+type SlackClient interface {
+	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
+}
+
 // SlackService data structure for storing slack client related data
 type SlackService struct {
-	client  *slack.Client
-	channel string
-	name    string
+	Presentation
+
+	client       SlackClient
+	channel      string
+	name         string
+	options      []slack.Option
+	refreshToken func() (string, error)
+	fallback     func(payload []byte) error
+	escalation   Escalation
+	timeout      time.Duration
+	chart        Chart
+	logger       *logger.Logger
+}
+
+// Escalation calls attention to repositories with findings of Severity or above, so they aren't missed among routine ones
+type Escalation struct {
+	// Who to notify: @here, @channel, a user group ID (S0123ABCD) or a user ID (U0123ABCD)
+	Mention  string
+	Severity string
+	// Inline prepends the mention to the message of each escalated repository
+	Inline bool
+	// Separate posts a message listing the escalated repositories right after the report header
+	Separate bool
+}
+
+// slackPayload holds messages queued while Slack is unavailable
+type slackPayload struct {
+	Channel  string         `json:"channel"`
+	Messages []slack.Blocks `json:"messages"`
+}
+
+// authErrors are returned by Slack when the token is no longer valid
+var authErrors = map[string]bool{
+	"invalid_auth":  true,
+	"not_authed":    true,
+	"token_expired": true,
+	"token_revoked": true,
 }
 
 // NewSlackExporter populates a new SlackService instance
-func NewSlackExporter(name string, token string, channel string) *SlackService {
+func NewSlackExporter(name string, token string, channel string, options ...slack.Option) *SlackService {
 	return &SlackService{
-		client:  slack.New(token),
+		client:  slack.New(token, options...),
 		channel: channel,
 		name:    name,
+		options: options,
 	}
 }
 
+// NewSlackExporterWithClient populates a new SlackService instance posting through client
+func NewSlackExporterWithClient(name string, client SlackClient, channel string) *SlackService {
+	return &SlackService{
+		client:  client,
+		channel: channel,
+		name:    name,
+	}
+}
+
+// WithTokenRefresh makes the exporter fetch a new token and retry once when Slack rejects the current one,
+// e.g.: after the token was rotated. The new token is kept for the reports sent later.
+func (s *SlackService) WithTokenRefresh(refresh func() (string, error)) *SlackService {
+	s.refreshToken = refresh
+	return s
+}
+
+// SetLogger makes the exporter log under l from now on, the logger of the run sending the next reports
+func (s *SlackService) SetLogger(l *logger.Logger) {
+	s.logger = l
+}
+
+// WithFallback makes the exporter hand the messages it can't post to queue while Slack is unavailable,
+// e.g.: sending them to an SQS queue. Replay posts them later.
+func (s *SlackService) WithFallback(queue func(payload []byte) error) *SlackService {
+	s.fallback = queue
+	return s
+}
+
+// WithEscalation makes the exporter mention e.Mention for repositories with findings of e.Severity or above
+func (s *SlackService) WithEscalation(e Escalation) *SlackService {
+	s.escalation = e
+	return s
+}
+
+// WithTimeout cancels each post not answered within timeout, so a hung connection can't hold up the report
+func (s *SlackService) WithTimeout(timeout time.Duration) *SlackService {
+	s.timeout = timeout
+	return s
+}
+
+// WithChart makes the exporter attach a bar chart of the findings per severity level to the report header
+func (s *SlackService) WithChart(c Chart) *SlackService {
+	s.chart = c
+	return s
+}
+
 // Name .
 func (s SlackService) Name() string {
 	return s.name
 }
 
 // Format clousure formats scan results and returns a function that sends report on invocation
-func (s SlackService) Format(filtered []*api.RepositoryInfo, failed []*api.RepositoryInfo) (func() error, error) {
-	var failedMsgBuffer bytes.Buffer
-	if len(failed) > 0 {
-		failedMsgBuffer.WriteString(boldn(reportFailedHeadText))
+func (s *SlackService) Format(report *api.Report) (func() error, error) {
+	messages := s.messages(report)
+	chart, key, err := s.attachChart(report, messages)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, f := range failed {
-			failedMsgBuffer.WriteString(f.Name + "\n")
+	// Send publishes message to provided slack channel
+	return func() error {
+		// Uploaded first, Slack fetches the image when the header is posted
+		if chart != nil {
+			if err := s.chart.Storage.Put(key, chart, "image/png", ""); err != nil {
+				return fmt.Errorf("Error uploading severity chart %s: %s", key, err)
+			}
 		}
+		_, err := s.deliver(s.channel, messages)
+		return err
+	}, nil
+}
+
+// attachChart renders the severity chart of the report and links it from the header message, returns the chart
+// and the key to upload it under. There is no chart without findings or when the exporter has none.
+func (s *SlackService) attachChart(report *api.Report, messages []slack.Blocks) ([]byte, string, error) {
+	if s.chart.Storage == nil {
+		return nil, "", nil
+	}
+	findings := countFindings(report.Filtered)
+	chart, err := s.renderHistogram(findings)
+	if err != nil || chart == nil {
+		return nil, "", err
+	}
+	key := histogramKey(report, time.Now().UTC().Format("20060102T150405Z"))
+	image := slack.NewImageBlock(s.chart.histogramURL(key), s.histogramText(findings), "", nil)
+	messages[0].BlockSet = append(messages[0].BlockSet, image)
+	return chart, key, nil
+}
+
+// messages renders the report as Slack messages in posting order
+func (s *SlackService) messages(report *api.Report) []slack.Blocks {
+	text := func(message string) slack.Blocks {
+		return slack.Blocks{BlockSet: []slack.Block{s.GenerateTextBlock(message)}}
 	}
 
-	failedMsg := failedMsgBuffer.String()
+	head := bold(s.headText(report.Date))
+	if run := s.formatRun(report); run != "" {
+		head += "\n_" + escapeMrkdwn(strings.TrimSuffix(run, "\n")) + "_"
+	}
+	messages := []slack.Blocks{text(head)}
+	if partial := s.formatPartial(report); partial != "" {
+		messages = append(messages, text(":warning: "+partial))
+	}
+	if s.escalation.Separate {
+		vulnerable := append(append([]*api.RepositoryInfo{}, report.Filtered...), report.PullThroughCache...)
+		if escalated := s.escalated(vulnerable); len(escalated) > 0 {
+			head := mention(s.escalation.Mention) + " " + fmt.Sprintf(s.msg().escalation, s.escalation.Severity)
+			messages = append(messages, text(s.formatList(head, escalated)))
+		}
+	}
+	if len(report.Filtered) == 0 {
+		messages = append(messages, text(s.msg().clean))
+	}
+	for _, g := range s.groupByNamespace(report.Filtered) {
+		if head := s.groupHead(g); head != "" {
+			messages = append(messages, text(bold(escapeMrkdwn(head))))
+		}
+		for _, r := range g.repositories {
+			messages = append(messages, s.repositoryMessage(r))
+		}
+	}
 
-	// Send publishes message to provided slack channel
-	return func() error {
-		err := s.PostStandaloneMessage(bold(reportHeadText))
-		if err != nil {
-			return err
+	if len(report.PullThroughCache) > 0 {
+		messages = append(messages, text(bold(s.msg().pullThroughCache)))
+		for _, r := range report.PullThroughCache {
+			messages = append(messages, s.repositoryMessage(r))
 		}
+	}
 
-		if len(filtered) == 0 {
-			return s.PostStandaloneMessage(reportClean)
+	lists := []string{s.formatScanType(report.ScanType)}
+	for _, l := range s.sections(report) {
+		lists = append(lists, s.formatSection(l))
+	}
+	if report.SuggestedLifecyclePolicy != "" {
+		lists = append(lists, boldn(s.msg().suggestedPolicy)+"```"+escapeEntities(report.SuggestedLifecyclePolicy)+"```")
+	}
+	for _, msg := range lists {
+		if len(msg) != 0 {
+			messages = append(messages, text(msg))
 		}
+	}
+	return messages
+}
+
+// repositoryMessage renders the message of a vulnerable repository, mentioning the escalation when inline
+func (s *SlackService) repositoryMessage(r *api.RepositoryInfo) slack.Blocks {
+	blocks := s.BuildMessageBlock(r)
+	if s.escalation.Inline && len(s.escalated([]*api.RepositoryInfo{r})) > 0 {
+		blocks = append([]slack.Block{s.GenerateTextBlock(mention(s.escalation.Mention))}, blocks...)
+	}
+	return slack.Blocks{BlockSet: blocks}
+}
+
+// escalated returns the repositories with findings of the escalation severity or above, and overdue ones
+func (s *SlackService) escalated(repositories []*api.RepositoryInfo) []*api.RepositoryInfo {
+	if s.escalation.Mention == "" {
+		return nil
+	}
 
-		for _, r := range filtered {
-			blockParts := s.BuildMessageBlock(r)
-			channelID, timestamp, err := s.PostMessage(blockParts...)
-			if err != nil {
-				return err
+	var escalated []*api.RepositoryInfo
+	for _, r := range repositories {
+		if r.Overdue {
+			escalated = append(escalated, r)
+			continue
+		}
+		for _, count := range r.Severity.AtLeast(s.escalation.Severity).Count {
+			if count != nil && *count > 0 {
+				escalated = append(escalated, r)
+				break
 			}
+		}
+	}
+	return escalated
+}
+
+// mention formats who to notify in Slack's syntax
+func mention(who string) string {
+	switch {
+	case who == "@here" || who == "@channel" || who == "@everyone":
+		return "<!" + who[1:] + ">"
+	case strings.HasPrefix(who, "S"):
+		return "<!subteam^" + who + ">"
+	default:
+		return "<@" + who + ">"
+	}
+}
+
+// deliver posts messages to channel in order. When Slack is unavailable and a fallback is set,
+// the messages not posted yet are handed to the fallback and queued is true.
+func (s *SlackService) deliver(channel string, messages []slack.Blocks) (queued bool, err error) {
+	for i, m := range messages {
+		channelID, timestamp, err := s.post(channel, m.BlockSet...)
+		if err == nil {
 			fmt.Printf("Message successfully sent to channel %s at %s\n", channelID, timestamp)
+			continue
 		}
 
-		if len(failedMsg) != 0 {
-			err := s.PostStandaloneMessage(failedMsg)
-			if err != nil {
-				return err
-			}
+		if s.fallback == nil || !unavailable(err) {
+			return false, err
 		}
 
-		return nil
-	}, nil
+		payload, marshalErr := json.Marshal(slackPayload{Channel: channel, Messages: messages[i:]})
+		if marshalErr != nil {
+			return false, marshalErr
+		}
+		if fallbackErr := s.fallback(payload); fallbackErr != nil {
+			return false, fmt.Errorf("%s, queueing the report failed: %s", err, fallbackErr)
+		}
+		fmt.Printf("Slack is unavailable (%s), queued %d messages\n", err, len(messages)-i)
+		return true, nil
+	}
+	return false, nil
 }
 
-// BuildMessageBlock constructs severity related message body
-func (s *SlackService) BuildMessageBlock(r *api.RepositoryInfo) []slack.Block {
-	headerSection := s.GenerateTextBlock(fmt.Sprintf("Vulnerabilities found in *%s*:", r.Name))
-	linkSection := s.GenerateTextBlock(fmt.Sprintf("View detailed scan results <%s| on ECR console>", r.Link))
+// Replay posts messages queued by the fallback, to the channel they were meant for.
+// When Slack is still unavailable, the messages not posted yet are queued again and queued is true.
+func (s *SlackService) Replay(payload []byte) (queued bool, err error) {
+	var p slackPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return false, fmt.Errorf("Error parsing queued Slack messages: %s", err)
+	}
+	return s.deliver(p.Channel, p.Messages)
+}
+
+// unavailable reports whether the error means Slack itself is down, rather than the request being wrong
+func unavailable(err error) bool {
+	if status, ok := err.(interface{ HTTPStatusCode() int }); ok {
+		return status.HTTPStatusCode() >= 500
+	}
+	_, ok := err.(net.Error)
+	if !ok {
+		if uerr, isURL := err.(*url.Error); isURL {
+			_, ok = uerr.Err.(net.Error)
+		}
+	}
+	return ok
+}
+
+// formatSection creates the list of a section, with failed repositories grouped under italic cause headers
+func (s SlackService) formatSection(l section) string {
+	if !l.byCause || len(l.repositories) == 0 {
+		return s.formatList(l.head, l.repositories)
+	}
 
 	var buffer bytes.Buffer
+	buffer.WriteString(boldn(l.head))
+	for _, group := range s.groupByCause(l.repositories) {
+		buffer.WriteString("_" + escapeMrkdwn(group.head) + "_\n")
+		for _, r := range group.repositories {
+			buffer.WriteString(escapeMrkdwn(s.listName(r)) + "\n")
+		}
+	}
+	return buffer.String()
+}
+
+// formatList creates a list of repository names under a bold header
+func (s SlackService) formatList(head string, repositories []*api.RepositoryInfo) string {
+	var buffer bytes.Buffer
+	if len(repositories) > 0 {
+		buffer.WriteString(boldn(head))
+
+		for _, r := range repositories {
+			buffer.WriteString(escapeMrkdwn(s.listName(r)) + "\n")
+		}
+	}
+	return buffer.String()
+}
+
+// BuildMessageBlock constructs severity related message body: the repository, led by the emoji of its worst
+// severity level, the image details as context,
+// the severity counts in two columns, each linking to its findings on the console, and the console link
+func (s *SlackService) BuildMessageBlock(r *api.RepositoryInfo) []slack.Block {
+	header := fmt.Sprintf(s.msg().found, bold(escapeMrkdwn(r.DisplayName())))
+	if emoji := s.displayOf(r.WorstSeverity()).Emoji; emoji != "" {
+		header = emoji + " " + header
+	}
+	blocks := []slack.Block{s.GenerateTextBlock(header)}
+
+	var context []slack.MixedElement
+	for _, detail := range []string{s.imageDetails(r), s.baseImageText(r)} {
+		if detail != "" {
+			context = append(context, slack.NewTextBlockObject("mrkdwn", escapeMrkdwn(detail), false, false))
+		}
+	}
+	if len(context) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("", context...))
+	}
+
+	var fields []*slack.TextBlockObject
+	reported := r.ReportedSeverity()
 	for _, key := range severity.SeverityList {
-		if val, ok := r.Severity.Count[key]; ok {
-			buffer.WriteString(fmt.Sprintf("%s *%d*\n", key, *val))
+		if val, ok := reported.Count[key]; ok {
+			label := s.severityText(key)
+			if link := severityLink(r.Link, key); link != "" {
+				label = fmt.Sprintf("<%s|%s>", link, label)
+			}
+			fields = append(fields, slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("%s *%d*", label, *val), false, false))
 		}
 	}
-	severitySection := s.GenerateTextBlock(buffer.String())
+	if len(fields) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(nil, fields, nil))
+	}
+	if packages := strings.TrimSuffix(s.packagesText(r), "\n"); packages != "" {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", escapeMrkdwn(packages), false, false)))
+	}
 
-	return []slack.Block{
-		headerSection,
-		severitySection,
-		linkSection,
-		slack.NewDividerBlock(),
+	// Redacted repositories have no link
+	if r.Link != "" {
+		blocks = append(blocks, s.GenerateTextBlock(fmt.Sprintf(s.msg().slackLink, r.Link)))
 	}
+	return append(blocks, slack.NewDividerBlock())
+}
+
+// severityLink returns the console scan results of the image filtered to the severity level, empty without a link
+func severityLink(link string, level string) string {
+	if link == "" {
+		return ""
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	query := u.Query()
+	query.Set("severity", level)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// shortDigest returns the first 12 hex digits of an image digest, the way docker lists images
+func shortDigest(digest string) string {
+	hex := strings.TrimPrefix(digest, "sha256:")
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
+
+// severityText returns the emoji and the label of the severity level
+func (p Presentation) severityText(level string) string {
+	d := p.displayOf(level)
+	if d.Emoji == "" {
+		return d.Label
+	}
+	return d.Emoji + " " + d.Label
 }
 
 // GenerateTextBlock returns a slack SectionBlock for text input
@@ -109,9 +433,77 @@ func (s *SlackService) BlockMessage(blocks ...slack.Block) slack.Message {
 
 // PostMessage sends provided slack MessageBlocks to the given slack channel
 func (s *SlackService) PostMessage(blocks ...slack.Block) (string, string, error) {
+	return s.post(s.channel, blocks...)
+}
+
+func (s *SlackService) post(channel string, blocks ...slack.Block) (string, string, error) {
 	// Wait one second so posting doesn't exceed Slack's rate limit
 	time.Sleep(1 * time.Second)
-	return s.client.PostMessage(s.channel, slack.MsgOptionBlocks(blocks...))
+	channelID, timestamp, err := s.postMessage(channel, blocks...)
+	if err == nil || s.refreshToken == nil || !authErrors[err.Error()] {
+		return channelID, timestamp, err
+	}
+
+	if s.logger != nil {
+		s.logger.Info("Slack rejected the token, refreshing it")
+	}
+	token, refreshErr := s.refreshToken()
+	if refreshErr != nil {
+		return channelID, timestamp, fmt.Errorf("%s, refreshing token failed: %s", err, refreshErr)
+	}
+	s.client = slack.New(token, s.options...)
+	return s.postMessage(channel, blocks...)
+}
+
+func (s *SlackService) postMessage(channel string, blocks ...slack.Block) (string, string, error) {
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancelFunc context.CancelFunc
+		ctx, cancelFunc = context.WithTimeout(ctx, s.timeout)
+		defer cancelFunc()
+	}
+	return s.client.PostMessageContext(ctx, channel, slack.MsgOptionText(plainText(blocks), false), slack.MsgOptionBlocks(blocks...))
+}
+
+var (
+	slackLinkPattern = regexp.MustCompile(`<[^|<>]+\|([^<>]+)>`)
+	// Formatting markers start after a space, those escapeMrkdwn kept from formatting follow a zero width space
+	slackBoldPattern   = regexp.MustCompile(`(^|\s)\*([^*\n]+)\*(\W|$)`)
+	slackItalicPattern = regexp.MustCompile(`(^|\s)_([^_\n]+)_(\W|$)`)
+)
+
+// plainText renders blocks as the text of the message, shown in notifications and by clients without blocks.
+// Links keep their label and formatting markers are dropped.
+func plainText(blocks []slack.Block) string {
+	var lines []string
+	add := func(t *slack.TextBlockObject) {
+		if t != nil && t.Text != "" {
+			lines = append(lines, t.Text)
+		}
+	}
+	for _, b := range blocks {
+		switch block := b.(type) {
+		case *slack.SectionBlock:
+			add(block.Text)
+			var fields []string
+			for _, f := range block.Fields {
+				fields = append(fields, f.Text)
+			}
+			if len(fields) > 0 {
+				lines = append(lines, strings.Join(fields, ", "))
+			}
+		case *slack.ContextBlock:
+			for _, e := range block.ContextElements.Elements {
+				if t, ok := e.(*slack.TextBlockObject); ok {
+					add(t)
+				}
+			}
+		}
+	}
+
+	text := slackLinkPattern.ReplaceAllString(strings.Join(lines, "\n"), "$1")
+	text = slackBoldPattern.ReplaceAllString(text, "$1$2$3")
+	return slackItalicPattern.ReplaceAllString(text, "$1$2$3")
 }
 
 // PostStandaloneMessage generates slack SectionBlock for provided text and sends it to the given slack channel
@@ -121,6 +513,30 @@ func (s *SlackService) PostStandaloneMessage(message string) error {
 	return err
 }
 
+// escapeEntities escapes the characters Slack reserves for links, mentions and dates
+func escapeEntities(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// escapeMrkdwn makes text read as is in mrkdwn. Slack can't escape formatting characters, so a zero width space
+// is put before those at the edge of a word, where they would start or end formatting, e.g.: team/_internal_.
+// Those inside words, e.g.: my_repo, don't format and are left alone.
+func escapeMrkdwn(text string) string {
+	runes := []rune(escapeEntities(text))
+	word := func(i int) bool {
+		return i >= 0 && i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]))
+	}
+
+	var buffer bytes.Buffer
+	for i, r := range runes {
+		if strings.ContainsRune("*_~`", r) && !(word(i-1) && word(i+1)) {
+			buffer.WriteRune('\u200b')
+		}
+		buffer.WriteRune(r)
+	}
+	return buffer.String()
+}
+
 func bold(message string) string {
 	return fmt.Sprintf("*%s*", message)
 }
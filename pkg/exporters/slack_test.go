@@ -2,7 +2,12 @@ package exporters
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
@@ -65,6 +70,7 @@ func TestBuildMessageBlock(t *testing.T) {
 		{
 			repository: &api.RepositoryInfo{
 				Name: "TestRepository",
+				Link: "https://console.aws.amazon.com/ecr/repositories/TestRepository/image/xxxyyyzzzddd/scan-results?region=us-east-1",
 				Severity: severity.Matrix{
 					Count: map[string]*int64{
 						"CRITICAL":      aws.Int64(1),
@@ -78,6 +84,23 @@ func TestBuildMessageBlock(t *testing.T) {
 			},
 			expected: 4,
 		},
+		{
+			repository: &api.RepositoryInfo{
+				Name:     "TestRepository",
+				Link:     "https://console.aws.amazon.com/ecr/repositories/TestRepository/image/xxxyyyzzzddd/scan-results?region=us-east-1",
+				Digest:   "sha256:0123456789abcdef",
+				Severity: severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(2)}},
+			},
+			expected: 5,
+		},
+		// Redacted repositories have no link
+		{
+			repository: &api.RepositoryInfo{
+				Name:     "[redacted]",
+				Severity: severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(2)}},
+			},
+			expected: 3,
+		},
 	}
 
 	for i, c := range cases {
@@ -117,15 +140,37 @@ func TestBlockMessage(t *testing.T) {
             "type": "section",
             "text": {
                 "type": "mrkdwn",
-                "text": "Vulnerabilities found in *TestRepository/TestRepo1*:"
+                "text": ":red_circle: Vulnerabilities found in *TestRepository/TestRepo1*:"
             }
         },
         {
             "type": "section",
-            "text": {
-                "type": "mrkdwn",
-                "text": "CRITICAL *1*\nHIGH *2*\nMEDIUM *3*\nLOW *4*\nINFORMATIONAL *5*\nUNDEFINED *6*\n"
-            }
+            "fields": [
+                {
+                    "type": "mrkdwn",
+                    "text": "\u003chttps://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1\u0026severity=CRITICAL|:red_circle: CRITICAL\u003e *1*"
+                },
+                {
+                    "type": "mrkdwn",
+                    "text": "\u003chttps://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1\u0026severity=HIGH|:large_orange_circle: HIGH\u003e *2*"
+                },
+                {
+                    "type": "mrkdwn",
+                    "text": "\u003chttps://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1\u0026severity=MEDIUM|:large_yellow_circle: MEDIUM\u003e *3*"
+                },
+                {
+                    "type": "mrkdwn",
+                    "text": "\u003chttps://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1\u0026severity=LOW|:large_blue_circle: LOW\u003e *4*"
+                },
+                {
+                    "type": "mrkdwn",
+                    "text": "\u003chttps://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1\u0026severity=INFORMATIONAL|:white_circle: INFORMATIONAL\u003e *5*"
+                },
+                {
+                    "type": "mrkdwn",
+                    "text": "\u003chttps://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1\u0026severity=UNDEFINED|:black_circle: UNDEFINED\u003e *6*"
+                }
+            ]
         },
         {
             "type": "section",
@@ -154,3 +199,241 @@ func TestBlockMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestPostMessageTokenRefresh(t *testing.T) {
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		token := r.FormValue("token")
+		tokens = append(tokens, token)
+		if token != "xoxb-new" {
+			w.Write([]byte(`{"ok": false, "error": "invalid_auth"}`))
+			return
+		}
+		w.Write([]byte(`{"ok": true, "channel": "C123", "ts": "1595116800.000100"}`))
+	}))
+	defer server.Close()
+
+	s := NewSlackExporter("slack", "xoxb-old", "#ecr-scan", slack.OptionAPIURL(server.URL+"/"))
+	if err := s.PostStandaloneMessage("test"); err == nil {
+		t.Fatalf("Expected auth error without token refresh")
+	}
+
+	s.WithTokenRefresh(func() (string, error) {
+		return "xoxb-new", nil
+	})
+	if err := s.PostStandaloneMessage("test"); err != nil {
+		t.Fatalf("Error posting message after token refresh: %s", err)
+	}
+	if err := s.PostStandaloneMessage("test"); err != nil {
+		t.Fatalf("Error posting message with refreshed token: %s", err)
+	}
+
+	expected := []string{"xoxb-old", "xoxb-old", "xoxb-new", "xoxb-new"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("values not equal, wanting: %v, got: %v", expected, tokens)
+	}
+}
+
+func TestFormatTokenRotation(t *testing.T) {
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		tokens = append(tokens, r.FormValue("token"))
+		if r.FormValue("token") != "xoxb-rotated" {
+			w.Write([]byte(`{"ok": false, "error": "invalid_auth"}`))
+			return
+		}
+		w.Write([]byte(`{"ok": true, "channel": "C123", "ts": "1595116800.000100"}`))
+	}))
+	defer server.Close()
+
+	refreshes := 0
+	s := NewSlackExporter("slack", "xoxb-old", "#ecr-scan", slack.OptionAPIURL(server.URL+"/")).WithTokenRefresh(func() (string, error) {
+		refreshes++
+		return "xoxb-rotated", nil
+	})
+
+	// Two nightly reports of a warm execution environment, the rotated token is fetched once
+	for i := 0; i < 2; i++ {
+		send, err := s.Format(&api.Report{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := send(); err != nil {
+			t.Fatalf("Error sending report after token rotation: %s", err)
+		}
+	}
+
+	expected := []string{"xoxb-old", "xoxb-rotated", "xoxb-rotated", "xoxb-rotated", "xoxb-rotated"}
+	if refreshes != 1 || !reflect.DeepEqual(tokens, expected) {
+		t.Fatalf("values not equal, wanting: %v after 1 refresh, got: %v after %d", expected, tokens, refreshes)
+	}
+}
+
+func TestPostTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	s := NewSlackExporter("slack", "xoxb-1234", "#ecr-scan", slack.OptionAPIURL(server.URL+"/")).WithTimeout(50 * time.Millisecond)
+	start := time.Now()
+	if _, _, err := s.PostMessage(s.GenerateTextBlock("hung")); err == nil {
+		t.Fatalf("Expected the hung post to time out")
+	}
+	// Posts wait a second for Slack's rate limit first
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the post to be canceled after the timeout, took: %s", elapsed)
+	}
+}
+
+func TestSlackFallback(t *testing.T) {
+	down := true
+	var channels []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		r.ParseForm()
+		channels = append(channels, r.FormValue("channel"))
+		w.Write([]byte(`{"ok": true, "channel": "C123", "ts": "1595116800.000100"}`))
+	}))
+	defer server.Close()
+
+	var queued [][]byte
+	s := NewSlackExporter("slack", "xoxb-test", "#ecr-scan", slack.OptionAPIURL(server.URL+"/")).WithFallback(func(payload []byte) error {
+		queued = append(queued, payload)
+		return nil
+	})
+
+	send, err := s.Format(&api.Report{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Expected the report to be queued while Slack is down, got: %s", err)
+	}
+	if len(queued) != 1 {
+		t.Fatalf("Expected 1 queued payload, got: %d", len(queued))
+	}
+
+	// Still down, the messages are queued again
+	requeued, err := s.Replay(queued[0])
+	if err != nil || !requeued || len(queued) != 2 {
+		t.Fatalf("Expected the messages to be queued again, got: %t, %v", requeued, err)
+	}
+
+	down = false
+	requeued, err = s.Replay(queued[1])
+	if err != nil || requeued {
+		t.Fatalf("Expected the messages to be posted, got: %t, %v", requeued, err)
+	}
+	expected := []string{"#ecr-scan", "#ecr-scan"}
+	if !reflect.DeepEqual(channels, expected) {
+		t.Fatalf("values not equal, wanting: %v, got: %v", expected, channels)
+	}
+}
+
+func TestSlackFallbackRequestError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+	}))
+	defer server.Close()
+
+	fallback := false
+	s := NewSlackExporter("slack", "xoxb-test", "#missing", slack.OptionAPIURL(server.URL+"/")).WithFallback(func(payload []byte) error {
+		fallback = true
+		return nil
+	})
+
+	if err := s.PostStandaloneMessage("test"); err == nil {
+		t.Fatalf("Expected channel_not_found error")
+	}
+	if _, err := s.Replay([]byte(`{"channel":"#missing","messages":[[{"type":"divider"}]]}`)); err == nil || fallback {
+		t.Fatalf("Expected the error to be returned instead of queueing, got: %v", err)
+	}
+}
+
+func TestSlackEscalation(t *testing.T) {
+	report := &api.Report{Filtered: []*api.RepositoryInfo{
+		{Name: "team-a/api", Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(1), "HIGH": aws.Int64(2)}}},
+		{Name: "team-a/web", Severity: severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(3)}}},
+	}}
+	text := func(m slack.Blocks, i int) string {
+		return m.BlockSet[i].(*slack.SectionBlock).Text.Text
+	}
+
+	s := NewSlackExporter("slack", "", "#ecr-scan").WithEscalation(Escalation{Mention: "S0123ABCD", Severity: "CRITICAL", Inline: true, Separate: true})
+	messages := s.messages(report)
+
+	expected := "*<!subteam^S0123ABCD> Repositories with CRITICAL findings need attention:*\nteam-a/api\n"
+	if len(messages) < 4 || text(messages[1], 0) != expected {
+		t.Fatalf("Unexpected escalation message: %+v", messages)
+	}
+	if text(messages[2], 0) != "<!subteam^S0123ABCD>" {
+		t.Fatalf("Expected the repository with CRITICAL findings to mention the group, got: %s", text(messages[2], 0))
+	}
+	if len(messages[3].BlockSet) != len(s.BuildMessageBlock(report.Filtered[1])) {
+		t.Fatalf("Expected no mention for the repository with HIGH findings only")
+	}
+
+	// Without a mention there is nothing to escalate
+	if messages := NewSlackExporter("slack", "", "#ecr-scan").messages(report); len(messages) != 3 {
+		t.Fatalf("Expected the header and 2 repositories, got: %d messages", len(messages))
+	}
+}
+
+func TestMention(t *testing.T) {
+	cases := map[string]string{
+		"@here":     "<!here>",
+		"@channel":  "<!channel>",
+		"S0123ABCD": "<!subteam^S0123ABCD>",
+		"U0123ABCD": "<@U0123ABCD>",
+	}
+	for who, expected := range cases {
+		if got := mention(who); got != expected {
+			t.Fatalf("values not equal, wanting: %s, got: %s", expected, got)
+		}
+	}
+}
+
+func TestEscapeMrkdwn(t *testing.T) {
+	cases := map[string]string{
+		"team-a/api":           "team-a/api",
+		"my_repo":              "my_repo",
+		"team/_internal_":      "team/\u200b_internal\u200b_",
+		"a<b>&c":               "a&lt;b&gt;&amp;c",
+		"*bold* `code` ~gone~": "\u200b*bold\u200b* \u200b`code\u200b` \u200b~gone\u200b~",
+	}
+	for text, expected := range cases {
+		if got := escapeMrkdwn(text); got != expected {
+			t.Fatalf("values not equal, wanting: %q, got: %q", expected, got)
+		}
+	}
+
+	blocks := slackService.BuildMessageBlock(&api.RepositoryInfo{Name: "team/<script>", BaseImage: "debian:*"})
+	if header := blocks[0].(*slack.SectionBlock).Text.Text; !strings.Contains(header, "*team/&lt;script&gt;*") {
+		t.Fatalf("Expected the repository name to be escaped, got: %s", header)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	blocks := slackService.BuildMessageBlock(&api.RepositoryInfo{
+		Name:     "team/_internal_",
+		Link:     "https://console.aws.amazon.com/ecr/repositories/team/internal/image/sha256:abc/scan-results?region=us-east-1",
+		Digest:   "sha256:0123456789abcdef",
+		Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(1), "HIGH": aws.Int64(2)}},
+	})
+
+	expected := ":red_circle: Vulnerabilities found in team/\u200b_internal\u200b_:\nsha256:0123456789ab\n:red_circle: CRITICAL 1, :large_orange_circle: HIGH 2\nView detailed scan results  on ECR console"
+	if text := plainText(blocks); text != expected {
+		t.Fatalf("values not equal, wanting: %q, got: %q", expected, text)
+	}
+}
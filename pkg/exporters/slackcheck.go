@@ -0,0 +1,76 @@
+package exporters
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// slackVerifier is the part of the Slack API the self test calls, satisfied by *slack.Client
+type slackVerifier interface {
+	AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error)
+	GetConversationInfoContext(ctx context.Context, channelID string, includeLocale bool) (*slack.Channel, error)
+	GetConversationsContext(ctx context.Context, params *slack.GetConversationsParameters) ([]slack.Channel, string, error)
+}
+
+// SelfTest checks that Slack accepts the token and the bot is a member of the channel, so a broken setup fails
+// before scanning rather than when posting. Webhooks can't be checked and pass.
+func (s *SlackService) SelfTest(ctx context.Context) error {
+	if _, ok := s.client.(slackVerifier); !ok {
+		return nil
+	}
+	if s.timeout > 0 {
+		var cancelFunc context.CancelFunc
+		ctx, cancelFunc = context.WithTimeout(ctx, s.timeout)
+		defer cancelFunc()
+	}
+
+	auth, err := s.client.(slackVerifier).AuthTestContext(ctx)
+	if err != nil && s.refreshToken != nil && authErrors[err.Error()] {
+		token, refreshErr := s.refreshToken()
+		if refreshErr != nil {
+			return fmt.Errorf("Slack self test: the token was rejected (%s), refreshing it failed: %s", err, refreshErr)
+		}
+		s.client = slack.New(token, s.options...)
+		auth, err = s.client.(slackVerifier).AuthTestContext(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("Slack self test: the token was rejected (%s), check SLACK_TOKEN or the secret holding it", err)
+	}
+
+	channel, err := s.findChannel(ctx, s.client.(slackVerifier))
+	if err != nil {
+		return fmt.Errorf("Slack self test: channel %s can't be looked up (%s), check SLACK_CHANNEL and that the app has the channels:read and groups:read scopes", s.channel, err)
+	}
+	if !channel.IsMember {
+		return fmt.Errorf("Slack self test: %s is not a member of %s, invite it with /invite @%s", auth.User, s.channel, auth.User)
+	}
+	return nil
+}
+
+// findChannel looks the channel up by ID, or by name when it has a # prefix
+func (s *SlackService) findChannel(ctx context.Context, v slackVerifier) (*slack.Channel, error) {
+	if !strings.HasPrefix(s.channel, "#") {
+		return v.GetConversationInfoContext(ctx, s.channel, false)
+	}
+
+	name := strings.TrimPrefix(s.channel, "#")
+	params := &slack.GetConversationsParameters{ExcludeArchived: "true", Limit: 1000, Types: []string{"public_channel", "private_channel"}}
+	for {
+		channels, cursor, err := v.GetConversationsContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		for i := range channels {
+			if channels[i].Name == name {
+				return &channels[i], nil
+			}
+		}
+		if cursor == "" {
+			return nil, fmt.Errorf("channel_not_found")
+		}
+		params.Cursor = cursor
+	}
+}
@@ -0,0 +1,81 @@
+package exporters
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestSlackSelfTest(t *testing.T) {
+	member := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/auth.test":
+			if r.FormValue("token") != "xoxb-valid" {
+				w.Write([]byte(`{"ok": false, "error": "invalid_auth"}`))
+				return
+			}
+			w.Write([]byte(`{"ok": true, "user": "ecr-scan"}`))
+		case "/conversations.list":
+			if r.FormValue("cursor") == "" {
+				w.Write([]byte(`{"ok": true, "channels": [{"id": "C1", "name": "general", "is_member": true}], "response_metadata": {"next_cursor": "page2"}}`))
+				return
+			}
+			w.Write([]byte(`{"ok": true, "channels": [{"id": "C2", "name": "ecr-scan", "is_member": ` + strconv.FormatBool(member) + `}]}`))
+		case "/conversations.info":
+			if r.FormValue("channel") != "C2" {
+				w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+				return
+			}
+			w.Write([]byte(`{"ok": true, "channel": {"id": "C2", "name": "ecr-scan", "is_member": true}}`))
+		}
+	}))
+	defer server.Close()
+	api := slack.OptionAPIURL(server.URL + "/")
+
+	for _, channel := range []string{"#ecr-scan", "C2"} {
+		if err := NewSlackExporter("slack", "xoxb-valid", channel, api).SelfTest(context.Background()); err != nil {
+			t.Fatalf("Unexpected self test error for %s: %s", channel, err)
+		}
+	}
+
+	cases := []struct {
+		token   string
+		channel string
+		err     string
+	}{
+		{token: "xoxb-revoked", channel: "#ecr-scan", err: "the token was rejected (invalid_auth)"},
+		{token: "xoxb-valid", channel: "#security", err: "channel #security can't be looked up (channel_not_found)"},
+		{token: "xoxb-valid", channel: "C9", err: "channel C9 can't be looked up (channel_not_found)"},
+	}
+	for i, c := range cases {
+		err := NewSlackExporter("slack", c.token, c.channel, api).SelfTest(context.Background())
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("[%d] Error should contain: %s, got: %v", i, c.err, err)
+		}
+	}
+
+	member = false
+	err := NewSlackExporter("slack", "xoxb-valid", "#ecr-scan", api).SelfTest(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "ecr-scan is not a member of #ecr-scan, invite it") {
+		t.Fatalf("Expected a membership error, got: %v", err)
+	}
+
+	// Rotated tokens are refreshed like when posting
+	s := NewSlackExporter("slack", "xoxb-revoked", "C2", api).WithTokenRefresh(func() (string, error) {
+		return "xoxb-valid", nil
+	})
+	if err := s.SelfTest(context.Background()); err != nil {
+		t.Fatalf("Unexpected self test error after token refresh: %s", err)
+	}
+
+	if err := NewSlackExporterWithClient("slack", NewSlackWebhook(server.URL, server.Client()), "").SelfTest(context.Background()); err != nil {
+		t.Fatalf("Expected webhooks to pass, got: %s", err)
+	}
+}
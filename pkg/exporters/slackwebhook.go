@@ -0,0 +1,78 @@
+package exporters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// SlackWebhook posts messages through an incoming webhook, for workspaces which don't allow bot tokens.
+// It satisfies SlackClient, the channel is decided by the webhook and the one passed is ignored.
+type SlackWebhook struct {
+	url    string
+	client *http.Client
+}
+
+// webhookError is the answer of a webhook rejecting a message, e.g.: 404 no_service
+type webhookError struct {
+	code    int
+	message string
+}
+
+func (e webhookError) Error() string {
+	return fmt.Sprintf("slack webhook error: %d %s", e.code, e.message)
+}
+
+// HTTPStatusCode lets unavailable tell server errors apart
+func (e webhookError) HTTPStatusCode() int {
+	return e.code
+}
+
+// NewSlackWebhook .
+func NewSlackWebhook(url string, client *http.Client) *SlackWebhook {
+	return &SlackWebhook{
+		url:    url,
+		client: client,
+	}
+}
+
+// PostMessageContext posts the text and blocks of the message to the webhook, which answers without a timestamp
+func (w *SlackWebhook) PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	_, values, err := slack.UnsafeApplyMsgOptions("", channelID, "", options...)
+	if err != nil {
+		return "", "", err
+	}
+
+	payload := map[string]interface{}{"text": values.Get("text")}
+	if blocks := values.Get("blocks"); blocks != "" {
+		payload["blocks"] = json.RawMessage(blocks)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := w.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return "", "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+		return "", "", webhookError{code: response.StatusCode, message: strings.TrimSpace(string(message))}
+	}
+	return channelID, "", nil
+}
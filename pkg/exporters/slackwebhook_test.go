@@ -0,0 +1,55 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+func TestSlackWebhook(t *testing.T) {
+	var payloads []map[string]json.RawMessage
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Error decoding webhook payload: %s", err)
+		}
+		payloads = append(payloads, payload)
+		w.WriteHeader(status)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	s := NewSlackExporterWithClient("slack", NewSlackWebhook(server.URL, server.Client()), "")
+	report := &api.Report{Filtered: []*api.RepositoryInfo{
+		{Name: "team-a/api", Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(1)}}},
+	}}
+	send, err := s.Format(report)
+	if err != nil {
+		t.Fatalf("Error formatting report: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error posting through the webhook: %s", err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("Expected the header and the repository, got: %d posts", len(payloads))
+	}
+	var blocks []map[string]interface{}
+	if err := json.Unmarshal(payloads[1]["blocks"], &blocks); err != nil || len(blocks) == 0 || blocks[0]["type"] != "section" {
+		t.Fatalf("Unexpected blocks: %s", payloads[1]["blocks"])
+	}
+	if string(payloads[1]["text"]) == `""` {
+		t.Fatalf("Expected a plain text fallback")
+	}
+
+	status = http.StatusServiceUnavailable
+	_, _, err = s.PostMessage(s.GenerateTextBlock("down"))
+	if err == nil || !unavailable(err) {
+		t.Fatalf("Expected Slack to be unavailable, got: %v", err)
+	}
+}
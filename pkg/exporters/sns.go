@@ -3,30 +3,99 @@ package exporters
 import (
 	"encoding/json"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
 )
 
 // SNSExporter publishes message to SNS topic as json
 type SNSExporter struct {
+	Presentation
+
 	client   *api.SNSService
 	name     string
 	topicARN string
 }
 
 type jsonData struct {
-	Head           string       `json:"head"`
-	Vulnerablities []repository `json:"vulnerablities"`
-	Failed         []string     `json:"failed"`
-	Default        string       `json:"default"`
+	Head                string               `json:"head"`
+	ScanType            string               `json:"scan_type,omitempty"`
+	Vulnerablities      []repository         `json:"vulnerablities"`
+	PullThroughCache    []repository         `json:"pull_through_cache,omitempty"`
+	Failed              []string             `json:"failed"`
+	Denied              []denied             `json:"denied,omitempty"`
+	Empty               []string             `json:"empty,omitempty"`
+	NotScanned          []string             `json:"not_scanned,omitempty"`
+	ScanOnPushDisabled  []string             `json:"scan_on_push_disabled,omitempty"`
+	NotCovered          []string             `json:"not_covered,omitempty"`
+	Public              []string             `json:"public,omitempty"`
+	Stale               []string             `json:"stale,omitempty"`
+	Untagged            []untagged           `json:"untagged,omitempty"`
+	NoLifecyclePolicy   []string             `json:"no_lifecycle_policy,omitempty"`
+	SnoozeExpiring      []report.Snooze      `json:"snooze_expiring,omitempty"`
+	SuppressionExpiring []report.Suppression `json:"suppression_expiring,omitempty"`
+	Pending             []string             `json:"pending,omitempty"`
+	Resolved            []resolved           `json:"resolved,omitempty"`
+	SuggestedPolicy     string               `json:"suggested_lifecycle_policy,omitempty"`
+	NotProcessed        int                  `json:"not_processed,omitempty"`
+	Interrupted         bool                 `json:"interrupted,omitempty"`
+	RunID               string               `json:"run_id,omitempty"`
+	Fingerprint         string               `json:"fingerprint,omitempty"`
+	Default             string               `json:"default"`
+	// Compliance controls of the listed sections, by section
+	Controls map[string][]Control `json:"controls,omitempty"`
 }
 
 type repository struct {
-	Name     string         `json:"name"`
-	Link     string         `json:"link"`
-	Findings []vulnerablity `json:"findings"`
+	Name                string         `json:"name"`
+	Platform            string         `json:"platform,omitempty"`
+	Link                string         `json:"link"`
+	Tag                 string         `json:"tag,omitempty"`
+	Digest              string         `json:"digest,omitempty"`
+	RegistryID          string         `json:"registry_id,omitempty"`
+	PushedAt            string         `json:"pushed_at,omitempty"`
+	ScanCompletedAt     string         `json:"scan_completed_at,omitempty"`
+	WorstSeverity       string         `json:"worst_severity,omitempty"`
+	Regions             []string       `json:"regions,omitempty"`
+	BaseImage           string         `json:"base_image,omitempty"`
+	BaseImageFindings   int            `json:"base_image_findings,omitempty"`
+	ApplicationFindings int            `json:"application_findings,omitempty"`
+	OSPackages          []vulnerablity `json:"os_packages,omitempty"`
+	LanguagePackages    []vulnerablity `json:"language_packages,omitempty"`
+	Layers              []layer        `json:"layers,omitempty"`
+	Findings            []vulnerablity `json:"findings"`
+	Overdue             bool           `json:"overdue,omitempty"`
+	Sources             map[string]int `json:"sources,omitempty"`
+	Controls            []Control      `json:"controls,omitempty"`
+}
+
+type layer struct {
+	Index       int      `json:"index"`
+	Digest      string   `json:"digest"`
+	Instruction string   `json:"instruction,omitempty"`
+	Findings    int      `json:"findings"`
+	Packages    []string `json:"packages,omitempty"`
+}
+
+type resolved struct {
+	Name  string   `json:"name"`
+	Fixed []string `json:"fixed,omitempty"`
+}
+
+type denied struct {
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	Resource string `json:"resource,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type untagged struct {
+	Name   string `json:"name"`
+	Images int    `json:"images"`
+	Bytes  int64  `json:"bytes"`
 }
 
 type vulnerablity struct {
@@ -49,24 +118,61 @@ func (s SNSExporter) Name() string {
 }
 
 // Format clousure formats scan results and returns a function that sends report on invocation
-func (s SNSExporter) Format(filtered []*api.RepositoryInfo, failed []*api.RepositoryInfo) (func() error, error) {
+func (s SNSExporter) Format(report *api.Report) (func() error, error) {
 	js := jsonData{
-		Head:           reportHeadText,
-		Vulnerablities: s.format(filtered),
-		Failed:         s.formatFailed(failed),
+		Head:                s.headText(report.Date),
+		ScanType:            report.ScanType,
+		Vulnerablities:      s.format(report.Filtered),
+		PullThroughCache:    s.format(report.PullThroughCache),
+		Failed:              s.formatFailed(report.Failed),
+		Denied:              formatDenied(report.Failed),
+		Empty:               s.formatFailed(report.Empty),
+		NotScanned:          s.formatFailed(report.NotScanned),
+		ScanOnPushDisabled:  s.formatFailed(report.ScanOnPushDisabled),
+		NotCovered:          s.formatFailed(report.NotCovered),
+		Public:              s.formatFailed(report.Public),
+		Stale:               s.formatFailed(report.Stale),
+		Untagged:            s.formatUntagged(report.Untagged),
+		NoLifecyclePolicy:   s.formatFailed(report.NoLifecyclePolicy),
+		SnoozeExpiring:      snoozes(report.SnoozeExpiring),
+		SuppressionExpiring: suppressions(report.SuppressionExpiring),
+		Pending:             s.formatFailed(report.Pending),
+		Resolved:            formatResolved(report.Resolved),
+		SuggestedPolicy:     report.SuggestedLifecyclePolicy,
+		NotProcessed:        report.NotProcessed,
+		Interrupted:         report.Interrupted,
+		RunID:               report.RunID,
+		Fingerprint:         report.Fingerprint(),
+	}
+	for _, l := range s.sections(report) {
+		if c := s.controls(l.category); len(c) > 0 && len(l.repositories) > 0 {
+			if js.Controls == nil {
+				js.Controls = make(map[string][]Control)
+			}
+			js.Controls[l.category] = c
+		}
 	}
 
 	bytes, err := marshal(js)
 	if err != nil {
 		return nil, err
 	}
+	text, err := s.formatReport(report)
+	if err != nil {
+		return nil, err
+	}
 
-	msg := string(bytes)
+	msg, err := snsMessage(bytes, text)
+	if err != nil {
+		return nil, err
+	}
+	structure := "json"
 
 	return func() error {
 		input := sns.PublishInput{
-			Message:  &msg,
-			TopicArn: &s.topicARN,
+			Message:          &msg,
+			MessageStructure: &structure,
+			TopicArn:         &s.topicARN,
 		}
 
 		if _, err = s.client.Publish(&input); err != nil {
@@ -77,6 +183,15 @@ func (s SNSExporter) Format(filtered []*api.RepositoryInfo, failed []*api.Reposi
 	}, nil
 }
 
+// snsMessage delivers the JSON payload to every protocol but email, whose subscribers read the plain text report
+func snsMessage(payload []byte, text string) (string, error) {
+	msg, err := json.Marshal(map[string]string{
+		"default": string(payload),
+		"email":   text,
+	})
+	return string(msg), err
+}
+
 func marshal(data jsonData) ([]byte, error) {
 	return json.Marshal(data)
 }
@@ -85,27 +200,106 @@ func (s SNSExporter) format(repositories []*api.RepositoryInfo) []repository {
 	var ret []repository
 	for _, r := range repositories {
 		repo := repository{
-			Name: r.Name,
-			Link: r.Link,
+			Name:                r.Name,
+			Platform:            r.Platform,
+			Link:                r.Link,
+			Tag:                 r.Tag,
+			Digest:              r.Digest,
+			RegistryID:          r.RegistryID,
+			WorstSeverity:       r.WorstSeverity(),
+			Regions:             r.Regions,
+			BaseImage:           r.BaseImage,
+			BaseImageFindings:   r.BaseImageFindings,
+			ApplicationFindings: r.ApplicationFindings,
+			Overdue:             r.Overdue,
+			Sources:             r.Sources,
+		}
+		if !r.PushedAt.IsZero() {
+			repo.PushedAt = r.PushedAt.UTC().Format(time.RFC3339)
+		}
+		if !r.ScanCompletedAt.IsZero() {
+			repo.ScanCompletedAt = r.ScanCompletedAt.UTC().Format(time.RFC3339)
 		}
 
-		for _, key := range severity.SeverityList {
-			if val, ok := r.Severity.Count[key]; ok {
-				repo.Findings = append(repo.Findings, vulnerablity{
-					Severity: key,
-					Count:    strconv.FormatInt(*val, 10),
-				})
-			}
+		repo.Findings = s.findings(r.ReportedSeverity())
+		repo.Controls = s.repositoryControls(r)
+		repo.OSPackages = s.findings(r.OSPackages.AtLeast(r.MinimumSeverity))
+		repo.LanguagePackages = s.findings(r.LanguagePackages.AtLeast(r.MinimumSeverity))
+		for _, l := range r.Layers {
+			repo.Layers = append(repo.Layers, layer{Index: l.Index, Digest: l.Digest, Instruction: l.Instruction, Findings: l.Findings, Packages: l.Packages})
 		}
 		ret = append(ret, repo)
 	}
 	return ret
 }
 
+func (s SNSExporter) findings(m severity.Matrix) []vulnerablity {
+	var ret []vulnerablity
+	for _, key := range severity.SeverityList {
+		if val, ok := m.Count[key]; ok {
+			ret = append(ret, vulnerablity{
+				Severity: key,
+				Count:    strconv.FormatInt(*val, 10),
+			})
+		}
+	}
+	return ret
+}
+
+func (s SNSExporter) formatUntagged(repositories []*api.RepositoryInfo) []untagged {
+	var ret []untagged
+	for _, r := range repositories {
+		ret = append(ret, untagged{Name: r.Name, Images: r.UntaggedImages, Bytes: r.UntaggedBytes})
+	}
+	return ret
+}
+
 func (s SNSExporter) formatFailed(repositories []*api.RepositoryInfo) []string {
 	var ret []string
 	for _, r := range repositories {
-		ret = append(ret, r.Name)
+		ret = append(ret, r.DisplayName())
+	}
+	return ret
+}
+
+// snoozes returns the snoozes of the repositories
+func snoozes(repositories []*api.RepositoryInfo) []report.Snooze {
+	var ret []report.Snooze
+	for _, r := range repositories {
+		if r.Snooze != nil {
+			ret = append(ret, *r.Snooze)
+		}
+	}
+	return ret
+}
+
+// formatDenied lists the permissions failed repositories were missing, of those whose error told
+func formatDenied(repositories []*api.RepositoryInfo) []denied {
+	var ret []denied
+	for _, r := range repositories {
+		if r.Denied != nil {
+			ret = append(ret, denied{Name: r.DisplayName(), Action: r.Denied.Action, Resource: r.Denied.Resource, Reason: r.Denied.Reason})
+		}
+	}
+	return ret
+}
+
+// formatResolved lists the repositories fixed since the previous report, with the vulnerabilities gone when known
+func formatResolved(repositories []*api.RepositoryInfo) []resolved {
+	var ret []resolved
+	for _, r := range repositories {
+		ret = append(ret, resolved{Name: r.DisplayName(), Fixed: r.Fixed})
+	}
+	return ret
+}
+
+// suppressions returns the suppressions of the repositories
+func suppressions(repositories []*api.RepositoryInfo) []report.Suppression {
+	var ret []report.Suppression
+	for _, r := range repositories {
+		if r.Suppression != nil {
+			ret = append(ret, *r.Suppression)
+		}
 	}
 	return ret
 }
@@ -1,6 +1,7 @@
 package exporters
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 
@@ -42,8 +43,9 @@ func TestFormatRepositories(t *testing.T) {
 	expected := jsonData{
 		Vulnerablities: []repository{
 			{
-				Name: "TestRepository/TestRepo1",
-				Link: "https://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1",
+				Name:          "TestRepository/TestRepo1",
+				Link:          "https://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1",
+				WorstSeverity: "CRITICAL",
 				Findings: []vulnerablity{
 					{
 						Severity: "CRITICAL",
@@ -72,8 +74,9 @@ func TestFormatRepositories(t *testing.T) {
 				},
 			},
 			{
-				Name: "TestRepository/TestRepo2",
-				Link: "https://console.aws.amazon.com/ecr/repositories/TestRepo/Test2/image/xxxyyyzzzddd/scan-results?region=us-east-1",
+				Name:          "TestRepository/TestRepo2",
+				Link:          "https://console.aws.amazon.com/ecr/repositories/TestRepo/Test2/image/xxxyyyzzzddd/scan-results?region=us-east-1",
+				WorstSeverity: "CRITICAL",
 				Findings: []vulnerablity{
 					{
 						Severity: "CRITICAL",
@@ -97,15 +100,16 @@ func TestFormatRepositories(t *testing.T) {
 	testInput := jsonData{Vulnerablities: formatted}
 
 	if !reflect.DeepEqual(testInput, expected) {
-		t.Fatalf("Values are not equal, wanting: %s, got: %s", expected, testInput)
+		t.Fatalf("Values are not equal, wanting: %+v, got: %+v", expected, testInput)
 
 	}
 }
 
 func TestJsonPayload(t *testing.T) {
 	input := jsonData{
-		Head:    reportHeadText,
+		Head:    "Scan results on 2020 Jul 18",
 		Default: "SNS topic",
+		RunID:   "1a2b3c4d",
 		Vulnerablities: []repository{
 			{
 				Name: "TestRepository/TestRepo1",
@@ -162,7 +166,7 @@ func TestJsonPayload(t *testing.T) {
 		},
 	}
 
-	expected := `{"head":"` + reportHeadText + `","vulnerablities":[{"name":"TestRepository/TestRepo1","link":"https://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1","findings":[{"severity":"CRITICAL","count":"1"},{"severity":"HIGH","count":"2"},{"severity":"MEDIUM","count":"3"},{"severity":"LOW","count":"4"},{"severity":"INFORMATIONAL","count":"5"},{"severity":"UNDEFINED","count":"6"}]},{"name":"TestRepository/TestRepo2","link":"https://console.aws.amazon.com/ecr/repositories/TestRepo/Test2/image/xxxyyyzzzddd/scan-results?region=us-east-1","findings":[{"severity":"CRITICAL","count":"6"},{"severity":"HIGH","count":"5"},{"severity":"UNDEFINED","count":"1"}]}],"failed":["TestRepo/Failed1","TestRepo/Failed2"],"default":"SNS topic"}`
+	expected := `{"head":"Scan results on 2020 Jul 18","vulnerablities":[{"name":"TestRepository/TestRepo1","link":"https://console.aws.amazon.com/ecr/repositories/TestRepo/Test1/image/xxxyyyzzzddd/scan-results?region=us-east-1","findings":[{"severity":"CRITICAL","count":"1"},{"severity":"HIGH","count":"2"},{"severity":"MEDIUM","count":"3"},{"severity":"LOW","count":"4"},{"severity":"INFORMATIONAL","count":"5"},{"severity":"UNDEFINED","count":"6"}]},{"name":"TestRepository/TestRepo2","link":"https://console.aws.amazon.com/ecr/repositories/TestRepo/Test2/image/xxxyyyzzzddd/scan-results?region=us-east-1","findings":[{"severity":"CRITICAL","count":"6"},{"severity":"HIGH","count":"5"},{"severity":"UNDEFINED","count":"1"}]}],"failed":["TestRepo/Failed1","TestRepo/Failed2"],"run_id":"1a2b3c4d","default":"SNS topic"}`
 
 	js, err := marshal(input)
 	if err != nil {
@@ -172,3 +176,17 @@ func TestJsonPayload(t *testing.T) {
 		t.Fatalf("Marshalled json is not what I expected, wanted => %s, got => %s", expected, js)
 	}
 }
+
+func TestSNSMessage(t *testing.T) {
+	msg, err := snsMessage([]byte(`{"head":"report"}`), "report\n")
+	if err != nil {
+		t.Fatalf("Error building SNS message: %s", err)
+	}
+	var structure map[string]string
+	if err := json.Unmarshal([]byte(msg), &structure); err != nil {
+		t.Fatalf("Error parsing SNS message: %s", err)
+	}
+	if structure["default"] != `{"head":"report"}` || structure["email"] != "report\n" {
+		t.Fatalf("Unexpected SNS message: %v", structure)
+	}
+}
@@ -0,0 +1,199 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+const (
+	splunkSource = "ecr-scan"
+	// Batches stay below the 1MB HEC accepts by default
+	splunkBatchBytes = 512 * 1024
+)
+
+// SplunkExporter posts an event per finding and a summary of the run to a Splunk HTTP Event Collector
+type SplunkExporter struct {
+	client     *http.Client
+	name       string
+	url        string
+	token      string
+	index      string
+	sourceType string
+}
+
+// splunkEvent is an event in the HEC format, the collector's defaults apply to the fields left empty
+type splunkEvent struct {
+	Time       int64       `json:"time"`
+	Source     string      `json:"source"`
+	SourceType string      `json:"sourcetype,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// splunkFinding is the findings of a severity level of a repository
+type splunkFinding struct {
+	Type             string `json:"type"`
+	RunID            string `json:"run_id,omitempty"`
+	Repository       string `json:"repository"`
+	Image            string `json:"image"`
+	Tag              string `json:"tag,omitempty"`
+	Digest           string `json:"digest,omitempty"`
+	RegistryID       string `json:"registryId,omitempty"`
+	PushedAt         string `json:"pushedAt,omitempty"`
+	ScanCompletedAt  string `json:"scanCompletedAt,omitempty"`
+	Severity         string `json:"severity"`
+	WorstSeverity    string `json:"worstSeverity"`
+	Count            int64  `json:"count"`
+	Link             string `json:"link,omitempty"`
+	PullThroughCache bool   `json:"pullThroughCache"`
+	Overdue          bool   `json:"overdue"`
+}
+
+type splunkSummary struct {
+	Type string `json:"type"`
+	report.Summary
+}
+
+// NewSplunkExporter creates an exporter for the collector at url, events go to index with sourceType,
+// or the defaults of the token when empty
+func NewSplunkExporter(name string, url string, token string, index string, sourceType string) *SplunkExporter {
+	return &SplunkExporter{
+		client:     &http.Client{Timeout: 30 * time.Second},
+		name:       name,
+		url:        strings.TrimSuffix(url, "/"),
+		token:      token,
+		index:      index,
+		sourceType: sourceType,
+	}
+}
+
+// Name .
+func (s SplunkExporter) Name() string {
+	return s.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (s SplunkExporter) Format(report *api.Report) (func() error, error) {
+	batches, err := s.batches(s.events(report, time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		for i, batch := range batches {
+			if err := s.post(batch); err != nil {
+				return fmt.Errorf("Error sending batch %d of %d to Splunk: %s", i+1, len(batches), err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// events returns an event per repository and severity level with findings, followed by the summary of the run
+func (s SplunkExporter) events(report *api.Report, now time.Time) []splunkEvent {
+	var events []splunkEvent
+	event := func(e interface{}) {
+		events = append(events, splunkEvent{
+			Time:       now.Unix(),
+			Source:     splunkSource,
+			SourceType: s.sourceType,
+			Index:      s.index,
+			Event:      e,
+		})
+	}
+
+	for _, section := range []struct {
+		repositories     []*api.RepositoryInfo
+		pullThroughCache bool
+	}{
+		{repositories: report.Filtered},
+		{repositories: report.PullThroughCache, pullThroughCache: true},
+	} {
+		for _, r := range section.repositories {
+			reported := r.ReportedSeverity()
+			worst := reported.Worst()
+			for _, key := range severity.SeverityList {
+				count := reported.Count[key]
+				if count == nil || *count == 0 {
+					continue
+				}
+				finding := splunkFinding{
+					Type:             "finding",
+					RunID:            report.RunID,
+					Repository:       r.Name,
+					Image:            r.DisplayName(),
+					Tag:              r.Tag,
+					Digest:           r.Digest,
+					RegistryID:       r.RegistryID,
+					Severity:         key,
+					WorstSeverity:    worst,
+					Count:            *count,
+					Link:             r.Link,
+					PullThroughCache: section.pullThroughCache,
+					Overdue:          r.Overdue,
+				}
+				if !r.PushedAt.IsZero() {
+					finding.PushedAt = r.PushedAt.UTC().Format(time.RFC3339)
+				}
+				if !r.ScanCompletedAt.IsZero() {
+					finding.ScanCompletedAt = r.ScanCompletedAt.UTC().Format(time.RFC3339)
+				}
+				event(finding)
+			}
+		}
+	}
+
+	event(splunkSummary{Type: "summary", Summary: report.Summary()})
+	return events
+}
+
+// batches encodes the events, concatenated as HEC expects them, into batches of at most splunkBatchBytes
+func (s SplunkExporter) batches(events []splunkEvent) ([][]byte, error) {
+	var batches [][]byte
+	var batch bytes.Buffer
+	for _, e := range events {
+		encoded, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		if batch.Len() > 0 && batch.Len()+len(encoded) > splunkBatchBytes {
+			batches = append(batches, append([]byte{}, batch.Bytes()...))
+			batch.Reset()
+		}
+		batch.Write(encoded)
+	}
+	if batch.Len() > 0 {
+		batches = append(batches, batch.Bytes())
+	}
+	return batches, nil
+}
+
+func (s SplunkExporter) post(batch []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url+"/services/collector/event", bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Splunk responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package exporters
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+func TestSplunkSend(t *testing.T) {
+	var received []map[string]interface{}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/collector/event" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		decoder := json.NewDecoder(r.Body)
+		for {
+			var event map[string]interface{}
+			if err := decoder.Decode(&event); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("Error decoding events: %s", err)
+				break
+			}
+			received = append(received, event)
+		}
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer server.Close()
+
+	report := &api.Report{
+		RunID:   "1a2b3c4d",
+		Scanned: 3,
+		Filtered: []*api.RepositoryInfo{
+			{
+				Name:     "team/app",
+				Digest:   "sha256:abc",
+				Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(2), "HIGH": aws.Int64(5), "LOW": aws.Int64(0)}},
+			},
+		},
+		PullThroughCache: []*api.RepositoryInfo{
+			{Name: "docker-hub/library/nginx", Severity: severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(1)}}},
+		},
+	}
+
+	s := NewSplunkExporter("splunk", server.URL+"/", "secret", "security", "ecr:scan")
+	send, err := s.Format(report)
+	if err != nil {
+		t.Fatalf("Error formatting events: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error sending events: %s", err)
+	}
+
+	if auth != "Splunk secret" {
+		t.Fatalf("Wrong authorization header, got => %s", auth)
+	}
+	if len(received) != 4 {
+		t.Fatalf("Expected 3 findings and a summary, got: %v", received)
+	}
+
+	var lines []string
+	for _, e := range received {
+		if e["index"] != "security" || e["sourcetype"] != "ecr:scan" || e["source"] != "ecr-scan" {
+			t.Fatalf("Unexpected event metadata: %v", e)
+		}
+		event := e["event"].(map[string]interface{})
+		if event["type"] == "summary" {
+			lines = append(lines, "summary "+event["run_id"].(string))
+			continue
+		}
+		lines = append(lines, strings.Join([]string{
+			event["image"].(string),
+			event["severity"].(string),
+			event["run_id"].(string),
+		}, " "))
+	}
+	expected := "team/app CRITICAL 1a2b3c4d,team/app HIGH 1a2b3c4d,docker-hub/library/nginx HIGH 1a2b3c4d,summary 1a2b3c4d"
+	if strings.Join(lines, ",") != expected {
+		t.Fatalf("values are not equal, wanting: %s, got: %s", expected, strings.Join(lines, ","))
+	}
+}
+
+func TestSplunkBatches(t *testing.T) {
+	s := NewSplunkExporter("splunk", "", "", "", "")
+	events := make([]splunkEvent, 3)
+	for i := range events {
+		events[i] = splunkEvent{Event: strings.Repeat("x", splunkBatchBytes/2)}
+	}
+
+	batches, err := s.batches(events)
+	if err != nil {
+		t.Fatalf("Error encoding events: %s", err)
+	}
+	if len(batches) != 3 {
+		t.Fatalf("Expected a batch per event, got: %d", len(batches))
+	}
+	for _, b := range batches {
+		if len(b) > splunkBatchBytes {
+			t.Fatalf("Batch exceeds %d bytes: %d", splunkBatchBytes, len(b))
+		}
+	}
+}
+
+func TestSplunkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"text":"Invalid token","code":4}`))
+	}))
+	defer server.Close()
+
+	send, err := NewSplunkExporter("splunk", server.URL, "wrong", "", "").Format(&api.Report{})
+	if err != nil {
+		t.Fatalf("Error formatting events: %s", err)
+	}
+	if err := send(); err == nil || !strings.Contains(err.Error(), "Invalid token") {
+		t.Fatalf("Expected the error of the collector, got: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+const (
+	webexCardContentType = "application/vnd.microsoft.card.adaptive"
+	// Webex rejects messages with more markdown than this many bytes
+	webexMaxMarkdown = 7439
+	// Vulnerable repositories listed on the card, the rest are counted
+	webexCardRepositories = 30
+)
+
+// WebexExporter posts the report to a Webex space, as markdown and as an adaptive card.
+// Clients showing the card hide the markdown, which is the fallback of the others.
+type WebexExporter struct {
+	Presentation
+
+	client *http.Client
+	name   string
+	url    string
+	token  string
+	roomID string
+}
+
+type webexMessage struct {
+	RoomID      string            `json:"roomId"`
+	Markdown    string            `json:"markdown"`
+	Attachments []webexAttachment `json:"attachments,omitempty"`
+}
+
+type webexAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string        `json:"$schema"`
+	Type    string        `json:"type"`
+	Version string        `json:"version"`
+	Body    []cardElement `json:"body"`
+}
+
+// cardElement is an element of the card body, e.g.: a TextBlock or a FactSet
+type cardElement map[string]interface{}
+
+// NewWebexExporter creates an exporter posting to the space roomID with a bot token, through the API at url
+func NewWebexExporter(name string, url string, token string, roomID string) *WebexExporter {
+	return &WebexExporter{
+		client: &http.Client{Timeout: 10 * time.Second},
+		name:   name,
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+		roomID: roomID,
+	}
+}
+
+// Name .
+func (w WebexExporter) Name() string {
+	return w.name
+}
+
+// Format clousure formats scan results and returns a function that sends report on invocation
+func (w WebexExporter) Format(report *api.Report) (func() error, error) {
+	body, err := json.Marshal(webexMessage{
+		RoomID:   w.roomID,
+		Markdown: w.webexMarkdown(report),
+		Attachments: []webexAttachment{
+			{ContentType: webexCardContentType, Content: w.webexCard(report)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		req, err := http.NewRequest(http.MethodPost, w.url+"/v1/messages", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+w.token)
+
+		resp, err := w.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			message, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Errorf("Webex responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+		}
+		return nil
+	}, nil
+}
+
+// webexMarkdown lists the vulnerable repositories and the sections of the report, repositories which don't fit
+// the size limit are counted at the end
+func (p Presentation) webexMarkdown(report *api.Report) string {
+	lines := []string{"**" + webexEscape(p.headText(report.Date)) + "**"}
+	if len(report.Filtered) == 0 {
+		lines = append(lines, webexEscape(p.msg().clean))
+	}
+	for _, r := range report.Filtered {
+		lines = append(lines, p.webexItem(r))
+	}
+	if len(report.PullThroughCache) > 0 {
+		lines = append(lines, "", "**"+webexEscape(p.msg().pullThroughCache)+"**")
+		for _, r := range report.PullThroughCache {
+			lines = append(lines, p.webexItem(r))
+		}
+	}
+	for _, s := range p.sections(report) {
+		if len(s.repositories) == 0 {
+			continue
+		}
+		lines = append(lines, "", "**"+webexEscape(s.head)+"**")
+		for _, r := range s.repositories {
+			lines = append(lines, "- "+webexEscape(p.listName(r)))
+		}
+	}
+
+	var notes []string
+	for _, note := range strings.Split(p.formatScanType(report.ScanType)+p.formatPartial(report)+p.formatRun(report), "\n") {
+		if note != "" {
+			notes = append(notes, "_"+webexEscape(note)+"_")
+		}
+	}
+	if len(notes) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, notes...)
+	}
+	return p.truncateMarkdown(lines, webexMaxMarkdown)
+}
+
+// webexItem returns the list item of a vulnerable repository, its findings and the details of its image
+func (p Presentation) webexItem(r *api.RepositoryInfo) string {
+	item := fmt.Sprintf("- %s: %s", webexLink(webexEscape(r.DisplayName()), r.Link), p.countsText(r))
+	if details := p.imageDetails(r); details != "" {
+		item += " (" + webexEscape(details) + ")"
+	}
+	return item
+}
+
+// truncateMarkdown joins the lines, leaving out the list items which don't fit limit bytes and counting them instead
+func (p Presentation) truncateMarkdown(lines []string, limit int) string {
+	text := strings.Join(lines, "\n")
+	if len(text) <= limit {
+		return text
+	}
+
+	// Room for the note counting the repositories left out
+	limit -= len(fmt.Sprintf(p.msg().more, len(lines))) + 1
+	var kept []string
+	size, left := 0, 0
+	for _, l := range lines {
+		if left > 0 || size+len(l)+1 > limit {
+			if strings.HasPrefix(l, "- ") {
+				left++
+			}
+			continue
+		}
+		kept = append(kept, l)
+		size += len(l) + 1
+	}
+	return strings.Join(append(kept, fmt.Sprintf(p.msg().more, left)), "\n")
+}
+
+// webexCard creates an adaptive card with the findings per severity level, the vulnerable repositories and
+// the sections of the report
+func (p Presentation) webexCard(report *api.Report) adaptiveCard {
+	body := []cardElement{
+		{"type": "TextBlock", "text": p.headText(report.Date), "size": "Medium", "weight": "Bolder", "wrap": true},
+	}
+
+	if len(report.Filtered) == 0 {
+		body = append(body, cardElement{"type": "TextBlock", "text": p.msg().clean, "wrap": true})
+	} else {
+		findings := countFindings(report.Filtered)
+		var facts []cardElement
+		for _, key := range severity.SeverityList {
+			if findings[key] > 0 {
+				facts = append(facts, cardElement{"title": p.displayOf(key).Label, "value": fmt.Sprint(findings[key])})
+			}
+		}
+		if len(facts) > 0 {
+			body = append(body, cardElement{"type": "FactSet", "facts": facts})
+		}
+	}
+
+	for i, r := range report.Filtered {
+		if i == webexCardRepositories {
+			body = append(body, cardElement{"type": "TextBlock", "text": fmt.Sprintf(p.msg().more, len(report.Filtered)-i), "isSubtle": true, "wrap": true})
+			break
+		}
+		items := []cardElement{
+			{"type": "TextBlock", "text": webexLink(r.DisplayName(), r.Link), "weight": "Bolder", "wrap": true},
+			{"type": "TextBlock", "text": p.countsText(r), "isSubtle": true, "wrap": true, "spacing": "None"},
+		}
+		if details := p.imageDetails(r); details != "" {
+			items = append(items, cardElement{"type": "TextBlock", "text": details, "isSubtle": true, "size": "Small", "wrap": true, "spacing": "None"})
+		}
+		body = append(body, cardElement{"type": "Container", "separator": true, "items": items})
+	}
+
+	for _, s := range append([]section{{head: p.msg().pullThroughCache, repositories: report.PullThroughCache}}, p.sections(report)...) {
+		if len(s.repositories) == 0 {
+			continue
+		}
+		var names []string
+		for i, r := range s.repositories {
+			if i == webexCardRepositories {
+				names = append(names, fmt.Sprintf(p.msg().more, len(s.repositories)-i))
+				break
+			}
+			names = append(names, "- "+p.listName(r))
+		}
+		body = append(body,
+			cardElement{"type": "TextBlock", "text": s.head, "weight": "Bolder", "wrap": true, "separator": true},
+			cardElement{"type": "TextBlock", "text": strings.Join(names, "\n"), "wrap": true},
+		)
+	}
+
+	if run := strings.TrimSpace(p.formatRun(report)); run != "" {
+		body = append(body, cardElement{"type": "TextBlock", "text": run, "isSubtle": true, "size": "Small", "wrap": true})
+	}
+
+	return adaptiveCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.2",
+		Body:    body,
+	}
+}
+
+// webexLink returns the text linking to link, the text alone without a link, e.g.: of redacted repositories
+func webexLink(text string, link string) string {
+	if link == "" {
+		return text
+	}
+	return fmt.Sprintf("[%s](%s)", text, link)
+}
+
+// countsText returns the reported findings of a repository per severity level, e.g.: CRITICAL 2, HIGH 5
+func (p Presentation) countsText(r *api.RepositoryInfo) string {
+	reported := r.ReportedSeverity()
+	var counts []string
+	for _, key := range severity.SeverityList {
+		if count := reported.Count[key]; count != nil && *count > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", p.displayOf(key).Label, *count))
+		}
+	}
+	return strings.Join(counts, ", ")
+}
+
+// webexEscape escapes the characters Webex markdown would format in repository names and messages
+func webexEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "`", "\\`").Replace(text)
+}
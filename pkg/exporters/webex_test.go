@@ -0,0 +1,118 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+func TestWebexSend(t *testing.T) {
+	var p Presentation
+	var message webexMessage
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&message)
+		w.Write([]byte(`{"id":"Y2lzY29zcGFyazovL3VzL01FU1NBR0UvMQ"}`))
+	}))
+	defer server.Close()
+
+	report := &api.Report{
+		Filtered: []*api.RepositoryInfo{
+			{
+				Name:     "team/my_app",
+				Link:     "https://console.aws.amazon.com/ecr/app",
+				Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(2), "HIGH": aws.Int64(5)}},
+			},
+		},
+		Failed: []*api.RepositoryInfo{{Name: "team/worker"}},
+		RunID:  "1a2b3c4d",
+	}
+
+	send, err := NewWebexExporter("webex", server.URL+"/", "secret", "room").Format(report)
+	if err != nil {
+		t.Fatalf("Error formatting message: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error sending message: %s", err)
+	}
+
+	if auth != "Bearer secret" || message.RoomID != "room" {
+		t.Fatalf("Unexpected request, authorization: %s, room: %s", auth, message.RoomID)
+	}
+	for _, expected := range []string{
+		"- [team/my\\_app](https://console.aws.amazon.com/ecr/app): CRITICAL 2, HIGH 5",
+		"**" + p.msg().failed + "**\n- team/worker",
+		"_Run 1a2b3c4d, report ",
+	} {
+		if !strings.Contains(message.Markdown, expected) {
+			t.Fatalf("Expected the markdown to contain %q, got: %s", expected, message.Markdown)
+		}
+	}
+
+	if len(message.Attachments) != 1 || message.Attachments[0].ContentType != webexCardContentType {
+		t.Fatalf("Expected an adaptive card, got: %v", message.Attachments)
+	}
+	card, _ := json.Marshal(message.Attachments[0].Content)
+	for _, expected := range []string{
+		`{"facts":[{"title":"CRITICAL","value":"2"},{"title":"HIGH","value":"5"}],"type":"FactSet"}`,
+		`"text":"[team/my_app](https://console.aws.amazon.com/ecr/app)"`,
+		`"text":"- team/worker"`,
+	} {
+		if !strings.Contains(string(card), expected) {
+			t.Fatalf("Expected the card to contain %s, got: %s", expected, card)
+		}
+	}
+}
+
+func TestWebexMarkdownLimit(t *testing.T) {
+	var p Presentation
+	report := &api.Report{}
+	for i := 0; i < 500; i++ {
+		report.Filtered = append(report.Filtered, &api.RepositoryInfo{
+			Name:     fmt.Sprintf("team/app-%03d", i),
+			Link:     "https://console.aws.amazon.com/ecr/repositories/private/123456789012/team/app",
+			Severity: severity.Matrix{Count: map[string]*int64{"HIGH": aws.Int64(1)}},
+		})
+	}
+
+	markdown := p.webexMarkdown(report)
+	if len(markdown) > webexMaxMarkdown {
+		t.Fatalf("Markdown exceeds %d bytes: %d", webexMaxMarkdown, len(markdown))
+	}
+	listed := strings.Count(markdown, "\n- ")
+	if !strings.HasSuffix(markdown, fmt.Sprintf(p.msg().more, 500-listed)) {
+		t.Fatalf("Expected the repositories left out to be counted, got: %s", markdown[len(markdown)-100:])
+	}
+
+	card := p.webexCard(report)
+	if last := card.Body[len(card.Body)-1]; last["text"] != fmt.Sprintf(p.msg().more, 500-webexCardRepositories) {
+		t.Fatalf("Expected the card to count the repositories left out, got: %v", last)
+	}
+}
+
+func TestWebexError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"Could not find a room with provided ID."}`))
+	}))
+	defer server.Close()
+
+	send, err := NewWebexExporter("webex", server.URL, "secret", "missing").Format(&api.Report{})
+	if err != nil {
+		t.Fatalf("Error formatting message: %s", err)
+	}
+	if err := send(); err == nil || !strings.Contains(err.Error(), "Could not find a room") {
+		t.Fatalf("Expected the error of the API, got: %v", err)
+	}
+}
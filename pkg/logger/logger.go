@@ -15,12 +15,25 @@ type Logger struct {
 
 // NewLogger creates a wrapper around zap
 func NewLogger(logLevel string) (*Logger, error) {
-	zap, err := newZap(logLevel)
+	zap, err := newZap(logLevel, zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), os.Stdout)
 	return &Logger{
 		zap,
 	}, err
 }
 
+// NewConsoleLogger creates a wrapper around zap which writes human readable logs to stderr, keeping stdout free for output
+func NewConsoleLogger(logLevel string) (*Logger, error) {
+	zap, err := newZap(logLevel, zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()), os.Stderr)
+	return &Logger{
+		zap,
+	}, err
+}
+
+// WithField returns a logger adding the field to every entry, e.g.: the ID of the run
+func (l *Logger) WithField(key string, value string) *Logger {
+	return &Logger{l.Logger.With(zap.String(key, value))}
+}
+
 // Debugf debug logs in printf style
 func (l *Logger) Debugf(msg string, values ...interface{}) {
 	l.Debug(fmt.Sprintf(msg, values...))
@@ -37,17 +50,16 @@ func (l *Logger) Errorf(msg string, values ...interface{}) {
 }
 
 // newZap creates a new zapcore logger instance
-func newZap(logLevel string) (*zap.Logger, error) {
+func newZap(logLevel string, encoder zapcore.Encoder, output *os.File) (*zap.Logger, error) {
 	atom := zap.NewAtomicLevel()
 	err := atom.UnmarshalText([]byte(logLevel))
 	if err != nil {
 		return nil, err
 	}
-	encoderCfg := zap.NewProductionEncoderConfig()
 
 	logger := zap.New(zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderCfg),
-		zapcore.Lock(os.Stdout),
+		encoder,
+		zapcore.Lock(output),
 		atom,
 	))
 
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	exp "github.com/nagypeterjob/ecr-scan-lambda/pkg/exporters"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// Policy is how Deliver attempts each notifier
+type Policy struct {
+	// Attempts of each notifier, less than 2 sends once
+	Attempts int
+	// Wait before the second attempt, doubled before each further one
+	Backoff time.Duration
+	// Attempts taking longer fail, 0 waits for them. The abandoned attempt isn't stopped and may still deliver,
+	// so it isn't retried either.
+	Timeout time.Duration
+}
+
+// sleep waits between attempts, replaced by tests
+var sleep = time.Sleep
+
+// Deliver formats the report for every notifier first like Send, then sends it through each of them as the policy
+// says. Unlike Send, a notifier failing every attempt doesn't keep the ones after it from being sent through,
+// the error names each failed notifier. A retried notifier sends its whole message again, e.g.: every Slack message.
+func Deliver(notifiers []Notifier, r *report.Report, p Policy) ([]Outcome, error) {
+	outcomes := make([]Outcome, len(notifiers))
+	for i, n := range notifiers {
+		outcomes[i] = Outcome{Notifier: n.Name(), Status: OutcomeNotSent}
+	}
+
+	sends := make([]func() error, 0, len(notifiers))
+	for i, n := range notifiers {
+		send, err := n.Format(r)
+		if err != nil {
+			outcomes[i].Status, outcomes[i].Error = OutcomeFailed, err.Error()
+			return outcomes, fmt.Errorf("%s: %s", n.Name(), err.Error())
+		}
+		sends = append(sends, send)
+	}
+	return outcomes, p.deliver(outcomes, sends)
+}
+
+// DeliverDigest formats the digest for every notifier able to send one like SendDigest, then sends it through
+// each of them as the policy says. Outcomes are those of the notifiers not skipped.
+func DeliverDigest(notifiers []Notifier, d *report.Digest, p Policy) (skipped []string, outcomes []Outcome, err error) {
+	var sends []func() error
+	for _, n := range notifiers {
+		de, ok := n.(exp.DigestExporter)
+		if !ok {
+			skipped = append(skipped, n.Name())
+			continue
+		}
+		send, err := de.FormatDigest(d)
+		if err != nil {
+			return skipped, nil, fmt.Errorf("%s: %s", n.Name(), err.Error())
+		}
+		outcomes = append(outcomes, Outcome{Notifier: n.Name(), Status: OutcomeNotSent})
+		sends = append(sends, send)
+	}
+	return skipped, outcomes, p.deliver(outcomes, sends)
+}
+
+// DeliverInventory formats the inventory for every notifier able to send one, then sends it through each of them
+// as the policy says. Notifiers are checked unwrapped, as inventories name no repository to redact.
+func DeliverInventory(notifiers []Notifier, inventory *report.Inventory, p Policy) (skipped []string, outcomes []Outcome, err error) {
+	var sends []func() error
+	for _, n := range notifiers {
+		ie, ok := exp.Unwrap(n).(exp.InventoryExporter)
+		if !ok {
+			skipped = append(skipped, n.Name())
+			continue
+		}
+		send, err := ie.FormatInventory(inventory)
+		if err != nil {
+			return skipped, nil, fmt.Errorf("%s: %s", n.Name(), err.Error())
+		}
+		outcomes = append(outcomes, Outcome{Notifier: n.Name(), Status: OutcomeNotSent})
+		sends = append(sends, send)
+	}
+	return skipped, outcomes, p.deliver(outcomes, sends)
+}
+
+// deliver sends through each notifier, noting the outcomes
+func (p Policy) deliver(outcomes []Outcome, sends []func() error) error {
+	var failed []string
+	for i, send := range sends {
+		attempts, err := p.send(send)
+		outcomes[i].Attempts = attempts
+		if err != nil {
+			outcomes[i].Status, outcomes[i].Error = OutcomeFailed, err.Error()
+			failed = append(failed, fmt.Sprintf("%s: %s", outcomes[i].Notifier, err.Error()))
+			continue
+		}
+		outcomes[i].Status = OutcomeSent
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// send attempts until the notifier sends, an attempt times out or the attempts run out, returns the number of
+// attempts and the last error
+func (p Policy) send(send func() error) (int, error) {
+	wait := p.Backoff
+	attempt := 1
+	for {
+		timedOut, err := p.attempt(send)
+		if err == nil || timedOut || attempt >= p.Attempts {
+			return attempt, err
+		}
+		sleep(wait)
+		wait *= 2
+		attempt++
+	}
+}
+
+// attempt sends once, failing when it takes longer than the timeout. Timed out tells the send was left running.
+func (p Policy) attempt(send func() error) (timedOut bool, err error) {
+	if p.Timeout <= 0 {
+		return false, send()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- send()
+	}()
+	select {
+	case err := <-done:
+		return false, err
+	case <-time.After(p.Timeout):
+		return true, fmt.Errorf("Timed out after %s", p.Timeout)
+	}
+}
+
+// Summary tells which notifiers sent and which failed, e.g.: sent: slack, sns; failed: mailgun after 3 attempts (timeout)
+func Summary(outcomes []Outcome) string {
+	var sent, failed, notSent []string
+	for _, o := range outcomes {
+		switch o.Status {
+		case OutcomeSent:
+			sent = append(sent, o.Notifier)
+		case OutcomeFailed:
+			if o.Attempts > 1 {
+				failed = append(failed, fmt.Sprintf("%s after %d attempts (%s)", o.Notifier, o.Attempts, o.Error))
+			} else {
+				failed = append(failed, fmt.Sprintf("%s (%s)", o.Notifier, o.Error))
+			}
+		default:
+			notSent = append(notSent, o.Notifier)
+		}
+	}
+
+	var parts []string
+	for _, part := range []struct {
+		label     string
+		notifiers []string
+	}{
+		{"sent", sent},
+		{"failed", failed},
+		{"not sent", notSent},
+	} {
+		if len(part.notifiers) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s", part.label, strings.Join(part.notifiers, ", ")))
+		}
+	}
+	if len(parts) == 0 {
+		return "no notifiers"
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// flakyNotifier fails the first failures attempts, then sends
+type flakyNotifier struct {
+	name     string
+	failures int
+	attempts *int
+	delay    time.Duration
+}
+
+func (f flakyNotifier) Name() string {
+	return f.name
+}
+
+func (f flakyNotifier) Format(r *report.Report) (func() error, error) {
+	return func() error {
+		*f.attempts++
+		time.Sleep(f.delay)
+		if *f.attempts <= f.failures {
+			return fmt.Errorf("attempt %d failed", *f.attempts)
+		}
+		return nil
+	}, nil
+}
+
+func (f flakyNotifier) FormatDigest(d *report.Digest) (func() error, error) {
+	return f.Format(nil)
+}
+
+func TestDeliver(t *testing.T) {
+	var waits []time.Duration
+	sleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+	defer func() { sleep = time.Sleep }()
+
+	var slack, sns, mailgun int
+	notifiers := []Notifier{
+		flakyNotifier{name: "slack", failures: 2, attempts: &slack},
+		flakyNotifier{name: "sns", failures: 5, attempts: &sns},
+		flakyNotifier{name: "mailgun", attempts: &mailgun},
+	}
+	outcomes, err := Deliver(notifiers, &report.Report{}, Policy{Attempts: 3, Backoff: time.Second})
+	if err == nil || err.Error() != "sns: attempt 3 failed" {
+		t.Fatalf("Expected error sns: attempt 3 failed, got: %v", err)
+	}
+
+	// A failed notifier doesn't keep the next one from sending
+	expected := []Outcome{
+		{Notifier: "slack", Status: OutcomeSent, Attempts: 3},
+		{Notifier: "sns", Status: OutcomeFailed, Error: "attempt 3 failed", Attempts: 3},
+		{Notifier: "mailgun", Status: OutcomeSent, Attempts: 1},
+	}
+	if fmt.Sprint(outcomes) != fmt.Sprint(expected) {
+		t.Fatalf("Expected outcomes %v, got: %v", expected, outcomes)
+	}
+	if fmt.Sprint(waits) != "[1s 2s 1s 2s]" {
+		t.Fatalf("Expected the backoff to double, got: %v", waits)
+	}
+	if summary := Summary(outcomes); summary != "sent: slack, mailgun; failed: sns after 3 attempts (attempt 3 failed)" {
+		t.Fatalf("Unexpected summary: %s", summary)
+	}
+
+	// Without a policy every notifier is attempted once
+	slack = 0
+	outcomes, err = Deliver(notifiers[:1], &report.Report{}, Policy{})
+	if err == nil || slack != 1 || outcomes[0].Attempts != 1 {
+		t.Fatalf("Expected a single attempt, got %d: %v", slack, err)
+	}
+}
+
+func TestDeliverTimeout(t *testing.T) {
+	var attempts int
+	notifiers := []Notifier{flakyNotifier{name: "slack", attempts: &attempts, delay: time.Second}}
+	outcomes, err := Deliver(notifiers, &report.Report{}, Policy{Attempts: 1, Timeout: 10 * time.Millisecond})
+	if err == nil || err.Error() != "slack: Timed out after 10ms" {
+		t.Fatalf("Expected the attempt to time out, got: %v", err)
+	}
+	if outcomes[0].Status != OutcomeFailed {
+		t.Fatalf("Expected the notifier to fail, got: %v", outcomes)
+	}
+}
+
+// slowNotifier delivers after the delay, telling each delivery on delivered
+type slowNotifier struct {
+	delay     time.Duration
+	delivered chan struct{}
+}
+
+func (s slowNotifier) Name() string {
+	return "slack"
+}
+
+func (s slowNotifier) Format(r *report.Report) (func() error, error) {
+	return func() error {
+		time.Sleep(s.delay)
+		s.delivered <- struct{}{}
+		return nil
+	}, nil
+}
+
+func TestDeliverTimeoutNotRetried(t *testing.T) {
+	delivered := make(chan struct{}, 3)
+	notifiers := []Notifier{slowNotifier{delay: 50 * time.Millisecond, delivered: delivered}}
+	outcomes, err := Deliver(notifiers, &report.Report{}, Policy{Attempts: 3, Timeout: 10 * time.Millisecond})
+	if err == nil || outcomes[0].Attempts != 1 {
+		t.Fatalf("Expected a single attempt to time out, got: %v, %v", outcomes, err)
+	}
+
+	// The abandoned attempt still delivers, but only once
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the abandoned attempt to deliver")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(delivered) != 0 {
+		t.Fatalf("Expected a single delivery, got %d more", len(delivered))
+	}
+}
+
+func TestDeliverDigest(t *testing.T) {
+	var slack int
+	notifiers := []Notifier{
+		flakyNotifier{name: "slack", failures: 1, attempts: &slack},
+		mockNotifier{name: "prometheus"},
+	}
+	skipped, outcomes, err := DeliverDigest(notifiers, &report.Digest{}, Policy{Attempts: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if fmt.Sprint(skipped) != "[prometheus]" {
+		t.Fatalf("Expected [prometheus] to be skipped, got: %v", skipped)
+	}
+	expected := []Outcome{{Notifier: "slack", Status: OutcomeSent, Attempts: 2}}
+	if fmt.Sprint(outcomes) != fmt.Sprint(expected) {
+		t.Fatalf("Expected outcomes %v, got: %v", expected, outcomes)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	cases := map[string][]Outcome{
+		"no notifiers": nil,
+		"sent: slack":  {{Notifier: "slack", Status: OutcomeSent, Attempts: 1}},
+		"failed: slack (bad template); not sent: sns": {
+			{Notifier: "slack", Status: OutcomeFailed, Error: "bad template"},
+			{Notifier: "sns", Status: OutcomeNotSent},
+		},
+	}
+	for expected, outcomes := range cases {
+		if summary := Summary(outcomes); summary != expected {
+			t.Fatalf("values are not equal, wanting: %s, got: %s", expected, summary)
+		}
+	}
+}
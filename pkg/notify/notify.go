@@ -0,0 +1,91 @@
+// Package notify sends a report through a set of notifiers, the exporters of the report lambda.
+package notify
+
+import (
+	"fmt"
+
+	exp "github.com/nagypeterjob/ecr-scan-lambda/pkg/exporters"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// Notifier formats a report and sends it somewhere, every exporter is a notifier
+type Notifier = exp.Exporter
+
+// Outcome tells whether a notifier sent the report
+type Outcome struct {
+	Notifier string `json:"notifier"`
+	// OutcomeSent, OutcomeFailed or OutcomeNotSent
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Times Deliver tried to send, not set by Send
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Outcomes of a notifier
+const (
+	OutcomeSent    = "sent"
+	OutcomeFailed  = "failed"
+	OutcomeNotSent = "not_sent"
+)
+
+// Send formats the report for every notifier first, then sends it through each of them.
+// Nothing is sent when any of the notifiers fails to format the report.
+func Send(notifiers []Notifier, r *report.Report) error {
+	_, err := SendOutcomes(notifiers, r)
+	return err
+}
+
+// SendOutcomes sends the report like Send, and returns the outcome of each notifier in order.
+// Notifiers after the one failing are not sent through.
+func SendOutcomes(notifiers []Notifier, r *report.Report) ([]Outcome, error) {
+	outcomes := make([]Outcome, len(notifiers))
+	for i, n := range notifiers {
+		outcomes[i] = Outcome{Notifier: n.Name(), Status: OutcomeNotSent}
+	}
+
+	sends := make([]func() error, 0, len(notifiers))
+	for i, n := range notifiers {
+		send, err := n.Format(r)
+		if err != nil {
+			outcomes[i].Status, outcomes[i].Error = OutcomeFailed, err.Error()
+			return outcomes, fmt.Errorf("%s: %s", n.Name(), err.Error())
+		}
+		sends = append(sends, send)
+	}
+
+	for i, send := range sends {
+		if err := send(); err != nil {
+			outcomes[i].Status, outcomes[i].Error = OutcomeFailed, err.Error()
+			return outcomes, fmt.Errorf("%s: %s", notifiers[i].Name(), err.Error())
+		}
+		outcomes[i].Status = OutcomeSent
+	}
+	return outcomes, nil
+}
+
+// SendDigest formats the digest for every notifier able to send one, then sends it through each of them.
+// Notifiers which only send daily reports are skipped, their names are returned.
+func SendDigest(notifiers []Notifier, d *report.Digest) (skipped []string, err error) {
+	var senders []Notifier
+	var sends []func() error
+	for _, n := range notifiers {
+		de, ok := n.(exp.DigestExporter)
+		if !ok {
+			skipped = append(skipped, n.Name())
+			continue
+		}
+		send, err := de.FormatDigest(d)
+		if err != nil {
+			return skipped, fmt.Errorf("%s: %s", n.Name(), err.Error())
+		}
+		senders = append(senders, n)
+		sends = append(sends, send)
+	}
+
+	for i, send := range sends {
+		if err := send(); err != nil {
+			return skipped, fmt.Errorf("%s: %s", senders[i].Name(), err.Error())
+		}
+	}
+	return skipped, nil
+}
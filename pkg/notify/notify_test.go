@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+type mockNotifier struct {
+	name      string
+	formatErr error
+	sendErr   error
+	sent      *[]string
+}
+
+func (m mockNotifier) Name() string {
+	return m.name
+}
+
+func (m mockNotifier) Format(r *report.Report) (func() error, error) {
+	if m.formatErr != nil {
+		return nil, m.formatErr
+	}
+	return func() error {
+		if m.sendErr != nil {
+			return m.sendErr
+		}
+		*m.sent = append(*m.sent, m.name)
+		return nil
+	}, nil
+}
+
+func TestSend(t *testing.T) {
+	cases := []struct {
+		notifiers func(sent *[]string) []Notifier
+		expected  []string
+		err       string
+	}{
+		{
+			notifiers: func(sent *[]string) []Notifier {
+				return []Notifier{mockNotifier{name: "slack", sent: sent}, mockNotifier{name: "sns", sent: sent}}
+			},
+			expected: []string{"slack", "sns"},
+		},
+		{
+			// A formatting error stops every notifier from sending
+			notifiers: func(sent *[]string) []Notifier {
+				return []Notifier{mockNotifier{name: "slack", sent: sent}, mockNotifier{name: "sns", sent: sent, formatErr: fmt.Errorf("bad template")}}
+			},
+			err: "sns: bad template",
+		},
+		{
+			notifiers: func(sent *[]string) []Notifier {
+				return []Notifier{mockNotifier{name: "slack", sent: sent, sendErr: fmt.Errorf("timeout")}, mockNotifier{name: "sns", sent: sent}}
+			},
+			err: "slack: timeout",
+		},
+	}
+
+	for i, c := range cases {
+		var sent []string
+		err := Send(c.notifiers(&sent), &report.Report{})
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("TestSend case %d expected error %s, got: %v", i, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestSend case %d unexpected error: %s", i, err)
+		}
+		if fmt.Sprint(sent) != fmt.Sprint(c.expected) {
+			t.Fatalf("TestSend case %d expected %v to be sent, got: %v", i, c.expected, sent)
+		}
+	}
+}
+
+func TestSendOutcomes(t *testing.T) {
+	var sent []string
+	notifiers := []Notifier{
+		mockNotifier{name: "slack", sent: &sent},
+		mockNotifier{name: "sns", sent: &sent, sendErr: fmt.Errorf("timeout")},
+		mockNotifier{name: "mailgun", sent: &sent},
+	}
+	outcomes, err := SendOutcomes(notifiers, &report.Report{})
+	if err == nil || err.Error() != "sns: timeout" {
+		t.Fatalf("Expected error sns: timeout, got: %v", err)
+	}
+	expected := []Outcome{
+		{Notifier: "slack", Status: OutcomeSent},
+		{Notifier: "sns", Status: OutcomeFailed, Error: "timeout"},
+		{Notifier: "mailgun", Status: OutcomeNotSent},
+	}
+	if fmt.Sprint(outcomes) != fmt.Sprint(expected) {
+		t.Fatalf("Expected outcomes %v, got: %v", expected, outcomes)
+	}
+}
+
+type mockDigestNotifier struct {
+	mockNotifier
+}
+
+func (m mockDigestNotifier) FormatDigest(d *report.Digest) (func() error, error) {
+	return m.Format(nil)
+}
+
+func TestSendDigest(t *testing.T) {
+	var sent []string
+	notifiers := []Notifier{
+		mockDigestNotifier{mockNotifier{name: "slack", sent: &sent}},
+		mockNotifier{name: "prometheus", sent: &sent},
+		mockDigestNotifier{mockNotifier{name: "sns", sent: &sent}},
+	}
+
+	skipped, err := SendDigest(notifiers, &report.Digest{})
+	if err != nil {
+		t.Fatalf("TestSendDigest unexpected error: %s", err)
+	}
+	if fmt.Sprint(sent) != "[slack sns]" {
+		t.Fatalf("TestSendDigest expected [slack sns] to be sent, got: %v", sent)
+	}
+	if fmt.Sprint(skipped) != "[prometheus]" {
+		t.Fatalf("TestSendDigest expected [prometheus] to be skipped, got: %v", skipped)
+	}
+
+	notifiers[2] = mockDigestNotifier{mockNotifier{name: "sns", sent: &sent, formatErr: fmt.Errorf("bad template")}}
+	sent = nil
+	if _, err := SendDigest(notifiers, &report.Digest{}); err == nil || err.Error() != "sns: bad template" {
+		t.Fatalf("TestSendDigest expected error sns: bad template, got: %v", err)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("TestSendDigest expected nothing to be sent, got: %v", sent)
+	}
+}
@@ -0,0 +1,48 @@
+package report
+
+import "time"
+
+// Age holds back repositories which became vulnerable recently and escalates those vulnerable for long, using the
+// stored reports of earlier days. Repositories vulnerable for fewer than grace days are moved to Pending, those
+// vulnerable for escalate days or more are marked Overdue. Zero days turn either off.
+func (r *Report) Age(date time.Time, history []DatedReport, grace int, escalate int) {
+	var reported []*RepositoryInfo
+	for _, info := range r.Filtered {
+		days := openDays(info, date, history)
+		if days < grace {
+			r.Pending = append(r.Pending, info)
+			continue
+		}
+		info.Overdue = escalate > 0 && days >= escalate
+		reported = append(reported, info)
+	}
+	r.Filtered = reported
+}
+
+// openDays returns the days since the repository became vulnerable: the date of the earliest of the consecutive
+// stored reports, up to the latest one before date, listing it as vulnerable or pending
+func openDays(info *RepositoryInfo, date time.Time, history []DatedReport) int {
+	since := date
+	for i := len(history) - 1; i >= 0; i-- {
+		if !history[i].Date.Before(date) {
+			continue
+		}
+		if !listed(history[i].Report, info.DisplayName()) {
+			break
+		}
+		since = history[i].Date
+	}
+	return int(date.Sub(since).Hours() / 24)
+}
+
+// listed reports whether the repository is vulnerable or pending in the report
+func listed(r *Report, name string) bool {
+	for _, repositories := range [][]*RepositoryInfo{r.Filtered, r.Pending} {
+		for _, info := range repositories {
+			if info.DisplayName() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAge(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 7, d, 0, 0, 0, 0, time.UTC)
+	}
+	history := []DatedReport{
+		{Date: day(10), Report: &Report{Filtered: []*RepositoryInfo{{Name: "team-a/api"}}}},
+		{Date: day(14), Report: &Report{Filtered: []*RepositoryInfo{{Name: "team-a/api"}, {Name: "team-b/api"}}}},
+		{Date: day(16), Report: &Report{Filtered: []*RepositoryInfo{{Name: "team-a/api"}}, Pending: []*RepositoryInfo{{Name: "team-b/web"}}}},
+		{Date: day(17), Report: &Report{Filtered: []*RepositoryInfo{{Name: "team-a/api"}}, Pending: []*RepositoryInfo{{Name: "team-b/web"}}}},
+		// An earlier run of the same day doesn't count
+		{Date: day(18), Report: &Report{Filtered: []*RepositoryInfo{{Name: "team-c/api"}}}},
+	}
+	report := &Report{Filtered: []*RepositoryInfo{
+		{Name: "team-a/api"},
+		{Name: "team-b/api"},
+		{Name: "team-b/web"},
+		{Name: "team-c/api"},
+	}}
+
+	report.Age(day(18), history, 2, 7)
+
+	// team-a/api: 8 days, team-b/api: vulnerable again today, team-b/web: 2 days, team-c/api: today
+	if len(report.Filtered) != 2 || report.Filtered[0].Name != "team-a/api" || report.Filtered[1].Name != "team-b/web" {
+		t.Fatalf("Unexpected vulnerable repositories: %+v", report.Filtered)
+	}
+	if !report.Filtered[0].Overdue || report.Filtered[1].Overdue {
+		t.Fatalf("Expected only team-a/api to be overdue: %+v", report.Filtered)
+	}
+	if len(report.Pending) != 2 || report.Pending[0].Name != "team-b/api" || report.Pending[1].Name != "team-c/api" {
+		t.Fatalf("Unexpected pending repositories: %+v", report.Pending)
+	}
+}
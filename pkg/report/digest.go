@@ -0,0 +1,161 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// DatedReport is the report of a daily run, as stored for digests
+type DatedReport struct {
+	Date   time.Time
+	Report *Report
+}
+
+// Digest rolls the daily reports of a period up
+type Digest struct {
+	From time.Time
+	To   time.Time
+	// Repositories vulnerable at the end of the period, but not at its start
+	New []*RepositoryInfo
+	// Repositories vulnerable at the start of the period, but not at its end
+	Resolved []*RepositoryInfo
+	// Outcome of each daily run of the period
+	Trend []DigestDay
+	// Repositories with findings open for longer than their severity allows
+	SLABreaches []SLABreach
+}
+
+// Redacted returns a copy of the digest with repository names replaced by redact, see Report.Redacted
+func (d *Digest) Redacted(redact func(name string) string) *Digest {
+	redacted := *d
+	redacted.New = redactAll(d.New, redact)
+	redacted.Resolved = redactAll(d.Resolved, redact)
+	redacted.SLABreaches = nil
+	for _, b := range d.SLABreaches {
+		b.Repository = redactAll([]*RepositoryInfo{b.Repository}, redact)[0]
+		redacted.SLABreaches = append(redacted.SLABreaches, b)
+	}
+	return &redacted
+}
+
+// DigestDay sums up a daily run
+type DigestDay struct {
+	Date       time.Time
+	Vulnerable int
+	Failed     int
+	Findings   map[string]int64
+}
+
+// SLABreach is a repository with findings of a severity open for longer than the SLA of the severity
+type SLABreach struct {
+	Repository *RepositoryInfo
+	Severity   string
+	Days       int
+}
+
+// NewDigest rolls up the reports of the last days, reports must be sorted by date. Reports before the period
+// are only used to tell how long findings have been open, sla maps severity levels to the days findings may stay open.
+func NewDigest(reports []DatedReport, days int, sla map[string]int) *Digest {
+	if len(reports) == 0 {
+		return &Digest{}
+	}
+
+	last := reports[len(reports)-1]
+	from := last.Date.AddDate(0, 0, -days+1)
+	var period []DatedReport
+	for _, r := range reports {
+		if !r.Date.Before(from) {
+			period = append(period, r)
+		}
+	}
+
+	digest := &Digest{From: period[0].Date, To: last.Date}
+	for _, r := range period {
+		digest.Trend = append(digest.Trend, DigestDay{
+			Date:       r.Date,
+			Vulnerable: len(r.Report.Filtered),
+			Failed:     len(r.Report.Failed),
+			Findings:   reportedFindings(r.Report.Filtered),
+		})
+	}
+
+	first := vulnerable(period[0].Report)
+	latest := vulnerable(last.Report)
+	for _, r := range last.Report.Filtered {
+		if first[r.DisplayName()] == nil {
+			digest.New = append(digest.New, r)
+		}
+	}
+	for _, r := range period[0].Report.Filtered {
+		if latest[r.DisplayName()] == nil {
+			digest.Resolved = append(digest.Resolved, r)
+		}
+	}
+
+	for _, r := range last.Report.Filtered {
+		if breach, ok := slaBreach(r, reports, sla); ok {
+			digest.SLABreaches = append(digest.SLABreaches, breach)
+		}
+	}
+	sort.SliceStable(digest.SLABreaches, func(i, j int) bool {
+		return digest.SLABreaches[i].Days > digest.SLABreaches[j].Days
+	})
+	return digest
+}
+
+// vulnerable maps the display names of the report's vulnerable repositories to them
+func vulnerable(r *Report) map[string]*RepositoryInfo {
+	repositories := make(map[string]*RepositoryInfo)
+	for _, info := range r.Filtered {
+		repositories[info.DisplayName()] = info
+	}
+	return repositories
+}
+
+// reportedFindings sums the findings shown in messages per severity
+func reportedFindings(repositories []*RepositoryInfo) map[string]int64 {
+	findings := make(map[string]int64)
+	for _, r := range repositories {
+		for key, val := range r.ReportedSeverity().Count {
+			if val != nil {
+				findings[key] += *val
+			}
+		}
+	}
+	return findings
+}
+
+// slaBreach returns the most severe SLA the repository breaches. Findings of a severity are open since
+// the earliest of the consecutive reports, up to the latest one, in which the repository has any of that severity.
+func slaBreach(info *RepositoryInfo, reports []DatedReport, sla map[string]int) (SLABreach, bool) {
+	last := reports[len(reports)-1].Date
+	for _, level := range severity.SeverityList {
+		limit, ok := sla[level]
+		if !ok || count(info, level) == 0 {
+			continue
+		}
+
+		since := last
+		for i := len(reports) - 1; i >= 0; i-- {
+			r := vulnerable(reports[i].Report)[info.DisplayName()]
+			if r == nil || count(r, level) == 0 {
+				break
+			}
+			since = reports[i].Date
+		}
+
+		if days := int(last.Sub(since).Hours() / 24); days >= limit {
+			return SLABreach{Repository: info, Severity: level, Days: days}, true
+		}
+	}
+	return SLABreach{}, false
+}
+
+func count(info *RepositoryInfo, level string) int64 {
+	if val := info.Severity.Count[level]; val != nil {
+		return *val
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+func TestNewDigest(t *testing.T) {
+	counts := func(level string, n int64) severity.Matrix {
+		return severity.Matrix{Count: map[string]*int64{level: &n}}
+	}
+	day := func(d int) time.Time {
+		return time.Date(2020, 7, d, 8, 0, 0, 0, time.UTC)
+	}
+
+	api := &RepositoryInfo{Name: "team-a/api", Severity: counts("CRITICAL", 2)}
+	worker := &RepositoryInfo{Name: "team-a/worker", Severity: counts("HIGH", 1)}
+	web := &RepositoryInfo{Name: "team-b/web", Severity: counts("HIGH", 3)}
+
+	reports := []DatedReport{
+		// Before the period, only tells how long findings have been open
+		{Date: day(1), Report: &Report{Filtered: []*RepositoryInfo{api}}},
+		{Date: day(6), Report: &Report{Filtered: []*RepositoryInfo{api, worker}}},
+		{Date: day(9), Report: &Report{Filtered: []*RepositoryInfo{api, worker}, Failed: []*RepositoryInfo{{Name: "team-c/job"}}}},
+		{Date: day(12), Report: &Report{Filtered: []*RepositoryInfo{api, web}}},
+	}
+
+	digest := NewDigest(reports, 7, map[string]int{"CRITICAL": 7, "HIGH": 30})
+
+	if !digest.From.Equal(day(6)) || !digest.To.Equal(day(12)) {
+		t.Fatalf("Unexpected period %s - %s", digest.From, digest.To)
+	}
+	if len(digest.Trend) != 3 || digest.Trend[1].Failed != 1 || digest.Trend[2].Findings["HIGH"] != 3 {
+		t.Fatalf("Unexpected trend: %+v", digest.Trend)
+	}
+	if len(digest.New) != 1 || digest.New[0].Name != "team-b/web" {
+		t.Fatalf("Expected team-b/web to be new, got: %+v", digest.New)
+	}
+	if len(digest.Resolved) != 1 || digest.Resolved[0].Name != "team-a/worker" {
+		t.Fatalf("Expected team-a/worker to be resolved, got: %+v", digest.Resolved)
+	}
+	// team-a/api has had critical findings since the 1st, team-b/web's high findings are within the SLA
+	if len(digest.SLABreaches) != 1 || digest.SLABreaches[0].Repository.Name != "team-a/api" || digest.SLABreaches[0].Severity != "CRITICAL" || digest.SLABreaches[0].Days != 11 {
+		t.Fatalf("Unexpected SLA breaches: %+v", digest.SLABreaches)
+	}
+
+	if empty := NewDigest(nil, 7, nil); len(empty.Trend) != 0 {
+		t.Fatalf("Expected an empty digest, got: %+v", empty)
+	}
+}
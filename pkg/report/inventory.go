@@ -0,0 +1,47 @@
+package report
+
+// Inventory counts the repositories and images of each registry, and how much of them is scanned
+type Inventory struct {
+	// Identifies the run which took the inventory
+	RunID      string
+	Registries []RegistryInventory
+}
+
+// RegistryInventory is the inventory of a registry in a region
+type RegistryInventory struct {
+	// Alias or ID of the account and the region, e.g.: prod/eu-west-1
+	Account    string
+	RegistryID string
+	Region     string
+	// Registry scan type, BASIC or ENHANCED, and its scanning rules, e.g.: SCAN_ON_PUSH on prod-*
+	ScanType string
+	Rules    []string
+	// Repositories, and those covered by a scanning rule, or scanning on push when the registry has no rules
+	Repositories        int
+	CoveredRepositories int
+	// Images, and those whose scan completed or which are scanned continuously
+	Images        int
+	ScannedImages int
+	// Why the inventory of the registry is incomplete, its counts are partial when set
+	Error string
+}
+
+// Coverage returns the percentage of images scanned, zero without images
+func (r RegistryInventory) Coverage() float64 {
+	if r.Images == 0 {
+		return 0
+	}
+	return float64(r.ScannedImages) * 100 / float64(r.Images)
+}
+
+// Total adds the counts of every registry up
+func (i *Inventory) Total() RegistryInventory {
+	var total RegistryInventory
+	for _, r := range i.Registries {
+		total.Repositories += r.Repositories
+		total.CoveredRepositories += r.CoveredRepositories
+		total.Images += r.Images
+		total.ScannedImages += r.ScannedImages
+	}
+	return total
+}
@@ -0,0 +1,576 @@
+// Package report holds the outcome of scanning a registry, independent of how it is gathered or sent.
+package report
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+// Report holds the outcome of gathering vulnerabilities
+type Report struct {
+	// Registry scan type, BASIC or ENHANCED
+	ScanType string
+	// Repositories hitting the severity threshold
+	Filtered []*RepositoryInfo
+	// Pull through cache repositories hitting the severity threshold, when reported separately
+	PullThroughCache []*RepositoryInfo
+	// Repositories gathered without findings hitting the threshold, not listed in messages
+	Clean []*RepositoryInfo
+	// Repositories which couldn't be scanned
+	Failed []*RepositoryInfo
+	// Repositories without any image
+	Empty []*RepositoryInfo
+	// Repositories whose image has never been scanned
+	NotScanned []*RepositoryInfo
+	// Repositories with scan on push disabled
+	ScanOnPushDisabled []*RepositoryInfo
+	// Repositories not covered by any registry scanning rule
+	NotCovered []*RepositoryInfo
+	// ECR Public repositories, which can't be scanned
+	Public []*RepositoryInfo
+	// Repositories whose image was pushed longer ago than the staleness limit
+	Stale []*RepositoryInfo
+	// Repositories holding many untagged images
+	Untagged []*RepositoryInfo
+	// Repositories without a lifecycle policy
+	NoLifecyclePolicy []*RepositoryInfo
+	// Repositories hitting the severity threshold, left out of messages while snoozed
+	Snoozed []*RepositoryInfo
+	// Snoozes about to expire, as reminders
+	SnoozeExpiring []*RepositoryInfo
+	// Suppressions about to expire, as reminders
+	SuppressionExpiring []*RepositoryInfo
+	// Repositories hitting the severity threshold for less than the grace period, left out of messages
+	Pending []*RepositoryInfo
+	// Repositories clean since the previous report, and those with vulnerabilities fixed since then
+	Resolved []*RepositoryInfo
+	// Lifecycle policy suggested for repositories without one, empty unless requested
+	SuggestedLifecyclePolicy string
+	// Number of repositories gathered
+	Scanned int
+	// Number of repositories left out because the time limit was reached
+	NotProcessed int
+	// Gathering was cancelled, an unknown number of repositories are missing
+	Interrupted bool
+	// Identifies the run which produced the report in messages, logs and artifacts
+	RunID string
+	// Date of the report shown in its header, now when zero
+	Date time.Time
+	// How long retrieving the findings of each gathered repository took
+	Fetches []Fetch
+	// Names of the repositories whose image scan was still in progress, reported with the findings known so far
+	InProgress []string
+}
+
+// Fetch is the retrieval of the findings of a repository, every image of it included
+type Fetch struct {
+	Repository string
+	Duration   time.Duration
+	// Retrieving the findings of an image failed, the repository is listed as failed
+	Failed bool
+}
+
+// Subset returns a report holding only the repositories for which keep returns true
+func (r *Report) Subset(keep func(*RepositoryInfo) bool) *Report {
+	filter := func(repositories []*RepositoryInfo) []*RepositoryInfo {
+		var kept []*RepositoryInfo
+		for _, repository := range repositories {
+			if keep(repository) {
+				kept = append(kept, repository)
+			}
+		}
+		return kept
+	}
+
+	// Fetches and scans in progress are kept by their repository, e.g.: along with its group
+	byName := make(map[string]*RepositoryInfo)
+	for _, repositories := range r.registrySections() {
+		for _, repository := range repositories {
+			if _, ok := byName[repository.Name]; !ok {
+				byName[repository.Name] = repository
+			}
+		}
+	}
+	repository := func(name string) *RepositoryInfo {
+		if info, ok := byName[name]; ok {
+			return info
+		}
+		return &RepositoryInfo{Name: name}
+	}
+
+	var fetches []Fetch
+	for _, f := range r.Fetches {
+		if keep(repository(f.Repository)) {
+			fetches = append(fetches, f)
+		}
+	}
+	var inProgress []string
+	for _, name := range r.InProgress {
+		if keep(repository(name)) {
+			inProgress = append(inProgress, name)
+		}
+	}
+
+	return &Report{
+		ScanType:                 r.ScanType,
+		Filtered:                 filter(r.Filtered),
+		PullThroughCache:         filter(r.PullThroughCache),
+		Clean:                    filter(r.Clean),
+		Failed:                   filter(r.Failed),
+		Empty:                    filter(r.Empty),
+		NotScanned:               filter(r.NotScanned),
+		ScanOnPushDisabled:       filter(r.ScanOnPushDisabled),
+		NotCovered:               filter(r.NotCovered),
+		Public:                   filter(r.Public),
+		Stale:                    filter(r.Stale),
+		Untagged:                 filter(r.Untagged),
+		NoLifecyclePolicy:        filter(r.NoLifecyclePolicy),
+		Snoozed:                  filter(r.Snoozed),
+		SnoozeExpiring:           filter(r.SnoozeExpiring),
+		SuppressionExpiring:      filter(r.SuppressionExpiring),
+		Pending:                  filter(r.Pending),
+		Resolved:                 filter(r.Resolved),
+		SuggestedLifecyclePolicy: r.SuggestedLifecyclePolicy,
+		Scanned:                  r.Scanned,
+		NotProcessed:             r.NotProcessed,
+		Interrupted:              r.Interrupted,
+		RunID:                    r.RunID,
+		Date:                     r.Date,
+		Fetches:                  fetches,
+		InProgress:               inProgress,
+	}
+}
+
+// Redacted returns a copy of the report with repository names replaced by redact, e.g.: masked for widely
+// readable channels. Renamed repositories lose their links, which hold the name.
+func (r *Report) Redacted(redact func(name string) string) *Report {
+	redacted := *r
+	for _, repositories := range []*[]*RepositoryInfo{
+		&redacted.Filtered, &redacted.PullThroughCache, &redacted.Clean, &redacted.Failed, &redacted.Empty,
+		&redacted.NotScanned, &redacted.ScanOnPushDisabled, &redacted.NotCovered, &redacted.Public, &redacted.Stale,
+		&redacted.Untagged, &redacted.NoLifecyclePolicy, &redacted.Snoozed, &redacted.SnoozeExpiring,
+		&redacted.SuppressionExpiring, &redacted.Pending, &redacted.Resolved,
+	} {
+		*repositories = redactAll(*repositories, redact)
+	}
+
+	redacted.Fetches = nil
+	for _, f := range r.Fetches {
+		f.Repository = redact(f.Repository)
+		redacted.Fetches = append(redacted.Fetches, f)
+	}
+	redacted.InProgress = nil
+	for _, name := range r.InProgress {
+		redacted.InProgress = append(redacted.InProgress, redact(name))
+	}
+	return &redacted
+}
+
+// redactAll returns copies of the repositories with their names replaced by redact
+func redactAll(repositories []*RepositoryInfo, redact func(name string) string) []*RepositoryInfo {
+	var redacted []*RepositoryInfo
+	for _, repository := range repositories {
+		copied := *repository
+		if name := redact(repository.Name); name != repository.Name {
+			copied.Name, copied.Link = name, ""
+			if copied.Snooze != nil {
+				snooze := *copied.Snooze
+				snooze.Repository = name
+				copied.Snooze = &snooze
+			}
+			if copied.Suppression != nil {
+				suppression := *copied.Suppression
+				suppression.Repository = name
+				copied.Suppression = &suppression
+			}
+			// The ARN of the resource denied holds the name
+			if copied.Denied != nil {
+				denied := *copied.Denied
+				denied.Resource = ""
+				copied.Denied = &denied
+			}
+		}
+		redacted = append(redacted, &copied)
+	}
+	return redacted
+}
+
+// SetAccount labels the repositories of the report with the account they belong to, public repositories aside
+func (r *Report) SetAccount(account string) {
+	for _, repositories := range r.registrySections() {
+		for _, repository := range repositories {
+			repository.Account = account
+		}
+	}
+}
+
+// SetGroup labels the repositories of the report with the group of each, public repositories aside
+func (r *Report) SetGroup(group func(repositoryName string) string) {
+	for _, repositories := range r.registrySections() {
+		for _, repository := range repositories {
+			repository.Group = group(repository.Name)
+		}
+	}
+}
+
+// registrySections returns the sections listing repositories of the private registry
+func (r *Report) registrySections() [][]*RepositoryInfo {
+	return [][]*RepositoryInfo{
+		r.Filtered, r.PullThroughCache, r.Clean, r.Failed, r.Empty, r.NotScanned, r.ScanOnPushDisabled,
+		r.NotCovered, r.Stale, r.Untagged, r.NoLifecyclePolicy, r.Snoozed, r.SnoozeExpiring, r.SuppressionExpiring,
+		r.Pending, r.Resolved,
+	}
+}
+
+// Merge appends the repositories of other to the sections of the report
+func (r *Report) Merge(other *Report) {
+	if r.ScanType == "" {
+		r.ScanType = other.ScanType
+	}
+	r.Filtered = append(r.Filtered, other.Filtered...)
+	r.PullThroughCache = append(r.PullThroughCache, other.PullThroughCache...)
+	r.Clean = append(r.Clean, other.Clean...)
+	r.Fetches = append(r.Fetches, other.Fetches...)
+	r.InProgress = append(r.InProgress, other.InProgress...)
+	r.Failed = append(r.Failed, other.Failed...)
+	r.Empty = append(r.Empty, other.Empty...)
+	r.NotScanned = append(r.NotScanned, other.NotScanned...)
+	r.ScanOnPushDisabled = append(r.ScanOnPushDisabled, other.ScanOnPushDisabled...)
+	r.NotCovered = append(r.NotCovered, other.NotCovered...)
+	r.Public = append(r.Public, other.Public...)
+	r.Stale = append(r.Stale, other.Stale...)
+	r.Untagged = append(r.Untagged, other.Untagged...)
+	r.NoLifecyclePolicy = append(r.NoLifecyclePolicy, other.NoLifecyclePolicy...)
+	r.Snoozed = append(r.Snoozed, other.Snoozed...)
+	r.SnoozeExpiring = append(r.SnoozeExpiring, other.SnoozeExpiring...)
+	r.SuppressionExpiring = append(r.SuppressionExpiring, other.SuppressionExpiring...)
+	r.Pending = append(r.Pending, other.Pending...)
+	r.Resolved = append(r.Resolved, other.Resolved...)
+	if r.SuggestedLifecyclePolicy == "" {
+		r.SuggestedLifecyclePolicy = other.SuggestedLifecyclePolicy
+	}
+	r.Scanned += other.Scanned
+	r.NotProcessed += other.NotProcessed
+	r.Interrupted = r.Interrupted || other.Interrupted
+	if r.RunID == "" {
+		r.RunID = other.RunID
+	}
+	if r.Date.IsZero() {
+		r.Date = other.Date
+	}
+}
+
+// MergeRegions merges the reports of several regions into one. Replicated images, found under the same
+// repository name with the same digest in more than one region, are reported once with every region they exist in.
+func MergeRegions(reports map[string]*Report) *Report {
+	var regions []string
+	for region := range reports {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	merged := &Report{}
+	seen := make(map[string]*RepositoryInfo)
+	for _, region := range regions {
+		regional := *reports[region]
+		regional.Filtered = replicas(seen, region, regional.Filtered)
+		regional.PullThroughCache = replicas(seen, region, regional.PullThroughCache)
+		merged.Merge(&regional)
+	}
+	return merged
+}
+
+// replicas returns copies of the repositories annotated with region, leaving out images already seen in another region
+func replicas(seen map[string]*RepositoryInfo, region string, repositories []*RepositoryInfo) []*RepositoryInfo {
+	var kept []*RepositoryInfo
+	for _, repository := range repositories {
+		key := repository.DisplayName() + "@" + repository.Digest
+		if first, ok := seen[key]; ok && repository.Digest != "" {
+			first.Regions = append(first.Regions, region)
+			continue
+		}
+
+		annotated := *repository
+		annotated.Regions = []string{region}
+		seen[key] = &annotated
+		kept = append(kept, &annotated)
+	}
+	return kept
+}
+
+// Summary counts the repositories of each section and the findings of vulnerable repositories
+type Summary struct {
+	Scanned            int              `json:"scanned"`
+	Vulnerable         int              `json:"vulnerable"`
+	PullThroughCache   int              `json:"pullThroughCache"`
+	Failed             int              `json:"failed"`
+	Empty              int              `json:"empty"`
+	NotScanned         int              `json:"notScanned"`
+	ScanOnPushDisabled int              `json:"scanOnPushDisabled"`
+	NotCovered         int              `json:"notCovered"`
+	Public             int              `json:"public"`
+	Stale              int              `json:"stale"`
+	Untagged           int              `json:"untagged"`
+	NoLifecyclePolicy  int              `json:"noLifecyclePolicy"`
+	NotProcessed       int              `json:"notProcessed"`
+	Interrupted        bool             `json:"interrupted"`
+	Findings           map[string]int64 `json:"findings"`
+	RunID              string           `json:"run_id,omitempty"`
+	Fingerprint        string           `json:"fingerprint"`
+}
+
+// Summary returns the numbers of the report
+func (r *Report) Summary() Summary {
+	findings := make(map[string]int64)
+	for _, repositories := range [][]*RepositoryInfo{r.Filtered, r.PullThroughCache} {
+		for _, repository := range repositories {
+			for level, count := range repository.Severity.Count {
+				if count != nil {
+					findings[level] += *count
+				}
+			}
+		}
+	}
+
+	return Summary{
+		Scanned:            r.Scanned,
+		Vulnerable:         len(r.Filtered),
+		PullThroughCache:   len(r.PullThroughCache),
+		Failed:             len(r.Failed),
+		Empty:              len(r.Empty),
+		NotScanned:         len(r.NotScanned),
+		ScanOnPushDisabled: len(r.ScanOnPushDisabled),
+		NotCovered:         len(r.NotCovered),
+		Public:             len(r.Public),
+		Stale:              len(r.Stale),
+		Untagged:           len(r.Untagged),
+		NoLifecyclePolicy:  len(r.NoLifecyclePolicy),
+		NotProcessed:       r.NotProcessed,
+		Interrupted:        r.Interrupted,
+		Findings:           findings,
+		RunID:              r.RunID,
+		Fingerprint:        r.Fingerprint(),
+	}
+}
+
+// Fingerprint returns a short form of Hash, for quoting the report in messages
+func (r *Report) Fingerprint() string {
+	return r.Hash()[:12]
+}
+
+// NewRunID returns a random identifier for runs which have none of their own
+func NewRunID() string {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(id)
+}
+
+// Hash returns a digest of the report content which doesn't depend on the order repositories were gathered in
+func (r *Report) Hash() string {
+	sections := map[string][]*RepositoryInfo{
+		"filtered":      r.Filtered,
+		"pullthrough":   r.PullThroughCache,
+		"failed":        r.Failed,
+		"empty":         r.Empty,
+		"notscanned":    r.NotScanned,
+		"scanonpushoff": r.ScanOnPushDisabled,
+		"notcovered":    r.NotCovered,
+		"public":        r.Public,
+		"stale":         r.Stale,
+		"untagged":      r.Untagged,
+		"nolifecycle":   r.NoLifecyclePolicy,
+	}
+
+	lines := []string{r.ScanType}
+	for section, repositories := range sections {
+		for _, repository := range repositories {
+			var counts []string
+			for level, count := range repository.Severity.Count {
+				if count != nil {
+					counts = append(counts, fmt.Sprintf("%s=%d", level, *count))
+				}
+			}
+			sort.Strings(counts)
+			lines = append(lines, fmt.Sprintf("%s\t%s\t%s", section, repository.DisplayName(), strings.Join(counts, ",")))
+		}
+	}
+	sort.Strings(lines[1:])
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// RepositoryInfo data structure for storing repositories
+type RepositoryInfo struct {
+	Name     string
+	Link     string
+	Platform string
+	Severity severity.Matrix
+	// Findings below this severity are left out of messages, all findings are shown when empty
+	MinimumSeverity string
+	// Why the findings couldn't be retrieved, only set on failed repositories
+	Cause string
+	// Permission missing to retrieve the findings, only set on repositories failing with CauseAccessDenied when the error tells
+	Denied *Denial
+	// When the image was pushed, zero when unknown
+	PushedAt time.Time
+	// Number and total size of untagged images, only set on repositories holding many of them
+	UntaggedImages int
+	UntaggedBytes  int64
+	// Tag and digest of the image the findings belong to
+	Tag    string
+	Digest string
+	// Every tag of the image, only set when each tagged image of the repository is listed separately
+	ImageTags []string
+	// When the findings were produced by the latest scan of the image, zero when unknown
+	ScanCompletedAt time.Time
+	// Registry, the AWS account ID, holding the repository, only set when the findings were retrieved
+	RegistryID string
+	// Alias or ID of the account and the region the repository is in, e.g.: prod/eu-west-1,
+	// only set when several registries are scanned into one report
+	Account string
+	// Value of the group tag of the repository, e.g.: payments, only set when repositories are grouped by a tag
+	Group string
+	// Regions the image exists in, only set by MergeRegions
+	Regions []string
+	// Image the build started from, as recorded in the manifest annotations
+	BaseImage string
+	// Reported findings in layers of the base image and in layers added on top of it, zero when unknown
+	BaseImageFindings   int
+	ApplicationFindings int
+	// Findings each source listed, a finding listed by several sources counted by each of them,
+	// only set when the findings of several sources are merged
+	Sources map[string]int
+	// IDs of the reported vulnerabilities, e.g.: CVE-2021-44228, only set when requested
+	Vulnerabilities []string
+	// Vulnerabilities gone since the previous report, only set on resolved repositories
+	Fixed []string
+	// Layers of the image vulnerable packages were introduced in, in image order, only set with enhanced scanning when requested
+	Layers []Layer
+	// Findings in operating system and in language packages, only set with enhanced scanning when requested
+	OSPackages       severity.Matrix
+	LanguagePackages severity.Matrix
+	// Commit and source repository the image was built from, as recorded in the manifest annotations
+	Revision string
+	Source   string
+	// Snooze of the repository, only set on snoozed repositories and reminders
+	Snooze *Snooze
+	// Suppression of the repository, only set on reminders
+	Suppression *Suppression
+	// Vulnerable for longer than the escalation period
+	Overdue bool
+}
+
+// Denial is the permission a request was denied, as read from the AccessDenied error
+type Denial struct {
+	// Action denied, e.g.: ecr:DescribeImageScanFindings
+	Action string
+	// ARN of the resource the action was denied on, empty when unknown
+	Resource string
+	// Which policy denied it, e.g.: no identity-based policy allows the ecr:DescribeImageScanFindings action
+	Reason string
+}
+
+// Layer of an image which introduced vulnerable packages
+type Layer struct {
+	// Position of the layer in the image, the first one is 1
+	Index  int
+	Digest string
+	// Build instruction which created the layer, e.g.: RUN apk add openssl, empty when unknown
+	Instruction string
+	// Reported findings of packages in the layer, and the names of the packages
+	Findings int
+	Packages []string
+}
+
+// Snooze keeps a repository, or a single vulnerability of it, out of reports until it expires
+type Snooze struct {
+	// Repository name pattern, * matches any sequence of characters
+	Repository string `json:"repository"`
+	// ID of the vulnerability, e.g.: CVE-2021-44228, the whole repository is snoozed when empty
+	Vulnerability string    `json:"vulnerability,omitempty"`
+	Until         time.Time `json:"until"`
+	Reason        string    `json:"reason,omitempty"`
+	// Who snoozed it, e.g.: a Slack user or an email address
+	By string `json:"by,omitempty"`
+}
+
+// Suppression leaves a repository out of reports until it expires
+type Suppression struct {
+	// Repository name pattern, * matches any sequence of characters
+	Repository string    `json:"repository"`
+	Until      time.Time `json:"until"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// Causes of failing to retrieve the findings of a repository
+const (
+	CauseImageNotFound = "ImageNotFound"
+	CauseAccessDenied  = "AccessDenied"
+	CauseThrottling    = "Throttling"
+	CauseOther         = "Other"
+)
+
+// Causes lists the failure causes in display order
+var Causes = []string{CauseImageNotFound, CauseAccessDenied, CauseThrottling, CauseOther}
+
+// DisplayName returns the repository name, prefixed with its account when several registries are scanned,
+// suffixed with the tags of the image when each tagged image is listed, and with the platform for
+// multi-architecture images
+func (r *RepositoryInfo) DisplayName() string {
+	name := r.Name
+	if r.Account != "" {
+		name = "[" + r.Account + "] " + name
+	}
+	if len(r.ImageTags) > 0 {
+		name += ":" + strings.Join(r.ImageTags, ",")
+	}
+	if r.Platform == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, r.Platform)
+}
+
+// WorstSeverity returns the most severe reported level the repository has findings of, empty when it has none
+func (r *RepositoryInfo) WorstSeverity() string {
+	reported := r.ReportedSeverity()
+	return reported.Worst()
+}
+
+// SortBySeverity orders the vulnerable and pull through cache repositories by their worst severity level, then by
+// the number of findings of that level, most severe first. Repositories alike are ordered by name.
+func (r *Report) SortBySeverity() {
+	sortBySeverity(r.Filtered)
+	sortBySeverity(r.PullThroughCache)
+}
+
+func sortBySeverity(repositories []*RepositoryInfo) {
+	sort.SliceStable(repositories, func(i, j int) bool {
+		a, b := repositories[i], repositories[j]
+		worstA, worstB := a.WorstSeverity(), b.WorstSeverity()
+		if worstA != worstB {
+			return worstB == "" || (worstA != "" && severity.MoreSevere(worstA, worstB))
+		}
+		if worstA != "" {
+			countA, countB := *a.ReportedSeverity().Count[worstA], *b.ReportedSeverity().Count[worstB]
+			if countA != countB {
+				return countA > countB
+			}
+		}
+		return a.DisplayName() < b.DisplayName()
+	})
+}
+
+// ReportedSeverity returns the finding counts shown in messages
+func (r *RepositoryInfo) ReportedSeverity() severity.Matrix {
+	return r.Severity.AtLeast(r.MinimumSeverity)
+}
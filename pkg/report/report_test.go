@@ -0,0 +1,211 @@
+package report
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+)
+
+func TestSubset(t *testing.T) {
+	report := &Report{
+		ScanType:   "BASIC",
+		Filtered:   []*RepositoryInfo{{Name: "team-a/api"}, {Name: "team-b/api"}},
+		Failed:     []*RepositoryInfo{{Name: "team-b/worker"}},
+		NotScanned: []*RepositoryInfo{{Name: "team-a/worker"}},
+	}
+
+	subset := report.Subset(func(r *RepositoryInfo) bool {
+		return strings.HasPrefix(r.Name, "team-a/")
+	})
+
+	expected := &Report{
+		ScanType:   "BASIC",
+		Filtered:   []*RepositoryInfo{{Name: "team-a/api"}},
+		NotScanned: []*RepositoryInfo{{Name: "team-a/worker"}},
+	}
+	if !reflect.DeepEqual(subset, expected) {
+		t.Fatalf("values not equal, wanting: %+v, got: %+v", expected, subset)
+	}
+	if len(report.Filtered) != 2 {
+		t.Fatalf("Subset must not modify the original report")
+	}
+}
+
+func TestSubsetByGroup(t *testing.T) {
+	report := &Report{
+		Filtered:   []*RepositoryInfo{{Name: "api", Group: "payments"}, {Name: "indexer", Group: "search"}},
+		Fetches:    []Fetch{{Repository: "api", Duration: time.Second}, {Repository: "indexer", Duration: 2 * time.Second}},
+		InProgress: []string{"api", "indexer"},
+	}
+
+	subset := report.Subset(func(r *RepositoryInfo) bool {
+		return r.Group == "payments"
+	})
+
+	if !reflect.DeepEqual(subset.Fetches, []Fetch{{Repository: "api", Duration: time.Second}}) {
+		t.Fatalf("Expected the fetch of the group's repository, got: %+v", subset.Fetches)
+	}
+	if !reflect.DeepEqual(subset.InProgress, []string{"api"}) {
+		t.Fatalf("Expected the scan in progress of the group's repository, got: %v", subset.InProgress)
+	}
+}
+
+func TestHash(t *testing.T) {
+	critical := int64(2)
+	high := int64(3)
+	api := &RepositoryInfo{Name: "team-a/api", Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": &critical}}}
+	worker := &RepositoryInfo{Name: "team-a/worker", Severity: severity.Matrix{Count: map[string]*int64{"HIGH": &high}}}
+
+	first := &Report{ScanType: "BASIC", Filtered: []*RepositoryInfo{api, worker}}
+	reordered := &Report{ScanType: "BASIC", Filtered: []*RepositoryInfo{worker, api}}
+	if first.Hash() != reordered.Hash() {
+		t.Fatalf("Expected hash not to depend on repository order")
+	}
+
+	moved := &Report{ScanType: "BASIC", Filtered: []*RepositoryInfo{api}, Failed: []*RepositoryInfo{worker}}
+	if first.Hash() == moved.Hash() {
+		t.Fatalf("Expected hash to change when a repository moves to another section")
+	}
+
+	more := int64(3)
+	changed := &Report{ScanType: "BASIC", Filtered: []*RepositoryInfo{
+		{Name: "team-a/api", Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": &more}}},
+		worker,
+	}}
+	if first.Hash() == changed.Hash() {
+		t.Fatalf("Expected hash to change when finding counts change")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	report := &Report{
+		Filtered: []*RepositoryInfo{{Name: "team-a/api"}},
+	}
+	report.Merge(&Report{
+		ScanType:   "BASIC",
+		Filtered:   []*RepositoryInfo{{Name: "team-b/api"}},
+		NotScanned: []*RepositoryInfo{{Name: "team-b/worker"}},
+		Stale:      []*RepositoryInfo{{Name: "team-b/api"}},
+		Untagged:   []*RepositoryInfo{{Name: "team-b/worker", UntaggedImages: 12}},
+	})
+
+	expected := &Report{
+		ScanType:   "BASIC",
+		Filtered:   []*RepositoryInfo{{Name: "team-a/api"}, {Name: "team-b/api"}},
+		NotScanned: []*RepositoryInfo{{Name: "team-b/worker"}},
+		Stale:      []*RepositoryInfo{{Name: "team-b/api"}},
+		Untagged:   []*RepositoryInfo{{Name: "team-b/worker", UntaggedImages: 12}},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("values not equal, wanting: %+v, got: %+v", expected, report)
+	}
+}
+
+func TestSetAccount(t *testing.T) {
+	report := &Report{
+		Filtered:            []*RepositoryInfo{{Name: "team-a/api"}},
+		Resolved:            []*RepositoryInfo{{Name: "team-a/web"}},
+		SnoozeExpiring:      []*RepositoryInfo{{Name: "team-b/api"}},
+		SuppressionExpiring: []*RepositoryInfo{{Name: "team-b/web"}},
+		Public:              []*RepositoryInfo{{Name: "public/tools"}},
+	}
+	report.SetAccount("prod/eu-west-1")
+
+	for _, r := range []*RepositoryInfo{report.Filtered[0], report.Resolved[0], report.SnoozeExpiring[0], report.SuppressionExpiring[0]} {
+		if r.Account != "prod/eu-west-1" {
+			t.Fatalf("Expected %s to be labelled with the account, got: %q", r.Name, r.Account)
+		}
+	}
+	if report.Public[0].Account != "" {
+		t.Fatalf("Expected public repositories not to be labelled, got: %q", report.Public[0].Account)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	one, four := int64(1), int64(4)
+	report := &Report{
+		Filtered: []*RepositoryInfo{
+			{Name: "team-a/api", Severity: severity.Matrix{Count: map[string]*int64{"CRITICAL": &one, "HIGH": &four}}},
+			{Name: "team-b/api", Severity: severity.Matrix{Count: map[string]*int64{"HIGH": &one}}},
+		},
+		Failed:  []*RepositoryInfo{{Name: "team-b/worker"}},
+		Scanned: 5,
+	}
+
+	expected := Summary{
+		Scanned:     5,
+		Vulnerable:  2,
+		Failed:      1,
+		Findings:    map[string]int64{"CRITICAL": 1, "HIGH": 5},
+		Fingerprint: report.Hash()[:12],
+	}
+	if summary := report.Summary(); !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("values not equal, wanting: %+v, got: %+v", expected, summary)
+	}
+}
+
+func TestMergeRegions(t *testing.T) {
+	merged := MergeRegions(map[string]*Report{
+		"us-east-1": {
+			Filtered: []*RepositoryInfo{{Name: "team-a/api", Digest: "sha256:a"}, {Name: "team-a/worker", Digest: "sha256:b"}},
+			Scanned:  2,
+		},
+		"eu-west-1": {
+			Filtered: []*RepositoryInfo{{Name: "team-a/api", Digest: "sha256:a"}, {Name: "team-a/worker", Digest: "sha256:c"}},
+			Failed:   []*RepositoryInfo{{Name: "team-b/api"}},
+			Scanned:  3,
+		},
+	})
+
+	expected := &Report{
+		Filtered: []*RepositoryInfo{
+			{Name: "team-a/api", Digest: "sha256:a", Regions: []string{"eu-west-1", "us-east-1"}},
+			{Name: "team-a/worker", Digest: "sha256:c", Regions: []string{"eu-west-1"}},
+			{Name: "team-a/worker", Digest: "sha256:b", Regions: []string{"us-east-1"}},
+		},
+		Failed:  []*RepositoryInfo{{Name: "team-b/api"}},
+		Scanned: 5,
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("values not equal, wanting: %+v, got: %+v", expected, merged)
+	}
+}
+
+func TestSortBySeverity(t *testing.T) {
+	count := func(counts ...int64) map[string]*int64 {
+		m := map[string]*int64{}
+		for i, c := range counts {
+			c := c
+			m[severity.SeverityList[i]] = &c
+		}
+		return m
+	}
+	report := &Report{
+		Filtered: []*RepositoryInfo{
+			{Name: "team/low", Severity: severity.Matrix{Count: count(0, 0, 0, 7)}},
+			{Name: "team/one-critical", Severity: severity.Matrix{Count: count(1, 9)}},
+			{Name: "team/high", Severity: severity.Matrix{Count: count(0, 3)}},
+			{Name: "team/b-critical", Severity: severity.Matrix{Count: count(2)}},
+			{Name: "team/a-critical", Severity: severity.Matrix{Count: count(2, 1)}},
+			// Reported from HIGH, the findings below don't count
+			{Name: "team/filtered", Severity: severity.Matrix{Count: count(0, 0, 5)}, MinimumSeverity: "HIGH"},
+		},
+	}
+
+	report.SortBySeverity()
+
+	var names []string
+	for _, r := range report.Filtered {
+		names = append(names, r.Name)
+	}
+	expected := []string{"team/a-critical", "team/b-critical", "team/one-critical", "team/high", "team/low", "team/filtered"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, names)
+	}
+	if worst := report.Filtered[3].WorstSeverity(); worst != "HIGH" {
+		t.Fatalf("values are not equal, wanting: HIGH, got: %s", worst)
+	}
+}
@@ -0,0 +1,67 @@
+package report
+
+import "sort"
+
+// Resolve lists in Resolved what was fixed since the previous report: repositories vulnerable then which are clean
+// now, and repositories still vulnerable whose vulnerabilities are partly gone. Vulnerabilities are only compared
+// when both reports list them. Repositories which failed or weren't gathered this time aren't resolved.
+func (r *Report) Resolve(previous *Report) {
+	r.Resolved = nil
+
+	clean := make(map[string]*RepositoryInfo)
+	for _, info := range r.Clean {
+		clean[info.DisplayName()] = info
+	}
+	vulnerable := make(map[string]*RepositoryInfo)
+	for _, repositories := range [][]*RepositoryInfo{r.Filtered, r.PullThroughCache, r.Pending, r.Snoozed} {
+		for _, info := range repositories {
+			vulnerable[info.DisplayName()] = info
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, repositories := range [][]*RepositoryInfo{previous.Filtered, previous.PullThroughCache, previous.Pending} {
+		for _, before := range repositories {
+			name := before.DisplayName()
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			if now, ok := clean[name]; ok {
+				resolved := *now
+				resolved.Fixed = before.Vulnerabilities
+				r.Resolved = append(r.Resolved, &resolved)
+				continue
+			}
+			now, ok := vulnerable[name]
+			if !ok || before.Vulnerabilities == nil || now.Vulnerabilities == nil {
+				continue
+			}
+			if fixed := missing(before.Vulnerabilities, now.Vulnerabilities); len(fixed) > 0 {
+				resolved := *now
+				resolved.Fixed = fixed
+				r.Resolved = append(r.Resolved, &resolved)
+			}
+		}
+	}
+
+	sort.Slice(r.Resolved, func(i, j int) bool {
+		return r.Resolved[i].DisplayName() < r.Resolved[j].DisplayName()
+	})
+}
+
+// missing returns the IDs of before which aren't in now
+func missing(before []string, now []string) []string {
+	current := make(map[string]bool)
+	for _, id := range now {
+		current[id] = true
+	}
+	var gone []string
+	for _, id := range before {
+		if !current[id] {
+			gone = append(gone, id)
+		}
+	}
+	return gone
+}
@@ -0,0 +1,49 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	previous := &Report{
+		Filtered: []*RepositoryInfo{
+			{Name: "team-a/api", Vulnerabilities: []string{"CVE-2023-0464", "CVE-2023-0465"}},
+			{Name: "team-a/web", Vulnerabilities: []string{"CVE-2023-0464", "CVE-2023-0465"}},
+			{Name: "team-b/api", Vulnerabilities: []string{"CVE-2023-0464"}},
+			// Stored before vulnerabilities were listed
+			{Name: "team-b/web"},
+			{Name: "team-c/api", Vulnerabilities: []string{"CVE-2023-0464"}},
+		},
+		Pending: []*RepositoryInfo{{Name: "team-c/web", Vulnerabilities: []string{"CVE-2023-0465"}}},
+	}
+	report := &Report{
+		Filtered: []*RepositoryInfo{
+			{Name: "team-a/web", Vulnerabilities: []string{"CVE-2023-0465", "CVE-2023-2650"}},
+			{Name: "team-b/api", Vulnerabilities: []string{"CVE-2023-0464"}},
+			{Name: "team-b/web", Vulnerabilities: []string{"CVE-2023-0464"}},
+		},
+		Clean: []*RepositoryInfo{{Name: "team-a/api", Link: "https://console.aws.amazon.com/ecr/repositories/team-a/api"}, {Name: "team-c/web"}},
+		// Failing isn't fixing
+		Failed: []*RepositoryInfo{{Name: "team-c/api"}},
+	}
+
+	report.Resolve(previous)
+
+	expected := map[string][]string{
+		"team-a/api": {"CVE-2023-0464", "CVE-2023-0465"},
+		"team-a/web": {"CVE-2023-0464"},
+		"team-c/web": {"CVE-2023-0465"},
+	}
+	if len(report.Resolved) != len(expected) {
+		t.Fatalf("Unexpected resolved repositories: %+v", report.Resolved)
+	}
+	for _, r := range report.Resolved {
+		if !reflect.DeepEqual(r.Fixed, expected[r.Name]) {
+			t.Fatalf("Unexpected fixed vulnerabilities of %s, wanting: %v, got: %v", r.Name, expected[r.Name], r.Fixed)
+		}
+	}
+	if report.Resolved[0].Name != "team-a/api" || report.Resolved[0].Link == "" {
+		t.Fatalf("Expected the repositories by name, as they are now: %+v", report.Resolved[0])
+	}
+}
@@ -0,0 +1,74 @@
+//go:build integration
+// +build integration
+
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	exp "github.com/nagypeterjob/ecr-scan-lambda/pkg/exporters"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/notify"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/testutil"
+	"github.com/nlopes/slack"
+)
+
+// TestIntegration runs the pipeline against LocalStack, see make integration
+func TestIntegration(t *testing.T) {
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		t.Skip("AWS_ENDPOINT_URL is not set")
+	}
+
+	sess, err := api.NewSession(api.SessionConfig{Region: "us-east-1", Endpoint: endpoint})
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+	client := ecr.New(sess)
+
+	// More repositories than fit on a single DescribeRepositories page
+	var repositories []string
+	for i := 0; i < 120; i++ {
+		repositories = append(repositories, fmt.Sprintf("integration/repo-%03d", i))
+	}
+	if err := testutil.Seed(client, repositories...); err != nil {
+		t.Fatalf("Error seeding repositories: %s", err)
+	}
+	defer testutil.Cleanup(client, repositories...)
+
+	r, err := Scan(context.Background(), Options{
+		Client:          client,
+		Region:          "us-east-1",
+		ImageTag:        "latest",
+		MinimumSeverity: "HIGH",
+		Workers:         4,
+		Selected: func(name string) bool {
+			return strings.HasPrefix(name, "integration/")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error scanning: %s", err)
+	}
+
+	// Seeded repositories hold no images, each of them ends up in exactly one section
+	found := len(r.Filtered) + len(r.Failed) + len(r.Empty) + len(r.NotScanned)
+	if found != len(repositories) {
+		t.Fatalf("Expected %d repositories in the report, got: %d", len(repositories), found)
+	}
+
+	server := testutil.NewSlackServer()
+	defer server.Close()
+
+	notifier := exp.NewSlackExporter("slack", "xoxb-test", "#ecr-scan", slack.OptionAPIURL(server.APIURL()))
+	if err := notify.Send([]notify.Notifier{notifier}, r); err != nil {
+		t.Fatalf("Error sending report: %s", err)
+	}
+	if server.Messages("#ecr-scan") == 0 {
+		t.Fatalf("Expected the report to be posted to Slack")
+	}
+}
@@ -0,0 +1,191 @@
+// Package scanner collects ECR image scan findings into a report, so other tools can embed
+// the logic of the report lambda instead of invoking it.
+//
+//	r, err := scanner.Scan(ctx, scanner.Options{
+//		Client:          ecr.New(sess),
+//		Region:          "us-east-1",
+//		ImageTag:        "latest",
+//		MinimumSeverity: "HIGH",
+//	})
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+)
+
+// Pull through cache handling modes
+const (
+	PullThroughInclude  = "include"
+	PullThroughSeparate = "separate"
+	PullThroughSkip     = "skip"
+)
+
+// Options configure a single scan
+type Options struct {
+	// ECR client of the scanned registry, required
+	Client api.ECRClient
+	// Registry to scan, the default registry of the account when empty
+	RegistryID string
+	// Region of the registry, used in links
+	Region string
+	// Tag of the image checked in every repository
+	ImageTag string
+	// Repositories with findings below this severity are left out of the report
+	MinimumSeverity string
+	// Enable scan on push on repositories which have it disabled
+	EnforceScanOnPush bool
+	// Number of repositories processed in parallel, 1 when not set
+	Workers int
+	// How pull through cache repositories are handled: include, separate or skip, include when empty
+	PullThroughCache string
+	// Leave repositories without images out of the report
+	SkipEmpty bool
+	// Stop at the first repository whose findings can't be retrieved and return the error
+	FailFast bool
+	// Only repositories it returns true for are scanned, every repository when nil
+	Selected func(name string) bool
+	// Called with the name of each repository listed, before any filtering, from the listing goroutine
+	Listed func(name string)
+	// Scan at most this many repositories, counted after filtering, every repository when zero
+	MaxRepositories int
+	// Public repositories are listed in the report as not scanned when set
+	Public *api.ECRPublicService
+	// Fine tuning of thresholds and filters
+	Service api.Options
+	// Logger of the scan, errors only go to stdout when nil
+	Logger *logger.Logger
+}
+
+// Scan describes the repositories of the registry and gathers their vulnerabilities.
+// Errors which only affect a part of the registry are logged and leave that part out of the report.
+func Scan(ctx context.Context, opts Options) (*report.Report, error) {
+	log := opts.Logger
+	if log == nil {
+		var err error
+		if log, err = logger.NewLogger("ERROR"); err != nil {
+			return nil, err
+		}
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancelFunc := context.WithCancel(ctx)
+	defer cancelFunc()
+
+	var scanned int64
+	serviceOptions := opts.Service
+	gathered := serviceOptions.Gathered
+	serviceOptions.Gathered = func(name string) {
+		atomic.AddInt64(&scanned, 1)
+		if gathered != nil {
+			gathered(name)
+		}
+	}
+
+	var failure error
+	var failOnce sync.Once
+	if opts.FailFast {
+		failed := serviceOptions.Failed
+		serviceOptions.Failed = func(name string, err error) {
+			failOnce.Do(func() {
+				failure = fmt.Errorf("Error gathering findings of %s: %s", name, err)
+				cancelFunc()
+			})
+			if failed != nil {
+				failed(name, err)
+			}
+		}
+	}
+
+	service := api.NewECRService(opts.RegistryID, opts.Region, opts.ImageTag, serviceOptions, log, opts.Client)
+
+	// Find out how the registry is scanned
+	service.LoadRegistryScanningConfiguration()
+
+	// Listing stops early once enough repositories are selected
+	listCtx, stopListing := context.WithCancel(ctx)
+	defer stopListing()
+
+	// Load all ecr repositories into a channel
+	repositories, describeError := service.DescribeRepositoriesPages(listCtx)
+	if opts.Listed != nil {
+		repositories = service.FilterRepositories(listCtx, repositories, func(r *ecr.Repository) bool {
+			opts.Listed(*r.RepositoryName)
+			return true
+		})
+	}
+
+	pullThrough := opts.PullThroughCache
+	if pullThrough == "" {
+		pullThrough = PullThroughInclude
+	}
+
+	if pullThrough != PullThroughInclude {
+		if err := service.LoadPullThroughCacheRules(); err != nil {
+			log.Errorf("Error describing pull through cache rules: %s", err.Error())
+		}
+	}
+
+	if pullThrough == PullThroughSkip {
+		repositories = service.FilterRepositories(listCtx, repositories, func(r *ecr.Repository) bool {
+			return !service.IsPullThroughCache(*r.RepositoryName)
+		})
+	}
+
+	if opts.Selected != nil {
+		repositories = service.FilterRepositories(listCtx, repositories, func(r *ecr.Repository) bool {
+			return opts.Selected(*r.RepositoryName)
+		})
+	}
+
+	if opts.MaxRepositories > 0 {
+		repositories = service.LimitRepositories(repositories, opts.MaxRepositories, stopListing)
+	}
+
+	// Scan repositories then filter them based on provided severity level
+	r := service.GatherVulnerabilities(ctx, repositories, opts.MinimumSeverity, opts.EnforceScanOnPush, workers)
+	// Sent once every repository has been listed
+	if err := <-describeError; err != nil {
+		return nil, err
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	r.Scanned = int(scanned)
+	// What was gathered until the cancellation is returned, so it can still be reported
+	if ctx.Err() != nil {
+		log.Errorf("Scan cancelled after %d repositories: %s", r.Scanned, ctx.Err())
+		r.Interrupted = true
+	}
+
+	if pullThrough == PullThroughSeparate {
+		service.SeparatePullThroughCache(r)
+	}
+
+	// List public repositories, they are reported as not scanned
+	if opts.Public != nil {
+		public, err := opts.Public.DescribeRepositories()
+		if err != nil {
+			log.Errorf("Error describing public repositories: %s", err.Error())
+		}
+		r.Public = public
+	}
+
+	if opts.SkipEmpty {
+		log.Infof("Skipping %d empty repositories", len(r.Empty))
+		r.Empty = nil
+	}
+
+	return r, nil
+}
@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/testutil"
+)
+
+func registry() *testutil.ECR {
+	return &testutil.ECR{
+		Repositories: []*ecr.Repository{
+			testutil.Repository("app/api"),
+			testutil.Repository("app/web"),
+			testutil.Repository("app/empty"),
+			testutil.Repository("tools/ci"),
+		},
+		Findings: map[string]map[string]int64{
+			"app/api":  {"CRITICAL": 2},
+			"app/web":  {"LOW": 3},
+			"tools/ci": {"HIGH": 1},
+		},
+		Empty: []string{"app/empty"},
+	}
+}
+
+func names(repositories []*report.RepositoryInfo) []string {
+	var out []string
+	for _, r := range repositories {
+		out = append(out, r.Name)
+	}
+	return out
+}
+
+func TestScan(t *testing.T) {
+	r, err := Scan(context.Background(), Options{
+		Client:          registry(),
+		Region:          "us-east-1",
+		ImageTag:        "latest",
+		MinimumSeverity: "HIGH",
+		Workers:         2,
+	})
+	if err != nil {
+		t.Fatalf("TestScan unexpected error: %s", err)
+	}
+	if len(r.Filtered) != 2 {
+		t.Fatalf("TestScan expected 2 repositories hitting the threshold, got: %v", names(r.Filtered))
+	}
+	if len(r.Empty) != 1 || r.Empty[0].Name != "app/empty" {
+		t.Fatalf("TestScan expected app/empty to be reported empty, got: %v", names(r.Empty))
+	}
+}
+
+func TestScanSelected(t *testing.T) {
+	var listed []string
+	r, err := Scan(context.Background(), Options{
+		Client:          registry(),
+		Region:          "us-east-1",
+		ImageTag:        "latest",
+		MinimumSeverity: "HIGH",
+		SkipEmpty:       true,
+		Selected: func(name string) bool {
+			return name != "tools/ci"
+		},
+		Listed: func(name string) {
+			listed = append(listed, name)
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestScanSelected unexpected error: %s", err)
+	}
+	if len(r.Filtered) != 1 || r.Filtered[0].Name != "app/api" {
+		t.Fatalf("TestScanSelected expected only app/api, got: %v", names(r.Filtered))
+	}
+	if len(r.Empty) != 0 {
+		t.Fatalf("TestScanSelected expected empty repositories to be skipped, got: %v", names(r.Empty))
+	}
+	if len(listed) != 4 {
+		t.Fatalf("TestScanSelected expected every repository to be listed, got: %v", listed)
+	}
+}
+
+func TestScanPullThroughCache(t *testing.T) {
+	client := registry()
+	client.Repositories = append(client.Repositories, testutil.Repository("docker-hub/library/nginx"))
+	client.Findings["docker-hub/library/nginx"] = map[string]int64{"CRITICAL": 1}
+	client.PullThroughPrefixes = []string{"docker-hub"}
+
+	r, err := Scan(context.Background(), Options{
+		Client:           client,
+		MinimumSeverity:  "HIGH",
+		PullThroughCache: PullThroughSeparate,
+	})
+	if err != nil {
+		t.Fatalf("TestScanPullThroughCache unexpected error: %s", err)
+	}
+	if len(r.PullThroughCache) != 1 || len(r.Filtered) != 2 {
+		t.Fatalf("TestScanPullThroughCache expected nginx to be separated, got: %v and %v", names(r.Filtered), names(r.PullThroughCache))
+	}
+}
+
+func TestScanDescribeError(t *testing.T) {
+	_, err := Scan(context.Background(), Options{
+		Client:          &testutil.ECR{DescribeErr: fmt.Errorf("Fake access denied")},
+		MinimumSeverity: "HIGH",
+	})
+	if err == nil {
+		t.Fatalf("TestScanDescribeError expected describe error to be returned")
+	}
+}
+
+func TestScanFailures(t *testing.T) {
+	client := registry()
+	client.FindingsErr = map[string]error{"app/web": fmt.Errorf("Fake throttling")}
+
+	r, err := Scan(context.Background(), Options{Client: client, MinimumSeverity: "HIGH"})
+	if err != nil {
+		t.Fatalf("TestScanFailures unexpected error: %s", err)
+	}
+	if len(r.Failed) != 1 || r.Scanned != 4 {
+		t.Fatalf("TestScanFailures expected 1 of 4 repositories to fail, got: %v of %d", names(r.Failed), r.Scanned)
+	}
+
+	_, err = Scan(context.Background(), Options{Client: client, MinimumSeverity: "HIGH", FailFast: true})
+	if err == nil || err.Error() != "Error gathering findings of app/web: Fake throttling" {
+		t.Fatalf("TestScanFailures expected fail fast error, got: %v", err)
+	}
+}
+
+func TestScanMaxRepositories(t *testing.T) {
+	r, err := Scan(context.Background(), Options{
+		Client:          registry(),
+		Region:          "us-east-1",
+		ImageTag:        "latest",
+		MinimumSeverity: "LOW",
+		Workers:         2,
+		Selected: func(name string) bool {
+			return name != "app/api"
+		},
+		MaxRepositories: 2,
+		Service:         api.Options{PageSize: 1},
+	})
+	if err != nil {
+		t.Fatalf("TestScanMaxRepositories unexpected error: %s", err)
+	}
+	// The cap applies after app/api is filtered out
+	if r.Scanned != 2 || len(r.Filtered) != 1 || r.Filtered[0].Name != "app/web" || len(r.Empty) != 1 {
+		t.Fatalf("TestScanMaxRepositories expected app/web and app/empty to be scanned, got: %d %v %v", r.Scanned, names(r.Filtered), names(r.Empty))
+	}
+}
+
+func TestScanCancelled(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	cancelFunc()
+
+	r, err := Scan(ctx, Options{
+		Client:          registry(),
+		Region:          "us-east-1",
+		ImageTag:        "latest",
+		MinimumSeverity: "HIGH",
+	})
+	if err != nil {
+		t.Fatalf("TestScanCancelled unexpected error: %s", err)
+	}
+	if !r.Interrupted {
+		t.Fatalf("TestScanCancelled expected the report to be marked interrupted")
+	}
+}
@@ -0,0 +1,66 @@
+package severity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Threshold modes decide how score and count thresholds combine
+const (
+	ThresholdModeScore = "score"
+	ThresholdModeCount = "count"
+	ThresholdModeAny   = "any"
+	ThresholdModeAll   = "all"
+)
+
+// ThresholdModes lists the valid threshold modes
+var ThresholdModes = []string{ThresholdModeScore, ThresholdModeCount, ThresholdModeAny, ThresholdModeAll}
+
+// CountThresholds maps severity levels to the number of findings which trigger a report
+type CountThresholds map[string]int64
+
+// ParseCountThresholds parses a comma separated list of SEVERITY=count pairs, e.g.: CRITICAL=1,HIGH=5
+func ParseCountThresholds(raw string) (CountThresholds, error) {
+	thresholds := CountThresholds{}
+	if raw == "" {
+		return thresholds, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid count threshold %q, expected SEVERITY=count pairs", raw)
+		}
+
+		count, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid count threshold %q, expected SEVERITY=count pairs", raw)
+		}
+		thresholds[strings.TrimSpace(parts[0])] = count
+	}
+	return thresholds, thresholds.Validate()
+}
+
+// Validate checks that thresholds refer to known severities with positive counts
+func (c CountThresholds) Validate() error {
+	for k, v := range c {
+		if _, ok := SeverityTable[k]; !ok {
+			return fmt.Errorf("Invalid count threshold, unknown severity %s", k)
+		}
+		if v <= 0 {
+			return fmt.Errorf("Invalid count threshold %d for %s, expected a positive count", v, k)
+		}
+	}
+	return nil
+}
+
+// HitCountThresholds reports whether the number of findings of any severity reaches its threshold
+func (sev *Matrix) HitCountThresholds(thresholds CountThresholds) bool {
+	for k, threshold := range thresholds {
+		if count, ok := sev.Count[k]; ok && count != nil && *count >= threshold {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package severity
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestParseCountThresholds(t *testing.T) {
+	thresholds, err := ParseCountThresholds("CRITICAL=1, HIGH=5")
+	if err != nil {
+		t.Fatalf("Error parsing count thresholds: %s", err)
+	}
+	expected := CountThresholds{"CRITICAL": 1, "HIGH": 5}
+	if !reflect.DeepEqual(thresholds, expected) {
+		t.Fatalf("values are not equal, wanting: %v, got: %v", expected, thresholds)
+	}
+
+	for _, raw := range []string{"CRITICAL", "CRITICAL=one", "SEVERE=1", "HIGH=0"} {
+		if _, err := ParseCountThresholds(raw); err == nil {
+			t.Fatalf("Expected error parsing %s", raw)
+		}
+	}
+}
+
+func TestHitCountThresholds(t *testing.T) {
+	thresholds := CountThresholds{"CRITICAL": 1, "HIGH": 5}
+
+	cases := []struct {
+		Severity Matrix
+		Expected bool
+	}{
+		{Severity: Matrix{Count: map[string]*int64{"CRITICAL": aws.Int64(1)}}, Expected: true},
+		{Severity: Matrix{Count: map[string]*int64{"HIGH": aws.Int64(4)}}, Expected: false},
+		{Severity: Matrix{Count: map[string]*int64{"HIGH": aws.Int64(5)}}, Expected: true},
+		{Severity: Matrix{Count: map[string]*int64{"INFORMATIONAL": aws.Int64(300)}}, Expected: false},
+	}
+
+	for i, c := range cases {
+		if hit := c.Severity.HitCountThresholds(thresholds); hit != c.Expected {
+			t.Fatalf("[%d] values are not equal, wanting: %t, got: %t", i, c.Expected, hit)
+		}
+	}
+}
@@ -5,9 +5,10 @@ type Matrix struct {
 	Count map[string]*int64
 }
 
-// SeverityList holds severity levels and maintains order during iteration
+// SeverityList holds severity levels and maintains order during iteration.
+// Enhanced scanning reports UNTRIAGED for vulnerabilities Inspector didn't assess yet.
 var SeverityList = []string{
-	"CRITICAL", "HIGH", "MEDIUM", "LOW", "INFORMATIONAL", "UNDEFINED",
+	"CRITICAL", "HIGH", "MEDIUM", "LOW", "INFORMATIONAL", "UNTRIAGED", "UNDEFINED",
 }
 
 // SeverityTable maps a score to each severity level
@@ -17,6 +18,7 @@ var SeverityTable = map[string]int{
 	"MEDIUM":        mediumSeverityScore,
 	"LOW":           lowSeverityScore,
 	"INFORMATIONAL": informationalSeverityScore,
+	"UNTRIAGED":     untriagedSeverityScore,
 	"UNDEFINED":     undefinedSeverityScore,
 }
 
@@ -26,14 +28,73 @@ const (
 	mediumSeverityScore        int = 20
 	lowSeverityScore           int = 10
 	informationalSeverityScore int = 5
+	untriagedSeverityScore     int = 1
 	undefinedSeverityScore     int = 1
 )
 
 // CalculateScore calculates severity score to each finding
 func (sev *Matrix) CalculateScore() int {
+	return sev.ScoreWith(nil)
+}
+
+// ScoreWith calculates severity score to each finding with the given weights
+func (sev *Matrix) ScoreWith(weights Weights) int {
 	score := 0
 	for k := range sev.Count {
-		score += SeverityTable[k]
+		score += weights.Score(k)
 	}
 	return score
 }
+
+// rank returns the position of the severity level in SeverityList, unknown levels rank last
+func rank(level string) int {
+	for i, l := range SeverityList {
+		if l == level {
+			return i
+		}
+	}
+	return len(SeverityList)
+}
+
+// Lowest returns the less severe of the two severity levels, ignoring empty ones
+func Lowest(a string, b string) string {
+	if a == "" || (b != "" && rank(b) > rank(a)) {
+		return b
+	}
+	return a
+}
+
+// MoreSevere reports whether level a is more severe than level b
+func MoreSevere(a string, b string) bool {
+	return rank(a) < rank(b)
+}
+
+// Reaches reports whether level is at least as severe as minimum, always true when minimum is empty
+func Reaches(level string, minimum string) bool {
+	return minimum == "" || rank(level) <= rank(minimum)
+}
+
+// Worst returns the most severe level with findings, empty when there are none
+func (sev *Matrix) Worst() string {
+	for _, level := range SeverityList {
+		if count := sev.Count[level]; count != nil && *count > 0 {
+			return level
+		}
+	}
+	return ""
+}
+
+// AtLeast returns the counts of severity levels at least as severe as minimum, every count when minimum is empty
+func (sev *Matrix) AtLeast(minimum string) Matrix {
+	if minimum == "" {
+		return *sev
+	}
+
+	count := make(map[string]*int64)
+	for k, v := range sev.Count {
+		if Reaches(k, minimum) {
+			count[k] = v
+		}
+	}
+	return Matrix{Count: count}
+}
@@ -40,6 +40,15 @@ func TestCalculateScore(t *testing.T) {
 			},
 			Expected: 111,
 		},
+		{
+			Severity: Matrix{
+				Count: map[string]*int64{
+					"MEDIUM":    aws.Int64(1),
+					"UNTRIAGED": aws.Int64(4),
+				},
+			},
+			Expected: 21,
+		},
 	}
 
 	for i, c := range cases {
@@ -49,3 +58,71 @@ func TestCalculateScore(t *testing.T) {
 		}
 	}
 }
+
+func TestLowest(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected string
+	}{
+		{a: "CRITICAL", b: "HIGH", expected: "HIGH"},
+		{a: "LOW", b: "MEDIUM", expected: "LOW"},
+		{a: "", b: "HIGH", expected: "HIGH"},
+		{a: "HIGH", b: "", expected: "HIGH"},
+	}
+
+	for i, c := range cases {
+		if lowest := Lowest(c.a, c.b); lowest != c.expected {
+			t.Fatalf("[%d] values are not equal, wanting: %s, got: %s", i, c.expected, lowest)
+		}
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	m := Matrix{
+		Count: map[string]*int64{
+			"CRITICAL":      aws.Int64(1),
+			"HIGH":          aws.Int64(2),
+			"LOW":           aws.Int64(3),
+			"INFORMATIONAL": aws.Int64(4),
+		},
+	}
+
+	cases := []struct {
+		minimum  string
+		expected []string
+	}{
+		{minimum: "HIGH", expected: []string{"CRITICAL", "HIGH"}},
+		{minimum: "MEDIUM", expected: []string{"CRITICAL", "HIGH"}},
+		{minimum: "", expected: []string{"CRITICAL", "HIGH", "LOW", "INFORMATIONAL"}},
+	}
+
+	for i, c := range cases {
+		count := m.AtLeast(c.minimum).Count
+		if len(count) != len(c.expected) {
+			t.Fatalf("[%d] values are not equal, wanting: %v, got: %v", i, c.expected, count)
+		}
+		for _, k := range c.expected {
+			if count[k] != m.Count[k] {
+				t.Fatalf("[%d] expected %s to be kept", i, k)
+			}
+		}
+	}
+}
+
+func TestWorst(t *testing.T) {
+	cases := []struct {
+		count    map[string]*int64
+		expected string
+	}{
+		{count: map[string]*int64{"CRITICAL": aws.Int64(0), "MEDIUM": aws.Int64(2), "LOW": aws.Int64(1)}, expected: "MEDIUM"},
+		{count: map[string]*int64{"UNDEFINED": aws.Int64(1), "HIGH": aws.Int64(1)}, expected: "HIGH"},
+		{count: map[string]*int64{"HIGH": aws.Int64(0)}, expected: ""},
+	}
+
+	for i, c := range cases {
+		m := Matrix{Count: c.count}
+		if worst := m.Worst(); worst != c.expected {
+			t.Fatalf("[%d] values are not equal, wanting: %s, got: %s", i, c.expected, worst)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package severity
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Weights maps a score to each severity level, a nil Weights scores levels by SeverityTable
+type Weights map[string]int
+
+// ParseWeights parses a JSON object mapping severity levels to scores, e.g.: {"CRITICAL": 1000, "HIGH": 100}
+func ParseWeights(raw string) (map[string]int, error) {
+	weights := map[string]int{}
+	if raw == "" {
+		return weights, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &weights); err != nil {
+		return nil, fmt.Errorf("Invalid severity weights %q, expected a JSON object of severity scores: %s", raw, err)
+	}
+	return weights, nil
+}
+
+// NewWeights returns the scores of SeverityTable with the given ones replaced, severities left out keep their default score
+func NewWeights(weights map[string]int) (Weights, error) {
+	table := Weights{}
+	for k, v := range SeverityTable {
+		table[k] = v
+	}
+
+	for k, v := range weights {
+		if _, ok := table[k]; !ok {
+			return nil, fmt.Errorf("Invalid severity weight, unknown severity %s", k)
+		}
+		if v <= 0 {
+			return nil, fmt.Errorf("Invalid severity weight %d for %s, expected a positive score", v, k)
+		}
+		table[k] = v
+	}
+	return table, nil
+}
+
+// Score returns the score of the severity level
+func (w Weights) Score(level string) int {
+	if w == nil {
+		return SeverityTable[level]
+	}
+	return w[level]
+}
@@ -0,0 +1,51 @@
+package severity
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestNewWeights(t *testing.T) {
+	parsed, err := ParseWeights(`{"CRITICAL": 1000, "HIGH": 100, "UNTRIAGED": 40}`)
+	if err != nil {
+		t.Fatalf("Error parsing severity weights: %s", err)
+	}
+	weights, err := NewWeights(parsed)
+	if err != nil {
+		t.Fatalf("Error creating severity weights: %s", err)
+	}
+
+	m := Matrix{
+		Count: map[string]*int64{
+			"CRITICAL":  aws.Int64(1),
+			"HIGH":      aws.Int64(2),
+			"LOW":       aws.Int64(3),
+			"UNTRIAGED": aws.Int64(1),
+		},
+	}
+	if score := m.ScoreWith(weights); score != 1150 {
+		t.Fatalf("values are not equal, wanting: %d, got: %d", 1150, score)
+	}
+	if score := m.CalculateScore(); score != 161 {
+		t.Fatalf("values are not equal, wanting: %d, got: %d", 161, score)
+	}
+	if score := weights.Score("LOW"); score != lowSeverityScore {
+		t.Fatalf("values are not equal, wanting: %d, got: %d", lowSeverityScore, score)
+	}
+}
+
+func TestNewWeightsErrors(t *testing.T) {
+	if _, err := ParseWeights(`CRITICAL=1000`); err == nil {
+		t.Fatalf("Expected error for malformed weights")
+	}
+	if _, err := NewWeights(map[string]int{"SEVERE": 10}); err == nil {
+		t.Fatalf("Expected error for unknown severity")
+	}
+	if _, err := NewWeights(map[string]int{"HIGH": 0}); err == nil {
+		t.Fatalf("Expected error for non positive score")
+	}
+	if SeverityTable["HIGH"] != highSeverityScore {
+		t.Fatalf("NewWeights must not modify SeverityTable")
+	}
+}
@@ -0,0 +1,198 @@
+// Package testutil provides in-memory fakes of the ECR and notification dependencies,
+// so code built on the scanner can be tested without AWS or Slack.
+package testutil
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+)
+
+// ECR is a fake registry implementing api.ECRClient.
+// Repositories without findings are reported as not scanned, unless they are listed in Empty.
+type ECR struct {
+	// Repositories of the registry
+	Repositories []*ecr.Repository
+	// Finding counts per severity of each repository's image
+	Findings map[string]map[string]int64
+	// Repositories without any image
+	Empty []string
+	// Errors returned when describing the findings of a repository
+	FindingsErr map[string]error
+	// Tags of each repository
+	Tags map[string]map[string]string
+	// Repository prefixes of pull through cache rules
+	PullThroughPrefixes []string
+	// Returned by DescribeRepositoriesPages when set
+	DescribeErr error
+	// Lifecycle policy text of each repository, repositories not listed have none
+	LifecyclePolicies map[string]string
+	// Repositories whose image scan is in progress, their findings are empty
+	InProgress []string
+
+	mu sync.Mutex
+	// Repositories scan on push was enabled on
+	ScanOnPushEnabled []string
+	// Repositories an image scan was started on
+	ScansStarted []string
+}
+
+var _ api.ECRClient = &ECR{}
+
+// Repository returns a repository with scan on push enabled
+func Repository(name string) *ecr.Repository {
+	return &ecr.Repository{
+		RepositoryName:             aws.String(name),
+		RepositoryArn:              aws.String("arn:aws:ecr:us-east-1:123456789012:repository/" + name),
+		ImageScanningConfiguration: &ecr.ImageScanningConfiguration{ScanOnPush: aws.Bool(true)},
+	}
+}
+
+// BatchGetImage returns no images, so every image is treated as single architecture
+func (f *ECR) BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error) {
+	return &ecr.BatchGetImageOutput{}, nil
+}
+
+// DescribeImageScanFindings .
+func (f *ECR) DescribeImageScanFindings(input *ecr.DescribeImageScanFindingsInput) (*ecr.DescribeImageScanFindingsOutput, error) {
+	name := aws.StringValue(input.RepositoryName)
+	if err, ok := f.FindingsErr[name]; ok {
+		return nil, err
+	}
+	for _, n := range f.InProgress {
+		if n == name {
+			return &ecr.DescribeImageScanFindingsOutput{
+				ImageScanStatus: &ecr.ImageScanStatus{Status: aws.String(ecr.ScanStatusInProgress)},
+				RepositoryName:  input.RepositoryName,
+				ImageId:         &ecr.ImageIdentifier{ImageDigest: aws.String("sha256:" + name)},
+			}, nil
+		}
+	}
+	findings, ok := f.Findings[name]
+	if !ok {
+		if f.isEmpty(name) {
+			return nil, awserr.New(ecr.ErrCodeImageNotFoundException, "The image requested does not exist", nil)
+		}
+		return nil, awserr.New(ecr.ErrCodeScanNotFoundException, "Image scan does not exist", nil)
+	}
+
+	counts := make(map[string]*int64)
+	for severity, count := range findings {
+		counts[severity] = aws.Int64(count)
+	}
+	return &ecr.DescribeImageScanFindingsOutput{
+		ImageScanFindings: &ecr.ImageScanFindings{FindingSeverityCounts: counts},
+		RepositoryName:    input.RepositoryName,
+		ImageId:           &ecr.ImageIdentifier{ImageDigest: aws.String("sha256:" + name)},
+	}, nil
+}
+
+// DescribeImages returns an image for each repository not empty, scanned when the repository has findings
+func (f *ECR) DescribeImages(input *ecr.DescribeImagesInput) (*ecr.DescribeImagesOutput, error) {
+	if f.isEmpty(aws.StringValue(input.RepositoryName)) {
+		return &ecr.DescribeImagesOutput{}, nil
+	}
+	image := &ecr.ImageDetail{RepositoryName: input.RepositoryName}
+	if _, ok := f.Findings[aws.StringValue(input.RepositoryName)]; ok {
+		image.ImageScanStatus = &ecr.ImageScanStatus{Status: aws.String(ecr.ScanStatusComplete)}
+	}
+	return &ecr.DescribeImagesOutput{ImageDetails: []*ecr.ImageDetail{image}}, nil
+}
+
+// DescribePullThroughCacheRulesPages .
+func (f *ECR) DescribePullThroughCacheRulesPages(input *ecr.DescribePullThroughCacheRulesInput, fn func(*ecr.DescribePullThroughCacheRulesOutput, bool) bool) error {
+	var rules []*ecr.PullThroughCacheRule
+	for _, prefix := range f.PullThroughPrefixes {
+		rules = append(rules, &ecr.PullThroughCacheRule{EcrRepositoryPrefix: aws.String(prefix)})
+	}
+	fn(&ecr.DescribePullThroughCacheRulesOutput{PullThroughCacheRules: rules}, true)
+	return nil
+}
+
+// DescribeRepositoriesPages returns the repositories in pages of MaxResults, on a single page when not set
+func (f *ECR) DescribeRepositoriesPages(input *ecr.DescribeRepositoriesInput, fn func(*ecr.DescribeRepositoriesOutput, bool) bool) error {
+	if f.DescribeErr != nil {
+		return f.DescribeErr
+	}
+
+	size := len(f.Repositories)
+	if input.MaxResults != nil {
+		size = int(*input.MaxResults)
+	}
+	for start := 0; ; start += size {
+		end := start + size
+		if end > len(f.Repositories) {
+			end = len(f.Repositories)
+		}
+		last := end == len(f.Repositories)
+		if !fn(&ecr.DescribeRepositoriesOutput{Repositories: f.Repositories[start:end]}, last) || last {
+			return nil
+		}
+	}
+}
+
+// GetDownloadUrlForLayer fails, the fake registry holds no layers
+func (f *ECR) GetDownloadUrlForLayer(input *ecr.GetDownloadUrlForLayerInput) (*ecr.GetDownloadUrlForLayerOutput, error) {
+	return nil, awserr.New(ecr.ErrCodeLayersNotFoundException, "Layer does not exist", nil)
+}
+
+// GetLifecyclePolicy .
+func (f *ECR) GetLifecyclePolicy(input *ecr.GetLifecyclePolicyInput) (*ecr.GetLifecyclePolicyOutput, error) {
+	policy, ok := f.LifecyclePolicies[aws.StringValue(input.RepositoryName)]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeLifecyclePolicyNotFoundException, "Lifecycle policy does not exist", nil)
+	}
+	return &ecr.GetLifecyclePolicyOutput{RepositoryName: input.RepositoryName, LifecyclePolicyText: aws.String(policy)}, nil
+}
+
+// GetRegistryScanningConfiguration reports basic scanning without rules
+func (f *ECR) GetRegistryScanningConfiguration(input *ecr.GetRegistryScanningConfigurationInput) (*ecr.GetRegistryScanningConfigurationOutput, error) {
+	return &ecr.GetRegistryScanningConfigurationOutput{
+		ScanningConfiguration: &ecr.RegistryScanningConfiguration{ScanType: aws.String(ecr.ScanTypeBasic)},
+	}, nil
+}
+
+// ListTagsForResource .
+func (f *ECR) ListTagsForResource(input *ecr.ListTagsForResourceInput) (*ecr.ListTagsForResourceOutput, error) {
+	output := &ecr.ListTagsForResourceOutput{}
+	for _, r := range f.Repositories {
+		if aws.StringValue(r.RepositoryArn) != aws.StringValue(input.ResourceArn) {
+			continue
+		}
+		for key, value := range f.Tags[aws.StringValue(r.RepositoryName)] {
+			output.Tags = append(output.Tags, &ecr.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+	}
+	return output, nil
+}
+
+// PutImageScanningConfiguration records the repository in ScanOnPushEnabled
+func (f *ECR) PutImageScanningConfiguration(input *ecr.PutImageScanningConfigurationInput) (*ecr.PutImageScanningConfigurationOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ScanOnPushEnabled = append(f.ScanOnPushEnabled, aws.StringValue(input.RepositoryName))
+	return &ecr.PutImageScanningConfigurationOutput{
+		RepositoryName:             input.RepositoryName,
+		ImageScanningConfiguration: input.ImageScanningConfiguration,
+	}, nil
+}
+
+// StartImageScan records the repository in ScansStarted
+func (f *ECR) StartImageScan(input *ecr.StartImageScanInput) (*ecr.StartImageScanOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ScansStarted = append(f.ScansStarted, aws.StringValue(input.RepositoryName))
+	return &ecr.StartImageScanOutput{RepositoryName: input.RepositoryName}, nil
+}
+
+func (f *ECR) isEmpty(name string) bool {
+	for _, e := range f.Empty {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
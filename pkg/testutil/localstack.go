@@ -0,0 +1,93 @@
+package testutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+)
+
+// Seed creates repositories with scan on push enabled, e.g.: in LocalStack. Existing repositories are left alone.
+func Seed(client ecriface.ECRAPI, repositories ...string) error {
+	for _, name := range repositories {
+		_, err := client.CreateRepository(&ecr.CreateRepositoryInput{
+			RepositoryName:             aws.String(name),
+			ImageScanningConfiguration: &ecr.ImageScanningConfiguration{ScanOnPush: aws.Bool(true)},
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ecr.ErrCodeRepositoryAlreadyExistsException {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cleanup deletes repositories along with their images. Missing repositories are ignored.
+func Cleanup(client ecriface.ECRAPI, repositories ...string) error {
+	for _, name := range repositories {
+		_, err := client.DeleteRepository(&ecr.DeleteRepositoryInput{
+			RepositoryName: aws.String(name),
+			Force:          aws.Bool(true),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ecr.ErrCodeRepositoryNotFoundException {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SlackServer mocks the Slack Web API, point the Slack client to URL with slack.OptionAPIURL
+type SlackServer struct {
+	*httptest.Server
+	// Error code returned for every request when set, e.g.: invalid_auth
+	Error string
+
+	mu       sync.Mutex
+	messages map[string]int
+}
+
+// NewSlackServer starts a mock Slack Web API, close it when done
+func NewSlackServer() *SlackServer {
+	s := &SlackServer{messages: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// APIURL is the base URL of the Web API methods
+func (s *SlackServer) APIURL() string {
+	return s.URL + "/"
+}
+
+// Messages returns the number of messages posted to channel
+func (s *SlackServer) Messages(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages[channel]
+}
+
+func (s *SlackServer) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.Error != "" {
+		w.Write([]byte(`{"ok": false, "error": "` + s.Error + `"}`))
+		return
+	}
+	if r.URL.Path != "/chat.postMessage" {
+		w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+		return
+	}
+
+	r.ParseForm()
+	s.mu.Lock()
+	s.messages[r.FormValue("channel")]++
+	s.mu.Unlock()
+	w.Write([]byte(`{"ok": true, "channel": "C123", "ts": "1595116800.000100"}`))
+}
@@ -0,0 +1,31 @@
+package testutil
+
+import (
+	"testing"
+
+	exp "github.com/nagypeterjob/ecr-scan-lambda/pkg/exporters"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nlopes/slack"
+)
+
+func TestSlackServer(t *testing.T) {
+	server := NewSlackServer()
+	defer server.Close()
+
+	exporter := exp.NewSlackExporter("slack", "xoxb-test", "#ecr-scan", slack.OptionAPIURL(server.APIURL()))
+	send, err := exporter.Format(&report.Report{})
+	if err != nil {
+		t.Fatalf("Error formatting report: %s", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("Error sending report: %s", err)
+	}
+	if server.Messages("#ecr-scan") == 0 {
+		t.Fatalf("Expected messages to be posted to #ecr-scan")
+	}
+
+	server.Error = "channel_not_found"
+	if err := send(); err == nil || err.Error() != "channel_not_found" {
+		t.Fatalf("Expected channel_not_found error, got: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package testutil
+
+import (
+	"context"
+	"sync"
+
+	exp "github.com/nagypeterjob/ecr-scan-lambda/pkg/exporters"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/notify"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nlopes/slack"
+)
+
+// Notifier records every report sent through it
+type Notifier struct {
+	// Name of the notifier, fake when empty
+	NotifierName string
+	// Returned by the send function when set
+	SendErr error
+
+	mu sync.Mutex
+	// Reports sent, in order
+	Sent []*report.Report
+	// Digests sent, in order
+	Digests []*report.Digest
+	// Inventories sent, in order
+	Inventories []*report.Inventory
+}
+
+var _ notify.Notifier = &Notifier{}
+
+var _ exp.DigestExporter = &Notifier{}
+
+var _ exp.InventoryExporter = &Notifier{}
+
+// Name .
+func (n *Notifier) Name() string {
+	if n.NotifierName == "" {
+		return "fake"
+	}
+	return n.NotifierName
+}
+
+// Format returns a function which records the report
+func (n *Notifier) Format(r *report.Report) (func() error, error) {
+	return func() error {
+		if n.SendErr != nil {
+			return n.SendErr
+		}
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.Sent = append(n.Sent, r)
+		return nil
+	}, nil
+}
+
+// FormatDigest returns a function which records the digest
+func (n *Notifier) FormatDigest(d *report.Digest) (func() error, error) {
+	return func() error {
+		if n.SendErr != nil {
+			return n.SendErr
+		}
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.Digests = append(n.Digests, d)
+		return nil
+	}, nil
+}
+
+// FormatInventory returns a function which records the inventory
+func (n *Notifier) FormatInventory(inventory *report.Inventory) (func() error, error) {
+	return func() error {
+		if n.SendErr != nil {
+			return n.SendErr
+		}
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.Inventories = append(n.Inventories, inventory)
+		return nil
+	}, nil
+}
+
+// Slack is a fake Slack client implementing exporters.SlackClient
+type Slack struct {
+	// Returned by PostMessageContext when set
+	PostErr error
+
+	mu sync.Mutex
+	// Number of messages posted per channel
+	Posted map[string]int
+}
+
+var _ exp.SlackClient = &Slack{}
+
+// PostMessageContext counts the message posted to channelID
+func (s *Slack) PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	if s.PostErr != nil {
+		return "", "", s.PostErr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Posted == nil {
+		s.Posted = make(map[string]int)
+	}
+	s.Posted[channelID]++
+	return channelID, "1", nil
+}
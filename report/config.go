@@ -3,41 +3,262 @@ package main
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/configfile"
+	exp "github.com/nagypeterjob/ecr-scan-lambda/pkg/exporters"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/notify"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
 )
 
 // Config stores lambda configuration
 type config struct {
-	region          string
-	minimumSeverity string
-	env             string
-	ecrID           string
-	imageTag        string
-	exporters       string
-	logLevel        string
-	numWorkers      string
+	region              string
+	minimumSeverity     string
+	env                 string
+	ecrID               string
+	ecrIDs              string
+	accountAliases      string
+	imageTag            string
+	exporters           string
+	logLevel            string
+	numWorkers          string
+	maxRepos            string
+	pageSize            string
+	rateLimit           string
+	staleDays           string
+	maxImageAge         string
+	untagged            string
+	lifecycleAudit      string
+	scanScope           string
+	newestImages        string
+	baseImage           string
+	packageTypes        string
+	layers              string
+	tagFilter           string
+	groupTag            string
+	emptyRepos          string
+	enforceScanPush     string
+	includePublic       string
+	pullThrough         string
+	multiArch           string
+	consoleDomain       string
+	fips                string
+	dualStack           string
+	endpoint            string
+	ecrEndpoint         string
+	stsEndpoint         string
+	s3Endpoint          string
+	httpTimeout         string
+	ecrCallTimeout      string
+	runTimeout          string
+	httpMaxIdleConns    string
+	proxyURL            string
+	ssmPath             string
+	ssmTTL              string
+	kmsEncrypted        string
+	configURI           string
+	weights             string
+	countThresholds     string
+	thresholdMode       string
+	showAll             string
+	groupNamespaces     string
+	severityDisplay     string
+	compliance          string
+	timezone            string
+	dateFormat          string
+	locale              string
+	dryRun              string
+	lockTable           string
+	lockTTL             string
+	dedupWindow         string
+	repoCacheTTL        string
+	repoCacheTable      string
+	checkpointURI       string
+	checkpointMargin    string
+	rerunInterval       string
+	rerunJitter         string
+	rerunMaxIterations  string
+	rerunInProgress     string
+	deadlineMargin      string
+	failureMode         string
+	failureThreshold    string
+	gate                string
+	gateStatus          string
+	eventBus            string
+	mode                string
+	historyURI          string
+	digestDays          string
+	graceDays           string
+	escalationDays      string
+	resolved            string
+	digestSLA           string
+	snoozeTable         string
+	snoozeReminder      string
+	suppressionReminder string
+	redactRepositories  string
+	redactMode          string
+	redactExporters     string
+	notifyAttempts      string
+	notifyBackoff       string
+	notifyTimeout       string
+	packageInclude      string
+	packageExclude      string
+	findingsSource      string
+	findingsURI         string
+	responseURI         string
+	responseTTL         string
 
-	slack   slackConfig
-	sns     snsConfig
-	mailgun mailgunConfig
+	slack       slackConfig
+	sns         snsConfig
+	mailgun     mailgunConfig
+	pushgateway pushgatewayConfig
+	grafana     grafanaConfig
+	badge       badgeConfig
+	github      githubConfig
+	confluence  confluenceConfig
+	pdf         pdfConfig
+	dashboard   dashboardConfig
+	defectDojo  defectDojoConfig
+	splunk      splunkConfig
+	webex       webexConfig
 }
 
 type slackConfig struct {
-	token   string
-	channel string
+	apiURL         string
+	token          string
+	tokenSecretARN string
+	// Incoming webhook posting to the channel it was created for, used when no token is set
+	webhookURL       string
+	channel          string
+	fallbackQueueURL string
+	fallbackTopicARN string
+	// Escalation of repositories with severe findings, off when the mention is empty
+	escalationMention  string
+	escalationSeverity string
+	escalationMode     string
+	// Time limit of each post, no limit besides HTTP_TIMEOUT when zero
+	postTimeout string
+	// Check the token and the channel membership before the first report of the container
+	selfTest string
+	// Severity chart attached to the report header, off when the URI is empty
+	chartURI string
+	chartURL string
 }
 
 type snsConfig struct {
 	topicARN string
 }
 
+type pushgatewayConfig struct {
+	url               string
+	repositoryMetrics string
+}
+
+type grafanaConfig struct {
+	url    string
+	apiKey string
+}
+
+type badgeConfig struct {
+	uri string
+}
+
+type githubConfig struct {
+	apiURL       string
+	token        string
+	repositories string
+}
+
+type confluenceConfig struct {
+	url      string
+	user     string
+	token    string
+	space    string
+	parentID string
+	title    string
+}
+
+type pdfConfig struct {
+	uri string
+}
+
+type dashboardConfig struct {
+	uri string
+}
+
+type defectDojoConfig struct {
+	url         string
+	token       string
+	productType string
+	// Product and engagement of repositories missing from products
+	product    string
+	engagement string
+	// JSON object mapping repository name patterns to products and engagements
+	products string
+}
+
+type webexConfig struct {
+	apiURL string
+	token  string
+	roomID string
+}
+
+type splunkConfig struct {
+	url            string
+	token          string
+	tokenSecretARN string
+	index          string
+	sourceType     string
+}
+
 type mailgunConfig struct {
 	apiKey     string
 	from       string
 	recipients string
 }
 
+// parameters loaded from Parameter Store take precedence over environment variables
+var parameters map[string]string
+
+// decrypted holds the plaintext of KMS encrypted environment variables, decrypted once per cold start
+var decrypted map[string]string
+
+func lookup(key string) string {
+	if value, ok := parameters[key]; ok {
+		return value
+	}
+	if value, ok := decrypted[key]; ok {
+		return value
+	}
+	return os.Getenv(key)
+}
+
+// decryptVariables decrypts the listed environment variables holding KMS ciphertext blobs
+func decryptVariables(keys string, svc *api.KMSService) (map[string]string, error) {
+	values := map[string]string{}
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		ciphertext := os.Getenv(key)
+		if ciphertext == "" {
+			continue
+		}
+
+		plaintext, err := svc.Decrypt(ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("Error decrypting environment variable %s: %s", key, err)
+		}
+		values[key] = plaintext
+	}
+	return values, nil
+}
+
 func retrive(key string, defaultValue string) string {
-	value := os.Getenv(key)
+	value := lookup(key)
 	if value == "" {
 		return defaultValue
 	}
@@ -46,7 +267,7 @@ func retrive(key string, defaultValue string) string {
 }
 
 func required(key string) (string, error) {
-	value := os.Getenv(key)
+	value := lookup(key)
 	if value == "" {
 		return value, fmt.Errorf("Required environtment variable %s is not set", key)
 	}
@@ -67,26 +288,854 @@ func initConfig() (config, error) {
 	}
 
 	return config{
-		env:             env,
-		region:          region,
-		ecrID:           retrive("ECR_ID", ""),
-		exporters:       retrive("EXPORTERS", "log"),
-		imageTag:        retrive("IMAGE_TAG", "latest"),
-		logLevel:        retrive("LOG_LEVEL", "INFO"),
-		numWorkers:      retrive("NUM_WORKERS", "10"),
-		minimumSeverity: retrive("MINIMUM_SEVERITY", "CRITICAL"),
+		env:                 env,
+		region:              region,
+		ecrID:               retrive("ECR_ID", ""),
+		ecrIDs:              retrive("ECR_IDS", ""),
+		accountAliases:      retrive("ACCOUNT_ALIASES", ""),
+		exporters:           retrive("EXPORTERS", "log"),
+		imageTag:            retrive("IMAGE_TAG", "latest"),
+		logLevel:            retrive("LOG_LEVEL", "INFO"),
+		numWorkers:          retrive("NUM_WORKERS", "10"),
+		maxRepos:            retrive("MAX_REPOS", "0"),
+		pageSize:            retrive("PAGE_SIZE", "100"),
+		rateLimit:           retrive("ECR_RATE_LIMIT", "0"),
+		staleDays:           retrive("STALE_IMAGE_DAYS", "0"),
+		maxImageAge:         retrive("MAX_IMAGE_AGE", "0"),
+		untagged:            retrive("UNTAGGED_IMAGE_THRESHOLD", "0"),
+		lifecycleAudit:      retrive("LIFECYCLE_POLICY_AUDIT", "off"),
+		scanScope:           retrive("SCAN_SCOPE", api.ScanScopeTag),
+		newestImages:        retrive("SCAN_NEWEST_IMAGES", "0"),
+		baseImage:           retrive("BASE_IMAGE_ATTRIBUTION", "false"),
+		packageTypes:        retrive("SPLIT_PACKAGE_TYPES", "false"),
+		layers:              retrive("LAYER_ATTRIBUTION", "false"),
+		minimumSeverity:     retrive("MINIMUM_SEVERITY", "CRITICAL"),
+		tagFilter:           retrive("REPOSITORY_TAG_FILTER", ""),
+		groupTag:            retrive("REPOSITORY_GROUP_TAG", ""),
+		emptyRepos:          retrive("EMPTY_REPOSITORIES", "report"),
+		enforceScanPush:     retrive("ENFORCE_SCAN_ON_PUSH", "false"),
+		includePublic:       retrive("INCLUDE_PUBLIC_REPOSITORIES", "false"),
+		pullThrough:         retrive("PULL_THROUGH_CACHE_REPOSITORIES", "include"),
+		multiArch:           retrive("RESOLVE_MANIFEST_LISTS", "false"),
+		consoleDomain:       retrive("CONSOLE_DOMAIN", ""),
+		fips:                retrive("AWS_USE_FIPS_ENDPOINT", "false"),
+		dualStack:           retrive("AWS_USE_DUALSTACK_ENDPOINT", "false"),
+		endpoint:            retrive("AWS_ENDPOINT_URL", ""),
+		ecrEndpoint:         retrive("ECR_ENDPOINT", ""),
+		stsEndpoint:         retrive("STS_ENDPOINT", ""),
+		s3Endpoint:          retrive("S3_ENDPOINT", ""),
+		httpTimeout:         retrive("HTTP_TIMEOUT", "30s"),
+		ecrCallTimeout:      retrive("ECR_CALL_TIMEOUT", "0s"),
+		runTimeout:          retrive("RUN_TIMEOUT", "0s"),
+		httpMaxIdleConns:    retrive("HTTP_MAX_IDLE_CONNS_PER_HOST", "10"),
+		proxyURL:            retrive("PROXY_URL", ""),
+		ssmPath:             os.Getenv("CONFIG_SSM_PATH"),
+		ssmTTL:              retrive("CONFIG_SSM_TTL", "5m"),
+		kmsEncrypted:        retrive("KMS_ENCRYPTED_VARIABLES", ""),
+		configURI:           retrive("CONFIG_S3_URI", ""),
+		weights:             retrive("SEVERITY_WEIGHTS", ""),
+		countThresholds:     retrive("COUNT_THRESHOLDS", ""),
+		thresholdMode:       retrive("THRESHOLD_MODE", "score"),
+		showAll:             retrive("SHOW_ALL_SEVERITIES", "false"),
+		groupNamespaces:     retrive("GROUP_BY_NAMESPACE", "false"),
+		severityDisplay:     retrive("SEVERITY_DISPLAY", ""),
+		compliance:          retrive("COMPLIANCE_FRAMEWORKS", ""),
+		timezone:            retrive("REPORT_TIMEZONE", "UTC"),
+		dateFormat:          retrive("DATE_FORMAT", exp.DefaultDateFormat),
+		locale:              retrive("LOCALE", exp.DefaultLocale),
+		dryRun:              retrive("DRY_RUN", "false"),
+		lockTable:           retrive("IDEMPOTENCY_TABLE", ""),
+		lockTTL:             retrive("IDEMPOTENCY_TTL", "24h"),
+		dedupWindow:         retrive("DEDUP_WINDOW", "24h"),
+		repoCacheTTL:        retrive("REPOSITORY_CACHE_TTL", "0s"),
+		repoCacheTable:      retrive("REPOSITORY_CACHE_TABLE", ""),
+		checkpointURI:       retrive("CHECKPOINT_S3_URI", ""),
+		checkpointMargin:    retrive("CHECKPOINT_MARGIN", "30s"),
+		rerunInterval:       retrive("RERUN_INTERVAL", "0s"),
+		rerunJitter:         retrive("RERUN_JITTER", "0s"),
+		rerunMaxIterations:  retrive("RERUN_MAX_ITERATIONS", "1"),
+		rerunInProgress:     retrive("RERUN_IN_PROGRESS", "false"),
+		deadlineMargin:      retrive("DEADLINE_MARGIN", "30s"),
+		failureMode:         retrive("FAILURE_MODE", "continue"),
+		failureThreshold:    retrive("FAILURE_THRESHOLD", "10"),
+		gate:                retrive("GATE", "false"),
+		gateStatus:          retrive("GATE_STATUS", "409"),
+		eventBus:            retrive("EVENT_BUS_NAME", ""),
+		mode:                retrive("MODE", modeDaily),
+		historyURI:          retrive("HISTORY_S3_URI", ""),
+		digestDays:          retrive("DIGEST_DAYS", "7"),
+		graceDays:           retrive("FINDING_GRACE_DAYS", "0"),
+		escalationDays:      retrive("FINDING_ESCALATION_DAYS", "0"),
+		resolved:            retrive("REPORT_RESOLVED", "false"),
+		digestSLA:           retrive("DIGEST_SLA", ""),
+		snoozeTable:         retrive("SNOOZE_TABLE", ""),
+		snoozeReminder:      retrive("SNOOZE_REMINDER", "72h"),
+		suppressionReminder: retrive("SUPPRESSION_REMINDER", "168h"),
+		redactRepositories:  retrive("REDACT_REPOSITORIES", ""),
+		redactMode:          retrive("REDACT_MODE", exp.RedactMask),
+		redactExporters:     retrive("REDACT_EXPORTERS", "slack,webex"),
+		notifyAttempts:      retrive("NOTIFY_ATTEMPTS", "3"),
+		notifyBackoff:       retrive("NOTIFY_BACKOFF", "2s"),
+		notifyTimeout:       retrive("NOTIFY_TIMEOUT", "0s"),
+		packageInclude:      retrive("PACKAGE_INCLUDE", ""),
+		packageExclude:      retrive("PACKAGE_EXCLUDE", ""),
+		findingsSource:      retrive("FINDINGS_SOURCE", api.FindingsSourceECR),
+		findingsURI:         retrive("FINDINGS_S3_URI", ""),
+		responseURI:         retrive("RESPONSE_S3_URI", ""),
+		responseTTL:         retrive("RESPONSE_URL_TTL", "1h"),
 		mailgun: mailgunConfig{
 			apiKey:     retrive("MAILGUN_API_KEY", ""),
 			from:       retrive("MAILGUN_FROM", ""),
 			recipients: retrive("MAILGUN_RECIPIENTS", ""),
 		},
 		slack: slackConfig{
-			token:   retrive("SLACK_TOKEN", ""),
-			channel: retrive("SLACK_CHANNEL", ""),
+			apiURL:           retrive("SLACK_API_URL", ""),
+			token:            retrive("SLACK_TOKEN", ""),
+			tokenSecretARN:   retrive("SLACK_TOKEN_SECRET_ARN", ""),
+			webhookURL:       retrive("SLACK_WEBHOOK_URL", ""),
+			channel:          retrive("SLACK_CHANNEL", ""),
+			fallbackQueueURL: retrive("SLACK_FALLBACK_QUEUE_URL", ""),
+			fallbackTopicARN: retrive("SLACK_FALLBACK_TOPIC_ARN", ""),
+
+			escalationMention:  retrive("SLACK_ESCALATION_MENTION", ""),
+			escalationSeverity: retrive("SLACK_ESCALATION_SEVERITY", "CRITICAL"),
+			escalationMode:     retrive("SLACK_ESCALATION_MODE", escalationInline),
+			postTimeout:        retrive("SLACK_POST_TIMEOUT", "0s"),
+			selfTest:           retrive("SLACK_SELF_TEST", "false"),
+			chartURI:           retrive("SLACK_CHART_S3_URI", ""),
+			chartURL:           retrive("SLACK_CHART_URL", ""),
 		},
 
 		sns: snsConfig{
 			topicARN: retrive("SNS_TOPIC_ARN", ""),
 		},
+
+		pushgateway: pushgatewayConfig{
+			url:               retrive("PUSHGATEWAY_URL", ""),
+			repositoryMetrics: retrive("PUSHGATEWAY_REPOSITORY_METRICS", "false"),
+		},
+
+		grafana: grafanaConfig{
+			url:    retrive("GRAFANA_URL", ""),
+			apiKey: retrive("GRAFANA_API_KEY", ""),
+		},
+
+		badge: badgeConfig{
+			uri: retrive("BADGE_S3_URI", ""),
+		},
+
+		github: githubConfig{
+			apiURL:       retrive("GITHUB_API_URL", "https://api.github.com"),
+			token:        retrive("GITHUB_TOKEN", ""),
+			repositories: retrive("GITHUB_REPOSITORIES", ""),
+		},
+
+		confluence: confluenceConfig{
+			url:      retrive("CONFLUENCE_URL", ""),
+			user:     retrive("CONFLUENCE_USER", ""),
+			token:    retrive("CONFLUENCE_API_TOKEN", ""),
+			space:    retrive("CONFLUENCE_SPACE", ""),
+			parentID: retrive("CONFLUENCE_PARENT_ID", ""),
+			title:    retrive("CONFLUENCE_TITLE", "ECR scan report"),
+		},
+
+		pdf: pdfConfig{
+			uri: retrive("PDF_S3_URI", ""),
+		},
+
+		dashboard: dashboardConfig{
+			uri: retrive("DASHBOARD_S3_URI", ""),
+		},
+
+		defectDojo: defectDojoConfig{
+			url:         retrive("DEFECTDOJO_URL", ""),
+			token:       retrive("DEFECTDOJO_API_TOKEN", ""),
+			productType: retrive("DEFECTDOJO_PRODUCT_TYPE", "ECR"),
+			product:     retrive("DEFECTDOJO_PRODUCT", ""),
+			engagement:  retrive("DEFECTDOJO_ENGAGEMENT", "ECR scan"),
+			products:    retrive("DEFECTDOJO_PRODUCTS", ""),
+		},
+
+		splunk: splunkConfig{
+			url:            retrive("SPLUNK_HEC_URL", ""),
+			token:          retrive("SPLUNK_HEC_TOKEN", ""),
+			tokenSecretARN: retrive("SPLUNK_HEC_TOKEN_SECRET_ARN", ""),
+			index:          retrive("SPLUNK_INDEX", ""),
+			sourceType:     retrive("SPLUNK_SOURCETYPE", "ecr:scan"),
+		},
+
+		webex: webexConfig{
+			apiURL: retrive("WEBEX_API_URL", "https://webexapis.com"),
+			token:  retrive("WEBEX_TOKEN", ""),
+			roomID: retrive("WEBEX_ROOM_ID", ""),
+		},
 	}, nil
 }
+
+// applyConfigFile overrides configuration with the values set in the config file
+func applyConfigFile(c *config, file *configfile.File) {
+	if file.Thresholds.MinimumSeverity != "" {
+		c.minimumSeverity = file.Thresholds.MinimumSeverity
+	}
+	if file.Thresholds.Mode != "" {
+		c.thresholdMode = file.Thresholds.Mode
+	}
+	if file.Format.Locale != "" {
+		c.locale = file.Format.Locale
+	}
+	if file.Format.DateFormat != "" {
+		c.dateFormat = file.Format.DateFormat
+	}
+	if file.Format.Timezone != "" {
+		c.timezone = file.Format.Timezone
+	}
+	if file.Format.ShowAllSeverities != nil {
+		c.showAll = strconv.FormatBool(*file.Format.ShowAllSeverities)
+	}
+	if file.Format.GroupByNamespace != nil {
+		c.groupNamespaces = strconv.FormatBool(*file.Format.GroupByNamespace)
+	}
+	applyNotifiers(c, file.Notifiers)
+}
+
+// webhook reports whether messages are posted through the incoming webhook, as no token is set
+func (s slackConfig) webhook() bool {
+	return s.webhookURL != "" && s.token == "" && s.tokenSecretARN == ""
+}
+
+// teamSettings returns the configuration of a team's exporters. Slack messages queued during an outage
+// are replayed with the token of the top level exporter, so teams posting to another workspace don't queue them.
+func teamSettings(c config, n configfile.Notifiers) config {
+	applyNotifiers(&c, n)
+	if n.Slack.TokenSecretARN != "" {
+		c.slack.fallbackQueueURL = ""
+		c.slack.fallbackTopicARN = ""
+	}
+	return c
+}
+
+// applyNotifiers overrides exporter configuration with the notifier settings set in the config file
+func applyNotifiers(c *config, n configfile.Notifiers) {
+	if len(n.Exporters) > 0 {
+		c.exporters = strings.Join(n.Exporters, ",")
+	}
+	if n.Slack.Channel != "" {
+		c.slack.channel = n.Slack.Channel
+	}
+	if n.Slack.TokenSecretARN != "" {
+		c.slack.tokenSecretARN = n.Slack.TokenSecretARN
+	}
+	if n.SNS.TopicARN != "" {
+		c.sns.topicARN = n.SNS.TopicARN
+	}
+	if n.Mailgun.From != "" {
+		c.mailgun.from = n.Mailgun.From
+	}
+	if len(n.Mailgun.Recipients) > 0 {
+		c.mailgun.recipients = strings.Join(n.Mailgun.Recipients, ",")
+	}
+}
+
+var (
+	regionPattern       = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+	slackTokenPattern   = regexp.MustCompile(`^xox[a-z]-[A-Za-z0-9-]+$`)
+	slackChannelPattern = regexp.MustCompile(`^(#[^\s#]+|[CGD][A-Z0-9]+)$`)
+	slackMentionPattern = regexp.MustCompile(`^(@here|@channel|@everyone|[SUW][A-Z0-9]+)$`)
+)
+
+// configError lists every invalid or missing setting
+type configError []string
+
+func (e configError) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
+}
+
+// redacted reports whether the exporter is listed in REDACT_EXPORTERS
+func (c config) redacted(name string) bool {
+	for _, e := range strings.Split(c.redactExporters, ",") {
+		if strings.TrimSpace(e) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exporterEnabled reports whether the exporter is listed in EXPORTERS
+func (c config) exporterEnabled(name string) bool {
+	for _, e := range strings.Split(c.exporters, ",") {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findingsSources returns the names of the sources findings are read from, in order
+func (c config) findingsSources() []string {
+	var sources []string
+	for _, source := range strings.Split(c.findingsSource, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// parseDigestSLA parses the days findings may stay open per severity, given as SEVERITY=days pairs
+func parseDigestSLA(raw string) (map[string]int, error) {
+	days, err := severity.ParseCountThresholds(raw)
+	if err != nil {
+		return nil, err
+	}
+	sla := make(map[string]int)
+	for k, v := range days {
+		sla[k] = int(v)
+	}
+	return sla, nil
+}
+
+// validate checks the settings up front, so a misconfigured function fails listing every problem
+// instead of failing mid-run on the first one
+func (c config) validate() error {
+	var problems configError
+	invalid := func(key string, value string, expected string) {
+		problems = append(problems, fmt.Sprintf("%s %q is invalid, expected %s", key, value, expected))
+	}
+	missing := func(key string, reason string) {
+		problems = append(problems, fmt.Sprintf("%s is not set, required %s", key, reason))
+	}
+	oneOf := func(key string, value string, valid ...string) {
+		for _, v := range valid {
+			if value == v {
+				return
+			}
+		}
+		invalid(key, value, "one of "+strings.Join(valid, ", "))
+	}
+
+	if !regionPattern.MatchString(c.region) {
+		invalid("REGION", c.region, "an AWS region, e.g.: us-east-1")
+	}
+	oneOf("MINIMUM_SEVERITY", c.minimumSeverity, severity.SeverityList...)
+	oneOf("EMPTY_REPOSITORIES", c.emptyRepos, "report", "skip")
+	oneOf("PULL_THROUGH_CACHE_REPOSITORIES", c.pullThrough, "include", "separate", "skip")
+	oneOf("THRESHOLD_MODE", c.thresholdMode, severity.ThresholdModes...)
+	oneOf("FAILURE_MODE", c.failureMode, failureModeFailFast, failureModeContinue, failureModeThreshold)
+	oneOf("GATE_STATUS", c.gateStatus, "409", "422")
+	oneOf("LIFECYCLE_POLICY_AUDIT", c.lifecycleAudit, "off", api.LifecyclePolicyAuditReport, api.LifecyclePolicyAuditSuggest)
+	oneOf("SCAN_SCOPE", c.scanScope, api.ScanScopeTag, api.ScanScopeAllTagged)
+	oneOf("LOCALE", c.locale, exp.Locales()...)
+	sources := c.findingsSources()
+	if len(sources) == 0 {
+		invalid("FINDINGS_SOURCE", c.findingsSource, "comma separated sources")
+	}
+	for i, source := range sources {
+		oneOf("FINDINGS_SOURCE", source, api.FindingsSourceECR, api.FindingsSourceInspector2, api.FindingsSourceTrivyS3)
+		for _, earlier := range sources[:i] {
+			if source == earlier {
+				invalid("FINDINGS_SOURCE", c.findingsSource, "each source once")
+			}
+		}
+		if source == api.FindingsSourceTrivyS3 && c.findingsURI == "" {
+			missing("FINDINGS_S3_URI", "by FINDINGS_SOURCE "+api.FindingsSourceTrivyS3)
+		}
+	}
+	if c.redactRepositories != "" {
+		oneOf("REDACT_MODE", c.redactMode, exp.RedactMask, exp.RedactHash)
+	}
+	oneOf("MODE", c.mode, modeDaily, modeDigest, modeInventory)
+	if c.mode == modeDigest && c.historyURI == "" {
+		missing("HISTORY_S3_URI", "by MODE digest")
+	}
+	for _, d := range []struct{ key, value string }{
+		{"FINDING_GRACE_DAYS", c.graceDays},
+		{"FINDING_ESCALATION_DAYS", c.escalationDays},
+	} {
+		if n, err := strconv.Atoi(d.value); err != nil || n < 0 {
+			invalid(d.key, d.value, "zero or a positive number")
+		} else if n > 0 && c.historyURI == "" {
+			missing("HISTORY_S3_URI", "by "+d.key)
+		}
+	}
+
+	for _, b := range []struct{ key, value string }{
+		{"ENFORCE_SCAN_ON_PUSH", c.enforceScanPush},
+		{"INCLUDE_PUBLIC_REPOSITORIES", c.includePublic},
+		{"RESOLVE_MANIFEST_LISTS", c.multiArch},
+		{"BASE_IMAGE_ATTRIBUTION", c.baseImage},
+		{"SPLIT_PACKAGE_TYPES", c.packageTypes},
+		{"LAYER_ATTRIBUTION", c.layers},
+		{"AWS_USE_FIPS_ENDPOINT", c.fips},
+		{"AWS_USE_DUALSTACK_ENDPOINT", c.dualStack},
+		{"SHOW_ALL_SEVERITIES", c.showAll},
+		{"GROUP_BY_NAMESPACE", c.groupNamespaces},
+		{"DRY_RUN", c.dryRun},
+		{"GATE", c.gate},
+		{"RERUN_IN_PROGRESS", c.rerunInProgress},
+		{"REPORT_RESOLVED", c.resolved},
+	} {
+		if _, err := strconv.ParseBool(b.value); err != nil {
+			invalid(b.key, b.value, "true or false")
+		}
+	}
+	if resolved, _ := strconv.ParseBool(c.resolved); resolved && c.historyURI == "" {
+		missing("HISTORY_S3_URI", "by REPORT_RESOLVED")
+	}
+
+	for _, d := range []struct{ key, value string }{
+		{"CONFIG_SSM_TTL", c.ssmTTL},
+		{"IDEMPOTENCY_TTL", c.lockTTL},
+		{"DEDUP_WINDOW", c.dedupWindow},
+		{"REPOSITORY_CACHE_TTL", c.repoCacheTTL},
+		{"CHECKPOINT_MARGIN", c.checkpointMargin},
+		{"RERUN_INTERVAL", c.rerunInterval},
+		{"RERUN_JITTER", c.rerunJitter},
+		{"DEADLINE_MARGIN", c.deadlineMargin},
+		{"SNOOZE_REMINDER", c.snoozeReminder},
+		{"SUPPRESSION_REMINDER", c.suppressionReminder},
+		{"ECR_CALL_TIMEOUT", c.ecrCallTimeout},
+		{"RUN_TIMEOUT", c.runTimeout},
+		{"NOTIFY_BACKOFF", c.notifyBackoff},
+		{"NOTIFY_TIMEOUT", c.notifyTimeout},
+	} {
+		if _, err := time.ParseDuration(d.value); err != nil {
+			invalid(d.key, d.value, "a duration, e.g.: 30s")
+		}
+	}
+	// Presigned URLs are valid for a week at most
+	if ttl, err := time.ParseDuration(c.responseTTL); err != nil || ttl <= 0 || ttl > 7*24*time.Hour {
+		invalid("RESPONSE_URL_TTL", c.responseTTL, "a duration between 1s and 168h")
+	}
+
+	if n, err := strconv.Atoi(c.numWorkers); err != nil || n < 1 {
+		invalid("NUM_WORKERS", c.numWorkers, "a positive number")
+	}
+	if n, err := strconv.Atoi(c.notifyAttempts); err != nil || n < 1 {
+		invalid("NOTIFY_ATTEMPTS", c.notifyAttempts, "a positive number")
+	}
+	if n, err := strconv.Atoi(c.rerunMaxIterations); err != nil || n < 1 {
+		invalid("RERUN_MAX_ITERATIONS", c.rerunMaxIterations, "a positive number")
+	}
+	if n, err := strconv.Atoi(c.maxRepos); err != nil || n < 0 {
+		invalid("MAX_REPOS", c.maxRepos, "zero or a positive number")
+	}
+	// The limits of DescribeRepositories
+	if n, err := strconv.Atoi(c.pageSize); err != nil || n < 1 || n > 1000 {
+		invalid("PAGE_SIZE", c.pageSize, "a number between 1 and 1000")
+	}
+	if c.ecrIDs != "" {
+		if c.ecrID != "" {
+			invalid("ECR_IDS", c.ecrIDs, "not to be set together with ECR_ID")
+		} else if _, err := api.ParseRegistries(c.ecrIDs); err != nil {
+			invalid("ECR_IDS", c.ecrIDs, "comma separated registry IDs, each optionally followed by =<role ARN>")
+		}
+	}
+	if _, err := api.ParseAccountAliases(c.accountAliases); err != nil {
+		invalid("ACCOUNT_ALIASES", c.accountAliases, "comma separated <registry ID>=<alias> pairs")
+	}
+	if _, err := api.ParseRateLimit(c.rateLimit); err != nil {
+		invalid("ECR_RATE_LIMIT", c.rateLimit, "zero or a positive number of requests per second")
+	}
+	if n, err := strconv.Atoi(c.staleDays); err != nil || n < 0 {
+		invalid("STALE_IMAGE_DAYS", c.staleDays, "zero or a positive number")
+	}
+	if n, err := strconv.Atoi(c.maxImageAge); err != nil || n < 0 {
+		invalid("MAX_IMAGE_AGE", c.maxImageAge, "zero or a positive number of days")
+	}
+	if n, err := strconv.Atoi(c.untagged); err != nil || n < 0 {
+		invalid("UNTAGGED_IMAGE_THRESHOLD", c.untagged, "zero or a positive number")
+	}
+	if n, err := strconv.Atoi(c.newestImages); err != nil || n < 0 {
+		invalid("SCAN_NEWEST_IMAGES", c.newestImages, "zero or a positive number")
+	}
+	if _, err := strconv.ParseFloat(c.failureThreshold, 64); err != nil {
+		invalid("FAILURE_THRESHOLD", c.failureThreshold, "a percentage")
+	}
+	if n, err := strconv.Atoi(c.digestDays); err != nil || n < 1 {
+		invalid("DIGEST_DAYS", c.digestDays, "a positive number")
+	}
+	if _, err := parseDigestSLA(c.digestSLA); err != nil {
+		invalid("DIGEST_SLA", c.digestSLA, "SEVERITY=days pairs, e.g.: CRITICAL=7,HIGH=30")
+	}
+	if _, err := time.LoadLocation(c.timezone); err != nil {
+		invalid("REPORT_TIMEZONE", c.timezone, "an IANA time zone, e.g.: Europe/Budapest")
+	}
+	if _, err := exp.ParseComplianceFrameworks(c.compliance); err != nil {
+		invalid("COMPLIANCE_FRAMEWORKS", c.compliance, "a comma separated list of "+strings.Join(exp.ComplianceFrameworks, ", "))
+	}
+	if _, err := exp.ParseSeverityDisplay(c.severityDisplay); err != nil {
+		invalid("SEVERITY_DISPLAY", c.severityDisplay, `a JSON object of severity levels, e.g.: {"CRITICAL": {"emoji": ":fire:", "color": "#e05d44", "label": "P1"}}`)
+	}
+
+	for _, e := range strings.Split(c.exporters, ",") {
+		switch e {
+		case "log":
+		case "slack":
+			if c.slack.webhook() {
+				if !strings.HasPrefix(c.slack.webhookURL, "https://") {
+					// The webhook URL is a secret, it stays out of the error too
+					problems = append(problems, "SLACK_WEBHOOK_URL is invalid, expected an https:// incoming webhook URL")
+				}
+			} else if c.slack.tokenSecretARN == "" {
+				if c.slack.token == "" {
+					missing("SLACK_TOKEN", "by the slack exporter, unless SLACK_TOKEN_SECRET_ARN or SLACK_WEBHOOK_URL is set")
+				} else if !slackTokenPattern.MatchString(c.slack.token) {
+					// The token itself stays out of the error
+					problems = append(problems, "SLACK_TOKEN is invalid, expected a Slack token starting with xoxb- or xoxp-")
+				}
+			}
+			if c.slack.channel == "" {
+				if !c.slack.webhook() {
+					missing("SLACK_CHANNEL", "by the slack exporter")
+				}
+			} else if !slackChannelPattern.MatchString(c.slack.channel) {
+				invalid("SLACK_CHANNEL", c.slack.channel, "a channel name with # prefix or a channel ID")
+			}
+			if c.slack.escalationMention != "" {
+				if !slackMentionPattern.MatchString(c.slack.escalationMention) {
+					invalid("SLACK_ESCALATION_MENTION", c.slack.escalationMention, "@here, @channel, a user group ID or a user ID")
+				}
+				oneOf("SLACK_ESCALATION_SEVERITY", c.slack.escalationSeverity, severity.SeverityList...)
+				oneOf("SLACK_ESCALATION_MODE", c.slack.escalationMode, escalationInline, escalationMessage, escalationBoth)
+			}
+			if _, err := time.ParseDuration(c.slack.postTimeout); err != nil {
+				invalid("SLACK_POST_TIMEOUT", c.slack.postTimeout, "a duration, e.g.: 30s")
+			}
+			if _, err := strconv.ParseBool(c.slack.selfTest); err != nil {
+				invalid("SLACK_SELF_TEST", c.slack.selfTest, "true or false")
+			}
+			if c.slack.chartURI != "" {
+				if _, _, err := api.ParseS3URI(c.slack.chartURI); err != nil {
+					invalid("SLACK_CHART_S3_URI", c.slack.chartURI, "an s3://bucket/prefix URI")
+				}
+				if c.slack.chartURL == "" {
+					missing("SLACK_CHART_URL", "when SLACK_CHART_S3_URI is set")
+				} else if !strings.HasPrefix(c.slack.chartURL, "https://") {
+					invalid("SLACK_CHART_URL", c.slack.chartURL, "an https:// URL the charts are served from")
+				}
+			}
+		case "sns":
+			if c.sns.topicARN == "" {
+				missing("SNS_TOPIC_ARN", "by the sns exporter")
+			}
+		case "mailgun":
+			if c.mailgun.apiKey == "" {
+				missing("MAILGUN_API_KEY", "by the mailgun exporter")
+			}
+			if c.mailgun.from == "" {
+				missing("MAILGUN_FROM", "by the mailgun exporter")
+			}
+			if c.mailgun.recipients == "" {
+				missing("MAILGUN_RECIPIENTS", "by the mailgun exporter")
+			}
+		case "prometheus":
+			if c.pushgateway.url == "" {
+				missing("PUSHGATEWAY_URL", "by the prometheus exporter")
+			}
+			if _, err := strconv.ParseBool(c.pushgateway.repositoryMetrics); err != nil {
+				invalid("PUSHGATEWAY_REPOSITORY_METRICS", c.pushgateway.repositoryMetrics, "true or false")
+			}
+		case "grafana":
+			if c.grafana.url == "" {
+				missing("GRAFANA_URL", "by the grafana exporter")
+			}
+			if c.grafana.apiKey == "" {
+				missing("GRAFANA_API_KEY", "by the grafana exporter")
+			}
+		case "badge":
+			if c.badge.uri == "" {
+				missing("BADGE_S3_URI", "by the badge exporter")
+			}
+		case "github":
+			if c.github.token == "" {
+				missing("GITHUB_TOKEN", "by the github exporter")
+			}
+			if _, err := exp.ParseGitHubRepositories(c.github.repositories); err != nil {
+				invalid("GITHUB_REPOSITORIES", c.github.repositories, "a JSON object mapping ECR repositories to GitHub repositories")
+			}
+		case "confluence":
+			if c.confluence.url == "" {
+				missing("CONFLUENCE_URL", "by the confluence exporter")
+			}
+			if c.confluence.token == "" {
+				missing("CONFLUENCE_API_TOKEN", "by the confluence exporter")
+			}
+			if c.confluence.space == "" {
+				missing("CONFLUENCE_SPACE", "by the confluence exporter")
+			}
+		case "pdf":
+			if c.pdf.uri == "" {
+				missing("PDF_S3_URI", "by the pdf exporter")
+			}
+		case "dashboard":
+			if c.dashboard.uri == "" {
+				missing("DASHBOARD_S3_URI", "by the dashboard exporter")
+			}
+		case "defectdojo":
+			if c.defectDojo.url == "" {
+				missing("DEFECTDOJO_URL", "by the defectdojo exporter")
+			}
+			if c.defectDojo.token == "" {
+				missing("DEFECTDOJO_API_TOKEN", "by the defectdojo exporter")
+			}
+			if c.defectDojo.engagement == "" {
+				missing("DEFECTDOJO_ENGAGEMENT", "by the defectdojo exporter")
+			}
+			if _, err := exp.ParseDefectDojoTargets(c.defectDojo.products); err != nil {
+				invalid("DEFECTDOJO_PRODUCTS", c.defectDojo.products, "a JSON object mapping repository patterns to DefectDojo products")
+			} else if c.defectDojo.product == "" && c.defectDojo.products == "" {
+				missing("DEFECTDOJO_PRODUCT", "by the defectdojo exporter without DEFECTDOJO_PRODUCTS")
+			}
+		case "splunk":
+			if c.splunk.url == "" {
+				missing("SPLUNK_HEC_URL", "by the splunk exporter")
+			}
+			if c.splunk.token == "" && c.splunk.tokenSecretARN == "" {
+				missing("SPLUNK_HEC_TOKEN", "by the splunk exporter, unless SPLUNK_HEC_TOKEN_SECRET_ARN is set")
+			}
+		case "webex":
+			if c.webex.token == "" {
+				missing("WEBEX_TOKEN", "by the webex exporter")
+			}
+			if c.webex.roomID == "" {
+				missing("WEBEX_ROOM_ID", "by the webex exporter")
+			}
+		default:
+			invalid("EXPORTERS", e, "log, slack, sns, mailgun, prometheus, grafana, badge, github, confluence, pdf, dashboard, defectdojo, splunk or webex")
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// connectionConfig holds the settings used to reach AWS services, read from the environment only
+type connectionConfig struct {
+	fips      bool
+	dualStack bool
+	http      api.HTTPConfig
+	ssmTTL    time.Duration
+}
+
+// The configuration is read on cold start, warm invocations read it again only when parameters
+// loaded from Parameter Store change or variables are decrypted
+var (
+	loadedConfig config
+	connection   connectionConfig
+	loadErr      error
+)
+
+func init() {
+	loadedConfig, loadErr = initConfig()
+	if loadErr == nil {
+		connection, loadErr = parseConnection(loadedConfig)
+	}
+}
+
+// parseConnection parses the settings used to reach AWS services
+func parseConnection(c config) (connectionConfig, error) {
+	var conn connectionConfig
+	var err error
+	if conn.fips, err = strconv.ParseBool(c.fips); err != nil {
+		return conn, err
+	}
+	if conn.dualStack, err = strconv.ParseBool(c.dualStack); err != nil {
+		return conn, err
+	}
+	if conn.http, err = api.ParseHTTPConfig(c.httpTimeout, c.httpMaxIdleConns, c.proxyURL); err != nil {
+		return conn, err
+	}
+	if c.ssmPath != "" {
+		if conn.ssmTTL, err = time.ParseDuration(c.ssmTTL); err != nil {
+			return conn, err
+		}
+	}
+	return conn, nil
+}
+
+// copyMap returns a copy of m, which can be added to without changing m
+func copyMap(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
+
+// parsedConfig holds the values of a configuration parsed
+type parsedConfig struct {
+	runTimeout          time.Duration
+	workers             int
+	maxRepos            int
+	pageSize            int64
+	staleAfter          time.Duration
+	maxImageAge         time.Duration
+	untagged            int
+	newestImages        int
+	enforceScanPush     bool
+	includePublic       bool
+	dryRun              bool
+	tagFilter           map[string]string
+	multiArch           bool
+	baseImage           bool
+	packageTypes        bool
+	layers              bool
+	resolved            bool
+	showAll             bool
+	countThresholds     severity.CountThresholds
+	weights             map[string]int
+	failureThreshold    float64
+	gate                bool
+	gateStatus          int
+	presentation        exp.Presentation
+	lockTTL             time.Duration
+	dedupWindow         time.Duration
+	repoCacheTTL        time.Duration
+	packageFilters      []api.PackageFilter
+	snoozeReminder      time.Duration
+	suppressionReminder time.Duration
+	delivery            notify.Policy
+	deadlineMargin      time.Duration
+	rateLimit           float64
+	ecrCallTimeout      time.Duration
+	rerunInterval       time.Duration
+	rerunJitter         time.Duration
+	rerunMaxIterations  int
+	rerunInProgress     bool
+	checkpointMargin    time.Duration
+	registries          []api.Registry
+	accountAliases      map[string]string
+	digestDays          int
+	graceDays           int
+	escalationDays      int
+	digestSLA           map[string]int
+	responseTTL         time.Duration
+}
+
+// parsedConfigs outlive a single invocation, so warm invocations of the same configuration skip parsing it
+var parsedConfigs = map[config]*parsedConfig{}
+
+// cachedParsedConfig returns the configuration parsed by a previous invocation, or parses it.
+// Maps of the result are shared by the invocations, they are copied before being added to.
+func cachedParsedConfig(c config) (*parsedConfig, error) {
+	if parsed, ok := parsedConfigs[c]; ok {
+		return parsed, nil
+	}
+	parsed, err := parseConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	parsedConfigs[c] = parsed
+	return parsed, nil
+}
+
+// parseConfig parses the numbers, booleans, durations and lists of a validated configuration
+func parseConfig(c config) (*parsedConfig, error) {
+	var p parsedConfig
+	var err error
+
+	parseBool := func(raw string, value *bool) {
+		if err == nil {
+			*value, err = strconv.ParseBool(raw)
+		}
+	}
+	parseInt := func(raw string, value *int) {
+		if err == nil {
+			*value, err = strconv.Atoi(raw)
+		}
+	}
+	parseDuration := func(raw string, value *time.Duration) {
+		if err == nil {
+			*value, err = time.ParseDuration(raw)
+		}
+	}
+	parseDays := func(raw string, value *time.Duration) {
+		var days int
+		parseInt(raw, &days)
+		*value = time.Duration(days) * 24 * time.Hour
+	}
+
+	parseDuration(c.runTimeout, &p.runTimeout)
+	parseInt(c.numWorkers, &p.workers)
+	parseInt(c.maxRepos, &p.maxRepos)
+	if err == nil {
+		p.pageSize, err = strconv.ParseInt(c.pageSize, 10, 64)
+	}
+	parseDays(c.staleDays, &p.staleAfter)
+	parseDays(c.maxImageAge, &p.maxImageAge)
+	parseInt(c.untagged, &p.untagged)
+	parseInt(c.newestImages, &p.newestImages)
+	parseBool(c.enforceScanPush, &p.enforceScanPush)
+	parseBool(c.includePublic, &p.includePublic)
+	parseBool(c.dryRun, &p.dryRun)
+	if err == nil {
+		p.tagFilter, err = api.ParseTagFilter(c.tagFilter)
+	}
+	parseBool(c.multiArch, &p.multiArch)
+	parseBool(c.baseImage, &p.baseImage)
+	parseBool(c.packageTypes, &p.packageTypes)
+	parseBool(c.layers, &p.layers)
+	parseBool(c.resolved, &p.resolved)
+	parseBool(c.showAll, &p.showAll)
+	if err == nil {
+		p.countThresholds, err = severity.ParseCountThresholds(c.countThresholds)
+	}
+	if err == nil {
+		p.weights, err = severity.ParseWeights(c.weights)
+	}
+	if err == nil {
+		p.failureThreshold, err = strconv.ParseFloat(c.failureThreshold, 64)
+	}
+	parseBool(c.gate, &p.gate)
+	parseInt(c.gateStatus, &p.gateStatus)
+	p.presentation.Locale = c.locale
+	p.presentation.DateFormat = c.dateFormat
+	if err == nil {
+		p.presentation.Location, err = time.LoadLocation(c.timezone)
+	}
+	parseBool(c.groupNamespaces, &p.presentation.GroupByNamespace)
+	if err == nil {
+		p.presentation.SeverityDisplay, err = exp.ParseSeverityDisplay(c.severityDisplay)
+	}
+	if err == nil {
+		p.presentation.ComplianceFrameworks, err = exp.ParseComplianceFrameworks(c.compliance)
+	}
+	parseDuration(c.lockTTL, &p.lockTTL)
+	parseDuration(c.dedupWindow, &p.dedupWindow)
+	parseDuration(c.repoCacheTTL, &p.repoCacheTTL)
+	p.packageFilters = api.ParsePackageFilter(c.packageInclude, c.packageExclude)
+	parseDuration(c.snoozeReminder, &p.snoozeReminder)
+	parseDuration(c.suppressionReminder, &p.suppressionReminder)
+	parseInt(c.notifyAttempts, &p.delivery.Attempts)
+	parseDuration(c.notifyBackoff, &p.delivery.Backoff)
+	parseDuration(c.notifyTimeout, &p.delivery.Timeout)
+	parseDuration(c.deadlineMargin, &p.deadlineMargin)
+	if err == nil {
+		p.rateLimit, err = api.ParseRateLimit(c.rateLimit)
+	}
+	parseDuration(c.ecrCallTimeout, &p.ecrCallTimeout)
+	parseDuration(c.rerunInterval, &p.rerunInterval)
+	parseDuration(c.rerunJitter, &p.rerunJitter)
+	p.rerunMaxIterations, _ = strconv.Atoi(c.rerunMaxIterations)
+	p.rerunInProgress, _ = strconv.ParseBool(c.rerunInProgress)
+	parseDuration(c.checkpointMargin, &p.checkpointMargin)
+	if err == nil && c.ecrIDs != "" {
+		p.registries, err = api.ParseRegistries(c.ecrIDs)
+	}
+	if err == nil && c.ecrIDs != "" {
+		p.accountAliases, err = api.ParseAccountAliases(c.accountAliases)
+	}
+	parseInt(c.digestDays, &p.digestDays)
+	parseInt(c.graceDays, &p.graceDays)
+	parseInt(c.escalationDays, &p.escalationDays)
+	if err == nil {
+		p.digestSLA, err = parseDigestSLA(c.digestSLA)
+	}
+	parseDuration(c.responseTTL, &p.responseTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/configfile"
+)
+
+func validConfig() config {
+	return config{
+		region:              "us-east-1",
+		minimumSeverity:     "HIGH",
+		exporters:           "log,slack",
+		numWorkers:          "2",
+		maxRepos:            "0",
+		pageSize:            "100",
+		rateLimit:           "0",
+		ecrCallTimeout:      "0s",
+		runTimeout:          "0s",
+		staleDays:           "0",
+		maxImageAge:         "0",
+		untagged:            "0",
+		lifecycleAudit:      "off",
+		scanScope:           "tag",
+		newestImages:        "0",
+		baseImage:           "false",
+		packageTypes:        "false",
+		resolved:            "false",
+		layers:              "false",
+		emptyRepos:          "report",
+		enforceScanPush:     "false",
+		includePublic:       "false",
+		pullThrough:         "include",
+		multiArch:           "false",
+		fips:                "false",
+		dualStack:           "false",
+		ssmTTL:              "5m",
+		thresholdMode:       "score",
+		showAll:             "false",
+		groupNamespaces:     "false",
+		timezone:            "UTC",
+		locale:              "en",
+		dryRun:              "false",
+		lockTTL:             "24h",
+		repoCacheTTL:        "0s",
+		dedupWindow:         "24h",
+		checkpointMargin:    "30s",
+		rerunInterval:       "0s",
+		rerunJitter:         "0s",
+		rerunMaxIterations:  "1",
+		rerunInProgress:     "false",
+		deadlineMargin:      "30s",
+		failureMode:         "continue",
+		failureThreshold:    "10",
+		gate:                "false",
+		gateStatus:          "409",
+		mode:                "daily",
+		digestDays:          "7",
+		graceDays:           "0",
+		escalationDays:      "0",
+		snoozeReminder:      "72h",
+		suppressionReminder: "168h",
+		notifyAttempts:      "3",
+		notifyBackoff:       "2s",
+		notifyTimeout:       "0s",
+		findingsSource:      "ecr",
+		responseTTL:         "1h",
+		slack:               slackConfig{token: "xoxb-1234-abcd", channel: "#ecr-scan", postTimeout: "0s", selfTest: "false"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c := validConfig()
+	c.region = "us-east"
+	c.minimumSeverity = "SEVERE"
+	c.numWorkers = "0"
+	c.pageSize = "1001"
+	c.rateLimit = "-5"
+	c.runTimeout = "10"
+	c.dryRun = "maybe"
+	c.exporters = "log,slack,sns,pagerduty"
+	c.slack = slackConfig{token: "secret-token", postTimeout: "0s", selfTest: "false"}
+
+	err := c.validate()
+	if err == nil {
+		t.Fatalf("Expected invalid configuration error")
+	}
+	problems := err.(configError)
+	expected := []string{
+		`REGION "us-east" is invalid`,
+		`MINIMUM_SEVERITY "SEVERE" is invalid`,
+		`DRY_RUN "maybe" is invalid`,
+		`RUN_TIMEOUT "10" is invalid`,
+		`NUM_WORKERS "0" is invalid`,
+		`PAGE_SIZE "1001" is invalid`,
+		`ECR_RATE_LIMIT "-5" is invalid`,
+		"SLACK_TOKEN is invalid",
+		"SLACK_CHANNEL is not set",
+		"SNS_TOPIC_ARN is not set",
+		`EXPORTERS "pagerduty" is invalid`,
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got: %s", len(expected), err)
+	}
+	for i, p := range expected {
+		if !strings.HasPrefix(problems[i], p) {
+			t.Fatalf("[%d] Expected problem %s, got: %s", i, p, problems[i])
+		}
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("The Slack token must not appear in the error: %s", err)
+	}
+}
+
+func TestValidateNotify(t *testing.T) {
+	c := validConfig()
+	c.notifyAttempts = "0"
+	c.notifyBackoff = "2"
+	c.notifyTimeout = "-"
+	err := c.validate()
+	if err == nil {
+		t.Fatalf("Expected invalid configuration error")
+	}
+	expected := []string{
+		`NOTIFY_BACKOFF "2" is invalid`,
+		`NOTIFY_TIMEOUT "-" is invalid`,
+		`NOTIFY_ATTEMPTS "0" is invalid`,
+	}
+	problems := err.(configError)
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got: %s", len(expected), err)
+	}
+	for i, p := range expected {
+		if !strings.HasPrefix(problems[i], p) {
+			t.Fatalf("[%d] Expected problem %s, got: %s", i, p, problems[i])
+		}
+	}
+}
+
+func TestValidateSlackTokenSecret(t *testing.T) {
+	c := validConfig()
+	c.slack = slackConfig{tokenSecretARN: "arn:aws:secretsmanager:us-east-1:123456789012:secret:slack", channel: "C0123ABCD", postTimeout: "0s", selfTest: "false"}
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestValidateSlackEscalation(t *testing.T) {
+	c := validConfig()
+	c.slack.escalationMention = "S0123ABCD"
+	c.slack.escalationSeverity = "CRITICAL"
+	c.slack.escalationMode = escalationBoth
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.slack.escalationMention = "@payments-oncall"
+	c.slack.escalationMode = "page"
+	err := c.validate()
+	if err == nil {
+		t.Fatalf("Expected invalid configuration error")
+	}
+	problems := err.(configError)
+	if len(problems) != 2 || !strings.HasPrefix(problems[0], `SLACK_ESCALATION_MENTION "@payments-oncall" is invalid`) || !strings.HasPrefix(problems[1], `SLACK_ESCALATION_MODE "page" is invalid`) {
+		t.Fatalf("Unexpected problems: %s", err)
+	}
+}
+
+func TestValidateFindingAge(t *testing.T) {
+	c := validConfig()
+	c.graceDays = "3"
+	c.escalationDays = "-1"
+	err := c.validate()
+	if err == nil {
+		t.Fatalf("Expected invalid configuration error")
+	}
+	problems := err.(configError)
+	if len(problems) != 2 || !strings.HasPrefix(problems[0], "HISTORY_S3_URI is not set") || !strings.HasPrefix(problems[1], `FINDING_ESCALATION_DAYS "-1" is invalid`) {
+		t.Fatalf("Unexpected problems: %s", err)
+	}
+
+	c.historyURI = "s3://bucket/history"
+	c.escalationDays = "14"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.historyURI = ""
+	c.graceDays, c.escalationDays = "0", "0"
+	c.resolved = "true"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], "HISTORY_S3_URI is not set") {
+		t.Fatalf("Expected REPORT_RESOLVED to need the history, got: %v", err)
+	}
+}
+
+func TestValidateScanScope(t *testing.T) {
+	c := validConfig()
+	c.scanScope = "all-tagged"
+	c.newestImages = "5"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.scanScope = "all"
+	c.newestImages = "-1"
+	err := c.validate()
+	if err == nil {
+		t.Fatalf("Expected invalid configuration error")
+	}
+	problems := err.(configError)
+	if len(problems) != 2 || !strings.HasPrefix(problems[0], `SCAN_SCOPE "all" is invalid`) || !strings.HasPrefix(problems[1], `SCAN_NEWEST_IMAGES "-1" is invalid`) {
+		t.Fatalf("Unexpected problems: %s", err)
+	}
+}
+
+func TestValidateLocale(t *testing.T) {
+	c := validConfig()
+	c.locale = "ja"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.locale = "fr"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], `LOCALE "fr" is invalid, expected one of de, en, ja`) {
+		t.Fatalf("Expected unsupported locale to be invalid, got: %v", err)
+	}
+}
+
+func TestValidateFindingsSource(t *testing.T) {
+	c := validConfig()
+	c.findingsSource = "inspector2"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.findingsSource = "trivy-s3"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], "FINDINGS_S3_URI is not set") {
+		t.Fatalf("Expected trivy-s3 to need the reports, got: %v", err)
+	}
+	c.findingsURI = "s3://ci-reports/trivy"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.findingsSource = "ecr, trivy-s3"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.findingsSource = "grype"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], `FINDINGS_SOURCE "grype" is invalid`) {
+		t.Fatalf("Unexpected problems: %v", err)
+	}
+	c.findingsSource = "ecr,ecr"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], `FINDINGS_SOURCE "ecr,ecr" is invalid, expected each source once`) {
+		t.Fatalf("Unexpected problems: %v", err)
+	}
+}
+
+func TestValidateMaxImageAge(t *testing.T) {
+	c := validConfig()
+	c.maxImageAge = "90d"
+	err := c.validate()
+	if err == nil {
+		t.Fatalf("Expected invalid configuration error")
+	}
+	problems := err.(configError)
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], `MAX_IMAGE_AGE "90d" is invalid`) {
+		t.Fatalf("Unexpected problems: %s", err)
+	}
+}
+
+func TestTeamSettingsWorkspace(t *testing.T) {
+	base := validConfig()
+	base.slack.fallbackQueueURL = "https://sqs.us-east-1.amazonaws.com/123456789012/slack-fallback"
+	c := teamSettings(base, configfile.Notifiers{Slack: configfile.SlackNotifier{
+		Channel:        "#platform-security",
+		TokenSecretARN: "arn:aws:secretsmanager:us-east-1:123456789012:secret:platform-slack",
+	}})
+	if c.slack.channel != "#platform-security" || c.slack.tokenSecretARN != "arn:aws:secretsmanager:us-east-1:123456789012:secret:platform-slack" || c.slack.fallbackQueueURL != "" {
+		t.Fatalf("Unexpected slack configuration: %+v", c.slack)
+	}
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestValidateRegistries(t *testing.T) {
+	c := validConfig()
+	c.ecrIDs = "111111111111,222222222222=arn:aws:iam::222222222222:role/ecr-scan"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.ecrID = "111111111111"
+	err := c.validate()
+	if err == nil || !strings.Contains(err.Error(), "not to be set together with ECR_ID") {
+		t.Fatalf("Expected ECR_ID and ECR_IDS to conflict, got: %v", err)
+	}
+
+	c.ecrID = ""
+	c.ecrIDs = "111111111111=ecr-scan"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], `ECR_IDS "111111111111=ecr-scan" is invalid`) {
+		t.Fatalf("Expected an invalid role ARN, got: %v", err)
+	}
+
+	c.ecrIDs = "111111111111"
+	c.accountAliases = "111111111111=prod,prod-eu"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], `ACCOUNT_ALIASES "111111111111=prod,prod-eu" is invalid`) {
+		t.Fatalf("Expected an invalid account alias, got: %v", err)
+	}
+}
+
+func TestValidateSlackWebhook(t *testing.T) {
+	c := validConfig()
+	c.exporters = "slack"
+	c.slack = slackConfig{webhookURL: "https://hooks.slack.com/services/T000/B000/XXXX", postTimeout: "0s", selfTest: "false"}
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.slack.webhookURL = "hooks.slack.com/services/T000/B000/XXXX"
+	err := c.validate()
+	if err == nil || !strings.HasPrefix(err.(configError)[0], "SLACK_WEBHOOK_URL is invalid") {
+		t.Fatalf("Expected an invalid webhook URL, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "XXXX") {
+		t.Fatalf("The webhook URL must not appear in the error: %s", err)
+	}
+
+	// A token takes precedence over the webhook
+	c.slack.token = "xoxb-1234"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], "SLACK_CHANNEL is not set") {
+		t.Fatalf("Expected the token to need a channel, got: %v", err)
+	}
+}
+
+func TestValidateSlackChart(t *testing.T) {
+	c := validConfig()
+	c.exporters = "slack"
+	c.slack.chartURI = "s3://ecr-scan-charts/slack"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], "SLACK_CHART_URL is not set") {
+		t.Fatalf("Expected the chart to need a URL, got: %v", err)
+	}
+
+	c.slack.chartURL = "http://ecr-scan-charts.s3.amazonaws.com/slack"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], `SLACK_CHART_URL "http://ecr-scan-charts.s3.amazonaws.com/slack" is invalid`) {
+		t.Fatalf("Expected an invalid chart URL, got: %v", err)
+	}
+
+	c.slack.chartURL = "https://ecr-scan-charts.s3.amazonaws.com/slack"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestValidateCompliance(t *testing.T) {
+	c := validConfig()
+	c.compliance = "cis-docker, nist-800-53"
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.compliance = "cis-docker,pci-dss"
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], `COMPLIANCE_FRAMEWORKS "cis-docker,pci-dss" is invalid`) {
+		t.Fatalf("Expected an unknown framework, got: %v", err)
+	}
+}
+
+func TestValidateSeverityDisplay(t *testing.T) {
+	c := validConfig()
+	c.severityDisplay = `{"CRITICAL": {"emoji": ":fire:", "label": "P1"}}`
+	if err := c.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.severityDisplay = `{"SEVERE": {"label": "S1"}}`
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], "SEVERITY_DISPLAY") {
+		t.Fatalf("Expected an invalid severity display, got: %v", err)
+	}
+}
+
+func TestValidateGitHub(t *testing.T) {
+	c := validConfig()
+	c.exporters = "github"
+	c.github = githubConfig{repositories: "team/app=example/app"}
+
+	err := c.validate()
+	if err == nil {
+		t.Fatalf("Expected invalid configuration error")
+	}
+	problems := err.(configError)
+	if len(problems) != 2 || !strings.HasPrefix(problems[0], "GITHUB_TOKEN is not set") || !strings.HasPrefix(problems[1], `GITHUB_REPOSITORIES "team/app=example/app" is invalid`) {
+		t.Fatalf("Unexpected problems: %s", err)
+	}
+	if !c.exporterEnabled("github") || c.exporterEnabled("slack") {
+		t.Fatalf("Expected only the github exporter to be enabled")
+	}
+}
+
+func TestValidateDefectDojo(t *testing.T) {
+	c := validConfig()
+	c.exporters = "defectdojo"
+	c.defectDojo = defectDojoConfig{url: "https://defectdojo.example.com", token: "secret", engagement: "ECR scan"}
+
+	err := c.validate()
+	if err == nil || len(err.(configError)) != 1 || !strings.HasPrefix(err.(configError)[0], "DEFECTDOJO_PRODUCT is not set") {
+		t.Fatalf("Expected a missing product, got: %v", err)
+	}
+
+	c.defectDojo.products = `{"team/*": {"engagement": "Images"}}`
+	if err := c.validate(); err == nil || !strings.HasPrefix(err.(configError)[0], "DEFECTDOJO_PRODUCTS") {
+		t.Fatalf("Expected invalid products, got: %v", err)
+	}
+
+	c.defectDojo.products = `{"team/*": {"product": "Payments"}}`
+	if err := c.validate(); err != nil {
+		t.Fatalf("Expected valid configuration, got: %s", err)
+	}
+}
+
+func TestValidateSplunk(t *testing.T) {
+	c := validConfig()
+	c.exporters = "splunk"
+
+	err := c.validate()
+	if err == nil || len(err.(configError)) != 2 || !strings.HasPrefix(err.(configError)[1], "SPLUNK_HEC_TOKEN is not set") {
+		t.Fatalf("Expected missing URL and token, got: %v", err)
+	}
+
+	c.splunk = splunkConfig{url: "https://splunk.example.com:8088", tokenSecretARN: "arn:aws:secretsmanager:us-east-1:123456789012:secret:hec"}
+	if err := c.validate(); err != nil {
+		t.Fatalf("Expected valid configuration, got: %s", err)
+	}
+}
+
+func TestValidateWebex(t *testing.T) {
+	c := validConfig()
+	c.exporters = "webex"
+	c.webex = webexConfig{apiURL: "https://webexapis.com", token: "secret"}
+
+	err := c.validate()
+	if err == nil || len(err.(configError)) != 1 || !strings.HasPrefix(err.(configError)[0], "WEBEX_ROOM_ID is not set") {
+		t.Fatalf("Expected a missing room, got: %v", err)
+	}
+}
+
+func TestCachedParsedConfig(t *testing.T) {
+	c := validConfig()
+	c.staleDays = "30"
+	c.tagFilter = "scan=true"
+	parsed, err := cachedParsedConfig(c)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if parsed.workers != 2 || parsed.staleAfter != 30*24*time.Hour || parsed.gateStatus != 409 || parsed.delivery.Attempts != 3 || parsed.tagFilter["scan"] != "true" {
+		t.Fatalf("Unexpected parsed config: %+v", parsed)
+	}
+
+	// Warm invocations of the same configuration reuse it
+	if again, err := cachedParsedConfig(c); err != nil || again != parsed {
+		t.Fatalf("Expected the parsed config to be reused, got: %p, %v", again, err)
+	}
+
+	c.numWorkers = "many"
+	if _, err := cachedParsedConfig(c); err == nil {
+		t.Fatalf("Expected an invalid number of workers to fail parsing")
+	}
+}
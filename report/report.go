@@ -1,34 +1,231 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	// Embed the time zone database, provided.al2 runtimes don't ship one
+	_ "time/tzdata"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/inspector2"
+	"github.com/aws/aws-sdk-go/service/kms"
+	awslambda "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/sts"
 	api "github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/configfile"
 	exp "github.com/nagypeterjob/ecr-scan-lambda/pkg/exporters"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/notify"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/report"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/scanner"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/severity"
+	"github.com/nlopes/slack"
+	"go.uber.org/zap"
+)
+
+// secrets outlives a single invocation, so secrets are only fetched on cold start
+var secrets *api.SecretsService
+
+// parameterStore outlives a single invocation, so parameters are cached between warm starts
+var parameterStore *api.ParameterStore
+
+// ecrClients outlive a single invocation, one per session
+var ecrClients = map[*session.Session]*ecr.ECR{}
+
+// ecrClient returns the ECR client of the session, creating it on first use. Its requests are limited to rate
+// per second unless rate is zero, across invocations too, and canceled after timeout unless it is zero.
+func ecrClient(sess *session.Session, rate float64, timeout time.Duration) *ecr.ECR {
+	if _, ok := ecrClients[sess]; !ok {
+		client := ecr.New(sess)
+		if rate > 0 {
+			api.LimitRequests(client.Client, api.NewRateLimiter(rate))
+		}
+		if timeout > 0 {
+			api.TimeoutRequests(client.Client, timeout)
+		}
+		ecrClients[sess] = client
+	}
+	return ecrClients[sess]
+}
+
+// roleSessions outlive a single invocation, one per assumed role, so their credentials are refreshed when they expire
+var roleSessions = map[string]*session.Session{}
+
+// roleSession returns a session with the credentials of the role, assumed with the credentials of sess
+func roleSession(sess *session.Session, roleARN string) *session.Session {
+	if _, ok := roleSessions[roleARN]; !ok {
+		roleSessions[roleARN] = sess.Copy(&aws.Config{Credentials: stscreds.NewCredentials(sess, roleARN)})
+	}
+	return roleSessions[roleARN]
+}
+
+// registryClient is a registry of ECR_IDS and the client reaching it
+type registryClient struct {
+	id     string
+	alias  string
+	client api.ECRClient
+}
+
+// repositoryCaches outlive a single invocation, so repository listings are reused by warm starts, one per table and TTL
+var repositoryCaches = map[string]*api.RepositoryCache{}
+
+// repositoryCache returns the repository cache of the table and TTL, creating it on first use
+func repositoryCache(table string, ttl time.Duration, sess *session.Session) *api.RepositoryCache {
+	key := table + "/" + ttl.String()
+	if _, ok := repositoryCaches[key]; !ok {
+		repositoryCaches[key] = api.NewRepositoryCache(ttl, table, dynamodb.New(sess))
+	}
+	return repositoryCaches[key]
+}
+
+// exporterCache outlives a single invocation, so exporters are only built again when their configuration changes
+var exporterCache = map[config][]notify.Notifier{}
+
+// cachedExporters returns the exporters a previous invocation built for the same configuration, or builds them
+func cachedExporters(config config, sess *session.Session, logger *logger.Logger) ([]notify.Notifier, error) {
+	if exporters, ok := exporterCache[config]; ok {
+		return exporters, nil
+	}
+	exporters, err := initExporters(config, sess, logger)
+	if err != nil {
+		return nil, err
+	}
+	exporterCache[config] = exporters
+	return exporters, nil
+}
+
+// Source and detail types of the EventBridge events published at the end of each invocation
+const (
+	eventSource       = "ecr-scan"
+	eventRunCompleted = "ecr-scan.run.completed"
+	eventRunFailed    = "ecr-scan.run.failed"
+)
+
+// How repositories whose findings can't be retrieved affect the outcome of the run
+const (
+	failureModeFailFast  = "fail_fast"
+	failureModeContinue  = "continue"
+	failureModeThreshold = "threshold"
+)
+
+// Modes of an invocation, daily runs scan the registry, digests roll the stored daily reports up,
+// inventories count the repositories and images of every registry and how much of them is scanned
+const (
+	modeDaily     = "daily"
+	modeDigest    = "digest"
+	modeInventory = "inventory"
+)
+
+// Where the Slack exporter mentions repositories with severe findings
+const (
+	escalationInline  = "inline"
+	escalationMessage = "message"
+	escalationBoth    = "both"
 )
 
 type app struct {
-	api             *api.ECRService
-	env             string
-	exporters       []exp.Exporter
-	logger          *logger.Logger
-	minimumSeverity string
-	numWorkers      int
-	region          string
+	checkpoints         *api.CheckpointStore
+	checkpointMargin    time.Duration
+	deadlineMargin      time.Duration
+	dedup               *api.LockService
+	digestDays          int
+	escalationDays      int
+	graceDays           int
+	resolved            bool
+	responses           *api.ResponseStore
+	responseLimit       int
+	delivery            notify.Policy
+	digestSLA           map[string]int
+	dryRun              bool
+	dryRunOutput        strings.Builder
+	env                 string
+	events              *api.EventsService
+	exporters           []notify.Notifier
+	fallbackQueue       *api.SQSService
+	failureMode         string
+	failureThreshold    float64
+	file                *configfile.File
+	gate                bool
+	gateStatus          int
+	history             *api.HistoryStore
+	invoker             *api.InvokeService
+	lock                *api.LockService
+	logger              *logger.Logger
+	mode                string
+	presentation        exp.Presentation
+	region              string
+	registries          []registryClient
+	reportDate          string
+	reportTime          time.Time
+	result              *api.Report
+	rerun               *rerun
+	rerunInterval       time.Duration
+	rerunJitter         time.Duration
+	rerunMaxIterations  int
+	rerunInProgress     bool
+	run                 *runSummary
+	runID               string
+	scan                scanner.Options
+	snoozeReminder      time.Duration
+	suppressionReminder time.Duration
+	teams               []team
+}
+
+// team receives the part of the report covering its repositories
+type team struct {
+	configfile.Team
+	exporters []notify.Notifier
+}
+
+// slackFallback returns where Slack messages are queued while Slack is unavailable, nil when nowhere
+func slackFallback(config config, sess *session.Session) func(payload []byte) error {
+	if config.slack.fallbackTopicARN != "" {
+		service := api.NewSNSService(sns.New(sess))
+		return func(payload []byte) error {
+			_, err := service.Publish(&sns.PublishInput{
+				TopicArn: aws.String(config.slack.fallbackTopicARN),
+				Message:  aws.String(string(payload)),
+			})
+			return err
+		}
+	}
+	if config.slack.fallbackQueueURL != "" {
+		return api.NewSQSService(config.slack.fallbackQueueURL, sqs.New(sess)).Send
+	}
+	return nil
 }
 
-func initExporters(config config, logger *logger.Logger) ([]exp.Exporter, error) {
-	var exporters []exp.Exporter
+func initExporters(config config, sess *session.Session, logger *logger.Logger) ([]notify.Notifier, error) {
+	var exporters []notify.Notifier
+	fallback := slackFallback(config, sess)
 
 	logger.Infof("Exporters enabled: %s", config.exporters)
 
@@ -44,16 +241,71 @@ func initExporters(config config, logger *logger.Logger) ([]exp.Exporter, error)
 
 		if e == "slack" {
 			logger.Debug("Initializing slack exporter...")
-			slack := exp.NewSlackExporter(e, config.slack.token, config.slack.channel)
-			exporters = append(exporters, slack)
-		}
+			httpConfig, err := api.ParseHTTPConfig(config.httpTimeout, config.httpMaxIdleConns, config.proxyURL)
+			if err != nil {
+				return nil, err
+			}
+			httpClient, err := api.SharedHTTPClient(httpConfig)
+			if err != nil {
+				return nil, err
+			}
 
-		if e == "sns" {
-			logger.Debug("Initializing sns exporter...")
-			sess, err := session.NewSession(&aws.Config{Region: &config.region})
+			options := []slack.Option{slack.OptionHTTPClient(httpClient)}
+			if config.slack.apiURL != "" {
+				options = append(options, slack.OptionAPIURL(config.slack.apiURL))
+			}
+
+			postTimeout, err := time.ParseDuration(config.slack.postTimeout)
 			if err != nil {
 				return nil, err
 			}
+
+			escalation := exp.Escalation{
+				Mention:  config.slack.escalationMention,
+				Severity: config.slack.escalationSeverity,
+				Inline:   config.slack.escalationMode != escalationMessage,
+				Separate: config.slack.escalationMode != escalationInline,
+			}
+
+			var slackExp *exp.SlackService
+			switch {
+			case config.slack.webhook():
+				webhook := exp.NewSlackWebhook(config.slack.webhookURL, httpClient)
+				slackExp = exp.NewSlackExporterWithClient(e, webhook, config.slack.channel)
+			case config.slack.tokenSecretARN == "":
+				slackExp = exp.NewSlackExporter(e, config.slack.token, config.slack.channel, options...)
+			default:
+				if secrets == nil {
+					secrets = api.NewSecretsService(secretsmanager.New(sess))
+				}
+				token, err := secrets.GetSecret(config.slack.tokenSecretARN)
+				if err != nil {
+					return nil, err
+				}
+				slackExp = exp.NewSlackExporter(e, token, config.slack.channel, options...).WithTokenRefresh(func() (string, error) {
+					return secrets.RefreshSecret(config.slack.tokenSecretARN)
+				})
+			}
+			slackExp.WithFallback(fallback).WithEscalation(escalation).WithTimeout(postTimeout)
+			if config.slack.chartURI != "" {
+				storage, err := api.NewS3Service(config.slack.chartURI, s3.New(sess))
+				if err != nil {
+					return nil, err
+				}
+				slackExp.WithChart(exp.Chart{Storage: storage, URL: config.slack.chartURL})
+			}
+
+			// Checked once per cold start, exporters failing it aren't cached and are checked again next time
+			if selfTest, _ := strconv.ParseBool(config.slack.selfTest); selfTest {
+				if err := slackExp.SelfTest(context.Background()); err != nil {
+					return nil, err
+				}
+			}
+			exporters = append(exporters, slackExp)
+		}
+
+		if e == "sns" {
+			logger.Debug("Initializing sns exporter...")
 			client := sns.New(sess)
 
 			service := api.NewSNSService(client)
@@ -67,90 +319,1481 @@ func initExporters(config config, logger *logger.Logger) ([]exp.Exporter, error)
 			mg := exp.NewMailgunExporter(e, config.mailgun.recipients, config.mailgun.from, config.mailgun.apiKey)
 			exporters = append(exporters, mg)
 		}
+
+		if e == "prometheus" {
+			logger.Debug("Initializing Prometheus Pushgateway exporter...")
+			repositoryMetrics, _ := strconv.ParseBool(config.pushgateway.repositoryMetrics)
+			pg := exp.NewPushgatewayExporter(e, config.pushgateway.url, config.ecrID, config.region, repositoryMetrics)
+			exporters = append(exporters, pg)
+		}
+
+		if e == "grafana" {
+			logger.Debug("Initializing Grafana exporter...")
+			gf := exp.NewGrafanaExporter(e, config.grafana.url, config.grafana.apiKey)
+			exporters = append(exporters, gf)
+		}
+
+		if e == "badge" {
+			logger.Debug("Initializing badge exporter...")
+			storage, err := api.NewS3Service(config.badge.uri, s3.New(sess))
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, exp.NewBadgeExporter(e, storage))
+		}
+
+		if e == "github" {
+			logger.Debug("Initializing GitHub exporter...")
+			repositories, err := exp.ParseGitHubRepositories(config.github.repositories)
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, exp.NewGitHubExporter(e, config.github.apiURL, config.github.token, repositories))
+		}
+
+		if e == "confluence" {
+			logger.Debug("Initializing Confluence exporter...")
+			c := config.confluence
+			exporters = append(exporters, exp.NewConfluenceExporter(e, c.url, c.user, c.token, c.space, c.parentID, c.title))
+		}
+
+		if e == "pdf" {
+			logger.Debug("Initializing PDF exporter...")
+			storage, err := api.NewS3Service(config.pdf.uri, s3.New(sess))
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, exp.NewPDFExporter(e, storage))
+		}
+
+		if e == "dashboard" {
+			logger.Debug("Initializing dashboard exporter...")
+			storage, err := api.NewS3Service(config.dashboard.uri, s3.New(sess))
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, exp.NewDashboardExporter(e, storage))
+		}
+
+		if e == "defectdojo" {
+			logger.Debug("Initializing DefectDojo exporter...")
+			d := config.defectDojo
+			targets, err := exp.ParseDefectDojoTargets(d.products)
+			if err != nil {
+				return nil, err
+			}
+			fallback := exp.DefectDojoTarget{Product: d.product, Engagement: d.engagement}
+			exporters = append(exporters, exp.NewDefectDojoExporter(e, d.url, d.token, d.productType, fallback, targets))
+		}
+
+		if e == "splunk" {
+			logger.Debug("Initializing Splunk exporter...")
+			token := config.splunk.token
+			if config.splunk.tokenSecretARN != "" {
+				if secrets == nil {
+					secrets = api.NewSecretsService(secretsmanager.New(sess))
+				}
+				var err error
+				if token, err = secrets.GetSecret(config.splunk.tokenSecretARN); err != nil {
+					return nil, err
+				}
+			}
+			exporters = append(exporters, exp.NewSplunkExporter(e, config.splunk.url, token, config.splunk.index, config.splunk.sourceType))
+		}
+
+		if e == "webex" {
+			logger.Debug("Initializing Webex exporter...")
+			exporters = append(exporters, exp.NewWebexExporter(e, config.webex.apiURL, config.webex.token, config.webex.roomID))
+		}
+	}
+
+	parsed, err := cachedParsedConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range exporters {
+		if p, ok := e.(exp.PresentingExporter); ok {
+			p.SetPresentation(parsed.presentation)
+		}
+	}
+
+	if redactor := exp.ParseRedactor(config.redactRepositories, config.redactMode); redactor != nil {
+		for i, e := range exporters {
+			if config.redacted(e.Name()) {
+				logger.Debugf("Redacting repository names sent by the %s exporter", e.Name())
+				exporters[i] = exp.Redacted(e, redactor)
+			}
+		}
 	}
 	return exporters, nil
 }
 
-func (a *app) Handle(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
-	ctx, cancelFunc := context.WithCancel(context.Background())
-	defer cancelFunc()
+// invocationParameter returns a parameter of the invocation, from the query string or the JSON body of the payload
+func invocationParameter(request events.APIGatewayProxyRequest, key string) string {
+	if value := request.QueryStringParameters[key]; value != "" {
+		return value
+	}
+
+	var body map[string]interface{}
+	if request.Body != "" {
+		json.Unmarshal([]byte(request.Body), &body)
+	}
+	value, _ := body[key].(string)
+	return value
+}
 
-	// Load all ecr repositories into a channel
-	repositories, describeError := a.api.DescribeRepositoriesPages(ctx)
+// resumeToken returns the token of the checkpoint an invocation continues from, if any
+func resumeToken(request events.APIGatewayProxyRequest) string {
+	return invocationParameter(request, "resumeToken")
+}
 
-	if err := <-describeError; err != nil {
-		cancelFunc()
-		fmt.Println(err)
+// invocationMode returns the mode the invocation runs in, the payload of a schedule may override the configured one
+func invocationMode(request events.APIGatewayProxyRequest, configured string) string {
+	if mode := invocationParameter(request, "mode"); mode != "" {
+		return mode
 	}
+	return configured
+}
 
-	// Scan repositories then filter them based on provided severity level
-	filtered, failed := a.api.GatherVulnerabilities(ctx, repositories, a.minimumSeverity, a.numWorkers)
+// rerun is a run the function invoked itself for, its state is carried by the payload of the invocation
+type rerun struct {
+	// Reruns before this one and this one, the scheduled run is not counted
+	Iteration int       `json:"iteration"`
+	NotBefore time.Time `json:"notBefore"`
+	// Only these repositories are checked when set, as <registry ID>/<name> with ECR_IDS
+	Repositories []string `json:"repositories,omitempty"`
+}
 
-	// Format and send vulnerability reports to each enabled exporters
-	for _, e := range a.exporters {
-		send, err := e.Format(filtered, failed)
+// rerunOf returns the rerun the invocation is, nil when it isn't one
+func rerunOf(request events.APIGatewayProxyRequest) *rerun {
+	var body struct {
+		Rerun *rerun `json:"rerun"`
+	}
+	if request.Body != "" {
+		json.Unmarshal([]byte(request.Body), &body)
+	}
+	return body.Rerun
+}
+
+// invocationRequest returns the payload of an invocation continuing the checkpoint of token, or the rerun r, or both
+func invocationRequest(token string, r *rerun) events.APIGatewayProxyRequest {
+	body, _ := json.Marshal(struct {
+		ResumeToken string `json:"resumeToken,omitempty"`
+		Rerun       *rerun `json:"rerun,omitempty"`
+	}{token, r})
+	return events.APIGatewayProxyRequest{Body: string(body)}
+}
+
+// runEvent is the detail of the EventBridge event published at the end of each invocation
+type runEvent struct {
+	Env     string          `json:"env"`
+	Region  string          `json:"region"`
+	Status  int             `json:"status"`
+	Error   string          `json:"error,omitempty"`
+	Summary *report.Summary `json:"summary,omitempty"`
+}
+
+// runSummary is logged and returned at the end of each invocation, so automation can check what the run did
+type runSummary struct {
+	RunID  string `json:"run_id"`
+	Mode   string `json:"mode"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Repositories listed by this invocation, before any filtering
+	Listed    int64             `json:"listed"`
+	Report    *report.Summary   `json:"report,omitempty"`
+	Gate      *gateOutcome      `json:"gate,omitempty"`
+	Notifiers []notifierOutcome `json:"notifiers"`
+	// Milliseconds spent in each phase of the invocation, and in total
+	Durations map[string]int64 `json:"durationsMs"`
+}
+
+// gateOutcome tells whether the images passed the gate, and the repositories failing it
+type gateOutcome struct {
+	Passed       bool     `json:"passed"`
+	Repositories []string `json:"repositories"`
+}
+
+// notifierOutcome is the outcome of a notifier, of a team's when Team is set
+type notifierOutcome struct {
+	Team string `json:"team,omitempty"`
+	notify.Outcome
+}
+
+// Handle runs the report, then publishes the outcome of the invocation
+func (a *app) Handle(ctx context.Context, request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	started := time.Now()
+	a.run = &runSummary{
+		RunID:     a.runID,
+		Mode:      invocationMode(request, a.mode),
+		Notifiers: []notifierOutcome{},
+		Durations: map[string]int64{},
+	}
+
+	a.rerun = rerunOf(request)
+	response := a.handle(ctx, request)
+	// Failed invocations are retried by Lambda, which schedules the rerun
+	if a.rerunInterval > 0 && a.result != nil && !a.dryRun && response.StatusCode < 500 {
+		a.scheduleRerun()
+	}
+	if a.events != nil && !a.dryRun {
+		a.publish(response)
+	}
+	return a.respond(request, a.summarize(response, started))
+}
+
+// summarize logs the summary of the invocation and returns it as the body of successful responses,
+// dry runs keep returning the would-be messages
+func (a *app) summarize(response events.APIGatewayProxyResponse, started time.Time) events.APIGatewayProxyResponse {
+	a.timed("total", started)
+	a.run.Status = response.StatusCode
+	if response.StatusCode >= 500 {
+		a.run.Error = response.Body
+	}
+	if a.result != nil && a.run.Mode == modeDaily {
+		summary := a.result.Summary()
+		a.run.Report = &summary
+	}
+
+	summary, err := json.Marshal(a.run)
+	if err != nil {
+		a.logger.Errorf("Error encoding the run summary: %s", err.Error())
+		return response
+	}
+	a.logger.Info("Run summary", zap.Reflect("summary", a.run))
+
+	// Failing the gate isn't an error, the summary tells which repositories failed it
+	succeeded := response.StatusCode == 200 || (a.run.Gate != nil && response.StatusCode == a.gateStatus)
+	if succeeded && response.Body == "" {
+		response.Body = string(summary)
+		response.Headers = map[string]string{"Content-Type": "application/json"}
+	}
+	return response
+}
+
+// maxResponseBytes is the largest body returned as is, below the 6 MB response limit of Lambda and API Gateway
+// leaving room for the headers and the encoding of the response
+const maxResponseBytes = 5 * 1024 * 1024
+
+// offloadedResponse is returned in place of a body too large to return
+type offloadedResponse struct {
+	RunID   string    `json:"run_id"`
+	Status  int       `json:"status"`
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+	Bytes   int       `json:"bytes"`
+}
+
+// respond compresses the body when the caller accepts gzip, then offloads it when it is still too large to return.
+// Offloaded bodies are stored uncompressed.
+func (a *app) respond(request events.APIGatewayProxyRequest, response events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	if response.Body != "" && acceptsGzip(request) {
+		compressed, err := gzipResponse(response)
 		if err != nil {
-			return errorResponse(err)
+			a.logger.Errorf("Error compressing the response: %s", err.Error())
+		} else if len(compressed.Body) <= a.maxResponseBytes() {
+			return compressed
 		}
+	}
+	return a.offload(response)
+}
 
-		if err = send(); err != nil {
-			return errorResponse(err)
+// acceptsGzip reports whether the Accept-Encoding header of the request accepts gzip, as RFC 9110 defines:
+// x-gzip is the same coding, * stands for codings not listed otherwise, and q=0 means not acceptable
+func acceptsGzip(request events.APIGatewayProxyRequest) bool {
+	var values []string
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, "Accept-Encoding") {
+			values = append(values, value)
+		}
+	}
+	for key, multi := range request.MultiValueHeaders {
+		if strings.EqualFold(key, "Accept-Encoding") {
+			values = append(values, multi...)
 		}
+	}
 
-		a.logger.Infof("%s exporter has sucessfully sent message", e.Name())
+	gzipWeight, anyWeight := -1.0, -1.0
+	for _, value := range values {
+		for _, coding := range strings.Split(value, ",") {
+			params := strings.Split(coding, ";")
+			weight := 1.0
+			for _, param := range params[1:] {
+				if q := strings.TrimSpace(param); strings.HasPrefix(strings.ToLower(q), "q=") {
+					parsed, err := strconv.ParseFloat(q[2:], 64)
+					if err != nil {
+						parsed = 0
+					}
+					weight = parsed
+				}
+			}
+			switch name := strings.ToLower(strings.TrimSpace(params[0])); name {
+			case "gzip", "x-gzip":
+				if weight > gzipWeight {
+					gzipWeight = weight
+				}
+			case "*":
+				if weight > anyWeight {
+					anyWeight = weight
+				}
+			}
+		}
 	}
+	if gzipWeight >= 0 {
+		return gzipWeight > 0
+	}
+	return anyWeight > 0
+}
 
-	return events.APIGatewayProxyResponse{StatusCode: 200}
+// gzipResponse returns the response with its body compressed, base64 encoded as API Gateway expects binary bodies
+func gzipResponse(response events.APIGatewayProxyResponse) (events.APIGatewayProxyResponse, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(response.Body)); err != nil {
+		return response, err
+	}
+	if err := writer.Close(); err != nil {
+		return response, err
+	}
+
+	headers := map[string]string{"Content-Encoding": "gzip", "Vary": "Accept-Encoding"}
+	for key, value := range response.Headers {
+		headers[key] = value
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode:      response.StatusCode,
+		Headers:         headers,
+		Body:            base64.StdEncoding.EncodeToString(buffer.Bytes()),
+		IsBase64Encoded: true,
+	}, nil
 }
 
-func errorResponse(err error) events.APIGatewayProxyResponse {
-	return events.APIGatewayProxyResponse{Body: err.Error(), StatusCode: 500}
+// maxResponseBytes returns the size of the largest body returned as is
+func (a *app) maxResponseBytes() int {
+	if a.responseLimit == 0 {
+		return maxResponseBytes
+	}
+	return a.responseLimit
 }
 
-// Handler glues the lambda logic together
-func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	err := printVersion()
-	if err != nil {
-		return errorResponse(err), err
+// offload stores a body too large to return in RESPONSE_S3_URI, and responds with a presigned URL of it in the
+// body and the Location header instead. The status is kept, so a failing gate still fails the caller.
+func (a *app) offload(response events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	limit := a.maxResponseBytes()
+	if len(response.Body) <= limit {
+		return response
+	}
+	if a.responses == nil {
+		a.logger.Errorf("Response of %d bytes exceeds the limit of %d bytes, set RESPONSE_S3_URI to offload it", len(response.Body), limit)
+		return response
 	}
 
-	config, err := initConfig()
+	contentType := response.Headers["Content-Type"]
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	url, expires, err := a.responses.Offload(a.runID, []byte(response.Body), contentType)
 	if err != nil {
-		return errorResponse(err), err
+		a.logger.Errorf("Error offloading the response of %d bytes: %s", len(response.Body), err.Error())
+		return response
 	}
-
-	sess, err := session.NewSession(&aws.Config{Region: &config.region})
+	body, err := json.Marshal(offloadedResponse{
+		RunID:   a.runID,
+		Status:  response.StatusCode,
+		URL:     url,
+		Expires: expires.UTC(),
+		Bytes:   len(response.Body),
+	})
 	if err != nil {
-		return errorResponse(err), err
+		a.logger.Errorf("Error encoding the offloaded response: %s", err.Error())
+		return response
+	}
+	a.logger.Infof("Response of %d bytes offloaded to S3", len(response.Body))
+	return events.APIGatewayProxyResponse{
+		StatusCode: response.StatusCode,
+		Body:       string(body),
+		Headers:    map[string]string{"Content-Type": "application/json", "Location": url},
 	}
+}
 
-	nw, err := strconv.ParseInt(config.numWorkers, 10, 64)
-	if err != nil {
-		return errorResponse(err), err
+// timed records the time spent in a phase of the invocation since started
+func (a *app) timed(phase string, started time.Time) {
+	a.run.Durations[phase] = time.Since(started).Nanoseconds() / int64(time.Millisecond)
+}
+
+// publish puts a run event on the event bus, failing when the invocation responds with an error
+func (a *app) publish(response events.APIGatewayProxyResponse) {
+	detailType := eventRunCompleted
+	detail := runEvent{Env: a.env, Region: a.region, Status: response.StatusCode}
+	if response.StatusCode >= 500 {
+		detailType = eventRunFailed
+		detail.Error = response.Body
+	}
+	if a.result != nil {
+		summary := a.result.Summary()
+		detail.Summary = &summary
 	}
 
-	logger, err := logger.NewLogger(config.logLevel)
+	if err := a.events.Put(detailType, detail); err != nil {
+		a.logger.Errorf("Error publishing %s event: %s", detailType, err.Error())
+	}
+}
+
+func (a *app) handle(ctx context.Context, request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	switch mode := invocationMode(request, a.mode); mode {
+	case modeDaily:
+	case modeDigest:
+		return a.digest()
+	case modeInventory:
+		return a.inventory(ctx)
+	default:
+		return errorResponse(fmt.Errorf("Invalid mode %q, expected %s, %s or %s", mode, modeDaily, modeDigest, modeInventory))
+	}
+
+	if a.rerun != nil {
+		if response, waiting := a.await(ctx); waiting {
+			return response
+		}
+	}
+
+	scan := a.scan
+	scanCtx := ctx
+
+	if a.rerun != nil && len(a.rerun.Repositories) > 0 {
+		only := make(map[string]bool)
+		for _, name := range a.rerun.Repositories {
+			only[name] = true
+		}
+		selected := scan.Selected
+		scan.Selected = func(name string) bool {
+			return only[name] && (selected == nil || selected(name))
+		}
+	}
+
+	checkpoint := &api.Checkpoint{Report: &api.Report{}}
+	token := resumeToken(request)
+	if a.checkpoints != nil {
+		if token != "" {
+			var err error
+			if checkpoint, err = a.checkpoints.Load(token); err != nil {
+				return errorResponse(err)
+			}
+			a.logger.Infof("Resuming %s after %d repositories", token, len(checkpoint.Processed))
+		}
+
+		processed := make(map[string]bool)
+		for _, name := range checkpoint.Processed {
+			processed[name] = true
+		}
+		// Repositories gathered by previous invocations count towards the cap
+		capReached := false
+		if scan.MaxRepositories > 0 {
+			scan.MaxRepositories -= len(checkpoint.Processed)
+			capReached = scan.MaxRepositories <= 0
+		}
+
+		selected := scan.Selected
+		scan.Selected = func(name string) bool {
+			return !capReached && !processed[name] && (selected == nil || selected(name))
+		}
+
+		var mu sync.Mutex
+		scan.Service.Gathered = func(name string) {
+			mu.Lock()
+			checkpoint.Processed = append(checkpoint.Processed, name)
+			mu.Unlock()
+		}
+
+		// Stop gathering in time to save the checkpoint before the function times out
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancelFunc context.CancelFunc
+			scanCtx, cancelFunc = context.WithDeadline(ctx, deadline.Add(-a.checkpointMargin))
+			defer cancelFunc()
+		}
+	} else if deadline, ok := ctx.Deadline(); ok {
+		// Stop gathering in time to send what was gathered before the function times out
+		scan.Service.Deadline = deadline.Add(-a.deadlineMargin)
+	}
+
+	resumed := len(checkpoint.Processed)
+	scan.Listed = func(string) {
+		atomic.AddInt64(&a.run.Listed, 1)
+	}
+	scanned := time.Now()
+	report, err := a.scanRegistries(scanCtx, scan)
+	a.timed("scan", scanned)
 	if err != nil {
-		return errorResponse(err), err
+		a.logger.Errorf("Error scanning registry: %s", err.Error())
+		return errorResponse(err)
+	}
+	// Reports continued by later invocations keep the ID of the first one
+	report.RunID = a.runID
+	report.Date = a.reportTime
+
+	if a.checkpoints != nil {
+		checkpoint.Invocations++
+		// Time ran out, unless the invocation itself was cancelled, which sends what was gathered
+		if scanCtx.Err() != nil && ctx.Err() == nil {
+			// Resuming without progress would invoke the function forever
+			if len(checkpoint.Processed) == resumed {
+				err := fmt.Errorf("No repository was gathered within the time limit, raise the timeout or lower CHECKPOINT_MARGIN")
+				return errorResponse(err)
+			}
+			return a.resume(token, checkpoint, report)
+		}
+
+		checkpoint.Report.Merge(report)
+		report = checkpoint.Report
+		if token != "" {
+			a.logger.Infof("Finished %s after %d invocations", token, checkpoint.Invocations)
+			if err := a.checkpoints.Delete(token); err != nil {
+				a.logger.Errorf("Error deleting checkpoint %s: %s", token, err.Error())
+			}
+		}
+	}
+
+	report.SnoozeExpiring = api.ExpiringSnoozes(scan.Service.Snoozes, time.Now(), a.snoozeReminder)
+	a.age(report)
+	a.resolve(report)
+	a.result = report
+	if report.NotProcessed > 0 {
+		a.logger.Errorf("Ran out of time, %d repositories were not processed", report.NotProcessed)
+	}
+
+	// Reports of broken runs are still sent, but answered with an error so they can be alerted on
+	var failure error
+	if len(report.Failed) > 0 {
+		a.logger.Errorf("Findings of %d of %d repositories couldn't be retrieved", len(report.Failed), report.Scanned)
+		if a.failureMode == failureModeThreshold && report.Scanned > 0 {
+			if ratio := float64(len(report.Failed)) * 100 / float64(report.Scanned); ratio > a.failureThreshold {
+				failure = fmt.Errorf("%.1f%% of repositories failed, more than FAILURE_THRESHOLD %.1f%%", ratio, a.failureThreshold)
+			}
+		}
 	}
 
-	exporters, err := initExporters(config, logger)
+	if a.file != nil && len(a.file.Suppressions) > 0 {
+		now := time.Now()
+		report = report.Subset(func(r *api.RepositoryInfo) bool {
+			if s := a.file.Suppressed(r.Name, now); s != nil {
+				a.logger.Infof("Suppressing %s: %s", r.DisplayName(), s.Reason)
+				return false
+			}
+			return true
+		})
+		report.SuppressionExpiring = a.file.ExpiringSuppressions(now, a.suppressionReminder)
+	}
+
+	// The eye lands on the most severe repositories first
+	report.SortBySeverity()
+
+	if a.gate {
+		a.run.Gate = checkGate(report)
+		if !a.run.Gate.Passed {
+			a.logger.Infof("Gate failed, %d repositories hit the severity threshold", len(a.run.Gate.Repositories))
+		}
+		// Repositories left out of a partial report could fail the gate
+		if failure == nil && (report.NotProcessed > 0 || report.Interrupted) {
+			failure = fmt.Errorf("The report is partial, GATE can't tell whether every repository passes")
+		}
+	}
+
+	// Retried and duplicate invocations don't send the same report again,
+	// neither do invocations finding the same results within the dedup window
+	var held []heldLock
+	if !a.dryRun {
+		hash := report.Hash()
+		locks := []heldLock{
+			{lock: a.lock, key: fmt.Sprintf("%s/%s/%s", a.env, a.reportDate, hash)},
+			{lock: a.dedup, key: fmt.Sprintf("%s/dedup/%s", a.env, hash)},
+		}
+		for _, l := range locks {
+			if l.lock == nil {
+				continue
+			}
+			acquired, err := l.lock.Acquire(l.key)
+			if err != nil {
+				a.release(held)
+				return errorResponse(err)
+			}
+			if !acquired {
+				a.logger.Infof("Report %s has already been sent, skipping", l.key)
+				return a.gated(events.APIGatewayProxyResponse{StatusCode: 200})
+			}
+			held = append(held, l)
+		}
+	}
+
+	if !a.dryRun && a.fallbackQueue != nil {
+		a.replay()
+	}
+
+	sent := time.Now()
+	err = a.sendAll(report)
+	a.timed("send", sent)
 	if err != nil {
-		return errorResponse(err), err
+		// Let the next attempt send the report, unless notifiers got it already and would get it twice
+		if a.delivered() {
+			a.logger.Infof("Some notifiers sent the report, the next attempt won't send it again")
+		} else {
+			a.release(held)
+		}
+		return errorResponse(err)
 	}
 
-	app := app{
-		api:             api.NewECRService(config.ecrID, config.region, config.imageTag, logger, ecr.New(sess)),
-		env:             config.env,
-		exporters:       exporters,
-		logger:          logger,
-		minimumSeverity: config.minimumSeverity,
-		numWorkers:      int(nw),
-		region:          config.region,
+	// The report was sent, a digest missing the day is better than sending it again
+	if a.history != nil && !a.dryRun {
+		if err := a.history.Save(a.date(), report); err != nil {
+			a.logger.Errorf("Error saving the report of %s for digests: %s", a.reportDate, err.Error())
+		}
+	}
+
+	if failure != nil {
+		a.logger.Error(failure.Error())
+		return errorResponse(failure)
 	}
-	return app.Handle(request), nil
+
+	// Dry runs return the would-be messages instead
+	return a.gated(events.APIGatewayProxyResponse{Body: a.dryRunOutput.String(), StatusCode: 200})
 }
 
-func main() {
+// checkGate collects the repositories hitting the severity threshold, which fail the gate
+func checkGate(report *api.Report) *gateOutcome {
+	outcome := &gateOutcome{Repositories: []string{}}
+	for _, r := range append(append([]*api.RepositoryInfo{}, report.Filtered...), report.PullThroughCache...) {
+		outcome.Repositories = append(outcome.Repositories, r.DisplayName())
+	}
+	outcome.Passed = len(outcome.Repositories) == 0
+	return outcome
+}
+
+// gated answers successful responses with gateStatus when the gate failed
+func (a *app) gated(response events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	if a.run.Gate != nil && !a.run.Gate.Passed && response.StatusCode == 200 {
+		response.StatusCode = a.gateStatus
+	}
+	return response
+}
+
+// scanRegistries scans each registry of ECR_IDS in turn and merges their reports, or the single registry
+// of the scan options. Repositories are told apart by registry in checkpoints, as <registry ID>/<name>.
+func (a *app) scanRegistries(ctx context.Context, scan scanner.Options) (*api.Report, error) {
+	if len(a.registries) == 0 {
+		return scanner.Scan(ctx, scan)
+	}
+
+	merged := &api.Report{}
+	for i, r := range a.registries {
+		id := r.id
+		opts := scan
+		opts.RegistryID, opts.Client = id, r.client
+		// Public repositories belong to no registry, they are listed once
+		if i > 0 {
+			opts.Public = nil
+		}
+		if selected := scan.Selected; selected != nil {
+			opts.Selected = func(name string) bool {
+				return selected(id + "/" + name)
+			}
+		}
+		if gathered := scan.Service.Gathered; gathered != nil {
+			opts.Service.Gathered = func(name string) {
+				gathered(id + "/" + name)
+			}
+		}
+
+		report, err := scanner.Scan(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("registry %s: %s", id, err)
+		}
+		account := r.alias
+		if account == "" {
+			account = id
+		}
+		report.SetAccount(account + "/" + a.region)
+		for i, name := range report.InProgress {
+			report.InProgress[i] = id + "/" + name
+		}
+		merged.Merge(report)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return merged, nil
+}
+
+// date returns the day of the report in the report time zone
+func (a *app) date() time.Time {
+	date, _ := time.Parse("2006-01-02", a.reportDate)
+	return date
+}
+
+// age holds back recently vulnerable repositories and escalates long vulnerable ones, by the stored daily reports
+func (a *app) age(report *api.Report) {
+	if a.history == nil || (a.graceDays == 0 && a.escalationDays == 0) {
+		return
+	}
+
+	lookback := a.graceDays
+	if a.escalationDays > lookback {
+		lookback = a.escalationDays
+	}
+	history, err := a.history.Load(a.date().AddDate(0, 0, -lookback))
+	if err != nil {
+		a.logger.Errorf("Error loading stored reports, repositories are reported regardless of how long they have been vulnerable: %s", err.Error())
+		return
+	}
+	report.Age(a.date(), history, a.graceDays, a.escalationDays)
+	if len(report.Pending) > 0 {
+		a.logger.Infof("%d repositories are held back by the grace period", len(report.Pending))
+	}
+}
+
+// resolve lists what was fixed since the latest stored report of an earlier day
+func (a *app) resolve(report *api.Report) {
+	if a.history == nil || !a.resolved {
+		return
+	}
+
+	// A week back, so a day without a run doesn't lose what was fixed
+	history, err := a.history.Load(a.date().AddDate(0, 0, -7))
+	if err != nil {
+		a.logger.Errorf("Error loading stored reports, fixed repositories aren't listed: %s", err.Error())
+		return
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Date.Before(a.date()) {
+			report.Resolve(history[i].Report)
+			return
+		}
+	}
+}
+
+// digest rolls the stored daily reports up, then sends the digest to the exporters able to send one
+func (a *app) digest() events.APIGatewayProxyResponse {
+	if a.history == nil {
+		return errorResponse(fmt.Errorf("MODE digest requires HISTORY_S3_URI to be set"))
+	}
+
+	// Findings breaching an SLA longer than the period are tracked back as far as the SLA
+	lookback := a.digestDays
+	for _, days := range a.digestSLA {
+		if days+1 > lookback {
+			lookback = days + 1
+		}
+	}
+	reports, err := a.history.Load(a.date().AddDate(0, 0, -lookback))
+	if err != nil {
+		return errorResponse(err)
+	}
+	if len(reports) == 0 {
+		a.logger.Info("No daily reports are stored yet, skipping digest")
+		return events.APIGatewayProxyResponse{StatusCode: 200}
+	}
+	digest := report.NewDigest(reports, a.digestDays, a.digestSLA)
+
+	if a.dryRun {
+		text := a.presentation.FormatDigestText(digest)
+		a.logger.Infof("Dry run, digest which would be sent:\n%s", text)
+		return events.APIGatewayProxyResponse{Body: text, StatusCode: 200}
+	}
+
+	skipped, outcomes, err := notify.DeliverDigest(a.runExporters(a.exporters), digest, a.delivery)
+	for _, name := range skipped {
+		a.logger.Infof("%s exporter doesn't send digests, skipping", name)
+	}
+	for _, o := range outcomes {
+		a.run.Notifiers = append(a.run.Notifiers, notifierOutcome{Outcome: o})
+	}
+	if len(outcomes) > 0 {
+		a.logger.Infof("Digest delivery, %s", notify.Summary(outcomes))
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+	a.logger.Infof("Digest of %d daily reports has been sent", len(digest.Trend))
+	return events.APIGatewayProxyResponse{StatusCode: 200}
+}
+
+// inventory counts the repositories and images of each registry of ECR_IDS, or of the single registry, then sends
+// the inventory to the exporters able to send one. Registries failing to be counted are sent as incomplete.
+func (a *app) inventory(ctx context.Context) events.APIGatewayProxyResponse {
+	registries := a.registries
+	if len(registries) == 0 {
+		registries = []registryClient{{id: a.scan.RegistryID, client: a.scan.Client}}
+	}
+
+	inventory := &report.Inventory{RunID: a.runID}
+	counted := time.Now()
+	for _, r := range registries {
+		service := api.NewECRService(r.id, a.region, a.scan.ImageTag, a.scan.Service, a.logger, r.client)
+		registry, err := service.Inventory(ctx)
+		registry.Account = a.region
+		if account := r.alias; account != "" || r.id != "" {
+			if account == "" {
+				account = r.id
+			}
+			registry.Account = account + "/" + a.region
+		}
+		if err != nil {
+			a.logger.Errorf("Error taking the inventory of %s: %s", registry.Account, err.Error())
+			registry.Error = err.Error()
+		}
+		inventory.Registries = append(inventory.Registries, *registry)
+	}
+	a.timed("inventory", counted)
+
+	if a.dryRun {
+		text := a.presentation.FormatInventoryText(inventory)
+		a.logger.Infof("Dry run, inventory which would be sent:\n%s", text)
+		return events.APIGatewayProxyResponse{Body: text, StatusCode: 200}
+	}
+
+	skipped, outcomes, err := notify.DeliverInventory(a.runExporters(a.exporters), inventory, a.delivery)
+	for _, name := range skipped {
+		a.logger.Infof("%s exporter doesn't send inventories, skipping", name)
+	}
+	for _, o := range outcomes {
+		a.run.Notifiers = append(a.run.Notifiers, notifierOutcome{Outcome: o})
+	}
+	if len(outcomes) > 0 {
+		a.logger.Infof("Inventory delivery, %s", notify.Summary(outcomes))
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+	total := inventory.Total()
+	a.logger.Infof("Inventory of %d repositories and %d images has been sent, %.1f%% of images are scanned", total.Repositories, total.Images, total.Coverage())
+	return events.APIGatewayProxyResponse{StatusCode: 200}
+}
+
+// resume saves the progress of an unfinished report, then invokes the function again to continue it
+func (a *app) resume(token string, checkpoint *api.Checkpoint, report *api.Report) events.APIGatewayProxyResponse {
+	if token == "" {
+		token = fmt.Sprintf("%s-%d", a.env, time.Now().UnixNano())
+	}
+
+	// Public repositories are listed again by the invocation finishing the report
+	report.Public = nil
+	// The report isn't cut short, the next invocation continues it
+	report.Interrupted = false
+	checkpoint.Report.Merge(report)
+
+	if err := a.checkpoints.Save(token, checkpoint); err != nil {
+		return errorResponse(err)
+	}
+	if err := a.invoker.InvokeAsync(invocationRequest(token, a.rerun)); err != nil {
+		return errorResponse(err)
+	}
+
+	a.logger.Infof("Ran out of time after %d repositories, continuing %s in a new invocation", len(checkpoint.Processed), token)
+	return events.APIGatewayProxyResponse{Body: token, StatusCode: 202}
+}
+
+// await holds the invocation until the rerun is due. Reruns not due before the invocation times out
+// are handed over to a new invocation, which keeps waiting.
+func (a *app) await(ctx context.Context) (events.APIGatewayProxyResponse, bool) {
+	wait := time.Until(a.rerun.NotBefore)
+	if wait <= 0 {
+		return events.APIGatewayProxyResponse{}, false
+	}
+
+	handOver := false
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline) - a.deadlineMargin
+		if left <= 0 {
+			return errorResponse(fmt.Errorf("No time left to wait for rerun %d, raise the timeout or lower DEADLINE_MARGIN", a.rerun.Iteration)), true
+		}
+		if left < wait {
+			wait, handOver = left, true
+		}
+	}
+
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+		return errorResponse(ctx.Err()), true
+	}
+	if !handOver {
+		return events.APIGatewayProxyResponse{}, false
+	}
+
+	if err := a.invoker.InvokeAsync(invocationRequest("", a.rerun)); err != nil {
+		return errorResponse(err), true
+	}
+	a.logger.Infof("Rerun %d is due at %s, waiting in a new invocation", a.rerun.Iteration, a.rerun.NotBefore.Format(time.RFC3339))
+	return events.APIGatewayProxyResponse{StatusCode: 202}, true
+}
+
+// scheduleRerun invokes the function for the next run, RERUN_INTERVAL and up to RERUN_JITTER from now.
+// There is none after RERUN_MAX_ITERATIONS reruns, nor with RERUN_IN_PROGRESS when no scan was in progress.
+func (a *app) scheduleRerun() {
+	next := &rerun{Iteration: 1}
+	if a.rerun != nil {
+		next.Iteration = a.rerun.Iteration + 1
+	}
+	if next.Iteration > a.rerunMaxIterations {
+		a.logger.Debugf("Ran %d reruns, not scheduling another", a.rerunMaxIterations)
+		return
+	}
+	if a.rerunInProgress {
+		if len(a.result.InProgress) == 0 {
+			a.logger.Debug("No scan is in progress, not scheduling a rerun")
+			return
+		}
+		next.Repositories = a.result.InProgress
+	}
+
+	delay := a.rerunInterval
+	if a.rerunJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(a.rerunJitter)))
+	}
+	next.NotBefore = time.Now().Add(delay)
+	if err := a.invoker.InvokeAsync(invocationRequest("", next)); err != nil {
+		a.logger.Errorf("Error scheduling rerun %d: %s", next.Iteration, err.Error())
+		return
+	}
+	a.logger.Infof("Scheduled rerun %d of %d at %s", next.Iteration, a.rerunMaxIterations, next.NotBefore.Format(time.RFC3339))
+}
+
+// replay posts the Slack messages queued during an outage, stopping when Slack is still unavailable.
+// Messages which can't be posted stay on the queue for the next run.
+func (a *app) replay() {
+	var slackExp *exp.SlackService
+	for _, e := range a.exporters {
+		if s, ok := exp.Unwrap(e).(*exp.SlackService); ok {
+			slackExp = s
+			break
+		}
+	}
+	if slackExp == nil {
+		a.logger.Error("SLACK_FALLBACK_QUEUE_URL is set, but the slack exporter isn't enabled to replay queued messages")
+		return
+	}
+
+	slackExp.SetLogger(a.logger)
+	for {
+		messages, err := a.fallbackQueue.Receive(10)
+		if err != nil {
+			a.logger.Errorf("Error receiving queued Slack messages: %s", err.Error())
+			return
+		}
+		if len(messages) == 0 {
+			return
+		}
+
+		for _, m := range messages {
+			queued, err := slackExp.Replay([]byte(m.Body))
+			if err != nil {
+				a.logger.Errorf("Error replaying queued Slack messages: %s", err.Error())
+				return
+			}
+			// Whatever wasn't posted has been queued again
+			if err := a.fallbackQueue.Delete(m.ReceiptHandle); err != nil {
+				a.logger.Errorf("Error deleting replayed Slack messages: %s", err.Error())
+				return
+			}
+			if queued {
+				a.logger.Info("Slack is still unavailable, replay stopped")
+				return
+			}
+		}
+		a.logger.Infof("Replayed %d queued Slack reports", len(messages))
+	}
+}
+
+// heldLock is a report lock taken by the invocation
+type heldLock struct {
+	lock *api.LockService
+	key  string
+}
+
+// release gives up the locks, so another invocation can send the report
+func (a *app) release(held []heldLock) {
+	for _, l := range held {
+		if err := l.lock.Release(l.key); err != nil {
+			a.logger.Errorf("Error releasing lock %s: %s", l.key, err.Error())
+		}
+	}
+}
+
+// delivered tells whether any notifier sent the report
+func (a *app) delivered() bool {
+	for _, o := range a.run.Notifiers {
+		if o.Status == notify.OutcomeSent {
+			return true
+		}
+	}
+	return false
+}
+
+// sendAll sends the report to the exporters, then the part of each team to the team's exporters
+func (a *app) sendAll(report *api.Report) error {
+	if err := a.send("", a.exporters, report); err != nil {
+		return err
+	}
+
+	for _, t := range a.teams {
+		a.logger.Infof("Sending report of team %s", t.Name)
+		teamReport := report.Subset(func(r *api.RepositoryInfo) bool {
+			return t.Owns(r.Name) || t.OwnsGroup(r.Group)
+		})
+		if err := a.send(t.Name, t.exporters, teamReport); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send formats and sends the vulnerability report to each exporter, of the team unless it is empty
+func (a *app) send(team string, exporters []notify.Notifier, report *api.Report) error {
+	if !a.dryRun {
+		outcomes, err := notify.Deliver(a.runExporters(exporters), report, a.delivery)
+		for _, o := range outcomes {
+			a.run.Notifiers = append(a.run.Notifiers, notifierOutcome{Team: team, Outcome: o})
+		}
+		if team != "" {
+			a.logger.Infof("Delivery of team %s, %s", team, notify.Summary(outcomes))
+		} else {
+			a.logger.Infof("Delivery, %s", notify.Summary(outcomes))
+		}
+		return err
+	}
+
+	text, err := a.presentation.FormatText(report)
+	if err != nil {
+		return err
+	}
+	a.logger.Infof("Dry run, report which would be sent:\n%s", text)
+	a.dryRunOutput.WriteString(text)
+
+	for _, e := range exporters {
+		if _, err := e.Format(report); err != nil {
+			return err
+		}
+		a.logger.Infof("Dry run, %s exporter didn't send the message", e.Name())
+	}
+	return nil
+}
+
+// runExporters makes the exporters log under the logger of the run, they are cached across runs
+func (a *app) runExporters(exporters []notify.Notifier) []notify.Notifier {
+	for _, e := range exporters {
+		if l, ok := exp.Unwrap(e).(exp.LoggingExporter); ok {
+			l.SetLogger(a.logger)
+		}
+	}
+	return exporters
+}
+
+// invocationRunID identifies the run by the start of the Lambda request ID, which CloudWatch logs are searchable by
+func invocationRunID(ctx context.Context) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok && len(lc.AwsRequestID) >= 8 {
+		return lc.AwsRequestID[:8]
+	}
+	return report.NewRunID()
+}
+
+func errorResponse(err error) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{Body: err.Error(), StatusCode: 500}
+}
+
+// terminated is closed when the runtime shuts the function down, e.g.: SIGTERM sent when extensions are registered
+var terminated = make(chan struct{})
+
+// Handler glues the lambda logic together
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Gathering stops on shutdown, so what was gathered is still sent
+	ctx, cancelFunc := context.WithCancel(ctx)
+	defer cancelFunc()
+	go func() {
+		select {
+		case <-terminated:
+			cancelFunc()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := printVersion()
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if loadErr != nil {
+		return errorResponse(loadErr), loadErr
+	}
+	config := loadedConfig
+
+	sess, err := api.CachedSession(api.SessionConfig{
+		Region:      config.region,
+		FIPS:        connection.fips,
+		DualStack:   connection.dualStack,
+		Endpoint:    config.endpoint,
+		ECREndpoint: config.ecrEndpoint,
+		STSEndpoint: config.stsEndpoint,
+		S3Endpoint:  config.s3Endpoint,
+		HTTP:        connection.http,
+	})
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if config.ssmPath != "" {
+		if parameterStore == nil {
+			parameterStore = api.NewParameterStore(config.ssmPath, connection.ssmTTL, ssm.New(sess))
+		}
+		previous := parameters
+		parameters, err = parameterStore.Load()
+		if err != nil {
+			return errorResponse(err), err
+		}
+
+		// Read the configuration again, now with parameters in place, unless they are the ones it was read with
+		if !reflect.DeepEqual(parameters, previous) {
+			if config, err = initConfig(); err != nil {
+				return errorResponse(err), err
+			}
+			loadedConfig = config
+		}
+	}
+
+	if config.kmsEncrypted != "" && decrypted == nil {
+		svc := api.NewKMSService(os.Getenv("AWS_LAMBDA_FUNCTION_NAME"), kms.New(sess))
+		decrypted, err = decryptVariables(config.kmsEncrypted, svc)
+		if err != nil {
+			return errorResponse(err), err
+		}
+
+		if config, err = initConfig(); err != nil {
+			return errorResponse(err), err
+		}
+		loadedConfig = config
+	}
+
+	var file *configfile.File
+	if config.configURI != "" {
+		file, err = configfile.Load(config.configURI, s3.New(sess))
+		if err != nil {
+			return errorResponse(err), err
+		}
+		if profile := invocationParameter(request, "profile"); profile != "" {
+			if file, err = file.WithProfile(profile); err != nil {
+				return errorResponse(err), err
+			}
+		}
+		applyConfigFile(&config, file)
+	} else if profile := invocationParameter(request, "profile"); profile != "" {
+		err = fmt.Errorf("Report profile %s requires CONFIG_S3_URI to be set", profile)
+		return errorResponse(err), err
+	}
+
+	if err := config.validate(); err != nil {
+		return errorResponse(err), err
+	}
+	if file != nil {
+		for _, t := range file.Routes() {
+			if len(t.Groups) > 0 && config.groupTag == "" {
+				err = fmt.Errorf("team %s: groups require REPOSITORY_GROUP_TAG to be set", t.Name)
+				return errorResponse(err), err
+			}
+			teamConfig := teamSettings(config, t.Notifiers)
+			if err := teamConfig.validate(); err != nil {
+				err = fmt.Errorf("team %s: %s", t.Name, err)
+				return errorResponse(err), err
+			}
+		}
+	}
+
+	parsed, err := cachedParsedConfig(config)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	// Gathering stops the margins ahead of the earlier of the run's and the function's timeout
+	if parsed.runTimeout > 0 {
+		var cancelRun context.CancelFunc
+		ctx, cancelRun = context.WithTimeout(ctx, parsed.runTimeout)
+		defer cancelRun()
+	}
+
+	logger, err := logger.NewLogger(config.logLevel)
+	if err != nil {
+		return errorResponse(err), err
+	}
+	runID := invocationRunID(ctx)
+	logger = logger.WithField("run_id", runID)
+
+	// Dry runs leave repositories untouched
+	enforceScanPush := parsed.enforceScanPush
+	if parsed.dryRun && enforceScanPush {
+		logger.Info("Dry run, scan on push won't be enabled on repositories")
+		enforceScanPush = false
+	}
+
+	tagFilter := copyMap(parsed.tagFilter)
+	if file != nil {
+		for k, v := range file.Repositories.Tags {
+			tagFilter[k] = v
+		}
+	}
+
+	countThresholds := severity.CountThresholds{}
+	for k, v := range parsed.countThresholds {
+		countThresholds[k] = v
+	}
+	if file != nil {
+		for k, v := range file.Thresholds.Counts {
+			countThresholds[k] = v
+		}
+	}
+
+	if config.thresholdMode != severity.ThresholdModeScore && len(countThresholds) == 0 {
+		err = fmt.Errorf("THRESHOLD_MODE %s requires COUNT_THRESHOLDS to be set", config.thresholdMode)
+		return errorResponse(err), err
+	}
+
+	options := api.Options{
+		TagFilter:            tagFilter,
+		GroupTag:             config.groupTag,
+		ResolveManifestLists: parsed.multiArch,
+		ScanScope:            config.scanScope,
+		NewestImages:         parsed.newestImages,
+		ConsoleDomain:        config.consoleDomain,
+		CountThresholds:      countThresholds,
+		ThresholdMode:        config.thresholdMode,
+		ShowAllSeverities:    parsed.showAll,
+		PageSize:             parsed.pageSize,
+		StaleAfter:           parsed.staleAfter,
+		MaxImageAge:          parsed.maxImageAge,
+		UntaggedThreshold:    parsed.untagged,
+		LifecyclePolicyAudit: config.lifecycleAudit,
+		AttributeBaseImage:   parsed.baseImage,
+		SplitPackageTypes:    parsed.packageTypes,
+		AttributeLayers:      parsed.layers,
+		ListVulnerabilities:  parsed.resolved,
+		ResolveRevision:      config.exporterEnabled("github"),
+		AuthorizationDecoder: sts.New(sess),
+	}
+	var sources []api.NamedSource
+	for _, name := range config.findingsSources() {
+		named := api.NamedSource{Name: name}
+		switch name {
+		case api.FindingsSourceInspector2:
+			named.Source = api.NewInspector2Source(inspector2.New(sess))
+		case api.FindingsSourceTrivyS3:
+			source, err := api.NewTrivyS3Source(config.findingsURI, s3.New(sess))
+			if err != nil {
+				return errorResponse(err), err
+			}
+			named.Source = source
+		}
+		sources = append(sources, named)
+	}
+	// Findings of a single source aren't merged, ECR is read with the client of each registry
+	if len(sources) > 1 {
+		options.FindingsSource = api.NewMergedSource(sources...)
+	} else if len(sources) == 1 && sources[0].Source != nil {
+		options.FindingsSource = sources[0].Source
+	}
+
+	weights := make(map[string]int)
+	for k, v := range parsed.weights {
+		weights[k] = v
+	}
+	if file != nil {
+		for k, v := range file.Thresholds.Weights {
+			weights[k] = v
+		}
+	}
+
+	if options.Weights, err = severity.NewWeights(weights); err != nil {
+		return errorResponse(err), err
+	}
+
+	if file != nil {
+		for _, o := range file.Thresholds.Overrides {
+			options.SeverityOverrides = append(options.SeverityOverrides, api.SeverityOverride{
+				Pattern:         o.Repository,
+				MinimumSeverity: o.MinimumSeverity,
+			})
+		}
+	}
+
+	now := time.Now().In(parsed.presentation.Location)
+
+	var lock, dedup *api.LockService
+	if config.lockTable != "" {
+		client := dynamodb.New(sess)
+		lock = api.NewLockService(config.lockTable, parsed.lockTTL, client)
+		if parsed.dedupWindow > 0 {
+			dedup = api.NewLockService(config.lockTable, parsed.dedupWindow, client)
+		}
+	}
+
+	if parsed.repoCacheTTL > 0 {
+		options.RepositoryCache = repositoryCache(config.repoCacheTable, parsed.repoCacheTTL, sess)
+	}
+
+	options.PackageFilters = append([]api.PackageFilter{}, parsed.packageFilters...)
+	if file != nil {
+		options.Snoozes = file.SnoozeList()
+		options.PackageFilters = append(options.PackageFilters, file.PackageFilterList()...)
+	}
+	if config.snoozeTable != "" {
+		stored, err := api.NewSnoozeStore(config.snoozeTable, dynamodb.New(sess)).List()
+		if err != nil {
+			return errorResponse(err), err
+		}
+		options.Snoozes = append(options.Snoozes, stored...)
+	}
+
+	exporters, err := cachedExporters(config, sess, logger)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	var teams []team
+	if file != nil {
+		for _, t := range file.Routes() {
+			teamConfig := teamSettings(config, t.Notifiers)
+
+			teamExporters, err := cachedExporters(teamConfig, sess, logger)
+			if err != nil {
+				return errorResponse(err), err
+			}
+			teams = append(teams, team{Team: t, exporters: teamExporters})
+		}
+	}
+
+	var public *api.ECRPublicService
+	if parsed.includePublic {
+		publicSess, err := api.CachedSession(api.SessionConfig{Region: api.ECRPublicRegion, FIPS: connection.fips, DualStack: connection.dualStack, Endpoint: config.endpoint, HTTP: connection.http})
+		if err != nil {
+			return errorResponse(err), err
+		}
+		public = api.NewECRPublicService(config.ecrID, ecrpublic.New(publicSess))
+	}
+
+	var checkpoints *api.CheckpointStore
+	var invoker *api.InvokeService
+	var checkpointMargin time.Duration
+	if config.checkpointURI != "" || parsed.rerunInterval > 0 {
+		invoker = api.NewInvokeService(os.Getenv("AWS_LAMBDA_FUNCTION_NAME"), awslambda.New(sess))
+	}
+	if config.checkpointURI != "" {
+		checkpoints, err = api.NewCheckpointStore(config.checkpointURI, s3.New(sess))
+		if err != nil {
+			return errorResponse(err), err
+		}
+		checkpointMargin = parsed.checkpointMargin
+	}
+
+	var registries []registryClient
+	for _, r := range parsed.registries {
+		registrySess := sess
+		if r.RoleARN != "" {
+			registrySess = roleSession(sess, r.RoleARN)
+		}
+		registries = append(registries, registryClient{id: r.ID, alias: parsed.accountAliases[r.ID], client: ecrClient(registrySess, parsed.rateLimit, parsed.ecrCallTimeout)})
+	}
+
+	scan := scanner.Options{
+		Client:            ecrClient(sess, parsed.rateLimit, parsed.ecrCallTimeout),
+		RegistryID:        config.ecrID,
+		Region:            config.region,
+		ImageTag:          config.imageTag,
+		MinimumSeverity:   config.minimumSeverity,
+		EnforceScanOnPush: enforceScanPush,
+		Workers:           parsed.workers,
+		PullThroughCache:  config.pullThrough,
+		SkipEmpty:         config.emptyRepos == "skip",
+		FailFast:          config.failureMode == failureModeFailFast,
+		MaxRepositories:   parsed.maxRepos,
+		Public:            public,
+		Service:           options,
+		Logger:            logger,
+	}
+	if file != nil {
+		scan.Selected = file.Selected
+	}
+
+	var eventsService *api.EventsService
+	if config.eventBus != "" {
+		eventsService = api.NewEventsService(config.eventBus, eventSource, eventbridge.New(sess))
+	}
+
+	var history *api.HistoryStore
+	if config.historyURI != "" {
+		history, err = api.NewHistoryStore(config.historyURI, s3.New(sess))
+		if err != nil {
+			return errorResponse(err), err
+		}
+	}
+
+	var responses *api.ResponseStore
+	if config.responseURI != "" {
+		responses, err = api.NewResponseStore(config.responseURI, parsed.responseTTL, s3.New(sess))
+		if err != nil {
+			return errorResponse(err), err
+		}
+	}
+
+	var fallbackQueue *api.SQSService
+	if config.slack.fallbackQueueURL != "" {
+		fallbackQueue = api.NewSQSService(config.slack.fallbackQueueURL, sqs.New(sess))
+	}
+
+	app := app{
+		checkpoints:         checkpoints,
+		checkpointMargin:    checkpointMargin,
+		deadlineMargin:      parsed.deadlineMargin,
+		dedup:               dedup,
+		delivery:            parsed.delivery,
+		digestDays:          parsed.digestDays,
+		escalationDays:      parsed.escalationDays,
+		graceDays:           parsed.graceDays,
+		resolved:            parsed.resolved,
+		responses:           responses,
+		digestSLA:           parsed.digestSLA,
+		dryRun:              parsed.dryRun,
+		env:                 config.env,
+		events:              eventsService,
+		exporters:           exporters,
+		fallbackQueue:       fallbackQueue,
+		failureMode:         config.failureMode,
+		failureThreshold:    parsed.failureThreshold,
+		gate:                parsed.gate,
+		gateStatus:          parsed.gateStatus,
+		file:                file,
+		history:             history,
+		invoker:             invoker,
+		lock:                lock,
+		logger:              logger,
+		mode:                config.mode,
+		region:              config.region,
+		registries:          registries,
+		presentation:        parsed.presentation,
+		reportDate:          now.Format("2006-01-02"),
+		reportTime:          now,
+		runID:               runID,
+		scan:                scan,
+		rerunInterval:       parsed.rerunInterval,
+		rerunJitter:         parsed.rerunJitter,
+		rerunMaxIterations:  parsed.rerunMaxIterations,
+		rerunInProgress:     parsed.rerunInProgress,
+		snoozeReminder:      parsed.snoozeReminder,
+		suppressionReminder: parsed.suppressionReminder,
+		teams:               teams,
+	}
+	return app.Handle(ctx, request), nil
+}
+
+func main() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(terminated)
+	}()
+
 	lambda.Start(Handler)
 }
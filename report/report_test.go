@@ -0,0 +1,914 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	awslambda "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/configfile"
+	exp "github.com/nagypeterjob/ecr-scan-lambda/pkg/exporters"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/notify"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/scanner"
+	"github.com/nagypeterjob/ecr-scan-lambda/pkg/testutil"
+)
+
+func testApp(t *testing.T, client *testutil.ECR, notifier *testutil.Notifier) *app {
+	logger, err := logger.NewLogger("ERROR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &app{
+		exporters: []notify.Notifier{notifier},
+		logger:    logger,
+		mode:      modeDaily,
+		scan: scanner.Options{
+			Client:          client,
+			Region:          "us-east-1",
+			ImageTag:        "latest",
+			MinimumSeverity: "HIGH",
+			Workers:         2,
+			Logger:          logger,
+		},
+	}
+}
+
+func registry() *testutil.ECR {
+	return &testutil.ECR{
+		Repositories: []*ecr.Repository{
+			testutil.Repository("payments/api"),
+			testutil.Repository("search/indexer"),
+		},
+		Findings: map[string]map[string]int64{
+			"payments/api":   {"CRITICAL": 1},
+			"search/indexer": {"HIGH": 4},
+		},
+	}
+}
+
+func TestHandle(t *testing.T) {
+	notifier := &testutil.Notifier{}
+	a := testApp(t, registry(), notifier)
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandle expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(notifier.Sent) != 1 || len(notifier.Sent[0].Filtered) != 2 {
+		t.Fatalf("TestHandle expected one report with 2 repositories, got: %v", notifier.Sent)
+	}
+}
+
+func TestHandleTeamsAndSuppressions(t *testing.T) {
+	notifier := &testutil.Notifier{}
+	teamNotifier := &testutil.Notifier{}
+	a := testApp(t, registry(), notifier)
+	a.file = &configfile.File{
+		Suppressions: []configfile.Suppression{{Repository: "search/*", Reason: "accepted risk"}},
+	}
+	a.teams = []team{{
+		Team:      configfile.Team{Name: "payments", Repositories: []string{"payments/*"}},
+		exporters: []notify.Notifier{teamNotifier},
+	}}
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleTeamsAndSuppressions expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(notifier.Sent) != 1 || len(notifier.Sent[0].Filtered) != 1 {
+		t.Fatalf("TestHandleTeamsAndSuppressions expected search/indexer to be suppressed, got: %v", notifier.Sent)
+	}
+	if len(teamNotifier.Sent) != 1 || teamNotifier.Sent[0].Filtered[0].Name != "payments/api" {
+		t.Fatalf("TestHandleTeamsAndSuppressions expected team to receive payments/api, got: %v", teamNotifier.Sent)
+	}
+}
+
+func TestHandleTeamsByGroup(t *testing.T) {
+	notifier := &testutil.Notifier{}
+	teamNotifier := &testutil.Notifier{}
+	client := registry()
+	client.Tags = map[string]map[string]string{"search/indexer": {"owner": "payments"}}
+	a := testApp(t, client, notifier)
+	a.scan.Service.GroupTag = "owner"
+	a.teams = []team{{
+		Team:      configfile.Team{Name: "payments", Repositories: []string{"payments/*"}, Groups: []string{"payments"}},
+		exporters: []notify.Notifier{teamNotifier},
+	}}
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleTeamsByGroup expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(teamNotifier.Sent) != 1 || len(teamNotifier.Sent[0].Filtered) != 2 {
+		t.Fatalf("TestHandleTeamsByGroup expected team to receive payments/api and search/indexer, got: %v", teamNotifier.Sent)
+	}
+}
+
+// loggingNotifier notes the logger it was given to send under
+type loggingNotifier struct {
+	testutil.Notifier
+	logger *logger.Logger
+}
+
+func (n *loggingNotifier) SetLogger(l *logger.Logger) {
+	n.logger = l
+}
+
+func TestHandleRunLogger(t *testing.T) {
+	notifier := &loggingNotifier{}
+	a := testApp(t, registry(), nil)
+	a.exporters = []notify.Notifier{exp.Redacted(notifier, exp.ParseRedactor("payments/*", ""))}
+
+	// Exporters are cached, each run hands them its own logger
+	for _, runID := range []string{"run-1", "run-2"} {
+		a.logger = a.scan.Logger.WithField("run_id", runID)
+		if response := a.Handle(context.Background(), events.APIGatewayProxyRequest{}); response.StatusCode != 200 {
+			t.Fatalf("TestHandleRunLogger expected status 200, got: %d %s", response.StatusCode, response.Body)
+		}
+		if notifier.logger != a.logger {
+			t.Fatalf("TestHandleRunLogger expected the exporter to log under the logger of %s", runID)
+		}
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	cases := []struct {
+		client   *testutil.ECR
+		notifier *testutil.Notifier
+	}{
+		{client: &testutil.ECR{DescribeErr: fmt.Errorf("AccessDeniedException")}, notifier: &testutil.Notifier{}},
+		{client: registry(), notifier: &testutil.Notifier{SendErr: fmt.Errorf("channel_not_found")}},
+	}
+
+	for i, c := range cases {
+		response := testApp(t, c.client, c.notifier).Handle(context.Background(), events.APIGatewayProxyRequest{})
+		if response.StatusCode != 500 {
+			t.Fatalf("[%d] TestHandleErrors expected status 500, got: %d", i, response.StatusCode)
+		}
+	}
+}
+
+// mockLocks holds the lock keys taken, none of them expire
+type mockLocks struct {
+	dynamodbiface.DynamoDBAPI
+	keys map[string]bool
+}
+
+func (m *mockLocks) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	key := aws.StringValue(input.Item["LockKey"].S)
+	if m.keys[key] {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	m.keys[key] = true
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockLocks) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	delete(m.keys, aws.StringValue(input.Key["LockKey"].S))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestHandleLocksAfterFailure(t *testing.T) {
+	// Nothing was sent, the next attempt sends the report
+	locks := &mockLocks{keys: map[string]bool{}}
+	a := testApp(t, registry(), &testutil.Notifier{SendErr: fmt.Errorf("channel_not_found")})
+	a.lock = api.NewLockService("ecr-scan-locks", time.Hour, locks)
+	if response := a.Handle(context.Background(), events.APIGatewayProxyRequest{}); response.StatusCode != 500 {
+		t.Fatalf("Expected status 500, got: %d", response.StatusCode)
+	}
+	if len(locks.keys) != 0 {
+		t.Fatalf("Expected the lock to be released, got: %v", locks.keys)
+	}
+
+	// A notifier sent, the next attempt doesn't send the report to it again
+	sent := &testutil.Notifier{NotifierName: "slack"}
+	a = testApp(t, registry(), sent)
+	a.exporters = append(a.exporters, &testutil.Notifier{NotifierName: "sns", SendErr: fmt.Errorf("NotFound")})
+	a.lock = api.NewLockService("ecr-scan-locks", time.Hour, locks)
+	if response := a.Handle(context.Background(), events.APIGatewayProxyRequest{}); response.StatusCode != 500 {
+		t.Fatalf("Expected status 500, got: %d", response.StatusCode)
+	}
+	if response := a.Handle(context.Background(), events.APIGatewayProxyRequest{}); response.StatusCode != 200 {
+		t.Fatalf("Expected the retry to skip the report, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(sent.Sent) != 1 {
+		t.Fatalf("Expected a single report sent, got: %d", len(sent.Sent))
+	}
+}
+
+type mockS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (m *mockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	body, err := ioutil.ReadAll(input.Body)
+	m.objects[*input.Key] = body
+	return &s3.PutObjectOutput{}, err
+}
+
+func (m *mockS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(m.objects[*input.Key]))}, nil
+}
+
+func (m *mockS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	delete(m.objects, *input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *mockS3) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	output := &s3.ListObjectsV2Output{}
+	for key := range m.objects {
+		output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	fn(output, true)
+	return nil
+}
+
+// GetObjectRequest builds the request with a real client, presigning doesn't send it
+func (m *mockS3) GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	return s3.New(sess).GetObjectRequest(input)
+}
+
+func TestHandleOffload(t *testing.T) {
+	client := &mockS3{objects: map[string][]byte{}}
+	responses, err := api.NewResponseStore("s3://bucket/responses", time.Hour, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testApp(t, registry(), &testutil.Notifier{})
+	a.runID = "run-1"
+	a.responses = responses
+
+	// Summaries within the limit are returned as is
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 || response.Headers["Location"] != "" || len(client.objects) != 0 {
+		t.Fatalf("TestHandleOffload expected the summary in the response, got: %d %s", response.StatusCode, response.Body)
+	}
+
+	a.responseLimit = 100
+	response = a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleOffload expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	var offloaded offloadedResponse
+	if err := json.Unmarshal([]byte(response.Body), &offloaded); err != nil {
+		t.Fatalf("TestHandleOffload expected the offloaded response, got: %s", response.Body)
+	}
+	stored := client.objects["responses/run-1.json"]
+	if offloaded.Bytes != len(stored) || !strings.Contains(string(stored), `"run_id":"run-1"`) {
+		t.Fatalf("TestHandleOffload expected the summary to be stored, got: %+v %s", offloaded, stored)
+	}
+	if offloaded.URL == "" || response.Headers["Location"] != offloaded.URL || offloaded.Status != 200 {
+		t.Fatalf("TestHandleOffload expected a presigned URL of the summary, got: %+v %v", offloaded, response.Headers)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	cases := []struct {
+		headers  map[string]string
+		multi    map[string][]string
+		expected bool
+	}{
+		{headers: map[string]string{"Accept-Encoding": "gzip, deflate, br"}, expected: true},
+		{headers: map[string]string{"accept-encoding": "br;q=1.0, gzip;q=0.8"}, expected: true},
+		{multi: map[string][]string{"Accept-Encoding": {"deflate", "GZIP"}}, expected: true},
+		{headers: map[string]string{"Accept-Encoding": "gzip;q=0"}},
+		{headers: map[string]string{"Accept-Encoding": "identity"}},
+		{headers: map[string]string{"Accept-Encoding": "x-gzip"}, expected: true},
+		{headers: map[string]string{"Accept-Encoding": "*"}, expected: true},
+		{headers: map[string]string{"Accept-Encoding": "br, *;q=0.1"}, expected: true},
+		{headers: map[string]string{"Accept-Encoding": "*;q=0"}},
+		{headers: map[string]string{"Accept-Encoding": "gzip;q=0, *"}},
+		{headers: map[string]string{"Accept-Encoding": "gzip;q=0.5, *;q=0"}, expected: true},
+		{headers: map[string]string{"Accept-Encoding": "x-gzip;q=0, gzip"}, expected: true},
+		{headers: map[string]string{"Accept-Encoding": "gzip;q=oops"}},
+		{},
+	}
+	for i, c := range cases {
+		request := events.APIGatewayProxyRequest{Headers: c.headers, MultiValueHeaders: c.multi}
+		if accepted := acceptsGzip(request); accepted != c.expected {
+			t.Fatalf("[%d] values are not equal, wanting: %t, got: %t", i, c.expected, accepted)
+		}
+	}
+}
+
+func TestHandleGzip(t *testing.T) {
+	a := testApp(t, registry(), &testutil.Notifier{})
+	a.runID = "run-1"
+
+	request := events.APIGatewayProxyRequest{Headers: map[string]string{"Accept-Encoding": "gzip"}}
+	response := a.Handle(context.Background(), request)
+	if response.StatusCode != 200 || !response.IsBase64Encoded || response.Headers["Content-Encoding"] != "gzip" || response.Headers["Content-Type"] != "application/json" {
+		t.Fatalf("TestHandleGzip expected a compressed summary, got: %d %v", response.StatusCode, response.Headers)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(body), `{"run_id":"run-1"`) {
+		t.Fatalf("TestHandleGzip expected the summary, got: %s", body)
+	}
+
+	// Callers not accepting gzip get the summary as is
+	response = a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.IsBase64Encoded || !strings.HasPrefix(response.Body, `{"run_id":"run-1"`) {
+		t.Fatalf("TestHandleGzip expected the summary uncompressed, got: %s", response.Body)
+	}
+}
+
+func TestHandleDigest(t *testing.T) {
+	client := &mockS3{objects: map[string][]byte{}}
+	history, err := api.NewHistoryStore("s3://bucket/history", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = history.Save(time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), &api.Report{Filtered: []*api.RepositoryInfo{{Name: "payments/api"}, {Name: "legacy/app"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &testutil.Notifier{}
+	a := testApp(t, registry(), notifier)
+	a.history = history
+	a.digestDays = 7
+	a.reportDate = "2020-07-03"
+
+	// Daily runs store their report for the digest
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleDigest expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if _, ok := client.objects["history/2020-07-03.json"]; !ok {
+		t.Fatalf("TestHandleDigest expected the report to be stored, got: %v", client.objects)
+	}
+
+	response = a.Handle(context.Background(), events.APIGatewayProxyRequest{Body: `{"mode":"digest"}`})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleDigest expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(notifier.Sent) != 1 || len(notifier.Digests) != 1 {
+		t.Fatalf("TestHandleDigest expected a report and a digest, got: %d %d", len(notifier.Sent), len(notifier.Digests))
+	}
+	digest := notifier.Digests[0]
+	if len(digest.Trend) != 2 || len(digest.New) != 1 || digest.New[0].Name != "search/indexer" || len(digest.Resolved) != 1 || digest.Resolved[0].Name != "legacy/app" {
+		t.Fatalf("TestHandleDigest unexpected digest: %+v", digest)
+	}
+
+	response = a.Handle(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"mode": "weekly"}})
+	if response.StatusCode != 500 {
+		t.Fatalf("TestHandleDigest expected status 500 for an unknown mode, got: %d", response.StatusCode)
+	}
+}
+
+func TestHandleInventory(t *testing.T) {
+	client := registry()
+	client.Repositories = append(client.Repositories, testutil.Repository("legacy/app"))
+	notifier := &testutil.Notifier{}
+	a := testApp(t, client, notifier)
+	a.registries = []registryClient{{id: "123456789012", alias: "prod", client: client}, {id: "210987654321", client: client}}
+	a.region = "us-east-1"
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"mode": "inventory"}})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleInventory expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(notifier.Sent) != 0 || len(notifier.Inventories) != 1 {
+		t.Fatalf("TestHandleInventory expected an inventory only, got: %d %d", len(notifier.Sent), len(notifier.Inventories))
+	}
+	inventory := notifier.Inventories[0]
+	if len(inventory.Registries) != 2 || inventory.Registries[0].Account != "prod/us-east-1" || inventory.Registries[1].Account != "210987654321/us-east-1" {
+		t.Fatalf("TestHandleInventory expected an inventory of each registry, got: %+v", inventory.Registries)
+	}
+	total := inventory.Total()
+	if total.Repositories != 6 || total.CoveredRepositories != 6 || total.Images != 6 || total.ScannedImages != 4 {
+		t.Fatalf("TestHandleInventory unexpected total: %+v", total)
+	}
+}
+
+func TestHandleAge(t *testing.T) {
+	client := &mockS3{objects: map[string][]byte{}}
+	history, err := api.NewHistoryStore("s3://bucket/history", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range []int{1, 2} {
+		err = history.Save(time.Date(2020, 7, day, 0, 0, 0, 0, time.UTC), &api.Report{Filtered: []*api.RepositoryInfo{{Name: "payments/api"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notifier := &testutil.Notifier{}
+	a := testApp(t, registry(), notifier)
+	a.history = history
+	a.graceDays = 2
+	a.escalationDays = 2
+	a.reportDate = "2020-07-03"
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleAge expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	sent := notifier.Sent[0]
+	if len(sent.Filtered) != 1 || sent.Filtered[0].Name != "payments/api" || !sent.Filtered[0].Overdue {
+		t.Fatalf("TestHandleAge expected payments/api to be reported overdue, got: %+v", sent.Filtered)
+	}
+	if len(sent.Pending) != 1 || sent.Pending[0].Name != "search/indexer" {
+		t.Fatalf("TestHandleAge expected search/indexer to be pending, got: %+v", sent.Pending)
+	}
+}
+
+func TestHandleResume(t *testing.T) {
+	client := &mockS3{objects: map[string][]byte{}}
+	checkpoints, err := api.NewCheckpointStore("s3://bucket/checkpoints", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkpoints.Save("run", &api.Checkpoint{
+		Processed:   []string{"payments/api"},
+		Report:      &api.Report{ScanType: "BASIC", Filtered: []*api.RepositoryInfo{{Name: "payments/api"}}},
+		Invocations: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &testutil.Notifier{}
+	a := testApp(t, registry(), notifier)
+	a.checkpoints = checkpoints
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{Body: `{"resumeToken":"run"}`})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleResume expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	// payments/api comes from the checkpoint, search/indexer from this invocation
+	if len(notifier.Sent) != 1 || len(notifier.Sent[0].Filtered) != 2 {
+		t.Fatalf("TestHandleResume expected one merged report with 2 repositories, got: %v", notifier.Sent)
+	}
+	if len(client.objects) != 0 {
+		t.Fatalf("TestHandleResume expected the checkpoint to be deleted")
+	}
+}
+
+func TestHandleFailureMode(t *testing.T) {
+	cases := []struct {
+		mode      string
+		threshold float64
+		status    int
+		sent      int
+	}{
+		{mode: failureModeContinue, status: 200, sent: 1},
+		// 1 of 2 repositories failed
+		{mode: failureModeThreshold, threshold: 60, status: 200, sent: 1},
+		{mode: failureModeThreshold, threshold: 40, status: 500, sent: 1},
+		{mode: failureModeFailFast, status: 500, sent: 0},
+	}
+
+	for i, c := range cases {
+		client := registry()
+		client.FindingsErr = map[string]error{"search/indexer": fmt.Errorf("ThrottlingException")}
+		notifier := &testutil.Notifier{}
+
+		a := testApp(t, client, notifier)
+		a.failureMode = c.mode
+		a.failureThreshold = c.threshold
+		a.scan.FailFast = c.mode == failureModeFailFast
+
+		response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+		if response.StatusCode != c.status || len(notifier.Sent) != c.sent {
+			t.Fatalf("[%d] TestHandleFailureMode expected status %d with %d reports sent, got: %d with %d", i, c.status, c.sent, response.StatusCode, len(notifier.Sent))
+		}
+	}
+}
+
+func TestHandleGate(t *testing.T) {
+	clean := registry()
+	clean.Findings = nil
+
+	cases := []struct {
+		client       *testutil.ECR
+		notifier     *testutil.Notifier
+		status       int
+		repositories []string
+	}{
+		{client: registry(), notifier: &testutil.Notifier{}, status: 409, repositories: []string{"payments/api", "search/indexer"}},
+		{client: clean, notifier: &testutil.Notifier{}, status: 200, repositories: []string{}},
+		// Operational failures take precedence
+		{client: registry(), notifier: &testutil.Notifier{SendErr: fmt.Errorf("channel_not_found")}, status: 500},
+	}
+
+	for i, c := range cases {
+		a := testApp(t, c.client, c.notifier)
+		a.gate = true
+		a.gateStatus = 409
+
+		response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+		if response.StatusCode != c.status {
+			t.Fatalf("[%d] TestHandleGate expected status %d, got: %d %s", i, c.status, response.StatusCode, response.Body)
+		}
+		if c.status == 500 {
+			continue
+		}
+		var summary runSummary
+		if err := json.Unmarshal([]byte(response.Body), &summary); err != nil {
+			t.Fatalf("[%d] TestHandleGate expected the run summary, got: %s", i, response.Body)
+		}
+		if summary.Gate == nil || summary.Gate.Passed != (c.status == 200) || strings.Join(summary.Gate.Repositories, ",") != strings.Join(c.repositories, ",") {
+			t.Fatalf("[%d] TestHandleGate unexpected gate outcome: %s", i, response.Body)
+		}
+	}
+}
+
+type mockSQS struct {
+	sqsiface.SQSAPI
+	bodies []string
+}
+
+func (m *mockSQS) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	out := &sqs.ReceiveMessageOutput{}
+	for i, body := range m.bodies {
+		out.Messages = append(out.Messages, &sqs.Message{Body: aws.String(body), ReceiptHandle: aws.String(fmt.Sprint(i))})
+	}
+	return out, nil
+}
+
+func (m *mockSQS) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	m.bodies = m.bodies[1:]
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestHandleReplay(t *testing.T) {
+	queue := &mockSQS{bodies: []string{
+		`{"channel":"#ecr-scan","messages":[[{"type":"divider"}],[{"type":"divider"}]]}`,
+	}}
+	slackClient := &testutil.Slack{}
+	a := testApp(t, registry(), &testutil.Notifier{})
+	a.exporters = append(a.exporters, exp.NewSlackExporterWithClient("slack", slackClient, "#ecr-scan"))
+	a.fallbackQueue = api.NewSQSService("https://sqs.us-east-1.amazonaws.com/123456789012/slack-fallback", queue)
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleReplay expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(queue.bodies) != 0 {
+		t.Fatalf("TestHandleReplay expected the queue to be flushed, got: %v", queue.bodies)
+	}
+	// 2 replayed messages, then the report: head, 2 repositories
+	if slackClient.Posted["#ecr-scan"] != 5 {
+		t.Fatalf("TestHandleReplay expected 5 messages, got: %d", slackClient.Posted["#ecr-scan"])
+	}
+}
+
+type mockEventBridge struct {
+	eventbridgeiface.EventBridgeAPI
+	entries []*eventbridge.PutEventsRequestEntry
+}
+
+func (m *mockEventBridge) PutEvents(input *eventbridge.PutEventsInput) (*eventbridge.PutEventsOutput, error) {
+	m.entries = append(m.entries, input.Entries...)
+	return &eventbridge.PutEventsOutput{FailedEntryCount: aws.Int64(0)}, nil
+}
+
+func TestHandleEvents(t *testing.T) {
+	cases := []struct {
+		notifier   *testutil.Notifier
+		detailType string
+		detail     string
+	}{
+		{
+			notifier:   &testutil.Notifier{},
+			detailType: "ecr-scan.run.completed",
+			detail:     `{"env":"production","region":"us-east-1","status":200,"summary":{"scanned":2,"vulnerable":2,"pullThroughCache":0,"failed":0,"empty":0,"notScanned":0,"scanOnPushDisabled":0,"notCovered":0,"public":0,"stale":0,"untagged":0,"noLifecyclePolicy":0,"notProcessed":0,"interrupted":false,"findings":{"CRITICAL":1,"HIGH":4},"run_id":"1a2b3c4d","fingerprint":"25602e00146a"}}`,
+		},
+		{
+			notifier:   &testutil.Notifier{SendErr: fmt.Errorf("channel_not_found")},
+			detailType: "ecr-scan.run.failed",
+			detail:     `{"env":"production","region":"us-east-1","status":500,"error":"fake: channel_not_found","summary":{"scanned":2,"vulnerable":2,"pullThroughCache":0,"failed":0,"empty":0,"notScanned":0,"scanOnPushDisabled":0,"notCovered":0,"public":0,"stale":0,"untagged":0,"noLifecyclePolicy":0,"notProcessed":0,"interrupted":false,"findings":{"CRITICAL":1,"HIGH":4},"run_id":"1a2b3c4d","fingerprint":"25602e00146a"}}`,
+		},
+	}
+
+	for i, c := range cases {
+		client := &mockEventBridge{}
+		a := testApp(t, registry(), c.notifier)
+		a.env = "production"
+		a.region = "us-east-1"
+		a.runID = "1a2b3c4d"
+		a.events = api.NewEventsService("default", eventSource, client)
+
+		a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+		if len(client.entries) != 1 {
+			t.Fatalf("[%d] TestHandleEvents expected one event, got: %d", i, len(client.entries))
+		}
+		if *client.entries[0].DetailType != c.detailType || *client.entries[0].Detail != c.detail {
+			t.Fatalf("[%d] TestHandleEvents expected %s %s, got: %s %s", i, c.detailType, c.detail, *client.entries[0].DetailType, *client.entries[0].Detail)
+		}
+	}
+}
+
+func TestHandleSummary(t *testing.T) {
+	a := testApp(t, registry(), &testutil.Notifier{})
+	a.runID = "1a2b3c4d"
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 || response.Headers["Content-Type"] != "application/json" {
+		t.Fatalf("TestHandleSummary expected a JSON response, got: %d %v", response.StatusCode, response.Headers)
+	}
+	var summary runSummary
+	if err := json.Unmarshal([]byte(response.Body), &summary); err != nil {
+		t.Fatalf("TestHandleSummary unexpected error: %s", err)
+	}
+	if summary.RunID != "1a2b3c4d" || summary.Mode != modeDaily || summary.Status != 200 || summary.Listed != 2 {
+		t.Fatalf("TestHandleSummary unexpected summary: %s", response.Body)
+	}
+	if summary.Report == nil || summary.Report.Scanned != 2 || summary.Report.Findings["HIGH"] != 4 {
+		t.Fatalf("TestHandleSummary expected the numbers of the report, got: %s", response.Body)
+	}
+	if len(summary.Notifiers) != 1 || summary.Notifiers[0].Notifier != "fake" || summary.Notifiers[0].Status != notify.OutcomeSent {
+		t.Fatalf("TestHandleSummary expected the fake notifier to have sent, got: %s", response.Body)
+	}
+	for _, phase := range []string{"scan", "send", "total"} {
+		if _, ok := summary.Durations[phase]; !ok {
+			t.Fatalf("TestHandleSummary expected the duration of %s, got: %s", phase, response.Body)
+		}
+	}
+
+	// Dry runs return the would-be messages
+	a.dryRun = true
+	if response := a.Handle(context.Background(), events.APIGatewayProxyRequest{}); strings.HasPrefix(response.Body, "{") {
+		t.Fatalf("TestHandleSummary expected the messages of the dry run, got: %s", response.Body)
+	}
+}
+
+func TestHandleRegistries(t *testing.T) {
+	other := &testutil.ECR{
+		Repositories: []*ecr.Repository{testutil.Repository("payments/api"), testutil.Repository("billing/worker")},
+		Findings: map[string]map[string]int64{
+			"payments/api":   {"HIGH": 2},
+			"billing/worker": {"CRITICAL": 3},
+		},
+	}
+	notifier := &testutil.Notifier{}
+	a := testApp(t, nil, notifier)
+	a.registries = []registryClient{{id: "111111111111", alias: "prod", client: registry()}, {id: "222222222222", client: other}}
+	a.region = "us-east-1"
+
+	var mu sync.Mutex
+	var gathered []string
+	a.scan.Selected = func(name string) bool {
+		return name != "222222222222/billing/worker"
+	}
+	a.scan.Service.Gathered = func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		gathered = append(gathered, name)
+	}
+
+	response := a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleRegistries expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if r := notifier.Sent[0]; r.Scanned != 3 || len(r.Filtered) != 3 {
+		t.Fatalf("TestHandleRegistries expected the repositories of both registries, got: %d %+v", r.Scanned, r.Filtered)
+	}
+	if len(gathered) != 3 || !strings.HasPrefix(gathered[0], "111111111111/") || !strings.HasPrefix(gathered[2], "222222222222/") {
+		t.Fatalf("TestHandleRegistries expected repositories to be told apart by registry, got: %v", gathered)
+	}
+	accounts := make(map[string]string)
+	for _, r := range notifier.Sent[0].Filtered {
+		accounts[r.Name] = r.Account
+	}
+	if accounts["payments/api"] != "222222222222/us-east-1" {
+		t.Fatalf("TestHandleRegistries expected repositories to be labelled with their account, got: %v", accounts)
+	}
+	for name, account := range accounts {
+		if name != "payments/api" && account != "prod/us-east-1" {
+			t.Fatalf("TestHandleRegistries expected %s to be labelled with the alias of its account, got: %s", name, account)
+		}
+	}
+}
+
+func TestCachedExporters(t *testing.T) {
+	logger, err := logger.NewLogger("ERROR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := validConfig()
+	c.exporters = "log"
+
+	first, err := cachedExporters(c, nil, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	second, _ := cachedExporters(c, nil, logger)
+	if len(first) != 1 || &first[0] != &second[0] {
+		t.Fatalf("Expected the exporters to be reused, got: %v, %v", first, second)
+	}
+
+	c.slack.channel = "#other"
+	if third, _ := cachedExporters(c, nil, logger); &third[0] == &first[0] {
+		t.Fatalf("Expected new exporters for a different configuration")
+	}
+}
+
+func TestInitExportersPresentation(t *testing.T) {
+	logger, err := logger.NewLogger("ERROR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := validConfig()
+	c.exporters = "log"
+	c.locale = "de"
+	c.groupNamespaces = "true"
+
+	exporters, err := initExporters(c, nil, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	log, ok := exporters[0].(*exp.LogExporter)
+	if !ok || log.Locale != "de" || !log.GroupByNamespace || log.Location != time.UTC {
+		t.Fatalf("Expected the exporter to follow the configured presentation, got: %+v", exporters[0])
+	}
+}
+
+func TestHandleDeadline(t *testing.T) {
+	notifier := &testutil.Notifier{}
+	a := testApp(t, registry(), notifier)
+	// The margin is longer than the time left, no repository is gathered
+	a.deadlineMargin = 2 * time.Minute
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelFunc()
+
+	response := a.Handle(ctx, events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleDeadline expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(notifier.Sent) != 1 || notifier.Sent[0].NotProcessed != 2 || len(notifier.Sent[0].Filtered) != 0 {
+		t.Fatalf("TestHandleDeadline expected a partial report with 2 repositories not processed, got: %+v", notifier.Sent)
+	}
+}
+
+func TestHandleCancelled(t *testing.T) {
+	notifier := &testutil.Notifier{}
+	checkpoints, err := api.NewCheckpointStore("s3://bucket/checkpoints", &mockS3{objects: map[string][]byte{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testApp(t, registry(), notifier)
+	a.checkpoints = checkpoints
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	cancelFunc()
+
+	// A cancelled invocation sends what it gathered instead of continuing in a new invocation
+	response := a.Handle(ctx, events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 {
+		t.Fatalf("TestHandleCancelled expected status 200, got: %d %s", response.StatusCode, response.Body)
+	}
+	if len(notifier.Sent) != 1 || !notifier.Sent[0].Interrupted {
+		t.Fatalf("TestHandleCancelled expected an interrupted report to be sent, got: %+v", notifier.Sent)
+	}
+}
+
+func TestInvocationRunID(t *testing.T) {
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "1a2b3c4d-5e6f-7a8b-9c0d-1e2f3a4b5c6d"})
+	if id := invocationRunID(ctx); id != "1a2b3c4d" {
+		t.Fatalf("values not equal, wanting: 1a2b3c4d, got: %s", id)
+	}
+	if id := invocationRunID(context.Background()); len(id) != 8 {
+		t.Fatalf("Expected a random run ID outside Lambda, got: %s", id)
+	}
+}
+
+func TestHandleRunID(t *testing.T) {
+	notifier := &testutil.Notifier{}
+	a := testApp(t, registry(), notifier)
+	a.runID = "1a2b3c4d"
+
+	a.Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if len(notifier.Sent) != 1 || notifier.Sent[0].RunID != "1a2b3c4d" {
+		t.Fatalf("TestHandleRunID expected the report to carry the run ID, got: %v", notifier.Sent)
+	}
+}
+
+type mockLambda struct {
+	lambdaiface.LambdaAPI
+	payloads []string
+}
+
+func (m *mockLambda) Invoke(input *awslambda.InvokeInput) (*awslambda.InvokeOutput, error) {
+	m.payloads = append(m.payloads, string(input.Payload))
+	return &awslambda.InvokeOutput{StatusCode: aws.Int64(202)}, nil
+}
+
+// invokedRerun returns the rerun the function invoked itself for
+func invokedRerun(t *testing.T, payload string) *rerun {
+	var request events.APIGatewayProxyRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		t.Fatal(err)
+	}
+	return rerunOf(request)
+}
+
+func TestHandleRerun(t *testing.T) {
+	client := registry()
+	client.InProgress = []string{"search/indexer"}
+	invoked := &mockLambda{}
+	rerunApp := func(notifier *testutil.Notifier) *app {
+		a := testApp(t, client, notifier)
+		a.invoker = api.NewInvokeService("ecr-scan-lambda", invoked)
+		a.rerunInterval = time.Hour
+		a.rerunMaxIterations = 2
+		a.rerunInProgress = true
+		return a
+	}
+
+	notifier := &testutil.Notifier{}
+	response := rerunApp(notifier).Handle(context.Background(), events.APIGatewayProxyRequest{})
+	if response.StatusCode != 200 || len(invoked.payloads) != 1 {
+		t.Fatalf("TestHandleRerun expected a rerun to be scheduled, got: %d %v", response.StatusCode, invoked.payloads)
+	}
+	next := invokedRerun(t, invoked.payloads[0])
+	if next.Iteration != 1 || !reflect.DeepEqual(next.Repositories, []string{"search/indexer"}) || time.Until(next.NotBefore) < 59*time.Minute {
+		t.Fatalf("TestHandleRerun expected search/indexer to be rechecked in an hour, got: %+v", next)
+	}
+
+	// The rerun only checks the repository whose scan was in progress
+	next.NotBefore = time.Now()
+	notifier = &testutil.Notifier{}
+	response = rerunApp(notifier).Handle(context.Background(), invocationRequest("", next))
+	if response.StatusCode != 200 || len(notifier.Sent) != 1 || notifier.Sent[0].Scanned != 1 {
+		t.Fatalf("TestHandleRerun expected a report of search/indexer, got: %d %+v", response.StatusCode, notifier.Sent)
+	}
+	if len(invoked.payloads) != 2 || invokedRerun(t, invoked.payloads[1]).Iteration != 2 {
+		t.Fatalf("TestHandleRerun expected the second rerun to be scheduled, got: %v", invoked.payloads)
+	}
+
+	// No more than RERUN_MAX_ITERATIONS
+	next.Iteration = 2
+	rerunApp(&testutil.Notifier{}).Handle(context.Background(), invocationRequest("", next))
+	if len(invoked.payloads) != 2 {
+		t.Fatalf("TestHandleRerun expected no third rerun, got: %v", invoked.payloads)
+	}
+}
+
+func TestHandleRerunHandOver(t *testing.T) {
+	invoked := &mockLambda{}
+	notifier := &testutil.Notifier{}
+	a := testApp(t, registry(), notifier)
+	a.invoker = api.NewInvokeService("ecr-scan-lambda", invoked)
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelFunc()
+
+	// Not due before the invocation times out, a new invocation keeps waiting
+	due := &rerun{Iteration: 1, NotBefore: time.Now().Add(time.Hour)}
+	response := a.Handle(ctx, invocationRequest("", due))
+	if response.StatusCode != 202 || len(notifier.Sent) != 0 {
+		t.Fatalf("TestHandleRerunHandOver expected to keep waiting, got: %d %+v", response.StatusCode, notifier.Sent)
+	}
+	if len(invoked.payloads) != 1 || !invokedRerun(t, invoked.payloads[0]).NotBefore.Equal(due.NotBefore) {
+		t.Fatalf("TestHandleRerunHandOver expected the rerun to be handed over, got: %v", invoked.payloads)
+	}
+}
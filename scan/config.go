@@ -7,16 +7,41 @@ import (
 
 // Config stores lambda configuration
 type config struct {
-	env        string
-	ecrID      string
-	imageTag   string
-	logLevel   string
-	numWorkers string
-	region     string
+	env         string
+	ecrID       string
+	imageTag    string
+	logLevel    string
+	dualStack   string
+	fips        string
+	endpoint    string
+	ecrEndpoint string
+	stsEndpoint string
+	s3Endpoint  string
+	httpTimeout string
+	httpIdle    string
+	proxyURL    string
+	ssmPath     string
+	ssmTTL      string
+	multiArch   string
+	maxImageAge string
+	numWorkers  string
+	pullThrough string
+	tagFilter   string
+	region      string
+}
+
+// parameters loaded from Parameter Store take precedence over environment variables
+var parameters map[string]string
+
+func lookup(key string) string {
+	if value, ok := parameters[key]; ok {
+		return value
+	}
+	return os.Getenv(key)
 }
 
 func retrive(key string, defaultValue string) string {
-	value := os.Getenv(key)
+	value := lookup(key)
 	if value == "" {
 		return defaultValue
 	}
@@ -25,7 +50,7 @@ func retrive(key string, defaultValue string) string {
 }
 
 func required(key string) (string, error) {
-	value := os.Getenv(key)
+	value := lookup(key)
 	if value == "" {
 		return value, fmt.Errorf("Required environtment variable %s is not set", key)
 	}
@@ -46,11 +71,26 @@ func initConfig() (config, error) {
 	}
 
 	return config{
-		env:        env,
-		region:     region,
-		ecrID:      retrive("ECR_ID", ""),
-		imageTag:   retrive("IMAGE_TAG", "latest"),
-		logLevel:   retrive("LOG_LEVEL", "INFO"),
-		numWorkers: retrive("NUM_WORKERS", "2"),
+		env:         env,
+		region:      region,
+		ecrID:       retrive("ECR_ID", ""),
+		imageTag:    retrive("IMAGE_TAG", "latest"),
+		logLevel:    retrive("LOG_LEVEL", "INFO"),
+		numWorkers:  retrive("NUM_WORKERS", "2"),
+		tagFilter:   retrive("REPOSITORY_TAG_FILTER", ""),
+		pullThrough: retrive("PULL_THROUGH_CACHE_REPOSITORIES", "include"),
+		multiArch:   retrive("RESOLVE_MANIFEST_LISTS", "false"),
+		maxImageAge: retrive("MAX_IMAGE_AGE", "0"),
+		fips:        retrive("AWS_USE_FIPS_ENDPOINT", "false"),
+		dualStack:   retrive("AWS_USE_DUALSTACK_ENDPOINT", "false"),
+		endpoint:    retrive("AWS_ENDPOINT_URL", ""),
+		ecrEndpoint: retrive("ECR_ENDPOINT", ""),
+		stsEndpoint: retrive("STS_ENDPOINT", ""),
+		s3Endpoint:  retrive("S3_ENDPOINT", ""),
+		httpTimeout: retrive("HTTP_TIMEOUT", "30s"),
+		httpIdle:    retrive("HTTP_MAX_IDLE_CONNS_PER_HOST", "10"),
+		proxyURL:    retrive("PROXY_URL", ""),
+		ssmPath:     os.Getenv("CONFIG_SSM_PATH"),
+		ssmTTL:      retrive("CONFIG_SSM_TTL", "5m"),
 	}, nil
 }
@@ -5,24 +5,41 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	api "github.com/nagypeterjob/ecr-scan-lambda/pkg/api"
 	"github.com/nagypeterjob/ecr-scan-lambda/pkg/logger"
 )
 
+// parameterStore outlives a single invocation, so parameters are cached between warm starts
+var parameterStore *api.ParameterStore
+
+// ecrClients outlive a single invocation, one per session
+var ecrClients = map[*session.Session]*ecr.ECR{}
+
+// ecrClient returns the ECR client of the session, creating it on first use
+func ecrClient(sess *session.Session) *ecr.ECR {
+	if _, ok := ecrClients[sess]; !ok {
+		ecrClients[sess] = ecr.New(sess)
+	}
+	return ecrClients[sess]
+}
+
 type app struct {
-	api        *api.ECRService
-	env        string
-	imageTag   string
-	logger     *logger.Logger
-	numWorkers int
-	region     string
+	api         *api.ECRService
+	env         string
+	imageTag    string
+	logger      *logger.Logger
+	multiArch   bool
+	numWorkers  int
+	pullThrough string
+	region      string
 }
 
 func errorResponse(err error) events.APIGatewayProxyResponse {
@@ -43,7 +60,7 @@ func (a *app) StartScan(in chan *api.ScanningResult, cancelFunc context.CancelFu
 					return
 				}
 
-				_, err := a.api.StartImageScan(r.Output.RepositoryName)
+				err := a.startImageScan(r.Output.RepositoryName)
 				a.logger.Infof("StartImageScan - (goroutine #%d) \n", i)
 				if err != nil {
 					if aerr, ok := err.(awserr.Error); ok {
@@ -67,16 +84,55 @@ func (a *app) StartScan(in chan *api.ScanningResult, cancelFunc context.CancelFu
 	return errc
 }
 
+// startImageScan triggers scan of the tagged image, or of each platform image when it is a manifest list.
+// Images pushed before MAX_IMAGE_AGE aren't scanned.
+func (a *app) startImageScan(repositoryName *string) error {
+	if a.api.ImageTooOld(repositoryName) {
+		a.logger.Infof("Skipping %s, its image was pushed more than MAX_IMAGE_AGE days ago\n", *repositoryName)
+		return nil
+	}
+
+	if a.multiArch {
+		platforms, err := a.api.ResolvePlatforms(repositoryName)
+		if err != nil {
+			return err
+		}
+		for _, p := range platforms {
+			if _, err := a.api.StartImageScanDigest(repositoryName, p.Digest); err != nil {
+				return err
+			}
+			a.logger.Infof("Scan started on %s (%s)\n", *repositoryName, p.Name)
+		}
+		if len(platforms) > 0 {
+			return nil
+		}
+	}
+
+	_, err := a.api.StartImageScan(repositoryName)
+	return err
+}
+
 func (a *app) Handle(request events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
 
+	// Manual scans are not supported with enhanced scanning, Amazon Inspector scans images continuously
+	if a.api.LoadRegistryScanningConfiguration() == ecr.ScanTypeEnhanced {
+		a.logger.Info("Registry uses enhanced scanning, skipping manual image scans")
+		return events.APIGatewayProxyResponse{StatusCode: 200}
+	}
+
 	// Load all ecr repositories into a channel
 	repositories, describeError := a.api.DescribeRepositoriesPages(ctx)
 
-	if err := <-describeError; err != nil {
-		cancelFunc()
-		fmt.Println(err)
+	// Pull through cache repositories hold upstream images, leave them alone if asked to
+	if a.pullThrough == "skip" {
+		if err := a.api.LoadPullThroughCacheRules(); err != nil {
+			a.logger.Errorf("Error describing pull through cache rules: %s", err.Error())
+		}
+		repositories = a.api.FilterRepositories(ctx, repositories, func(r *ecr.Repository) bool {
+			return !a.api.IsPullThroughCache(*r.RepositoryName)
+		})
 	}
 
 	// Enable image scanning ability on repositories
@@ -90,6 +146,11 @@ func (a *app) Handle(request events.APIGatewayProxyRequest) events.APIGatewayPro
 		fmt.Println(err)
 	}
 
+	// Sent once every repository has been listed
+	if err := <-describeError; err != nil {
+		fmt.Println(err)
+	}
+
 	return events.APIGatewayProxyResponse{StatusCode: 200}
 }
 
@@ -100,11 +161,56 @@ func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 		return errorResponse(err), err
 	}
 
-	sess, err := session.NewSession(&aws.Config{Region: &config.region})
+	fips, err := strconv.ParseBool(config.fips)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	dualStack, err := strconv.ParseBool(config.dualStack)
 	if err != nil {
 		return errorResponse(err), err
 	}
 
+	httpConfig, err := api.ParseHTTPConfig(config.httpTimeout, config.httpIdle, config.proxyURL)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	sess, err := api.CachedSession(api.SessionConfig{
+		Region:      config.region,
+		FIPS:        fips,
+		DualStack:   dualStack,
+		Endpoint:    config.endpoint,
+		ECREndpoint: config.ecrEndpoint,
+		STSEndpoint: config.stsEndpoint,
+		S3Endpoint:  config.s3Endpoint,
+		HTTP:        httpConfig,
+	})
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	if config.ssmPath != "" {
+		ttl, err := time.ParseDuration(config.ssmTTL)
+		if err != nil {
+			return errorResponse(err), err
+		}
+
+		if parameterStore == nil {
+			parameterStore = api.NewParameterStore(config.ssmPath, ttl, ssm.New(sess))
+		}
+		parameters, err = parameterStore.Load()
+		if err != nil {
+			return errorResponse(err), err
+		}
+
+		// Read the configuration again, now with parameters in place
+		config, err = initConfig()
+		if err != nil {
+			return errorResponse(err), err
+		}
+	}
+
 	nw, err := strconv.ParseInt(config.numWorkers, 10, 64)
 	if err != nil {
 		return errorResponse(err), err
@@ -115,13 +221,36 @@ func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 		return errorResponse(err), err
 	}
 
+	tagFilter, err := api.ParseTagFilter(config.tagFilter)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	multiArch, err := strconv.ParseBool(config.multiArch)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	maxImageAge, err := strconv.Atoi(config.maxImageAge)
+	if err != nil {
+		return errorResponse(err), err
+	}
+
+	options := api.Options{
+		TagFilter:            tagFilter,
+		ResolveManifestLists: multiArch,
+		MaxImageAge:          time.Duration(maxImageAge) * 24 * time.Hour,
+	}
+
 	app := app{
-		api:        api.NewECRService(config.ecrID, config.region, config.imageTag, logger, ecr.New(sess)),
-		env:        config.env,
-		imageTag:   config.imageTag,
-		logger:     logger,
-		numWorkers: int(nw),
-		region:     config.region,
+		api:         api.NewECRService(config.ecrID, config.region, config.imageTag, options, logger, ecrClient(sess)),
+		env:         config.env,
+		imageTag:    config.imageTag,
+		logger:      logger,
+		multiArch:   multiArch,
+		numWorkers:  int(nw),
+		pullThrough: config.pullThrough,
+		region:      config.region,
 	}
 	return app.Handle(request), nil
 }